@@ -28,16 +28,28 @@ while IFS= read -d $'\0' -r dir; do
     # build image
     svcname="$(basename "${dir}")"
     builddir="${dir}"
+    contextdir="${dir}"
     #PR 516 moved cartservice build artifacts one level down to src
     if [ $svcname == "cartservice" ] 
     then
         builddir="${dir}/src"
+        contextdir="${builddir}"
+    fi
+    # shippingservice builds with the shared packages in src/internal
+    if [ $svcname == "shippingservice" ]
+    then
+        contextdir="${dir}/.."
+    fi
+    # skip directories that hold no service, such as src/internal
+    if [ ! -f "${builddir}/Dockerfile" ]
+    then
+        continue
     fi
     image="${REPO_PREFIX}/$svcname:$TAG"
     (
         cd "${builddir}"
         log "Building: ${image}"
-        docker build -t "${image}" .
+        docker build -t "${image}" -f "${builddir}/Dockerfile" "${contextdir}"
 
         log "Pushing: ${image}"
         docker push "${image}"
@@ -0,0 +1,83 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"google.golang.org/grpc"
+)
+
+// Resource describes the service: its name, overridden by OTEL_SERVICE_NAME,
+// the attributes of OTEL_RESOURCE_ATTRIBUTES, and those of the SDK.
+func Resource(ctx context.Context, serviceName string) (*resource.Resource, error) {
+	appResource, err := resource.New(
+		ctx,
+		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Merge(resource.Default(), appResource)
+}
+
+// SpanExporter returns an OTLP/gRPC span exporter for cfg, which also dials
+// with the given options.
+func SpanExporter(ctx context.Context, cfg OTLPConfig, dial ...grpc.DialOption) (*otlptrace.Exporter, error) {
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(cfg.Endpoint),
+		otlptracegrpc.WithTimeout(cfg.Timeout),
+	}
+	for _, d := range dial {
+		opts = append(opts, otlptracegrpc.WithDialOption(d))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if cfg.Compression == "gzip" {
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	}
+	return otlptrace.New(ctx, otlptracegrpc.NewClient(opts...))
+}
+
+// MetricExporter returns an OTLP/gRPC metric exporter for cfg, using the
+// given temporality if it is not nil, which also dials with the given
+// options.
+func MetricExporter(ctx context.Context, cfg OTLPConfig, temporality sdkmetric.TemporalitySelector, dial ...grpc.DialOption) (sdkmetric.Exporter, error) {
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(cfg.Endpoint),
+		otlpmetricgrpc.WithTimeout(cfg.Timeout),
+	}
+	for _, d := range dial {
+		opts = append(opts, otlpmetricgrpc.WithDialOption(d))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	if cfg.Compression == "gzip" {
+		opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
+	}
+	if temporality != nil {
+		opts = append(opts, otlpmetricgrpc.WithTemporalitySelector(temporality))
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
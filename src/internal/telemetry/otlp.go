@@ -0,0 +1,139 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOTLPEndpoint  = "http://localhost:4317"
+	defaultOTLPTimeoutMs = 10000
+)
+
+// OTLPConfig is the configuration of an OTLP/gRPC exporter.
+type OTLPConfig struct {
+	Endpoint    string // host:port
+	Insecure    bool
+	Timeout     time.Duration
+	Compression string // "gzip" or "none"
+}
+
+// OTLPConfigFromEnv reads the OTLP exporter configuration of a signal,
+// "TRACES" or "METRICS", as the OpenTelemetry environment variable
+// specification defines it: OTEL_EXPORTER_OTLP_<SIGNAL>_<NAME> takes
+// precedence over OTEL_EXPORTER_OTLP_<NAME>.
+//
+// The endpoint is a URL whose scheme, http or https, decides whether TLS is
+// used. For compatibility with the manifests, an endpoint without a scheme,
+// e.g. "otelcol:4317", is also accepted: it is plaintext unless
+// OTEL_EXPORTER_OTLP_INSECURE is false. Headers and TLS certificates are
+// read by the exporter itself.
+func OTLPConfigFromEnv(signal string) (OTLPConfig, error) {
+	cfg := OTLPConfig{Compression: "none"}
+
+	key, raw := otlpEnv(signal, "ENDPOINT")
+	if raw == "" {
+		key, raw = "", defaultOTLPEndpoint
+	}
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s=%q: %v", key, raw, err)
+		}
+		switch u.Scheme {
+		case "http":
+			cfg.Insecure = true
+		case "https":
+		default:
+			return cfg, fmt.Errorf("invalid %s=%q: scheme must be http or https", key, raw)
+		}
+		if u.Host == "" {
+			return cfg, fmt.Errorf("invalid %s=%q: no host", key, raw)
+		}
+		cfg.Endpoint = u.Host
+		if u.Port() == "" {
+			cfg.Endpoint += ":4317"
+		}
+	} else {
+		cfg.Endpoint = raw
+		insecureKey, _ := otlpEnv(signal, "INSECURE")
+		cfg.Insecure = envBool(insecureKey, true)
+	}
+
+	timeoutKey, _ := otlpEnv(signal, "TIMEOUT")
+	cfg.Timeout = time.Duration(envInt(timeoutKey, defaultOTLPTimeoutMs)) * time.Millisecond
+
+	if compressionKey, v := otlpEnv(signal, "COMPRESSION"); v != "" {
+		switch v {
+		case "gzip", "none":
+			cfg.Compression = v
+		default:
+			slog.Warn(fmt.Sprintf("ignoring invalid %s=%q: must be gzip or none", compressionKey, v))
+		}
+	}
+	return cfg, nil
+}
+
+// otlpEnv returns the name and value of the signal-specific variable if it is
+// set, or else of the general one.
+func otlpEnv(signal, name string) (string, string) {
+	key := "OTEL_EXPORTER_OTLP_" + signal + "_" + name
+	if v := os.Getenv(key); v != "" {
+		return key, v
+	}
+	key = "OTEL_EXPORTER_OTLP_" + name
+	return key, os.Getenv(key)
+}
+
+func (c OTLPConfig) String() string {
+	scheme := "https"
+	if c.Insecure {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s (timeout %s, compression %s)", scheme, c.Endpoint, c.Timeout, c.Compression)
+}
+
+func envInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("ignoring invalid %s=%q: %v", key, v, err))
+		return def
+	}
+	return n
+}
+
+func envBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("ignoring invalid %s=%q: %v", key, v, err))
+		return def
+	}
+	return b
+}
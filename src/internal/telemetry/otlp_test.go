@@ -0,0 +1,88 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// TestOTLPConfigFromEnv checks the precedence, defaults and scheme rules of
+// the OTLP exporter variables.
+func TestOTLPConfigFromEnv(t *testing.T) {
+	for _, k := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"} {
+		t.Setenv(k, "")
+	}
+
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		want OTLPConfig
+	}{
+		{"defaults", nil,
+			OTLPConfig{Endpoint: "localhost:4317", Insecure: true, Timeout: 10 * time.Second, Compression: "none"}},
+		{"legacy endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "otelcol:4317"},
+			OTLPConfig{Endpoint: "otelcol:4317", Insecure: true, Timeout: 10 * time.Second, Compression: "none"}},
+		{"legacy endpoint with TLS", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "otelcol:4317", "OTEL_EXPORTER_OTLP_INSECURE": "false"},
+			OTLPConfig{Endpoint: "otelcol:4317", Timeout: 10 * time.Second, Compression: "none"}},
+		{"https", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "https://collector.example.com", "OTEL_EXPORTER_OTLP_INSECURE": "true"},
+			OTLPConfig{Endpoint: "collector.example.com:4317", Timeout: 10 * time.Second, Compression: "none"}},
+		{"signal overrides", map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT":           "https://general:4317",
+			"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT":    "http://traces:14317",
+			"OTEL_EXPORTER_OTLP_TIMEOUT":            "500",
+			"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT":     "2500",
+			"OTEL_EXPORTER_OTLP_COMPRESSION":        "none",
+			"OTEL_EXPORTER_OTLP_TRACES_COMPRESSION": "gzip",
+		}, OTLPConfig{Endpoint: "traces:14317", Insecure: true, Timeout: 2500 * time.Millisecond, Compression: "gzip"}},
+		{"invalid values ignored", map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "soon", "OTEL_EXPORTER_OTLP_COMPRESSION": "zstd"},
+			OTLPConfig{Endpoint: "localhost:4317", Insecure: true, Timeout: 10 * time.Second, Compression: "none"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			got, err := OTLPConfigFromEnv("TRACES")
+			if err != nil {
+				t.Fatalf("TestOTLPConfigFromEnv: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("TestOTLPConfigFromEnv: got %v, expected %v", got, tc.want)
+			}
+		})
+	}
+
+	for _, endpoint := range []string{"grpc://otelcol:4317", "http://"} {
+		t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", endpoint)
+		if _, err := OTLPConfigFromEnv("METRICS"); err == nil {
+			t.Errorf("TestOTLPConfigFromEnv: endpoint %q was accepted", endpoint)
+		}
+	}
+}
+
+// TestServiceNameFromEnv checks that OTEL_SERVICE_NAME overrides the service
+// name of the resource.
+func TestServiceNameFromEnv(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "shipping-canary")
+	res, err := Resource(context.Background(), "shippingservice")
+	if err != nil {
+		t.Fatalf("TestServiceNameFromEnv: %v", err)
+	}
+	if v, _ := res.Set().Value(semconv.ServiceNameKey); v.AsString() != "shipping-canary" {
+		t.Errorf("TestServiceNameFromEnv: service.name is %q", v.AsString())
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package telemetry sets up the OpenTelemetry SDK the same way for every
+// workshop service: a resource named after the service, spans and metrics
+// exported over OTLP/gRPC as the OTEL_EXPORTER_OTLP_* variables configure,
+// and W3C trace context and baggage propagation. Services change the parts
+// they need, such as the sampler or extra span processors, with options.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+// config is what the options of Setup change.
+type config struct {
+	sampler     sdktrace.Sampler
+	export      func(sdktrace.SpanExporter) sdktrace.SpanProcessor
+	processors  []sdktrace.SpanProcessor
+	idGenerator sdktrace.IDGenerator
+	propagator  propagation.TextMapPropagator
+	views       []sdkmetric.View
+	temporality sdkmetric.TemporalitySelector
+	dial        func(signal string, cfg OTLPConfig) []grpc.DialOption
+}
+
+// Option changes how Setup sets up the SDK.
+type Option func(*config)
+
+// WithSampler samples spans with s instead of the parent-based sampler that
+// samples every root span.
+func WithSampler(s sdktrace.Sampler) Option {
+	return func(c *config) { c.sampler = s }
+}
+
+// WithExportProcessor builds the processor that spans are exported through
+// from the exporter, instead of a batch span processor with the default
+// settings.
+func WithExportProcessor(f func(sdktrace.SpanExporter) sdktrace.SpanProcessor) Option {
+	return func(c *config) { c.export = f }
+}
+
+// WithSpanProcessors adds processors that spans go through besides the
+// export processor, such as ones that keep them in memory.
+func WithSpanProcessors(p ...sdktrace.SpanProcessor) Option {
+	return func(c *config) { c.processors = append(c.processors, p...) }
+}
+
+// WithIDGenerator generates trace and span IDs with g instead of at random.
+func WithIDGenerator(g sdktrace.IDGenerator) Option {
+	return func(c *config) { c.idGenerator = g }
+}
+
+// WithPropagator installs p as the global propagator instead of trace context
+// and baggage.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) { c.propagator = p }
+}
+
+// WithMetricViews applies views to the metrics.
+func WithMetricViews(views ...sdkmetric.View) Option {
+	return func(c *config) { c.views = append(c.views, views...) }
+}
+
+// WithTemporality exports metrics with the temporality selected by s, if it is
+// not nil, instead of the cumulative temporality.
+func WithTemporality(s sdkmetric.TemporalitySelector) Option {
+	return func(c *config) { c.temporality = s }
+}
+
+// WithDialOptions adds the options returned by f to the connection of the
+// exporter of each signal, "traces" or "metrics", for instance to measure
+// what they send.
+func WithDialOptions(f func(signal string, cfg OTLPConfig) []grpc.DialOption) Option {
+	return func(c *config) { c.dial = f }
+}
+
+// Setup installs the global tracer and meter providers of serviceName and the
+// global propagator. It returns a function that exports what is buffered and
+// shuts the providers down, which the service calls as it exits.
+//
+// Unless OTEL_GO_X_EXEMPLAR is set, measurements made within sampled spans
+// carry their trace IDs as exemplars.
+func Setup(ctx context.Context, serviceName string, opts ...Option) (shutdown func(context.Context) error, err error) {
+	c := config{
+		sampler:    sdktrace.ParentBased(sdktrace.AlwaysSample()),
+		export:     func(exp sdktrace.SpanExporter) sdktrace.SpanProcessor { return sdktrace.NewBatchSpanProcessor(exp) },
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		dial:       func(string, OTLPConfig) []grpc.DialOption { return nil },
+	}
+	for _, o := range opts {
+		o(&c)
+	}
+	if _, ok := os.LookupEnv("OTEL_GO_X_EXEMPLAR"); !ok {
+		os.Setenv("OTEL_GO_X_EXEMPLAR", "true")
+	}
+
+	res, err := Resource(ctx, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("detect resource: %w", err)
+	}
+
+	metricCfg, err := OTLPConfigFromEnv("METRICS")
+	if err != nil {
+		return nil, err
+	}
+	metricExp, err := MetricExporter(ctx, metricCfg, c.temporality, c.dial("metrics", metricCfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("create metric exporter: %w", err)
+	}
+	slog.Info("exporting metrics to OTLP collector at " + metricCfg.String())
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExp)),
+		sdkmetric.WithView(c.views...),
+	)
+
+	spanCfg, err := OTLPConfigFromEnv("TRACES")
+	if err != nil {
+		mp.Shutdown(ctx)
+		return nil, err
+	}
+	spanExp, err := SpanExporter(ctx, spanCfg, c.dial("traces", spanCfg)...)
+	if err != nil {
+		mp.Shutdown(ctx)
+		return nil, fmt.Errorf("create span exporter: %w", err)
+	}
+	slog.Info("exporting spans to OTLP collector at " + spanCfg.String())
+	tpOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(c.sampler),
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(c.export(spanExp)),
+	}
+	for _, p := range c.processors {
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(p))
+	}
+	if c.idGenerator != nil {
+		tpOpts = append(tpOpts, sdktrace.WithIDGenerator(c.idGenerator))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
+
+	otel.SetMeterProvider(mp)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(c.propagator)
+	return func(ctx context.Context) error {
+		// Spans go first: ending them may record metrics.
+		return errors.Join(tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// TestSetup checks that Setup installs the providers and propagator, with
+// the spans going through the processors it is given, and that shutting
+// down ends them.
+func TestSetup(t *testing.T) {
+	tp, mp, prop := otel.GetTracerProvider(), otel.GetMeterProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(tp)
+		otel.SetMeterProvider(mp)
+		otel.SetTextMapPropagator(prop)
+	}()
+	// Nothing listens there, so exports fail fast.
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "100")
+	rec := tracetest.NewSpanRecorder()
+	ctx := context.Background()
+	shutdown, err := Setup(ctx, "testservice", WithSampler(sdktrace.AlwaysSample()), WithSpanProcessors(rec))
+	if err != nil {
+		t.Fatalf("TestSetup: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(ctx, "work")
+	span.End()
+	if fields := otel.GetTextMapPropagator().Fields(); len(fields) != 3 {
+		t.Errorf("TestSetup: propagator fields %v, want traceparent, tracestate and baggage", fields)
+	}
+	stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	shutdown(stopCtx)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("TestSetup: recorded %d spans, want 1", len(spans))
+	}
+	if v, _ := spans[0].Resource().Set().Value(semconv.ServiceNameKey); v.AsString() != "testservice" {
+		t.Errorf("TestSetup: service.name is %q", v.AsString())
+	}
+	if !rec.Started()[0].SpanContext().IsSampled() {
+		t.Error("TestSetup: span was not sampled")
+	}
+}
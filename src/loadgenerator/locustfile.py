@@ -28,6 +28,11 @@ products = [
     'LS4PSXUNUM',
     'OLJCESPC7Z']
 
+# Synthetic users belong to a customer tier, propagated as W3C baggage so
+# that services can sample their traces by tier.
+tiers = ['gold', 'silver', 'free']
+tier_weights = [1, 3, 6]
+
 states = ["AL","AK","AZ","AR","CA","CO","CT","DE","FL"]
 zips = [93154,93254,43154,9954,4315,9154,93159,123]
 
@@ -70,6 +75,8 @@ def checkout(l):
 class UserBehavior(TaskSet):
 
     def on_start(self):
+        tier = random.choices(tiers, weights=tier_weights)[0]
+        self.client.headers['baggage'] = 'customer.tier=' + tier
         index(self)
 
     tasks = {index: 1,
@@ -0,0 +1,104 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// accessLogger writes one structured line per RPC. Failed calls are always
+// logged; successful ones are sampled at sampleRate. The sampling decision is
+// taken from the trace ID, so a sampled request is logged by every service
+// using the same rate and the log lines of one trace stay together. Health
+// checks are not logged unless healthChecks is set.
+type accessLogger struct {
+	log          *logger
+	sampleRate   float64
+	healthChecks bool
+}
+
+func accessLoggerFromEnv() *accessLogger {
+	return &accessLogger{log: log, sampleRate: envFloat("ACCESS_LOG_SAMPLE_RATE", 1), healthChecks: healthCheckTelemetry()}
+}
+
+// sampled reports whether a successful call should be logged.
+func (a *accessLogger) sampled(sc trace.SpanContext) bool {
+	switch {
+	case a.sampleRate >= 1:
+		return true
+	case a.sampleRate <= 0:
+		return false
+	case sc.HasTraceID():
+		id := sc.TraceID()
+		return float64(binary.BigEndian.Uint64(id[8:])>>1) < a.sampleRate*float64(math.MaxInt64)
+	default:
+		return random.Float64() < a.sampleRate
+	}
+}
+
+func (a *accessLogger) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !a.healthChecks && isHealthCheck(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		sc := trace.SpanContextFromContext(ctx)
+		if code == codes.OK && !a.sampled(sc) {
+			return resp, err
+		}
+		entry := a.log.Ctx(ctx).With(
+			"grpc.method", info.FullMethod,
+			"grpc.code", code.String(),
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"request_bytes", messageSize(req),
+			"response_bytes", messageSize(resp),
+			"logging.sampled", code == codes.OK && a.sampleRate < 1,
+		)
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			entry = entry.With("peer.address", p.Addr.String())
+		}
+		switch code {
+		case codes.OK:
+			entry.Info("access")
+		case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.DeadlineExceeded, codes.Unimplemented:
+			entry.WithError(err).Error("access")
+		default:
+			entry.WithError(err).Warn("access")
+		}
+		return resp, err
+	}
+}
+
+// messageSize returns the encoded size of a protobuf message, or 0 for
+// anything else.
+func messageSize(v interface{}) int {
+	if m, ok := v.(proto.Message); ok && m != nil {
+		return proto.Size(m)
+	}
+	return 0
+}
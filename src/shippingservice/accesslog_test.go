@@ -0,0 +1,98 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestAccessLog checks that sampled-out successes and health checks are skipped and errors are always logged with their trace.
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(&buf, "", "json")
+	if err != nil {
+		t.Fatalf("TestAccessLog: %v", err)
+	}
+	intercept := (&accessLogger{log: l, sampleRate: 0}).unary()
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	req := &pb.GetQuoteRequest{Address: &pb.Address{City: "London"}}
+
+	intercept(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &pb.GetQuoteResponse{}, nil
+	})
+	if buf.Len() != 0 {
+		t.Errorf("TestAccessLog: sampled-out success was logged: %s", buf.String())
+	}
+	health := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	intercept(ctx, nil, health, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	})
+	if buf.Len() != 0 {
+		t.Errorf("TestAccessLog: failed health check was logged: %s", buf.String())
+	}
+
+	intercept(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "boom")
+	})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("TestAccessLog: got %d lines, expected 1", len(lines))
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("TestAccessLog: %v", err)
+	}
+	for k, want := range map[string]interface{}{
+		"grpc.method": info.FullMethod,
+		"grpc.code":   "Internal",
+		"trace_id":    sc.TraceID().String(),
+		"severity":    "ERROR",
+	} {
+		if entry[k] != want {
+			t.Errorf("TestAccessLog: %s = %v, expected %v", k, entry[k], want)
+		}
+	}
+	if entry["request_bytes"].(float64) == 0 {
+		t.Errorf("TestAccessLog: request_bytes was not recorded")
+	}
+}
+
+// TestAccessLogSampling checks that the sampling decision follows the trace ID.
+func TestAccessLogSampling(t *testing.T) {
+	a := &accessLogger{sampleRate: 0.5}
+	low := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{15: 1}})
+	high := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{8: 0xff, 15: 1}})
+	if !a.sampled(low) || a.sampled(high) {
+		t.Errorf("TestAccessLogSampling: got %v and %v, expected true and false", a.sampled(low), a.sampled(high))
+	}
+}
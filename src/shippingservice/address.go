@@ -0,0 +1,63 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const maxZipCode = 99999
+
+// validateAddress checks that an address can be shipped to. US addresses need
+// a five digit zip code; elsewhere the zip code is optional but may not be
+// negative.
+func validateAddress(a *pb.Address) []*errdetails.BadRequest_FieldViolation {
+	if a == nil {
+		return []*errdetails.BadRequest_FieldViolation{{Field: "address", Description: "address is required"}}
+	}
+	zip := a.GetZipCode()
+	switch {
+	case zip < 0 || zip > maxZipCode:
+		return []*errdetails.BadRequest_FieldViolation{{
+			Field:       "address.zip_code",
+			Description: fmt.Sprintf("zip code %d is not between 0 and %d", zip, maxZipCode),
+		}}
+	case zip == 0 && isDomestic(a):
+		return []*errdetails.BadRequest_FieldViolation{{
+			Field:       "address.zip_code",
+			Description: "zip code is required for US addresses",
+		}}
+	}
+	return nil
+}
+
+// formatAddress formats an address on one line as "street, city, state,
+// zip", in a pooled builder since ShipOrder does it on every call.
+func formatAddress(a *pb.Address) string {
+	b := getBuilder()
+	defer b.release()
+	b.WriteString(a.GetStreetAddress())
+	b.WriteString(", ")
+	b.WriteString(a.GetCity())
+	b.WriteString(", ")
+	b.WriteString(a.GetState())
+	b.WriteString(", ")
+	b.writeInt(int64(a.GetZipCode()))
+	return b.String()
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	defaultAdminPort = "8081"
+	defaultAdminHost = "127.0.0.1"
+)
+
+// adminServer is a plain HTTP server for operating the service: inspecting
+// and changing its runtime settings. It listens on the loopback interface
+// unless told otherwise, so that it is not exposed outside the pod.
+type adminServer struct {
+	addr string
+	mux  *http.ServeMux
+}
+
+func newAdminServer(addr string) *adminServer {
+	return &adminServer{addr: addr, mux: http.NewServeMux()}
+}
+
+// adminServerFromEnv listens on ADMIN_PORT of ADMIN_HOST, or returns nil if
+// the port is set to "off". ADMIN_HOST=0.0.0.0 listens on every interface.
+func adminServerFromEnv() *adminServer {
+	port := os.Getenv("ADMIN_PORT")
+	switch port {
+	case "off":
+		return nil
+	case "":
+		port = defaultAdminPort
+	}
+	host, ok := os.LookupEnv("ADMIN_HOST")
+	if !ok {
+		host = defaultAdminHost
+	}
+	return newAdminServer(net.JoinHostPort(host, port))
+}
+
+func (a *adminServer) handle(pattern string, h http.Handler) {
+	a.mux.Handle(pattern, h)
+}
+
+// serve runs the admin server until it fails.
+func (a *adminServer) serve() {
+	log.Infof("admin server listening on %s", a.addr)
+	srv := &http.Server{Addr: a.addr, Handler: a.mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		log.WithError(err).Error("admin server stopped")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// prodDeniedAttributes are the personal details a customer's address is made
+// of, under the names the workshop exercises use and the app.* names.
+var prodDeniedAttributes = []string{
+	"address", "address.*", "*.address.*",
+	"street*", "*.street*",
+	"city", "*.city",
+	"zipcode", "zip_code", "*.zipcode", "*.zip_code",
+}
+
+// attributePolicy decides which attribute keys may leave the service. Keys
+// matching a deny pattern are removed unless they also match an allow
+// pattern. Patterns use path.Match syntax, where "*" spans dots, so
+// "*.city" matches "app.address.city".
+type attributePolicy struct {
+	allow []string
+	deny  []string
+	// known remembers the decision made for each key, if set, since matching
+	// every attribute of every span against the patterns is costly and spans
+	// only use a few keys.
+	known *sync.Map // attribute.Key to bool
+}
+
+// attributePolicyFromEnv starts from the preset named by SPAN_ATTRIBUTE_POLICY
+// ("workshop", the default, keeps everything; "prod" drops address details)
+// and adds the patterns in SPAN_ATTRIBUTE_ALLOW and SPAN_ATTRIBUTE_DENY.
+func attributePolicyFromEnv() attributePolicy {
+	var p attributePolicy
+	switch mode := strings.ToLower(os.Getenv("SPAN_ATTRIBUTE_POLICY")); mode {
+	case "", "workshop":
+	case "prod":
+		p.deny = append(p.deny, prodDeniedAttributes...)
+	default:
+		log.Fatalf("unknown SPAN_ATTRIBUTE_POLICY %q", mode)
+	}
+	p.allow = append(p.allow, splitList(os.Getenv("SPAN_ATTRIBUTE_ALLOW"))...)
+	p.deny = append(p.deny, splitList(os.Getenv("SPAN_ATTRIBUTE_DENY"))...)
+	for _, pattern := range append(p.allow, p.deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Fatalf("invalid span attribute pattern %q: %v", pattern, err)
+		}
+	}
+	return p
+}
+
+func (p attributePolicy) permits(key attribute.Key) bool {
+	if p.known != nil {
+		if ok, found := p.known.Load(key); found {
+			return ok.(bool)
+		}
+	}
+	ok := !matchAny(p.deny, string(key)) || matchAny(p.allow, string(key))
+	if p.known != nil {
+		p.known.Store(key, ok)
+	}
+	return ok
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the permitted attributes and how many were removed.
+func (p attributePolicy) filter(attrs []attribute.KeyValue) ([]attribute.KeyValue, int) {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		if p.permits(kv.Key) {
+			if out != nil {
+				out = append(out, kv)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]attribute.KeyValue, 0, len(attrs)-1), attrs[:i]...)
+		}
+	}
+	if out == nil {
+		return attrs, 0
+	}
+	return out, len(attrs) - len(out)
+}
+
+// attributeFilter is a span processor that applies the policy to every
+// finished span, and to its events, before passing it on. Doing this in one
+// place means no handler can leak an attribute the deployment forbids.
+type attributeFilter struct {
+	sdktrace.SpanProcessor
+	policy attributePolicy
+}
+
+// newAttributeFilter wraps next, or returns it unchanged if the policy
+// removes nothing.
+func newAttributeFilter(next sdktrace.SpanProcessor, policy attributePolicy) sdktrace.SpanProcessor {
+	if len(policy.deny) == 0 {
+		return next
+	}
+	policy.known = new(sync.Map)
+	return attributeFilter{SpanProcessor: next, policy: policy}
+}
+
+func (f attributeFilter) OnEnd(s sdktrace.ReadOnlySpan) {
+	attrs, removed := f.policy.filter(s.Attributes())
+	f.SpanProcessor.OnEnd(filteredSpan{ReadOnlySpan: s, policy: f.policy, attrs: attrs, removed: removed})
+}
+
+// filteredSpan presents a finished span without the attributes its policy
+// removes. Removed span attributes are counted as dropped.
+type filteredSpan struct {
+	sdktrace.ReadOnlySpan
+	policy  attributePolicy
+	attrs   []attribute.KeyValue
+	removed int
+}
+
+func (s filteredSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
+
+func (s filteredSpan) DroppedAttributes() int {
+	return s.ReadOnlySpan.DroppedAttributes() + s.removed
+}
+
+func (s filteredSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	if len(events) == 0 {
+		return events
+	}
+	out := make([]sdktrace.Event, len(events))
+	for i, ev := range events {
+		var removed int
+		ev.Attributes, removed = s.policy.filter(ev.Attributes)
+		ev.DroppedAttributeCount += removed
+		out[i] = ev
+	}
+	return out
+}
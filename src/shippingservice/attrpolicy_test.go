@@ -0,0 +1,108 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestAttributeFilter checks that denied attributes are removed from spans and events unless allowed.
+func TestAttributeFilter(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	policy := attributePolicy{allow: []string{"app.address.state"}, deny: prodDeniedAttributes}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newAttributeFilter(rec, policy)))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "ShipOrder")
+	span.SetAttributes(
+		attribute.String("city", "Mountain View"),
+		attribute.String("app.address.street_address", "1600 Amphitheatre Parkway"),
+		attribute.String("app.address.state", "CA"),
+		attribute.String("shipment.tracking_id", "OB-1"),
+	)
+	span.AddEvent("shipment.created", trace.WithAttributes(
+		attribute.Int("zipcode", 94043),
+		attribute.String("shipment.status", "CREATED"),
+	))
+	span.End()
+
+	got := rec.Ended()[0]
+	keys := map[attribute.Key]bool{}
+	for _, kv := range got.Attributes() {
+		keys[kv.Key] = true
+	}
+	if keys["city"] || keys["app.address.street_address"] || !keys["app.address.state"] || !keys["shipment.tracking_id"] {
+		t.Errorf("TestAttributeFilter: span kept %v", got.Attributes())
+	}
+	if got.DroppedAttributes() != 2 {
+		t.Errorf("TestAttributeFilter: %d attributes dropped, expected 2", got.DroppedAttributes())
+	}
+	ev := got.Events()[0]
+	if len(ev.Attributes) != 1 || ev.Attributes[0].Key != "shipment.status" || ev.DroppedAttributeCount != 1 {
+		t.Errorf("TestAttributeFilter: event kept %v", ev.Attributes)
+	}
+}
+
+// TestAttributeFilterWorkshop checks that the default policy leaves the processor unwrapped.
+func TestAttributeFilterWorkshop(t *testing.T) {
+	t.Setenv("SPAN_ATTRIBUTE_POLICY", "workshop")
+	rec := tracetest.NewSpanRecorder()
+	if p := newAttributeFilter(rec, attributePolicyFromEnv()); p != sdktrace.SpanProcessor(rec) {
+		t.Errorf("TestAttributeFilterWorkshop: processor was wrapped in %T", p)
+	}
+}
+
+// attributeReader is a span processor that reads the attributes of finished
+// spans, as an exporter would, and keeps nothing.
+type attributeReader struct{ sdktrace.SpanProcessor }
+
+func (attributeReader) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (attributeReader) OnEnd(s sdktrace.ReadOnlySpan) {
+	s.Attributes()
+	s.DroppedAttributes()
+	s.Events()
+}
+
+// BenchmarkSpanAttributes measures a span with the attributes of a GetQuote
+// call ended through the prod policy, which checks every attribute.
+func BenchmarkSpanAttributes(b *testing.B) {
+	policy := attributePolicy{deny: prodDeniedAttributes}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newAttributeFilter(attributeReader{}, policy)))
+	tr := tp.Tracer("bench")
+	key := quoteCacheKey{zone: zoneLocal, weightBucket: 2, method: pb.ShippingMethod_SHIPPING_METHOD_EXPRESS, ratesVersion: "8f3ac2d1"}
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, span := tr.Start(ctx, "hipstershop.ShippingService/GetQuote")
+		span.SetAttributes(
+			attribute.String("rates.version", key.ratesVersion),
+			attribute.Bool("rates.precomputed", true),
+			attribute.Bool("quote.cache_hit", false),
+			attribute.Bool("quote.coalesced", false),
+			attribute.String("quote.id", "a1d31aa2-7e05-57ef-89ce-820ce27537f5"),
+			attribute.String("shipping.zone", key.zone.String()),
+			attribute.String("app.address.city", "Mountain View"),
+		)
+		span.End()
+	}
+}
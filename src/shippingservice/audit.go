@@ -0,0 +1,196 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// auditActorHeader is the metadata key callers use to say on whose behalf an
+// order is shipped.
+const auditActorHeader = "x-user-id"
+
+var errAuditTampered = errors.New("audit log has been modified")
+
+type auditItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int32  `json:"quantity"`
+}
+
+type auditAddress struct {
+	StreetAddress string `json:"street_address"`
+	City          string `json:"city"`
+	State         string `json:"state"`
+	Country       string `json:"country"`
+	ZipCode       int32  `json:"zip_code"`
+}
+
+// auditEntry records who shipped what, where and when. Entries form a hash
+// chain: each carries the hash of the one before it, so changing, removing
+// or reordering an entry breaks every hash that follows.
+type auditEntry struct {
+	Seq         int64        `json:"seq"`
+	Time        time.Time    `json:"time"`
+	Operation   string       `json:"operation"`
+	Actor       string       `json:"actor"`
+	Peer        string       `json:"peer,omitempty"`
+	TrackingID  string       `json:"tracking_id"`
+	QuoteID     string       `json:"quote_id,omitempty"`
+	Items       []auditItem  `json:"items"`
+	Destination auditAddress `json:"destination"`
+	TraceID     string       `json:"trace_id,omitempty"`
+	PrevHash    string       `json:"prev_hash"`
+	Hash        string       `json:"hash"`
+}
+
+func newShipOrderAudit(trackingID string, in *pb.ShipOrderRequest) auditEntry {
+	e := auditEntry{
+		Operation:  "ShipOrder",
+		TrackingID: trackingID,
+		QuoteID:    in.QuoteId,
+		Items:      make([]auditItem, 0, len(in.Items)),
+	}
+	for _, it := range in.Items {
+		e.Items = append(e.Items, auditItem{ProductID: it.GetProductId(), Quantity: it.GetQuantity()})
+	}
+	if a := in.Address; a != nil {
+		e.Destination = auditAddress{a.StreetAddress, a.City, a.State, a.Country, a.ZipCode}
+	}
+	return e
+}
+
+// digest returns the hash of the entry, covering every field but Hash itself.
+func (e auditEntry) digest() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditLog appends entries, one JSON object per line, to a sink of its own,
+// kept apart from the application log. A nil *auditLog records nothing.
+type auditLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	seq  int64
+	last string
+	now  func() time.Time
+}
+
+func newAuditLog(w io.Writer) *auditLog {
+	return &auditLog{w: w, now: time.Now}
+}
+
+// auditLogFromEnv opens AUDIT_LOG_FILE for appending, after checking that the
+// entries already in it are intact, and continues their chain. It returns nil
+// if no file is configured.
+func auditLogFromEnv() *auditLog {
+	path := os.Getenv("AUDIT_LOG_FILE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	seq, last, err := verifyAuditLog(f)
+	if err != nil {
+		log.Fatalf("refusing to append to audit log %s: %v", path, err)
+	}
+	a := newAuditLog(f)
+	a.seq, a.last = seq, last
+	log.Infof("writing audit log to %s, continuing after entry %d", path, seq)
+	return a
+}
+
+// record fills in the caller, sequence number and hashes of e and appends it.
+// The entry is written before the operation it describes is carried out, so
+// an error means the operation must not go ahead.
+func (a *auditLog) record(ctx context.Context, e auditEntry) error {
+	if a == nil {
+		return nil
+	}
+	e.Actor = auditActor(ctx)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		e.Peer = p.Addr.String()
+	}
+	span := trace.SpanFromContext(ctx)
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		e.TraceID = sc.TraceID().String()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e.Seq = a.seq + 1
+	e.Time = a.now().UTC()
+	e.PrevHash = a.last
+	e.Hash = e.digest()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	a.seq, a.last = e.Seq, e.Hash
+	span.SetAttributes(attribute.Int64("audit.seq", e.Seq))
+	return nil
+}
+
+// auditActor returns the user named in the request metadata, or "anonymous".
+func auditActor(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(auditActorHeader); len(v) > 0 && v[0] != "" {
+		return v[0]
+	}
+	return "anonymous"
+}
+
+// verifyAuditLog checks the hash chain of an audit log and returns the
+// sequence number and hash of its last entry.
+func verifyAuditLog(r io.Reader) (int64, string, error) {
+	var seq int64
+	var last string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return 0, "", fmt.Errorf("entry after %d: %w", seq, err)
+		}
+		if e.Seq != seq+1 || e.PrevHash != last || e.Hash != e.digest() {
+			return 0, "", fmt.Errorf("%w at entry %d", errAuditTampered, seq+1)
+		}
+		seq, last = e.Seq, e.Hash
+	}
+	return seq, last, sc.Err()
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestShipOrderAudit checks that shipping an order appends a verifiable entry naming the caller.
+func TestShipOrderAudit(t *testing.T) {
+	var buf bytes.Buffer
+	s := newServer()
+	s.audit = newAuditLog(&buf)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auditActorHeader, "alice"))
+	req := &pb.ShipOrderRequest{
+		Address: &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043},
+		Items:   []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}},
+	}
+	res, err := s.ShipOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("TestShipOrderAudit: %v", err)
+	}
+	if _, err := s.ShipOrder(context.Background(), req); err != nil {
+		t.Fatalf("TestShipOrderAudit: %v", err)
+	}
+
+	var first auditEntry
+	if err := json.Unmarshal([]byte(strings.SplitN(buf.String(), "\n", 2)[0]), &first); err != nil {
+		t.Fatalf("TestShipOrderAudit: %v", err)
+	}
+	if first.Actor != "alice" || first.TrackingID != res.TrackingId || first.Destination.City != "Mountain View" ||
+		len(first.Items) != 1 || first.Items[0].Quantity != 2 {
+		t.Errorf("TestShipOrderAudit: unexpected entry %+v", first)
+	}
+	seq, last, err := verifyAuditLog(strings.NewReader(buf.String()))
+	if err != nil || seq != 2 || last == "" {
+		t.Errorf("TestShipOrderAudit: verify gave %d, %q, %v", seq, last, err)
+	}
+}
+
+// TestAuditLogTamperEvident checks that edited, removed and reordered entries are detected.
+func TestAuditLogTamperEvident(t *testing.T) {
+	var buf bytes.Buffer
+	a := newAuditLog(&buf)
+	for _, id := range []string{"OB-1", "OB-2", "OB-3"} {
+		if err := a.record(context.Background(), auditEntry{Operation: "ShipOrder", TrackingID: id}); err != nil {
+			t.Fatalf("TestAuditLogTamperEvident: %v", err)
+		}
+	}
+	lines := strings.SplitAfter(strings.TrimSpace(buf.String()), "\n")
+
+	for name, contents := range map[string]string{
+		"edited":    strings.Replace(buf.String(), "OB-2", "OB-9", 1),
+		"removed":   lines[0] + lines[2],
+		"reordered": lines[1] + lines[0] + lines[2],
+	} {
+		if _, _, err := verifyAuditLog(strings.NewReader(contents)); !errors.Is(err, errAuditTampered) {
+			t.Errorf("TestAuditLogTamperEvident: %s log gave %v, expected %v", name, err, errAuditTampered)
+		}
+	}
+
+	// A log reopened after a restart continues the existing chain.
+	seq, last, err := verifyAuditLog(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("TestAuditLogTamperEvident: %v", err)
+	}
+	b := newAuditLog(&buf)
+	b.seq, b.last = seq, last
+	b.record(context.Background(), auditEntry{Operation: "ShipOrder", TrackingID: "OB-4"})
+	if seq, _, err := verifyAuditLog(strings.NewReader(buf.String())); err != nil || seq != 4 {
+		t.Errorf("TestAuditLogTamperEvident: resumed log gave %d, %v", seq, err)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	defaultBatchWorkers = 4
+	maxBatchSize        = 500
+)
+
+// ShipOrders ships many orders in one call. Orders are processed concurrently
+// by a bounded pool of workers. Each order gets its own span which is linked
+// to the batch request span, so a single slow or failing order can be traced
+// on its own without losing track of the batch it came from.
+func (s *server) ShipOrders(ctx context.Context, in *pb.ShipOrdersRequest) (*pb.ShipOrdersResponse, error) {
+	log.Ctx(ctx).Infof("[ShipOrders] received request with %d orders", len(in.Orders))
+	defer log.Ctx(ctx).Info("[ShipOrders] completed request")
+
+	if len(in.Orders) > maxBatchSize {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonBatchTooLarge, map[string]string{"max_batch_size": strconv.Itoa(maxBatchSize)},
+			fmt.Sprintf("batch of %d orders exceeds the maximum of %d", len(in.Orders), maxBatchSize),
+			badRequest(&errdetails.BadRequest_FieldViolation{Field: "orders", Description: fmt.Sprintf("at most %d orders are allowed", maxBatchSize)}))
+	}
+
+	batchSpan := trace.SpanFromContext(ctx)
+	batchSpan.SetAttributes(attribute.Int("batch.size", len(in.Orders)))
+
+	workers := s.batchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+
+	ctx = s.prefetchQuotes(ctx, in.Orders)
+	results := make([]*pb.ShipOrderResult, len(in.Orders))
+	pool := newWorkerPool(workers, linkedSpans)
+	for i, order := range in.Orders {
+		i, order := i, order
+		ship := func(ctx context.Context) error {
+			var err error
+			results[i], err = s.shipBatchItem(withIdempotencyItem(ctx, strconv.Itoa(i)), order)
+			return err
+		}
+		// Stop handing out orders once the caller has gone away.
+		if !pool.submit(ctx, "ShipOrders/item", ship, trace.WithAttributes(attribute.Int("batch.index", i))) {
+			break
+		}
+	}
+	pool.wait()
+	if err := abandoned(ctx); err != nil {
+		return nil, err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Code != int32(codes.OK) {
+			failed++
+		}
+	}
+	batchSpan.SetAttributes(attribute.Int("batch.failed", failed))
+
+	return &pb.ShipOrdersResponse{Results: results}, nil
+}
+
+// shipBatchItem processes one order of a batch. It runs in the order's own
+// span, linked to the batch span rather than parented by it, and returns the
+// order's error as well as its result so that the span records it. A missing
+// order fails on its own, rather than being shipped as an empty one.
+func (s *server) shipBatchItem(ctx context.Context, order *pb.ShipOrderRequest) (*pb.ShipOrderResult, error) {
+	var res *pb.ShipOrderResponse
+	var err error
+	if order == nil {
+		err = rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "order is required",
+			badRequest(&errdetails.BadRequest_FieldViolation{Field: "order", Description: "must be set"}))
+	} else {
+		res, err = s.ShipOrder(ctx, order)
+	}
+	if err != nil {
+		st := status.Convert(err)
+		return &pb.ShipOrderResult{Code: int32(st.Code()), Error: st.Message()}, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("shipment.tracking_id", res.TrackingId))
+	return &pb.ShipOrderResult{TrackingId: res.TrackingId}, nil
+}
+
+type prefetchedQuotesKey struct{}
+
+// prefetchQuotes looks up the quotes the orders of a batch were placed
+// against in one round trip, if the quote repository can, and returns a
+// context that ShipOrder finds them in. Quotes that could not be fetched are
+// looked up by each order as usual.
+func (s *server) prefetchQuotes(ctx context.Context, orders []*pb.ShipOrderRequest) context.Context {
+	batch, ok := s.issued.(quoteBatchLookup)
+	if !ok {
+		return ctx
+	}
+	var ids []string
+	for _, order := range orders {
+		if order.QuoteId != "" {
+			ids = append(ids, order.QuoteId)
+		}
+	}
+	if len(ids) == 0 {
+		return ctx
+	}
+	quotes, err := batch.lookupMany(ctx, ids)
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("failed to prefetch the quotes of a batch")
+		return ctx
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("batch.quotes_prefetched", len(quotes)))
+	return context.WithValue(ctx, prefetchedQuotesKey{}, quotes)
+}
+
+// lookupQuote returns an issued quote, from the quotes prefetched for the
+// batch if the order is part of one.
+func (s *server) lookupQuote(ctx context.Context, id string) (issuedQuote, bool, error) {
+	if quotes, ok := ctx.Value(prefetchedQuotesKey{}).(map[string]issuedQuote); ok {
+		if q, ok := quotes[id]; ok && time.Now().Before(q.Expires) {
+			return q, true, nil
+		}
+	}
+	return s.issued.lookup(ctx, id)
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// quoteLine is one charge of a quote, in cents.
+type quoteLine struct {
+	kind        pb.QuoteLineItemType
+	description string
+	cents       int64
+}
+
+// quoteBreakdown is how a quote is made up, base rate first.
+type quoteBreakdown []quoteLine
+
+// breakdown returns the charges of an order whose parcel, matching key, is
+// priced at q: the base rate, the adjustment for the service level, the
+// signature and insurance fees, then the surcharges of the pricing rules
+// that apply at now. Each line is rounded to the cent on its own, so that the
+// lines add up to the total. Empty orders have no lines and cost nothing.
+func (rt *rateTable) breakdown(ctx context.Context, q Quote, key quoteCacheKey, opts shippingOptions, now time.Time) quoteBreakdown {
+	if q == (Quote{}) {
+		return nil
+	}
+	base := int64(q.Dollars)*100 + int64(q.Cents)
+	lines := quoteBreakdown{{kind: pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_BASE_RATE, description: "Base rate", cents: base}}
+	if m, ok := rt.Options.ServiceLevels[serviceLevelName(opts.level())]; ok && m != 1 {
+		lines = append(lines, quoteLine{
+			kind:        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_SERVICE_LEVEL,
+			description: fmt.Sprintf("%s service (x%g)", titleCase(serviceLevelName(opts.level())), m),
+			cents:       roundCents(float64(base) * (m - 1)),
+		})
+	}
+	if opts.Signature {
+		lines = append(lines, quoteLine{
+			kind:        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_SIGNATURE,
+			description: "Signature on delivery",
+			cents:       roundCents(rt.Options.Signature * 100),
+		})
+	}
+	if opts.Insured {
+		ins := rt.Options.Insurance
+		lines = append(lines, quoteLine{
+			kind:        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_INSURANCE,
+			description: fmt.Sprintf("Insurance of %s", money.Format(money.FromCents("USD", opts.DeclaredCents))),
+			cents:       roundCents(math.Max(ins.Rate*float64(opts.DeclaredCents), ins.Minimum*100)),
+		})
+	}
+	return rt.applyRules(ctx, lines, key, now)
+}
+
+func roundCents(c float64) int64 {
+	return int64(math.Round(c))
+}
+
+// titleCase upper-cases the first letter of an ASCII word.
+func titleCase(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	return string(s[0]-'a'+'A') + s[1:]
+}
+
+// cents is the sum of the lines.
+func (b quoteBreakdown) cents() int64 {
+	var cents int64
+	for _, l := range b {
+		cents += l.cents
+	}
+	return cents
+}
+
+// total is the sum of the lines as a quote.
+func (b quoteBreakdown) total() Quote {
+	cents := b.cents()
+	if cents <= 0 {
+		return Quote{}
+	}
+	return Quote{Dollars: uint32(cents / 100), Cents: uint32(cents % 100)}
+}
+
+// lineItems returns the lines as they are sent in a GetQuoteResponse.
+func (b quoteBreakdown) lineItems() []*pb.QuoteLineItem {
+	items := make([]*pb.QuoteLineItem, len(b))
+	for i, l := range b {
+		amount := money.FromCents("USD", l.cents)
+		items[i] = &pb.QuoteLineItem{Type: l.kind, Description: l.description, AmountUsd: &amount}
+	}
+	return items
+}
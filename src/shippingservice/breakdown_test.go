@@ -0,0 +1,79 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// TestQuoteBreakdown checks that a quote lists its charges in order and that
+// they add up to its cost.
+func TestQuoteBreakdown(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 3}}
+	declared := money.FromCents("USD", 4999)
+	for name, tc := range map[string]struct {
+		opts     *pb.ShippingOptions
+		items    []*pb.CartItem
+		want     []pb.QuoteLineItemType
+		discount bool
+	}{
+		"plain": {items: items, want: []pb.QuoteLineItemType{pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_BASE_RATE}},
+		"economy": {
+			opts:     &pb.ShippingOptions{ServiceLevel: pb.ServiceLevel_SERVICE_LEVEL_ECONOMY},
+			items:    items,
+			want:     []pb.QuoteLineItemType{pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_BASE_RATE, pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_SERVICE_LEVEL},
+			discount: true,
+		},
+		"everything": {
+			opts:  &pb.ShippingOptions{ServiceLevel: pb.ServiceLevel_SERVICE_LEVEL_PREMIUM, DeclaredValue: &declared, SignatureRequired: true, Insured: true},
+			items: items,
+			want: []pb.QuoteLineItemType{
+				pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_BASE_RATE,
+				pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_SERVICE_LEVEL,
+				pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_SIGNATURE,
+				pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_INSURANCE,
+			},
+		},
+		"empty": {opts: &pb.ShippingOptions{SignatureRequired: true}},
+	} {
+		quote, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: tc.items, Options: tc.opts})
+		if err != nil {
+			t.Fatalf("TestQuoteBreakdown: %s: %v", name, err)
+		}
+		if len(quote.LineItems) != len(tc.want) {
+			t.Errorf("TestQuoteBreakdown: %s: got %d line items, want %d", name, len(quote.LineItems), len(tc.want))
+			continue
+		}
+		var sum int64
+		for i, l := range quote.LineItems {
+			if l.Type != tc.want[i] || l.Description == "" {
+				t.Errorf("TestQuoteBreakdown: %s: line %d is %v %q, want %v", name, i, l.Type, l.Description, tc.want[i])
+			}
+			sum += money.Cents(*l.AmountUsd)
+		}
+		if got := money.Cents(*quote.CostUsd); got != sum {
+			t.Errorf("TestQuoteBreakdown: %s: line items add up to %d cents, cost is %d", name, sum, got)
+		}
+		if tc.discount && money.Cents(*quote.LineItems[1].AmountUsd) >= 0 {
+			t.Errorf("TestQuoteBreakdown: %s: economy is not a discount", name)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+)
+
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// circuitBreaker stops calls to a dependency after threshold consecutive
+// failures. Once cooldown has passed it lets a single probe call through
+// (half-open); the breaker closes if the probe succeeds and opens again if it
+// fails. Calls that were let through before the breaker opened do not change
+// its state when they finish, and calls cancelled by their caller count
+// neither as failures nor as successes.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration) *circuitBreaker {
+	b := &circuitBreaker{name: name, threshold: threshold, cooldown: cooldown, now: time.Now}
+	registerBreaker(b)
+	return b
+}
+
+// breakerFromEnv creates a breaker configured by BREAKER_THRESHOLD and
+// BREAKER_COOLDOWN.
+func breakerFromEnv(name string) *circuitBreaker {
+	return newCircuitBreaker(name,
+		envInt("BREAKER_THRESHOLD", defaultBreakerThreshold),
+		envDuration("BREAKER_COOLDOWN", defaultBreakerCooldown))
+}
+
+// allow reports whether a call may go ahead, returning errBreakerOpen if not,
+// and whether the call is the probe of a half-open breaker. Every allowed
+// call must be followed by a call to done.
+func (b *circuitBreaker) allow(ctx context.Context) (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		b.state = breakerHalfOpen
+	}
+	state := b.state
+	allowed := state == breakerClosed || (state == breakerHalfOpen && !b.probing)
+	if allowed && state == breakerHalfOpen {
+		b.probing, probe = true, true
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("breaker.name", b.name),
+		attribute.String("breaker.state", state.String()),
+	)
+	if !allowed {
+		return false, fmt.Errorf("%s: %w", b.name, errBreakerOpen)
+	}
+	return probe, nil
+}
+
+// done records the outcome of an allowed call, made with ctx. Only the probe
+// moves a half-open breaker, and only calls made while it was closed count
+// towards opening it.
+func (b *circuitBreaker) done(ctx context.Context, probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if failed && errors.Is(ctx.Err(), context.Canceled) {
+		// The caller gave up, which says nothing about the dependency.
+		return
+	}
+	if !probe && b.state != breakerClosed {
+		return
+	}
+	if !failed {
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if probe || b.failures >= b.threshold {
+		log.Warnf("circuit breaker %s opened after %d failure(s)", b.name, b.failures)
+		b.state, b.openedAt = breakerOpen, b.now()
+	}
+}
+
+func (b *circuitBreaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+var (
+	breakersMu    sync.Mutex
+	breakers      []*circuitBreaker
+	breakerGauge  sync.Once
+	breakerStates = map[breakerState]int64{breakerClosed: 0, breakerHalfOpen: 1, breakerOpen: 2}
+)
+
+// registerBreaker adds b to the shipping.breaker.state gauge, which reports 0
+// for closed, 1 for half-open and 2 for open.
+func registerBreaker(b *circuitBreaker) {
+	breakersMu.Lock()
+	breakers = append(breakers, b)
+	breakersMu.Unlock()
+
+	breakerGauge.Do(func() {
+		_, err := meter.Int64ObservableGauge("shipping.breaker.state",
+			metric.WithDescription("Circuit breaker state: 0 closed, 1 half-open, 2 open."),
+			metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+				breakersMu.Lock()
+				defer breakersMu.Unlock()
+				for _, b := range breakers {
+					o.Observe(breakerStates[b.currentState()], metric.WithAttributes(attribute.String("breaker.name", b.name)))
+				}
+				return nil
+			}),
+		)
+		if err != nil {
+			log.WithError(err).Warn("failed to create circuit breaker metric")
+		}
+	})
+}
+
+// breakerHook guards every Redis command with a circuit breaker. A cache miss
+// (redis.Nil) is not a failure.
+type breakerHook struct{ b *circuitBreaker }
+
+func (h breakerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h breakerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		probe, err := h.b.allow(ctx)
+		if err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err = next(ctx, cmd)
+		h.b.done(ctx, probe, err != nil && !errors.Is(err, redis.Nil))
+		return err
+	}
+}
+
+func (h breakerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		probe, err := h.b.allow(ctx)
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err = next(ctx, cmds)
+		h.b.done(ctx, probe, err != nil && !errors.Is(err, redis.Nil))
+		return err
+	}
+}
+
+// breakerTransport guards HTTP requests with one circuit breaker per host.
+// Transport errors and 5xx responses count as failures.
+type breakerTransport struct {
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerTransport(next http.RoundTripper) *breakerTransport {
+	return &breakerTransport{next: next, breakers: make(map[string]*circuitBreaker)}
+}
+
+func (t *breakerTransport) breaker(host string) *circuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = breakerFromEnv("http:" + host)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker(req.URL.Host)
+	probe, err := b.allow(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	b.done(req.Context(), probe, err != nil || resp.StatusCode >= 500)
+	return resp, err
+}
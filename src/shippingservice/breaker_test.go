@@ -0,0 +1,116 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker walks the breaker through open, half-open and closed.
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker("test", 2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	// A call still running when the breaker opens.
+	if _, err := b.allow(ctx); err != nil {
+		t.Fatalf("TestCircuitBreaker: straggler was refused: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := b.allow(ctx); err != nil {
+			t.Fatalf("TestCircuitBreaker: call %d was refused: %v", i, err)
+		}
+		b.done(ctx, false, true)
+	}
+	if _, err := b.allow(ctx); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("TestCircuitBreaker: got %v after 2 failures, expected %v", err, errBreakerOpen)
+	}
+	b.done(ctx, false, false)
+	if b.currentState() != breakerOpen {
+		t.Fatalf("TestCircuitBreaker: state is %s after a straggler succeeded, expected open", b.currentState())
+	}
+
+	// After the cooldown one probe is let through; a failed probe reopens.
+	now = now.Add(time.Minute)
+	probe, err := b.allow(ctx)
+	if err != nil || !probe {
+		t.Fatalf("TestCircuitBreaker: probe was refused: %v", err)
+	}
+	if _, err := b.allow(ctx); !errors.Is(err, errBreakerOpen) {
+		t.Errorf("TestCircuitBreaker: second concurrent probe was allowed")
+	}
+	b.done(ctx, true, true)
+	if b.currentState() != breakerOpen {
+		t.Fatalf("TestCircuitBreaker: state is %s after a failed probe, expected open", b.currentState())
+	}
+
+	// A probe cancelled by its caller lets the next one through.
+	now = now.Add(time.Minute)
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if probe, _ = b.allow(cctx); !probe {
+		t.Fatalf("TestCircuitBreaker: probe was refused")
+	}
+	b.done(cctx, true, true)
+	if b.currentState() != breakerHalfOpen {
+		t.Fatalf("TestCircuitBreaker: state is %s after a cancelled probe, expected half-open", b.currentState())
+	}
+
+	// A successful probe closes the breaker.
+	if probe, _ = b.allow(ctx); !probe {
+		t.Fatalf("TestCircuitBreaker: probe was refused")
+	}
+	b.done(ctx, true, false)
+	if b.currentState() != breakerClosed {
+		t.Errorf("TestCircuitBreaker: state is %s after a successful probe, expected closed", b.currentState())
+	}
+
+	// Cancelled calls are not failures.
+	for i := 0; i < 3; i++ {
+		b.allow(cctx)
+		b.done(cctx, false, true)
+	}
+	if b.currentState() != breakerClosed {
+		t.Errorf("TestCircuitBreaker: state is %s after cancelled calls, expected closed", b.currentState())
+	}
+}
+
+// TestBreakerTransport checks that a failing host stops receiving requests.
+func TestBreakerTransport(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: newBreakerTransport(http.DefaultTransport)}
+	for i := 0; i < defaultBreakerThreshold+3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != defaultBreakerThreshold {
+		t.Errorf("TestBreakerTransport: server received %d requests, expected %d", n, defaultBreakerThreshold)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// maxPooledBuilder is the largest buffer put back in the pool, so that one
+// unusually long string does not stay in memory for good.
+const maxPooledBuilder = 1 << 10
+
+// builders holds the buffers that handlers format their strings in, so that
+// under load each request reuses one instead of growing a new one.
+var builders = sync.Pool{New: func() any { return new(stringBuilder) }}
+
+// stringBuilder builds a string in a pooled buffer. It works like
+// strings.Builder, which cannot be pooled: its String hands over the buffer,
+// so a reset builder always starts from nothing. Here String copies the
+// buffer out, and release returns it to the pool.
+type stringBuilder struct {
+	buf []byte
+}
+
+// getBuilder returns an empty builder from the pool.
+func getBuilder() *stringBuilder {
+	return builders.Get().(*stringBuilder)
+}
+
+// release returns the builder to the pool; it must not be used afterwards.
+func (b *stringBuilder) release() {
+	if cap(b.buf) > maxPooledBuilder {
+		return
+	}
+	b.buf = b.buf[:0]
+	builders.Put(b)
+}
+
+func (b *stringBuilder) WriteString(s string) {
+	b.buf = append(b.buf, s...)
+}
+
+func (b *stringBuilder) WriteByte(c byte) error {
+	b.buf = append(b.buf, c)
+	return nil
+}
+
+func (b *stringBuilder) writeInt(n int64) {
+	b.buf = strconv.AppendInt(b.buf, n, 10)
+}
+
+func (b *stringBuilder) String() string {
+	return string(b.buf)
+}
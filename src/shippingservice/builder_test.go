@@ -0,0 +1,49 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestFormatAddress checks that addresses are formatted as before pooling,
+// and that a reused builder starts empty.
+func TestFormatAddress(t *testing.T) {
+	a := benchmarkAddress
+	want := fmt.Sprintf("%s, %s, %s, %d", a.StreetAddress, a.City, a.State, a.ZipCode)
+	for i := 0; i < 3; i++ {
+		if got := formatAddress(a); got != want {
+			t.Errorf("TestFormatAddress: got %q, want %q", got, want)
+		}
+	}
+
+	b := getBuilder()
+	b.WriteString(strings.Repeat("x", 2*maxPooledBuilder))
+	b.release()
+	b = getBuilder()
+	defer b.release()
+	if s := b.String(); s != "" {
+		t.Errorf("TestFormatAddress: pooled builder holds %d bytes", len(s))
+	}
+}
+
+func BenchmarkFormatAddress(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		formatAddress(benchmarkAddress)
+	}
+}
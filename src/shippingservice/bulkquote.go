@@ -0,0 +1,181 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// GetBulkQuote prices a stream of packages, one GetQuoteRequest each, and
+// returns their total once the client closes the stream. The whole stream is
+// a single server span, with a package.quoted event per package, so it shows
+// how a long-lived call looks next to the unary ones; the packages are priced
+// concurrently, each in a child span. Bulk quotes are estimates and issue no
+// quote ID.
+func (s *server) GetBulkQuote(stream pb.ShippingService_GetBulkQuoteServer) error {
+	ctx := stream.Context()
+	log.Ctx(ctx).Info("[GetBulkQuote] received request")
+	defer log.Ctx(ctx).Info("[GetBulkQuote] completed request")
+
+	// The rate table is read once, so every package of a stream is priced
+	// from the same version.
+	rates := s.rates.table()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("rates.version", rates.version), attribute.Bool("rates.precomputed", rates.matrix != nil))
+
+	var packages []*pb.GetQuoteRequest
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(packages) == maxBatchSize {
+			return rpcError(ctx, codes.InvalidArgument, reasonBatchTooLarge, map[string]string{"max_batch_size": strconv.Itoa(maxBatchSize)},
+				fmt.Sprintf("bulk quote exceeds the maximum of %d packages", maxBatchSize),
+				badRequest(&errdetails.BadRequest_FieldViolation{Field: "packages", Description: fmt.Sprintf("at most %d packages are allowed", maxBatchSize)}))
+		}
+		packages = append(packages, in)
+	}
+
+	// The packages are looked up in the cache together, and the quotes that
+	// were missing stored together, so that with Redis the whole stream costs
+	// two round trips.
+	keys := make([]quoteCacheKey, len(packages))
+	opts := make([]shippingOptions, len(packages))
+	values := make([]int64, len(packages))
+	for i, in := range packages {
+		var violations []*errdetails.BadRequest_FieldViolation
+		if opts[i], violations = rates.shippingOptions(in.Options, fmt.Sprintf("packages[%d].options", i)); len(violations) > 0 {
+			return rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid shipping options", badRequest(violations...))
+		}
+		if values[i], violations = orderValue(in.OrderValue, fmt.Sprintf("packages[%d].order_value", i)); len(violations) > 0 {
+			return rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid order value", badRequest(violations...))
+		}
+		if violations = validateDimensions(in.Dimensions, fmt.Sprintf("packages[%d].dimensions", i)); len(violations) > 0 {
+			return rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid item dimensions", badRequest(violations...))
+		}
+		keys[i] = newQuoteCacheKey(in, rates.version)
+	}
+	quotes, hits := s.quotes.getMany(ctx, keys)
+	if err := s.priceBulkPackages(ctx, packages, keys, quotes, hits, rates); err != nil {
+		return err
+	}
+	var missedKeys []quoteCacheKey
+	var missed []Quote
+	cacheHits := 0
+	for i, hit := range hits {
+		if hit {
+			cacheHits++
+			continue
+		}
+		missedKeys = append(missedKeys, keys[i])
+		missed = append(missed, quotes[i])
+	}
+	s.quotes.putMany(ctx, missedKeys, missed)
+	span.SetAttributes(attribute.Int("bulk.cache_hits", cacheHits))
+	// The cache holds the price of the parcels; options, surcharges,
+	// distance, promotions and taxes are added after.
+	now := time.Now()
+	for i := range quotes {
+		lines := rates.breakdown(ctx, quotes[i], keys[i], opts[i], now)
+		if km, ok := s.distance(ctx, packages[i].Address); ok {
+			lines = rates.applyDistance(lines, km)
+		}
+		lines, _ = rates.applyPromotion(ctx, lines, keys[i], values[i])
+		lines, err := s.applyTaxes(ctx, rates, lines, keys[i], packages[i].Address, opts[i], values[i])
+		if err != nil {
+			return backendUnavailable(ctx, "calculate taxes", err)
+		}
+		quotes[i] = lines.total()
+	}
+
+	total := money.FromCents("USD", 0)
+	costs := make([]*pb.Money, len(quotes))
+	for i, quote := range quotes {
+		var err error
+		costs[i] = quote.toMoney()
+		if total, err = money.Sum(total, *costs[i]); err != nil {
+			return rpcError(ctx, codes.Internal, reasonInternal, nil, fmt.Sprintf("sum package costs: %v", err))
+		}
+		span.AddEvent("package.quoted", trace.WithAttributes(
+			attribute.Int("package.index", i),
+			attribute.String("shipping.zone", keys[i].zone.String()),
+			attribute.String("package.cost", quote.String()),
+		))
+	}
+	if err := abandoned(ctx); err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("bulk.packages", len(costs)), attribute.String("bulk.cost", money.Format(total)))
+	return stream.SendAndClose(&pb.GetBulkQuoteResponse{
+		CostUsd:      &total,
+		Packages:     int32(len(costs)),
+		PackageCosts: costs,
+	})
+}
+
+// priceBulkPackages fills in the quotes of the packages the cache missed.
+// Packages are priced concurrently by up to BATCH_WORKERS goroutines, each in
+// a GetBulkQuote/package span of its own, so the trace shows how the work was
+// spread.
+func (s *server) priceBulkPackages(ctx context.Context, packages []*pb.GetQuoteRequest, keys []quoteCacheKey, quotes []Quote, hits []bool, rates *rateTable) error {
+	workers := s.batchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("bulk.parallelism", workers))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+	for i := range packages {
+		i := i
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			_, span := tracer.Start(gctx, "GetBulkQuote/package", trace.WithAttributes(
+				attribute.Int("package.index", i),
+				attribute.String("shipping.zone", keys[i].zone.String()),
+				attribute.Bool("quote.cache_hit", hits[i]),
+			))
+			defer span.End()
+			// Each goroutine writes its own element, so no lock is needed.
+			if !hits[i] {
+				quotes[i] = CreateQuoteFromCount(itemCount(packages[i].Items), rates, keys[i])
+			}
+			span.SetAttributes(attribute.String("package.cost", quotes[i].String()))
+			return nil
+		})
+	}
+	g.Wait()
+	return abandoned(ctx)
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// TestGetBulkQuote checks that the bulk quote is the sum of the quotes of its
+// packages.
+func TestGetBulkQuote(t *testing.T) {
+	client, stop := goldenClient(t, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tracetest.NewSpanRecorder())))
+	defer stop()
+	ctx := context.Background()
+	packages := []*pb.GetQuoteRequest{
+		{Address: &pb.Address{State: "CA", Country: "USA", ZipCode: 94043}, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}},
+		{Address: &pb.Address{State: "NY", Country: "USA", ZipCode: 10001}, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 5}}},
+		{Address: &pb.Address{Country: "France"}, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}}},
+	}
+
+	stream, err := client.GetBulkQuote(ctx)
+	if err != nil {
+		t.Fatalf("TestGetBulkQuote: %v", err)
+	}
+	want := money.FromCents("USD", 0)
+	for _, p := range packages {
+		if err := stream.Send(p); err != nil {
+			t.Fatalf("TestGetBulkQuote: %v", err)
+		}
+		q, err := client.GetQuote(ctx, p)
+		if err != nil {
+			t.Fatalf("TestGetBulkQuote: %v", err)
+		}
+		want, _ = money.Sum(want, *q.CostUsd)
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("TestGetBulkQuote: %v", err)
+	}
+	if res.Packages != int32(len(packages)) || len(res.PackageCosts) != len(packages) {
+		t.Errorf("TestGetBulkQuote: got %d packages and %d costs, expected %d", res.Packages, len(res.PackageCosts), len(packages))
+	}
+	if money.Format(*res.CostUsd) != money.Format(want) {
+		t.Errorf("TestGetBulkQuote: total is %s, expected %s", money.Format(*res.CostUsd), money.Format(want))
+	}
+
+	// An empty stream costs nothing.
+	stream, _ = client.GetBulkQuote(ctx)
+	if res, err := stream.CloseAndRecv(); err != nil || res.Packages != 0 || !money.IsZero(*res.CostUsd) {
+		t.Errorf("TestGetBulkQuote: empty stream returned %v, %v", res, err)
+	}
+}
+
+// TestGetBulkQuoteTooLarge checks that a stream is ended once it exceeds the
+// batch size limit.
+func TestGetBulkQuoteTooLarge(t *testing.T) {
+	client, stop := goldenClient(t, sdktrace.NewTracerProvider())
+	defer stop()
+
+	stream, err := client.GetBulkQuote(context.Background())
+	if err != nil {
+		t.Fatalf("TestGetBulkQuoteTooLarge: %v", err)
+	}
+	p := &pb.GetQuoteRequest{Address: &pb.Address{Country: "USA"}, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}}
+	for i := 0; i <= maxBatchSize; i++ {
+		if stream.Send(p) != nil {
+			break // the server has already failed the call
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	if info, _ := errorDetails(err); status.Code(err) != codes.InvalidArgument || info == nil || info.Reason != reasonBatchTooLarge {
+		t.Errorf("TestGetBulkQuoteTooLarge: got %v, expected %s with %s", err, codes.InvalidArgument, reasonBatchTooLarge)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// quoteValueBuckets are the quote value histogram bucket boundaries, in USD.
+var quoteValueBuckets = []float64{5, 10, 15, 20, 25, 30, 40, 50, 75, 100}
+
+// usStates are the state codes recorded as they are. Any other destination
+// state is recorded as "other", and foreign destinations as "international",
+// so a typo or a hostile client cannot create new time series.
+var usStates = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true, "DC": true,
+	"FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true, "KS": true, "KY": true,
+	"LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true, "MS": true, "MO": true, "MT": true,
+	"NE": true, "NV": true, "NH": true, "NJ": true, "NM": true, "NY": true, "NC": true, "ND": true, "OH": true,
+	"OK": true, "OR": true, "PA": true, "RI": true, "SC": true, "SD": true, "TN": true, "TX": true, "UT": true,
+	"VT": true, "VA": true, "WA": true, "WV": true, "WI": true, "WY": true, "PR": true,
+}
+
+// businessMetrics records shipping KPIs for business dashboards, as opposed
+// to the RED metrics, which describe the service itself.
+type businessMetrics struct {
+	quoteValue metric.Float64Histogram
+	byMethod   metric.Int64Counter
+	byState    metric.Int64Counter
+}
+
+func newBusinessMetrics() *businessMetrics {
+	m := &businessMetrics{}
+	var err error
+	if m.quoteValue, err = meter.Float64Histogram("shipping.quote.value",
+		metric.WithDescription("Value of the quotes issued, by shipping method and zone."),
+		metric.WithUnit("USD"),
+		metric.WithExplicitBucketBoundaries(quoteValueBuckets...),
+	); err != nil {
+		log.WithError(err).Warn("failed to create quote value metric")
+	}
+	if m.byMethod, err = meter.Int64Counter("shipping.shipments.by_method",
+		metric.WithDescription("Shipments created, by shipping method and zone."),
+		metric.WithUnit("{shipment}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create shipments by method metric")
+	}
+	if m.byState, err = meter.Int64Counter("shipping.shipments.by_destination_state",
+		metric.WithDescription("Shipments created, by destination state."),
+		metric.WithUnit("{shipment}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create shipments by state metric")
+	}
+	return m
+}
+
+// quoted records a quote issued for key.
+func (m *businessMetrics) quoted(ctx context.Context, key quoteCacheKey, q Quote) {
+	if m.quoteValue != nil {
+		m.quoteValue.Record(ctx, float64(q.Dollars)+float64(q.Cents)/100, metric.WithAttributes(
+			attribute.String("shipping.method", metricMethod(key.method)),
+			attribute.String("shipping.zone", key.zone.String()),
+			attribute.String("tenant.id", tenantFromContext(ctx).label),
+		))
+	}
+}
+
+// shipped records a shipment sent to address by method.
+func (m *businessMetrics) shipped(ctx context.Context, method pb.ShippingMethod, address *pb.Address) {
+	if m.byMethod != nil {
+		m.byMethod.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("shipping.method", metricMethod(method)),
+			attribute.String("shipping.zone", destinationZone(address).String()),
+			attribute.String("tenant.id", tenantFromContext(ctx).label),
+		))
+	}
+	if m.byState != nil {
+		m.byState.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("destination.state", metricState(address)),
+			attribute.String("tenant.id", tenantFromContext(ctx).label),
+		))
+	}
+}
+
+// metricMethod names a method, or "unknown" for values outside the enum.
+func metricMethod(m pb.ShippingMethod) string {
+	if m == pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED {
+		m = pb.ShippingMethod_SHIPPING_METHOD_STANDARD
+	}
+	if _, ok := pb.ShippingMethod_name[int32(m)]; !ok {
+		return "unknown"
+	}
+	return methodName(m)
+}
+
+func metricState(a *pb.Address) string {
+	if !isDomestic(a) {
+		return "international"
+	}
+	if st := strings.ToUpper(strings.TrimSpace(a.GetState())); usStates[st] {
+		return st
+	}
+	return "other"
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestBusinessMetrics checks that quotes and shipments are recorded with bounded attribute values.
+func TestBusinessMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	saved := meter
+	meter = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(serviceName)
+	defer func() { meter = saved }()
+
+	s := newServer()
+	ctx := context.Background()
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}
+	quote, err := s.GetQuote(ctx, &pb.GetQuoteRequest{
+		Address: &pb.Address{State: "CA", Country: "USA", ZipCode: 94043},
+		Items:   items,
+		Method:  pb.ShippingMethod_SHIPPING_METHOD_EXPRESS,
+	})
+	if err != nil {
+		t.Fatalf("TestBusinessMetrics: %v", err)
+	}
+	for _, req := range []*pb.ShipOrderRequest{
+		{Address: &pb.Address{State: "ca", Country: "USA", ZipCode: 94043}, Items: items, QuoteId: quote.QuoteId},
+		{Address: &pb.Address{State: "Narnia", Country: "USA", ZipCode: 10001}, Items: items},
+		{Address: &pb.Address{State: "Bavaria", Country: "Germany", ZipCode: 80331}, Items: items},
+	} {
+		if _, err := s.ShipOrder(ctx, req); err != nil {
+			t.Fatalf("TestBusinessMetrics: %v", err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("TestBusinessMetrics: %v", err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					for _, kv := range dp.Attributes.ToSlice() {
+						if kv.Key == "shipping.method" || kv.Key == "destination.state" {
+							got[m.Name+"/"+kv.Value.AsString()] += dp.Value
+						}
+					}
+				}
+			case metricdata.Histogram[float64]:
+				if m.Name == "shipping.quote.value" {
+					for _, dp := range data.DataPoints {
+						got[m.Name] += int64(dp.Count)
+						if dp.Sum <= 0 {
+							t.Errorf("TestBusinessMetrics: quote value sum is %v", dp.Sum)
+						}
+					}
+				}
+			}
+		}
+	}
+	for k, v := range map[string]int64{
+		"shipping.quote.value":                                  1,
+		"shipping.shipments.by_method/express":                  1,
+		"shipping.shipments.by_method/standard":                 2,
+		"shipping.shipments.by_destination_state/CA":            1,
+		"shipping.shipments.by_destination_state/other":         1,
+		"shipping.shipments.by_destination_state/international": 1,
+	} {
+		if got[k] != v {
+			t.Errorf("TestBusinessMetrics: %s = %d, expected %d", k, got[k], v)
+		}
+	}
+}
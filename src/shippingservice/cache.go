@@ -0,0 +1,292 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	defaultQuoteCacheSize = 1000
+	defaultQuoteCacheTTL  = time.Minute
+
+	// nominalItemWeightGrams is the assumed weight of one item, as the
+	// catalog does not know product weights.
+	nominalItemWeightGrams = 500
+)
+
+// weightBucketsGrams are the upper bounds of the weight brackets used for
+// pricing. Anything heavier falls into the last, open-ended bucket.
+var weightBucketsGrams = []int{1000, 2000, 5000, 10000, 20000}
+
+// quoteCacheKey identifies requests that are priced identically under a given
+// version of the rate table.
+type quoteCacheKey struct {
+	zone         zone
+	weightBucket int
+	method       pb.ShippingMethod
+	ratesVersion string
+	// empty marks an empty cart, which costs nothing to ship but weighs the
+	// same as a one-item cart, so that their quotes are kept apart.
+	empty bool
+}
+
+// weightGrams is the estimated total weight of the items.
+func weightGrams(items []*pb.CartItem) int {
+	w := 0
+	for _, it := range items {
+		w += int(it.GetQuantity()) * nominalItemWeightGrams
+	}
+	return w
+}
+
+// weightBucket returns the index of the weight bracket w falls into.
+func weightBucket(w int) int {
+	for i, limit := range weightBucketsGrams {
+		if w <= limit {
+			return i
+		}
+	}
+	return len(weightBucketsGrams)
+}
+
+// newQuoteCacheKey returns the key of a request, weighing its parcel by its
+// billable weight when the dimensions of its items are given.
+func newQuoteCacheKey(in *pb.GetQuoteRequest, ratesVersion string) quoteCacheKey {
+	return newQuoteCacheKeyForWeight(in, packOrder(in.GetItems(), in.GetDimensions()).billableGrams(), ratesVersion)
+}
+
+// newQuoteCacheKeyForWeight returns the key of a request whose parcel has
+// already been weighed.
+func newQuoteCacheKeyForWeight(in *pb.GetQuoteRequest, grams int, ratesVersion string) quoteCacheKey {
+	method := in.GetMethod()
+	if method == pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED {
+		method = pb.ShippingMethod_SHIPPING_METHOD_STANDARD
+	}
+	return quoteCacheKey{
+		zone:         destinationZone(in.GetAddress()),
+		weightBucket: weightBucket(grams),
+		method:       method,
+		ratesVersion: ratesVersion,
+		empty:        itemCount(in.GetItems()) == 0,
+	}
+}
+
+func (k quoteCacheKey) String() string {
+	var buf [64]byte
+	b := append(buf[:0], k.ratesVersion...)
+	b = append(b, ':')
+	b = append(b, k.zone.String()...)
+	b = append(b, ':')
+	b = strconv.AppendInt(b, int64(k.weightBucket), 10)
+	b = append(b, ':')
+	b = append(b, k.method.String()...)
+	if k.empty {
+		b = append(b, ":empty"...)
+	}
+	return string(b)
+}
+
+// quoteCacher caches computed quotes. Lookups record whether they hit on the
+// current span and in the shipping.quote.cache.lookups metric.
+type quoteCacher interface {
+	get(ctx context.Context, key quoteCacheKey) (Quote, bool)
+	put(ctx context.Context, key quoteCacheKey, q Quote)
+	// getMany looks up many quotes in one round trip; hits[i] says whether
+	// quotes[i] was found.
+	getMany(ctx context.Context, keys []quoteCacheKey) (quotes []Quote, hits []bool)
+	putMany(ctx context.Context, keys []quoteCacheKey, quotes []Quote)
+}
+
+// quoteCacheFromEnv selects the cache backend named by CACHE_BACKEND.
+func quoteCacheFromEnv(rdb redis.UniversalClient) quoteCacher {
+	size := envInt("QUOTE_CACHE_SIZE", defaultQuoteCacheSize)
+	ttl := envDuration("QUOTE_CACHE_TTL", defaultQuoteCacheTTL)
+	if rdb != nil {
+		return newRedisQuoteCache(rdb, ttl)
+	}
+	return newQuoteCache(size, ttl)
+}
+
+func newCacheLookupCounter() metric.Int64Counter {
+	lookups, err := meter.Int64Counter("shipping.quote.cache.lookups",
+		metric.WithDescription("Quote cache lookups, by backend and whether they were a hit."),
+	)
+	if err != nil {
+		log.WithError(err).Warn("failed to create quote cache metric")
+	}
+	return lookups
+}
+
+// cacheLookupAttrs are the metric attributes of a miss and of a hit on each
+// backend, built once rather than on every lookup.
+var cacheLookupAttrs = map[string][2]metric.AddOption{
+	"memory": {cacheLookupOption("memory", false), cacheLookupOption("memory", true)},
+	"redis":  {cacheLookupOption("redis", false), cacheLookupOption("redis", true)},
+}
+
+func cacheLookupOption(backend string, hit bool) metric.AddOption {
+	return metric.WithAttributeSet(attribute.NewSet(
+		attribute.String("cache.backend", backend),
+		attribute.Bool("cache.hit", hit),
+	))
+}
+
+func recordCacheLookup(ctx context.Context, lookups metric.Int64Counter, backend string, hit bool) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("quote.cache_hit", hit))
+	if lookups != nil {
+		i := 0
+		if hit {
+			i = 1
+		}
+		lookups.Add(ctx, 1, cacheLookupAttrs[backend][i])
+	}
+}
+
+type quoteCacheEntry struct {
+	key     quoteCacheKey
+	quote   Quote
+	expires time.Time
+}
+
+// quoteCache is an in-process, size-bounded LRU cache of quotes whose entries expire after
+// a fixed TTL. A cache with a size of zero never stores anything.
+type quoteCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // most recently used first
+	entries map[quoteCacheKey]*list.Element
+	lookups metric.Int64Counter
+}
+
+func newQuoteCache(size int, ttl time.Duration) *quoteCache {
+	return &quoteCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[quoteCacheKey]*list.Element),
+		lookups: newCacheLookupCounter(),
+	}
+}
+
+func (c *quoteCache) get(ctx context.Context, key quoteCacheKey) (Quote, bool) {
+	q, hit := c.lookup(key)
+	recordCacheLookup(ctx, c.lookups, "memory", hit)
+	return q, hit
+}
+
+func (c *quoteCache) lookup(key quoteCacheKey) (Quote, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return Quote{}, false
+	}
+	e := el.Value.(*quoteCacheEntry)
+	if time.Now().After(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return Quote{}, false
+	}
+	c.order.MoveToFront(el)
+	return e.quote, true
+}
+
+func (c *quoteCache) getMany(ctx context.Context, keys []quoteCacheKey) ([]Quote, []bool) {
+	quotes, hits := make([]Quote, len(keys)), make([]bool, len(keys))
+	for i, key := range keys {
+		quotes[i], hits[i] = c.get(ctx, key)
+	}
+	return quotes, hits
+}
+
+func (c *quoteCache) putMany(ctx context.Context, keys []quoteCacheKey, quotes []Quote) {
+	for i, key := range keys {
+		c.put(ctx, key, quotes[i])
+	}
+}
+
+// put stores a quote, evicting the least recently used entry if the cache is
+// full.
+func (c *quoteCache) put(_ context.Context, key quoteCacheKey, q Quote) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*quoteCacheEntry)
+		e.quote, e.expires = q, time.Now().Add(c.ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&quoteCacheEntry{key: key, quote: q, expires: time.Now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*quoteCacheEntry).key)
+	}
+}
+
+// purgeExpired removes the entries that expired before now and returns how
+// many there were. Expired entries are otherwise only removed when looked up
+// or evicted.
+func (c *quoteCache) purgeExpired(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, el := range c.entries {
+		if now.After(el.Value.(*quoteCacheEntry).expires) {
+			c.order.Remove(el)
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+// computeQuote returns the quote for key, from the cache if it is there.
+// Concurrent calls for the same key, as a load test makes, are coalesced so
+// that only one of them burns CPU, looks up the cache and prices the quote;
+// the others wait for its result and have quote.coalesced set on their span.
+// Empty carts have keys of their own, so their free quote is never shared
+// with carts of the same weight, in flight or in the cache.
+func (s *server) computeQuote(ctx context.Context, key quoteCacheKey, count int, rates *rateTable) Quote {
+	leader := false
+	v, _, _ := s.flights.Do(key.String(), func() (interface{}, error) {
+		leader = true
+		s.burn.quote(ctx, key)
+		quote, hit := s.quotes.get(ctx, key)
+		if !hit {
+			quote = CreateQuoteFromCount(count, rates, key)
+			s.quotes.put(ctx, key, quote)
+		}
+		return quote, nil
+	})
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("quote.coalesced", !leader))
+	return v.(Quote)
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+func TestQuoteCacheKey(t *testing.T) {
+	a := newQuoteCacheKey(&pb.GetQuoteRequest{
+		Address: &pb.Address{ZipCode: 94043},
+		Items:   []*pb.CartItem{{ProductId: "a", Quantity: 1}},
+	}, "v1")
+	b := newQuoteCacheKey(&pb.GetQuoteRequest{
+		Address: &pb.Address{ZipCode: 94105},
+		Items:   []*pb.CartItem{{ProductId: "b", Quantity: 2}},
+		Method:  pb.ShippingMethod_SHIPPING_METHOD_STANDARD,
+	}, "v1")
+	if a != b {
+		t.Errorf("TestQuoteCacheKey: %+v and %+v should share a cache entry", a, b)
+	}
+}
+
+// TestEmptyCartQuote checks that the free quote of an empty cart is not
+// cached for the one-item carts that weigh the same.
+func TestEmptyCartQuote(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	empty, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress})
+	if err != nil || empty.CostUsd.GetUnits() != 0 || empty.CostUsd.GetNanos() != 0 {
+		t.Fatalf("TestEmptyCartQuote: empty cart quoted %v (%v), want 0", empty.GetCostUsd(), err)
+	}
+	one, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}})
+	if err != nil || one.CostUsd.GetUnits() != 8 || one.CostUsd.GetNanos() != 990000000 {
+		t.Errorf("TestEmptyCartQuote: one item after an empty cart quoted %v (%v), want 8.99", one.GetCostUsd(), err)
+	}
+}
+
+func TestQuoteCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := newQuoteCache(10, 10*time.Millisecond)
+	key := quoteCacheKey{zone: zoneLocal}
+	c.put(ctx, key, Quote{Dollars: 8, Cents: 99})
+
+	if q, hit := c.get(ctx, key); !hit || q.Dollars != 8 {
+		t.Fatalf("TestQuoteCacheExpiry: expected a hit, got %v (hit=%t)", q, hit)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, hit := c.get(ctx, key); hit {
+		t.Error("TestQuoteCacheExpiry: expected the entry to have expired")
+	}
+}
+
+func TestQuoteCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	c := newQuoteCache(2, time.Minute)
+	k1, k2, k3 := quoteCacheKey{zone: 1}, quoteCacheKey{zone: 2}, quoteCacheKey{zone: 3}
+	c.put(ctx, k1, Quote{Dollars: 1})
+	c.put(ctx, k2, Quote{Dollars: 2})
+	c.get(ctx, k1) // k2 is now the least recently used entry
+	c.put(ctx, k3, Quote{Dollars: 3})
+
+	if _, hit := c.get(ctx, k2); hit {
+		t.Error("TestQuoteCacheEviction: expected k2 to be evicted")
+	}
+	if _, hit := c.get(ctx, k1); !hit {
+		t.Error("TestQuoteCacheEviction: expected k1 to be kept")
+	}
+}
+
+// slowQuoteCache is a quote cache whose lookups always miss, and wait until
+// release is closed.
+type slowQuoteCache struct {
+	*quoteCache
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *slowQuoteCache) get(ctx context.Context, key quoteCacheKey) (Quote, bool) {
+	if c.calls.Add(1) == 1 {
+		close(c.started)
+	}
+	<-c.release
+	return Quote{}, false
+}
+
+// TestQuoteCoalescing checks that concurrent quotes for the same key are
+// computed once, and that the calls that waited are marked as coalesced.
+func TestQuoteCoalescing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("test")
+	svc := newServer()
+	cache := &slowQuoteCache{quoteCache: newQuoteCache(10, time.Minute), started: make(chan struct{}), release: make(chan struct{})}
+	svc.quotes = cache
+	rates := svc.rates.table()
+	key := newQuoteCacheKey(&pb.GetQuoteRequest{Items: []*pb.CartItem{{Quantity: 1}}}, rates.version)
+
+	const calls = 5
+	quotes := make([]Quote, calls)
+	var wg sync.WaitGroup
+	quote := func(i int) {
+		defer wg.Done()
+		ctx, span := tracer.Start(context.Background(), "GetQuote")
+		quotes[i] = svc.computeQuote(ctx, key, 1, rates)
+		span.End()
+	}
+	wg.Add(calls)
+	go quote(0)
+	<-cache.started
+	for i := 1; i < calls; i++ {
+		go quote(i)
+	}
+	// Give the other calls time to join the first one's flight.
+	time.Sleep(50 * time.Millisecond)
+	close(cache.release)
+	wg.Wait()
+
+	if n := cache.calls.Load(); n != 1 {
+		t.Errorf("TestQuoteCoalescing: %d cache lookups, want 1", n)
+	}
+	coalesced := 0
+	for _, span := range rec.Ended() {
+		attrs := attribute.NewSet(span.Attributes()...)
+		if v, _ := attrs.Value("quote.coalesced"); v.AsBool() {
+			coalesced++
+		}
+	}
+	if coalesced != calls-1 {
+		t.Errorf("TestQuoteCoalescing: %d coalesced calls, want %d", coalesced, calls-1)
+	}
+	for _, q := range quotes[1:] {
+		if q != quotes[0] || q == (Quote{}) {
+			t.Errorf("TestQuoteCoalescing: got quotes %v, want the same non-zero quote", quotes)
+			break
+		}
+	}
+}
+
+// TestQuoteCoalescingEmptyCart checks that a one-item cart quoted while an
+// empty cart of the same weight bucket is being quoted neither joins its
+// flight nor gets its free quote from the cache afterwards.
+func TestQuoteCoalescingEmptyCart(t *testing.T) {
+	svc := newServer()
+	cache := &slowQuoteCache{quoteCache: newQuoteCache(10, time.Minute), started: make(chan struct{}), release: make(chan struct{})}
+	svc.quotes = cache
+	rates := svc.rates.table()
+	address := &pb.Address{ZipCode: 94043}
+	emptyKey := newQuoteCacheKey(&pb.GetQuoteRequest{Address: address}, rates.version)
+	oneKey := newQuoteCacheKey(&pb.GetQuoteRequest{Address: address, Items: []*pb.CartItem{{Quantity: 1}}}, rates.version)
+
+	var empty, one Quote
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		empty = svc.computeQuote(context.Background(), emptyKey, 0, rates)
+	}()
+	<-cache.started
+	go func() {
+		defer wg.Done()
+		one = svc.computeQuote(context.Background(), oneKey, 1, rates)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(cache.release)
+	wg.Wait()
+
+	if n := cache.calls.Load(); n != 2 {
+		t.Errorf("TestQuoteCoalescingEmptyCart: %d cache lookups, want 2", n)
+	}
+	if empty != (Quote{}) || one == (Quote{}) {
+		t.Errorf("TestQuoteCoalescingEmptyCart: empty cart quoted %v and one item %v", empty, one)
+	}
+	if q, hit := cache.quoteCache.get(context.Background(), oneKey); !hit || q != one {
+		t.Errorf("TestQuoteCoalescingEmptyCart: one item cached as %v (hit=%t), want %v", q, hit, one)
+	}
+}
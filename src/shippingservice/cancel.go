@@ -0,0 +1,55 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// sleepContext pauses for d, or until ctx is done, whichever comes first. Use
+// it instead of time.Sleep for any delay on the request path, so that a
+// cancelled request stops waiting.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// abandoned returns nil while the caller is still waiting for a response.
+// Once the request has been cancelled or has run out of time, it records that
+// on the span and returns the matching Canceled or DeadlineExceeded error for
+// the handler to return instead of finishing work nobody will read.
+func abandoned(ctx context.Context) error {
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("request.abandoned", trace.WithAttributes(attribute.String("error", err.Error())))
+	span.RecordError(err)
+	span.SetStatus(otelcodes.Error, err.Error())
+	return status.FromContextError(err).Err()
+}
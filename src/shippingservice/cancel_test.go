@@ -0,0 +1,64 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestSleepContext checks that a delay ends as soon as the context is cancelled.
+func TestSleepContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sleepContext(ctx, time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("TestSleepContext: got %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TestSleepContext: slept for %v after the deadline", elapsed)
+	}
+}
+
+// TestAbandonedRequests checks that handlers give up on cancelled or expired requests.
+func TestAbandonedRequests(t *testing.T) {
+	s := newServer()
+	addr := &pb.Address{ZipCode: 94043}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.ShipOrder(cancelled, &pb.ShipOrderRequest{Address: addr}); status.Code(err) != codes.Canceled {
+		t.Errorf("TestAbandonedRequests: ShipOrder returned %v, expected %s", err, codes.Canceled)
+	}
+	if n, _ := s.shipments.live(context.Background(), defaultTenant); n != 0 {
+		t.Errorf("TestAbandonedRequests: cancelled ShipOrder created %d shipment(s)", n)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := s.GetQuote(expired, &pb.GetQuoteRequest{Address: addr}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("TestAbandonedRequests: GetQuote returned %v, expected %s", err, codes.DeadlineExceeded)
+	}
+	orders := &pb.ShipOrdersRequest{Orders: []*pb.ShipOrderRequest{{Address: addr}, {Address: addr}}}
+	if _, err := s.ShipOrders(expired, orders); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("TestAbandonedRequests: ShipOrders returned %v, expected %s", err, codes.DeadlineExceeded)
+	}
+}
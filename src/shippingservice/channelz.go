@@ -0,0 +1,240 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// channelzCalls counts the calls made on a server or channel.
+type channelzCalls struct {
+	Started   int64  `json:"started"`
+	Succeeded int64  `json:"succeeded"`
+	Failed    int64  `json:"failed"`
+	LastCall  string `json:"last_call,omitempty"`
+}
+
+// channelzSocket is a connection, with the streams and messages it carried.
+type channelzSocket struct {
+	ID               int64  `json:"id"`
+	Local            string `json:"local,omitempty"`
+	Remote           string `json:"remote,omitempty"`
+	StreamsStarted   int64  `json:"streams_started"`
+	StreamsSucceeded int64  `json:"streams_succeeded"`
+	StreamsFailed    int64  `json:"streams_failed"`
+	MessagesSent     int64  `json:"messages_sent"`
+	MessagesReceived int64  `json:"messages_received"`
+	KeepalivesSent   int64  `json:"keepalives_sent"`
+}
+
+// channelzServer is a gRPC server with its listeners and connections.
+type channelzServer struct {
+	ID            int64            `json:"id"`
+	Calls         channelzCalls    `json:"calls"`
+	ListenSockets []string         `json:"listen_sockets"`
+	Sockets       []channelzSocket `json:"sockets"`
+	ActiveSockets int              `json:"active_sockets"`
+}
+
+// channelzChannel is a client channel, or one of its subchannels, each of
+// which connects to one backend.
+type channelzChannel struct {
+	ID          int64             `json:"id"`
+	Target      string            `json:"target,omitempty"`
+	State       string            `json:"state"`
+	Calls       channelzCalls     `json:"calls"`
+	Subchannels []channelzChannel `json:"subchannels,omitempty"`
+	Sockets     []channelzSocket  `json:"sockets,omitempty"`
+}
+
+// channelzReport is the state of every gRPC server and client channel of
+// the process.
+type channelzReport struct {
+	Servers  []channelzServer  `json:"servers"`
+	Channels []channelzChannel `json:"channels"`
+}
+
+// channelzView serves channelz, the gRPC runtime's own accounting of servers,
+// channels and sockets, as JSON. Streams and calls per socket show how
+// evenly clients spread their load over the replicas, and whether a
+// connection is stuck to one of them after a scale-up.
+type channelzView struct {
+	cz channelzgrpc.ChannelzServer
+}
+
+// capturingRegistrar keeps the implementation of the service registered with
+// it, so that the channelz service can be called in-process.
+type capturingRegistrar struct{ impl any }
+
+func (r *capturingRegistrar) RegisterService(_ *grpc.ServiceDesc, impl any) { r.impl = impl }
+
+func newChannelzView() *channelzView {
+	var r capturingRegistrar
+	channelzsvc.RegisterChannelzServiceToServer(&r)
+	return &channelzView{cz: r.impl.(channelzgrpc.ChannelzServer)}
+}
+
+// registerChannelzService serves the channelz gRPC service on srv, for tools
+// such as grpcdebug.
+func registerChannelzService(srv *grpc.Server) {
+	channelzsvc.RegisterChannelzServiceToServer(srv)
+}
+
+// report collects the servers and top-level channels, with their sockets.
+func (v *channelzView) report(ctx context.Context) (channelzReport, error) {
+	rep := channelzReport{Servers: []channelzServer{}, Channels: []channelzChannel{}}
+	for start := int64(0); ; {
+		resp, err := v.cz.GetServers(ctx, &channelzgrpc.GetServersRequest{StartServerId: start})
+		if err != nil {
+			return rep, err
+		}
+		for _, s := range resp.Server {
+			srv := channelzServer{ID: s.Ref.ServerId, Calls: newChannelzCalls(s.Data.CallsStarted, s.Data.CallsSucceeded, s.Data.CallsFailed, s.Data.LastCallStartedTimestamp)}
+			for _, ls := range s.ListenSocket {
+				if sock, err := v.socket(ctx, ls.SocketId); err == nil {
+					srv.ListenSockets = append(srv.ListenSockets, sock.Local)
+				}
+			}
+			if srv.Sockets, err = v.serverSockets(ctx, s.Ref.ServerId); err != nil {
+				return rep, err
+			}
+			srv.ActiveSockets = len(srv.Sockets)
+			rep.Servers = append(rep.Servers, srv)
+			start = s.Ref.ServerId + 1
+		}
+		if resp.End || len(resp.Server) == 0 {
+			break
+		}
+	}
+	for start := int64(0); ; {
+		resp, err := v.cz.GetTopChannels(ctx, &channelzgrpc.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return rep, err
+		}
+		for _, c := range resp.Channel {
+			ch := newChannelzChannel(c.Ref.ChannelId, c.Data)
+			for _, ref := range c.SubchannelRef {
+				sub, err := v.cz.GetSubchannel(ctx, &channelzgrpc.GetSubchannelRequest{SubchannelId: ref.SubchannelId})
+				if err != nil {
+					continue
+				}
+				sc := newChannelzChannel(ref.SubchannelId, sub.Subchannel.Data)
+				for _, sref := range sub.Subchannel.SocketRef {
+					if sock, err := v.socket(ctx, sref.SocketId); err == nil {
+						sc.Sockets = append(sc.Sockets, sock)
+					}
+				}
+				ch.Subchannels = append(ch.Subchannels, sc)
+			}
+			rep.Channels = append(rep.Channels, ch)
+			start = c.Ref.ChannelId + 1
+		}
+		if resp.End || len(resp.Channel) == 0 {
+			break
+		}
+	}
+	return rep, nil
+}
+
+// serverSockets returns the connections accepted by a server.
+func (v *channelzView) serverSockets(ctx context.Context, id int64) ([]channelzSocket, error) {
+	socks := []channelzSocket{}
+	for start := int64(0); ; {
+		resp, err := v.cz.GetServerSockets(ctx, &channelzgrpc.GetServerSocketsRequest{ServerId: id, StartSocketId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range resp.SocketRef {
+			// A socket closed since it was listed is skipped.
+			if sock, err := v.socket(ctx, ref.SocketId); err == nil {
+				socks = append(socks, sock)
+			}
+			start = ref.SocketId + 1
+		}
+		if resp.End || len(resp.SocketRef) == 0 {
+			return socks, nil
+		}
+	}
+}
+
+func (v *channelzView) socket(ctx context.Context, id int64) (channelzSocket, error) {
+	resp, err := v.cz.GetSocket(ctx, &channelzgrpc.GetSocketRequest{SocketId: id})
+	if err != nil {
+		return channelzSocket{}, err
+	}
+	s, d := resp.Socket, resp.Socket.Data
+	return channelzSocket{
+		ID:               id,
+		Local:            channelzAddress(s.Local),
+		Remote:           channelzAddress(s.Remote),
+		StreamsStarted:   d.StreamsStarted,
+		StreamsSucceeded: d.StreamsSucceeded,
+		StreamsFailed:    d.StreamsFailed,
+		MessagesSent:     d.MessagesSent,
+		MessagesReceived: d.MessagesReceived,
+		KeepalivesSent:   d.KeepAlivesSent,
+	}, nil
+}
+
+func newChannelzChannel(id int64, d *channelzgrpc.ChannelData) channelzChannel {
+	return channelzChannel{
+		ID:     id,
+		Target: d.Target,
+		State:  d.State.GetState().String(),
+		Calls:  newChannelzCalls(d.CallsStarted, d.CallsSucceeded, d.CallsFailed, d.LastCallStartedTimestamp),
+	}
+}
+
+func newChannelzCalls(started, succeeded, failed int64, last *timestamppb.Timestamp) channelzCalls {
+	c := channelzCalls{Started: started, Succeeded: succeeded, Failed: failed}
+	if last != nil && started > 0 {
+		c.LastCall = last.AsTime().UTC().Format(time.RFC3339Nano)
+	}
+	return c
+}
+
+// channelzAddress formats a TCP address as host:port.
+func channelzAddress(a *channelzgrpc.Address) string {
+	if tcp := a.GetTcpipAddress(); tcp != nil {
+		return net.JoinHostPort(net.IP(tcp.IpAddress).String(), strconv.Itoa(int(tcp.Port)))
+	}
+	if uds := a.GetUdsAddress(); uds != nil {
+		return uds.Filename
+	}
+	return ""
+}
+
+// ServeHTTP writes the channelz report as JSON.
+func (v *channelzView) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rep, err := v.report(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(rep)
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestChannelzView checks that the servers and channels of the process are
+// reported with their sockets and call counts.
+func TestChannelzView(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, newServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := healthpb.NewHealthClient(cc)
+	for i := 0; i < 3; i++ {
+		if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	newChannelzView().ServeHTTP(w, httptest.NewRequest("GET", "/debug/channelz", nil))
+	var rep channelzReport
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("TestChannelzView: %v: %s", err, w.Body)
+	}
+
+	// Other tests leave servers and channels behind: find this one's.
+	var server *channelzServer
+	for i, s := range rep.Servers {
+		if len(s.ListenSockets) == 1 && s.ListenSockets[0] == lis.Addr().String() {
+			server = &rep.Servers[i]
+		}
+	}
+	if server == nil {
+		t.Fatalf("TestChannelzView: no server listening on %s in %+v", lis.Addr(), rep.Servers)
+	}
+	if server.Calls.Started != 3 || server.Calls.Succeeded != 3 || server.Calls.LastCall == "" {
+		t.Errorf("TestChannelzView: server calls are %+v, want 3 started and succeeded", server.Calls)
+	}
+	if server.ActiveSockets != 1 || server.Sockets[0].StreamsSucceeded != 3 || server.Sockets[0].Remote == "" {
+		t.Errorf("TestChannelzView: server sockets are %+v, want one with 3 streams", server.Sockets)
+	}
+
+	var channel *channelzChannel
+	for i, c := range rep.Channels {
+		if c.Target == lis.Addr().String() {
+			channel = &rep.Channels[i]
+		}
+	}
+	if channel == nil {
+		t.Fatalf("TestChannelzView: no channel to %s in %+v", lis.Addr(), rep.Channels)
+	}
+	if channel.State != "READY" || channel.Calls.Succeeded != 3 {
+		t.Errorf("TestChannelzView: channel is %s with calls %+v, want READY with 3 succeeded", channel.State, channel.Calls)
+	}
+	if len(channel.Subchannels) != 1 || len(channel.Subchannels[0].Sockets) != 1 ||
+		channel.Subchannels[0].Sockets[0].Remote != lis.Addr().String() {
+		t.Errorf("TestChannelzView: subchannels are %+v, want one connected to %s", channel.Subchannels, lis.Addr())
+	}
+}
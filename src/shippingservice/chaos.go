@@ -0,0 +1,188 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Request metadata keys that inject a fault into a call when chaos mode is
+// on, e.g. "x-fault-code: UNAVAILABLE" or "x-fault-delay-ms: 1500". The delay
+// is applied first, so both can be combined.
+const (
+	faultCodeHeader  = "x-fault-code"
+	faultDelayHeader = "x-fault-delay-ms"
+
+	maxFaultDelay = time.Minute
+)
+
+// faultInjector fails or delays calls on request, delays the methods given
+// a latency shape, and fails a share of calls with simulated errors. It is
+// off unless chaos mode is enabled, so a production deployment cannot be
+// disrupted by a client.
+type faultInjector struct {
+	enabled atomic.Bool
+	shapes  map[string]latencyShape
+	errors  *errorMix
+}
+
+func newFaultInjector(enabled bool) *faultInjector {
+	f := &faultInjector{}
+	f.enabled.Store(enabled)
+	return f
+}
+
+func faultInjectorFromEnv() *faultInjector {
+	f := newFaultInjector(envBool("CHAOS_MODE", false))
+	f.shapes = latencyShapesFromEnv()
+	f.errors = errorMixFromEnv()
+	if f.enabled.Load() {
+		log.Warn("chaos mode is on: requests may inject faults")
+	}
+	return f
+}
+
+// setEnabled turns chaos mode on or off.
+func (f *faultInjector) setEnabled(on bool) {
+	if f.enabled.Swap(on) != on {
+		log.Infof("chaos mode enabled: %v", on)
+	}
+}
+
+// fault is the fault requested by a call's metadata.
+type fault struct {
+	code  codes.Code
+	delay time.Duration
+}
+
+// parseFault reads the fault headers. It returns a zero fault if there are
+// none.
+func parseFault(md metadata.MD) (fault, error) {
+	var f fault
+	if v := lastValue(md, faultDelayHeader); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxFaultDelay {
+			return f, fmt.Errorf("%s must be a number of milliseconds up to %d", faultDelayHeader, maxFaultDelay.Milliseconds())
+		}
+		f.delay = time.Duration(ms) * time.Millisecond
+	}
+	if v := lastValue(md, faultCodeHeader); v != "" {
+		code, ok := parseCode(v)
+		if !ok {
+			return f, fmt.Errorf("%s must be a gRPC status code name or number, got %q", faultCodeHeader, v)
+		}
+		f.code = code
+	}
+	return f, nil
+}
+
+// parseCode accepts a code name in any case, e.g. "unavailable" or
+// "DEADLINE_EXCEEDED", or its number.
+func parseCode(s string) (codes.Code, bool) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return codes.Code(n), n <= uint64(codes.Unauthenticated)
+	}
+	var c codes.Code
+	if err := c.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(s)))); err != nil {
+		return 0, false
+	}
+	return c, true
+}
+
+func lastValue(md metadata.MD, key string) string {
+	if vs := md.Get(key); len(vs) > 0 {
+		return strings.TrimSpace(vs[len(vs)-1])
+	}
+	return ""
+}
+
+// unary returns an interceptor that applies the method's latency shape, then
+// the requested fault or else a simulated error, before the handler runs. It belongs inside timeoutInterceptor, so that long delays
+// still hit the server timeout.
+func (f *faultInjector) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := f.inject(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// stream is unary for streaming RPCs. Latency and faults apply once, when
+// the stream is opened.
+func (f *faultInjector) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := f.inject(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// inject delays a call of fullMethod and returns the error it should fail
+// with, if any.
+func (f *faultInjector) inject(ctx context.Context, fullMethod string) error {
+	// Health checks are never failed, or Kubernetes would restart the pod.
+	if !f.enabled.Load() || strings.HasPrefix(fullMethod, "/grpc.health.") {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	ft, err := parseFault(md)
+	if err != nil {
+		return rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, err.Error(),
+			badRequest(&errdetails.BadRequest_FieldViolation{Field: "metadata", Description: err.Error()}))
+	}
+	if shape, ok := f.shapes[path.Base(fullMethod)]; ok {
+		d := shape.sample()
+		trace.SpanFromContext(ctx).AddEvent("latency.injected", trace.WithAttributes(
+			attribute.Int64("latency.delay_ms", d.Milliseconds()),
+		))
+		if err := sleepContext(ctx, d); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+	if ft != (fault{}) {
+		trace.SpanFromContext(ctx).AddEvent("fault.injected", trace.WithAttributes(
+			attribute.String("fault.code", ft.code.String()),
+			attribute.Int64("fault.delay_ms", ft.delay.Milliseconds()),
+		))
+		if err := sleepContext(ctx, ft.delay); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if ft.code != codes.OK {
+			return rpcError(ctx, ft.code, reasonInjectedFault,
+				map[string]string{"method": path.Base(fullMethod)},
+				fmt.Sprintf("injected fault: %s requested by %s metadata", ft.code, faultCodeHeader))
+		}
+	}
+	if code, ok := f.errors.pick(); ok {
+		return f.errors.fail(ctx, path.Base(fullMethod), code)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestFaultInjection checks that fault metadata is honored only in chaos mode.
+func TestFaultInjection(t *testing.T) {
+	f := newFaultInjector(false)
+	intercept := f.unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "done", nil }
+	call := func(info *grpc.UnaryServerInfo, kv ...string) (interface{}, error) {
+		return intercept(metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...)), nil, info, handler)
+	}
+
+	if resp, err := call(info, faultCodeHeader, "UNAVAILABLE"); err != nil || resp != "done" {
+		t.Errorf("TestFaultInjection: chaos mode off returned %v, %v", resp, err)
+	}
+
+	f.setEnabled(true)
+	_, err := call(info, faultCodeHeader, "unavailable")
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("TestFaultInjection: got %v, expected %s", err, codes.Unavailable)
+	}
+	if info, _ := errorDetails(err); info == nil || info.Reason != reasonInjectedFault {
+		t.Errorf("TestFaultInjection: ErrorInfo is %v", info)
+	}
+	if _, err := call(info, faultCodeHeader, "14"); status.Code(err) != codes.Unavailable {
+		t.Errorf("TestFaultInjection: numeric code returned %v", err)
+	}
+
+	start := time.Now()
+	if resp, err := call(info, faultDelayHeader, "20"); err != nil || resp != "done" || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("TestFaultInjection: delayed call returned %v, %v after %v", resp, err, time.Since(start))
+	}
+	ctx, cancel := context.WithTimeout(metadata.NewIncomingContext(context.Background(), metadata.Pairs(faultDelayHeader, "1000")), 10*time.Millisecond)
+	defer cancel()
+	if _, err := intercept(ctx, nil, info, handler); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("TestFaultInjection: a delay past the deadline returned %v", err)
+	}
+
+	for _, bad := range [][]string{{faultCodeHeader, "SOMETIMES"}, {faultCodeHeader, "99"}, {faultDelayHeader, "-1"}, {faultDelayHeader, "forever"}} {
+		if _, err := call(info, bad...); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("TestFaultInjection: %s=%s returned %v, expected %s", bad[0], bad[1], err, codes.InvalidArgument)
+		}
+	}
+
+	health := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	if _, err := call(health, faultCodeHeader, "UNAVAILABLE"); err != nil {
+		t.Errorf("TestFaultInjection: health check was failed: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	eventContentType       = "application/json"
+
+	// cloudEventsTypePrefix turns an event type such as ShipmentCreated
+	// into a reverse-DNS CloudEvents type.
+	cloudEventsTypePrefix = "fok.shipping."
+	defaultEventSource    = "/" + serviceName
+)
+
+// FOK Workshop - CloudEvents
+//
+// cloudEvent is a shipment event in the CloudEvents 1.0 JSON format, as sent
+// in structured mode: the whole envelope is the message body. The
+// traceparent and tracestate attributes are the CloudEvents distributed
+// tracing extension. They hold the trace context the event was produced in,
+// so a consumer in any language can continue the trace with its CloudEvents
+// SDK, whether it got the event from Kafka, NATS or a webhook, and even after
+// it has been stored and forwarded without its message headers.
+type cloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	ID              string        `json:"id"`
+	Source          string        `json:"source"`
+	Type            string        `json:"type"`
+	Subject         string        `json:"subject"`
+	Time            time.Time     `json:"time"`
+	DataContentType string        `json:"datacontenttype"`
+	TraceParent     string        `json:"traceparent,omitempty"`
+	TraceState      string        `json:"tracestate,omitempty"`
+	Data            shipmentEvent `json:"data"`
+}
+
+// eventEncoder turns shipment events into message bodies. The zero value
+// sends the plain JSON payload.
+type eventEncoder struct {
+	cloudEvents bool
+	source      string
+	propagator  propagation.TextMapPropagator
+}
+
+// eventEncoderFromEnv returns the encoder for EVENT_FORMAT: json, the
+// default, or cloudevents, with CLOUDEVENTS_SOURCE as the source attribute.
+func eventEncoderFromEnv() eventEncoder {
+	switch format := os.Getenv("EVENT_FORMAT"); format {
+	case "", "json":
+		return eventEncoder{}
+	case "cloudevents":
+		source := os.Getenv("CLOUDEVENTS_SOURCE")
+		if source == "" {
+			source = defaultEventSource
+		}
+		return newCloudEventsEncoder(source)
+	default:
+		log.Fatalf("unknown EVENT_FORMAT %q: want json or cloudevents", format)
+		return eventEncoder{}
+	}
+}
+
+func newCloudEventsEncoder(source string) eventEncoder {
+	return eventEncoder{
+		cloudEvents: true,
+		source:      source,
+		propagator:  tracestatePropagatorFromEnv(propagation.TraceContext{}),
+	}
+}
+
+// contentType is the content type of the bodies the encoder produces.
+func (e eventEncoder) contentType() string {
+	if e.cloudEvents {
+		return cloudEventsContentType
+	}
+	return eventContentType
+}
+
+// encode returns the body of the message for ev, with the trace context of
+// ctx in the CloudEvents envelope.
+func (e eventEncoder) encode(ctx context.Context, ev shipmentEvent) ([]byte, error) {
+	if !e.cloudEvents {
+		return json.Marshal(ev)
+	}
+	carrier := propagation.MapCarrier{}
+	e.propagator.Inject(ctx, carrier)
+	return json.Marshal(cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              ev.ID,
+		Source:          e.source,
+		Type:            cloudEventsTypePrefix + ev.Type,
+		Subject:         ev.TrackingID,
+		Time:            ev.Time,
+		DataContentType: eventContentType,
+		TraceParent:     carrier.Get("traceparent"),
+		TraceState:      carrier.Get("tracestate"),
+		Data:            ev,
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestCloudEventsEncoder checks the CloudEvents envelope of a shipment event,
+// and that a consumer can continue the trace from its traceparent.
+func TestCloudEventsEncoder(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ev := testEvent()
+
+	plain, err := eventEncoder{}.encode(ctx, ev)
+	if err != nil || !bytes.Equal(plain, mustJSON(t, ev)) {
+		t.Errorf("TestCloudEventsEncoder: the default encoder gave %s (%v), want the plain event", plain, err)
+	}
+
+	body, err := newCloudEventsEncoder(defaultEventSource).encode(ctx, ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ce cloudEvent
+	if err := json.Unmarshal(body, &ce); err != nil {
+		t.Fatalf("TestCloudEventsEncoder: %v: %s", err, body)
+	}
+	if ce.SpecVersion != "1.0" || ce.ID != ev.ID || ce.Source != "/shippingservice" || ce.Type != "fok.shipping.ShipmentStatusChanged" ||
+		ce.Subject != "AB-123" || ce.DataContentType != "application/json" || ce.Data != ev {
+		t.Errorf("TestCloudEventsEncoder: unexpected envelope %s", body)
+	}
+	if ce.TraceState != defaultTracestateEntry {
+		t.Errorf("TestCloudEventsEncoder: tracestate is %q, want %q", ce.TraceState, defaultTracestateEntry)
+	}
+	carrier := propagation.MapCarrier{"traceparent": ce.TraceParent}
+	if got := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier)); !got.Equal(sc.WithRemote(true)) {
+		t.Errorf("TestCloudEventsEncoder: traceparent %q gave %v, want %v", ce.TraceParent, got, sc)
+	}
+}
+
+// TestWebhookCloudEvents checks that webhooks are sent as structured-mode
+// CloudEvents when the encoder says so.
+func TestWebhookCloudEvents(t *testing.T) {
+	type delivery struct {
+		contentType string
+		event       cloudEvent
+	}
+	received := make(chan delivery, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d delivery
+		d.contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&d.event)
+		received <- d
+	}))
+	defer srv.Close()
+
+	var deadLetter bytes.Buffer
+	w := newWebhookNotifier([]string{srv.URL}, &deadLetter)
+	w.encoder = newCloudEventsEncoder(defaultEventSource)
+	w.start()
+	defer close(w.queue)
+	if err := w.Publish(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case d := <-received:
+		if d.contentType != "application/cloudevents+json" || d.event.Subject != "AB-123" {
+			t.Errorf("TestWebhookCloudEvents: got %q with %+v", d.contentType, d.event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestWebhookCloudEvents: event was not delivered: %s", deadLetter.String())
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInitialConcurrencyLimit = 20
+	defaultMinConcurrencyLimit     = 1
+	defaultMaxConcurrencyLimit     = 200
+	defaultConcurrencyLatency      = 500 * time.Millisecond
+
+	// aimdBackoff is the factor the AIMD limit is cut by on overload.
+	aimdBackoff = 0.9
+	// gradientTolerance is how much slower than the long-term latency calls
+	// may get before the gradient limit shrinks.
+	gradientTolerance = 1.5
+	// gradientSmoothing weighs each new gradient limit against the current one.
+	gradientSmoothing = 0.2
+	// shortWindow and longWindow are the number of samples averaged by the
+	// short and long-term latencies.
+	shortWindow = 10
+	longWindow  = 600
+)
+
+// adaptiveLimit is a concurrency limit that follows the latency of the calls
+// it admits, in the manner of Netflix's concurrency-limits:
+//
+//   - "aimd" grows the limit by one for every call that completes within the
+//     latency target while the limit is in use, and cuts it by 10% for every
+//     call that does not, or that times out;
+//   - "gradient" compares the short-term latency with the long-term one.
+//     While the two agree the limit grows by its square root, a queue's
+//     worth; as calls slow down it shrinks in proportion, down to half of
+//     the limit at a time.
+//
+// Both keep the limit between min and max.
+type adaptiveLimit struct {
+	algorithm string
+	min, max  float64
+	target    time.Duration
+
+	mu                sync.Mutex
+	limit             float64
+	shortRTT, longRTT float64 // seconds
+	samples           int
+}
+
+func newAdaptiveLimit(algorithm string, initial, min, max int, target time.Duration) (*adaptiveLimit, error) {
+	if algorithm != "aimd" && algorithm != "gradient" {
+		return nil, fmt.Errorf("unknown algorithm %q, want fixed, aimd or gradient", algorithm)
+	}
+	if min < 1 || max < min {
+		return nil, fmt.Errorf("invalid limit range %d-%d", min, max)
+	}
+	a := &adaptiveLimit{algorithm: algorithm, min: float64(min), max: float64(max), target: target}
+	a.limit = a.clamp(float64(initial))
+	return a, nil
+}
+
+// update accounts for a call that took rtt with inflight calls running, and
+// returns the new limit. A timed-out call counts as overload.
+func (a *adaptiveLimit) update(rtt time.Duration, inflight int64, timedOut bool) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.observe(rtt.Seconds())
+	switch a.algorithm {
+	case "aimd":
+		switch {
+		case timedOut || rtt > a.target:
+			a.limit = a.clamp(a.limit * aimdBackoff)
+		case float64(inflight)*2 >= a.limit:
+			a.limit = a.clamp(a.limit + 1)
+		}
+	case "gradient":
+		// A limit far above the calls made says nothing about capacity.
+		if timedOut || float64(inflight)*2 >= a.limit {
+			// Calls too fast for the clock to time show no queueing.
+			gradient := 1.0
+			switch {
+			case timedOut:
+				gradient = 0.5
+			case a.shortRTT > 0:
+				gradient = math.Max(0.5, math.Min(1, gradientTolerance*a.longRTT/a.shortRTT))
+			}
+			next := a.limit*gradient + math.Sqrt(a.limit)
+			a.limit = a.clamp(a.limit*(1-gradientSmoothing) + next*gradientSmoothing)
+		}
+	}
+	return int64(a.limit)
+}
+
+// observe adds a latency sample to the short and long-term averages. The
+// long-term latency drifts towards a sustained slowdown, so a new normal
+// is eventually accepted rather than throttled forever.
+func (a *adaptiveLimit) observe(rtt float64) {
+	a.samples++
+	if a.samples == 1 {
+		a.shortRTT, a.longRTT = rtt, rtt
+		return
+	}
+	a.shortRTT += (rtt - a.shortRTT) * 2 / (shortWindow + 1)
+	a.longRTT += (rtt - a.longRTT) * 2 / (longWindow + 1)
+	if a.shortRTT > 0 && a.longRTT/a.shortRTT > 2 {
+		// Calls got much faster: catch up with them.
+		a.longRTT *= 0.95
+	}
+}
+
+// latencies returns the short and long-term latencies, in seconds.
+func (a *adaptiveLimit) latencies() (short, long float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.shortRTT, a.longRTT
+}
+
+func (a *adaptiveLimit) clamp(limit float64) float64 {
+	return math.Max(a.min, math.Min(a.max, limit))
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// envInt returns the integer value of the environment variable key, or def
+// if it is unset or cannot be parsed.
+func envInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Warnf("ignoring invalid %s=%q: %v", key, v, err)
+		return def
+	}
+	return n
+}
+
+// envDuration returns the duration value (e.g. "1m30s") of the environment
+// variable key, or def if it is unset or cannot be parsed.
+func envDuration(key string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Warnf("ignoring invalid %s=%q: %v", key, v, err)
+		return def
+	}
+	return d
+}
+
+// envFloat returns the floating point value of the environment variable key,
+// or def if it is unset or cannot be parsed.
+func envFloat(key string, def float64) float64 {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Warnf("ignoring invalid %s=%q: %v", key, v, err)
+		return def
+	}
+	return f
+}
+
+// envBool returns the boolean value (e.g. "true" or "0") of the environment
+// variable key, or def if it is unset or cannot be parsed.
+func envBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Warnf("ignoring invalid %s=%q: %v", key, v, err)
+		return def
+	}
+	return b
+}
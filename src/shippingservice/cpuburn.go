@@ -0,0 +1,112 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+const defaultCPUBurnRounds = 200000
+
+// cpuBurn gives the continuous-profiling exercises an obvious hotspot: in
+// chaos mode, a share of GetQuote calls, and the next calls requested from
+// the admin server, hash the quote key over and over. It deliberately leaves
+// no mark in traces or logs, so that it has to be found in a profile.
+type cpuBurn struct {
+	chance  float64
+	rounds  int
+	enabled func() bool
+	// pending is the number of calls still to burn on request.
+	pending atomic.Int64
+}
+
+// cpuBurnFromEnv returns the burn configured by CHAOS_CPU_BURN_CHANCE and
+// CHAOS_CPU_BURN_ROUNDS. It is always returned, so that burns can be
+// requested from the admin server.
+func cpuBurnFromEnv(faults *faultInjector) *cpuBurn {
+	return &cpuBurn{
+		chance:  envFloat("CHAOS_CPU_BURN_CHANCE", 0),
+		rounds:  envInt("CHAOS_CPU_BURN_ROUNDS", defaultCPUBurnRounds),
+		enabled: faults.enabled.Load,
+	}
+}
+
+// quote burns CPU for a GetQuote call if it is to. A nil burn never does.
+func (b *cpuBurn) quote(ctx context.Context, key quoteCacheKey) {
+	if b == nil || !b.enabled() {
+		return
+	}
+	if !b.take() && (b.chance <= 0 || random.Float64() >= b.chance) {
+		return
+	}
+	rehashQuoteKey(ctx, key.String(), b.rounds)
+}
+
+// take uses up one of the requested burns, if any are left.
+func (b *cpuBurn) take() bool {
+	for {
+		n := b.pending.Load()
+		if n <= 0 {
+			return false
+		}
+		if b.pending.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// rehashQuoteKey hashes key rounds times, each round hashing the last
+// digest, and stops early if ctx is done.
+func rehashQuoteKey(ctx context.Context, key string, rounds int) [sha256.Size]byte {
+	sum := sha256.Sum256([]byte(key))
+	for i := 0; i < rounds; i++ {
+		if i%1000 == 0 && ctx.Err() != nil {
+			break
+		}
+		sum = sha256.Sum256(sum[:])
+	}
+	return sum
+}
+
+// ServeHTTP reports the burn settings. POST ?calls=N burns CPU in the next
+// N GetQuote calls, as long as chaos mode is on.
+func (b *cpuBurn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		n, err := strconv.ParseInt(r.FormValue("calls"), 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "calls must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		b.pending.Store(n)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Chance  float64 `json:"chance"`
+		Rounds  int     `json:"rounds"`
+		Pending int64   `json:"pending_calls"`
+		Enabled bool    `json:"enabled"`
+	}{b.chance, b.rounds, b.pending.Load(), b.enabled()})
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCPUBurn checks that burns requested from the admin server are used up
+// by GetQuote calls, and only in chaos mode.
+func TestCPUBurn(t *testing.T) {
+	faults := newFaultInjector(false)
+	b := cpuBurnFromEnv(faults)
+	b.rounds = 10
+
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chaos/cpuburn?calls=2", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"pending_calls":2`) {
+		t.Errorf("TestCPUBurn: POST returned %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chaos/cpuburn?calls=many", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("TestCPUBurn: invalid calls returned %d", rec.Code)
+	}
+
+	ctx := context.Background()
+	b.quote(ctx, quoteCacheKey{})
+	if n := b.pending.Load(); n != 2 {
+		t.Errorf("TestCPUBurn: %d burns pending with chaos mode off, want 2", n)
+	}
+	faults.setEnabled(true)
+	for i := 0; i < 3; i++ {
+		b.quote(ctx, quoteCacheKey{})
+	}
+	if n := b.pending.Load(); n != 0 {
+		t.Errorf("TestCPUBurn: %d burns pending after 3 calls, want 0", n)
+	}
+
+	if rehashQuoteKey(ctx, "k", 10) == rehashQuoteKey(ctx, "k", 11) {
+		t.Errorf("TestCPUBurn: extra rounds did not change the digest")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultCacheCleanupSchedule      = "*/5 * * * *"
+	defaultQuotePurgeSchedule        = "*/15 * * * *"
+	defaultShipmentRetentionSchedule = "0 * * * *"
+	defaultShipmentRetention         = 7 * 24 * time.Hour
+)
+
+// cronSchedule is a parsed cron expression: five fields for the minute, hour,
+// day of the month, month and day of the week, each a set of values, or an
+// "@every <duration>" interval.
+type cronSchedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+	every                         time.Duration
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// parseCronSchedule parses a standard cron expression such as
+// "*/5 9-17 * * 1-5", with lists, ranges and steps, one of the @hourly
+// style macros, or "@every 90s".
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every <= 0 {
+			return nil, fmt.Errorf("invalid interval in %q", spec)
+		}
+		return &cronSchedule{spec: spec, every: every}, nil
+	}
+	expr := spec
+	if m, ok := cronMacros[spec]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%q must have 5 fields, got %d", spec, len(fields))
+	}
+	s := &cronSchedule{spec: spec}
+	ranges := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+	for i, r := range ranges {
+		set, err := parseCronField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, fmt.Errorf("%q: field %d: %w", spec, i+1, err)
+		}
+		*r.set = set
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	s.domRestricted, s.dowRestricted = fields[2] != "*", fields[4] != "*"
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of "*", "n" or "a-b" terms,
+// each optionally followed by "/step", into a set of values.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, term := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(term, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", a)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", b)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", term, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time after t that the schedule fires, in the
+// location of t.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Any schedule fires within a few years, as February 29 does.
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applies the cron rule that a day matches either field when both
+// the day of the month and the day of the week are restricted.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// cronJob is maintenance work run on a schedule. run returns the attributes
+// describing what it did, which are added to the span of the run.
+type cronJob struct {
+	name     string
+	schedule *cronSchedule
+	run      func(ctx context.Context) ([]attribute.KeyValue, error)
+}
+
+// scheduler runs cron jobs. Every run is a root span of its own, as nothing
+// requested it, carrying the schedule and the time it was due so that late
+// or overlong runs can be found.
+type scheduler struct {
+	jobs []cronJob
+	now  func() time.Time
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{now: time.Now}
+}
+
+// add schedules a job with the spec of the given environment variable, or
+// def if it is unset. A spec of "off" leaves the job out.
+func (s *scheduler) add(name, env, def string, run func(ctx context.Context) ([]attribute.KeyValue, error)) {
+	spec := os.Getenv(env)
+	if spec == "" {
+		spec = def
+	}
+	if spec == "off" {
+		return
+	}
+	sched, err := parseCronSchedule(spec)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", env, err)
+	}
+	s.jobs = append(s.jobs, cronJob{name: name, schedule: sched, run: run})
+}
+
+// maintenanceScheduler schedules the clean-up of the stores of svc. Stores in
+// Redis expire their own keys.
+func maintenanceScheduler(svc *server) *scheduler {
+	type expirer interface{ purgeExpired(now time.Time) int }
+	s := newScheduler()
+	deleted := newRetentionMetrics()
+	s.add("cache.cleanup", "CRON_CACHE_CLEANUP", defaultCacheCleanupSchedule, func(ctx context.Context) ([]attribute.KeyValue, error) {
+		var quotes, keys int
+		if c, ok := svc.quotes.(expirer); ok {
+			quotes = c.purgeExpired(time.Now())
+		}
+		if c, ok := svc.idempotency.(expirer); ok {
+			keys = c.purgeExpired(time.Now())
+		}
+		return []attribute.KeyValue{
+			deleted.record(ctx, "cache.cleanup", "cache.quotes", quotes),
+			deleted.record(ctx, "cache.cleanup", "cache.idempotency_keys", keys),
+		}, nil
+	})
+	s.add("quotes.purge", "CRON_QUOTE_PURGE", defaultQuotePurgeSchedule, func(ctx context.Context) ([]attribute.KeyValue, error) {
+		n, err := svc.issued.deleteExpired(ctx, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return []attribute.KeyValue{deleted.record(ctx, "quotes.purge", "quotes", n)}, nil
+	})
+	policy := retentionPolicyFromEnv()
+	s.add("shipments.retention", "CRON_SHIPMENT_RETENTION", defaultShipmentRetentionSchedule, func(ctx context.Context) ([]attribute.KeyValue, error) {
+		res, err := svc.shipments.purgeFinished(ctx, time.Now(), policy)
+		if err != nil {
+			return nil, err
+		}
+		deleted.record(ctx, "shipments.retention", "shipments", res.delivered, attribute.String("shipment.status", "delivered"))
+		deleted.record(ctx, "shipments.retention", "shipments", res.cancelled, attribute.String("shipment.status", "cancelled"))
+		return []attribute.KeyValue{
+			attribute.Int("shipments.purged", res.shipments()),
+			attribute.Int("shipments.purged.delivered", res.delivered),
+			attribute.Int("shipments.purged.cancelled", res.cancelled),
+			deleted.record(ctx, "shipments.retention", "shipment_events", res.events),
+			attribute.String("shipments.retention.delivered", policy.delivered.String()),
+			attribute.String("shipments.retention.cancelled", policy.cancelled.String()),
+		}, nil
+	})
+	return s
+}
+
+// run runs every job on its schedule until ctx is done. A job is never run
+// twice at once: a run that overlaps the next due time skips it.
+func (s *scheduler) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func(j cronJob) {
+			defer wg.Done()
+			for {
+				due := j.schedule.next(s.now())
+				if due.IsZero() {
+					log.Warnf("cron: %s never fires", j.name)
+					return
+				}
+				if err := sleepContext(ctx, due.Sub(s.now())); err != nil {
+					return
+				}
+				s.runOnce(ctx, j, due)
+			}
+		}(j)
+	}
+	wg.Wait()
+}
+
+// runOnce runs a job that was due at the given time.
+func (s *scheduler) runOnce(ctx context.Context, j cronJob, due time.Time) {
+	start := s.now()
+	ctx, span := tracer.Start(ctx, "cron "+j.name,
+		trace.WithNewRoot(),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(
+			attribute.String("cron.job", j.name),
+			attribute.String("cron.schedule", j.schedule.spec),
+			attribute.String("cron.scheduled_time", due.UTC().Format(time.RFC3339)),
+			attribute.String("cron.next_time", j.schedule.next(due).UTC().Format(time.RFC3339)),
+			attribute.Int64("cron.delay_ms", start.Sub(due).Milliseconds()),
+		))
+	defer span.End()
+
+	attrs, err := j.run(ctx)
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		log.Ctx(ctx).WithError(err).Warnf("cron: %s failed", j.name)
+		return
+	}
+	log.Ctx(ctx).Debugf("cron: %s done in %v", j.name, s.now().Sub(start))
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestCronScheduleNext checks when cron expressions fire next.
+func TestCronScheduleNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2024, 5, 15, 10, 7, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2024, 5, 15, 10, 10, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 5, 16, 2, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2024, 5, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,20 * *", time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches.
+		{"0 0 1 * 5", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", from.Add(90 * time.Second)},
+	} {
+		s, err := parseCronSchedule(tc.spec)
+		if err != nil {
+			t.Errorf("TestCronScheduleNext: %q: %v", tc.spec, err)
+			continue
+		}
+		if got := s.next(from); !got.Equal(tc.want) {
+			t.Errorf("TestCronScheduleNext: %q fires at %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+	if s, _ := parseCronSchedule("0 0 31 2 *"); !s.next(from).IsZero() {
+		t.Error("TestCronScheduleNext: February 31 fired")
+	}
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every soon"} {
+		if _, err := parseCronSchedule(bad); err == nil {
+			t.Errorf("TestCronScheduleNext: %q was accepted", bad)
+		}
+	}
+}
+
+// TestCronRunSpan checks that a run is a root span recording the schedule
+// and the result of the job.
+func TestCronRunSpan(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	svc := newServer()
+	svc.shipments.create(context.Background(), defaultTenant, "AB-1", &pb.Address{}, nil, 0)
+	svc.shipments.transition(context.Background(), defaultTenant, "AB-1", pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED)
+	svc.shipments.create(context.Background(), defaultTenant, "AB-2", &pb.Address{}, nil, 0)
+	t.Setenv("SHIPMENT_RETENTION", "0s")
+	s := maintenanceScheduler(svc)
+	if len(s.jobs) != 3 {
+		t.Fatalf("TestCronRunSpan: %d jobs scheduled, want 3", len(s.jobs))
+	}
+	var retention cronJob
+	for _, j := range s.jobs {
+		if j.name == "shipments.retention" {
+			retention = j
+		}
+	}
+
+	ctx, parent := tracer.Start(context.Background(), "caller")
+	due := time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return due.Add(3 * time.Second) }
+	s.runOnce(ctx, retention, due)
+	parent.End()
+
+	span := rec.Ended()[0]
+	if span.Name() != "cron shipments.retention" || span.Parent().IsValid() {
+		t.Fatalf("TestCronRunSpan: got span %q with parent %v, want a root cron span", span.Name(), span.Parent())
+	}
+	attrs := attribute.NewSet(span.Attributes()...)
+	for k, want := range map[attribute.Key]string{
+		"cron.job":            "shipments.retention",
+		"cron.schedule":       defaultShipmentRetentionSchedule,
+		"cron.scheduled_time": "2024-05-15T11:00:00Z",
+		"cron.next_time":      "2024-05-15T12:00:00Z",
+	} {
+		if v, _ := attrs.Value(k); v.AsString() != want {
+			t.Errorf("TestCronRunSpan: %s is %q, want %q", k, v.AsString(), want)
+		}
+	}
+	if v, _ := attrs.Value("cron.delay_ms"); v.AsInt64() != 3000 {
+		t.Errorf("TestCronRunSpan: cron.delay_ms is %d, want 3000", v.AsInt64())
+	}
+	if v, _ := attrs.Value("shipments.purged"); v.AsInt64() != 1 {
+		t.Errorf("TestCronRunSpan: shipments.purged is %d, want 1", v.AsInt64())
+	}
+	if _, err := svc.shipments.get(context.Background(), defaultTenant, "AB-2"); err != nil {
+		t.Errorf("TestCronRunSpan: a live shipment was purged")
+	}
+
+	t.Setenv("CRON_QUOTE_PURGE", "off")
+	if n := len(maintenanceScheduler(svc).jobs); n != 2 {
+		t.Errorf("TestCronRunSpan: %d jobs with one off, want 2", n)
+	}
+}
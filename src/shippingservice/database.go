@@ -0,0 +1,146 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	dialectPostgres = "postgres"
+	dialectSQLite   = "sqlite"
+
+	defaultSQLiteURL = "sqlite://shipping.db"
+)
+
+// database is the SQL database the service keeps its state in: Postgres, or
+// SQLite for running without any external dependency.
+type database struct {
+	*sql.DB
+	dialect string
+	// target is the URL of the database without credentials, for logs and
+	// span attributes.
+	target string
+}
+
+// openDatabase opens a database by URL: postgres://… or postgresql://… for
+// Postgres, and sqlite://path or sqlite::memory: for SQLite. Opening does not
+// connect; the first query does. Statements are traced by otelsql, and the
+// connection pool is reported as metrics.
+func openDatabase(url string) (*database, error) {
+	var d *database
+	var attrs []attribute.KeyValue
+	switch {
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		attrs = []attribute.KeyValue{attribute.String("db.system", "postgresql")}
+		if u, err := neturl.Parse(url); err == nil {
+			attrs = append(attrs,
+				attribute.String("server.address", u.Hostname()),
+				attribute.String("db.name", strings.TrimPrefix(u.Path, "/")))
+		}
+		db, err := openTracedDB("postgres", url, attrs)
+		if err != nil {
+			return nil, err
+		}
+		d = &database{DB: db, dialect: dialectPostgres, target: redactURL(url)}
+	case strings.HasPrefix(url, "sqlite:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(url, "sqlite:"), "//")
+		attrs = []attribute.KeyValue{
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.name", path),
+		}
+		db, err := openTracedDB("sqlite", path, attrs)
+		if err != nil {
+			return nil, err
+		}
+		// SQLite allows one writer at a time, and every connection to
+		// :memory: would be a database of its own.
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec("PRAGMA foreign_keys = ON; PRAGMA busy_timeout = 5000"); err != nil {
+			db.Close()
+			return nil, err
+		}
+		d = &database{DB: db, dialect: dialectSQLite, target: path}
+	default:
+		return nil, fmt.Errorf("unsupported database URL %q: want postgres://… or sqlite://…", redactURL(url))
+	}
+	if err := otelsql.RegisterDBStatsMetrics(d.DB, otelsql.WithAttributes(attrs...)); err != nil {
+		log.WithError(err).Warn("failed to register database connection metrics")
+	}
+	return d, nil
+}
+
+// openTracedDB opens a database like sql.Open, with every statement made
+// within a trace getting a client span. Statements outside of any trace are
+// not traced, and neither are the session resets and row reads that go with
+// every statement.
+func openTracedDB(driverName, dsn string, attrs []attribute.KeyValue) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(attrs...),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}))
+}
+
+// rebind rewrites the ? placeholders of a query to $1, $2, … for Postgres, so
+// that queries can be written once for both dialects.
+func (db *database) rebind(query string) string {
+	if db.dialect != dialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// redactURL drops the password from a database URL.
+func redactURL(url string) string {
+	scheme, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		return url
+	}
+	userinfo, host, ok := strings.Cut(rest, "@")
+	if !ok {
+		return url
+	}
+	user, _, _ := strings.Cut(userinfo, ":")
+	return scheme + "://" + user + "@" + host
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracedDatabase checks that statements made within a trace get client
+// spans with their statements, and that the connection pool is reported.
+func TestTracedDatabase(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	reader := sdkmetric.NewManualReader()
+	savedTP, savedMP := otel.GetTracerProvider(), otel.GetMeterProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer func() {
+		otel.SetTracerProvider(savedTP)
+		otel.SetMeterProvider(savedMP)
+	}()
+
+	db, err := openDatabase("sqlite://" + filepath.Join(t.TempDir(), "shipping.db"))
+	if err != nil {
+		t.Fatalf("TestTracedDatabase: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "CREATE TABLE notes (id INTEGER, body TEXT)"); err != nil {
+		t.Fatalf("TestTracedDatabase: %v", err)
+	}
+	if n := len(rec.Ended()); n != 0 {
+		t.Errorf("TestTracedDatabase: %d spans for statements outside a trace, want 0", n)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(ctx, "caller")
+	if _, err := db.ExecContext(ctx, "INSERT INTO notes (id, body) VALUES (?, ?)", 7, "secret"); err != nil {
+		t.Fatalf("TestTracedDatabase: %v", err)
+	}
+	db.ExecContext(ctx, "SELECT * FROM missing")
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("TestTracedDatabase: got %d spans, want 3", len(spans))
+	}
+	insert, failed := spans[0], spans[1]
+	attrs := attribute.NewSet(insert.Attributes()...)
+	for k, want := range map[attribute.Key]string{
+		"db.system":    "sqlite",
+		"db.statement": "INSERT INTO notes (id, body) VALUES (?, ?)",
+	} {
+		if v, _ := attrs.Value(k); v.AsString() != want {
+			t.Errorf("TestTracedDatabase: %s is %q, want %q", k, v.AsString(), want)
+		}
+	}
+	if insert.Name() != "sql.conn.exec" || insert.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("TestTracedDatabase: got span %q with parent %v", insert.Name(), insert.Parent())
+	}
+	if failed.Status().Code.String() != "Error" {
+		t.Errorf("TestTracedDatabase: failed statement has status %v", failed.Status())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("TestTracedDatabase: %v", err)
+	}
+	found := false
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if g, ok := m.Data.(metricdata.Gauge[int64]); ok && m.Name == "db.sql.connection.max_open" {
+				found = len(g.DataPoints) == 1 && g.DataPoints[0].Value == 1
+			}
+		}
+	}
+	if !found {
+		t.Error("TestTracedDatabase: db.sql.connection.max_open is not 1")
+	}
+}
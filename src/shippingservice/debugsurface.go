@@ -0,0 +1,179 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	profileWorkshop   = "workshop"
+	profileProduction = "production"
+)
+
+// debugSurface says which of the endpoints that expose or change the
+// service's internals are served. The workshop profile serves all of them,
+// so that they can be explored; the production profile serves none unless
+// each is turned on by its own variable. The channelz gRPC service is off in
+// both, as the gRPC port can be reached from outside the pod.
+type debugSurface struct {
+	profile         string
+	reflection      bool
+	zpages          bool
+	pprof           bool
+	configDump      bool
+	channelz        bool
+	channelzService bool
+	inflight        bool
+	adminWrites     bool
+	chaos           bool
+}
+
+// debugSurfaceFromEnv reads DEPLOYMENT_PROFILE, then GRPC_REFLECTION,
+// ZPAGES, PPROF, CONFIG_DUMP, CHANNELZ, INFLIGHT, ADMIN_WRITES and
+// CHAOS_ENDPOINTS, which default to whether the profile is workshop, and
+// CHANNELZ_SERVICE.
+func debugSurfaceFromEnv() debugSurface {
+	profile := strings.ToLower(os.Getenv("DEPLOYMENT_PROFILE"))
+	switch profile {
+	case profileWorkshop, profileProduction:
+	case "":
+		profile = profileWorkshop
+	default:
+		log.Warnf("ignoring unknown DEPLOYMENT_PROFILE=%q", profile)
+		profile = profileWorkshop
+	}
+	open := profile == profileWorkshop
+	d := debugSurface{
+		profile:         profile,
+		reflection:      envBool("GRPC_REFLECTION", open),
+		zpages:          envBool("ZPAGES", open),
+		pprof:           envBool("PPROF", open),
+		configDump:      envBool("CONFIG_DUMP", open),
+		channelz:        envBool("CHANNELZ", open),
+		channelzService: envBool("CHANNELZ_SERVICE", false),
+		inflight:        envBool("INFLIGHT", open),
+		adminWrites:     envBool("ADMIN_WRITES", open),
+		chaos:           envBool("CHAOS_ENDPOINTS", open),
+	}
+	log.Infof("%s profile: reflection %v, zPages %v, pprof %v, config dump %v, channelz %v (gRPC service %v), inflight %v, admin writes %v, chaos endpoints %v",
+		d.profile, d.reflection, d.zpages, d.pprof, d.configDump, d.channelz, d.channelzService, d.inflight, d.adminWrites, d.chaos)
+	return d
+}
+
+// registerGRPC serves the reflection and channelz services on srv, those of
+// them that are on.
+func (d debugSurface) registerGRPC(srv *grpc.Server) {
+	if d.reflection {
+		reflection.Register(srv)
+	}
+	if d.channelzService {
+		registerChannelzService(srv)
+	}
+}
+
+// registerAdmin serves the zPages kept by zp, pprof, the config dump and the
+// channelz view on the admin server, those of them that are on.
+func (d debugSurface) registerAdmin(admin *adminServer, zp *zpages) {
+	if d.zpages && zp != nil {
+		admin.handle("/debug/tracez", zp.tracez())
+		admin.handle("/debug/rpcz", zp.rpcz())
+	}
+	if d.pprof {
+		admin.handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+		admin.handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+		admin.handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+		admin.handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+		admin.handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	}
+	if d.configDump {
+		admin.handle("/config", configDump{debug: d})
+	}
+	if d.channelz {
+		admin.handle("/debug/channelz", newChannelzView())
+	}
+}
+
+// writable returns h, or without admin writes a handler that only lets GET
+// requests through to it.
+func (d debugSurface) writable(h http.Handler) http.Handler {
+	if d.adminWrites {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "changes are turned off in the "+d.profile+" profile; set ADMIN_WRITES=true", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// configDump serves the environment of the process as JSON, with secrets
+// redacted, and the debug surface it led to.
+type configDump struct {
+	debug debugSurface
+}
+
+func (c configDump) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = redactEnv(k, v)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	d := c.debug
+	json.NewEncoder(w).Encode(struct {
+		Profile         string            `json:"profile"`
+		Reflection      bool              `json:"reflection"`
+		ZPages          bool              `json:"zpages"`
+		PProf           bool              `json:"pprof"`
+		Channelz        bool              `json:"channelz"`
+		ChannelzService bool              `json:"channelz_service"`
+		Inflight        bool              `json:"inflight"`
+		AdminWrites     bool              `json:"admin_writes"`
+		Chaos           bool              `json:"chaos_endpoints"`
+		Environment     map[string]string `json:"environment"`
+	}{d.profile, d.reflection, d.zpages, d.pprof, d.channelz, d.channelzService, d.inflight, d.adminWrites, d.chaos, env})
+}
+
+// secretEnvWords mark the variables whose values are never shown.
+var secretEnvWords = []string{"SECRET", "PASSWORD", "TOKEN", "KEY", "CREDENTIAL", "HEADERS", "AUTH"}
+
+// redactEnv hides the value of a variable that looks like a secret, and the
+// password of a URL.
+func redactEnv(name, value string) string {
+	upper := strings.ToUpper(name)
+	for _, w := range secretEnvWords {
+		if strings.Contains(upper, w) && value != "" {
+			return "[redacted]"
+		}
+	}
+	return redactURL(value)
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDebugSurface checks that the production profile turns every debug
+// endpoint and admin write off unless it is asked for, and that the config
+// dump hides secrets.
+func TestDebugSurface(t *testing.T) {
+	if d := debugSurfaceFromEnv(); !d.reflection || !d.zpages || !d.pprof || !d.configDump ||
+		!d.channelz || !d.inflight || !d.adminWrites || !d.chaos || d.channelzService {
+		t.Errorf("TestDebugSurface: workshop profile serves %+v, want everything but the channelz service", d)
+	}
+
+	t.Setenv("DEPLOYMENT_PROFILE", "production")
+	t.Setenv("CONFIG_DUMP", "true")
+	t.Setenv("SMTP_PASSWORD", "hunter2")
+	t.Setenv("DATABASE_URL", "postgres://shipping:secret@db:5432/shipping")
+	d := debugSurfaceFromEnv()
+	if d.reflection || d.zpages || d.pprof || !d.configDump ||
+		d.channelz || d.channelzService || d.inflight || d.adminWrites || d.chaos {
+		t.Errorf("TestDebugSurface: production profile with CONFIG_DUMP serves %+v", d)
+	}
+	admin := newAdminServer(":0")
+	d.registerAdmin(admin, newZPages())
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	admin.handle("/loglevel", d.writable(ok))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		admin.mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	get := func(path string) *httptest.ResponseRecorder { return serve(http.MethodGet, path) }
+	for _, path := range []string{"/debug/pprof/", "/debug/tracez", "/debug/rpcz", "/debug/channelz"} {
+		if rec := get(path); rec.Code != http.StatusNotFound {
+			t.Errorf("TestDebugSurface: %s returned %d, want 404", path, rec.Code)
+		}
+	}
+	if rec := get("/loglevel"); rec.Code != http.StatusOK {
+		t.Errorf("TestDebugSurface: GET /loglevel returned %d, want 200", rec.Code)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodPost} {
+		if rec := serve(method, "/loglevel?level=trace"); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+			t.Errorf("TestDebugSurface: %s /loglevel returned %d, want 405", method, rec.Code)
+		}
+	}
+	rec := get("/config")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, `"profile":"production"`) ||
+		!strings.Contains(body, `"postgres://shipping@db:5432/shipping"`) {
+		t.Errorf("TestDebugSurface: /config returned %d %s", rec.Code, body)
+	}
+	if strings.Contains(body, "hunter2") || strings.Contains(body, ":secret@") {
+		t.Errorf("TestDebugSurface: /config shows secrets: %s", body)
+	}
+}
+
+// TestAdminServerAddr checks that the admin server listens on the loopback
+// interface unless ADMIN_HOST says otherwise.
+func TestAdminServerAddr(t *testing.T) {
+	if a := adminServerFromEnv(); a == nil || a.addr != "127.0.0.1:8081" {
+		t.Errorf("TestAdminServerAddr: default admin server is %+v, want 127.0.0.1:8081", a)
+	}
+	t.Setenv("ADMIN_HOST", "0.0.0.0")
+	t.Setenv("ADMIN_PORT", "9090")
+	if a := adminServerFromEnv(); a == nil || a.addr != "0.0.0.0:9090" {
+		t.Errorf("TestAdminServerAddr: admin server is %+v, want 0.0.0.0:9090", a)
+	}
+	t.Setenv("ADMIN_PORT", "off")
+	if a := adminServerFromEnv(); a != nil {
+		t.Errorf("TestAdminServerAddr: ADMIN_PORT=off returned %+v, want nil", a)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	defaultWeekend = "Sat,Sun"
+)
+
+// businessCalendar knows which days carriers do not deliver on.
+type businessCalendar struct {
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+}
+
+// newBusinessCalendar builds a calendar from a comma-separated list of
+// weekend day names (e.g. "Sat,Sun") and holiday dates in YYYY-MM-DD form.
+func newBusinessCalendar(weekend, holidays string) (*businessCalendar, error) {
+	c := &businessCalendar{
+		weekend:  make(map[time.Weekday]bool),
+		holidays: make(map[string]bool),
+	}
+	for _, name := range splitList(weekend) {
+		d, ok := parseWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", name)
+		}
+		c.weekend[d] = true
+	}
+	for _, date := range splitList(holidays) {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: %w", date, err)
+		}
+		c.holidays[date] = true
+	}
+	return c, nil
+}
+
+// calendarFromEnv reads the calendar from WEEKEND_DAYS and HOLIDAYS, falling
+// back to a Saturday/Sunday weekend with no holidays.
+func calendarFromEnv() *businessCalendar {
+	weekend, ok := os.LookupEnv("WEEKEND_DAYS")
+	if !ok {
+		weekend = defaultWeekend
+	}
+	c, err := newBusinessCalendar(weekend, os.Getenv("HOLIDAYS"))
+	if err != nil {
+		log.Fatalf("invalid delivery calendar: %v", err)
+	}
+	return c
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseWeekday accepts full or abbreviated (at least three letters) day names.
+func parseWeekday(s string) (time.Weekday, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.HasPrefix(strings.ToLower(d.String()), strings.ToLower(s)) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// isBusinessDay reports whether t is neither a weekend day nor a holiday.
+func (c *businessCalendar) isBusinessDay(t time.Time) bool {
+	return !c.weekend[t.Weekday()] && !c.holidays[t.Format(dateLayout)]
+}
+
+// addBusinessDays returns the date n business days after t.
+func (c *businessCalendar) addBusinessDays(t time.Time, n int) time.Time {
+	for n > 0 {
+		t = t.AddDate(0, 0, 1)
+		if c.isBusinessDay(t) {
+			n--
+		}
+	}
+	return t
+}
+
+// transitDays is the number of business days a parcel spends in transit.
+func transitDays(method pb.ShippingMethod, z zone) int {
+	switch method {
+	case pb.ShippingMethod_SHIPPING_METHOD_OVERNIGHT:
+		if z == zoneInternational {
+			return 3
+		}
+		return 1
+	case pb.ShippingMethod_SHIPPING_METHOD_EXPRESS:
+		if z == zoneInternational {
+			return 5
+		}
+		return 1 + int(z+2)/3
+	default:
+		if z == zoneInternational {
+			return 10
+		}
+		return 1 + int(z)
+	}
+}
+
+// GetDeliveryEstimate estimates when an order shipped on the given date will
+// arrive, skipping weekends and holidays.
+func (s *server) GetDeliveryEstimate(ctx context.Context, in *pb.GetDeliveryEstimateRequest) (*pb.GetDeliveryEstimateResponse, error) {
+	log.Ctx(ctx).Info("[GetDeliveryEstimate] received request")
+	defer log.Ctx(ctx).Info("[GetDeliveryEstimate] completed request")
+
+	shipDate := time.Now().UTC()
+	if in.ShipDate != nil {
+		if err := in.ShipDate.CheckValid(); err != nil {
+			return nil, rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, fmt.Sprintf("invalid ship_date: %v", err),
+				badRequest(&errdetails.BadRequest_FieldViolation{Field: "ship_date", Description: err.Error()}))
+		}
+		shipDate = in.ShipDate.AsTime()
+	}
+	method := in.Method
+	if method == pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED {
+		method = pb.ShippingMethod_SHIPPING_METHOD_STANDARD
+	}
+
+	z := destinationZone(in.Address)
+	days := transitDays(method, z)
+	eta := s.calendar.addBusinessDays(shipDate, days)
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("shipping.method", method.String()),
+		attribute.String("shipping.zone", z.String()),
+		attribute.Int("delivery.business_days", days),
+	)
+
+	return &pb.GetDeliveryEstimateResponse{
+		EstimatedDelivery: timestamppb.New(eta),
+		BusinessDays:      int32(days),
+		Zone:              z.String(),
+	}, nil
+}
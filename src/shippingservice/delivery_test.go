@@ -0,0 +1,66 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+func TestAddBusinessDays(t *testing.T) {
+	c, err := newBusinessCalendar("Sat,Sun", "2022-12-26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Friday 2022-12-23 plus one business day skips the weekend and the
+	// Boxing Day holiday.
+	start := time.Date(2022, 12, 23, 10, 0, 0, 0, time.UTC)
+	got := c.addBusinessDays(start, 1).Format(dateLayout)
+	if got != "2022-12-27" {
+		t.Errorf("addBusinessDays = %s, expected 2022-12-27", got)
+	}
+}
+
+func TestNewBusinessCalendarRejectsInvalidInput(t *testing.T) {
+	if _, err := newBusinessCalendar("Caturday", ""); err == nil {
+		t.Error("expected an error for an unknown weekday")
+	}
+	if _, err := newBusinessCalendar("", "26/12/2022"); err == nil {
+		t.Error("expected an error for a malformed holiday")
+	}
+}
+
+func TestGetDeliveryEstimate(t *testing.T) {
+	s := newServer()
+	res, err := s.GetDeliveryEstimate(context.Background(), &pb.GetDeliveryEstimateRequest{
+		Address:  &pb.Address{ZipCode: 94043},
+		Method:   pb.ShippingMethod_SHIPPING_METHOD_OVERNIGHT,
+		ShipDate: timestamppb.New(time.Date(2022, 12, 23, 10, 0, 0, 0, time.UTC)),
+	})
+	if err != nil {
+		t.Fatalf("TestGetDeliveryEstimate (%v) failed", err)
+	}
+	if got := res.EstimatedDelivery.AsTime().Format(dateLayout); got != "2022-12-26" {
+		t.Errorf("TestGetDeliveryEstimate: estimated delivery %s, expected 2022-12-26", got)
+	}
+	if res.Zone != "zone-1" {
+		t.Errorf("TestGetDeliveryEstimate: zone %q, expected zone-1", res.Zone)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/internal/telemetry"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+const clientUsage = `usage: shippingservice client <quote|ship|track|history> [flags]
+
+  quote    get a shipping quote for an address and items
+  ship     ship an order, optionally at a quoted price
+  track    get the status of a shipment
+  history  get every change of state of a shipment
+
+Run "shippingservice client <command> -h" for the flags of a command.
+`
+
+// clientCommand calls the service from the command line, for the workshop
+// instructions, and prints the response and the ID of its trace to out.
+// The call is traced, and its trace context and baggage propagated, like a
+// call from another service; client spans are exported only if
+// OTEL_EXPORTER_OTLP_ENDPOINT is set.
+func clientCommand(args []string, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, clientUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("client "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	addr := fs.String("addr", "localhost:"+defaultPort, "address of the server")
+	tenant := fs.String("tenant", "", "tenant ID to send in "+tenantHeader)
+	debug := fs.Bool("debug", false, "force the trace to be sampled")
+	bag := fs.String("baggage", "", "W3C baggage to propagate, e.g. \"tenant.id=acme\"")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the call")
+
+	var (
+		street, city, state, country *string
+		zip                          *int
+		items, dims                  *string
+		level                        *string
+		declared                     *float64
+		signature, insured           *bool
+		value                        *float64
+	)
+	address := func() {
+		street = fs.String("street", "1600 Amphitheatre Parkway", "street address")
+		city = fs.String("city", "Mountain View", "city")
+		state = fs.String("state", "CA", "state")
+		country = fs.String("country", "USA", "country")
+		zip = fs.Int("zip", 94043, "zip code")
+		items = fs.String("items", "OLJCESPC7Z:1", "items, as product:quantity pairs separated by commas")
+		dims = fs.String("dims", "", "sizes of the products, as product:LxWxH[:grams] in cm separated by commas")
+		level = fs.String("level", "standard", "service level: economy, standard or premium")
+		declared = fs.Float64("declared", 0, "declared value of the contents, in USD")
+		signature = fs.Bool("signature", false, "require a signature on delivery")
+		insured = fs.Bool("insure", false, "insure the contents for their declared value")
+	}
+	var quoteID, trackingID *string
+	switch args[0] {
+	case "quote":
+		address()
+		value = fs.Float64("value", 0, "value of the order in USD, for promotions")
+	case "ship":
+		address()
+		quoteID = fs.String("quote", "", "ID of a quote to ship at")
+	case "track", "history":
+		trackingID = fs.String("id", "", "tracking ID of the shipment")
+	default:
+		fmt.Fprint(out, clientUsage)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	var req, resp protoadapt.MessageV1
+	var method string
+	switch args[0] {
+	case "quote", "ship":
+		cartItems, err := parseCartItems(*items)
+		if err != nil {
+			fmt.Fprintf(out, "invalid -items: %v\n", err)
+			return 2
+		}
+		dimensions, err := parseDimensions(*dims)
+		if err != nil {
+			fmt.Fprintf(out, "invalid -dims: %v\n", err)
+			return 2
+		}
+		opts, err := parseShippingOptions(*level, *declared, *signature, *insured)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+		dest := &pb.Address{StreetAddress: *street, City: *city, State: *state, Country: *country, ZipCode: int32(*zip)}
+		if args[0] == "quote" {
+			quote := &pb.GetQuoteRequest{Address: dest, Items: cartItems, Options: opts, Dimensions: dimensions}
+			if *value != 0 {
+				v, err := money.FromFloat("USD", *value)
+				if err != nil {
+					fmt.Fprintf(out, "invalid -value: %v\n", err)
+					return 2
+				}
+				quote.OrderValue = &v
+			}
+			req, resp, method = quote, &pb.GetQuoteResponse{}, "GetQuote"
+		} else {
+			req, resp, method = &pb.ShipOrderRequest{Address: dest, Items: cartItems, QuoteId: *quoteID, Options: opts, Dimensions: dimensions}, &pb.ShipOrderResponse{}, "ShipOrder"
+		}
+	case "track", "history":
+		if *trackingID == "" {
+			fmt.Fprintln(out, "-id is required")
+			return 2
+		}
+		if args[0] == "track" {
+			req, resp, method = &pb.GetTrackingStatusRequest{TrackingId: *trackingID}, &pb.GetTrackingStatusResponse{}, "GetTrackingStatus"
+		} else {
+			req, resp, method = &pb.GetShipmentHistoryRequest{TrackingId: *trackingID}, &pb.GetShipmentHistoryResponse{}, "GetShipmentHistory"
+		}
+	}
+
+	tp, err := clientTracerProvider()
+	if err != nil {
+		fmt.Fprintf(out, "failed to set up tracing: %v\n", err)
+		return 1
+	}
+	defer tp.Shutdown(context.Background())
+	conn, err := grpc.NewClient(*addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithTracerProvider(tp),
+			otelgrpc.WithPropagators(newPropagator()),
+		)),
+	)
+	if err != nil {
+		fmt.Fprintf(out, "failed to create client: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if *bag != "" {
+		b, err := baggage.Parse(*bag)
+		if err != nil {
+			fmt.Fprintf(out, "invalid -baggage: %v\n", err)
+			return 2
+		}
+		ctx = baggage.ContextWithBaggage(ctx, b)
+	}
+	if *tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenantHeader, *tenant)
+	}
+	if *debug {
+		ctx = metadata.AppendToOutgoingContext(ctx, debugTraceHeader, "true")
+	}
+	var header metadata.MD
+	err = conn.Invoke(ctx, "/hipstershop.ShippingService/"+method, req, resp, grpc.Header(&header))
+	if err != nil {
+		st := status.Convert(err)
+		fmt.Fprintf(out, "error: %s: %s\n", st.Code(), st.Message())
+	} else {
+		b, _ := protojson.MarshalOptions{Multiline: true}.Marshal(protoadapt.MessageV2Of(resp))
+		fmt.Fprintln(out, string(b))
+	}
+	if id := header.Get(traceIDHeader); len(id) > 0 {
+		sampled := header.Get(traceSampledHeader)
+		fmt.Fprintf(out, "trace ID: %s (sampled: %s)\n", id[0], strings.Join(sampled, ""))
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// clientTracerProvider samples every client span, so the server follows the
+// decision, and exports the spans if an OTLP endpoint is configured.
+func clientTracerProvider() (*sdktrace.TracerProvider, error) {
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithSampler(sdktrace.AlwaysSample())}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		cfg, err := telemetry.OTLPConfigFromEnv("TRACES")
+		if err != nil {
+			return nil, err
+		}
+		exp, err := telemetry.SpanExporter(context.Background(), cfg)
+		if err != nil {
+			return nil, err
+		}
+		res, err := telemetry.Resource(context.Background(), serviceName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	}
+	return sdktrace.NewTracerProvider(opts...), nil
+}
+
+// parseCartItems parses "product:quantity" pairs separated by commas; the
+// quantity defaults to 1.
+func parseCartItems(s string) ([]*pb.CartItem, error) {
+	var items []*pb.CartItem
+	for _, v := range splitList(s) {
+		id, qty, ok := strings.Cut(v, ":")
+		n := 1
+		if ok {
+			var err error
+			if n, err = strconv.Atoi(qty); err != nil || n <= 0 {
+				return nil, fmt.Errorf("quantity of %s must be a positive number, got %q", id, qty)
+			}
+		}
+		items = append(items, &pb.CartItem{ProductId: strings.TrimSpace(id), Quantity: int32(n)})
+	}
+	return items, nil
+}
+
+// parseDimensions parses "product:LxWxH" sizes in cm separated by commas,
+// each optionally followed by ":grams".
+func parseDimensions(s string) ([]*pb.ItemDimensions, error) {
+	var dims []*pb.ItemDimensions
+	for _, v := range splitList(s) {
+		parts := strings.Split(v, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("%q is not product:LxWxH[:grams]", v)
+		}
+		d := &pb.ItemDimensions{ProductId: strings.TrimSpace(parts[0])}
+		sides := strings.Split(parts[1], "x")
+		if len(sides) != 3 {
+			return nil, fmt.Errorf("size of %s must be LxWxH, got %q", d.ProductId, parts[1])
+		}
+		for i, side := range []*float64{&d.LengthCm, &d.WidthCm, &d.HeightCm} {
+			var err error
+			if *side, err = strconv.ParseFloat(sides[i], 64); err != nil {
+				return nil, fmt.Errorf("size of %s must be LxWxH, got %q", d.ProductId, parts[1])
+			}
+		}
+		if len(parts) == 3 {
+			g, err := strconv.Atoi(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("weight of %s must be a number of grams, got %q", d.ProductId, parts[2])
+			}
+			d.WeightGrams = int32(g)
+		}
+		dims = append(dims, d)
+	}
+	return dims, nil
+}
+
+// parseShippingOptions builds the options of an order from a service level
+// name, empty for the default, and a declared value in USD, which is left
+// out if it is 0.
+func parseShippingOptions(level string, declared float64, signature, insured bool) (*pb.ShippingOptions, error) {
+	opts := &pb.ShippingOptions{SignatureRequired: signature, Insured: insured}
+	if level = strings.TrimSpace(level); level != "" {
+		l, ok := pb.ServiceLevel_value["SERVICE_LEVEL_"+strings.ToUpper(level)]
+		if !ok {
+			return nil, fmt.Errorf("unknown service level %q", level)
+		}
+		opts.ServiceLevel = pb.ServiceLevel(l)
+	}
+	if declared != 0 {
+		v, err := money.FromFloat("USD", declared)
+		if err != nil {
+			return nil, fmt.Errorf("invalid declared value: %v", err)
+		}
+		opts.DeclaredValue = &v
+	}
+	return opts, nil
+}
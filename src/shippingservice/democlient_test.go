@@ -0,0 +1,82 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"regexp"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestClientCommand checks that the client prints the response and the
+// trace ID of each call, with the trace continued from the client.
+func TestClientCommand(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parent trace.SpanContext
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithTracerProvider(sdktrace.NewTracerProvider()),
+			otelgrpc.WithPropagators(propagation.TraceContext{}),
+		)),
+		grpc.ChainUnaryInterceptor(
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				parent = trace.SpanContextFromContext(ctx)
+				return handler(ctx, req)
+			},
+			traceIDInterceptor(),
+		),
+	)
+	pb.RegisterShippingServiceServer(srv, newServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	addr := lis.Addr().String()
+
+	var out bytes.Buffer
+	if code := clientCommand([]string{"ship", "-addr", addr, "-items", "OLJCESPC7Z:2,66VCHSJNUP"}, &out); code != 0 {
+		t.Fatalf("TestClientCommand: ship exited with %d: %s", code, &out)
+	}
+	m := regexp.MustCompile(`"trackingId":\s*"([^"]+)"[\s\S]*trace ID: ([0-9a-f]{32}) \(sampled: true\)`).FindStringSubmatch(out.String())
+	if m == nil {
+		t.Fatalf("TestClientCommand: ship printed %s", &out)
+	}
+	if m[2] != parent.TraceID().String() {
+		t.Errorf("TestClientCommand: printed trace %s, server saw %s", m[2], parent.TraceID())
+	}
+
+	out.Reset()
+	if code := clientCommand([]string{"track", "-addr", addr, "-id", m[1]}, &out); code != 0 || !bytes.Contains(out.Bytes(), []byte("SHIPMENT_STATUS_CREATED")) {
+		t.Errorf("TestClientCommand: track exited with %d: %s", code, &out)
+	}
+	out.Reset()
+	if code := clientCommand([]string{"track", "-addr", addr, "-id", "OB-0000000000000"}, &out); code != 1 || !bytes.Contains(out.Bytes(), []byte("error: InvalidArgument")) {
+		t.Errorf("TestClientCommand: malformed ID exited with %d: %s", code, &out)
+	}
+	if code := clientCommand([]string{"unknown"}, &out); code != 2 {
+		t.Errorf("TestClientCommand: unknown command exited with %d", code)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultDeterministicSeed = 1
+
+// Deterministic mode makes the output of the service reproducible, for
+// workshop verification scripts and the golden trace tests: randomness,
+// trace IDs included, is seeded, backoff delays have no jitter, and
+// tracking, quote and event IDs are derived from the request instead of the
+// clock or a random source. The same sequence of requests then gets the same
+// responses and span attributes. Do not use it in production, where derived
+// IDs could collide across replicas.
+var (
+	deterministic bool
+	random        randSource = newPooledRand(time.Now().UnixNano())
+	derived                  = newDerivedIDs()
+)
+
+// deterministicFromEnv turns deterministic mode on if DETERMINISTIC is set,
+// seeded with DETERMINISTIC_SEED.
+func deterministicFromEnv() {
+	if envBool("DETERMINISTIC", false) {
+		setDeterministic(true, int64(envInt("DETERMINISTIC_SEED", defaultDeterministicSeed)))
+		log.Warn("deterministic mode is on: IDs are derived from requests and may repeat across replicas")
+	}
+}
+
+// setDeterministic turns deterministic mode on or off and restarts the
+// random sequence and the derived IDs, so each run starts from the same
+// state.
+func setDeterministic(on bool, seed int64) {
+	deterministic = on
+	if on {
+		random = newLockedRand(seed)
+	} else {
+		random = newPooledRand(time.Now().UnixNano())
+	}
+	derived = newDerivedIDs()
+}
+
+// randSource is the source of the random numbers used for latency, fault
+// injection, sampling and seeded IDs. It is safe for concurrent use.
+type randSource interface {
+	Float64() float64
+	Int63() int64
+	Int63n(n int64) int64
+}
+
+// pooledRand hands each call a rand.Rand from a pool, so that concurrent
+// requests draw from separate sources instead of contending on one lock, as
+// they would on the global math/rand source. Its sequence depends on which
+// goroutine gets which source, so deterministic mode uses a lockedRand.
+type pooledRand struct {
+	pool sync.Pool
+}
+
+func newPooledRand(seed int64) *pooledRand {
+	p := &pooledRand{}
+	var sources atomic.Int64
+	p.pool.New = func() any {
+		// Sources are seeded a golden ratio apart, so that no two share a
+		// sequence.
+		n := sources.Add(1)
+		return rand.New(rand.NewSource(seed + n*-0x61c8864680b583eb))
+	}
+	return p
+}
+
+func (p *pooledRand) Float64() float64 {
+	r := p.pool.Get().(*rand.Rand)
+	defer p.pool.Put(r)
+	return r.Float64()
+}
+
+func (p *pooledRand) Int63() int64 {
+	r := p.pool.Get().(*rand.Rand)
+	defer p.pool.Put(r)
+	return r.Int63()
+}
+
+func (p *pooledRand) Int63n(n int64) int64 {
+	r := p.pool.Get().(*rand.Rand)
+	defer p.pool.Put(r)
+	return r.Int63n(n)
+}
+
+// lockedRand is a rand.Rand safe for concurrent use, whose sequence only
+// depends on the order of the calls.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+func (l *lockedRand) Int63() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63()
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63n(n)
+}
+
+// jitter returns a random delay in (0, d], or d itself in deterministic
+// mode, where the order of concurrent calls would make a seeded delay vary.
+func jitter(d time.Duration) time.Duration {
+	if deterministic {
+		return d
+	}
+	return time.Duration(random.Int63n(int64(d)) + 1)
+}
+
+// seededIDGenerator makes trace and span IDs from the seeded random source,
+// so that ratio sampling, which depends on the trace ID, is reproducible too.
+type seededIDGenerator struct{}
+
+func (seededIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	var tid trace.TraceID
+	for !tid.IsValid() {
+		binary.BigEndian.PutUint64(tid[:8], uint64(random.Int63()))
+		binary.BigEndian.PutUint64(tid[8:], uint64(random.Int63()))
+	}
+	return tid, seededIDGenerator{}.NewSpanID(ctx, tid)
+}
+
+func (seededIDGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	var sid trace.SpanID
+	for !sid.IsValid() {
+		binary.BigEndian.PutUint64(sid[:], uint64(random.Int63()))
+	}
+	return sid
+}
+
+// derivedIDs derives IDs from the input they identify. Repeated inputs are
+// numbered, so that, say, two identical orders still get distinct tracking
+// IDs, in the order they were placed. Only the maxDerivedInputs most recently
+// used inputs are remembered. An input seen again after it was forgotten is
+// numbered afresh within a new epoch, the number of inputs forgotten before
+// it, which no earlier numbering of the input shares.
+type derivedIDs struct {
+	mu      sync.Mutex
+	size    int
+	epoch   int
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+// derivedInput is the numbering of an input within an epoch.
+type derivedInput struct {
+	input string
+	epoch int
+	seen  int
+}
+
+const maxDerivedInputs = 10000
+
+func newDerivedIDs() *derivedIDs {
+	return &derivedIDs{size: maxDerivedInputs, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// sum returns the hash of input, its epoch and the number of earlier calls
+// with it in that epoch.
+func (d *derivedIDs) sum(input string) [sha256.Size]byte {
+	d.mu.Lock()
+	el, ok := d.entries[input]
+	if ok {
+		d.order.MoveToFront(el)
+	} else {
+		el = d.order.PushFront(&derivedInput{input: input, epoch: d.epoch})
+		d.entries[input] = el
+		for d.order.Len() > d.size {
+			oldest := d.order.Back()
+			d.order.Remove(oldest)
+			delete(d.entries, oldest.Value.(*derivedInput).input)
+			d.epoch++
+		}
+	}
+	e := el.Value.(*derivedInput)
+	epoch, n := e.epoch, e.seen
+	e.seen++
+	d.mu.Unlock()
+	if epoch == 0 {
+		// The first epoch keeps the IDs derived before inputs could be
+		// forgotten, which the golden traces record.
+		return sha256.Sum256([]byte(strconv.Itoa(n) + "\x00" + input))
+	}
+	return sha256.Sum256([]byte(strconv.Itoa(epoch) + "." + strconv.Itoa(n) + "\x00" + input))
+}
+
+// newID returns a random UUID, or in deterministic mode one derived from
+// input.
+func newID(input string) string {
+	if !deterministic {
+		return uuid.NewString()
+	}
+	sum := derived.sum(input)
+	id, _ := uuid.FromBytes(sum[:16])
+	id[6] = id[6]&0x0f | 0x50 // version 5, name based
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return id.String()
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDeterministicMode checks that IDs and random values repeat from run to
+// run, while repeated inputs within a run still get distinct IDs.
+func TestDeterministicMode(t *testing.T) {
+	defer setDeterministic(false, 0)
+	run := func() []string {
+		setDeterministic(true, defaultDeterministicSeed)
+		tid, sid := seededIDGenerator{}.NewIDs(context.Background())
+		return []string{
+			CreateTrackingId("1600 Amphitheatre Parkway"),
+			CreateTrackingId("1600 Amphitheatre Parkway"),
+			newID("quote"),
+			tid.String() + "/" + sid.String(),
+		}
+	}
+	first, second := run(), run()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("TestDeterministicMode: value %d is %q, then %q", i, first[i], second[i])
+		}
+	}
+	if first[0] == first[1] {
+		t.Errorf("TestDeterministicMode: repeated orders got the same tracking ID %q", first[0])
+	}
+	if _, err := ParseTrackingId(first[0]); err != nil {
+		t.Errorf("TestDeterministicMode: %v", err)
+	}
+	if d := jitter(time.Second); d != time.Second {
+		t.Errorf("TestDeterministicMode: jitter(1s) = %s, want 1s", d)
+	}
+
+	setDeterministic(false, 0)
+	if a, b := newID("quote"), newID("quote"); a == b {
+		t.Errorf("TestDeterministicMode: random IDs repeat outside deterministic mode: %q", a)
+	}
+}
+
+// TestDerivedIDsBounded checks that only the most recent inputs are
+// remembered, and that an input seen again once forgotten gets new IDs.
+func TestDerivedIDsBounded(t *testing.T) {
+	d := newDerivedIDs()
+	d.size = 2
+	seen := make(map[[sha256.Size]byte]string)
+	for i, input := range []string{"a", "a", "b", "c", "a", "b", "a", "c", "c"} {
+		sum := d.sum(input)
+		if prev, ok := seen[sum]; ok {
+			t.Errorf("TestDerivedIDsBounded: call %d with %q repeated the ID of %q", i, input, prev)
+		}
+		seen[sum] = input
+	}
+	if len(d.entries) != 2 || d.order.Len() != 2 {
+		t.Errorf("TestDerivedIDsBounded: %d inputs remembered, want 2", len(d.entries))
+	}
+}
+
+// TestPooledRand checks that the pooled source stays in range and that its
+// sources do not repeat each other.
+func TestPooledRand(t *testing.T) {
+	p := newPooledRand(1)
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if n := p.Int63n(10); n < 0 || n >= 10 {
+					t.Errorf("TestPooledRand: Int63n(10) = %d", n)
+				}
+				if f := p.Float64(); f < 0 || f >= 1 {
+					t.Errorf("TestPooledRand: Float64() = %v", f)
+				}
+				n := p.Int63()
+				mu.Lock()
+				if seen[n] {
+					t.Errorf("TestPooledRand: %d drawn twice", n)
+				}
+				seen[n] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkRandom compares the pooled source with a single locked one when
+// every goroutine draws from it, as concurrent requests do.
+func BenchmarkRandom(b *testing.B) {
+	for name, r := range map[string]randSource{
+		"locked": newLockedRand(1),
+		"pooled": newPooledRand(1),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					r.Float64()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultEmailFrom = "shipping@example.com"
+	smtpTimeout      = 10 * time.Second
+)
+
+// emailSender sends notifications by email through an SMTP relay, or only
+// logs them when no relay is configured.
+type emailSender struct {
+	addr string
+	from string
+	to   string
+	auth smtp.Auth
+}
+
+// emailSenderFromEnv returns a sender mailing NOTIFY_EMAIL_TO, or nil if it is
+// not set. Mail goes through SMTP_ADDR, or is logged if that is not set.
+func emailSenderFromEnv() *emailSender {
+	to := os.Getenv("NOTIFY_EMAIL_TO")
+	if to == "" {
+		return nil
+	}
+	e := &emailSender{addr: os.Getenv("SMTP_ADDR"), from: os.Getenv("NOTIFY_EMAIL_FROM"), to: to}
+	if e.from == "" {
+		e.from = defaultEmailFrom
+	}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		host, _, _ := net.SplitHostPort(e.addr)
+		e.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	if e.addr == "" {
+		log.Infof("logging email notifications to %s", to)
+	} else {
+		log.Infof("emailing notifications to %s through %s", to, e.addr)
+	}
+	return e
+}
+
+func (e *emailSender) channel() string { return "email" }
+
+func (e *emailSender) send(ctx context.Context, n notification) error {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("email.to", e.to))
+	if e.addr == "" {
+		log.Ctx(ctx).Infof("email to %s: %s", e.to, n.subject)
+		return nil
+	}
+	host, port, err := net.SplitHostPort(e.addr)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("server.address", host), attribute.String("server.port", port))
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(nil); err != nil {
+			return err
+		}
+	}
+	if e.auth != nil {
+		if err := c.Auth(e.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(e.to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message formats a notification as a plain text RFC 5322 message.
+func (e *emailSender) message(n notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", e.to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", n.subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(n.body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+const defaultErrorMix = "INVALID_ARGUMENT=2,UNAVAILABLE=4,DEADLINE_EXCEEDED=2,INTERNAL=1"
+
+// simulatedError is a kind of failure the error generator produces. Each
+// looks like the real failure it stands for: the same reason and details,
+// and a message picked from several plausible ones.
+type simulatedError struct {
+	reason   string
+	messages []string
+	details  func() []protoadapt.MessageV1
+}
+
+var simulatedErrors = map[codes.Code]simulatedError{
+	codes.InvalidArgument: {reason: reasonInvalidAddress, messages: []string{
+		"zip code does not match the state",
+		"street address is not deliverable",
+		"country is not served by any carrier",
+	}, details: func() []protoadapt.MessageV1 {
+		return []protoadapt.MessageV1{badRequest(&errdetails.BadRequest_FieldViolation{Field: "address", Description: "rejected by carrier validation"})}
+	}},
+	codes.Unavailable: {reason: reasonBackendUnavailable, messages: []string{
+		"failed to look up quote: connection refused",
+		"failed to write audit log: broken pipe",
+		"carrier API returned 503 Service Unavailable",
+	}, details: func() []protoadapt.MessageV1 {
+		return []protoadapt.MessageV1{retryAfter(backendRetryDelay)}
+	}},
+	codes.DeadlineExceeded: {reason: reasonServerTimeout, messages: []string{
+		"carrier API did not respond within 2s",
+		"rate lookup did not complete within the server timeout",
+	}},
+	codes.Internal: {reason: reasonInternal, messages: []string{
+		"label renderer failed: nil pointer dereference",
+		"inconsistent shipment state: CREATED after IN_TRANSIT",
+	}},
+}
+
+// errorMix fails a fraction of calls with a weighted mix of error codes, so
+// that error dashboards have varied material rather than a single failure.
+type errorMix struct {
+	rate    float64
+	codes   []codes.Code
+	weights []float64 // cumulative
+}
+
+// parseErrorMix parses a comma-separated list of CODE=weight pairs, e.g.
+// "UNAVAILABLE=4,INTERNAL=1". Codes are those of simulatedErrors.
+func parseErrorMix(rate float64, s string) (*errorMix, error) {
+	m := &errorMix{rate: rate}
+	var total float64
+	for _, kv := range splitList(s) {
+		name, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not of the form CODE=weight", kv)
+		}
+		code, ok := parseCode(strings.TrimSpace(name))
+		if _, known := simulatedErrors[code]; !ok || !known {
+			return nil, fmt.Errorf("cannot simulate %s errors", strings.TrimSpace(name))
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("weight of %s must be a non-negative number, got %q", code, v)
+		}
+		total += w
+		m.codes = append(m.codes, code)
+		m.weights = append(m.weights, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("the mix has no error with a positive weight")
+	}
+	return m, nil
+}
+
+// errorMixFromEnv returns the generator configured by CHAOS_ERROR_RATE and
+// CHAOS_ERROR_MIX, or nil if the rate is 0.
+func errorMixFromEnv() *errorMix {
+	rate := envFloat("CHAOS_ERROR_RATE", 0)
+	if rate <= 0 {
+		return nil
+	}
+	mix := os.Getenv("CHAOS_ERROR_MIX")
+	if mix == "" {
+		mix = defaultErrorMix
+	}
+	m, err := parseErrorMix(rate, mix)
+	if err != nil {
+		log.Fatalf("invalid CHAOS_ERROR_MIX: %v", err)
+	}
+	return m
+}
+
+// pick returns the code of the error to fail a call with, if it is to fail.
+func (m *errorMix) pick() (codes.Code, bool) {
+	if m == nil || random.Float64() >= m.rate {
+		return codes.OK, false
+	}
+	r := random.Float64() * m.weights[len(m.weights)-1]
+	i := sort.Search(len(m.weights)-1, func(i int) bool { return m.weights[i] > r })
+	return m.codes[i], true
+}
+
+// fail returns a simulated error with the given code for method. The
+// ErrorInfo metadata marks it as simulated; the server span gets an
+// error.simulated event and the error.type attribute.
+func (m *errorMix) fail(ctx context.Context, method string, code codes.Code) error {
+	e := simulatedErrors[code]
+	msg := e.messages[int(random.Int63n(int64(len(e.messages))))]
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("error.type", code.String()))
+	span.AddEvent("error.simulated", trace.WithAttributes(attribute.String("rpc.grpc.status", code.String())))
+	var details []protoadapt.MessageV1
+	if e.details != nil {
+		details = e.details()
+	}
+	return rpcError(ctx, code, e.reason, map[string]string{"method": method, "simulated": "true"}, msg, details...)
+}
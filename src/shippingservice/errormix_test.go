@@ -0,0 +1,71 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestErrorMix checks that simulated errors follow the configured rate and
+// weights, and carry the reason and details of the failure they imitate.
+func TestErrorMix(t *testing.T) {
+	saved := random
+	random = newLockedRand(1)
+	defer func() { random = saved }()
+
+	for _, bad := range []string{"UNAVAILABLE", "NOT_FOUND=1", "INTERNAL=-1", "INTERNAL=0"} {
+		if _, err := parseErrorMix(0.5, bad); err == nil {
+			t.Errorf("TestErrorMix: %q was accepted", bad)
+		}
+	}
+	mix, err := parseErrorMix(0.5, "unavailable=3, INTERNAL=1, INVALID_ARGUMENT=0")
+	if err != nil {
+		t.Fatalf("TestErrorMix: %v", err)
+	}
+
+	f := newFaultInjector(true)
+	f.errors = mix
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "done", nil }
+	const calls = 4000
+	got := make(map[codes.Code]int)
+	for i := 0; i < calls; i++ {
+		_, err := f.unary()(context.Background(), nil, info, handler)
+		got[status.Code(err)]++
+		if err == nil {
+			continue
+		}
+		errInfo, retry := errorDetails(err)
+		if errInfo == nil || errInfo.Metadata["simulated"] != "true" || errInfo.Reason != simulatedErrors[status.Code(err)].reason {
+			t.Fatalf("TestErrorMix: %v has ErrorInfo %v", err, errInfo)
+		}
+		if (status.Code(err) == codes.Unavailable) != (retry != nil) {
+			t.Errorf("TestErrorMix: %v has RetryInfo %v", err, retry)
+		}
+	}
+	for code, want := range map[codes.Code]int{codes.OK: calls / 2, codes.Unavailable: calls * 3 / 8, codes.Internal: calls / 8} {
+		if got[code] < want*9/10 || got[code] > want*11/10 {
+			t.Errorf("TestErrorMix: %d calls returned %s, want about %d", got[code], code, want)
+		}
+	}
+	if got[codes.InvalidArgument] > 0 {
+		t.Errorf("TestErrorMix: %d calls returned INVALID_ARGUMENT, which has no weight", got[codes.InvalidArgument])
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain identifies this service in the ErrorInfo of every error it
+// returns.
+const errorDomain = "shippingservice.hipstershop"
+
+// Reasons are stable, machine-readable causes sent in ErrorInfo. Clients
+// should branch on the reason rather than parse messages.
+const (
+	reasonInvalidAddress      = "INVALID_ADDRESS"
+	reasonInvalidArgument     = "INVALID_ARGUMENT"
+	reasonBatchTooLarge       = "BATCH_TOO_LARGE"
+	reasonMalformedTrackingID = "MALFORMED_TRACKING_ID"
+	reasonShipmentNotFound    = "SHIPMENT_NOT_FOUND"
+	reasonInvalidTransition   = "INVALID_SHIPMENT_TRANSITION"
+	reasonQuoteExpired        = "QUOTE_EXPIRED"
+	reasonQuoteMismatch       = "QUOTE_MISMATCH"
+	reasonBackendUnavailable  = "BACKEND_UNAVAILABLE"
+	reasonServerTimeout       = "SERVER_TIMEOUT"
+	reasonInjectedFault       = "INJECTED_FAULT"
+	reasonRateLimited         = "RATE_LIMITED"
+	reasonQuotaExceeded       = "QUOTA_EXCEEDED"
+	reasonOverloaded          = "OVERLOADED"
+	reasonInternal            = "INTERNAL"
+)
+
+// backendRetryDelay is the RetryInfo delay suggested when a backing store is
+// unavailable.
+const backendRetryDelay = time.Second
+
+// rpcError returns a status error with the given code and message. It always
+// carries an ErrorInfo with the reason and metadata, followed by any extra
+// details such as a BadRequest or RetryInfo. The error is also recorded on
+// the current span, so the trace and the response agree.
+func rpcError(ctx context.Context, code codes.Code, reason string, metadata map[string]string, msg string, details ...protoadapt.MessageV1) error {
+	st := status.New(code, msg)
+	info := &errdetails.ErrorInfo{Reason: reason, Domain: errorDomain, Metadata: metadata}
+	if detailed, err := st.WithDetails(append([]protoadapt.MessageV1{info}, details...)...); err == nil {
+		st = detailed
+	}
+	err := st.Err()
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(otelcodes.Error, msg)
+	return err
+}
+
+// badRequest lists the fields that made a request invalid.
+func badRequest(violations ...*errdetails.BadRequest_FieldViolation) *errdetails.BadRequest {
+	return &errdetails.BadRequest{FieldViolations: violations}
+}
+
+// retryAfter tells the client it may retry the call after d.
+func retryAfter(d time.Duration) *errdetails.RetryInfo {
+	return &errdetails.RetryInfo{RetryDelay: durationpb.New(d)}
+}
+
+// backendUnavailable reports a failure of a backing store, such as Redis, that
+// is likely to be transient.
+func backendUnavailable(ctx context.Context, what string, err error) error {
+	return rpcError(ctx, codes.Unavailable, reasonBackendUnavailable, nil,
+		fmt.Sprintf("failed to %s: %v", what, err), retryAfter(backendRetryDelay))
+}
+
+// shipmentNotFound reports an unknown tracking ID.
+func shipmentNotFound(ctx context.Context, trackingID string) error {
+	return rpcError(ctx, codes.NotFound, reasonShipmentNotFound, map[string]string{"tracking_id": trackingID},
+		fmt.Sprintf("no shipment with tracking ID %q", trackingID))
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/shippingclient"
+)
+
+// errorDetails returns the ErrorInfo and RetryInfo carried by err, if any.
+func errorDetails(err error) (*errdetails.ErrorInfo, *errdetails.RetryInfo) {
+	var info *errdetails.ErrorInfo
+	var retry *errdetails.RetryInfo
+	for _, d := range status.Convert(err).Details() {
+		switch v := d.(type) {
+		case *errdetails.ErrorInfo:
+			info = v
+		case *errdetails.RetryInfo:
+			retry = v
+		}
+	}
+	return info, retry
+}
+
+type failingQuoteStore struct{}
+
+func (failingQuoteStore) issue(context.Context, issuedQuote) error {
+	return errors.New("connection refused")
+}
+func (failingQuoteStore) lookup(context.Context, string) (issuedQuote, bool, error) {
+	return issuedQuote{}, false, errors.New("connection refused")
+}
+func (failingQuoteStore) deleteExpired(context.Context, time.Time) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+// TestErrorDetails checks that handlers return an ErrorInfo reason, and RetryInfo for transient failures.
+func TestErrorDetails(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+
+	_, err := s.CancelShipment(ctx, &pb.CancelShipmentRequest{TrackingId: "does-not-exist"})
+	info, _ := errorDetails(err)
+	if info == nil || info.Reason != reasonShipmentNotFound || info.Domain != errorDomain || info.Metadata["tracking_id"] != "does-not-exist" {
+		t.Errorf("TestErrorDetails: CancelShipment returned ErrorInfo %v", info)
+	}
+
+	s.issued = failingQuoteStore{}
+	_, err = s.GetQuote(ctx, &pb.GetQuoteRequest{Address: &pb.Address{ZipCode: 94043}})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("TestErrorDetails: GetQuote returned %v, expected %s", err, codes.Unavailable)
+	}
+	info, retry := errorDetails(err)
+	if info == nil || info.Reason != reasonBackendUnavailable {
+		t.Errorf("TestErrorDetails: GetQuote returned ErrorInfo %v", info)
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() != backendRetryDelay {
+		t.Errorf("TestErrorDetails: GetQuote returned RetryInfo %v", retry)
+	}
+}
+
+// TestShippingClientReasons checks that the errors of the shipping client
+// have the reasons the service returns.
+func TestShippingClientReasons(t *testing.T) {
+	for reason, want := range map[string]*shippingclient.Error{
+		reasonInvalidAddress:      shippingclient.ErrInvalidAddress,
+		reasonInvalidArgument:     shippingclient.ErrInvalidArgument,
+		reasonBatchTooLarge:       shippingclient.ErrBatchTooLarge,
+		reasonMalformedTrackingID: shippingclient.ErrMalformedTrackingID,
+		reasonShipmentNotFound:    shippingclient.ErrShipmentNotFound,
+		reasonInvalidTransition:   shippingclient.ErrInvalidTransition,
+		reasonQuoteExpired:        shippingclient.ErrQuoteExpired,
+		reasonQuoteMismatch:       shippingclient.ErrQuoteMismatch,
+		reasonBackendUnavailable:  shippingclient.ErrBackendUnavailable,
+		reasonServerTimeout:       shippingclient.ErrServerTimeout,
+		reasonInjectedFault:       shippingclient.ErrInjectedFault,
+		reasonRateLimited:         shippingclient.ErrRateLimited,
+		reasonQuotaExceeded:       shippingclient.ErrQuotaExceeded,
+		reasonOverloaded:          shippingclient.ErrOverloaded,
+		reasonInternal:            shippingclient.ErrInternal,
+	} {
+		if want.Reason != reason {
+			t.Errorf("TestShippingClientReasons: client reason %q, service reason %q", want.Reason, reason)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	eventShipmentCreated       = "ShipmentCreated"
+	eventShipmentStatusChanged = "ShipmentStatusChanged"
+)
+
+// shipmentEvent describes a change to a shipment. It is the payload sent to
+// every event sink, so its JSON form is part of the service's contract.
+type shipmentEvent struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	Tenant         string    `json:"tenant,omitempty"`
+	TrackingID     string    `json:"tracking_id"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// newShipmentEvent describes a change to a shipment of tenant. The default
+// tenant is left out, so single-tenant payloads are unchanged.
+func newShipmentEvent(typ, tenant, trackingID string, from, to pb.ShipmentStatus) shipmentEvent {
+	if tenant == defaultTenant {
+		tenant = ""
+	}
+	ev := shipmentEvent{
+		ID:         newID(typ + ":" + trackingID),
+		Type:       typ,
+		Tenant:     tenant,
+		TrackingID: trackingID,
+		Status:     to.String(),
+		Time:       time.Now().UTC(),
+	}
+	if from != pb.ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED {
+		ev.PreviousStatus = from.String()
+	}
+	return ev
+}
+
+// eventPublisher delivers shipment events to a sink. Publish is called on the
+// request path, so implementations that talk to the network should hand the
+// event off rather than block.
+type eventPublisher interface {
+	Publish(ctx context.Context, ev shipmentEvent) error
+}
+
+// multiPublisher fans an event out to several publishers.
+type multiPublisher []eventPublisher
+
+func (m multiPublisher) Publish(ctx context.Context, ev shipmentEvent) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, ev); err != nil {
+			log.Ctx(ctx).WithError(err).Warnf("failed to publish %s event for %s", ev.Type, ev.TrackingID)
+		}
+	}
+	return nil
+}
+
+// detachedContext returns a context that carries the trace and baggage of ctx
+// but not its deadline or cancellation, for work that outlives the request.
+func detachedContext(ctx context.Context) context.Context {
+	return carryContext(context.Background(), ctx)
+}
+
+// eventBusFromEnv selects the message bus named by EVENT_BUS. For backwards
+// compatibility Kafka is used when EVENT_BUS is unset but KAFKA_BROKERS is
+// set. It returns nil when no bus is configured.
+func eventBusFromEnv() eventPublisher {
+	switch bus := strings.ToLower(os.Getenv("EVENT_BUS")); bus {
+	case "":
+		if k := kafkaPublisherFromEnv(); k != nil {
+			return k
+		}
+	case "kafka":
+		k := kafkaPublisherFromEnv()
+		if k == nil {
+			log.Fatal("EVENT_BUS=kafka requires KAFKA_BROKERS to be set")
+		}
+		return k
+	case "nats":
+		return natsPublisherFromEnv()
+	case "pubsub":
+		return pubsubPublisherFromEnv()
+	case "sqs":
+		return sqsPublisherFromEnv()
+	case "sns":
+		return snsPublisherFromEnv()
+	case "none":
+	default:
+		log.Fatalf("unknown EVENT_BUS %q", bus)
+	}
+	return nil
+}
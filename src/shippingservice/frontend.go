@@ -0,0 +1,309 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/internal/telemetry"
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/shippingclient"
+)
+
+const (
+	frontendServiceName = "shipping-frontend"
+	maxFrontendBody     = 1 << 20
+)
+
+// frontendCommand serves a small web page in front of the service, so that
+// the workshop has a two-hop trace without the rest of the demo: an order
+// posted as a form or as JSON is quoted with GetQuote, shipped at that price
+// with ShipOrder, and shown with the ID of its trace.
+//
+//	shippingservice frontend [-listen :8080] [-addr localhost:50051]
+func frontendCommand(args []string, out io.Writer) int {
+	addr := os.Getenv("SHIPPING_SERVICE_ADDR")
+	if addr == "" {
+		addr = "localhost:" + defaultPort
+	}
+	fs := flag.NewFlagSet("frontend", flag.ContinueOnError)
+	fs.SetOutput(out)
+	listen := fs.String("listen", ":8080", "address to serve the page on")
+	fs.StringVar(&addr, "addr", addr, "address of the shipping service")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	shutdown, err := telemetry.Setup(context.Background(), frontendServiceName, telemetry.WithPropagator(newPropagator()))
+	if err != nil {
+		fmt.Fprintf(out, "failed to set up telemetry: %v\n", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryFlushTimeout)
+		defer cancel()
+		shutdown(ctx)
+	}()
+	client, err := shippingclient.NewClient(addr)
+	if err != nil {
+		fmt.Fprintf(out, "failed to create client: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           newDemoFrontend(client, otel.GetTracerProvider()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+	log.Infof("frontend listening on %s, calling the shipping service at %s", *listen, addr)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-served:
+		fmt.Fprintf(out, "frontend stopped: %v\n", err)
+		return 1
+	case <-signals:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	return 0
+}
+
+// demoFrontend is the page served by the frontend command.
+type demoFrontend struct {
+	client *shippingclient.Client
+}
+
+// newDemoFrontend serves the order form on / and takes orders on /ship, with
+// every request traced by tp.
+func newDemoFrontend(client *shippingclient.Client, tp trace.TracerProvider) http.Handler {
+	f := &demoFrontend{client: client}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", f.form)
+	mux.HandleFunc("/ship", f.ship)
+	return otelhttp.NewHandler(mux, "frontend",
+		otelhttp.WithTracerProvider(tp),
+		otelhttp.WithPropagators(newPropagator()),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method + " " + r.URL.Path }),
+	)
+}
+
+// frontendLine is one charge of a quote.
+type frontendLine struct {
+	Description string `json:"description"`
+	Amount      string `json:"amount_usd"`
+}
+
+// frontendResult is what an order came to, shown on the page or returned as
+// JSON.
+type frontendResult struct {
+	QuoteID     string `json:"quote_id,omitempty"`
+	PromotionID string `json:"promotion_id,omitempty"`
+	Cost        string `json:"cost_usd,omitempty"`
+	// LineItems are the charges the cost is made up of.
+	LineItems  []frontendLine `json:"line_items,omitempty"`
+	TrackingID string         `json:"tracking_id,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	TraceID    string         `json:"trace_id"`
+}
+
+func (f *demoFrontend) form(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	renderFrontend(w, http.StatusOK, nil)
+}
+
+// ship quotes and ships an order. The order is a form with the fields of an
+// address and items as product:quantity pairs, or a GetQuoteRequest as JSON,
+// in which case the result is JSON too.
+func (f *demoFrontend) ship(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	res := frontendResult{TraceID: span.SpanContext().TraceID().String()}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	asJSON := mediaType == "application/json"
+	reply := func(code int) {
+		if !asJSON {
+			renderFrontend(w, code, &res)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(res)
+	}
+
+	order, err := parseFrontendOrder(r, asJSON)
+	if err != nil {
+		res.Error = err.Error()
+		reply(http.StatusBadRequest)
+		return
+	}
+	quote, err := f.client.GetQuote(ctx, order)
+	if err == nil {
+		res.QuoteID, res.PromotionID, res.Cost = quote.QuoteId, quote.PromotionId, money.Format(*quote.CostUsd)
+		for _, l := range quote.LineItems {
+			res.LineItems = append(res.LineItems, frontendLine{Description: l.Description, Amount: money.Format(*l.AmountUsd)})
+		}
+		span.SetAttributes(attribute.String("quote.id", quote.QuoteId))
+		var shipped *pb.ShipOrderResponse
+		shipped, err = f.client.ShipOrder(ctx, &pb.ShipOrderRequest{Address: order.Address, Items: order.Items, QuoteId: quote.QuoteId, Options: order.Options, Dimensions: order.Dimensions})
+		if err == nil {
+			res.TrackingID = shipped.TrackingId
+			span.SetAttributes(attribute.String("shipment.tracking_id", shipped.TrackingId))
+		}
+	}
+	if err != nil {
+		res.Error = err.Error()
+		code := http.StatusBadGateway
+		if status.Code(err) == codes.InvalidArgument {
+			code = http.StatusBadRequest
+		}
+		reply(code)
+		return
+	}
+	reply(http.StatusOK)
+}
+
+// parseFrontendOrder reads the order posted to /ship.
+func parseFrontendOrder(r *http.Request, asJSON bool) (*pb.GetQuoteRequest, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxFrontendBody)
+	if asJSON {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		var order pb.GetQuoteRequest
+		if err := protojson.Unmarshal(b, protoadapt.MessageV2Of(&order)); err != nil {
+			return nil, fmt.Errorf("invalid order: %v", err)
+		}
+		return &order, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	items, err := parseCartItems(r.PostForm.Get("items"))
+	if err != nil {
+		return nil, err
+	}
+	zip, err := strconv.Atoi(r.PostForm.Get("zip"))
+	if err != nil {
+		return nil, errors.New("the zip code must be a number")
+	}
+	declared := 0.0
+	if v := r.PostForm.Get("declared"); v != "" {
+		if declared, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, errors.New("the declared value must be a number")
+		}
+	}
+	var value *pb.Money
+	if v := r.PostForm.Get("value"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, errors.New("the order value must be a number")
+		}
+		m, err := money.FromFloat("USD", f)
+		if err != nil {
+			return nil, err
+		}
+		value = &m
+	}
+	opts, err := parseShippingOptions(r.PostForm.Get("level"), declared, r.PostForm.Get("signature") != "", r.PostForm.Get("insured") != "")
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetQuoteRequest{
+		Address: &pb.Address{
+			StreetAddress: r.PostForm.Get("street"),
+			City:          r.PostForm.Get("city"),
+			State:         r.PostForm.Get("state"),
+			Country:       r.PostForm.Get("country"),
+			ZipCode:       int32(zip),
+		},
+		Items:      items,
+		Options:    opts,
+		OrderValue: value,
+	}, nil
+}
+
+func renderFrontend(w http.ResponseWriter, code int, res *frontendResult) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := frontendTemplate.Execute(w, res); err != nil {
+		log.WithError(err).Warn("failed to render the frontend page")
+	}
+}
+
+var frontendTemplate = template.Must(template.New("frontend").Parse(`<!DOCTYPE html>
+<html><head><title>Shipping</title></head>
+<body>
+<h1>Ship an order</h1>
+{{with .}}
+{{if .Error}}<p><b>Failed:</b> {{.Error}}</p>{{else}}
+<p>Shipped for {{.Cost}} (quote {{.QuoteID}}), tracking ID <b>{{.TrackingID}}</b>.</p>
+<table>{{range .LineItems}}<tr><td>{{.Description}}</td><td align="right">{{.Amount}}</td></tr>{{end}}
+<tr><th align="left">Total</th><th align="right">{{.Cost}}</th></tr></table>
+{{with .PromotionID}}<p>Promotion {{.}} applied.</p>{{end}}{{end}}
+<p>Trace ID: <code>{{.TraceID}}</code></p>
+{{end}}
+<form method="post" action="/ship">
+<p><label>Street <input name="street" value="1600 Amphitheatre Parkway"></label></p>
+<p><label>City <input name="city" value="Mountain View"></label>
+<label>State <input name="state" value="CA" size="3"></label>
+<label>Zip <input name="zip" value="94043" size="6"></label>
+<label>Country <input name="country" value="USA" size="4"></label></p>
+<p><label>Items <input name="items" value="OLJCESPC7Z:1,66VCHSJNUP:2" size="40"></label>
+<label>Order value $<input name="value" value="120.00" size="8"></label></p>
+<p><label>Service <select name="level"><option>economy</option><option selected>standard</option><option>premium</option></select></label>
+<label>Declared value $<input name="declared" value="120.00" size="8"></label>
+<label><input type="checkbox" name="signature"> Signature</label>
+<label><input type="checkbox" name="insured" checked> Insured</label></p>
+<p><button>Quote and ship</button></p>
+</form>
+</body></html>
+`))
@@ -0,0 +1,94 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/shippingclient"
+)
+
+// TestDemoFrontend checks that an order posted to the frontend is quoted and
+// shipped, and that both hops are in the trace it reports.
+func TestDemoFrontend(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(newPropagator()))))
+	pb.RegisterShippingServiceServer(srv, newServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	c, err := shippingclient.NewClient(lis.Addr().String(), shippingclient.WithInstrumentation(otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(newPropagator())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	web := httptest.NewServer(newDemoFrontend(c, tp))
+	defer web.Close()
+
+	resp, err := http.Post(web.URL+"/ship", "application/json; charset=utf-8", strings.NewReader(
+		`{"address": {"city": "Mountain View", "country": "USA", "zipCode": 94043}, "items": [{"productId": "OLJCESPC7Z", "quantity": 2}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res frontendResult
+	json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || res.TrackingID == "" || res.QuoteID == "" || res.Error != "" || len(res.LineItems) != 1 {
+		t.Fatalf("TestDemoFrontend: got %d %+v", resp.StatusCode, res)
+	}
+	kinds := map[trace.SpanKind]int{}
+	for _, sp := range rec.Ended() {
+		if sp.SpanContext().TraceID().String() == res.TraceID {
+			kinds[sp.SpanKind()]++
+		}
+	}
+	if kinds[trace.SpanKindServer] != 3 || kinds[trace.SpanKindClient] != 2 {
+		t.Errorf("TestDemoFrontend: trace %s has spans %v, want the page and both calls on each side", res.TraceID, kinds)
+	}
+
+	resp, err = http.PostForm(web.URL+"/ship", url.Values{"city": {"Mountain View"}, "zip": {"94043"}, "items": {"OLJCESPC7Z:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("TestDemoFrontend: form got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	resp, err = http.PostForm(web.URL+"/ship", url.Values{"zip": {"none"}, "items": {"OLJCESPC7Z:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestDemoFrontend: bad zip code got %d, want 400", resp.StatusCode)
+	}
+}
@@ -18,14 +18,12 @@
 package hipstershop
 
 import (
+	context "context"
 	fmt "fmt"
 	proto "github.com/golang/protobuf/proto"
-	math "math"
-)
-
-import (
-	context "golang.org/x/net/context"
 	grpc "google.golang.org/grpc"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	math "math"
 )
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -37,7 +35,165 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Kinds of charge that make up a quote.
+type QuoteLineItemType int32
+
+const (
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_UNSPECIFIED QuoteLineItemType = 0
+	// Price of the parcel by zone, weight and method.
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_BASE_RATE QuoteLineItemType = 1
+	// Adjustment for the service level, negative for economy.
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_SERVICE_LEVEL QuoteLineItemType = 2
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_SIGNATURE     QuoteLineItemType = 3
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_INSURANCE     QuoteLineItemType = 4
+	// Surcharges come from the pricing rules of the rate table.
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_FUEL_SURCHARGE QuoteLineItemType = 5
+	// Duties and import taxes of international orders.
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_TAX            QuoteLineItemType = 6
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_PEAK_SURCHARGE QuoteLineItemType = 7
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_REMOTE_AREA    QuoteLineItemType = 8
+	// A promotion, as a negative amount.
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_DISCOUNT QuoteLineItemType = 9
+	// Distance from the warehouse, when addresses are geocoded.
+	QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_DISTANCE QuoteLineItemType = 10
+)
+
+var QuoteLineItemType_name = map[int32]string{
+	0:  "QUOTE_LINE_ITEM_TYPE_UNSPECIFIED",
+	1:  "QUOTE_LINE_ITEM_TYPE_BASE_RATE",
+	2:  "QUOTE_LINE_ITEM_TYPE_SERVICE_LEVEL",
+	3:  "QUOTE_LINE_ITEM_TYPE_SIGNATURE",
+	4:  "QUOTE_LINE_ITEM_TYPE_INSURANCE",
+	5:  "QUOTE_LINE_ITEM_TYPE_FUEL_SURCHARGE",
+	6:  "QUOTE_LINE_ITEM_TYPE_TAX",
+	7:  "QUOTE_LINE_ITEM_TYPE_PEAK_SURCHARGE",
+	8:  "QUOTE_LINE_ITEM_TYPE_REMOTE_AREA",
+	9:  "QUOTE_LINE_ITEM_TYPE_DISCOUNT",
+	10: "QUOTE_LINE_ITEM_TYPE_DISTANCE",
+}
+
+var QuoteLineItemType_value = map[string]int32{
+	"QUOTE_LINE_ITEM_TYPE_UNSPECIFIED":    0,
+	"QUOTE_LINE_ITEM_TYPE_BASE_RATE":      1,
+	"QUOTE_LINE_ITEM_TYPE_SERVICE_LEVEL":  2,
+	"QUOTE_LINE_ITEM_TYPE_SIGNATURE":      3,
+	"QUOTE_LINE_ITEM_TYPE_INSURANCE":      4,
+	"QUOTE_LINE_ITEM_TYPE_FUEL_SURCHARGE": 5,
+	"QUOTE_LINE_ITEM_TYPE_TAX":            6,
+	"QUOTE_LINE_ITEM_TYPE_PEAK_SURCHARGE": 7,
+	"QUOTE_LINE_ITEM_TYPE_REMOTE_AREA":    8,
+	"QUOTE_LINE_ITEM_TYPE_DISCOUNT":       9,
+	"QUOTE_LINE_ITEM_TYPE_DISTANCE":       10,
+}
+
+func (x QuoteLineItemType) String() string {
+	return proto.EnumName(QuoteLineItemType_name, int32(x))
+}
+
+func (QuoteLineItemType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{0}
+}
+
+type ShippingMethod int32
+
+const (
+	ShippingMethod_SHIPPING_METHOD_UNSPECIFIED ShippingMethod = 0
+	ShippingMethod_SHIPPING_METHOD_STANDARD    ShippingMethod = 1
+	ShippingMethod_SHIPPING_METHOD_EXPRESS     ShippingMethod = 2
+	ShippingMethod_SHIPPING_METHOD_OVERNIGHT   ShippingMethod = 3
+)
+
+var ShippingMethod_name = map[int32]string{
+	0: "SHIPPING_METHOD_UNSPECIFIED",
+	1: "SHIPPING_METHOD_STANDARD",
+	2: "SHIPPING_METHOD_EXPRESS",
+	3: "SHIPPING_METHOD_OVERNIGHT",
+}
+
+var ShippingMethod_value = map[string]int32{
+	"SHIPPING_METHOD_UNSPECIFIED": 0,
+	"SHIPPING_METHOD_STANDARD":    1,
+	"SHIPPING_METHOD_EXPRESS":     2,
+	"SHIPPING_METHOD_OVERNIGHT":   3,
+}
+
+func (x ShippingMethod) String() string {
+	return proto.EnumName(ShippingMethod_name, int32(x))
+}
+
+func (ShippingMethod) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{1}
+}
+
+// How carefully a parcel is handled, whatever its method.
+type ServiceLevel int32
+
+const (
+	ServiceLevel_SERVICE_LEVEL_UNSPECIFIED ServiceLevel = 0
+	ServiceLevel_SERVICE_LEVEL_ECONOMY     ServiceLevel = 1
+	ServiceLevel_SERVICE_LEVEL_STANDARD    ServiceLevel = 2
+	ServiceLevel_SERVICE_LEVEL_PREMIUM     ServiceLevel = 3
+)
+
+var ServiceLevel_name = map[int32]string{
+	0: "SERVICE_LEVEL_UNSPECIFIED",
+	1: "SERVICE_LEVEL_ECONOMY",
+	2: "SERVICE_LEVEL_STANDARD",
+	3: "SERVICE_LEVEL_PREMIUM",
+}
+
+var ServiceLevel_value = map[string]int32{
+	"SERVICE_LEVEL_UNSPECIFIED": 0,
+	"SERVICE_LEVEL_ECONOMY":     1,
+	"SERVICE_LEVEL_STANDARD":    2,
+	"SERVICE_LEVEL_PREMIUM":     3,
+}
+
+func (x ServiceLevel) String() string {
+	return proto.EnumName(ServiceLevel_name, int32(x))
+}
+
+func (ServiceLevel) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{2}
+}
+
+// Lifecycle states of a shipment. A shipment can only be cancelled before it
+// is in transit.
+type ShipmentStatus int32
+
+const (
+	ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED ShipmentStatus = 0
+	ShipmentStatus_SHIPMENT_STATUS_CREATED     ShipmentStatus = 1
+	ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT  ShipmentStatus = 2
+	ShipmentStatus_SHIPMENT_STATUS_DELIVERED   ShipmentStatus = 3
+	ShipmentStatus_SHIPMENT_STATUS_CANCELLED   ShipmentStatus = 4
+)
+
+var ShipmentStatus_name = map[int32]string{
+	0: "SHIPMENT_STATUS_UNSPECIFIED",
+	1: "SHIPMENT_STATUS_CREATED",
+	2: "SHIPMENT_STATUS_IN_TRANSIT",
+	3: "SHIPMENT_STATUS_DELIVERED",
+	4: "SHIPMENT_STATUS_CANCELLED",
+}
+
+var ShipmentStatus_value = map[string]int32{
+	"SHIPMENT_STATUS_UNSPECIFIED": 0,
+	"SHIPMENT_STATUS_CREATED":     1,
+	"SHIPMENT_STATUS_IN_TRANSIT":  2,
+	"SHIPMENT_STATUS_DELIVERED":   3,
+	"SHIPMENT_STATUS_CANCELLED":   4,
+}
+
+func (x ShipmentStatus) String() string {
+	return proto.EnumName(ShipmentStatus_name, int32(x))
+}
+
+func (ShipmentStatus) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{3}
+}
 
 type CartItem struct {
 	ProductId            string   `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
@@ -613,11 +769,20 @@ func (m *SearchProductsResponse) GetResults() []*Product {
 }
 
 type GetQuoteRequest struct {
-	Address              *Address    `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
-	Items                []*CartItem `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
-	XXX_unrecognized     []byte      `json:"-"`
-	XXX_sizecache        int32       `json:"-"`
+	Address *Address    `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Items   []*CartItem `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	// Defaults to standard shipping.
+	Method  ShippingMethod   `protobuf:"varint,3,opt,name=method,proto3,enum=hipstershop.ShippingMethod" json:"method,omitempty"`
+	Options *ShippingOptions `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	// Value of the items, in USD, for promotions such as free shipping over
+	// an amount.
+	OrderValue *Money `protobuf:"bytes,5,opt,name=order_value,json=orderValue,proto3" json:"order_value,omitempty"`
+	// Optional. Sizes of the products, to pack them and charge for the
+	// space they take up.
+	Dimensions           []*ItemDimensions `protobuf:"bytes,6,rep,name=dimensions,proto3" json:"dimensions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *GetQuoteRequest) Reset()         { *m = GetQuoteRequest{} }
@@ -659,18 +824,195 @@ func (m *GetQuoteRequest) GetItems() []*CartItem {
 	return nil
 }
 
-type GetQuoteResponse struct {
-	CostUsd              *Money   `protobuf:"bytes,1,opt,name=cost_usd,json=costUsd,proto3" json:"cost_usd,omitempty"`
+func (m *GetQuoteRequest) GetMethod() ShippingMethod {
+	if m != nil {
+		return m.Method
+	}
+	return ShippingMethod_SHIPPING_METHOD_UNSPECIFIED
+}
+
+func (m *GetQuoteRequest) GetOptions() *ShippingOptions {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+func (m *GetQuoteRequest) GetOrderValue() *Money {
+	if m != nil {
+		return m.OrderValue
+	}
+	return nil
+}
+
+func (m *GetQuoteRequest) GetDimensions() []*ItemDimensions {
+	if m != nil {
+		return m.Dimensions
+	}
+	return nil
+}
+
+// Size and weight of one unit of a product.
+type ItemDimensions struct {
+	ProductId string  `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	LengthCm  float64 `protobuf:"fixed64,2,opt,name=length_cm,json=lengthCm,proto3" json:"length_cm,omitempty"`
+	WidthCm   float64 `protobuf:"fixed64,3,opt,name=width_cm,json=widthCm,proto3" json:"width_cm,omitempty"`
+	HeightCm  float64 `protobuf:"fixed64,4,opt,name=height_cm,json=heightCm,proto3" json:"height_cm,omitempty"`
+	// Defaults to 500g.
+	WeightGrams          int32    `protobuf:"varint,5,opt,name=weight_grams,json=weightGrams,proto3" json:"weight_grams,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ItemDimensions) Reset()         { *m = ItemDimensions{} }
+func (m *ItemDimensions) String() string { return proto.CompactTextString(m) }
+func (*ItemDimensions) ProtoMessage()    {}
+func (*ItemDimensions) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{14}
+}
+
+func (m *ItemDimensions) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ItemDimensions.Unmarshal(m, b)
+}
+func (m *ItemDimensions) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ItemDimensions.Marshal(b, m, deterministic)
+}
+func (m *ItemDimensions) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ItemDimensions.Merge(m, src)
+}
+func (m *ItemDimensions) XXX_Size() int {
+	return xxx_messageInfo_ItemDimensions.Size(m)
+}
+func (m *ItemDimensions) XXX_DiscardUnknown() {
+	xxx_messageInfo_ItemDimensions.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ItemDimensions proto.InternalMessageInfo
+
+func (m *ItemDimensions) GetProductId() string {
+	if m != nil {
+		return m.ProductId
+	}
+	return ""
+}
+
+func (m *ItemDimensions) GetLengthCm() float64 {
+	if m != nil {
+		return m.LengthCm
+	}
+	return 0
+}
+
+func (m *ItemDimensions) GetWidthCm() float64 {
+	if m != nil {
+		return m.WidthCm
+	}
+	return 0
+}
+
+func (m *ItemDimensions) GetHeightCm() float64 {
+	if m != nil {
+		return m.HeightCm
+	}
+	return 0
+}
+
+func (m *ItemDimensions) GetWeightGrams() int32 {
+	if m != nil {
+		return m.WeightGrams
+	}
+	return 0
+}
+
+// How the items of an order were packed.
+type Packaging struct {
+	// Box of each package, e.g. "medium".
+	Boxes             []string `protobuf:"bytes,1,rep,name=boxes,proto3" json:"boxes,omitempty"`
+	ActualWeightGrams int32    `protobuf:"varint,2,opt,name=actual_weight_grams,json=actualWeightGrams,proto3" json:"actual_weight_grams,omitempty"`
+	// Weight charged for the space the boxes take up.
+	DimensionalWeightGrams int32 `protobuf:"varint,3,opt,name=dimensional_weight_grams,json=dimensionalWeightGrams,proto3" json:"dimensional_weight_grams,omitempty"`
+	// The larger of the two, which the quote is priced by.
+	BillableWeightGrams  int32    `protobuf:"varint,4,opt,name=billable_weight_grams,json=billableWeightGrams,proto3" json:"billable_weight_grams,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
+func (m *Packaging) Reset()         { *m = Packaging{} }
+func (m *Packaging) String() string { return proto.CompactTextString(m) }
+func (*Packaging) ProtoMessage()    {}
+func (*Packaging) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{15}
+}
+
+func (m *Packaging) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Packaging.Unmarshal(m, b)
+}
+func (m *Packaging) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Packaging.Marshal(b, m, deterministic)
+}
+func (m *Packaging) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Packaging.Merge(m, src)
+}
+func (m *Packaging) XXX_Size() int {
+	return xxx_messageInfo_Packaging.Size(m)
+}
+func (m *Packaging) XXX_DiscardUnknown() {
+	xxx_messageInfo_Packaging.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Packaging proto.InternalMessageInfo
+
+func (m *Packaging) GetBoxes() []string {
+	if m != nil {
+		return m.Boxes
+	}
+	return nil
+}
+
+func (m *Packaging) GetActualWeightGrams() int32 {
+	if m != nil {
+		return m.ActualWeightGrams
+	}
+	return 0
+}
+
+func (m *Packaging) GetDimensionalWeightGrams() int32 {
+	if m != nil {
+		return m.DimensionalWeightGrams
+	}
+	return 0
+}
+
+func (m *Packaging) GetBillableWeightGrams() int32 {
+	if m != nil {
+		return m.BillableWeightGrams
+	}
+	return 0
+}
+
+type GetQuoteResponse struct {
+	CostUsd *Money `protobuf:"bytes,1,opt,name=cost_usd,json=costUsd,proto3" json:"cost_usd,omitempty"`
+	// Pass quote_id to ShipOrder to be charged this price.
+	QuoteId   string                 `protobuf:"bytes,2,opt,name=quote_id,json=quoteId,proto3" json:"quote_id,omitempty"`
+	ExpiresAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	// How cost_usd is made up, base rate first. The amounts add up to it.
+	LineItems []*QuoteLineItem `protobuf:"bytes,4,rep,name=line_items,json=lineItems,proto3" json:"line_items,omitempty"`
+	// The promotion that was applied, if any.
+	PromotionId string `protobuf:"bytes,5,opt,name=promotion_id,json=promotionId,proto3" json:"promotion_id,omitempty"`
+	// Set when the request has dimensions.
+	Packaging            *Packaging `protobuf:"bytes,6,opt,name=packaging,proto3" json:"packaging,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
 func (m *GetQuoteResponse) Reset()         { *m = GetQuoteResponse{} }
 func (m *GetQuoteResponse) String() string { return proto.CompactTextString(m) }
 func (*GetQuoteResponse) ProtoMessage()    {}
 func (*GetQuoteResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{14}
+	return fileDescriptor_ca53982754088a9d, []int{16}
 }
 
 func (m *GetQuoteResponse) XXX_Unmarshal(b []byte) error {
@@ -698,19 +1040,173 @@ func (m *GetQuoteResponse) GetCostUsd() *Money {
 	return nil
 }
 
+func (m *GetQuoteResponse) GetQuoteId() string {
+	if m != nil {
+		return m.QuoteId
+	}
+	return ""
+}
+
+func (m *GetQuoteResponse) GetExpiresAt() *timestamppb.Timestamp {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return nil
+}
+
+func (m *GetQuoteResponse) GetLineItems() []*QuoteLineItem {
+	if m != nil {
+		return m.LineItems
+	}
+	return nil
+}
+
+func (m *GetQuoteResponse) GetPromotionId() string {
+	if m != nil {
+		return m.PromotionId
+	}
+	return ""
+}
+
+func (m *GetQuoteResponse) GetPackaging() *Packaging {
+	if m != nil {
+		return m.Packaging
+	}
+	return nil
+}
+
+type QuoteLineItem struct {
+	Type QuoteLineItemType `protobuf:"varint,1,opt,name=type,proto3,enum=hipstershop.QuoteLineItemType" json:"type,omitempty"`
+	// Human-readable, e.g. "Premium service".
+	Description          string   `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	AmountUsd            *Money   `protobuf:"bytes,3,opt,name=amount_usd,json=amountUsd,proto3" json:"amount_usd,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QuoteLineItem) Reset()         { *m = QuoteLineItem{} }
+func (m *QuoteLineItem) String() string { return proto.CompactTextString(m) }
+func (*QuoteLineItem) ProtoMessage()    {}
+func (*QuoteLineItem) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{17}
+}
+
+func (m *QuoteLineItem) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QuoteLineItem.Unmarshal(m, b)
+}
+func (m *QuoteLineItem) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QuoteLineItem.Marshal(b, m, deterministic)
+}
+func (m *QuoteLineItem) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QuoteLineItem.Merge(m, src)
+}
+func (m *QuoteLineItem) XXX_Size() int {
+	return xxx_messageInfo_QuoteLineItem.Size(m)
+}
+func (m *QuoteLineItem) XXX_DiscardUnknown() {
+	xxx_messageInfo_QuoteLineItem.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QuoteLineItem proto.InternalMessageInfo
+
+func (m *QuoteLineItem) GetType() QuoteLineItemType {
+	if m != nil {
+		return m.Type
+	}
+	return QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_UNSPECIFIED
+}
+
+func (m *QuoteLineItem) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *QuoteLineItem) GetAmountUsd() *Money {
+	if m != nil {
+		return m.AmountUsd
+	}
+	return nil
+}
+
+type GetBulkQuoteResponse struct {
+	// Sum of the package costs.
+	CostUsd  *Money `protobuf:"bytes,1,opt,name=cost_usd,json=costUsd,proto3" json:"cost_usd,omitempty"`
+	Packages int32  `protobuf:"varint,2,opt,name=packages,proto3" json:"packages,omitempty"`
+	// Cost of each package, in the order they were streamed.
+	PackageCosts         []*Money `protobuf:"bytes,3,rep,name=package_costs,json=packageCosts,proto3" json:"package_costs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetBulkQuoteResponse) Reset()         { *m = GetBulkQuoteResponse{} }
+func (m *GetBulkQuoteResponse) String() string { return proto.CompactTextString(m) }
+func (*GetBulkQuoteResponse) ProtoMessage()    {}
+func (*GetBulkQuoteResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{18}
+}
+
+func (m *GetBulkQuoteResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetBulkQuoteResponse.Unmarshal(m, b)
+}
+func (m *GetBulkQuoteResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetBulkQuoteResponse.Marshal(b, m, deterministic)
+}
+func (m *GetBulkQuoteResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetBulkQuoteResponse.Merge(m, src)
+}
+func (m *GetBulkQuoteResponse) XXX_Size() int {
+	return xxx_messageInfo_GetBulkQuoteResponse.Size(m)
+}
+func (m *GetBulkQuoteResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetBulkQuoteResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetBulkQuoteResponse proto.InternalMessageInfo
+
+func (m *GetBulkQuoteResponse) GetCostUsd() *Money {
+	if m != nil {
+		return m.CostUsd
+	}
+	return nil
+}
+
+func (m *GetBulkQuoteResponse) GetPackages() int32 {
+	if m != nil {
+		return m.Packages
+	}
+	return 0
+}
+
+func (m *GetBulkQuoteResponse) GetPackageCosts() []*Money {
+	if m != nil {
+		return m.PackageCosts
+	}
+	return nil
+}
+
 type ShipOrderRequest struct {
-	Address              *Address    `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
-	Items                []*CartItem `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
-	XXX_unrecognized     []byte      `json:"-"`
-	XXX_sizecache        int32       `json:"-"`
+	Address *Address    `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Items   []*CartItem `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	// Optional. A quote from GetQuote that has not yet expired.
+	QuoteId string `protobuf:"bytes,3,opt,name=quote_id,json=quoteId,proto3" json:"quote_id,omitempty"`
+	// Must be the options the quote was given for, if there is one.
+	Options *ShippingOptions `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	// As in GetQuoteRequest, so that the order weighs what it was quoted at.
+	Dimensions           []*ItemDimensions `protobuf:"bytes,5,rep,name=dimensions,proto3" json:"dimensions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *ShipOrderRequest) Reset()         { *m = ShipOrderRequest{} }
 func (m *ShipOrderRequest) String() string { return proto.CompactTextString(m) }
 func (*ShipOrderRequest) ProtoMessage()    {}
 func (*ShipOrderRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{15}
+	return fileDescriptor_ca53982754088a9d, []int{19}
 }
 
 func (m *ShipOrderRequest) XXX_Unmarshal(b []byte) error {
@@ -729,61 +1225,965 @@ func (m *ShipOrderRequest) XXX_DiscardUnknown() {
 	xxx_messageInfo_ShipOrderRequest.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_ShipOrderRequest proto.InternalMessageInfo
+var xxx_messageInfo_ShipOrderRequest proto.InternalMessageInfo
+
+func (m *ShipOrderRequest) GetAddress() *Address {
+	if m != nil {
+		return m.Address
+	}
+	return nil
+}
+
+func (m *ShipOrderRequest) GetItems() []*CartItem {
+	if m != nil {
+		return m.Items
+	}
+	return nil
+}
+
+func (m *ShipOrderRequest) GetQuoteId() string {
+	if m != nil {
+		return m.QuoteId
+	}
+	return ""
+}
+
+func (m *ShipOrderRequest) GetOptions() *ShippingOptions {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+func (m *ShipOrderRequest) GetDimensions() []*ItemDimensions {
+	if m != nil {
+		return m.Dimensions
+	}
+	return nil
+}
+
+type ShipOrderResponse struct {
+	TrackingId string `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	// Set when the order was placed against a quote.
+	CostUsd              *Money   `protobuf:"bytes,2,opt,name=cost_usd,json=costUsd,proto3" json:"cost_usd,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ShipOrderResponse) Reset()         { *m = ShipOrderResponse{} }
+func (m *ShipOrderResponse) String() string { return proto.CompactTextString(m) }
+func (*ShipOrderResponse) ProtoMessage()    {}
+func (*ShipOrderResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{20}
+}
+
+func (m *ShipOrderResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShipOrderResponse.Unmarshal(m, b)
+}
+func (m *ShipOrderResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShipOrderResponse.Marshal(b, m, deterministic)
+}
+func (m *ShipOrderResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShipOrderResponse.Merge(m, src)
+}
+func (m *ShipOrderResponse) XXX_Size() int {
+	return xxx_messageInfo_ShipOrderResponse.Size(m)
+}
+func (m *ShipOrderResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShipOrderResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShipOrderResponse proto.InternalMessageInfo
+
+func (m *ShipOrderResponse) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+func (m *ShipOrderResponse) GetCostUsd() *Money {
+	if m != nil {
+		return m.CostUsd
+	}
+	return nil
+}
+
+type ShipOrdersRequest struct {
+	Orders               []*ShipOrderRequest `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *ShipOrdersRequest) Reset()         { *m = ShipOrdersRequest{} }
+func (m *ShipOrdersRequest) String() string { return proto.CompactTextString(m) }
+func (*ShipOrdersRequest) ProtoMessage()    {}
+func (*ShipOrdersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{21}
+}
+
+func (m *ShipOrdersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShipOrdersRequest.Unmarshal(m, b)
+}
+func (m *ShipOrdersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShipOrdersRequest.Marshal(b, m, deterministic)
+}
+func (m *ShipOrdersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShipOrdersRequest.Merge(m, src)
+}
+func (m *ShipOrdersRequest) XXX_Size() int {
+	return xxx_messageInfo_ShipOrdersRequest.Size(m)
+}
+func (m *ShipOrdersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShipOrdersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShipOrdersRequest proto.InternalMessageInfo
+
+func (m *ShipOrdersRequest) GetOrders() []*ShipOrderRequest {
+	if m != nil {
+		return m.Orders
+	}
+	return nil
+}
+
+// Outcome of a single order in a batch. Results are returned in the same
+// order as the requests; code is a google.rpc.Code and is 0 on success.
+type ShipOrderResult struct {
+	TrackingId           string   `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	Code                 int32    `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
+	Error                string   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ShipOrderResult) Reset()         { *m = ShipOrderResult{} }
+func (m *ShipOrderResult) String() string { return proto.CompactTextString(m) }
+func (*ShipOrderResult) ProtoMessage()    {}
+func (*ShipOrderResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{22}
+}
+
+func (m *ShipOrderResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShipOrderResult.Unmarshal(m, b)
+}
+func (m *ShipOrderResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShipOrderResult.Marshal(b, m, deterministic)
+}
+func (m *ShipOrderResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShipOrderResult.Merge(m, src)
+}
+func (m *ShipOrderResult) XXX_Size() int {
+	return xxx_messageInfo_ShipOrderResult.Size(m)
+}
+func (m *ShipOrderResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShipOrderResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShipOrderResult proto.InternalMessageInfo
+
+func (m *ShipOrderResult) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+func (m *ShipOrderResult) GetCode() int32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *ShipOrderResult) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type ShipOrdersResponse struct {
+	Results              []*ShipOrderResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *ShipOrdersResponse) Reset()         { *m = ShipOrdersResponse{} }
+func (m *ShipOrdersResponse) String() string { return proto.CompactTextString(m) }
+func (*ShipOrdersResponse) ProtoMessage()    {}
+func (*ShipOrdersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{23}
+}
+
+func (m *ShipOrdersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShipOrdersResponse.Unmarshal(m, b)
+}
+func (m *ShipOrdersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShipOrdersResponse.Marshal(b, m, deterministic)
+}
+func (m *ShipOrdersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShipOrdersResponse.Merge(m, src)
+}
+func (m *ShipOrdersResponse) XXX_Size() int {
+	return xxx_messageInfo_ShipOrdersResponse.Size(m)
+}
+func (m *ShipOrdersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShipOrdersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShipOrdersResponse proto.InternalMessageInfo
+
+func (m *ShipOrdersResponse) GetResults() []*ShipOrderResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+type StreamOrdersRequest struct {
+	Order *ShipOrderRequest `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	// Optional. Echoed in the responses about this order.
+	Ref                  string   `protobuf:"bytes,2,opt,name=ref,proto3" json:"ref,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamOrdersRequest) Reset()         { *m = StreamOrdersRequest{} }
+func (m *StreamOrdersRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamOrdersRequest) ProtoMessage()    {}
+func (*StreamOrdersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{24}
+}
+
+func (m *StreamOrdersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamOrdersRequest.Unmarshal(m, b)
+}
+func (m *StreamOrdersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamOrdersRequest.Marshal(b, m, deterministic)
+}
+func (m *StreamOrdersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamOrdersRequest.Merge(m, src)
+}
+func (m *StreamOrdersRequest) XXX_Size() int {
+	return xxx_messageInfo_StreamOrdersRequest.Size(m)
+}
+func (m *StreamOrdersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamOrdersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamOrdersRequest proto.InternalMessageInfo
+
+func (m *StreamOrdersRequest) GetOrder() *ShipOrderRequest {
+	if m != nil {
+		return m.Order
+	}
+	return nil
+}
+
+func (m *StreamOrdersRequest) GetRef() string {
+	if m != nil {
+		return m.Ref
+	}
+	return ""
+}
+
+type StreamOrdersResponse struct {
+	// Position of the order in the request stream, starting at 0.
+	Index int32  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Ref   string `protobuf:"bytes,2,opt,name=ref,proto3" json:"ref,omitempty"`
+	// Unset in the acknowledgement; set once the order is processed.
+	Result               *ShipOrderResult `protobuf:"bytes,3,opt,name=result,proto3" json:"result,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *StreamOrdersResponse) Reset()         { *m = StreamOrdersResponse{} }
+func (m *StreamOrdersResponse) String() string { return proto.CompactTextString(m) }
+func (*StreamOrdersResponse) ProtoMessage()    {}
+func (*StreamOrdersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{25}
+}
+
+func (m *StreamOrdersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamOrdersResponse.Unmarshal(m, b)
+}
+func (m *StreamOrdersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamOrdersResponse.Marshal(b, m, deterministic)
+}
+func (m *StreamOrdersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamOrdersResponse.Merge(m, src)
+}
+func (m *StreamOrdersResponse) XXX_Size() int {
+	return xxx_messageInfo_StreamOrdersResponse.Size(m)
+}
+func (m *StreamOrdersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamOrdersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamOrdersResponse proto.InternalMessageInfo
+
+func (m *StreamOrdersResponse) GetIndex() int32 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *StreamOrdersResponse) GetRef() string {
+	if m != nil {
+		return m.Ref
+	}
+	return ""
+}
+
+func (m *StreamOrdersResponse) GetResult() *ShipOrderResult {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+type GenerateLabelRequest struct {
+	TrackingId           string   `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GenerateLabelRequest) Reset()         { *m = GenerateLabelRequest{} }
+func (m *GenerateLabelRequest) String() string { return proto.CompactTextString(m) }
+func (*GenerateLabelRequest) ProtoMessage()    {}
+func (*GenerateLabelRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{26}
+}
+
+func (m *GenerateLabelRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GenerateLabelRequest.Unmarshal(m, b)
+}
+func (m *GenerateLabelRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GenerateLabelRequest.Marshal(b, m, deterministic)
+}
+func (m *GenerateLabelRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GenerateLabelRequest.Merge(m, src)
+}
+func (m *GenerateLabelRequest) XXX_Size() int {
+	return xxx_messageInfo_GenerateLabelRequest.Size(m)
+}
+func (m *GenerateLabelRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GenerateLabelRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GenerateLabelRequest proto.InternalMessageInfo
+
+func (m *GenerateLabelRequest) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+type GenerateLabelResponse struct {
+	TrackingId string `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	// MIME type of label, e.g. "image/png".
+	ContentType          string   `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Label                []byte   `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GenerateLabelResponse) Reset()         { *m = GenerateLabelResponse{} }
+func (m *GenerateLabelResponse) String() string { return proto.CompactTextString(m) }
+func (*GenerateLabelResponse) ProtoMessage()    {}
+func (*GenerateLabelResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{27}
+}
+
+func (m *GenerateLabelResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GenerateLabelResponse.Unmarshal(m, b)
+}
+func (m *GenerateLabelResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GenerateLabelResponse.Marshal(b, m, deterministic)
+}
+func (m *GenerateLabelResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GenerateLabelResponse.Merge(m, src)
+}
+func (m *GenerateLabelResponse) XXX_Size() int {
+	return xxx_messageInfo_GenerateLabelResponse.Size(m)
+}
+func (m *GenerateLabelResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GenerateLabelResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GenerateLabelResponse proto.InternalMessageInfo
+
+func (m *GenerateLabelResponse) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+func (m *GenerateLabelResponse) GetContentType() string {
+	if m != nil {
+		return m.ContentType
+	}
+	return ""
+}
+
+func (m *GenerateLabelResponse) GetLabel() []byte {
+	if m != nil {
+		return m.Label
+	}
+	return nil
+}
+
+// Options of an order that add to its price. All of them are optional.
+type ShippingOptions struct {
+	// Defaults to standard.
+	ServiceLevel ServiceLevel `protobuf:"varint,1,opt,name=service_level,json=serviceLevel,proto3,enum=hipstershop.ServiceLevel" json:"service_level,omitempty"`
+	// Value of the contents, in USD. Required for insurance.
+	DeclaredValue     *Money `protobuf:"bytes,2,opt,name=declared_value,json=declaredValue,proto3" json:"declared_value,omitempty"`
+	SignatureRequired bool   `protobuf:"varint,3,opt,name=signature_required,json=signatureRequired,proto3" json:"signature_required,omitempty"`
+	// Insures the contents for their declared value.
+	Insured              bool     `protobuf:"varint,4,opt,name=insured,proto3" json:"insured,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ShippingOptions) Reset()         { *m = ShippingOptions{} }
+func (m *ShippingOptions) String() string { return proto.CompactTextString(m) }
+func (*ShippingOptions) ProtoMessage()    {}
+func (*ShippingOptions) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{28}
+}
+
+func (m *ShippingOptions) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShippingOptions.Unmarshal(m, b)
+}
+func (m *ShippingOptions) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShippingOptions.Marshal(b, m, deterministic)
+}
+func (m *ShippingOptions) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShippingOptions.Merge(m, src)
+}
+func (m *ShippingOptions) XXX_Size() int {
+	return xxx_messageInfo_ShippingOptions.Size(m)
+}
+func (m *ShippingOptions) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShippingOptions.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShippingOptions proto.InternalMessageInfo
+
+func (m *ShippingOptions) GetServiceLevel() ServiceLevel {
+	if m != nil {
+		return m.ServiceLevel
+	}
+	return ServiceLevel_SERVICE_LEVEL_UNSPECIFIED
+}
+
+func (m *ShippingOptions) GetDeclaredValue() *Money {
+	if m != nil {
+		return m.DeclaredValue
+	}
+	return nil
+}
+
+func (m *ShippingOptions) GetSignatureRequired() bool {
+	if m != nil {
+		return m.SignatureRequired
+	}
+	return false
+}
+
+func (m *ShippingOptions) GetInsured() bool {
+	if m != nil {
+		return m.Insured
+	}
+	return false
+}
+
+type GetDeliveryEstimateRequest struct {
+	Address *Address `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// Defaults to standard shipping.
+	Method ShippingMethod `protobuf:"varint,2,opt,name=method,proto3,enum=hipstershop.ShippingMethod" json:"method,omitempty"`
+	// Defaults to now.
+	ShipDate             *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=ship_date,json=shipDate,proto3" json:"ship_date,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *GetDeliveryEstimateRequest) Reset()         { *m = GetDeliveryEstimateRequest{} }
+func (m *GetDeliveryEstimateRequest) String() string { return proto.CompactTextString(m) }
+func (*GetDeliveryEstimateRequest) ProtoMessage()    {}
+func (*GetDeliveryEstimateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{29}
+}
+
+func (m *GetDeliveryEstimateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetDeliveryEstimateRequest.Unmarshal(m, b)
+}
+func (m *GetDeliveryEstimateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetDeliveryEstimateRequest.Marshal(b, m, deterministic)
+}
+func (m *GetDeliveryEstimateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetDeliveryEstimateRequest.Merge(m, src)
+}
+func (m *GetDeliveryEstimateRequest) XXX_Size() int {
+	return xxx_messageInfo_GetDeliveryEstimateRequest.Size(m)
+}
+func (m *GetDeliveryEstimateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetDeliveryEstimateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetDeliveryEstimateRequest proto.InternalMessageInfo
+
+func (m *GetDeliveryEstimateRequest) GetAddress() *Address {
+	if m != nil {
+		return m.Address
+	}
+	return nil
+}
+
+func (m *GetDeliveryEstimateRequest) GetMethod() ShippingMethod {
+	if m != nil {
+		return m.Method
+	}
+	return ShippingMethod_SHIPPING_METHOD_UNSPECIFIED
+}
+
+func (m *GetDeliveryEstimateRequest) GetShipDate() *timestamppb.Timestamp {
+	if m != nil {
+		return m.ShipDate
+	}
+	return nil
+}
+
+type GetDeliveryEstimateResponse struct {
+	EstimatedDelivery    *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=estimated_delivery,json=estimatedDelivery,proto3" json:"estimated_delivery,omitempty"`
+	BusinessDays         int32                  `protobuf:"varint,2,opt,name=business_days,json=businessDays,proto3" json:"business_days,omitempty"`
+	Zone                 string                 `protobuf:"bytes,3,opt,name=zone,proto3" json:"zone,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *GetDeliveryEstimateResponse) Reset()         { *m = GetDeliveryEstimateResponse{} }
+func (m *GetDeliveryEstimateResponse) String() string { return proto.CompactTextString(m) }
+func (*GetDeliveryEstimateResponse) ProtoMessage()    {}
+func (*GetDeliveryEstimateResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{30}
+}
+
+func (m *GetDeliveryEstimateResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetDeliveryEstimateResponse.Unmarshal(m, b)
+}
+func (m *GetDeliveryEstimateResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetDeliveryEstimateResponse.Marshal(b, m, deterministic)
+}
+func (m *GetDeliveryEstimateResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetDeliveryEstimateResponse.Merge(m, src)
+}
+func (m *GetDeliveryEstimateResponse) XXX_Size() int {
+	return xxx_messageInfo_GetDeliveryEstimateResponse.Size(m)
+}
+func (m *GetDeliveryEstimateResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetDeliveryEstimateResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetDeliveryEstimateResponse proto.InternalMessageInfo
+
+func (m *GetDeliveryEstimateResponse) GetEstimatedDelivery() *timestamppb.Timestamp {
+	if m != nil {
+		return m.EstimatedDelivery
+	}
+	return nil
+}
+
+func (m *GetDeliveryEstimateResponse) GetBusinessDays() int32 {
+	if m != nil {
+		return m.BusinessDays
+	}
+	return 0
+}
+
+func (m *GetDeliveryEstimateResponse) GetZone() string {
+	if m != nil {
+		return m.Zone
+	}
+	return ""
+}
+
+type CancelShipmentRequest struct {
+	TrackingId           string   `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CancelShipmentRequest) Reset()         { *m = CancelShipmentRequest{} }
+func (m *CancelShipmentRequest) String() string { return proto.CompactTextString(m) }
+func (*CancelShipmentRequest) ProtoMessage()    {}
+func (*CancelShipmentRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{31}
+}
+
+func (m *CancelShipmentRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CancelShipmentRequest.Unmarshal(m, b)
+}
+func (m *CancelShipmentRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CancelShipmentRequest.Marshal(b, m, deterministic)
+}
+func (m *CancelShipmentRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CancelShipmentRequest.Merge(m, src)
+}
+func (m *CancelShipmentRequest) XXX_Size() int {
+	return xxx_messageInfo_CancelShipmentRequest.Size(m)
+}
+func (m *CancelShipmentRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CancelShipmentRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CancelShipmentRequest proto.InternalMessageInfo
+
+func (m *CancelShipmentRequest) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+type CancelShipmentResponse struct {
+	TrackingId           string         `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	Status               ShipmentStatus `protobuf:"varint,2,opt,name=status,proto3,enum=hipstershop.ShipmentStatus" json:"status,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *CancelShipmentResponse) Reset()         { *m = CancelShipmentResponse{} }
+func (m *CancelShipmentResponse) String() string { return proto.CompactTextString(m) }
+func (*CancelShipmentResponse) ProtoMessage()    {}
+func (*CancelShipmentResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{32}
+}
+
+func (m *CancelShipmentResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CancelShipmentResponse.Unmarshal(m, b)
+}
+func (m *CancelShipmentResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CancelShipmentResponse.Marshal(b, m, deterministic)
+}
+func (m *CancelShipmentResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CancelShipmentResponse.Merge(m, src)
+}
+func (m *CancelShipmentResponse) XXX_Size() int {
+	return xxx_messageInfo_CancelShipmentResponse.Size(m)
+}
+func (m *CancelShipmentResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CancelShipmentResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CancelShipmentResponse proto.InternalMessageInfo
+
+func (m *CancelShipmentResponse) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+func (m *CancelShipmentResponse) GetStatus() ShipmentStatus {
+	if m != nil {
+		return m.Status
+	}
+	return ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
+}
+
+type GetTrackingStatusRequest struct {
+	TrackingId           string   `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTrackingStatusRequest) Reset()         { *m = GetTrackingStatusRequest{} }
+func (m *GetTrackingStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*GetTrackingStatusRequest) ProtoMessage()    {}
+func (*GetTrackingStatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{33}
+}
+
+func (m *GetTrackingStatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTrackingStatusRequest.Unmarshal(m, b)
+}
+func (m *GetTrackingStatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTrackingStatusRequest.Marshal(b, m, deterministic)
+}
+func (m *GetTrackingStatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTrackingStatusRequest.Merge(m, src)
+}
+func (m *GetTrackingStatusRequest) XXX_Size() int {
+	return xxx_messageInfo_GetTrackingStatusRequest.Size(m)
+}
+func (m *GetTrackingStatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTrackingStatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTrackingStatusRequest proto.InternalMessageInfo
+
+func (m *GetTrackingStatusRequest) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+type GetTrackingStatusResponse struct {
+	TrackingId           string                 `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	Status               ShipmentStatus         `protobuf:"varint,2,opt,name=status,proto3,enum=hipstershop.ShipmentStatus" json:"status,omitempty"`
+	UpdatedAt            *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *GetTrackingStatusResponse) Reset()         { *m = GetTrackingStatusResponse{} }
+func (m *GetTrackingStatusResponse) String() string { return proto.CompactTextString(m) }
+func (*GetTrackingStatusResponse) ProtoMessage()    {}
+func (*GetTrackingStatusResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{34}
+}
+
+func (m *GetTrackingStatusResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTrackingStatusResponse.Unmarshal(m, b)
+}
+func (m *GetTrackingStatusResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTrackingStatusResponse.Marshal(b, m, deterministic)
+}
+func (m *GetTrackingStatusResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTrackingStatusResponse.Merge(m, src)
+}
+func (m *GetTrackingStatusResponse) XXX_Size() int {
+	return xxx_messageInfo_GetTrackingStatusResponse.Size(m)
+}
+func (m *GetTrackingStatusResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTrackingStatusResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTrackingStatusResponse proto.InternalMessageInfo
+
+func (m *GetTrackingStatusResponse) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+func (m *GetTrackingStatusResponse) GetStatus() ShipmentStatus {
+	if m != nil {
+		return m.Status
+	}
+	return ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
+}
+
+func (m *GetTrackingStatusResponse) GetUpdatedAt() *timestamppb.Timestamp {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return nil
+}
+
+type GetShipmentHistoryRequest struct {
+	TrackingId           string   `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetShipmentHistoryRequest) Reset()         { *m = GetShipmentHistoryRequest{} }
+func (m *GetShipmentHistoryRequest) String() string { return proto.CompactTextString(m) }
+func (*GetShipmentHistoryRequest) ProtoMessage()    {}
+func (*GetShipmentHistoryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{35}
+}
+
+func (m *GetShipmentHistoryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetShipmentHistoryRequest.Unmarshal(m, b)
+}
+func (m *GetShipmentHistoryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetShipmentHistoryRequest.Marshal(b, m, deterministic)
+}
+func (m *GetShipmentHistoryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetShipmentHistoryRequest.Merge(m, src)
+}
+func (m *GetShipmentHistoryRequest) XXX_Size() int {
+	return xxx_messageInfo_GetShipmentHistoryRequest.Size(m)
+}
+func (m *GetShipmentHistoryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetShipmentHistoryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetShipmentHistoryRequest proto.InternalMessageInfo
+
+func (m *GetShipmentHistoryRequest) GetTrackingId() string {
+	if m != nil {
+		return m.TrackingId
+	}
+	return ""
+}
+
+// One change of state of a shipment, recorded when it happened and never
+// modified afterwards.
+type ShipmentHistoryEvent struct {
+	// Position of the event in the shipment's history, starting at 1.
+	Sequence int64 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	// ID of the shipment event published for the change.
+	EventId string `protobuf:"bytes,2,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	// Unset for the creation of the shipment.
+	PreviousStatus ShipmentStatus         `protobuf:"varint,3,opt,name=previous_status,json=previousStatus,proto3,enum=hipstershop.ShipmentStatus" json:"previous_status,omitempty"`
+	Status         ShipmentStatus         `protobuf:"varint,4,opt,name=status,proto3,enum=hipstershop.ShipmentStatus" json:"status,omitempty"`
+	Time           *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	// Trace of the call that made the change, if it was traced.
+	TraceId              string   `protobuf:"bytes,6,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ShipmentHistoryEvent) Reset()         { *m = ShipmentHistoryEvent{} }
+func (m *ShipmentHistoryEvent) String() string { return proto.CompactTextString(m) }
+func (*ShipmentHistoryEvent) ProtoMessage()    {}
+func (*ShipmentHistoryEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{36}
+}
+
+func (m *ShipmentHistoryEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShipmentHistoryEvent.Unmarshal(m, b)
+}
+func (m *ShipmentHistoryEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShipmentHistoryEvent.Marshal(b, m, deterministic)
+}
+func (m *ShipmentHistoryEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShipmentHistoryEvent.Merge(m, src)
+}
+func (m *ShipmentHistoryEvent) XXX_Size() int {
+	return xxx_messageInfo_ShipmentHistoryEvent.Size(m)
+}
+func (m *ShipmentHistoryEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShipmentHistoryEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShipmentHistoryEvent proto.InternalMessageInfo
+
+func (m *ShipmentHistoryEvent) GetSequence() int64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *ShipmentHistoryEvent) GetEventId() string {
+	if m != nil {
+		return m.EventId
+	}
+	return ""
+}
+
+func (m *ShipmentHistoryEvent) GetPreviousStatus() ShipmentStatus {
+	if m != nil {
+		return m.PreviousStatus
+	}
+	return ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
+}
+
+func (m *ShipmentHistoryEvent) GetStatus() ShipmentStatus {
+	if m != nil {
+		return m.Status
+	}
+	return ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
+}
 
-func (m *ShipOrderRequest) GetAddress() *Address {
+func (m *ShipmentHistoryEvent) GetTime() *timestamppb.Timestamp {
 	if m != nil {
-		return m.Address
+		return m.Time
 	}
 	return nil
 }
 
-func (m *ShipOrderRequest) GetItems() []*CartItem {
+func (m *ShipmentHistoryEvent) GetTraceId() string {
 	if m != nil {
-		return m.Items
+		return m.TraceId
 	}
-	return nil
+	return ""
 }
 
-type ShipOrderResponse struct {
-	TrackingId           string   `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+type GetShipmentHistoryResponse struct {
+	TrackingId string `protobuf:"bytes,1,opt,name=tracking_id,json=trackingId,proto3" json:"tracking_id,omitempty"`
+	// Status reached by replaying the events.
+	Status               ShipmentStatus          `protobuf:"varint,2,opt,name=status,proto3,enum=hipstershop.ShipmentStatus" json:"status,omitempty"`
+	Events               []*ShipmentHistoryEvent `protobuf:"bytes,3,rep,name=events,proto3" json:"events,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                `json:"-"`
+	XXX_unrecognized     []byte                  `json:"-"`
+	XXX_sizecache        int32                   `json:"-"`
 }
 
-func (m *ShipOrderResponse) Reset()         { *m = ShipOrderResponse{} }
-func (m *ShipOrderResponse) String() string { return proto.CompactTextString(m) }
-func (*ShipOrderResponse) ProtoMessage()    {}
-func (*ShipOrderResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{16}
+func (m *GetShipmentHistoryResponse) Reset()         { *m = GetShipmentHistoryResponse{} }
+func (m *GetShipmentHistoryResponse) String() string { return proto.CompactTextString(m) }
+func (*GetShipmentHistoryResponse) ProtoMessage()    {}
+func (*GetShipmentHistoryResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ca53982754088a9d, []int{37}
 }
 
-func (m *ShipOrderResponse) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_ShipOrderResponse.Unmarshal(m, b)
+func (m *GetShipmentHistoryResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetShipmentHistoryResponse.Unmarshal(m, b)
 }
-func (m *ShipOrderResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_ShipOrderResponse.Marshal(b, m, deterministic)
+func (m *GetShipmentHistoryResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetShipmentHistoryResponse.Marshal(b, m, deterministic)
 }
-func (m *ShipOrderResponse) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_ShipOrderResponse.Merge(m, src)
+func (m *GetShipmentHistoryResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetShipmentHistoryResponse.Merge(m, src)
 }
-func (m *ShipOrderResponse) XXX_Size() int {
-	return xxx_messageInfo_ShipOrderResponse.Size(m)
+func (m *GetShipmentHistoryResponse) XXX_Size() int {
+	return xxx_messageInfo_GetShipmentHistoryResponse.Size(m)
 }
-func (m *ShipOrderResponse) XXX_DiscardUnknown() {
-	xxx_messageInfo_ShipOrderResponse.DiscardUnknown(m)
+func (m *GetShipmentHistoryResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetShipmentHistoryResponse.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_ShipOrderResponse proto.InternalMessageInfo
+var xxx_messageInfo_GetShipmentHistoryResponse proto.InternalMessageInfo
 
-func (m *ShipOrderResponse) GetTrackingId() string {
+func (m *GetShipmentHistoryResponse) GetTrackingId() string {
 	if m != nil {
 		return m.TrackingId
 	}
 	return ""
 }
 
+func (m *GetShipmentHistoryResponse) GetStatus() ShipmentStatus {
+	if m != nil {
+		return m.Status
+	}
+	return ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
+}
+
+func (m *GetShipmentHistoryResponse) GetEvents() []*ShipmentHistoryEvent {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
 type Address struct {
 	StreetAddress        string   `protobuf:"bytes,1,opt,name=street_address,json=streetAddress,proto3" json:"street_address,omitempty"`
 	City                 string   `protobuf:"bytes,2,opt,name=city,proto3" json:"city,omitempty"`
@@ -799,7 +2199,7 @@ func (m *Address) Reset()         { *m = Address{} }
 func (m *Address) String() string { return proto.CompactTextString(m) }
 func (*Address) ProtoMessage()    {}
 func (*Address) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{17}
+	return fileDescriptor_ca53982754088a9d, []int{38}
 }
 
 func (m *Address) XXX_Unmarshal(b []byte) error {
@@ -878,7 +2278,7 @@ func (m *Money) Reset()         { *m = Money{} }
 func (m *Money) String() string { return proto.CompactTextString(m) }
 func (*Money) ProtoMessage()    {}
 func (*Money) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{18}
+	return fileDescriptor_ca53982754088a9d, []int{39}
 }
 
 func (m *Money) XXX_Unmarshal(b []byte) error {
@@ -932,7 +2332,7 @@ func (m *GetSupportedCurrenciesResponse) Reset()         { *m = GetSupportedCurr
 func (m *GetSupportedCurrenciesResponse) String() string { return proto.CompactTextString(m) }
 func (*GetSupportedCurrenciesResponse) ProtoMessage()    {}
 func (*GetSupportedCurrenciesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{19}
+	return fileDescriptor_ca53982754088a9d, []int{40}
 }
 
 func (m *GetSupportedCurrenciesResponse) XXX_Unmarshal(b []byte) error {
@@ -973,7 +2373,7 @@ func (m *CurrencyConversionRequest) Reset()         { *m = CurrencyConversionReq
 func (m *CurrencyConversionRequest) String() string { return proto.CompactTextString(m) }
 func (*CurrencyConversionRequest) ProtoMessage()    {}
 func (*CurrencyConversionRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{20}
+	return fileDescriptor_ca53982754088a9d, []int{41}
 }
 
 func (m *CurrencyConversionRequest) XXX_Unmarshal(b []byte) error {
@@ -1022,7 +2422,7 @@ func (m *CreditCardInfo) Reset()         { *m = CreditCardInfo{} }
 func (m *CreditCardInfo) String() string { return proto.CompactTextString(m) }
 func (*CreditCardInfo) ProtoMessage()    {}
 func (*CreditCardInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{21}
+	return fileDescriptor_ca53982754088a9d, []int{42}
 }
 
 func (m *CreditCardInfo) XXX_Unmarshal(b []byte) error {
@@ -1083,7 +2483,7 @@ func (m *ChargeRequest) Reset()         { *m = ChargeRequest{} }
 func (m *ChargeRequest) String() string { return proto.CompactTextString(m) }
 func (*ChargeRequest) ProtoMessage()    {}
 func (*ChargeRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{22}
+	return fileDescriptor_ca53982754088a9d, []int{43}
 }
 
 func (m *ChargeRequest) XXX_Unmarshal(b []byte) error {
@@ -1129,7 +2529,7 @@ func (m *ChargeResponse) Reset()         { *m = ChargeResponse{} }
 func (m *ChargeResponse) String() string { return proto.CompactTextString(m) }
 func (*ChargeResponse) ProtoMessage()    {}
 func (*ChargeResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{23}
+	return fileDescriptor_ca53982754088a9d, []int{44}
 }
 
 func (m *ChargeResponse) XXX_Unmarshal(b []byte) error {
@@ -1169,7 +2569,7 @@ func (m *OrderItem) Reset()         { *m = OrderItem{} }
 func (m *OrderItem) String() string { return proto.CompactTextString(m) }
 func (*OrderItem) ProtoMessage()    {}
 func (*OrderItem) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{24}
+	return fileDescriptor_ca53982754088a9d, []int{45}
 }
 
 func (m *OrderItem) XXX_Unmarshal(b []byte) error {
@@ -1219,7 +2619,7 @@ func (m *OrderResult) Reset()         { *m = OrderResult{} }
 func (m *OrderResult) String() string { return proto.CompactTextString(m) }
 func (*OrderResult) ProtoMessage()    {}
 func (*OrderResult) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{25}
+	return fileDescriptor_ca53982754088a9d, []int{46}
 }
 
 func (m *OrderResult) XXX_Unmarshal(b []byte) error {
@@ -1287,7 +2687,7 @@ func (m *SendOrderConfirmationRequest) Reset()         { *m = SendOrderConfirmat
 func (m *SendOrderConfirmationRequest) String() string { return proto.CompactTextString(m) }
 func (*SendOrderConfirmationRequest) ProtoMessage()    {}
 func (*SendOrderConfirmationRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{26}
+	return fileDescriptor_ca53982754088a9d, []int{47}
 }
 
 func (m *SendOrderConfirmationRequest) XXX_Unmarshal(b []byte) error {
@@ -1337,7 +2737,7 @@ func (m *PlaceOrderRequest) Reset()         { *m = PlaceOrderRequest{} }
 func (m *PlaceOrderRequest) String() string { return proto.CompactTextString(m) }
 func (*PlaceOrderRequest) ProtoMessage()    {}
 func (*PlaceOrderRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{27}
+	return fileDescriptor_ca53982754088a9d, []int{48}
 }
 
 func (m *PlaceOrderRequest) XXX_Unmarshal(b []byte) error {
@@ -1404,7 +2804,7 @@ func (m *PlaceOrderResponse) Reset()         { *m = PlaceOrderResponse{} }
 func (m *PlaceOrderResponse) String() string { return proto.CompactTextString(m) }
 func (*PlaceOrderResponse) ProtoMessage()    {}
 func (*PlaceOrderResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{28}
+	return fileDescriptor_ca53982754088a9d, []int{49}
 }
 
 func (m *PlaceOrderResponse) XXX_Unmarshal(b []byte) error {
@@ -1444,7 +2844,7 @@ func (m *AdRequest) Reset()         { *m = AdRequest{} }
 func (m *AdRequest) String() string { return proto.CompactTextString(m) }
 func (*AdRequest) ProtoMessage()    {}
 func (*AdRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{29}
+	return fileDescriptor_ca53982754088a9d, []int{50}
 }
 
 func (m *AdRequest) XXX_Unmarshal(b []byte) error {
@@ -1483,7 +2883,7 @@ func (m *AdResponse) Reset()         { *m = AdResponse{} }
 func (m *AdResponse) String() string { return proto.CompactTextString(m) }
 func (*AdResponse) ProtoMessage()    {}
 func (*AdResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{30}
+	return fileDescriptor_ca53982754088a9d, []int{51}
 }
 
 func (m *AdResponse) XXX_Unmarshal(b []byte) error {
@@ -1525,7 +2925,7 @@ func (m *Ad) Reset()         { *m = Ad{} }
 func (m *Ad) String() string { return proto.CompactTextString(m) }
 func (*Ad) ProtoMessage()    {}
 func (*Ad) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ca53982754088a9d, []int{31}
+	return fileDescriptor_ca53982754088a9d, []int{52}
 }
 
 func (m *Ad) XXX_Unmarshal(b []byte) error {
@@ -1561,6 +2961,10 @@ func (m *Ad) GetText() string {
 }
 
 func init() {
+	proto.RegisterEnum("hipstershop.QuoteLineItemType", QuoteLineItemType_name, QuoteLineItemType_value)
+	proto.RegisterEnum("hipstershop.ShippingMethod", ShippingMethod_name, ShippingMethod_value)
+	proto.RegisterEnum("hipstershop.ServiceLevel", ServiceLevel_name, ServiceLevel_value)
+	proto.RegisterEnum("hipstershop.ShipmentStatus", ShipmentStatus_name, ShipmentStatus_value)
 	proto.RegisterType((*CartItem)(nil), "hipstershop.CartItem")
 	proto.RegisterType((*AddItemRequest)(nil), "hipstershop.AddItemRequest")
 	proto.RegisterType((*EmptyCartRequest)(nil), "hipstershop.EmptyCartRequest")
@@ -1575,9 +2979,30 @@ func init() {
 	proto.RegisterType((*SearchProductsRequest)(nil), "hipstershop.SearchProductsRequest")
 	proto.RegisterType((*SearchProductsResponse)(nil), "hipstershop.SearchProductsResponse")
 	proto.RegisterType((*GetQuoteRequest)(nil), "hipstershop.GetQuoteRequest")
+	proto.RegisterType((*ItemDimensions)(nil), "hipstershop.ItemDimensions")
+	proto.RegisterType((*Packaging)(nil), "hipstershop.Packaging")
 	proto.RegisterType((*GetQuoteResponse)(nil), "hipstershop.GetQuoteResponse")
+	proto.RegisterType((*QuoteLineItem)(nil), "hipstershop.QuoteLineItem")
+	proto.RegisterType((*GetBulkQuoteResponse)(nil), "hipstershop.GetBulkQuoteResponse")
 	proto.RegisterType((*ShipOrderRequest)(nil), "hipstershop.ShipOrderRequest")
 	proto.RegisterType((*ShipOrderResponse)(nil), "hipstershop.ShipOrderResponse")
+	proto.RegisterType((*ShipOrdersRequest)(nil), "hipstershop.ShipOrdersRequest")
+	proto.RegisterType((*ShipOrderResult)(nil), "hipstershop.ShipOrderResult")
+	proto.RegisterType((*ShipOrdersResponse)(nil), "hipstershop.ShipOrdersResponse")
+	proto.RegisterType((*StreamOrdersRequest)(nil), "hipstershop.StreamOrdersRequest")
+	proto.RegisterType((*StreamOrdersResponse)(nil), "hipstershop.StreamOrdersResponse")
+	proto.RegisterType((*GenerateLabelRequest)(nil), "hipstershop.GenerateLabelRequest")
+	proto.RegisterType((*GenerateLabelResponse)(nil), "hipstershop.GenerateLabelResponse")
+	proto.RegisterType((*ShippingOptions)(nil), "hipstershop.ShippingOptions")
+	proto.RegisterType((*GetDeliveryEstimateRequest)(nil), "hipstershop.GetDeliveryEstimateRequest")
+	proto.RegisterType((*GetDeliveryEstimateResponse)(nil), "hipstershop.GetDeliveryEstimateResponse")
+	proto.RegisterType((*CancelShipmentRequest)(nil), "hipstershop.CancelShipmentRequest")
+	proto.RegisterType((*CancelShipmentResponse)(nil), "hipstershop.CancelShipmentResponse")
+	proto.RegisterType((*GetTrackingStatusRequest)(nil), "hipstershop.GetTrackingStatusRequest")
+	proto.RegisterType((*GetTrackingStatusResponse)(nil), "hipstershop.GetTrackingStatusResponse")
+	proto.RegisterType((*GetShipmentHistoryRequest)(nil), "hipstershop.GetShipmentHistoryRequest")
+	proto.RegisterType((*ShipmentHistoryEvent)(nil), "hipstershop.ShipmentHistoryEvent")
+	proto.RegisterType((*GetShipmentHistoryResponse)(nil), "hipstershop.GetShipmentHistoryResponse")
 	proto.RegisterType((*Address)(nil), "hipstershop.Address")
 	proto.RegisterType((*Money)(nil), "hipstershop.Money")
 	proto.RegisterType((*GetSupportedCurrenciesResponse)(nil), "hipstershop.GetSupportedCurrenciesResponse")
@@ -1595,6 +3020,201 @@ func init() {
 	proto.RegisterType((*Ad)(nil), "hipstershop.Ad")
 }
 
+func init() { proto.RegisterFile("demo.proto", fileDescriptor_ca53982754088a9d) }
+
+var fileDescriptor_ca53982754088a9d = []byte{
+	// 3022 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x59, 0x4b, 0x73, 0xe3, 0xc6,
+	0xf1, 0x17, 0xf8, 0x14, 0x5b, 0x12, 0x45, 0xcd, 0x4a, 0x6b, 0x8a, 0xda, 0x97, 0xb0, 0x7f, 0xaf,
+	0xd7, 0x6b, 0x5b, 0xeb, 0xbf, 0xd6, 0xf1, 0xda, 0xb5, 0x8e, 0x1d, 0x9a, 0x84, 0x29, 0xc4, 0x7a,
+	0x19, 0xa4, 0x36, 0xbb, 0x65, 0x57, 0x50, 0x10, 0x30, 0x4b, 0xc1, 0x4b, 0x02, 0x5c, 0x60, 0x28,
+	0x2f, 0x7d, 0x49, 0x55, 0x72, 0xcc, 0x21, 0x87, 0x5c, 0x52, 0xa9, 0xca, 0x21, 0xa7, 0x54, 0x2a,
+	0xce, 0x39, 0x55, 0xb9, 0xe4, 0x9e, 0xaa, 0x1c, 0xf3, 0x15, 0xf2, 0x35, 0x92, 0x9a, 0x17, 0x08,
+	0x80, 0xa4, 0x28, 0x3b, 0xe5, 0xdc, 0x30, 0xd3, 0xbf, 0xee, 0xe9, 0xee, 0x19, 0xf4, 0x74, 0xf7,
+	0x00, 0x38, 0xb8, 0xef, 0xef, 0x0c, 0x02, 0x9f, 0xf8, 0x68, 0xe9, 0xcc, 0x1d, 0x84, 0x04, 0x07,
+	0xe1, 0x99, 0x3f, 0xa8, 0xdd, 0xec, 0xfa, 0x7e, 0xb7, 0x87, 0xef, 0x33, 0xd2, 0xe9, 0xf0, 0xd9,
+	0x7d, 0xe2, 0xf6, 0x71, 0x48, 0xac, 0xfe, 0x80, 0xa3, 0x55, 0x0d, 0x16, 0x1b, 0x56, 0x40, 0x74,
+	0x82, 0xfb, 0xe8, 0x3a, 0xc0, 0x20, 0xf0, 0x9d, 0xa1, 0x4d, 0x4c, 0xd7, 0xa9, 0x2a, 0xb7, 0x94,
+	0xbb, 0x25, 0xa3, 0x24, 0x66, 0x74, 0x07, 0xd5, 0x60, 0xf1, 0xc5, 0xd0, 0xf2, 0x88, 0x4b, 0x46,
+	0xd5, 0xcc, 0x2d, 0xe5, 0x6e, 0xde, 0x88, 0xc6, 0x6a, 0x07, 0xca, 0x75, 0xc7, 0xa1, 0x52, 0x0c,
+	0xfc, 0x62, 0x88, 0x43, 0x82, 0x5e, 0x81, 0xe2, 0x30, 0xc4, 0xc1, 0x58, 0x52, 0x81, 0x0e, 0x75,
+	0x07, 0xbd, 0x0e, 0x39, 0x97, 0xe0, 0x3e, 0x13, 0xb1, 0xb4, 0xbb, 0xb1, 0x13, 0x53, 0x77, 0x47,
+	0xaa, 0x62, 0x30, 0x88, 0xfa, 0x06, 0x54, 0xb4, 0xfe, 0x80, 0x8c, 0xe8, 0xf4, 0x3c, 0xb9, 0xea,
+	0xeb, 0x50, 0x6e, 0x61, 0x72, 0x29, 0xe8, 0x3e, 0xe4, 0x28, 0x6e, 0xb6, 0x8e, 0x6f, 0x40, 0x9e,
+	0x2a, 0x10, 0x56, 0x33, 0xb7, 0xb2, 0xb3, 0x95, 0xe4, 0x18, 0xb5, 0x08, 0x79, 0xa6, 0xa5, 0xfa,
+	0x18, 0x6a, 0xfb, 0x6e, 0x48, 0x0c, 0x6c, 0xfb, 0xfd, 0x3e, 0xf6, 0x1c, 0x8b, 0xb8, 0xbe, 0x17,
+	0xce, 0x75, 0xc8, 0x4d, 0x58, 0x1a, 0xbb, 0x9d, 0x2f, 0x59, 0x32, 0x20, 0xf2, 0x7b, 0xa8, 0x7e,
+	0x08, 0x5b, 0x53, 0xe5, 0x86, 0x03, 0xdf, 0x0b, 0x71, 0x9a, 0x5f, 0x99, 0xe0, 0xff, 0xab, 0x02,
+	0xc5, 0x63, 0x3e, 0x44, 0x65, 0xc8, 0x44, 0x0a, 0x64, 0x5c, 0x07, 0x21, 0xc8, 0x79, 0x56, 0x1f,
+	0xb3, 0xdd, 0x28, 0x19, 0xec, 0x1b, 0xdd, 0x82, 0x25, 0x07, 0x87, 0x76, 0xe0, 0x0e, 0xe8, 0x42,
+	0xd5, 0x2c, 0x23, 0xc5, 0xa7, 0x50, 0x15, 0x8a, 0x03, 0xd7, 0x26, 0xc3, 0x00, 0x57, 0x73, 0x8c,
+	0x2a, 0x87, 0xe8, 0x3e, 0x94, 0x06, 0x81, 0x6b, 0x63, 0x73, 0x18, 0x3a, 0xd5, 0x3c, 0xdb, 0x62,
+	0x94, 0xf0, 0xde, 0x81, 0xef, 0xe1, 0x91, 0xb1, 0xc8, 0x40, 0x27, 0xa1, 0x83, 0x6e, 0x00, 0xd8,
+	0x16, 0xc1, 0x5d, 0x3f, 0x70, 0x71, 0x58, 0x2d, 0x70, 0xe5, 0xc7, 0x33, 0xea, 0x1e, 0xac, 0x53,
+	0xe3, 0x85, 0xfe, 0x63, 0xab, 0xdf, 0x86, 0x45, 0x61, 0x22, 0x37, 0x79, 0x69, 0x77, 0x3d, 0xb1,
+	0x8e, 0x60, 0x30, 0x22, 0x94, 0x7a, 0x1b, 0xd6, 0x5a, 0x58, 0x0a, 0x92, 0xbb, 0x92, 0xf2, 0x87,
+	0xfa, 0x16, 0x6c, 0xb4, 0xb1, 0x15, 0xd8, 0x67, 0xe3, 0x05, 0x39, 0x70, 0x1d, 0xf2, 0x2f, 0x86,
+	0x38, 0x18, 0x09, 0x2c, 0x1f, 0xa8, 0x7b, 0x70, 0x35, 0x0d, 0x17, 0xfa, 0xed, 0x40, 0x31, 0xc0,
+	0xe1, 0xb0, 0x37, 0x47, 0x3d, 0x09, 0x52, 0xff, 0x91, 0x81, 0xd5, 0x16, 0x26, 0x9f, 0x0d, 0x7d,
+	0x82, 0xe5, 0x9a, 0x3b, 0x50, 0xb4, 0x1c, 0x27, 0xc0, 0x61, 0xc8, 0x56, 0x4d, 0xcb, 0xa8, 0x73,
+	0x9a, 0x21, 0x41, 0xdf, 0xea, 0xd8, 0xa2, 0x07, 0x50, 0xe8, 0x63, 0x72, 0xe6, 0x3b, 0x6c, 0x83,
+	0xcb, 0xbb, 0x5b, 0x09, 0x74, 0xfb, 0xcc, 0x1d, 0x0c, 0x5c, 0xaf, 0x7b, 0xc0, 0x20, 0x86, 0x80,
+	0xa2, 0x77, 0xa1, 0xe8, 0xb3, 0x23, 0x10, 0xb2, 0x8d, 0x5f, 0xda, 0xbd, 0x36, 0x95, 0xeb, 0x88,
+	0x63, 0x0c, 0x09, 0x46, 0x0f, 0x60, 0xc9, 0x0f, 0x1c, 0x1c, 0x98, 0xe7, 0x56, 0x6f, 0x88, 0x2f,
+	0x38, 0x18, 0xc0, 0x60, 0x8f, 0x29, 0x0a, 0x3d, 0x02, 0x70, 0xdc, 0x3e, 0xf6, 0x42, 0xb6, 0x5e,
+	0x81, 0xd9, 0x94, 0xd4, 0x92, 0xda, 0xd3, 0x8c, 0x20, 0x46, 0x0c, 0xae, 0xfe, 0x41, 0x81, 0x72,
+	0x92, 0x3c, 0x2f, 0xbe, 0x6d, 0x41, 0xa9, 0x87, 0xbd, 0x2e, 0x39, 0x33, 0x6d, 0x1e, 0x9d, 0x14,
+	0x63, 0x91, 0x4f, 0x34, 0xfa, 0x68, 0x13, 0x16, 0xbf, 0x72, 0x1d, 0x4e, 0xcb, 0x32, 0x5a, 0x91,
+	0x8d, 0x1b, 0x7d, 0xca, 0x77, 0x86, 0xdd, 0xee, 0x19, 0xa1, 0xb4, 0x1c, 0xe7, 0xe3, 0x13, 0x8d,
+	0x3e, 0xda, 0x86, 0xe5, 0xaf, 0x38, 0xb1, 0x1b, 0x58, 0xfd, 0x90, 0x59, 0x9e, 0x37, 0x96, 0xf8,
+	0x5c, 0x8b, 0x4e, 0xa9, 0x7f, 0x53, 0xa0, 0x74, 0x6c, 0xd9, 0xcf, 0xad, 0xae, 0xeb, 0x75, 0xe9,
+	0x39, 0x3b, 0xf5, 0x5f, 0x62, 0xf9, 0x1f, 0xf3, 0x01, 0xda, 0x81, 0x2b, 0x96, 0x4d, 0x86, 0x56,
+	0xcf, 0x4c, 0x48, 0xe3, 0x61, 0x78, 0x8d, 0x93, 0x7e, 0x32, 0x96, 0x89, 0xde, 0x83, 0x6a, 0xe4,
+	0x8b, 0x34, 0x53, 0x96, 0x31, 0x5d, 0x8d, 0xd1, 0xe3, 0x9c, 0xbb, 0xb0, 0x71, 0xea, 0xf6, 0x7a,
+	0xd6, 0x69, 0x0f, 0x27, 0xd9, 0x72, 0x8c, 0xed, 0x8a, 0x24, 0xc6, 0x78, 0xd4, 0x3f, 0x65, 0xa0,
+	0x32, 0x3e, 0xbb, 0xe2, 0x07, 0x78, 0x0b, 0x16, 0x6d, 0x3f, 0x24, 0x2c, 0x10, 0x28, 0x33, 0xf7,
+	0xbb, 0x48, 0x31, 0x34, 0x0e, 0x6c, 0xd2, 0xdb, 0xc5, 0x27, 0x98, 0x6e, 0x0d, 0x0f, 0x46, 0x45,
+	0x36, 0xd6, 0x1d, 0xf4, 0x3e, 0x00, 0x7e, 0x39, 0x70, 0x03, 0x1c, 0x9a, 0x16, 0x61, 0xea, 0x2f,
+	0xed, 0xd6, 0x76, 0xf8, 0xcd, 0xb6, 0x23, 0x6f, 0xb6, 0x9d, 0x8e, 0xbc, 0xd9, 0x8c, 0x92, 0x40,
+	0xd7, 0x09, 0x65, 0xed, 0xb9, 0x1e, 0x36, 0xf9, 0x6f, 0x91, 0x63, 0x47, 0xa8, 0x96, 0x50, 0x83,
+	0x29, 0xbd, 0xef, 0x7a, 0x98, 0xfd, 0x1b, 0xa5, 0x9e, 0xf8, 0x0a, 0xe9, 0xce, 0x0d, 0x02, 0xbf,
+	0xef, 0xd3, 0x03, 0x4c, 0x95, 0xca, 0xf3, 0x30, 0x18, 0xcd, 0xe9, 0x0e, 0x7a, 0x07, 0x4a, 0x03,
+	0xb9, 0x71, 0xd5, 0x02, 0xd3, 0xeb, 0x6a, 0xf2, 0x2f, 0x97, 0x54, 0x63, 0x0c, 0x54, 0x7f, 0xa3,
+	0xc0, 0x4a, 0x62, 0x55, 0xb4, 0x0b, 0x39, 0x32, 0x1a, 0x60, 0xe6, 0xa6, 0xf2, 0xee, 0x8d, 0xd9,
+	0xfa, 0x75, 0x46, 0x03, 0x6c, 0x30, 0x6c, 0x3a, 0x48, 0x67, 0x26, 0x83, 0xf4, 0xff, 0x03, 0x58,
+	0x7d, 0x7f, 0xe8, 0xf1, 0x2d, 0xc8, 0xce, 0xdc, 0x82, 0x12, 0x47, 0x9d, 0x84, 0x8e, 0xfa, 0x5b,
+	0x05, 0xd6, 0x5b, 0x98, 0x7c, 0x3c, 0xec, 0x3d, 0xff, 0xaf, 0x36, 0xb3, 0x06, 0x8b, 0xdc, 0x5e,
+	0x2c, 0xcf, 0x68, 0x34, 0x46, 0x0f, 0x61, 0x45, 0x7c, 0x9b, 0x14, 0x4e, 0xcf, 0x63, 0x76, 0x86,
+	0xbc, 0x65, 0x01, 0x6c, 0x50, 0x9c, 0xfa, 0x6f, 0x05, 0x2a, 0x34, 0xc0, 0x1c, 0xd1, 0x08, 0xf1,
+	0x3f, 0x09, 0x91, 0xf1, 0x33, 0x99, 0x4d, 0x9e, 0xc9, 0xef, 0x1a, 0x08, 0x93, 0x31, 0x2d, 0xff,
+	0xed, 0x62, 0x9a, 0x0d, 0x6b, 0x31, 0x07, 0x8c, 0xaf, 0x7f, 0x12, 0x58, 0xf6, 0x73, 0xd7, 0xeb,
+	0x8e, 0xc3, 0x1a, 0xc8, 0x29, 0xdd, 0x49, 0xec, 0x5d, 0x66, 0xee, 0xde, 0xa9, 0x3f, 0x8e, 0x2d,
+	0x12, 0xdd, 0x7e, 0x3f, 0x80, 0x02, 0x0b, 0xcc, 0xf2, 0x32, 0xbb, 0x3e, 0x61, 0x6d, 0x7c, 0x57,
+	0x0c, 0x01, 0x56, 0xbf, 0x80, 0xd5, 0xb8, 0xc2, 0xc3, 0x1e, 0x99, 0xaf, 0x2e, 0x82, 0x9c, 0xed,
+	0x3b, 0x58, 0x9c, 0x1b, 0xf6, 0x4d, 0x83, 0x22, 0x0e, 0x02, 0x3f, 0x10, 0xbb, 0xc0, 0x07, 0xea,
+	0x3e, 0xa0, 0xb8, 0xa6, 0xc2, 0x1f, 0xef, 0xa6, 0x2f, 0xde, 0x6b, 0xb3, 0x74, 0xa5, 0xa0, 0xf1,
+	0x05, 0xfc, 0x05, 0x5c, 0x69, 0x93, 0x00, 0x5b, 0xfd, 0xa4, 0xe5, 0x0f, 0x20, 0xcf, 0x8c, 0x11,
+	0xc7, 0x6b, 0x8e, 0xe1, 0x1c, 0x8b, 0x2a, 0x90, 0x0d, 0xf0, 0x33, 0xf1, 0x53, 0xd2, 0x4f, 0x95,
+	0xc0, 0x7a, 0x52, 0xba, 0xd0, 0x76, 0x1d, 0xf2, 0xae, 0xe7, 0xe0, 0x97, 0x4c, 0x7c, 0xde, 0xe0,
+	0x83, 0x49, 0x7e, 0xf4, 0x0e, 0x14, 0xb8, 0xa2, 0xe2, 0x47, 0xbe, 0xd8, 0x28, 0x81, 0x55, 0x1f,
+	0xd2, 0xdf, 0xd9, 0xc3, 0x81, 0x45, 0xf0, 0xbe, 0x75, 0x8a, 0x7b, 0xd2, 0xa8, 0x79, 0x9b, 0xa0,
+	0xbe, 0x80, 0x8d, 0x14, 0xe3, 0x65, 0x4f, 0xdb, 0x36, 0x2c, 0xdb, 0xbe, 0x47, 0xb0, 0x47, 0x4c,
+	0x16, 0xd3, 0x44, 0x60, 0x12, 0x73, 0x34, 0x80, 0x51, 0x9b, 0x7b, 0x54, 0x28, 0x33, 0x65, 0xd9,
+	0xe0, 0x03, 0xf5, 0x9f, 0x0a, 0xac, 0xa6, 0x7e, 0x1b, 0xf4, 0x21, 0xac, 0x84, 0x38, 0x38, 0xa7,
+	0xf9, 0x64, 0x0f, 0x9f, 0xe3, 0x9e, 0x88, 0x90, 0x9b, 0x49, 0xe3, 0x39, 0x62, 0x9f, 0x02, 0x8c,
+	0xe5, 0x30, 0x36, 0x42, 0xef, 0x43, 0xd9, 0xc1, 0x76, 0xcf, 0x0a, 0xb0, 0x23, 0x32, 0x8f, 0xd9,
+	0x3f, 0xc0, 0x8a, 0x44, 0xf2, 0xe4, 0xe3, 0x2d, 0x40, 0xa1, 0xdb, 0xf5, 0x2c, 0x9a, 0xd5, 0x9a,
+	0x01, 0x7e, 0x31, 0x74, 0x03, 0xcc, 0xa3, 0xc0, 0xa2, 0xb1, 0x16, 0x51, 0x0c, 0x41, 0xa0, 0x19,
+	0xb1, 0xeb, 0x85, 0x43, 0x8a, 0xc9, 0x31, 0x8c, 0x1c, 0xd2, 0xec, 0xbb, 0xd6, 0xc2, 0xa4, 0x89,
+	0x7b, 0xee, 0x39, 0x0e, 0x46, 0x5a, 0x48, 0xdc, 0xbe, 0xf5, 0xdd, 0x73, 0xbc, 0x71, 0xda, 0x96,
+	0xb9, 0x7c, 0xda, 0xf6, 0x10, 0x4a, 0xe1, 0x99, 0x3b, 0x30, 0x1d, 0x8b, 0xe0, 0x4b, 0x5c, 0xa0,
+	0x8b, 0x14, 0xdc, 0xb4, 0x08, 0x56, 0x7f, 0xaf, 0xc0, 0xd6, 0x54, 0xe5, 0xc5, 0x71, 0xd0, 0x01,
+	0x61, 0x31, 0xe7, 0x98, 0x8e, 0x40, 0x55, 0x95, 0xb9, 0x2b, 0xac, 0x45, 0x5c, 0x52, 0x34, 0xba,
+	0x0d, 0x2b, 0xa7, 0xc3, 0xd0, 0xf5, 0x70, 0x18, 0x9a, 0x8e, 0x35, 0x92, 0x17, 0xc7, 0xb2, 0x9c,
+	0x6c, 0x5a, 0xa3, 0x90, 0x06, 0x87, 0xaf, 0x7d, 0x0f, 0x8b, 0x38, 0xc0, 0xbe, 0xd5, 0xf7, 0x60,
+	0xa3, 0x61, 0x79, 0x36, 0xee, 0x51, 0xe3, 0xfb, 0xd8, 0x23, 0x97, 0x3e, 0xe5, 0x1e, 0x5c, 0x4d,
+	0x73, 0x5e, 0xf6, 0x98, 0x3f, 0x80, 0x42, 0x48, 0x2c, 0x32, 0x0c, 0x67, 0x6e, 0x03, 0x95, 0xd7,
+	0x66, 0x10, 0x43, 0x40, 0xd5, 0x47, 0x50, 0x6d, 0x61, 0xd2, 0x11, 0x52, 0x04, 0xf1, 0xb2, 0xca,
+	0x7e, 0xa3, 0xc0, 0xe6, 0x14, 0xee, 0xef, 0x53, 0x61, 0x9a, 0x3e, 0x0d, 0x07, 0x0e, 0xdb, 0xdc,
+	0xcb, 0x65, 0x5e, 0x02, 0x5d, 0x27, 0xea, 0x07, 0x4c, 0x5b, 0x29, 0x77, 0xcf, 0x0d, 0x89, 0x1f,
+	0x8c, 0x2e, 0x6d, 0xec, 0xaf, 0x33, 0xb0, 0x9e, 0xe2, 0xd5, 0xce, 0xb1, 0x47, 0x68, 0x66, 0x11,
+	0x52, 0x21, 0x9e, 0xcd, 0xd3, 0xa5, 0xac, 0x11, 0x8d, 0xe9, 0x75, 0x8d, 0x29, 0x28, 0x96, 0x42,
+	0xb2, 0xb1, 0xee, 0xa0, 0x26, 0xac, 0x0e, 0x02, 0x7c, 0xee, 0xfa, 0xc3, 0xd0, 0x14, 0x6e, 0xc8,
+	0xce, 0x77, 0x43, 0x59, 0xf2, 0xf0, 0x71, 0xcc, 0x87, 0xb9, 0xcb, 0xfb, 0x70, 0x07, 0x72, 0xb4,
+	0xe9, 0x52, 0xcd, 0xcf, 0xf5, 0x1e, 0xc3, 0x51, 0x2b, 0xa8, 0x23, 0x58, 0xd2, 0x51, 0xe0, 0x56,
+	0xb0, 0xb1, 0xee, 0xa8, 0x7f, 0xe6, 0xa1, 0x64, 0xc2, 0xa9, 0xdf, 0xf3, 0x19, 0x28, 0x30, 0x2f,
+	0xca, 0x44, 0x6d, 0x7b, 0x2a, 0x53, 0x7c, 0x93, 0x0c, 0xc1, 0xa0, 0xfe, 0x4a, 0x81, 0xa2, 0x08,
+	0x60, 0xe8, 0x55, 0x28, 0x87, 0x24, 0xc0, 0x98, 0x98, 0xf1, 0x70, 0x57, 0x32, 0x56, 0xf8, 0xac,
+	0x84, 0xd1, 0xdb, 0x5f, 0x36, 0x98, 0x4a, 0x06, 0xfb, 0xa6, 0xf7, 0x05, 0xd5, 0x45, 0xfe, 0xf5,
+	0x7c, 0x40, 0x23, 0xae, 0x4d, 0xf3, 0xd6, 0x60, 0x24, 0x7b, 0x10, 0x62, 0x48, 0x3d, 0xf8, 0xb5,
+	0x3b, 0x30, 0x59, 0x16, 0xc1, 0xeb, 0xad, 0xe2, 0xd7, 0xee, 0xa0, 0xe1, 0x3b, 0x58, 0x7d, 0x02,
+	0x79, 0x16, 0xed, 0x69, 0xb4, 0xb1, 0x87, 0x41, 0x80, 0x3d, 0x7b, 0xc4, 0x81, 0x5c, 0x9b, 0x65,
+	0x39, 0xd9, 0x10, 0x69, 0xc7, 0xd0, 0x73, 0x09, 0x77, 0x57, 0xd6, 0xe0, 0x03, 0x3a, 0xeb, 0x59,
+	0x9e, 0x2f, 0x0b, 0x29, 0x3e, 0x50, 0x5b, 0x70, 0x83, 0x6e, 0xcd, 0x70, 0x30, 0xf0, 0x03, 0x82,
+	0x9d, 0x06, 0x97, 0xe3, 0xe2, 0xf1, 0x2f, 0xfa, 0x2a, 0x94, 0x13, 0x4b, 0xca, 0x12, 0x6f, 0x25,
+	0xbe, 0x26, 0xcd, 0x43, 0x36, 0x1b, 0xd1, 0x84, 0x77, 0x8e, 0x03, 0x9a, 0xfb, 0xc9, 0x1f, 0xe7,
+	0x0e, 0xe4, 0x9e, 0x05, 0x7e, 0xff, 0x82, 0x1c, 0x9c, 0xd1, 0x69, 0xb3, 0x89, 0xf8, 0x66, 0x94,
+	0x47, 0x95, 0x8c, 0x02, 0xf1, 0x99, 0x03, 0xfe, 0xa5, 0x40, 0xb9, 0x11, 0x60, 0xc7, 0xa5, 0x9d,
+	0x32, 0x47, 0xf7, 0x9e, 0xf9, 0xe8, 0x4d, 0x40, 0x36, 0x9b, 0x31, 0x6d, 0x2b, 0x70, 0x4c, 0x6f,
+	0xd8, 0x3f, 0x15, 0xe9, 0x4e, 0xc9, 0xa8, 0xd8, 0x11, 0xf6, 0x90, 0xcd, 0xa3, 0x3b, 0xb0, 0x1a,
+	0x47, 0xdb, 0xe7, 0xe7, 0x22, 0x50, 0xaf, 0x8c, 0xa1, 0x8d, 0xf3, 0x73, 0xf4, 0x43, 0xd8, 0x8a,
+	0xe3, 0x58, 0x49, 0xc6, 0x1a, 0x57, 0xe6, 0x08, 0x5b, 0x81, 0xf0, 0x5d, 0x75, 0xcc, 0xa3, 0x45,
+	0x80, 0xa7, 0xd8, 0x0a, 0xd0, 0x47, 0x70, 0x6d, 0x06, 0x7b, 0xdf, 0xf7, 0xc8, 0x99, 0xa8, 0x46,
+	0x37, 0xa7, 0xf1, 0x1f, 0x50, 0x80, 0x3a, 0x82, 0x95, 0xc6, 0x99, 0x15, 0x74, 0xa3, 0x8b, 0xf6,
+	0x1e, 0x14, 0x78, 0xa1, 0x73, 0x81, 0xf3, 0x04, 0x02, 0x7d, 0x00, 0x4b, 0xb1, 0xd5, 0x45, 0xd2,
+	0x90, 0xfc, 0x5b, 0x92, 0x4e, 0x34, 0x60, 0xac, 0x89, 0xfa, 0x10, 0xca, 0x72, 0xe9, 0xf1, 0xd6,
+	0x93, 0xc0, 0xf2, 0x42, 0xcb, 0x96, 0xd5, 0xa4, 0x38, 0xfc, 0xb1, 0x59, 0xdd, 0x51, 0x7f, 0x0a,
+	0x25, 0x96, 0xc5, 0xb1, 0xa2, 0x50, 0xf6, 0x49, 0x95, 0xb9, 0x7d, 0x52, 0x7a, 0x2a, 0x68, 0xf6,
+	0x7e, 0x41, 0x72, 0xc3, 0xe8, 0xea, 0xcf, 0x33, 0xb0, 0x14, 0xcf, 0xc5, 0x37, 0x61, 0x91, 0x77,
+	0x65, 0x22, 0x85, 0x8a, 0x6c, 0xac, 0x3b, 0xe8, 0x6d, 0x58, 0x0f, 0x45, 0x2e, 0x61, 0xc6, 0x83,
+	0x0a, 0x3f, 0x4d, 0x48, 0xd2, 0x3a, 0xe3, 0xe0, 0xf2, 0x10, 0x56, 0x22, 0x0e, 0xa6, 0xcd, 0xec,
+	0x8a, 0x73, 0x59, 0x02, 0x69, 0x61, 0x87, 0x3e, 0x82, 0x4a, 0xc4, 0x28, 0x63, 0x43, 0xee, 0x82,
+	0x54, 0x68, 0x55, 0xa2, 0xc5, 0x04, 0x7a, 0x53, 0xd6, 0x74, 0xbc, 0x9c, 0x4a, 0x96, 0xe0, 0x91,
+	0x43, 0x65, 0xbb, 0xd6, 0x81, 0x6b, 0x6d, 0xec, 0x39, 0x6c, 0xbe, 0xe1, 0x7b, 0xcf, 0xdc, 0xa0,
+	0xcf, 0x8e, 0x4d, 0xac, 0xd1, 0x87, 0xfb, 0x96, 0xdb, 0x93, 0x8d, 0x3e, 0x36, 0x40, 0x3b, 0xb2,
+	0x0c, 0xe0, 0x3e, 0xae, 0x4e, 0xae, 0x21, 0x52, 0x6f, 0x0e, 0xa3, 0xd9, 0xec, 0xda, 0x71, 0xcf,
+	0xb2, 0x71, 0xa2, 0x5a, 0x9d, 0xd9, 0x03, 0xbe, 0x0d, 0x2b, 0x8c, 0x20, 0x43, 0x81, 0xf0, 0xf3,
+	0x32, 0x9d, 0x94, 0xd1, 0x20, 0x9e, 0x2a, 0x66, 0x2f, 0x93, 0x2a, 0x46, 0x96, 0xe4, 0xe3, 0x96,
+	0xa4, 0xce, 0x76, 0xe1, 0xdb, 0x9d, 0xed, 0x26, 0xa0, 0xb8, 0x59, 0x51, 0xb3, 0x33, 0x51, 0x24,
+	0xcd, 0xf5, 0xce, 0x0e, 0x94, 0xea, 0x8e, 0x74, 0x8a, 0xac, 0x18, 0x5e, 0x12, 0xf3, 0x39, 0x1e,
+	0xc9, 0xa8, 0xb8, 0x24, 0xe6, 0x3e, 0xc5, 0xa3, 0x50, 0xbd, 0x0f, 0x50, 0x77, 0xa2, 0xd5, 0xb6,
+	0x21, 0x6b, 0x39, 0xb2, 0xba, 0x5b, 0x4d, 0xf9, 0xc0, 0xa0, 0x34, 0xf5, 0x11, 0x64, 0xea, 0xac,
+	0x16, 0xa1, 0x9a, 0x07, 0xd8, 0x26, 0xe6, 0x30, 0x90, 0x3b, 0xba, 0x24, 0xe7, 0x4e, 0x82, 0x1e,
+	0xbd, 0x6f, 0xe8, 0x2a, 0xf2, 0xbe, 0xa1, 0xdf, 0xf7, 0xfe, 0x98, 0x85, 0xb5, 0x89, 0xb6, 0x0b,
+	0xfa, 0x3f, 0xb8, 0xf5, 0xd9, 0xc9, 0x51, 0x47, 0x33, 0xf7, 0xf5, 0x43, 0xcd, 0xd4, 0x3b, 0xda,
+	0x81, 0xd9, 0x79, 0x7a, 0xac, 0x99, 0x27, 0x87, 0xed, 0x63, 0xad, 0xa1, 0x7f, 0xa2, 0x6b, 0xcd,
+	0xca, 0x02, 0x52, 0xe1, 0xc6, 0x54, 0xd4, 0xc7, 0xf5, 0xb6, 0x66, 0x1a, 0xf5, 0x8e, 0x56, 0x51,
+	0xd0, 0x1d, 0x50, 0xa7, 0x62, 0xda, 0x9a, 0xf1, 0x58, 0x6f, 0x68, 0xe6, 0xbe, 0xf6, 0x58, 0xdb,
+	0xaf, 0x64, 0x66, 0xca, 0x6a, 0xeb, 0xad, 0xc3, 0x7a, 0xe7, 0xc4, 0xd0, 0x2a, 0xd9, 0x99, 0x18,
+	0xfd, 0xb0, 0x7d, 0x62, 0xd4, 0x0f, 0x1b, 0x5a, 0x25, 0x87, 0x5e, 0x83, 0xdb, 0x53, 0x31, 0x9f,
+	0x9c, 0x68, 0xfb, 0x66, 0xfb, 0xc4, 0x68, 0xec, 0xd5, 0x8d, 0x96, 0x56, 0xc9, 0xa3, 0x6b, 0x50,
+	0x9d, 0x0a, 0xec, 0xd4, 0x9f, 0x54, 0x0a, 0x33, 0xc5, 0x1c, 0x6b, 0xf5, 0x4f, 0x63, 0x62, 0x8a,
+	0x33, 0x3d, 0x65, 0x68, 0x07, 0x74, 0xb6, 0x6e, 0x68, 0xf5, 0xca, 0x22, 0xda, 0x86, 0xeb, 0x53,
+	0x51, 0x4d, 0xbd, 0xdd, 0x38, 0x3a, 0x39, 0xec, 0x54, 0x4a, 0x17, 0x41, 0x3a, 0xcc, 0x36, 0xb8,
+	0xf7, 0x4b, 0x05, 0xca, 0xc9, 0xa2, 0x07, 0xdd, 0x84, 0xad, 0xf6, 0x9e, 0x7e, 0x7c, 0xac, 0x1f,
+	0xb6, 0xcc, 0x03, 0xad, 0xb3, 0x77, 0xd4, 0x4c, 0xed, 0xd1, 0x35, 0xa8, 0xa6, 0x01, 0x54, 0x5e,
+	0xb3, 0x6e, 0x34, 0x2b, 0x0a, 0xda, 0x82, 0x57, 0xd2, 0x54, 0xed, 0xc9, 0xb1, 0xa1, 0xb5, 0xdb,
+	0x95, 0x0c, 0xba, 0x0e, 0x9b, 0x69, 0xe2, 0xd1, 0x63, 0xcd, 0x38, 0xd4, 0x5b, 0x7b, 0x9d, 0x4a,
+	0xf6, 0xde, 0xcf, 0x60, 0x39, 0x5e, 0x8d, 0x32, 0x78, 0x7c, 0x53, 0x53, 0x8a, 0x6c, 0xc2, 0x46,
+	0x92, 0xac, 0x35, 0x8e, 0x0e, 0x8f, 0x0e, 0x9e, 0x56, 0x14, 0x54, 0x83, 0xab, 0x49, 0x52, 0xa4,
+	0x61, 0x66, 0x92, 0xed, 0xd8, 0xd0, 0x0e, 0xf4, 0x93, 0x83, 0x4a, 0xf6, 0xde, 0x37, 0xc2, 0x1d,
+	0xe3, 0x3c, 0x4e, 0xba, 0xe3, 0x40, 0x3b, 0xec, 0x50, 0x21, 0x9d, 0x93, 0x76, 0x4a, 0x0b, 0x61,
+	0x70, 0x1c, 0xd0, 0x30, 0xb4, 0x7a, 0x47, 0xa3, 0xde, 0xb8, 0x01, 0xb5, 0x34, 0x51, 0x3f, 0x34,
+	0x3b, 0x46, 0xfd, 0xb0, 0xad, 0x77, 0xc6, 0x0e, 0x89, 0xd3, 0x9b, 0xda, 0xbe, 0xfe, 0x58, 0x33,
+	0xb4, 0x66, 0x25, 0x3b, 0x8d, 0xdc, 0xa0, 0x3b, 0xb7, 0xbf, 0xaf, 0x35, 0x2b, 0xb9, 0xdd, 0xbf,
+	0x2b, 0xb0, 0x44, 0xef, 0x32, 0xe1, 0x34, 0xf4, 0x01, 0xcb, 0x17, 0xd9, 0xf5, 0xb7, 0x95, 0x8e,
+	0x6d, 0xb1, 0xc7, 0xc5, 0x5a, 0xf2, 0x52, 0xe1, 0xaf, 0x6f, 0x0b, 0xe8, 0x11, 0x14, 0xc5, 0x0b,
+	0x60, 0x8a, 0x3b, 0xf9, 0x2e, 0x58, 0x5b, 0x9b, 0xb8, 0x4b, 0xd5, 0x05, 0xf4, 0x23, 0x28, 0x45,
+	0x6f, 0x8d, 0xe8, 0xfa, 0xa4, 0xfc, 0xb8, 0x80, 0xa9, 0xcb, 0xef, 0xfe, 0x42, 0x81, 0x8d, 0xe4,
+	0x1b, 0x9d, 0x34, 0xeb, 0x4b, 0xb8, 0x32, 0xe5, 0x01, 0x0f, 0xbd, 0x96, 0x10, 0x33, 0xfb, 0xe9,
+	0xb0, 0x76, 0x77, 0x3e, 0x90, 0x87, 0x46, 0xaa, 0x45, 0x06, 0x36, 0xc4, 0xe3, 0x52, 0xc3, 0x22,
+	0x56, 0xcf, 0xef, 0x4a, 0x2d, 0x5a, 0xb0, 0x1c, 0x7f, 0x49, 0x43, 0x53, 0xac, 0xa8, 0x6d, 0x4f,
+	0xac, 0x94, 0x7e, 0xd8, 0x52, 0x17, 0x50, 0x13, 0x60, 0xfc, 0x90, 0x86, 0x6e, 0xa4, 0x5d, 0x9d,
+	0x7c, 0x61, 0xab, 0x4d, 0x7d, 0xf7, 0x52, 0x17, 0xd0, 0xe7, 0x50, 0x4e, 0x3e, 0x9d, 0x21, 0x35,
+	0xd5, 0xd6, 0x99, 0xf2, 0x0c, 0x57, 0xbb, 0x7d, 0x21, 0x26, 0xf2, 0xc2, 0xef, 0x8a, 0xe3, 0x66,
+	0x92, 0xb4, 0x5f, 0x87, 0x45, 0xf9, 0x48, 0x81, 0xae, 0xa5, 0x95, 0x8e, 0xbf, 0xbb, 0xd5, 0xae,
+	0xcf, 0xa0, 0x46, 0x1e, 0xd8, 0x87, 0x52, 0xd4, 0x72, 0x43, 0x17, 0xb7, 0x04, 0x6b, 0x37, 0x66,
+	0x91, 0x23, 0x69, 0x9f, 0x43, 0x39, 0xd9, 0x86, 0x48, 0x79, 0x62, 0x6a, 0x77, 0xa3, 0x76, 0xfb,
+	0x42, 0x4c, 0x24, 0xfc, 0x08, 0x20, 0x5a, 0x33, 0x44, 0x33, 0x94, 0x89, 0xdc, 0x7b, 0x73, 0x26,
+	0x3d, 0x12, 0xf8, 0x04, 0x56, 0x12, 0xad, 0x41, 0xb4, 0x9d, 0xf2, 0xd6, 0x64, 0xbf, 0xb1, 0xa6,
+	0x5e, 0x04, 0x89, 0x24, 0x7f, 0x09, 0x57, 0xa6, 0xf4, 0x9a, 0x52, 0xbf, 0xc9, 0xec, 0x56, 0x5a,
+	0xed, 0xee, 0x7c, 0x60, 0xb4, 0x96, 0xc3, 0x1e, 0x83, 0x93, 0xcd, 0x14, 0xf4, 0x6a, 0x5a, 0xc0,
+	0xd4, 0x56, 0x4d, 0xed, 0xce, 0x3c, 0x58, 0xb4, 0x4a, 0x17, 0xd0, 0x64, 0xbd, 0x8e, 0x26, 0xf8,
+	0xa7, 0x77, 0x49, 0x6a, 0xaf, 0xcd, 0xc5, 0x45, 0x0b, 0xb5, 0x61, 0x39, 0xfe, 0x6e, 0x33, 0xe7,
+	0x7c, 0xa7, 0x77, 0x6c, 0xf2, 0xc1, 0x47, 0x5d, 0xb8, 0xab, 0xa0, 0xa7, 0xb0, 0x1c, 0xef, 0x59,
+	0xa3, 0x5b, 0xc9, 0xc3, 0x31, 0xd9, 0x2c, 0xaf, 0x6d, 0x5f, 0x80, 0x18, 0x0b, 0x7e, 0x5b, 0xd9,
+	0xfd, 0x8b, 0x02, 0xab, 0x32, 0xaf, 0x95, 0xff, 0xe7, 0xe7, 0x70, 0x75, 0x7a, 0x05, 0x3d, 0x35,
+	0x52, 0xbd, 0x31, 0xe1, 0x9c, 0xd9, 0xa5, 0xb7, 0xba, 0x80, 0x5a, 0x50, 0xe4, 0xd5, 0x34, 0x49,
+	0xb9, 0x7f, 0x66, 0xad, 0x5d, 0x9b, 0x52, 0xb9, 0xa8, 0x0b, 0xbb, 0x27, 0x50, 0x3e, 0xb6, 0x46,
+	0xec, 0x7e, 0x15, 0x7a, 0x37, 0xa0, 0xc0, 0xcb, 0x3d, 0x94, 0x7c, 0x59, 0x4c, 0x94, 0x9f, 0xb5,
+	0xad, 0xa9, 0xb4, 0x28, 0x60, 0x9d, 0xc1, 0xb2, 0x46, 0xd3, 0x73, 0x29, 0xf4, 0x09, 0x6c, 0x4c,
+	0xad, 0x52, 0xd0, 0xeb, 0xa9, 0x00, 0x38, 0xbb, 0x92, 0x99, 0x71, 0x4d, 0x9d, 0xc2, 0x6a, 0xe3,
+	0x0c, 0xdb, 0xcf, 0xfd, 0x61, 0x64, 0xc1, 0x11, 0xc0, 0x38, 0xa9, 0x4f, 0xc5, 0x88, 0x89, 0x22,
+	0xa6, 0x76, 0x73, 0x26, 0x3d, 0xb2, 0x66, 0x8f, 0xe6, 0xf7, 0x52, 0xfa, 0x23, 0x28, 0xb4, 0x68,
+	0x83, 0x27, 0x44, 0x57, 0xd3, 0xb9, 0xba, 0x90, 0xf8, 0xca, 0xc4, 0xbc, 0x94, 0x74, 0x5a, 0x60,
+	0x7d, 0xb2, 0x07, 0xff, 0x19, 0x00, 0x1e, 0x18, 0x4e, 0xf3, 0xe2, 0x24, 0x00, 0x00,
+}
+
 // Reference imports to suppress errors if they are not otherwise used.
 var _ context.Context
 var _ grpc.ClientConn
@@ -1933,6 +3553,19 @@ var _ProductCatalogService_serviceDesc = grpc.ServiceDesc{
 type ShippingServiceClient interface {
 	GetQuote(ctx context.Context, in *GetQuoteRequest, opts ...grpc.CallOption) (*GetQuoteResponse, error)
 	ShipOrder(ctx context.Context, in *ShipOrderRequest, opts ...grpc.CallOption) (*ShipOrderResponse, error)
+	CancelShipment(ctx context.Context, in *CancelShipmentRequest, opts ...grpc.CallOption) (*CancelShipmentResponse, error)
+	ShipOrders(ctx context.Context, in *ShipOrdersRequest, opts ...grpc.CallOption) (*ShipOrdersResponse, error)
+	GenerateLabel(ctx context.Context, in *GenerateLabelRequest, opts ...grpc.CallOption) (*GenerateLabelResponse, error)
+	GetDeliveryEstimate(ctx context.Context, in *GetDeliveryEstimateRequest, opts ...grpc.CallOption) (*GetDeliveryEstimateResponse, error)
+	GetTrackingStatus(ctx context.Context, in *GetTrackingStatusRequest, opts ...grpc.CallOption) (*GetTrackingStatusResponse, error)
+	// Returns every change of state of a shipment, oldest first.
+	GetShipmentHistory(ctx context.Context, in *GetShipmentHistoryRequest, opts ...grpc.CallOption) (*GetShipmentHistoryResponse, error)
+	// Streams one GetQuoteRequest per package and returns their total cost.
+	GetBulkQuote(ctx context.Context, opts ...grpc.CallOption) (ShippingService_GetBulkQuoteClient, error)
+	// Streams orders and returns, for each one, an acknowledgement once it is
+	// received and its result once it is processed. Results can arrive in
+	// any order.
+	StreamOrders(ctx context.Context, opts ...grpc.CallOption) (ShippingService_StreamOrdersClient, error)
 }
 
 type shippingServiceClient struct {
@@ -1961,10 +3594,142 @@ func (c *shippingServiceClient) ShipOrder(ctx context.Context, in *ShipOrderRequ
 	return out, nil
 }
 
+func (c *shippingServiceClient) CancelShipment(ctx context.Context, in *CancelShipmentRequest, opts ...grpc.CallOption) (*CancelShipmentResponse, error) {
+	out := new(CancelShipmentResponse)
+	err := c.cc.Invoke(ctx, "/hipstershop.ShippingService/CancelShipment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) ShipOrders(ctx context.Context, in *ShipOrdersRequest, opts ...grpc.CallOption) (*ShipOrdersResponse, error) {
+	out := new(ShipOrdersResponse)
+	err := c.cc.Invoke(ctx, "/hipstershop.ShippingService/ShipOrders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) GenerateLabel(ctx context.Context, in *GenerateLabelRequest, opts ...grpc.CallOption) (*GenerateLabelResponse, error) {
+	out := new(GenerateLabelResponse)
+	err := c.cc.Invoke(ctx, "/hipstershop.ShippingService/GenerateLabel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) GetDeliveryEstimate(ctx context.Context, in *GetDeliveryEstimateRequest, opts ...grpc.CallOption) (*GetDeliveryEstimateResponse, error) {
+	out := new(GetDeliveryEstimateResponse)
+	err := c.cc.Invoke(ctx, "/hipstershop.ShippingService/GetDeliveryEstimate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) GetTrackingStatus(ctx context.Context, in *GetTrackingStatusRequest, opts ...grpc.CallOption) (*GetTrackingStatusResponse, error) {
+	out := new(GetTrackingStatusResponse)
+	err := c.cc.Invoke(ctx, "/hipstershop.ShippingService/GetTrackingStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) GetShipmentHistory(ctx context.Context, in *GetShipmentHistoryRequest, opts ...grpc.CallOption) (*GetShipmentHistoryResponse, error) {
+	out := new(GetShipmentHistoryResponse)
+	err := c.cc.Invoke(ctx, "/hipstershop.ShippingService/GetShipmentHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shippingServiceClient) GetBulkQuote(ctx context.Context, opts ...grpc.CallOption) (ShippingService_GetBulkQuoteClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ShippingService_serviceDesc.Streams[0], "/hipstershop.ShippingService/GetBulkQuote", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shippingServiceGetBulkQuoteClient{stream}
+	return x, nil
+}
+
+type ShippingService_GetBulkQuoteClient interface {
+	Send(*GetQuoteRequest) error
+	CloseAndRecv() (*GetBulkQuoteResponse, error)
+	grpc.ClientStream
+}
+
+type shippingServiceGetBulkQuoteClient struct {
+	grpc.ClientStream
+}
+
+func (x *shippingServiceGetBulkQuoteClient) Send(m *GetQuoteRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shippingServiceGetBulkQuoteClient) CloseAndRecv() (*GetBulkQuoteResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(GetBulkQuoteResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shippingServiceClient) StreamOrders(ctx context.Context, opts ...grpc.CallOption) (ShippingService_StreamOrdersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ShippingService_serviceDesc.Streams[1], "/hipstershop.ShippingService/StreamOrders", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shippingServiceStreamOrdersClient{stream}
+	return x, nil
+}
+
+type ShippingService_StreamOrdersClient interface {
+	Send(*StreamOrdersRequest) error
+	Recv() (*StreamOrdersResponse, error)
+	grpc.ClientStream
+}
+
+type shippingServiceStreamOrdersClient struct {
+	grpc.ClientStream
+}
+
+func (x *shippingServiceStreamOrdersClient) Send(m *StreamOrdersRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shippingServiceStreamOrdersClient) Recv() (*StreamOrdersResponse, error) {
+	m := new(StreamOrdersResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ShippingServiceServer is the server API for ShippingService service.
 type ShippingServiceServer interface {
 	GetQuote(context.Context, *GetQuoteRequest) (*GetQuoteResponse, error)
 	ShipOrder(context.Context, *ShipOrderRequest) (*ShipOrderResponse, error)
+	CancelShipment(context.Context, *CancelShipmentRequest) (*CancelShipmentResponse, error)
+	ShipOrders(context.Context, *ShipOrdersRequest) (*ShipOrdersResponse, error)
+	GenerateLabel(context.Context, *GenerateLabelRequest) (*GenerateLabelResponse, error)
+	GetDeliveryEstimate(context.Context, *GetDeliveryEstimateRequest) (*GetDeliveryEstimateResponse, error)
+	GetTrackingStatus(context.Context, *GetTrackingStatusRequest) (*GetTrackingStatusResponse, error)
+	// Returns every change of state of a shipment, oldest first.
+	GetShipmentHistory(context.Context, *GetShipmentHistoryRequest) (*GetShipmentHistoryResponse, error)
+	// Streams one GetQuoteRequest per package and returns their total cost.
+	GetBulkQuote(ShippingService_GetBulkQuoteServer) error
+	// Streams orders and returns, for each one, an acknowledgement once it is
+	// received and its result once it is processed. Results can arrive in
+	// any order.
+	StreamOrders(ShippingService_StreamOrdersServer) error
 }
 
 func RegisterShippingServiceServer(s *grpc.Server, srv ShippingServiceServer) {
@@ -2007,6 +3772,166 @@ func _ShippingService_ShipOrder_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShippingService_CancelShipment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelShipmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).CancelShipment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hipstershop.ShippingService/CancelShipment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).CancelShipment(ctx, req.(*CancelShipmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_ShipOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShipOrdersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).ShipOrders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hipstershop.ShippingService/ShipOrders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).ShipOrders(ctx, req.(*ShipOrdersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_GenerateLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).GenerateLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hipstershop.ShippingService/GenerateLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).GenerateLabel(ctx, req.(*GenerateLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_GetDeliveryEstimate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeliveryEstimateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).GetDeliveryEstimate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hipstershop.ShippingService/GetDeliveryEstimate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).GetDeliveryEstimate(ctx, req.(*GetDeliveryEstimateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_GetTrackingStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTrackingStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).GetTrackingStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hipstershop.ShippingService/GetTrackingStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).GetTrackingStatus(ctx, req.(*GetTrackingStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_GetShipmentHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetShipmentHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShippingServiceServer).GetShipmentHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hipstershop.ShippingService/GetShipmentHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShippingServiceServer).GetShipmentHistory(ctx, req.(*GetShipmentHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShippingService_GetBulkQuote_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShippingServiceServer).GetBulkQuote(&shippingServiceGetBulkQuoteServer{stream})
+}
+
+type ShippingService_GetBulkQuoteServer interface {
+	SendAndClose(*GetBulkQuoteResponse) error
+	Recv() (*GetQuoteRequest, error)
+	grpc.ServerStream
+}
+
+type shippingServiceGetBulkQuoteServer struct {
+	grpc.ServerStream
+}
+
+func (x *shippingServiceGetBulkQuoteServer) SendAndClose(m *GetBulkQuoteResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shippingServiceGetBulkQuoteServer) Recv() (*GetQuoteRequest, error) {
+	m := new(GetQuoteRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ShippingService_StreamOrders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShippingServiceServer).StreamOrders(&shippingServiceStreamOrdersServer{stream})
+}
+
+type ShippingService_StreamOrdersServer interface {
+	Send(*StreamOrdersResponse) error
+	Recv() (*StreamOrdersRequest, error)
+	grpc.ServerStream
+}
+
+type shippingServiceStreamOrdersServer struct {
+	grpc.ServerStream
+}
+
+func (x *shippingServiceStreamOrdersServer) Send(m *StreamOrdersResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shippingServiceStreamOrdersServer) Recv() (*StreamOrdersRequest, error) {
+	m := new(StreamOrdersRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _ShippingService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "hipstershop.ShippingService",
 	HandlerType: (*ShippingServiceServer)(nil),
@@ -2019,8 +3944,44 @@ var _ShippingService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ShipOrder",
 			Handler:    _ShippingService_ShipOrder_Handler,
 		},
+		{
+			MethodName: "CancelShipment",
+			Handler:    _ShippingService_CancelShipment_Handler,
+		},
+		{
+			MethodName: "ShipOrders",
+			Handler:    _ShippingService_ShipOrders_Handler,
+		},
+		{
+			MethodName: "GenerateLabel",
+			Handler:    _ShippingService_GenerateLabel_Handler,
+		},
+		{
+			MethodName: "GetDeliveryEstimate",
+			Handler:    _ShippingService_GetDeliveryEstimate_Handler,
+		},
+		{
+			MethodName: "GetTrackingStatus",
+			Handler:    _ShippingService_GetTrackingStatus_Handler,
+		},
+		{
+			MethodName: "GetShipmentHistory",
+			Handler:    _ShippingService_GetShipmentHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetBulkQuote",
+			Handler:       _ShippingService_GetBulkQuote_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamOrders",
+			Handler:       _ShippingService_StreamOrders_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "demo.proto",
 }
 
@@ -2376,103 +4337,3 @@ var _AdService_serviceDesc = grpc.ServiceDesc{
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "demo.proto",
 }
-
-func init() { proto.RegisterFile("demo.proto", fileDescriptor_ca53982754088a9d) }
-
-var fileDescriptor_ca53982754088a9d = []byte{
-	// 1500 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x58, 0xef, 0x72, 0x13, 0xb7,
-	0x16, 0xcf, 0x26, 0xb1, 0x1d, 0x1f, 0xc7, 0x4e, 0xa2, 0x9b, 0x04, 0xb3, 0x81, 0x10, 0x94, 0x81,
-	0x0b, 0x17, 0x08, 0x4c, 0xee, 0x9d, 0xe1, 0x03, 0xdc, 0xd2, 0x8c, 0xc9, 0x18, 0x4f, 0xa1, 0xd0,
-	0x0d, 0xe9, 0xd0, 0xa1, 0x53, 0xcf, 0xb2, 0x12, 0xf1, 0x96, 0xec, 0x6a, 0x91, 0xb4, 0x19, 0xcc,
-	0xc7, 0xf6, 0x01, 0xfa, 0x1e, 0x7d, 0x81, 0xce, 0xf4, 0x11, 0xfa, 0xbd, 0xaf, 0xd0, 0xe7, 0xe8,
-	0x48, 0xbb, 0xda, 0x7f, 0xb1, 0x13, 0xf8, 0xd2, 0x6f, 0xab, 0xa3, 0x9f, 0xce, 0xf9, 0xe9, 0xe8,
-	0xfc, 0xb3, 0x01, 0x08, 0x0d, 0xd8, 0x4e, 0xc4, 0x99, 0x64, 0xa8, 0x35, 0xf2, 0x23, 0x21, 0x29,
-	0x17, 0x23, 0x16, 0xe1, 0x7d, 0x58, 0xe8, 0xb9, 0x5c, 0x0e, 0x24, 0x0d, 0xd0, 0x65, 0x80, 0x88,
-	0x33, 0x12, 0x7b, 0x72, 0xe8, 0x93, 0xae, 0xb5, 0x65, 0xdd, 0x68, 0x3a, 0xcd, 0x54, 0x32, 0x20,
-	0xc8, 0x86, 0x85, 0xf7, 0xb1, 0x1b, 0x4a, 0x5f, 0x8e, 0xbb, 0xb3, 0x5b, 0xd6, 0x8d, 0x9a, 0x93,
-	0xad, 0xf1, 0x4b, 0xe8, 0xec, 0x11, 0xa2, 0xb4, 0x38, 0xf4, 0x7d, 0x4c, 0x85, 0x44, 0x17, 0xa0,
-	0x11, 0x0b, 0xca, 0x73, 0x4d, 0x75, 0xb5, 0x1c, 0x10, 0x74, 0x13, 0xe6, 0x7d, 0x49, 0x03, 0xad,
-	0xa2, 0xb5, 0xbb, 0xb6, 0x53, 0x60, 0xb3, 0x63, 0xa8, 0x38, 0x1a, 0x82, 0x6f, 0xc1, 0xf2, 0x7e,
-	0x10, 0xc9, 0xb1, 0x12, 0x9f, 0xa7, 0x17, 0xdf, 0x84, 0x4e, 0x9f, 0xca, 0x4f, 0x82, 0x3e, 0x85,
-	0x79, 0x85, 0x9b, 0xce, 0xf1, 0x16, 0xd4, 0x14, 0x01, 0xd1, 0x9d, 0xdd, 0x9a, 0x9b, 0x4e, 0x32,
-	0xc1, 0xe0, 0x06, 0xd4, 0x34, 0x4b, 0xfc, 0x2d, 0xd8, 0x4f, 0x7d, 0x21, 0x1d, 0xea, 0xb1, 0x20,
-	0xa0, 0x21, 0x71, 0xa5, 0xcf, 0x42, 0x71, 0xae, 0x43, 0xae, 0x40, 0x2b, 0x77, 0x7b, 0x62, 0xb2,
-	0xe9, 0x40, 0xe6, 0x77, 0x81, 0xbf, 0x80, 0x8d, 0x89, 0x7a, 0x45, 0xc4, 0x42, 0x41, 0xab, 0xe7,
-	0xad, 0x53, 0xe7, 0x7f, 0xb7, 0xa0, 0xf1, 0x22, 0x59, 0xa2, 0x0e, 0xcc, 0x66, 0x04, 0x66, 0x7d,
-	0x82, 0x10, 0xcc, 0x87, 0x6e, 0x40, 0xf5, 0x6b, 0x34, 0x1d, 0xfd, 0x8d, 0xb6, 0xa0, 0x45, 0xa8,
-	0xf0, 0xb8, 0x1f, 0x29, 0x43, 0xdd, 0x39, 0xbd, 0x55, 0x14, 0xa1, 0x2e, 0x34, 0x22, 0xdf, 0x93,
-	0x31, 0xa7, 0xdd, 0x79, 0xbd, 0x6b, 0x96, 0xe8, 0x2e, 0x34, 0x23, 0xee, 0x7b, 0x74, 0x18, 0x0b,
-	0xd2, 0xad, 0xe9, 0x27, 0x46, 0x25, 0xef, 0x3d, 0x63, 0x21, 0x1d, 0x3b, 0x0b, 0x1a, 0x74, 0x28,
-	0x08, 0xda, 0x04, 0xf0, 0x5c, 0x49, 0x8f, 0x18, 0xf7, 0xa9, 0xe8, 0xd6, 0x13, 0xf2, 0xb9, 0x04,
-	0x3f, 0x81, 0x55, 0x75, 0xf9, 0x94, 0x7f, 0x7e, 0xeb, 0x7b, 0xb0, 0x90, 0x5e, 0x31, 0xb9, 0x72,
-	0x6b, 0x77, 0xb5, 0x64, 0x27, 0x3d, 0xe0, 0x64, 0x28, 0xbc, 0x0d, 0x2b, 0x7d, 0x6a, 0x14, 0x99,
-	0x57, 0xa9, 0xf8, 0x03, 0xdf, 0x81, 0xb5, 0x03, 0xea, 0x72, 0x6f, 0x94, 0x1b, 0x4c, 0x80, 0xab,
-	0x50, 0x7b, 0x1f, 0x53, 0x3e, 0x4e, 0xb1, 0xc9, 0x02, 0x3f, 0x81, 0xf5, 0x2a, 0x3c, 0xe5, 0xb7,
-	0x03, 0x0d, 0x4e, 0x45, 0x7c, 0x7c, 0x0e, 0x3d, 0x03, 0xc2, 0x21, 0x2c, 0xf5, 0xa9, 0xfc, 0x26,
-	0x66, 0x92, 0x1a, 0x93, 0x3b, 0xd0, 0x70, 0x09, 0xe1, 0x54, 0x08, 0x6d, 0xb4, 0xaa, 0x62, 0x2f,
-	0xd9, 0x73, 0x0c, 0xe8, 0xf3, 0xa2, 0x76, 0x0f, 0x96, 0x73, 0x7b, 0x29, 0xe7, 0x3b, 0xb0, 0xe0,
-	0x31, 0x21, 0xf5, 0xdb, 0x59, 0x53, 0xdf, 0xae, 0xa1, 0x30, 0x87, 0x82, 0x60, 0x06, 0xcb, 0x07,
-	0x23, 0x3f, 0x7a, 0xce, 0x09, 0xe5, 0xff, 0x08, 0xe7, 0xff, 0xc1, 0x4a, 0xc1, 0x60, 0x1e, 0xfe,
-	0x92, 0xbb, 0xde, 0x3b, 0x3f, 0x3c, 0xca, 0x73, 0x0b, 0x8c, 0x68, 0x40, 0xf0, 0x2f, 0x16, 0x34,
-	0x52, 0xbb, 0xe8, 0x1a, 0x74, 0x84, 0xe4, 0x94, 0xca, 0x61, 0x91, 0x65, 0xd3, 0x69, 0x27, 0x52,
-	0x03, 0x43, 0x30, 0xef, 0x99, 0x32, 0xd7, 0x74, 0xf4, 0xb7, 0x0a, 0x00, 0x21, 0x5d, 0x49, 0xd3,
-	0x7c, 0x48, 0x16, 0x2a, 0x13, 0x3c, 0x16, 0x87, 0x92, 0x8f, 0x4d, 0x26, 0xa4, 0x4b, 0x74, 0x11,
-	0x16, 0x3e, 0xfa, 0xd1, 0xd0, 0x63, 0x84, 0xea, 0x44, 0xa8, 0x39, 0x8d, 0x8f, 0x7e, 0xd4, 0x63,
-	0x84, 0xe2, 0x57, 0x50, 0xd3, 0xae, 0x44, 0xdb, 0xd0, 0xf6, 0x62, 0xce, 0x69, 0xe8, 0x8d, 0x13,
-	0x60, 0xc2, 0x66, 0xd1, 0x08, 0x15, 0x5a, 0x19, 0x8e, 0x43, 0x5f, 0x0a, 0xcd, 0x66, 0xce, 0x49,
-	0x16, 0x4a, 0x1a, 0xba, 0x21, 0x13, 0x9a, 0x4e, 0xcd, 0x49, 0x16, 0xb8, 0x0f, 0x9b, 0x7d, 0x2a,
-	0x0f, 0xe2, 0x28, 0x62, 0x5c, 0x52, 0xd2, 0x4b, 0xf4, 0xf8, 0x34, 0x8f, 0xcb, 0x6b, 0xd0, 0x29,
-	0x99, 0x34, 0x05, 0xa3, 0x5d, 0xb4, 0x29, 0xf0, 0xf7, 0x70, 0xb1, 0x97, 0x09, 0xc2, 0x13, 0xca,
-	0x85, 0xcf, 0x42, 0xf3, 0xc8, 0xd7, 0x61, 0xfe, 0x2d, 0x67, 0xc1, 0x19, 0x31, 0xa2, 0xf7, 0x55,
-	0xc9, 0x93, 0x2c, 0xb9, 0x58, 0xe2, 0xc9, 0xba, 0x64, 0xda, 0x01, 0x7f, 0x59, 0xd0, 0xe9, 0x71,
-	0x4a, 0x7c, 0x55, 0xaf, 0xc9, 0x20, 0x7c, 0xcb, 0xd0, 0x6d, 0x40, 0x9e, 0x96, 0x0c, 0x3d, 0x97,
-	0x93, 0x61, 0x18, 0x07, 0x6f, 0x28, 0x4f, 0xfd, 0xb1, 0xec, 0x65, 0xd8, 0xaf, 0xb5, 0x1c, 0x5d,
-	0x87, 0xa5, 0x22, 0xda, 0x3b, 0x39, 0x49, 0x5b, 0x52, 0x3b, 0x87, 0xf6, 0x4e, 0x4e, 0xd0, 0xff,
-	0x61, 0xa3, 0x88, 0xa3, 0x1f, 0x22, 0x9f, 0xeb, 0xf2, 0x39, 0x1c, 0x53, 0x97, 0xa7, 0xbe, 0xeb,
-	0xe6, 0x67, 0xf6, 0x33, 0xc0, 0x77, 0xd4, 0xe5, 0xe8, 0x11, 0x5c, 0x9a, 0x72, 0x3c, 0x60, 0xa1,
-	0x1c, 0xe9, 0x27, 0xaf, 0x39, 0x17, 0x27, 0x9d, 0x7f, 0xa6, 0x00, 0x78, 0x0c, 0xed, 0xde, 0xc8,
-	0xe5, 0x47, 0x59, 0x4e, 0xff, 0x07, 0xea, 0x6e, 0xa0, 0x22, 0xe4, 0x0c, 0xe7, 0xa5, 0x08, 0xf4,
-	0x10, 0x5a, 0x05, 0xeb, 0x69, 0xc3, 0xdc, 0x28, 0x67, 0x48, 0xc9, 0x89, 0x0e, 0xe4, 0x4c, 0xf0,
-	0x7d, 0xe8, 0x18, 0xd3, 0xf9, 0xd3, 0x4b, 0xee, 0x86, 0xc2, 0xf5, 0xf4, 0x15, 0xb2, 0x64, 0x69,
-	0x17, 0xa4, 0x03, 0x82, 0x7f, 0x80, 0xa6, 0xce, 0x30, 0x3d, 0x13, 0x98, 0x6e, 0x6d, 0x9d, 0xdb,
-	0xad, 0x55, 0x54, 0xa8, 0xca, 0x90, 0xf2, 0x9c, 0x18, 0x15, 0x6a, 0x1f, 0xff, 0x34, 0x0b, 0x2d,
-	0x93, 0xc2, 0xf1, 0xb1, 0x54, 0x89, 0xc2, 0xd4, 0x32, 0x27, 0xd4, 0xd0, 0xeb, 0x01, 0x41, 0xf7,
-	0x60, 0x55, 0x8c, 0xfc, 0x28, 0x52, 0xb9, 0x5d, 0x4c, 0xf2, 0x24, 0x9a, 0x90, 0xd9, 0x7b, 0x99,
-	0x25, 0x3b, 0xba, 0x0f, 0xed, 0xec, 0x84, 0x66, 0x33, 0x37, 0x95, 0xcd, 0xa2, 0x01, 0xf6, 0x98,
-	0x90, 0xe8, 0x11, 0x2c, 0x67, 0x07, 0x4d, 0x6d, 0x98, 0x3f, 0xa3, 0x82, 0x2d, 0x19, 0xb4, 0xa9,
-	0x19, 0xb7, 0x4d, 0x25, 0xab, 0xe9, 0x4a, 0xb6, 0x5e, 0x3a, 0x95, 0x39, 0xd4, 0x94, 0x32, 0x02,
-	0x97, 0x0e, 0x68, 0x48, 0xb4, 0xbc, 0xc7, 0xc2, 0xb7, 0x3e, 0x0f, 0x74, 0xd8, 0x14, 0xda, 0x0d,
-	0x0d, 0x5c, 0xff, 0xd8, 0xb4, 0x1b, 0xbd, 0x40, 0x3b, 0x50, 0xd3, 0xae, 0x49, 0x7d, 0xdc, 0x3d,
-	0x6d, 0x23, 0xf1, 0xa9, 0x93, 0xc0, 0xf0, 0x9f, 0x16, 0xac, 0xbc, 0x38, 0x76, 0x3d, 0x5a, 0xaa,
-	0xd1, 0x53, 0x27, 0x91, 0x6d, 0x68, 0xeb, 0x0d, 0x53, 0x0a, 0x52, 0x3f, 0x2f, 0x2a, 0xa1, 0xa9,
-	0x06, 0xc5, 0x0a, 0x3f, 0xf7, 0x29, 0x15, 0x3e, 0xbb, 0x49, 0xad, 0x78, 0x93, 0x4a, 0x6c, 0xd7,
-	0x3f, 0x2f, 0xb6, 0x1f, 0x03, 0x2a, 0x5e, 0x2b, 0x6b, 0xb9, 0xa9, 0x77, 0xac, 0x4f, 0xf3, 0xce,
-	0x0e, 0x34, 0xf7, 0x88, 0x71, 0xca, 0x55, 0x58, 0xf4, 0x58, 0x28, 0xe9, 0x07, 0x39, 0x7c, 0x47,
-	0xc7, 0xa6, 0x2a, 0xb6, 0x52, 0xd9, 0x57, 0x74, 0x2c, 0xf0, 0x5d, 0x00, 0x85, 0x4f, 0xad, 0x5d,
-	0x85, 0x39, 0x97, 0x98, 0xe6, 0xbe, 0x54, 0xf1, 0x81, 0xa3, 0xf6, 0xf0, 0x03, 0x98, 0xdd, 0x23,
-	0x4a, 0xb3, 0x62, 0xce, 0xa9, 0x27, 0x87, 0x31, 0x37, 0x2f, 0xda, 0x32, 0xb2, 0x43, 0x7e, 0xac,
-	0xfa, 0x8d, 0xb2, 0x62, 0xfa, 0x8d, 0xfa, 0xde, 0xfd, 0xc3, 0x82, 0x96, 0xca, 0xb0, 0x03, 0xca,
-	0x4f, 0x7c, 0x8f, 0xa2, 0x87, 0xba, 0x8b, 0xe9, 0xa4, 0xdc, 0xa8, 0x7a, 0xbc, 0x30, 0x78, 0xdb,
-	0xe5, 0x50, 0x4f, 0x26, 0xd3, 0x19, 0xf4, 0x00, 0x1a, 0xe9, 0x74, 0x5c, 0x39, 0x5d, 0x9e, 0x99,
-	0xed, 0x95, 0x53, 0x19, 0x8e, 0x67, 0xd0, 0x97, 0xd0, 0xcc, 0xe6, 0x70, 0x74, 0xf9, 0xb4, 0xfe,
-	0xa2, 0x82, 0x89, 0xe6, 0x77, 0x7f, 0xb6, 0x60, 0xad, 0x3c, 0xbf, 0x9a, 0x6b, 0xfd, 0x08, 0xff,
-	0x9a, 0x30, 0xdc, 0xa2, 0x7f, 0x97, 0xd4, 0x4c, 0x1f, 0xab, 0xed, 0x1b, 0xe7, 0x03, 0x93, 0x07,
-	0x53, 0x2c, 0x66, 0x61, 0x2d, 0x1d, 0xbc, 0x7a, 0xae, 0x74, 0x8f, 0xd9, 0x91, 0x61, 0xd1, 0x87,
-	0xc5, 0xe2, 0x94, 0x89, 0x26, 0xdc, 0xc2, 0xbe, 0x7a, 0xca, 0x52, 0x75, 0xe8, 0xc3, 0x33, 0xe8,
-	0x31, 0x40, 0x3e, 0x64, 0xa2, 0xcd, 0xaa, 0xab, 0xcb, 0xd3, 0xa7, 0x3d, 0x71, 0x26, 0xc4, 0x33,
-	0xe8, 0x35, 0x74, 0xca, 0x63, 0x25, 0xc2, 0x25, 0xe4, 0xc4, 0x11, 0xd5, 0xde, 0x3e, 0x13, 0x93,
-	0x79, 0xe1, 0x57, 0x0b, 0x96, 0x0e, 0xd2, 0xe2, 0x65, 0xee, 0x3f, 0x80, 0x05, 0x33, 0x0d, 0xa2,
-	0x4b, 0x55, 0xd2, 0xc5, 0xa1, 0xd4, 0xbe, 0x3c, 0x65, 0x37, 0xf3, 0xc0, 0x53, 0x68, 0x66, 0x43,
-	0x5a, 0x25, 0x58, 0xaa, 0xd3, 0xa2, 0xbd, 0x39, 0x6d, 0x3b, 0x23, 0xfb, 0x9b, 0x05, 0x4b, 0xa6,
-	0xf4, 0x18, 0xb2, 0xaf, 0x61, 0x7d, 0xf2, 0x90, 0x33, 0xf1, 0xd9, 0x6e, 0x55, 0x09, 0x9f, 0x31,
-	0x1d, 0xe1, 0x19, 0xd4, 0x87, 0x46, 0x32, 0xf0, 0x48, 0x74, 0xbd, 0x9c, 0x0b, 0xd3, 0xc6, 0x21,
-	0x7b, 0x42, 0x73, 0xc1, 0x33, 0xbb, 0x87, 0xd0, 0x79, 0xe1, 0x8e, 0x03, 0x1a, 0x66, 0x19, 0xdc,
-	0x83, 0x7a, 0xd2, 0x91, 0x91, 0x5d, 0xd6, 0x5c, 0x9c, 0x10, 0xec, 0x8d, 0x89, 0x7b, 0x99, 0x43,
-	0x46, 0xb0, 0xb8, 0xaf, 0x2a, 0xa8, 0x51, 0xfa, 0x4a, 0xfd, 0x60, 0x99, 0xd0, 0x48, 0xd0, 0xcd,
-	0x4a, 0x34, 0x4c, 0x6f, 0x36, 0x53, 0x72, 0xf6, 0x0d, 0x2c, 0xf5, 0x46, 0xd4, 0x7b, 0xc7, 0xe2,
-	0xec, 0x06, 0xcf, 0x01, 0xf2, 0xba, 0x5b, 0x89, 0xee, 0x53, 0x7d, 0xc6, 0xbe, 0x32, 0x75, 0x3f,
-	0xbb, 0xcd, 0x13, 0x55, 0x82, 0x8d, 0xf6, 0x07, 0x50, 0xef, 0xab, 0x19, 0x5c, 0xa0, 0xf5, 0x6a,
-	0x39, 0x4d, 0x35, 0x5e, 0x38, 0x25, 0x37, 0x9a, 0xde, 0xd4, 0xf5, 0x9f, 0x1b, 0xff, 0xfd, 0x3b,
-	0x00, 0x00, 0xff, 0xff, 0xb2, 0xa0, 0x6e, 0x6c, 0xea, 0x10, 0x00, 0x00,
-}
@@ -0,0 +1,358 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	defaultNominatimURL     = "https://nominatim.openstreetmap.org"
+	defaultGeocoderTimeout  = 2 * time.Second
+	defaultGeocodeCacheSize = 10000
+	defaultGeocodeCacheTTL  = 24 * time.Hour
+	defaultGeocoderRate     = 1 // requests a second, the limit of the public Nominatim
+	earthRadiusKm           = 6371.0
+	nominatimUserAgent      = "shippingservice (otel-workshop demo)"
+)
+
+// location is a point on Earth, in degrees.
+type location struct {
+	lat, lon float64
+}
+
+// originLocation is the warehouse all orders ship from, in Mountain View.
+var originLocation = location{lat: 37.4220, lon: -122.0841}
+
+// distanceKm is the great-circle distance between two locations.
+func distanceKm(a, b location) float64 {
+	rad := math.Pi / 180
+	dLat, dLon := (b.lat-a.lat)*rad, (b.lon-a.lon)*rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(a.lat*rad)*math.Cos(b.lat*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// geocoder finds where an address is. Only its country, zip code and city
+// are used, so that street addresses are neither cached nor sent to another
+// service. Addresses that cannot be found are not an error.
+type geocoder interface {
+	name() string
+	locate(ctx context.Context, a *pb.Address) (location, bool, error)
+}
+
+// geocoderFromEnv returns the geocoder named by GEOCODER, behind a cache,
+// or nil if there is none: "zip" for the built-in table of zip code
+// centroids, or "nominatim" for OpenStreetMap Nominatim at GEOCODER_URL,
+// called at most GEOCODER_RATE times a second.
+func geocoderFromEnv() geocoder {
+	var g geocoder
+	switch name := os.Getenv("GEOCODER"); name {
+	case "", "off":
+		return nil
+	case "zip":
+		g = zipCentroids{}
+	case "nominatim":
+		base := os.Getenv("GEOCODER_URL")
+		if base == "" {
+			base = defaultNominatimURL
+		}
+		g = &nominatimGeocoder{
+			base:   strings.TrimSuffix(base, "/"),
+			client: newDownstreamHTTPClient(envDuration("GEOCODER_TIMEOUT", defaultGeocoderTimeout)),
+			rate:   envFloat("GEOCODER_RATE", defaultGeocoderRate),
+		}
+	default:
+		log.Fatalf("unknown GEOCODER %q: want zip or nominatim", name)
+	}
+	log.Infof("pricing quotes by distance with the %s geocoder", g.name())
+	return newGeocodeCache(g, envInt("GEOCODER_CACHE_SIZE", defaultGeocodeCacheSize), envDuration("GEOCODER_CACHE_TTL", defaultGeocodeCacheTTL))
+}
+
+// zipRegionCentroids are the rough centres of the US zip code regions, by
+// the first digit of their zip codes.
+var zipRegionCentroids = [10]location{
+	{42.3, -71.8},  // 0: New England, New Jersey
+	{41.5, -75.5},  // 1: New York, Pennsylvania
+	{37.5, -78.5},  // 2: Mid-Atlantic, Carolinas
+	{32.5, -84.5},  // 3: Southeast
+	{40.0, -84.5},  // 4: Ohio Valley, Michigan
+	{44.5, -93.5},  // 5: Upper Midwest
+	{38.5, -94.0},  // 6: Central Plains
+	{31.5, -96.5},  // 7: South Central
+	{39.5, -108.0}, // 8: Mountain West
+	{37.5, -121.0}, // 9: Pacific
+}
+
+// zipCentroids is a built-in geocoder placing US addresses at the centre of
+// their zip code region. It is coarse, but needs no network.
+type zipCentroids struct{}
+
+func (zipCentroids) name() string { return "zip" }
+
+// locate places a zip code by its ten-thousands digit: zip codes are
+// numbers, so 02110 is 2110, in region 0.
+func (zipCentroids) locate(_ context.Context, a *pb.Address) (location, bool, error) {
+	zip := a.GetZipCode()
+	if !isDomestic(a) || zip <= 0 || zip > 99999 {
+		return location{}, false, nil
+	}
+	return zipRegionCentroids[zip/10000], true, nil
+}
+
+// errGeocoderRateLimited is returned instead of calling Nominatim more often
+// than its rate allows.
+var errGeocoderRateLimited = errors.New("geocoder rate limit reached")
+
+// nominatimGeocoder looks addresses up with the search API of OpenStreetMap
+// Nominatim. The public instance allows one request a second: lookups beyond
+// rate a second fail rather than wait, so that their quotes are priced by
+// zone alone, and the cache in front of it keeps them rare.
+type nominatimGeocoder struct {
+	base   string
+	client *http.Client
+	rate   float64 // requests a second; 0 is unlimited
+
+	mu     sync.Mutex
+	bucket tokenBucket
+}
+
+func (g *nominatimGeocoder) name() string { return "nominatim" }
+
+// admit takes a request from the rate limit, if there is one left.
+func (g *nominatimGeocoder) admit() bool {
+	if g.rate <= 0 {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.bucket.take(time.Now(), g.rate, 1)
+}
+
+func (g *nominatimGeocoder) locate(ctx context.Context, a *pb.Address) (location, bool, error) {
+	if !g.admit() {
+		return location{}, false, errGeocoderRateLimited
+	}
+	q := url.Values{"format": {"jsonv2"}, "limit": {"1"}}
+	if zip := a.GetZipCode(); zip > 0 {
+		q.Set("postalcode", fmt.Sprintf("%05d", zip))
+	}
+	if a.GetCity() != "" {
+		q.Set("city", a.GetCity())
+	}
+	country := a.GetCountry()
+	if isDomestic(a) {
+		country = "us"
+	}
+	q.Set("country", country)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.base+"/search?"+q.Encode(), nil)
+	if err != nil {
+		return location{}, false, err
+	}
+	req.Header.Set("User-Agent", nominatimUserAgent)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return location{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return location{}, false, fmt.Errorf("nominatim returned %s", resp.Status)
+	}
+	var places []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&places); err != nil {
+		return location{}, false, fmt.Errorf("decode nominatim response: %w", err)
+	}
+	if len(places) == 0 {
+		return location{}, false, nil
+	}
+	lat, err1 := strconv.ParseFloat(places[0].Lat, 64)
+	lon, err2 := strconv.ParseFloat(places[0].Lon, 64)
+	if err1 != nil || err2 != nil {
+		return location{}, false, fmt.Errorf("nominatim returned an invalid location %q, %q", places[0].Lat, places[0].Lon)
+	}
+	return location{lat: lat, lon: lon}, true, nil
+}
+
+type geocodeCacheEntry struct {
+	key     string
+	loc     location
+	found   bool
+	expires time.Time
+}
+
+// geocodeCache is a size-bounded LRU cache in front of a geocoder, whose
+// entries expire after a fixed TTL. Addresses that were not found are cached
+// too; failed lookups are not. Concurrent misses of an address share one
+// call of the geocoder. Every lookup is a geocode span, with
+// geocode.cache_hit, under which the geocoder's own calls are traced.
+type geocodeCache struct {
+	next    geocoder
+	size    int
+	ttl     time.Duration
+	flights singleflight.Group
+
+	mu      sync.Mutex
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+func newGeocodeCache(next geocoder, size int, ttl time.Duration) *geocodeCache {
+	return &geocodeCache{next: next, size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *geocodeCache) name() string { return c.next.name() }
+
+// geocodeKey is the part of an address that geocoders use.
+func geocodeKey(a *pb.Address) string {
+	country := strings.ToUpper(strings.TrimSpace(a.GetCountry()))
+	if isDomestic(a) {
+		country = "US"
+	}
+	return country + "|" + strconv.Itoa(int(a.GetZipCode())) + "|" + strings.ToLower(strings.TrimSpace(a.GetCity()))
+}
+
+func (c *geocodeCache) locate(ctx context.Context, a *pb.Address) (location, bool, error) {
+	ctx, span := tracer.Start(ctx, "geocode", trace.WithAttributes(attribute.String("geocode.provider", c.next.name())))
+	defer span.End()
+	key := geocodeKey(a)
+	if e, ok := c.lookup(key); ok {
+		span.SetAttributes(attribute.Bool("geocode.cache_hit", true), attribute.Bool("geocode.found", e.found))
+		return e.loc, e.found, nil
+	}
+	span.SetAttributes(attribute.Bool("geocode.cache_hit", false))
+	v, err, _ := c.flights.Do(key, func() (any, error) {
+		loc, found, err := c.next.locate(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		e := &geocodeCacheEntry{key: key, loc: loc, found: found, expires: time.Now().Add(c.ttl)}
+		c.put(e)
+		return e, nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return location{}, false, err
+	}
+	e := v.(*geocodeCacheEntry)
+	span.SetAttributes(attribute.Bool("geocode.found", e.found))
+	return e.loc, e.found, nil
+}
+
+func (c *geocodeCache) lookup(key string) (*geocodeCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*geocodeCacheEntry)
+	if time.Now().After(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e, true
+}
+
+func (c *geocodeCache) put(e *geocodeCacheEntry) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[e.key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*geocodeCacheEntry).key)
+	}
+}
+
+// distance returns how far an address is from the warehouse, if there is a
+// geocoder and it finds the address, and sets it on the current span as
+// shipping.distance_km. Quotes fall back to zone pricing alone when the
+// geocoder fails, so failures are only logged.
+func (s *server) distance(ctx context.Context, a *pb.Address) (float64, bool) {
+	if s.geocoder == nil {
+		return 0, false
+	}
+	loc, found, err := s.geocoder.locate(ctx, a)
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("failed to geocode address")
+		return 0, false
+	}
+	if !found {
+		return 0, false
+	}
+	km := distanceKm(originLocation, loc)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Float64("shipping.distance_km", math.Round(km)))
+	return km, true
+}
+
+// distanceRate prices the distance a parcel travels: PerKm for every km
+// beyond FreeKm, in USD.
+type distanceRate struct {
+	PerKm  float64 `yaml:"per_km"`
+	FreeKm float64 `yaml:"free_km"`
+}
+
+func (d distanceRate) validate() error {
+	if d.PerKm < 0 || d.FreeKm < 0 {
+		return fmt.Errorf("distance rates must not be negative")
+	}
+	return nil
+}
+
+// applyDistance adds the distance surcharge of a parcel travelling km to
+// its lines.
+func (rt *rateTable) applyDistance(lines quoteBreakdown, km float64) quoteBreakdown {
+	d := rt.Distance
+	if len(lines) == 0 || d.PerKm == 0 || km <= d.FreeKm {
+		return lines
+	}
+	return append(lines, quoteLine{
+		kind:        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_DISTANCE,
+		description: fmt.Sprintf("Distance surcharge (%.0f km)", km),
+		cents:       roundCents((km - d.FreeKm) * d.PerKm * 100),
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// TestDistancePricing checks that geocoded parcels pay for the distance
+// beyond the free distance of the rate table, and that lookups are cached.
+func TestDistancePricing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	if km := distanceKm(location{40.7128, -74.0060}, location{51.5074, -0.1278}); math.Abs(km-5570) > 10 {
+		t.Errorf("TestDistancePricing: New York to London is %.0f km, want 5570", km)
+	}
+
+	s := newServer()
+	s.geocoder = newGeocodeCache(zipCentroids{}, 10, time.Minute)
+	ctx := context.Background()
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}
+	newYork := &pb.Address{City: "New York", State: "NY", ZipCode: 10001}
+	for i := 0; i < 2; i++ {
+		res, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: newYork, Items: items})
+		if err != nil {
+			t.Fatalf("TestDistancePricing: %v", err)
+		}
+		want := roundCents((distanceKm(originLocation, zipRegionCentroids[1]) - 1000) * 0.002 * 100)
+		last := res.LineItems[len(res.LineItems)-1]
+		if last.Type != pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_DISTANCE || money.Cents(*last.AmountUsd) != want {
+			t.Errorf("TestDistancePricing: quote to New York ends with %v, want a distance surcharge of %d cents", last, want)
+		}
+	}
+	if res, _ := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items}); len(res.GetLineItems()) != 1 {
+		t.Errorf("TestDistancePricing: local quote got lines %v", res.GetLineItems())
+	}
+	if loc, found, _ := (zipCentroids{}).locate(ctx, &pb.Address{City: "Boston", ZipCode: 2110}); !found || loc != zipRegionCentroids[0] {
+		t.Errorf("TestDistancePricing: Boston, 02110, is at %v, want New England", loc)
+	}
+
+	var hits []bool
+	for _, sp := range rec.Ended() {
+		if sp.Name() == "geocode" {
+			attrs := attribute.NewSet(sp.Attributes()...)
+			v, _ := attrs.Value("geocode.cache_hit")
+			hits = append(hits, v.AsBool())
+		}
+	}
+	if len(hits) != 3 || hits[0] || !hits[1] {
+		t.Errorf("TestDistancePricing: geocode cache hits %v, want a miss then a hit", hits)
+	}
+}
+
+// TestNominatimGeocoder checks the queries sent to Nominatim, that street
+// addresses are left out, that it is called no more often than its rate, and
+// that quotes are still given when it fails.
+func TestNominatimGeocoder(t *testing.T) {
+	calls := 0
+	osm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		q := r.URL.Query()
+		if zip := q.Get("postalcode"); zip != "10001" && zip != "02110" {
+			t.Errorf("TestNominatimGeocoder: got postal code %q", zip)
+		}
+		if r.URL.Path != "/search" || q.Get("country") != "us" || q.Get("street") != "" || r.UserAgent() != nominatimUserAgent {
+			t.Errorf("TestNominatimGeocoder: got request %s with User-Agent %q", r.URL, r.UserAgent())
+		}
+		if q.Get("city") == "Atlantis" {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"lat": "40.7506", "lon": "-73.9972"}]`))
+	}))
+	defer osm.Close()
+
+	g := newGeocodeCache(&nominatimGeocoder{base: osm.URL, client: osm.Client()}, 10, time.Minute)
+	ctx := context.Background()
+	address := &pb.Address{StreetAddress: "350 5th Ave", City: "New York", ZipCode: 10001}
+	for i := 0; i < 2; i++ {
+		loc, found, err := g.locate(ctx, address)
+		if err != nil || !found || loc != (location{40.7506, -73.9972}) {
+			t.Errorf("TestNominatimGeocoder: got %v, %v (%v)", loc, found, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("TestNominatimGeocoder: %d calls to Nominatim, want 1", calls)
+	}
+
+	limited := &nominatimGeocoder{base: osm.URL, client: osm.Client(), rate: 1}
+	if _, found, err := limited.locate(ctx, &pb.Address{City: "Boston", ZipCode: 2110}); err != nil || !found {
+		t.Errorf("TestNominatimGeocoder: Boston got %v, %v", found, err)
+	}
+	if _, _, err := limited.locate(ctx, address); !errors.Is(err, errGeocoderRateLimited) {
+		t.Errorf("TestNominatimGeocoder: second call within a second got %v, want %v", err, errGeocoderRateLimited)
+	}
+	if calls != 2 {
+		t.Errorf("TestNominatimGeocoder: %d calls to Nominatim, want 2", calls)
+	}
+
+	s := newServer()
+	s.geocoder = g
+	res, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: &pb.Address{City: "Atlantis", ZipCode: 10001}, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}})
+	if err != nil || len(res.LineItems) != 1 {
+		t.Errorf("TestNominatimGeocoder: quote with a failed geocoder got %v (%v), want zone pricing", res.GetLineItems(), err)
+	}
+}
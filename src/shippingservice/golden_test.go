@@ -0,0 +1,260 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden trace files in testdata/golden")
+
+// goldenVolatile are attribute keys whose values differ from run to run.
+// Their presence is still checked, their values are not.
+var goldenVolatile = map[string]bool{
+	"net.sock.peer.addr": true,
+	"net.sock.peer.port": true,
+	"shipment.id":        true,
+	"audit.seq":          true,
+	"rates.version":      true, // changes with rates.yaml, not the instrumentation
+}
+
+// goldenSpan is the run-independent part of a span: no IDs or timestamps.
+type goldenSpan struct {
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Status     string            `json:"status,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Events     []goldenEvent     `json:"events,omitempty"`
+	Children   []*goldenSpan     `json:"children,omitempty"`
+}
+
+type goldenEvent struct {
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// TestGoldenTraces runs RPCs through an instrumented client and server and
+// compares the span trees they produce with testdata/golden. After an
+// intended instrumentation change, regenerate the files with
+//
+//	go test -run TestGoldenTraces -update
+//
+// and review the diff.
+func TestGoldenTraces(t *testing.T) {
+	address := &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043}
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}}
+
+	for _, tc := range []struct {
+		name string
+		run  func(context.Context, pb.ShippingServiceClient)
+	}{
+		{"get_quote", func(ctx context.Context, c pb.ShippingServiceClient) {
+			c.GetQuote(ctx, &pb.GetQuoteRequest{Address: address, Items: items})
+		}},
+		{"ship_order", func(ctx context.Context, c pb.ShippingServiceClient) {
+			c.ShipOrder(ctx, &pb.ShipOrderRequest{Address: address, Items: items})
+		}},
+		{"ship_order_invalid_address", func(ctx context.Context, c pb.ShippingServiceClient) {
+			c.ShipOrder(ctx, &pb.ShipOrderRequest{Address: &pb.Address{Country: "USA"}, Items: items})
+		}},
+		{"ship_orders", func(ctx context.Context, c pb.ShippingServiceClient) {
+			c.ShipOrders(ctx, &pb.ShipOrdersRequest{Orders: []*pb.ShipOrderRequest{
+				{Address: address, Items: items},
+				{Address: &pb.Address{Country: "USA"}, Items: items},
+			}})
+		}},
+		{"generate_label", func(ctx context.Context, c pb.ShippingServiceClient) {
+			res, err := c.ShipOrder(ctx, &pb.ShipOrderRequest{Address: address, Items: items})
+			if err != nil {
+				t.Fatalf("TestGoldenTraces: %v", err)
+			}
+			c.GenerateLabel(ctx, &pb.GenerateLabelRequest{TrackingId: res.TrackingId})
+		}},
+		{"get_bulk_quote", func(ctx context.Context, c pb.ShippingServiceClient) {
+			stream, err := c.GetBulkQuote(ctx)
+			if err != nil {
+				t.Fatalf("TestGoldenTraces: %v", err)
+			}
+			stream.Send(&pb.GetQuoteRequest{Address: address, Items: items})
+			stream.Send(&pb.GetQuoteRequest{Address: &pb.Address{Country: "France"}, Items: items})
+			stream.CloseAndRecv()
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Deterministic mode makes the IDs reproducible, whichever
+			// cases run before this one.
+			setDeterministic(true, defaultDeterministicSeed)
+			defer setDeterministic(false, 0)
+			rec := tracetest.NewSpanRecorder()
+			client, stop := goldenClient(t, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+			tc.run(context.Background(), client)
+			stop()
+
+			got := goldenTree(rec.Ended())
+			path := filepath.Join("testdata", "golden", tc.name+".json")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("TestGoldenTraces: %v (run with -update to create it)", err)
+			}
+			if line, g, w := firstDiff(got, want); line > 0 {
+				t.Errorf("TestGoldenTraces: %s differs at line %d:\n got: %s\nwant: %s\nrun with -update if the change is intended", path, line, g, w)
+			}
+		})
+	}
+}
+
+// goldenClient serves a new server instrumented like main's, with every
+// span recorded by tp, and returns a client instrumented the same way. stop
+// closes both once every span has ended.
+func goldenClient(t *testing.T, tp *sdktrace.TracerProvider) (client pb.ShippingServiceClient, stop func()) {
+	saved := tracer
+	tracer = tp.Tracer("ExampleService")
+	t.Cleanup(func() { tracer = saved })
+
+	prop := propagation.TraceContext{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(prop))),
+		grpc.ChainUnaryInterceptor(timeoutInterceptor(nil)),
+	)
+	pb.RegisterShippingServiceServer(srv, newServer())
+	go srv.Serve(lis)
+
+	cc, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(prop))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pb.NewShippingServiceClient(cc), func() {
+		cc.Close()
+		srv.GracefulStop()
+	}
+}
+
+// goldenTree arranges spans into trees and encodes them as indented JSON.
+// Siblings are sorted by their encoding, as concurrent spans end in any
+// order.
+func goldenTree(spans []sdktrace.ReadOnlySpan) []byte {
+	nodes := make(map[trace.SpanID]*goldenSpan)
+	for _, s := range spans {
+		n := &goldenSpan{
+			Name:       s.Name(),
+			Kind:       s.SpanKind().String(),
+			Status:     strings.TrimSpace(s.Status().Code.String() + " " + s.Status().Description),
+			Attributes: goldenAttributes(s.Attributes()),
+		}
+		for _, e := range s.Events() {
+			n.Events = append(n.Events, goldenEvent{Name: e.Name, Attributes: goldenAttributes(e.Attributes)})
+		}
+		nodes[s.SpanContext().SpanID()] = n
+	}
+	var roots []*goldenSpan
+	for _, s := range spans {
+		n := nodes[s.SpanContext().SpanID()]
+		if parent, ok := nodes[s.Parent().SpanID()]; ok && s.Parent().IsValid() {
+			parent.Children = append(parent.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	sortSpans(roots)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(roots)
+	return buf.Bytes()
+}
+
+func goldenAttributes(kvs []attribute.KeyValue) map[string]string {
+	if len(kvs) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		if goldenVolatile[string(kv.Key)] {
+			m[string(kv.Key)] = "<volatile>"
+		} else {
+			m[string(kv.Key)] = kv.Value.Emit()
+		}
+	}
+	return m
+}
+
+// sortSpans sorts spans and, first, their descendants.
+func sortSpans(spans []*goldenSpan) {
+	keys := make(map[*goldenSpan]string, len(spans))
+	for _, s := range spans {
+		sortSpans(s.Children)
+		b, _ := json.Marshal(s)
+		keys[s] = string(b)
+	}
+	sort.Slice(spans, func(i, j int) bool { return keys[spans[i]] < keys[spans[j]] })
+}
+
+// firstDiff returns the first line that differs between got and want,
+// numbered from 1, or 0 if they are equal.
+func firstDiff(got, want []byte) (int, string, string) {
+	if bytes.Equal(got, want) {
+		return 0, "", ""
+	}
+	g, w := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; ; i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl || i >= len(g) || i >= len(w) {
+			return i + 1, gl, wl
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// This file parses the subset of GraphQL served by the GraphQL API:
+// queries and mutations with variables, arguments, aliases and nested
+// selections. Fragments, directives and subscriptions are rejected.
+
+// gqlOperation is an operation of a GraphQL document.
+type gqlOperation struct {
+	kind      string // "query" or "mutation"
+	name      string
+	vars      []gqlVarDef
+	selection []gqlField
+}
+
+type gqlVarDef struct {
+	name     string
+	required bool
+	def      interface{}
+}
+
+// gqlField is a selected field. Argument values are JSON-like: nil, bool,
+// string (for strings and enum values), json.Number, []interface{} and
+// map[string]interface{}, with gqlVariable for references to variables.
+type gqlField struct {
+	alias     string
+	name      string
+	args      map[string]interface{}
+	selection []gqlField
+}
+
+// key is the name of the field in the response.
+func (f gqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type gqlVariable string
+
+// gqlSyntaxError is panicked by the parser and recovered by parseGraphQL.
+type gqlSyntaxError struct{ msg string }
+
+// parseGraphQL parses a document and returns the operation to run: the one
+// called operationName, or the only one.
+func parseGraphQL(src, operationName string) (op *gqlOperation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(gqlSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			op, err = nil, fmt.Errorf("syntax error: %s", se.msg)
+		}
+	}()
+	p := &gqlParser{src: src}
+	p.advance()
+	var ops []*gqlOperation
+	for p.tok.kind != gqlEOF {
+		ops = append(ops, p.operation())
+	}
+	for _, o := range ops {
+		if o.name == operationName || (operationName == "" && len(ops) == 1) {
+			return o, nil
+		}
+	}
+	if operationName == "" {
+		return nil, fmt.Errorf("the document has %d operations, operationName must name one", len(ops))
+	}
+	return nil, fmt.Errorf("unknown operation %q", operationName)
+}
+
+const (
+	gqlEOF = iota
+	gqlName
+	gqlNumber
+	gqlString
+	gqlPunct
+)
+
+type gqlToken struct {
+	kind int
+	text string
+}
+
+type gqlParser struct {
+	src string
+	pos int
+	tok gqlToken
+}
+
+func (p *gqlParser) fail(format string, args ...interface{}) {
+	panic(gqlSyntaxError{fmt.Sprintf("%s at offset %d", fmt.Sprintf(format, args...), p.pos)})
+}
+
+// advance reads the next token into p.tok.
+func (p *gqlParser) advance() {
+	// Commas, like white space, are insignificant in GraphQL.
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else {
+			break
+		}
+	}
+	if p.pos == len(p.src) {
+		p.tok = gqlToken{kind: gqlEOF}
+		return
+	}
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = gqlToken{gqlName, p.src[start:p.pos]}
+	case c == '-' || isDigit(c):
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		if !json.Valid([]byte(text)) {
+			p.fail("invalid number %q", text)
+		}
+		p.tok = gqlToken{gqlNumber, text}
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			p.fail("block strings are not supported")
+		}
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			p.fail("unterminated string")
+		}
+		p.pos++
+		// GraphQL string escapes are the same as JSON's.
+		var s string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+			p.fail("invalid string %s", p.src[start:p.pos])
+		}
+		p.tok = gqlToken{gqlString, s}
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = gqlToken{gqlPunct, "..."}
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		p.pos++
+		p.tok = gqlToken{gqlPunct, string(c)}
+	default:
+		p.fail("unexpected character %q", c)
+	}
+}
+
+func isLetter(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isDigit(c byte) bool  { return '0' <= c && c <= '9' }
+
+func (p *gqlParser) is(punct string) bool {
+	return p.tok.kind == gqlPunct && p.tok.text == punct
+}
+
+func (p *gqlParser) expect(punct string) {
+	if !p.is(punct) {
+		p.fail("expected %q, got %q", punct, p.tok.text)
+	}
+	p.advance()
+}
+
+func (p *gqlParser) name() string {
+	if p.tok.kind != gqlName {
+		p.fail("expected a name, got %q", p.tok.text)
+	}
+	n := p.tok.text
+	p.advance()
+	return n
+}
+
+func (p *gqlParser) operation() *gqlOperation {
+	op := &gqlOperation{kind: "query"}
+	if p.tok.kind == gqlName {
+		switch op.kind = p.name(); op.kind {
+		case "query", "mutation":
+		case "subscription", "fragment":
+			p.fail("%ss are not supported", op.kind)
+		default:
+			p.fail("unknown operation type %q", op.kind)
+		}
+		if p.tok.kind == gqlName {
+			op.name = p.name()
+		}
+		if p.is("(") {
+			p.advance()
+			for !p.is(")") {
+				op.vars = append(op.vars, p.varDef())
+			}
+			p.advance()
+		}
+	}
+	op.selection = p.selectionSet()
+	return op
+}
+
+func (p *gqlParser) varDef() gqlVarDef {
+	p.expect("$")
+	v := gqlVarDef{name: p.name()}
+	p.expect(":")
+	v.required = p.typeRef()
+	if p.is("=") {
+		p.advance()
+		v.def = p.value(true)
+	}
+	return v
+}
+
+// typeRef skips a type reference and reports whether it is non-null. Values
+// are checked against the request messages, not the GraphQL types.
+func (p *gqlParser) typeRef() bool {
+	if p.is("[") {
+		p.advance()
+		p.typeRef()
+		p.expect("]")
+	} else {
+		p.name()
+	}
+	if p.is("!") {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) selectionSet() []gqlField {
+	p.expect("{")
+	var fields []gqlField
+	for !p.is("}") {
+		if p.is("...") {
+			p.fail("fragments are not supported")
+		}
+		f := gqlField{name: p.name()}
+		if p.is(":") {
+			p.advance()
+			f.alias, f.name = f.name, p.name()
+		}
+		if p.is("(") {
+			p.advance()
+			f.args = make(map[string]interface{})
+			for !p.is(")") {
+				n := p.name()
+				p.expect(":")
+				f.args[n] = p.value(false)
+			}
+			p.advance()
+		}
+		if p.is("@") {
+			p.fail("directives are not supported")
+		}
+		if p.is("{") {
+			f.selection = p.selectionSet()
+		}
+		fields = append(fields, f)
+	}
+	p.advance()
+	return fields
+}
+
+// value parses a value; constant values, such as variable defaults, cannot
+// refer to variables.
+func (p *gqlParser) value(constant bool) interface{} {
+	tok := p.tok
+	switch {
+	case p.is("$"):
+		if constant {
+			p.fail("variables are not allowed here")
+		}
+		p.advance()
+		return gqlVariable(p.name())
+	case p.is("["):
+		p.advance()
+		list := []interface{}{}
+		for !p.is("]") {
+			list = append(list, p.value(constant))
+		}
+		p.advance()
+		return list
+	case p.is("{"):
+		p.advance()
+		obj := make(map[string]interface{})
+		for !p.is("}") {
+			n := p.name()
+			p.expect(":")
+			obj[n] = p.value(constant)
+		}
+		p.advance()
+		return obj
+	case tok.kind == gqlNumber:
+		p.advance()
+		return json.Number(tok.text)
+	case tok.kind == gqlString:
+		p.advance()
+		return tok.text
+	case tok.kind == gqlName:
+		p.advance()
+		switch tok.text {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return tok.text // an enum value
+	}
+	p.fail("expected a value, got %q", tok.text)
+	return nil
+}
+
+// substitute replaces the variables in an argument value with their values.
+func substitute(v interface{}, vars map[string]interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case gqlVariable:
+		val, ok := vars[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", v)
+		}
+		return val, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			var err error
+			if out[i], err = substitute(e, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			var err error
+			if out[k], err = substitute(e, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseGraphQL checks that a document with variables, aliases and every
+// kind of value parses.
+func TestParseGraphQL(t *testing.T) {
+	op, err := parseGraphQL(`
+		# Comments and commas are ignored.
+		mutation Ship($items: [CartItemInput!]!, $method: String = "express") {
+			order: shipOrder(address: {country: "USA", zipCode: 94043}, items: $items, tags: [1, -2.5e3, true, null, EXPRESS]) {
+				trackingId
+				costUsd { units, nanos }
+			}
+		}`, "")
+	if err != nil {
+		t.Fatalf("TestParseGraphQL: %v", err)
+	}
+	if op.kind != "mutation" || op.name != "Ship" || len(op.vars) != 2 {
+		t.Fatalf("TestParseGraphQL: got operation %+v", op)
+	}
+	if !op.vars[0].required || op.vars[1].required || op.vars[1].def != "express" {
+		t.Errorf("TestParseGraphQL: got variables %+v", op.vars)
+	}
+	f := op.selection[0]
+	if f.alias != "order" || f.name != "shipOrder" || len(f.selection) != 2 || len(f.selection[1].selection) != 2 {
+		t.Errorf("TestParseGraphQL: got field %+v", f)
+	}
+	wantArgs := map[string]interface{}{
+		"address": map[string]interface{}{"country": "USA", "zipCode": json.Number("94043")},
+		"items":   gqlVariable("items"),
+		"tags":    []interface{}{json.Number("1"), json.Number("-2.5e3"), true, nil, "EXPRESS"},
+	}
+	if !reflect.DeepEqual(f.args, wantArgs) {
+		t.Errorf("TestParseGraphQL: got arguments %#v, expected %#v", f.args, wantArgs)
+	}
+	args, err := substitute(f.args, map[string]interface{}{"items": []interface{}{"x"}})
+	if err != nil || !reflect.DeepEqual(args.(map[string]interface{})["items"], []interface{}{"x"}) {
+		t.Errorf("TestParseGraphQL: substituted %v, %v", args, err)
+	}
+	if _, err := substitute(f.args, nil); err == nil {
+		t.Errorf("TestParseGraphQL: an undefined variable was accepted")
+	}
+}
+
+// TestParseGraphQLErrors checks that unsupported or malformed documents are
+// rejected.
+func TestParseGraphQLErrors(t *testing.T) {
+	for _, tc := range []struct{ doc, op, want string }{
+		{`{ quote { ...Fields } }`, "", "fragments are not supported"},
+		{`{ quote @skip(if: true) }`, "", "directives are not supported"},
+		{`subscription { quote }`, "", "subscriptions are not supported"},
+		{`{ quote(id: "open) }`, "", "unterminated string"},
+		{`{ quote`, "", "expected a name"},
+		{`query ($x: Int = $y) { quote }`, "", "variables are not allowed"},
+		{`query A { a } query B { b }`, "", "operationName must name one"},
+		{`query A { a }`, "B", `unknown operation "B"`},
+	} {
+		if _, err := parseGraphQL(tc.doc, tc.op); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("TestParseGraphQLErrors: %s got error %v, expected %q", tc.doc, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/protoadapt"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	graphqlPath         = "/graphql"
+	maxGraphQLBodyBytes = 1 << 20
+)
+
+// graphqlResolver resolves a root field from its arguments, encoded as JSON.
+type graphqlResolver func(ctx context.Context, args []byte) (protoadapt.MessageV1, error)
+
+// graphqlHandler serves a GraphQL API over the gRPC handlers:
+//
+//	type Query {
+//	  quote(address: Address!, items: [CartItem!]!, method: ShippingMethod, options: ShippingOptions,
+//	        dimensions: [ItemDimensions!]): GetQuoteResponse
+//	  trackShipment(trackingId: String!): GetTrackingStatusResponse
+//	  shipmentHistory(trackingId: String!): GetShipmentHistoryResponse
+//	}
+//	type Mutation {
+//	  shipOrder(address: Address!, items: [CartItem!]!, quoteId: String, options: ShippingOptions,
+//	            dimensions: [ItemDimensions!]): ShipOrderResponse
+//	}
+//
+// Arguments and results are the proto messages in their JSON form, so field
+// names are those of demo.proto in lowerCamelCase. Every operation and every
+// resolver is a span, under the HTTP server span.
+type graphqlHandler struct {
+	s         *server
+	resolvers map[string]map[string]graphqlResolver
+}
+
+func newGraphQLHandler(s *server) *graphqlHandler {
+	return &graphqlHandler{s: s, resolvers: map[string]map[string]graphqlResolver{
+		"query": {
+			"quote": func(ctx context.Context, args []byte) (protoadapt.MessageV1, error) {
+				req := &pb.GetQuoteRequest{}
+				if err := unmarshalArgs(ctx, args, req); err != nil {
+					return nil, err
+				}
+				return s.GetQuote(ctx, req)
+			},
+			"trackShipment": func(ctx context.Context, args []byte) (protoadapt.MessageV1, error) {
+				req := &pb.GetTrackingStatusRequest{}
+				if err := unmarshalArgs(ctx, args, req); err != nil {
+					return nil, err
+				}
+				return s.GetTrackingStatus(ctx, req)
+			},
+			"shipmentHistory": func(ctx context.Context, args []byte) (protoadapt.MessageV1, error) {
+				req := &pb.GetShipmentHistoryRequest{}
+				if err := unmarshalArgs(ctx, args, req); err != nil {
+					return nil, err
+				}
+				return s.GetShipmentHistory(ctx, req)
+			},
+		},
+		"mutation": {
+			"shipOrder": func(ctx context.Context, args []byte) (protoadapt.MessageV1, error) {
+				req := &pb.ShipOrderRequest{}
+				if err := unmarshalArgs(ctx, args, req); err != nil {
+					return nil, err
+				}
+				return s.ShipOrder(ctx, req)
+			},
+		},
+	}}
+}
+
+func unmarshalArgs(ctx context.Context, args []byte, req protoadapt.MessageV1) error {
+	if err := protojson.Unmarshal(args, protoadapt.MessageV2Of(req)); err != nil {
+		return rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, fmt.Sprintf("invalid arguments: %v", err))
+	}
+	return nil
+}
+
+// graphqlServerFromEnv returns the GraphQL API server listening on
+// GRAPHQL_PORT, or nil if it is not set.
+func graphqlServerFromEnv(s *server) *http.Server {
+	port := os.Getenv("GRAPHQL_PORT")
+	if port == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(graphqlPath, newGraphQLHandler(s))
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           otelhttp.NewHandler(mux, "graphql"),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type graphqlError struct {
+	Message    string            `json:"message"`
+	Path       []string          `json:"path,omitempty"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+type graphqlResponse struct {
+	Data   *gqlObject     `json:"data,omitempty"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+func (h *graphqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeGraphQLRequest(w, r)
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}})
+		return
+	}
+	op, err := parseGraphQL(req.Query, req.OperationName)
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}})
+		return
+	}
+	if op.kind == "mutation" && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGraphQL(w, http.StatusMethodNotAllowed, graphqlResponse{Errors: []graphqlError{{Message: "mutations must be sent with POST"}}})
+		return
+	}
+	vars, err := op.variables(req.Variables)
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}})
+		return
+	}
+
+	// Headers are passed on as gRPC metadata, so that x-tenant-id,
+	// idempotency-key and the like work as they do over gRPC.
+	md := metadata.MD{}
+	for k, v := range r.Header {
+		md[strings.ToLower(k)] = v
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	tn := h.s.tenants.resolve(ctx)
+	if tn.err != nil {
+		writeGraphQL(w, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: tn.err.Error()}}})
+		return
+	}
+	if !h.s.tenants.allow(tn.ID) {
+		writeGraphQL(w, http.StatusTooManyRequests, graphqlResponse{Errors: []graphqlError{{Message: fmt.Sprintf("tenant %q is over its rate limit", tn.ID)}}})
+		return
+	}
+	ctx = context.WithValue(ctx, tenantKey{}, tn)
+
+	ctx, span := tracer.Start(ctx, strings.TrimSpace(op.kind+" "+op.name), trace.WithAttributes(
+		attribute.String("graphql.operation.type", op.kind),
+		attribute.String("graphql.operation.name", op.name),
+		attribute.String("graphql.document", req.Query),
+		attribute.String("tenant.id", tn.ID),
+	))
+	defer span.End()
+
+	res := graphqlResponse{Data: &gqlObject{}}
+	for _, f := range op.selection {
+		v, err := h.resolve(ctx, op.kind, f, vars)
+		if err != nil {
+			res.Errors = append(res.Errors, graphqlErrorOf(f.key(), err))
+		}
+		*res.Data = append(*res.Data, gqlEntry{f.key(), v})
+	}
+	if len(res.Errors) > 0 {
+		span.SetStatus(otelcodes.Error, res.Errors[0].Message)
+	}
+	writeGraphQL(w, http.StatusOK, res)
+}
+
+// resolve resolves a root field in its own span and returns the selected
+// part of the result.
+func (h *graphqlHandler) resolve(ctx context.Context, kind string, f gqlField, vars map[string]interface{}) (interface{}, error) {
+	parent := "Query"
+	if kind == "mutation" {
+		parent = "Mutation"
+	}
+	resolver, ok := h.resolvers[kind][f.name]
+	if !ok {
+		return nil, fmt.Errorf("cannot query field %q on type %q", f.name, parent)
+	}
+	ctx, span := tracer.Start(ctx, parent+"."+f.name, trace.WithAttributes(
+		attribute.String("graphql.field.name", f.name),
+		attribute.String("graphql.field.path", f.key()),
+	))
+	defer span.End()
+
+	v, err := func() (interface{}, error) {
+		args, err := substitute(f.args, vars)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		res, err := resolver(ctx, raw)
+		if err != nil {
+			return nil, err
+		}
+		out, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(protoadapt.MessageV2Of(res))
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(out))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		return project(v, f.selection)
+	}()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, err
+	}
+	return v, nil
+}
+
+// variables returns the operation's variables, taking defaults for those
+// missing from the request.
+func (op *gqlOperation) variables(values map[string]interface{}) (map[string]interface{}, error) {
+	vars := make(map[string]interface{}, len(op.vars))
+	for _, d := range op.vars {
+		v, ok := values[d.name]
+		if !ok {
+			v, ok = d.def, d.def != nil
+		}
+		if (!ok || v == nil) && d.required {
+			return nil, fmt.Errorf("variable $%s is required", d.name)
+		}
+		vars[d.name] = v
+	}
+	return vars, nil
+}
+
+// project returns the fields of v selected by sel.
+func project(v interface{}, sel []gqlField) (interface{}, error) {
+	switch v := v.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			var err error
+			if out[i], err = project(e, sel); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]interface{}:
+		if len(sel) == 0 {
+			return nil, errors.New("an object field must select subfields")
+		}
+		obj := gqlObject{}
+		for _, f := range sel {
+			fv, ok := v[f.name]
+			if !ok {
+				return nil, fmt.Errorf("cannot query field %q", f.name)
+			}
+			p, err := project(fv, f.selection)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.key(), err)
+			}
+			obj = append(obj, gqlEntry{f.key(), p})
+		}
+		return obj, nil
+	}
+	if v != nil && len(sel) > 0 {
+		return nil, errors.New("a scalar field has no subfields")
+	}
+	return v, nil
+}
+
+// graphqlErrorOf reports a field error, with the gRPC code and error reason
+// as extensions.
+func graphqlErrorOf(key string, err error) graphqlError {
+	st := status.Convert(err)
+	e := graphqlError{Message: st.Message(), Path: []string{key}, Extensions: map[string]string{"code": st.Code().String()}}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			e.Extensions["reason"] = info.Reason
+		}
+	}
+	return e
+}
+
+// decodeGraphQLRequest reads a request sent as a JSON POST body or as GET
+// query parameters.
+func decodeGraphQLRequest(w http.ResponseWriter, r *http.Request) (graphqlRequest, error) {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			dec := json.NewDecoder(strings.NewReader(v))
+			dec.UseNumber()
+			if err := dec.Decode(&req.Variables); err != nil {
+				return req, fmt.Errorf("invalid variables: %v", err)
+			}
+		}
+	case http.MethodPost:
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodyBytes))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid request body: %v", err)
+		}
+	default:
+		return req, fmt.Errorf("method %s is not allowed", r.Method)
+	}
+	if req.Query == "" {
+		return req, errors.New("query is required")
+	}
+	return req, nil
+}
+
+func writeGraphQL(w http.ResponseWriter, code int, res graphqlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+// gqlObject is a JSON object that keeps its keys in selection order, as
+// GraphQL requires.
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.key)
+		v, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// postGraphQL sends a query to h and returns the status code and raw body.
+func postGraphQL(t *testing.T, h http.Handler, query string, vars map[string]interface{}) (int, string) {
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: vars})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, graphqlPath, strings.NewReader(string(body))))
+	return rec.Code, rec.Body.String()
+}
+
+// TestGraphQLAPI checks that a shipment created with a mutation can be
+// tracked with a query.
+func TestGraphQLAPI(t *testing.T) {
+	h := newGraphQLHandler(newServer())
+	address := map[string]interface{}{"streetAddress": "1600 Amphitheatre Parkway", "city": "Mountain View", "state": "CA", "country": "USA", "zipCode": 94043}
+	items := []interface{}{map[string]interface{}{"productId": "OLJCESPC7Z", "quantity": 2}}
+
+	code, body := postGraphQL(t, h, `mutation ($address: Address!, $items: [CartItem!]!) {
+		shipOrder(address: $address, items: $items) { trackingId }
+	}`, map[string]interface{}{"address": address, "items": items})
+	var shipped struct {
+		Data struct{ ShipOrder struct{ TrackingID string } }
+	}
+	if err := json.Unmarshal([]byte(body), &shipped); code != http.StatusOK || err != nil || shipped.Data.ShipOrder.TrackingID == "" {
+		t.Fatalf("TestGraphQLAPI: shipOrder returned %d %s", code, body)
+	}
+
+	// Aliases and the order of the selection are kept in the response.
+	_, body = postGraphQL(t, h, `{
+		b: trackShipment(trackingId: "`+shipped.Data.ShipOrder.TrackingID+`") { status trackingId }
+		a: quote(address: {country: "USA", state: "CA"}, items: [{productId: "OLJCESPC7Z", quantity: 1}]) { costUsd { currencyCode } }
+	}`, nil)
+	want := `{"data":{"b":{"status":"SHIPMENT_STATUS_CREATED","trackingId":"` + shipped.Data.ShipOrder.TrackingID + `"},"a":{"costUsd":{"currencyCode":"USD"}}}}`
+	if strings.TrimSpace(body) != want {
+		t.Errorf("TestGraphQLAPI: got %s, expected %s", body, want)
+	}
+}
+
+// TestGraphQLAPIErrors checks request errors and field errors.
+func TestGraphQLAPIErrors(t *testing.T) {
+	h := newGraphQLHandler(newServer())
+
+	// Field errors come with the gRPC code and reason, and leave the
+	// other fields resolved.
+	_, body := postGraphQL(t, h, `{
+		trackShipment(trackingId: "nope") { status }
+		quote(address: {country: "USA"}, items: []) { quoteId }
+	}`, nil)
+	var res graphqlResponse
+	var data map[string]interface{}
+	json.Unmarshal([]byte(body), &struct {
+		Data   *map[string]interface{}
+		Errors *[]graphqlError
+	}{&data, &res.Errors})
+	if len(res.Errors) != 1 || res.Errors[0].Path[0] != "trackShipment" || res.Errors[0].Extensions["reason"] != reasonMalformedTrackingID {
+		t.Errorf("TestGraphQLAPIErrors: got errors %+v", res.Errors)
+	}
+	if data["trackShipment"] != nil || data["quote"] == nil {
+		t.Errorf("TestGraphQLAPIErrors: got data %v", data)
+	}
+
+	for _, tc := range []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{`{ quote(`, http.StatusBadRequest, "syntax error"},
+		{`query ($id: String!) { trackShipment(trackingId: $id) { status } }`, http.StatusBadRequest, "variable $id is required"},
+		{`{ nothing { x } }`, http.StatusOK, `cannot query field \"nothing\" on type \"Query\"`},
+		{`{ quote(address: {country: "USA"}, items: []) { price } }`, http.StatusOK, `cannot query field \"price\"`},
+		{`{ quote(address: {country: "USA"}, items: []) { costUsd } }`, http.StatusOK, "must select subfields"},
+		{`{ quote(weight: 3) { quoteId } }`, http.StatusOK, "invalid arguments"},
+	} {
+		if code, body := postGraphQL(t, h, tc.query, nil); code != tc.code || !strings.Contains(body, tc.want) {
+			t.Errorf("TestGraphQLAPIErrors: %s returned %d %s, expected %d with %q", tc.query, code, body, tc.code, tc.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, graphqlPath+"?query="+url.QueryEscape(`mutation { shipOrder { trackingId } }`), nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("TestGraphQLAPIErrors: mutation over GET returned %d, expected %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// TestGraphQLSpans checks that every resolver is a child span of the
+// operation's span.
+func TestGraphQLSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	postGraphQL(t, newGraphQLHandler(newServer()), `query Quotes {
+		a: quote(address: {country: "USA"}, items: [{productId: "OLJCESPC7Z", quantity: 1}]) { quoteId }
+		b: quote(address: {country: "France"}, items: [{productId: "OLJCESPC7Z", quantity: 1}]) { quoteId }
+	}`, nil)
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = append(spans[s.Name()], s)
+	}
+	if len(spans["query Quotes"]) != 1 || len(spans["Query.quote"]) != 2 {
+		t.Fatalf("TestGraphQLSpans: got spans %v", spans)
+	}
+	op := spans["query Quotes"][0].SpanContext()
+	for _, s := range spans["Query.quote"] {
+		if s.Parent().SpanID() != op.SpanID() {
+			t.Errorf("TestGraphQLSpans: resolver span %s is not a child of the operation span", s.Name())
+		}
+	}
+}
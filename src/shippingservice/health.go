@@ -0,0 +1,232 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultHealthInterval = 10 * time.Second
+	healthCheckTimeout    = 2 * time.Second
+
+	// healthServicePrefix names the per-dependency services of the gRPC
+	// health protocol, e.g. "shippingservice.redis".
+	healthServicePrefix = serviceName + "."
+)
+
+type healthState string
+
+const (
+	healthOK       healthState = "ok"
+	healthDegraded healthState = "degraded"
+	healthDown     healthState = "down"
+	// healthDraining is reported while the service shuts down.
+	healthDraining healthState = "draining"
+)
+
+// healthCheck probes one dependency. Without a critical dependency the
+// service cannot do its job and stops reporting SERVING; a failing optional
+// one only makes it degraded.
+type healthCheck struct {
+	name     string
+	critical bool
+	probe    func(context.Context) error
+}
+
+// checkResult is the outcome of the latest probe of a dependency.
+type checkResult struct {
+	Status    healthState `json:"status"`
+	Critical  bool        `json:"critical"`
+	Error     string      `json:"error,omitempty"`
+	LatencyMs float64     `json:"latency_ms"`
+	CheckedAt time.Time   `json:"checked_at"`
+}
+
+type healthReport struct {
+	Status healthState            `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// healthRegistry probes the service's dependencies in the background, so
+// that health checks from kubelet and load balancers return immediately and
+// never pile load onto a struggling dependency.
+type healthRegistry struct {
+	mu      sync.Mutex
+	checks  []healthCheck
+	results map[string]checkResult
+	changed chan struct{}
+	// draining is set once the service starts shutting down.
+	draining bool
+}
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{results: make(map[string]checkResult), changed: make(chan struct{})}
+}
+
+// register adds a dependency. It must be called before watch.
+func (r *healthRegistry) register(name string, critical bool, probe func(context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, healthCheck{name: name, critical: critical, probe: probe})
+}
+
+// run probes every dependency once, concurrently.
+func (r *healthRegistry) run(ctx context.Context) {
+	r.mu.Lock()
+	checks := append([]healthCheck(nil), r.checks...)
+	r.mu.Unlock()
+
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := c.probe(ctx)
+			res := checkResult{
+				Status:    healthOK,
+				Critical:  c.critical,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				CheckedAt: start.UTC(),
+			}
+			if err != nil {
+				res.Status, res.Error = healthDown, err.Error()
+			}
+			results[i] = res
+		}(i, c)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for i, c := range checks {
+		if old, ok := r.results[c.name]; !ok || old.Status != results[i].Status {
+			changed = true
+			if ok {
+				log.Warnf("dependency %s is now %s: %s", c.name, results[i].Status, results[i].Error)
+			}
+		}
+		r.results[c.name] = results[i]
+	}
+	if changed {
+		close(r.changed)
+		r.changed = make(chan struct{})
+	}
+}
+
+// drain makes the service report NOT_SERVING from now on, whatever the state
+// of its dependencies, so that it is taken out of load balancing before it
+// stops.
+func (r *healthRegistry) drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.draining {
+		r.draining = true
+		close(r.changed)
+		r.changed = make(chan struct{})
+	}
+}
+
+// watch probes the dependencies every interval until ctx is done.
+func (r *healthRegistry) watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		r.run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// report returns the latest results and the overall state.
+func (r *healthRegistry) report() healthReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := healthReport{Status: healthOK, Checks: make(map[string]checkResult, len(r.results))}
+	for name, res := range r.results {
+		rep.Checks[name] = res
+		switch {
+		case res.Status == healthOK:
+		case res.Critical:
+			rep.Status = healthDown
+		case rep.Status == healthOK:
+			rep.Status = healthDegraded
+		}
+	}
+	if r.draining {
+		rep.Status = healthDraining
+	}
+	return rep
+}
+
+// servingStatus answers a gRPC health check. The empty service name asks
+// about the service as a whole, which is SERVING unless a critical
+// dependency is down; "shippingservice.<dependency>" asks about one
+// dependency. Everything is NOT_SERVING while the service drains. It returns
+// false for unknown names.
+func (r *healthRegistry) servingStatus(service string) (healthpb.HealthCheckResponse_ServingStatus, bool) {
+	rep := r.report()
+	state := rep.Status
+	if service != "" && service != serviceName {
+		name, ok := strings.CutPrefix(service, healthServicePrefix)
+		if !ok {
+			return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, false
+		}
+		res, ok := rep.Checks[name]
+		if !ok {
+			return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, false
+		}
+		state = res.Status
+	}
+	if state == healthDown || rep.Status == healthDraining {
+		return healthpb.HealthCheckResponse_NOT_SERVING, true
+	}
+	return healthpb.HealthCheckResponse_SERVING, true
+}
+
+// changes returns a channel that is closed when a result next changes.
+func (r *healthRegistry) changes() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+// ServeHTTP writes the report as JSON, with status 503 when the service is
+// down or draining, so it can double as an HTTP readiness probe.
+func (r *healthRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rep := r.report()
+	w.Header().Set("Content-Type", "application/json")
+	if rep.Status == healthDown || rep.Status == healthDraining {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(rep)
+}
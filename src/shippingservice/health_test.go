@@ -0,0 +1,99 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// TestHealthDependencies checks that a failing critical dependency takes the
+// service out of rotation, while a failing optional one only degrades it.
+func TestHealthDependencies(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	var redisErr, otlpErr error
+	s.health.register("redis", true, func(context.Context) error { return redisErr })
+	s.health.register("otlp", false, func(context.Context) error { return otlpErr })
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		res, err := s.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("TestHealthDependencies: Check(%q): %v", service, err)
+		}
+		return res.Status
+	}
+
+	otlpErr = errors.New("connection refused")
+	s.health.run(ctx)
+	if st := check(""); st != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("TestHealthDependencies: with OTLP down the service is %v, expected SERVING", st)
+	}
+	if st := check("shippingservice.otlp"); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("TestHealthDependencies: OTLP is %v, expected NOT_SERVING", st)
+	}
+	if rep := s.health.report(); rep.Status != healthDegraded || rep.Checks["otlp"].Error != "connection refused" {
+		t.Errorf("TestHealthDependencies: report is %+v, expected degraded with the OTLP error", rep)
+	}
+
+	redisErr = errors.New("i/o timeout")
+	s.health.run(ctx)
+	if st := check(""); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("TestHealthDependencies: with Redis down the service is %v, expected NOT_SERVING", st)
+	}
+
+	rec := httptest.NewRecorder()
+	s.health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var rep healthReport
+	if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil {
+		t.Fatalf("TestHealthDependencies: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || rep.Status != healthDown || !rep.Checks["redis"].Critical {
+		t.Errorf("TestHealthDependencies: /healthz returned %d %+v", rec.Code, rep)
+	}
+
+	_, err := s.Check(ctx, &healthpb.HealthCheckRequest{Service: "shippingservice.postgres"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("TestHealthDependencies: unknown dependency returned %v, expected NotFound", err)
+	}
+}
+
+// TestExportHealth checks that the OTLP probe follows the latest export.
+func TestExportHealth(t *testing.T) {
+	tel := newSDKTelemetry(10)
+	e := tel.exporter(&flakySpanExporter{InMemoryExporter: tracetest.NewInMemoryExporter()})
+	ctx := context.Background()
+
+	if err := tel.exportHealth(ctx); err != nil {
+		t.Errorf("TestExportHealth: before any export: %v", err)
+	}
+	e.ExportSpans(ctx, nil)
+	if err := tel.exportHealth(ctx); err == nil {
+		t.Errorf("TestExportHealth: expected an error after a failed export")
+	}
+	e.ExportSpans(ctx, nil)
+	if err := tel.exportHealth(ctx); err != nil {
+		t.Errorf("TestExportHealth: after a successful export: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// historyEntry is one change of state of a shipment. Entries are only ever
+// appended, never changed.
+type historyEntry struct {
+	Seq     int64
+	EventID string
+	From    pb.ShipmentStatus
+	To      pb.ShipmentStatus
+	Time    time.Time
+	TraceID trace.TraceID
+}
+
+// newHistoryEntry returns the entry recording a change from one status to
+// another, made in the trace of ctx. The repository numbers it.
+func newHistoryEntry(ctx context.Context, ev shipmentEvent, from, to pb.ShipmentStatus) historyEntry {
+	return historyEntry{
+		EventID: ev.ID,
+		From:    from,
+		To:      to,
+		Time:    ev.Time,
+		TraceID: trace.SpanContextFromContext(ctx).TraceID(),
+	}
+}
+
+// shipmentHistory is the event log of every shipment, by tenant and then
+// tracking ID. Like the outbox it is not safe for concurrent use; the
+// in-memory repository writes it under the same lock as the shipment, so the
+// log holds exactly the changes that happened.
+type shipmentHistory struct {
+	entries map[string]map[string][]historyEntry
+}
+
+func (h *shipmentHistory) append(tenant, id string, e historyEntry) {
+	if h.entries == nil {
+		h.entries = make(map[string]map[string][]historyEntry)
+	}
+	if h.entries[tenant] == nil {
+		h.entries[tenant] = make(map[string][]historyEntry)
+	}
+	rows := h.entries[tenant][id]
+	e.Seq = int64(len(rows)) + 1
+	h.entries[tenant][id] = append(rows, e)
+}
+
+// get returns a copy of the history of a tenant's shipment, oldest first.
+func (h *shipmentHistory) get(tenant, id string) []historyEntry {
+	rows := h.entries[tenant][id]
+	if len(rows) == 0 {
+		return nil
+	}
+	return append([]historyEntry(nil), rows...)
+}
+
+// remove drops the history of a tenant's shipment and returns how many
+// entries it had.
+func (h *shipmentHistory) remove(tenant, id string) int {
+	n := len(h.entries[tenant][id])
+	delete(h.entries[tenant], id)
+	if len(h.entries[tenant]) == 0 {
+		delete(h.entries, tenant)
+	}
+	return n
+}
+
+// replayStatus returns the status that a shipment reaches by going through the
+// entries in order.
+func replayStatus(entries []historyEntry) pb.ShipmentStatus {
+	status := pb.ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
+	for _, e := range entries {
+		status = e.To
+	}
+	return status
+}
+
+// history returns the history of a tenant's shipment, oldest first.
+func (st *shipmentStore) history(ctx context.Context, tenant, id string) ([]historyEntry, error) {
+	return st.repo.history(ctx, tenant, id)
+}
+
+// GetShipmentHistory returns the timeline of a shipment, rebuilt from its
+// recorded changes of state.
+func (s *server) GetShipmentHistory(ctx context.Context, in *pb.GetShipmentHistoryRequest) (*pb.GetShipmentHistoryResponse, error) {
+	log.Ctx(ctx).Info("[GetShipmentHistory] received request")
+	defer log.Ctx(ctx).Info("[GetShipmentHistory] completed request")
+
+	id, err := ParseTrackingId(in.TrackingId)
+	if err != nil {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonMalformedTrackingID, nil, err.Error(),
+			badRequest(&errdetails.BadRequest_FieldViolation{Field: "tracking_id", Description: err.Error()}))
+	}
+	entries, err := s.shipments.history(ctx, tenantFromContext(ctx).ID, id.String())
+	if errors.Is(err, errShipmentNotFound) {
+		return nil, shipmentNotFound(ctx, in.TrackingId)
+	}
+	if err != nil {
+		return nil, backendUnavailable(ctx, "read shipment history", err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("shipment.history.events", len(entries)))
+
+	res := &pb.GetShipmentHistoryResponse{TrackingId: id.String(), Status: replayStatus(entries)}
+	for _, e := range entries {
+		ev := &pb.ShipmentHistoryEvent{
+			Sequence:       e.Seq,
+			EventId:        e.EventID,
+			PreviousStatus: e.From,
+			Status:         e.To,
+			Time:           timestamppb.New(e.Time),
+		}
+		if e.TraceID.IsValid() {
+			ev.TraceId = e.TraceID.String()
+		}
+		res.Events = append(res.Events, ev)
+	}
+	return res, nil
+}
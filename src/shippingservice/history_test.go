@@ -0,0 +1,75 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestGetShipmentHistory checks that every change of state is recorded, in
+// order and with the trace that made it, and that the history goes with the
+// shipment.
+func TestGetShipmentHistory(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	s := newServer()
+	shipCtx, ship := tp.Tracer("test").Start(context.Background(), "ShipOrder")
+	res, err := s.ShipOrder(shipCtx, &pb.ShipOrderRequest{Address: &pb.Address{ZipCode: 94043}})
+	ship.End()
+	if err != nil {
+		t.Fatalf("TestGetShipmentHistory (%v) failed", err)
+	}
+	if _, err := s.CancelShipment(context.Background(), &pb.CancelShipmentRequest{TrackingId: res.TrackingId}); err != nil {
+		t.Fatalf("TestGetShipmentHistory (%v) failed", err)
+	}
+
+	h, err := s.GetShipmentHistory(context.Background(), &pb.GetShipmentHistoryRequest{TrackingId: res.TrackingId})
+	if err != nil {
+		t.Fatalf("TestGetShipmentHistory (%v) failed", err)
+	}
+	if h.Status != pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED || len(h.Events) != 2 {
+		t.Fatalf("TestGetShipmentHistory: got status %s and %d events, want CANCELLED and 2", h.Status, len(h.Events))
+	}
+	created, cancelled := h.Events[0], h.Events[1]
+	if created.Sequence != 1 || created.Status != pb.ShipmentStatus_SHIPMENT_STATUS_CREATED || created.PreviousStatus != pb.ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED {
+		t.Errorf("TestGetShipmentHistory: unexpected first event %v", created)
+	}
+	if cancelled.Sequence != 2 || cancelled.PreviousStatus != pb.ShipmentStatus_SHIPMENT_STATUS_CREATED {
+		t.Errorf("TestGetShipmentHistory: unexpected second event %v", cancelled)
+	}
+	if created.TraceId != ship.SpanContext().TraceID().String() || cancelled.TraceId != "" {
+		t.Errorf("TestGetShipmentHistory: trace IDs %q and %q, want the ShipOrder trace and none", created.TraceId, cancelled.TraceId)
+	}
+	if created.EventId == "" || created.EventId == cancelled.EventId {
+		t.Errorf("TestGetShipmentHistory: event IDs %q and %q are not distinct", created.EventId, cancelled.EventId)
+	}
+
+	_, err = s.GetShipmentHistory(context.Background(), &pb.GetShipmentHistoryRequest{TrackingId: CreateTrackingId("")})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("TestGetShipmentHistory: unknown ID returned %v, expected %s", err, codes.NotFound)
+	}
+	s.shipments.purgeFinished(context.Background(), time.Now().Add(time.Minute), retentionPolicy{})
+	_, err = s.GetShipmentHistory(context.Background(), &pb.GetShipmentHistoryRequest{TrackingId: res.TrackingId})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("TestGetShipmentHistory: purged shipment returned %v, expected %s", err, codes.NotFound)
+	}
+}
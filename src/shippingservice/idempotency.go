@@ -0,0 +1,157 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	idempotencyKeyHeader  = "idempotency-key"
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyPendingTTL bounds how long a key stays claimed by a
+	// request that never completes or releases it, such as one whose
+	// replica crashed.
+	idempotencyPendingTTL = time.Minute
+)
+
+// errIdempotencyPending is returned by claim while another request holding
+// the key has not yet created its shipment.
+var errIdempotencyPending = errors.New("a request with this idempotency key is in progress")
+
+// idempotencyStore maps client-supplied idempotency keys to the tracking ID
+// of the shipment they created. A key is claimed as pending before the
+// shipment is created, and is then either completed, once the shipment
+// exists, or released, so that a retry of a failed request can claim it
+// again.
+type idempotencyStore interface {
+	// claim associates key with trackingID, as pending, unless the key was
+	// already claimed. It returns the tracking ID the key maps to and
+	// whether this call claimed it, or errIdempotencyPending if the key is
+	// held by a request that has not completed.
+	claim(ctx context.Context, key, trackingID string) (string, bool, error)
+	// complete keeps the claim of key by trackingID for the TTL of the
+	// store.
+	complete(ctx context.Context, key, trackingID string) error
+	// release removes the pending claim of key by trackingID.
+	release(ctx context.Context, key, trackingID string) error
+}
+
+func idempotencyStoreFromEnv(rdb redis.UniversalClient) idempotencyStore {
+	ttl := envDuration("IDEMPOTENCY_TTL", defaultIdempotencyTTL)
+	if rdb != nil {
+		return &redisIdempotencyStore{rdb: rdb, ttl: ttl}
+	}
+	return newMemoryIdempotencyStore(ttl)
+}
+
+// idempotencyKey returns the idempotency key sent in the request metadata.
+// Keys of tenants other than the default one are prefixed with the tenant
+// ID, so that tenants choosing the same key do not see each other's
+// shipments, and the keys of the orders of a batch or stream are suffixed
+// with the order's item.
+func idempotencyKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	v := md.Get(idempotencyKeyHeader)
+	if len(v) == 0 || v[0] == "" {
+		return ""
+	}
+	key := v[0]
+	if item, ok := ctx.Value(idempotencyItemKey{}).(string); ok {
+		key += "#" + item
+	}
+	if tn := tenantFromContext(ctx).ID; tn != defaultTenant {
+		return tn + "/" + key
+	}
+	return key
+}
+
+type idempotencyItemKey struct{}
+
+// withIdempotencyItem returns a context for one order of a batch or stream.
+// The orders share the metadata of the call, so each is given its own
+// idempotency key, made of the call's key and item, instead of all of them
+// replaying the shipment of the first.
+func withIdempotencyItem(ctx context.Context, item string) context.Context {
+	return context.WithValue(ctx, idempotencyItemKey{}, item)
+}
+
+type idempotencyEntry struct {
+	trackingID string
+	pending    bool
+	expires    time.Time
+}
+
+// memoryIdempotencyStore keeps idempotency keys in process memory.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]idempotencyEntry
+}
+
+func newMemoryIdempotencyStore(ttl time.Duration) *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{ttl: ttl, entries: make(map[string]idempotencyEntry)}
+}
+
+func (s *memoryIdempotencyStore) claim(_ context.Context, key, trackingID string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.pending {
+			return "", false, errIdempotencyPending
+		}
+		return e.trackingID, false, nil
+	}
+	s.entries[key] = idempotencyEntry{trackingID: trackingID, pending: true, expires: now.Add(idempotencyPendingTTL)}
+	return trackingID, true, nil
+}
+
+func (s *memoryIdempotencyStore) complete(_ context.Context, key, trackingID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = idempotencyEntry{trackingID: trackingID, expires: time.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) release(_ context.Context, key, trackingID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.pending && e.trackingID == trackingID {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// purgeExpired removes the keys that expired by now and returns how many
+// there were.
+func (s *memoryIdempotencyStore) purgeExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Tracking ID payloads are Snowflake-style: 41 bits of milliseconds since
+// idEpoch, a 16 bit node ID and a 13 bit sequence number, 70 bits in all.
+// IDs from one node never repeat, and nodes with different IDs never collide.
+const (
+	idTimeBits = 41
+	idNodeBits = 16
+	idSeqBits  = 13
+	maxNodeID  = 1<<idNodeBits - 1
+
+	idPayloadBytes = (idTimeBits + idNodeBits + idSeqBits + 7) / 8
+)
+
+var idEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// idGenerator hands out unique payloads without locking.
+type idGenerator struct {
+	node uint64
+	// last is the most recently used (milliseconds << idSeqBits | sequence).
+	last atomic.Uint64
+	now  func() time.Time
+}
+
+func newIDGenerator(node uint16) *idGenerator {
+	return &idGenerator{node: uint64(node), now: time.Now}
+}
+
+// ids generates the tracking IDs of this replica.
+var ids = newIDGenerator(hostnameNodeID())
+
+// next returns a new payload. Each call takes the current millisecond and a
+// fresh sequence number; if 8192 IDs are issued within one millisecond, or
+// the clock goes backwards, the sequence carries into the next
+// millisecond instead of repeating a value. The payload is returned by
+// value, so that generating a tracking ID does not allocate it.
+func (g *idGenerator) next() [idPayloadBytes]byte {
+	for {
+		old := g.last.Load()
+		v := uint64(g.now().Sub(idEpoch).Milliseconds()) << idSeqBits
+		if v <= old {
+			v = old + 1
+		}
+		if g.last.CompareAndSwap(old, v) {
+			ms, seq := v>>idSeqBits, v&(1<<idSeqBits-1)
+			var b [idPayloadBytes]byte
+			putBits(b[:], 0, idTimeBits, ms)
+			putBits(b[:], idTimeBits, idNodeBits, g.node)
+			putBits(b[:], idTimeBits+idNodeBits, idSeqBits, seq)
+			return b
+		}
+	}
+}
+
+// putBits writes the low width bits of v into dst, most significant first,
+// starting at bit offset.
+func putBits(dst []byte, offset, width int, v uint64) {
+	for i := 0; i < width; i++ {
+		if v>>(width-1-i)&1 == 1 {
+			bit := offset + i
+			dst[bit/8] |= 1 << (7 - bit%8)
+		}
+	}
+}
+
+// nodeIDFromEnv returns INSTANCE_ID if it is set, and otherwise a hash of the
+// hostname, which is the pod name on Kubernetes. Set INSTANCE_ID, for example
+// from a StatefulSet ordinal, to guarantee that replicas never collide.
+func nodeIDFromEnv() uint16 {
+	v := os.Getenv("INSTANCE_ID")
+	if v == "" {
+		return hostnameNodeID()
+	}
+	n, err := strconv.ParseUint(v, 10, idNodeBits)
+	if err != nil {
+		log.Fatalf("INSTANCE_ID must be between 0 and %d: %v", maxNodeID, err)
+	}
+	return uint16(n)
+}
+
+func hostnameNodeID() uint16 {
+	host, _ := os.Hostname()
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	return uint16(h.Sum32() & maxNodeID)
+}
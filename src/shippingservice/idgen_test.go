@@ -0,0 +1,70 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIDGeneratorUnique checks that concurrent callers, a stopped clock and a
+// clock going backwards never produce the same ID twice.
+func TestIDGeneratorUnique(t *testing.T) {
+	clock := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	g := newIDGenerator(7)
+	g.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		clock = clock.Add(-time.Microsecond)
+		return clock
+	}
+
+	const workers, perWorker = 16, 2000
+	results := make(chan string, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				payload := g.next()
+				results <- encodeBase32(payload[:], trackingPayloadLen)
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[string]bool)
+	for id := range results {
+		if seen[id] {
+			t.Fatalf("TestIDGeneratorUnique: %s was generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+// TestIDGeneratorNodes checks that nodes issuing IDs at the same instant do not collide.
+func TestIDGeneratorNodes(t *testing.T) {
+	now := func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+	a, b := newIDGenerator(1), newIDGenerator(2)
+	a.now, b.now = now, now
+	pa, pb := a.next(), b.next()
+	if x, y := encodeBase32(pa[:], trackingPayloadLen), encodeBase32(pb[:], trackingPayloadLen); x == y {
+		t.Errorf("TestIDGeneratorNodes: nodes 1 and 2 both generated %s", x)
+	}
+}
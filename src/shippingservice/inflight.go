@@ -0,0 +1,126 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// inflightCall is an RPC being handled.
+type inflightCall struct {
+	Method   string    `json:"method"`
+	Peer     string    `json:"peer,omitempty"`
+	Tenant   string    `json:"tenant"`
+	Started  time.Time `json:"started"`
+	Elapsed  string    `json:"elapsed"`
+	Deadline string    `json:"deadline,omitempty"` // time left, negative once passed
+	TraceID  string    `json:"trace_id,omitempty"`
+	SpanID   string    `json:"span_id,omitempty"`
+	Sampled  bool      `json:"sampled"`
+
+	deadline time.Time
+}
+
+// inflightRegistry tracks the RPCs being handled, so that hung calls, such
+// as those delayed by chaos mode, can be found and followed to their trace.
+type inflightRegistry struct {
+	mu    sync.Mutex
+	next  uint64
+	calls map[uint64]*inflightCall
+	now   func() time.Time
+}
+
+func newInflightRegistry() *inflightRegistry {
+	return &inflightRegistry{calls: make(map[uint64]*inflightCall), now: time.Now}
+}
+
+// add registers a call and returns the function that removes it.
+func (r *inflightRegistry) add(ctx context.Context, method string) func() {
+	c := &inflightCall{Method: method, Tenant: tenantFromContext(ctx).ID, Started: r.now()}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		c.Peer = p.Addr.String()
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		c.TraceID, c.SpanID, c.Sampled = sc.TraceID().String(), sc.SpanID().String(), sc.IsSampled()
+	}
+	c.deadline, _ = ctx.Deadline()
+
+	r.mu.Lock()
+	id := r.next
+	r.next++
+	r.calls[id] = c
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		delete(r.calls, id)
+		r.mu.Unlock()
+	}
+}
+
+// list returns the calls in flight, longest-running first.
+func (r *inflightRegistry) list() []inflightCall {
+	now := r.now()
+	r.mu.Lock()
+	calls := make([]inflightCall, 0, len(r.calls))
+	for _, c := range r.calls {
+		calls = append(calls, *c)
+	}
+	r.mu.Unlock()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Started.Before(calls[j].Started) })
+	for i := range calls {
+		c := &calls[i]
+		c.Elapsed = now.Sub(c.Started).Round(time.Millisecond).String()
+		if !c.deadline.IsZero() {
+			c.Deadline = c.deadline.Sub(now).Round(time.Millisecond).String()
+		}
+	}
+	return calls
+}
+
+// unary returns an interceptor registering every call while it runs. It
+// belongs after the tenancy interceptor, which sets the call's tenant, and
+// before the timeout interceptor, so that a deadline shown is the client's.
+func (r *inflightRegistry) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		defer r.add(ctx, info.FullMethod)()
+		return handler(ctx, req)
+	}
+}
+
+// stream is unary for streaming RPCs. Streams stay listed for as long as
+// they are open.
+func (r *inflightRegistry) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		defer r.add(ss.Context(), info.FullMethod)()
+		return handler(srv, ss)
+	}
+}
+
+// ServeHTTP writes the calls in flight as JSON.
+func (r *inflightRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(r.list())
+}
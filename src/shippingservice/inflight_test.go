@@ -0,0 +1,86 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// TestInflight checks that a call is listed with its trace while it runs,
+// and removed once it returns.
+func TestInflight(t *testing.T) {
+	r := newInflightRegistry()
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}, TraceFlags: trace.FlagsSampled})
+	ctx := trace.ContextWithSpanContext(asTenant(context.Background(), "team-a"), sc)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 4242}})
+	ctx, cancel := context.WithDeadline(ctx, now.Add(5*time.Second))
+	defer cancel()
+
+	entered, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		r.unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/ShipOrder"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				close(entered)
+				<-release
+				return nil, nil
+			})
+	}()
+	<-entered
+	now = now.Add(1500 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/inflight", nil))
+	var calls []inflightCall
+	if err := json.Unmarshal(rec.Body.Bytes(), &calls); err != nil {
+		t.Fatalf("TestInflight: %v", err)
+	}
+	want := inflightCall{
+		Method:   "/hipstershop.ShippingService/ShipOrder",
+		Peer:     "10.0.0.7:4242",
+		Tenant:   "team-a",
+		Started:  time.Unix(1700000000, 0),
+		Elapsed:  "1.5s",
+		Deadline: "3.5s",
+		TraceID:  sc.TraceID().String(),
+		SpanID:   sc.SpanID().String(),
+		Sampled:  true,
+	}
+	if len(calls) != 1 || !calls[0].Started.Equal(want.Started) {
+		t.Fatalf("TestInflight: got %+v, expected %+v", calls, want)
+	}
+	calls[0].Started = want.Started
+	if calls[0] != want {
+		t.Errorf("TestInflight: got %+v, expected %+v", calls[0], want)
+	}
+
+	close(release)
+	<-done
+	if calls := r.list(); len(calls) != 0 {
+		t.Errorf("TestInflight: finished call is still listed: %+v", calls)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultJobWorkers = 2
+
+	// carrierLatency is the p50/p95/p99 of the simulated carrier booking API.
+	carrierLatency = "20ms/80ms/250ms"
+)
+
+// job is a piece of work done after the RPC that queued it has returned.
+type job struct {
+	name       string
+	tenant     string
+	trackingID string
+	ctx        context.Context
+	queued     time.Time
+	run        func(ctx context.Context) error
+}
+
+// jobQueue is a bounded queue of jobs worked off by a fixed number of
+// workers. Each job runs in a trace of its own, linked to the request that
+// queued it, as the request has usually finished by then, and with that
+// request's baggage.
+type jobQueue struct {
+	jobs    chan job
+	workers int
+}
+
+func newJobQueue(size, workers int) *jobQueue {
+	q := &jobQueue{jobs: make(chan job, size), workers: workers}
+	_, err := meter.Int64ObservableGauge("shipping.jobs.queue.depth",
+		metric.WithDescription("Jobs waiting for a worker."),
+		metric.WithUnit("{job}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(len(q.jobs)), metric.WithAttributes(attribute.Int("jobs.queue.capacity", cap(q.jobs))))
+			return nil
+		}),
+	)
+	if err != nil {
+		log.WithError(err).Warn("failed to create job queue metric")
+	}
+	return q
+}
+
+// jobQueueFromEnv returns a queue of JOB_QUEUE_SIZE jobs worked off by
+// JOB_WORKERS workers, or nil if the size is not set.
+func jobQueueFromEnv() *jobQueue {
+	size := envInt("JOB_QUEUE_SIZE", 0)
+	if size <= 0 {
+		return nil
+	}
+	workers := envInt("JOB_WORKERS", defaultJobWorkers)
+	log.Infof("queueing order processing: %d jobs, %d workers", size, workers)
+	return newJobQueue(size, workers)
+}
+
+func newJob(ctx context.Context, name string, sh shipment, run func(context.Context) error) job {
+	return job{
+		name:       name,
+		tenant:     sh.Tenant,
+		trackingID: sh.TrackingID,
+		ctx:        detachedContext(ctx),
+		queued:     time.Now(),
+		run:        run,
+	}
+}
+
+// enqueue queues a job, recording it on the request span. It returns false
+// if the queue is full; the caller then does the work itself.
+func (q *jobQueue) enqueue(ctx context.Context, j job) bool {
+	span := trace.SpanFromContext(ctx)
+	select {
+	case q.jobs <- j:
+		span.AddEvent("job.queued", trace.WithAttributes(attribute.String("job.name", j.name)))
+		return true
+	default:
+		span.AddEvent("job.rejected", trace.WithAttributes(attribute.String("job.name", j.name)))
+		log.Ctx(ctx).Warnf("job queue full, running %s for %s inline", j.name, j.trackingID)
+		return false
+	}
+}
+
+// run works off jobs until stop is closed, and then works off the jobs
+// still queued. Jobs still queued when ctx is done are dropped.
+func (q *jobQueue) run(ctx context.Context, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-q.jobs:
+					q.work(ctx, j)
+				case <-stop:
+					for ctx.Err() == nil {
+						select {
+						case j := <-q.jobs:
+							q.work(ctx, j)
+						default:
+							return
+						}
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(q.jobs); n > 0 {
+		log.Warnf("dropping %d queued jobs", n)
+	}
+}
+
+// work runs a job with the cancellation of ctx and the trace context and
+// baggage of the request that queued it.
+func (q *jobQueue) work(ctx context.Context, j job) {
+	run := func(ctx context.Context) error {
+		err := j.run(ctx)
+		if err != nil {
+			log.Ctx(ctx).WithError(err).Warnf("job %s for %s failed", j.name, j.trackingID)
+		}
+		return err
+	}
+	runTask(carryContext(ctx, j.ctx), linkedSpans, j.name, run,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("job.name", j.name),
+			attribute.Int64("job.queue.wait_ms", time.Since(j.queued).Milliseconds()),
+			attribute.String("tenant.id", j.tenant),
+			attribute.String("shipment.tracking_id", j.trackingID),
+		),
+	)
+}
+
+// processOrder does the work that follows a shipped order: rendering the
+// label, which is kept with the shipment for GenerateLabel, and booking the
+// carrier. With a queue the work is queued and processOrder returns at once;
+// without one nothing is done ahead of time.
+func (s *server) processOrder(ctx context.Context, tenant, trackingID string) {
+	if s.jobs == nil {
+		return
+	}
+	sh, err := s.shipments.get(ctx, tenant, trackingID)
+	if err != nil {
+		return
+	}
+	work := []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{"label.generate", func(ctx context.Context) error {
+			label, err := renderLabel(ctx, sh)
+			if err != nil {
+				return err
+			}
+			return s.shipments.attachLabel(ctx, sh.Tenant, sh.TrackingID, label)
+		}},
+		{"carrier.booking", func(ctx context.Context) error { return bookCarrier(ctx, sh) }},
+	}
+	for _, w := range work {
+		// Work done inline is traced like queued work, so that it looks
+		// the same whichever way it ran.
+		if j := newJob(ctx, w.name, sh, w.run); !s.jobs.enqueue(ctx, j) {
+			s.jobs.work(context.WithoutCancel(ctx), j)
+		}
+	}
+}
+
+var carrierShape, _ = parseLatencyShapes("Book=" + carrierLatency)
+
+// bookCarrier books a pickup with the simulated carrier, traced as a call to
+// an external API.
+func bookCarrier(ctx context.Context, sh shipment) error {
+	ctx, span := tracer.Start(ctx, "carrier.book", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("server.address", "api.carrier.example")))
+	defer span.End()
+	if err := sleepContext(ctx, carrierShape["Book"].sample()); err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("carrier.booking_id", newID("booking:"+sh.TrackingID)))
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestJobQueue checks that ShipOrder queues the order processing, that a
+// full queue makes it do the work itself, that the jobs still queued are
+// worked off when the workers are stopped, and that job spans link to the
+// request.
+func TestJobQueue(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	s := newServer()
+	s.jobs = newJobQueue(2, 1)
+	req := &pb.ShipOrderRequest{Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}}
+	ship := func() (string, sdktrace.ReadOnlySpan) {
+		ctx, span := tracer.Start(context.Background(), "ShipOrder")
+		res, err := s.ShipOrder(ctx, req)
+		span.End()
+		if err != nil {
+			t.Fatalf("TestJobQueue: ShipOrder failed: %v", err)
+		}
+		return res.TrackingId, span.(sdktrace.ReadOnlySpan)
+	}
+
+	queued, queuedSpan := ship()
+	if n := len(s.jobs.jobs); n != 2 {
+		t.Errorf("TestJobQueue: %d jobs queued, want 2", n)
+	}
+	if sh, _ := s.shipments.get(context.Background(), defaultTenant, queued); sh.Label != nil {
+		t.Error("TestJobQueue: label rendered before the job ran")
+	}
+	inline, inlineSpan := ship()
+	if sh, _ := s.shipments.get(context.Background(), defaultTenant, inline); sh.Label == nil {
+		t.Error("TestJobQueue: label not rendered inline with the queue full")
+	}
+	if n := countEvents(queuedSpan, "job.queued"); n != 2 {
+		t.Errorf("TestJobQueue: %d job.queued events, want 2", n)
+	}
+	if n := countEvents(inlineSpan, "job.rejected"); n != 2 {
+		t.Errorf("TestJobQueue: %d job.rejected events with the queue full, want 2", n)
+	}
+
+	// The workers are stopped before they start: they work off the queue
+	// and return.
+	stop := make(chan struct{})
+	close(stop)
+	stopped := make(chan struct{})
+	go func() {
+		s.jobs.run(context.Background(), stop)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("TestJobQueue: workers did not stop")
+	}
+	if sh, _ := s.shipments.get(context.Background(), defaultTenant, queued); sh.Label == nil {
+		t.Fatal("TestJobQueue: queued label job did not run")
+	}
+	if n := len(s.jobs.jobs); n != 0 {
+		t.Errorf("TestJobQueue: %d jobs left in the queue, want 0", n)
+	}
+
+	linked := 0
+	for _, sp := range rec.Ended() {
+		if sp.Name() != "label.generate" {
+			continue
+		}
+		if sp.Parent().IsValid() || len(sp.Links()) != 1 {
+			t.Errorf("TestJobQueue: label.generate has parent %v and links %v, want a root span with one link", sp.Parent(), sp.Links())
+			continue
+		}
+		if l := sp.Links()[0].SpanContext.SpanID(); l == queuedSpan.SpanContext().SpanID() || l == inlineSpan.SpanContext().SpanID() {
+			linked++
+		}
+	}
+	if linked != 2 {
+		t.Errorf("TestJobQueue: %d label.generate spans linked to ShipOrder, want 2", linked)
+	}
+
+	res, err := s.GenerateLabel(context.Background(), &pb.GenerateLabelRequest{TrackingId: queued})
+	if sh, _ := s.shipments.get(context.Background(), defaultTenant, queued); err != nil || string(res.Label) != string(sh.Label) {
+		t.Errorf("TestJobQueue: GenerateLabel did not return the rendered label (%v)", err)
+	}
+}
+
+func countEvents(span sdktrace.ReadOnlySpan, name string) int {
+	n := 0
+	for _, ev := range span.Events() {
+		if ev.Name == name {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultKafkaTopic = "shipments"
+
+// kafkaHeaderCarrier lets the OTel propagators read and write Kafka message
+// headers.
+type kafkaHeaderCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c kafkaHeaderCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c kafkaHeaderCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c kafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, h := range *c.headers {
+		keys[i] = h.Key
+	}
+	return keys
+}
+
+// kafkaPublisher writes shipment events to a Kafka topic, keyed by tracking
+// ID so that events for one shipment stay ordered. The trace context of the
+// producing request is injected into the message headers.
+type kafkaPublisher struct {
+	topic   string
+	writer  *kafka.Writer
+	encoder eventEncoder
+}
+
+// kafkaPublisherFromEnv builds a publisher from KAFKA_BROKERS and KAFKA_TOPIC,
+// or returns nil if no brokers are configured.
+func kafkaPublisherFromEnv() *kafkaPublisher {
+	brokers := splitList(os.Getenv("KAFKA_BROKERS"))
+	if len(brokers) == 0 {
+		return nil
+	}
+	topic := defaultKafkaTopic
+	if v := os.Getenv("KAFKA_TOPIC"); v != "" {
+		topic = v
+	}
+	log.Infof("publishing shipment events to Kafka topic %q at %v", topic, brokers)
+	return &kafkaPublisher{
+		topic:   topic,
+		encoder: eventEncoderFromEnv(),
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			BatchTimeout:           50 * time.Millisecond,
+			Async:                  true,
+			AllowAutoTopicCreation: true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.WithError(err).Errorf("failed to write %d event(s) to Kafka", len(messages))
+				}
+			},
+		},
+	}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, ev shipmentEvent) error {
+	ctx, span := tracer.Start(ctx, p.topic+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKey.String(p.topic),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingMessageIDKey.String(ev.ID),
+		),
+	)
+	defer span.End()
+
+	value, err := p.encoder.encode(ctx, ev)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	msg := kafka.Message{
+		Key:   []byte(ev.TrackingID),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event_type", Value: []byte(ev.Type)},
+			{Key: "content-type", Value: []byte(p.encoder.contentType())},
+		},
+	}
+	otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{&msg.Headers})
+
+	// The writer is asynchronous, so this only fails if the writer is closed;
+	// delivery errors are reported by the Completion callback.
+	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
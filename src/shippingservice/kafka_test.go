@@ -0,0 +1,46 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestKafkaHeaderCarrier checks that trace context survives a round trip through message headers.
+func TestKafkaHeaderCarrier(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	var headers []kafka.Header
+	prop := propagation.TraceContext{}
+	prop.Inject(ctx, kafkaHeaderCarrier{&headers})
+	if len(headers) != 1 || headers[0].Key != "traceparent" {
+		t.Fatalf("TestKafkaHeaderCarrier: unexpected headers %v", headers)
+	}
+
+	got := trace.SpanContextFromContext(prop.Extract(context.Background(), kafkaHeaderCarrier{&headers}))
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() {
+		t.Errorf("TestKafkaHeaderCarrier: extracted %v, expected %v", got, sc)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	labelWidth    = 600
+	labelHeight   = 400
+	labelMargin   = 24
+	barcodeModule = 2 // width in pixels of the narrowest bar
+	barcodeHeight = 120
+	labelMIMEType = "image/png"
+)
+
+// code128Patterns holds the bar/space widths of every Code 128 symbol, indexed
+// by symbol value. Values 103-105 are the start codes and 106 is the stop code.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = 106
+)
+
+var errUnencodable = errors.New("value cannot be encoded as Code 128B")
+
+// encodeCode128 encodes s using Code 128 subset B and returns the widths of
+// the alternating bars and spaces, starting with a bar.
+func encodeCode128(s string) ([]int, error) {
+	symbols := []int{code128StartB}
+	checksum := code128StartB
+	for i, r := range s {
+		if r < 32 || r > 127 {
+			return nil, fmt.Errorf("%w: %q", errUnencodable, r)
+		}
+		v := int(r) - 32
+		symbols = append(symbols, v)
+		checksum += (i + 1) * v
+	}
+	symbols = append(symbols, checksum%103, code128Stop)
+
+	var widths []int
+	for _, sym := range symbols {
+		for _, w := range code128Patterns[sym] {
+			widths = append(widths, int(w-'0'))
+		}
+	}
+	return widths, nil
+}
+
+// GenerateLabel renders a shipping label for an existing shipment.
+func (s *server) GenerateLabel(ctx context.Context, in *pb.GenerateLabelRequest) (*pb.GenerateLabelResponse, error) {
+	log.Ctx(ctx).Info("[GenerateLabel] received request")
+	defer log.Ctx(ctx).Info("[GenerateLabel] completed request")
+
+	sh, err := s.shipments.get(ctx, tenantFromContext(ctx).ID, in.TrackingId)
+	if errors.Is(err, errShipmentNotFound) {
+		return nil, shipmentNotFound(ctx, in.TrackingId)
+	}
+	if err != nil {
+		return nil, backendUnavailable(ctx, "read shipment", err)
+	}
+
+	if err := abandoned(ctx); err != nil {
+		return nil, err
+	}
+	// The label job may have rendered the label already.
+	label := sh.Label
+	if label == nil {
+		if label, err = renderLabel(ctx, sh); err != nil {
+			return nil, rpcError(ctx, codes.Internal, reasonInternal, map[string]string{"tracking_id": sh.TrackingID},
+				fmt.Sprintf("failed to render label: %v", err))
+		}
+	}
+
+	return &pb.GenerateLabelResponse{
+		TrackingId:  sh.TrackingID,
+		ContentType: labelMIMEType,
+		Label:       label,
+	}, nil
+}
+
+// renderLabel draws the label as a PNG image. This is deliberately done on the
+// CPU without caching, so it shows up clearly in profiles.
+func renderLabel(ctx context.Context, sh shipment) ([]byte, error) {
+	_, span := tracer.Start(ctx, "renderLabel")
+	defer span.End()
+
+	widths, err := encodeCode128(sh.TrackingID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, err
+	}
+
+	img := image.NewGray(image.Rect(0, 0, labelWidth, labelHeight))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	lines := []string{"SHIP TO:"}
+	if a := sh.Address; a != nil {
+		lines = append(lines,
+			a.StreetAddress,
+			fmt.Sprintf("%s, %s %d", a.City, a.State, a.ZipCode),
+			a.Country,
+		)
+	}
+	d := &font.Drawer{Dst: img, Src: image.Black, Face: basicfont.Face7x13}
+	for i, line := range lines {
+		d.Dot = fixed.P(labelMargin, labelMargin+(i+1)*20)
+		d.DrawString(line)
+	}
+
+	x := labelMargin
+	top := labelHeight - labelMargin - barcodeHeight - 20
+	for i, w := range widths {
+		if i%2 == 0 {
+			bar := image.Rect(x, top, x+w*barcodeModule, top+barcodeHeight)
+			draw.Draw(img, bar, &image.Uniform{C: color.Black}, image.Point{}, draw.Src)
+		}
+		x += w * barcodeModule
+	}
+	d.Dot = fixed.P(labelMargin, labelHeight-labelMargin)
+	d.DrawString(sh.TrackingID)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("label.bytes", buf.Len()))
+	return buf.Bytes(), nil
+}
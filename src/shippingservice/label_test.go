@@ -0,0 +1,65 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestCode128Patterns checks that every symbol is 11 modules wide (13 for the stop code).
+func TestCode128Patterns(t *testing.T) {
+	for v, p := range code128Patterns {
+		sum := 0
+		for _, w := range p {
+			sum += int(w - '0')
+		}
+		want := 11
+		if v == code128Stop {
+			want = 13
+		}
+		if sum != want {
+			t.Errorf("TestCode128Patterns: symbol %d is %d modules wide, expected %d", v, sum, want)
+		}
+	}
+}
+
+// TestGenerateLabel checks that a label is a decodable PNG for a known shipment.
+func TestGenerateLabel(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+
+	res, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{
+		Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"},
+	})
+	if err != nil {
+		t.Fatalf("TestGenerateLabel: ShipOrder (%v) failed", err)
+	}
+
+	label, err := s.GenerateLabel(ctx, &pb.GenerateLabelRequest{TrackingId: res.TrackingId})
+	if err != nil {
+		t.Fatalf("TestGenerateLabel (%v) failed", err)
+	}
+	if label.ContentType != "image/png" {
+		t.Errorf("TestGenerateLabel: content type is %q, expected %q", label.ContentType, "image/png")
+	}
+	if _, err := png.Decode(bytes.NewReader(label.Label)); err != nil {
+		t.Errorf("TestGenerateLabel: label is not a valid PNG: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// latencyShape is a target latency distribution for a method, given by its
+// 50th, 95th and 99th percentiles. In chaos mode each call is delayed by a
+// sample of it, so percentile exercises see a realistic long tail.
+type latencyShape struct {
+	p50, p95, p99 time.Duration
+}
+
+// parseLatencyShapes parses a comma-separated list of Method=p50/p95/p99
+// entries, e.g. "GetQuote=20ms/100ms/400ms,ShipOrder=50ms/250ms/1s".
+func parseLatencyShapes(s string) (map[string]latencyShape, error) {
+	out := make(map[string]latencyShape)
+	for _, kv := range splitList(s) {
+		method, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not of the form Method=p50/p95/p99", kv)
+		}
+		method = strings.TrimSpace(method)
+		parts := strings.Split(v, "/")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("latency of %s must be three durations, p50/p95/p99, got %q", method, v)
+		}
+		var ps [3]time.Duration
+		for i, p := range parts {
+			d, err := time.ParseDuration(strings.TrimSpace(p))
+			if err != nil {
+				return nil, fmt.Errorf("invalid latency for %s: %w", method, err)
+			}
+			ps[i] = d
+		}
+		shape := latencyShape{p50: ps[0], p95: ps[1], p99: ps[2]}
+		if shape.p50 < 0 || shape.p95 < shape.p50 || shape.p99 < shape.p95 {
+			return nil, fmt.Errorf("latency percentiles of %s must be non-negative and in increasing order", method)
+		}
+		if shape.max() > maxFaultDelay {
+			return nil, fmt.Errorf("latency of %s can reach %s, more than the maximum of %s", method, shape.max(), maxFaultDelay)
+		}
+		out[method] = shape
+	}
+	return out, nil
+}
+
+func latencyShapesFromEnv() map[string]latencyShape {
+	shapes, err := parseLatencyShapes(os.Getenv("CHAOS_LATENCY"))
+	if err != nil {
+		log.Fatalf("invalid CHAOS_LATENCY: %v", err)
+	}
+	return shapes
+}
+
+// max is the largest delay the shape produces: the tail beyond p99 is as
+// long again as the step from p95 to p99.
+func (l latencyShape) max() time.Duration {
+	return 2*l.p99 - l.p95
+}
+
+// quantile returns the delay at quantile q in [0, 1], interpolating linearly
+// between the percentiles, from half the median at 0 to max at 1.
+func (l latencyShape) quantile(q float64) time.Duration {
+	points := []struct {
+		q float64
+		d time.Duration
+	}{{0, l.p50 / 2}, {0.5, l.p50}, {0.95, l.p95}, {0.99, l.p99}, {1, l.max()}}
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if q <= hi.q {
+			return lo.d + time.Duration((q-lo.q)/(hi.q-lo.q)*float64(hi.d-lo.d))
+		}
+	}
+	return l.max()
+}
+
+// sample returns a random delay from the shape. In deterministic mode it is
+// always the median.
+func (l latencyShape) sample() time.Duration {
+	if deterministic {
+		return l.p50
+	}
+	return l.quantile(random.Float64())
+}
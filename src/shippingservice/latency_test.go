@@ -0,0 +1,85 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// TestParseLatencyShapes checks the CHAOS_LATENCY syntax.
+func TestParseLatencyShapes(t *testing.T) {
+	shapes, err := parseLatencyShapes("GetQuote=20ms/100ms/400ms, ShipOrder = 50ms/250ms/1s")
+	if err != nil {
+		t.Fatalf("TestParseLatencyShapes: %v", err)
+	}
+	if want := (latencyShape{20 * time.Millisecond, 100 * time.Millisecond, 400 * time.Millisecond}); shapes["GetQuote"] != want {
+		t.Errorf("TestParseLatencyShapes: GetQuote is %+v, want %+v", shapes["GetQuote"], want)
+	}
+	if shapes["ShipOrder"].p99 != time.Second {
+		t.Errorf("TestParseLatencyShapes: ShipOrder is %+v", shapes["ShipOrder"])
+	}
+	for _, bad := range []string{"GetQuote", "GetQuote=20ms/100ms", "GetQuote=fast/100ms/1s", "GetQuote=100ms/20ms/1s", "GetQuote=1s/10s/50s"} {
+		if _, err := parseLatencyShapes(bad); err == nil {
+			t.Errorf("TestParseLatencyShapes: %q was accepted", bad)
+		}
+	}
+}
+
+// TestLatencyShape checks that sampled delays have the configured
+// percentiles, and that the interceptor applies them in chaos mode only.
+func TestLatencyShape(t *testing.T) {
+	saved := random
+	random = newLockedRand(1)
+	defer func() { random = saved }()
+
+	shape := latencyShape{20 * time.Millisecond, 100 * time.Millisecond, 400 * time.Millisecond}
+	samples := make([]time.Duration, 20000)
+	for i := range samples {
+		samples[i] = shape.sample()
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	for _, p := range []struct {
+		q    float64
+		want time.Duration
+	}{{0.5, shape.p50}, {0.95, shape.p95}, {0.99, shape.p99}} {
+		got := samples[int(p.q*float64(len(samples)))]
+		if got < p.want*9/10 || got > p.want*11/10 {
+			t.Errorf("TestLatencyShape: p%v is %s, want about %s", p.q*100, got, p.want)
+		}
+	}
+	if max := samples[len(samples)-1]; max > shape.max() {
+		t.Errorf("TestLatencyShape: largest delay %s is past the maximum %s", max, shape.max())
+	}
+
+	f := newFaultInjector(false)
+	f.shapes = map[string]latencyShape{"GetQuote": {10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}}
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "done", nil }
+	start := time.Now()
+	f.unary()(context.Background(), nil, info, handler)
+	if d := time.Since(start); d >= 5*time.Millisecond {
+		t.Errorf("TestLatencyShape: chaos mode off delayed the call by %s", d)
+	}
+	f.setEnabled(true)
+	start = time.Now()
+	if resp, err := f.unary()(context.Background(), nil, info, handler); err != nil || resp != "done" || time.Since(start) < 5*time.Millisecond {
+		t.Errorf("TestLatencyShape: shaped call returned %v, %v after %s", resp, err, time.Since(start))
+	}
+}
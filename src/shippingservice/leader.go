@@ -0,0 +1,231 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultLeaseName     = "shippingservice-jobs"
+	defaultLeaseDuration = 15 * time.Second
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// leaderElector makes sure that only one replica runs the background jobs,
+// with client-go's leader election: the leader renews a Lease every third of
+// its duration, and the others take it over once they have not seen it
+// change for the duration, by their own clocks. A leader that cannot renew
+// for two thirds of the duration stops its jobs before anyone else can take
+// over.
+type leaderElector struct {
+	config   leaderelection.LeaderElectionConfig
+	lease    string
+	identity string
+	// tracer is fixed when the elector is made, as client-go reports new
+	// leaders from goroutines that can outlive lead.
+	tracer trace.Tracer
+
+	mu     sync.Mutex
+	holder string // last known holder; "" if unknown
+}
+
+func newLeaderElector(leases coordinationv1.LeasesGetter, namespace, name, identity string, duration time.Duration) (*leaderElector, error) {
+	e := &leaderElector{lease: name, identity: identity, tracer: tracer}
+	e.config = leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Client:     leases,
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   duration,
+		RenewDeadline:   duration * 2 / 3,
+		RetryPeriod:     duration / 3,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			// lead replaces OnStartedLeading and tracks the leadership of
+			// this replica itself, as client-go reports new leaders late.
+			OnStartedLeading: func(context.Context) {},
+			OnStoppedLeading: func() {},
+			OnNewLeader: func(holder string) {
+				if holder != e.identity {
+					e.observe(holder)
+				}
+			},
+		},
+	}
+	if _, err := leaderelection.NewLeaderElector(e.config); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// leaderElectorFromEnv returns an elector for the LEADER_ELECTION_LEASE Lease
+// in the pod's namespace if LEADER_ELECTION is set, or nil. The identity of
+// the replica is POD_NAME, or the host name.
+func leaderElectorFromEnv() *leaderElector {
+	if !envBool("LEADER_ELECTION", false) {
+		return nil
+	}
+	name := os.Getenv("LEADER_ELECTION_LEASE")
+	if name == "" {
+		name = defaultLeaseName
+	}
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	namespace := os.Getenv("LEADER_ELECTION_NAMESPACE")
+	if namespace == "" {
+		b, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			log.WithError(err).Fatal("failed to set up leader election")
+		}
+		namespace = strings.TrimSpace(string(b))
+	}
+	// client-go logs through klog; send its lines to the service log.
+	klog.SetLogger(logr.FromSlogHandler(log.sl.Handler()))
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Fatal("failed to set up leader election")
+	}
+	leases, err := coordinationv1.NewForConfig(config)
+	if err != nil {
+		log.WithError(err).Fatal("failed to set up leader election")
+	}
+	e, err := newLeaderElector(leases, namespace, name, identity, envDuration("LEADER_ELECTION_LEASE_DURATION", defaultLeaseDuration))
+	if err != nil {
+		log.WithError(err).Fatal("failed to set up leader election")
+	}
+	log.Infof("leader election: competing for lease %s/%s as %s", namespace, name, identity)
+	return e
+}
+
+// lead runs the jobs while this replica is the leader, until ctx is done.
+// Each job gets a context that is cancelled when leadership is lost, and is
+// started again when it is regained. A nil elector runs the jobs right away,
+// for a single replica.
+func (e *leaderElector) lead(ctx context.Context, jobs ...func(context.Context)) {
+	if e == nil {
+		runJobs(ctx, jobs)
+		return
+	}
+	for ctx.Err() == nil {
+		// client-go starts leading in a goroutine of its own, which may
+		// only be scheduled once Run has returned: wait for the jobs that
+		// started, and keep the others from starting late.
+		var (
+			mu      sync.Mutex
+			over    bool
+			running sync.WaitGroup
+		)
+		config := e.config
+		config.Callbacks.OnStartedLeading = func(ctx context.Context) {
+			mu.Lock()
+			if over {
+				mu.Unlock()
+				return
+			}
+			running.Add(1)
+			mu.Unlock()
+			defer running.Done()
+			e.observe(e.identity)
+			runJobs(ctx, jobs)
+		}
+		le, err := leaderelection.NewLeaderElector(config)
+		if err != nil {
+			log.WithError(err).Error("leader election: invalid configuration")
+			return
+		}
+		// Run returns once leadership is lost, or ctx is done, in which case
+		// it releases the lease so that another replica can take over at
+		// once rather than after the duration.
+		le.Run(ctx)
+		mu.Lock()
+		over = true
+		mu.Unlock()
+		running.Wait()
+		if e.leading() {
+			e.observe("")
+		}
+	}
+}
+
+// runJobs runs the jobs until they return.
+func runJobs(ctx context.Context, jobs []func(context.Context)) {
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job func(context.Context)) {
+			defer wg.Done()
+			job(ctx)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (e *leaderElector) leading() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.holder == e.identity
+}
+
+// observe logs and traces a change of leader as seen from this replica.
+// The span is a root of its own, as the change does not belong to any
+// request.
+func (e *leaderElector) observe(holder string) {
+	e.mu.Lock()
+	previous := e.holder
+	e.holder = holder
+	e.mu.Unlock()
+	if holder == previous {
+		return
+	}
+	_, span := e.tracer.Start(context.Background(), "leader.change",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("leader.lease", e.lease),
+			attribute.String("leader.identity", e.identity),
+			attribute.String("leader.holder", holder),
+			attribute.String("leader.previous", previous),
+			attribute.Bool("leader.leading", holder == e.identity),
+		))
+	defer span.End()
+	switch {
+	case holder == e.identity:
+		log.Infof("leader election: became the leader of lease %s", e.lease)
+	case previous == e.identity:
+		log.Warnf("leader election: lost lease %s, stopping background jobs", e.lease)
+	case holder != "":
+		log.Infof("leader election: %s is the leader of lease %s", holder, e.lease)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coordv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// leaderJob reports on its channels when it is started and stopped.
+type leaderJob struct {
+	started, stopped chan struct{}
+}
+
+func newLeaderJob() *leaderJob {
+	return &leaderJob{started: make(chan struct{}, 8), stopped: make(chan struct{}, 8)}
+}
+
+func (j *leaderJob) run(ctx context.Context) {
+	j.started <- struct{}{}
+	<-ctx.Done()
+	j.stopped <- struct{}{}
+}
+
+// leadInBackground runs e.lead with the job until the returned function is
+// called, which waits for lead to return.
+func leadInBackground(e *leaderElector, job *leaderJob) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.lead(ctx, job.run)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(ch chan struct{}, d time.Duration) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// TestLeaderElection checks that a lease renewed long ago by another clock
+// is only taken over once it has not changed for its duration, that one of
+// two replicas leads, that the other takes over once the leader stops
+// renewing or releases the lease, and that leadership changes are traced.
+func TestLeaderElection(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	// The lease was last renewed an hour ago by the clock of its holder.
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	holder, seconds := "gone", int32(1)
+	cs := fake.NewSimpleClientset(&coordv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "jobs", Namespace: "default"},
+		Spec:       coordv1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &seconds, RenewTime: &renewed},
+	})
+	var blockA atomic.Bool
+	cs.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		l := action.(k8stesting.UpdateAction).GetObject().(*coordv1.Lease)
+		if blockA.Load() && l.Spec.HolderIdentity != nil && *l.Spec.HolderIdentity == "a" {
+			return true, nil, errors.New("unavailable")
+		}
+		return false, nil, nil
+	})
+	newElector := func(id string) *leaderElector {
+		e, err := newLeaderElector(cs.CoordinationV1(), "default", "jobs", id, time.Second)
+		if err != nil {
+			t.Fatalf("TestLeaderElection: %v", err)
+		}
+		return e
+	}
+	leaseHolder := func() string {
+		l, err := cs.CoordinationV1().Leases("default").Get(context.Background(), "jobs", metav1.GetOptions{})
+		if err != nil || l.Spec.HolderIdentity == nil {
+			return ""
+		}
+		return *l.Spec.HolderIdentity
+	}
+
+	jobA, jobB := newLeaderJob(), newLeaderJob()
+	stopA := leadInBackground(newElector("a"), jobA)
+	defer stopA()
+	if waitFor(jobA.started, 500*time.Millisecond) {
+		t.Fatal("TestLeaderElection: a took over a lease it had not seen unchanged for its duration")
+	}
+	if !waitFor(jobA.started, 3*time.Second) {
+		t.Fatal("TestLeaderElection: expected a to take over the expired lease")
+	}
+	stopB := leadInBackground(newElector("b"), jobB)
+	if waitFor(jobB.started, 1500*time.Millisecond) {
+		t.Fatal("TestLeaderElection: b led while a renewed the lease")
+	}
+
+	// a stops renewing.
+	blockA.Store(true)
+	if !waitFor(jobA.stopped, 3*time.Second) {
+		t.Fatal("TestLeaderElection: a kept its jobs running after failing to renew")
+	}
+	if !waitFor(jobB.started, 3*time.Second) {
+		t.Fatal("TestLeaderElection: expected b to take over the expired lease")
+	}
+	blockA.Store(false)
+
+	stopB()
+	if h := leaseHolder(); h == "b" {
+		t.Error("TestLeaderElection: b did not release the lease on shutdown")
+	}
+	if !waitFor(jobA.started, 3*time.Second) {
+		t.Error("TestLeaderElection: expected a to take over the released lease")
+	}
+
+	changes := map[string]bool{}
+	for _, s := range rec.Ended() {
+		if s.Name() != "leader.change" {
+			continue
+		}
+		attrs := attribute.NewSet(s.Attributes()...)
+		id, _ := attrs.Value("leader.identity")
+		holder, _ := attrs.Value("leader.holder")
+		changes[id.AsString()+":"+holder.AsString()] = true
+	}
+	for _, want := range []string{"a:gone", "a:a", "b:a", "b:b", "b:"} {
+		if !changes[want] {
+			t.Errorf("TestLeaderElection: traced changes %v, want %s among them", changes, want)
+		}
+	}
+	// a sees that it lost the lease, or who took it over first.
+	if !changes["a:"] && !changes["a:b"] {
+		t.Errorf("TestLeaderElection: traced changes %v, want a losing the lease among them", changes)
+	}
+}
+
+// TestLeadRunsJobs checks that the jobs only run while leading, and that a
+// nil elector runs them at once.
+func TestLeadRunsJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	var nilElector *leaderElector
+	go nilElector.lead(ctx, func(ctx context.Context) { close(started) })
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("TestLeadRunsJobs: a nil elector did not run the job")
+	}
+	cancel()
+
+	cs := fake.NewSimpleClientset()
+	e, err := newLeaderElector(cs.CoordinationV1(), "default", "jobs", "a", time.Second)
+	if err != nil {
+		t.Fatalf("TestLeadRunsJobs: %v", err)
+	}
+	job := newLeaderJob()
+	stop := leadInBackground(e, job)
+	if !waitFor(job.started, time.Second) {
+		t.Fatal("TestLeadRunsJobs: the job was not started")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	if !waitFor(stopped, time.Second) {
+		t.Fatal("TestLeadRunsJobs: lead did not return after its context was cancelled")
+	}
+	select {
+	case <-job.stopped:
+	default:
+		t.Error("TestLeadRunsJobs: lead returned before the job stopped")
+	}
+	l, err := cs.CoordinationV1().Leases("default").Get(context.Background(), "jobs", metav1.GetOptions{})
+	if err != nil || l.Spec.HolderIdentity != nil && *l.Spec.HolderIdentity != "" {
+		t.Errorf("TestLeadRunsJobs: lease %v, %v after shutdown, want it released", l, err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultLeakLimitMB = 1024
+	leakPageSize       = 4096
+)
+
+// memoryLeak simulates a leak for the memory-debugging exercises: while
+// chaos mode is on it retains rate bytes of buffers every second, up to
+// limit, until reset from the admin server.
+type memoryLeak struct {
+	rate, limit int64
+	enabled     func() bool
+
+	mu       sync.Mutex
+	buffers  [][]byte
+	retained int64
+}
+
+func newMemoryLeak(rate, limit int64, enabled func() bool) *memoryLeak {
+	l := &memoryLeak{rate: rate, limit: limit, enabled: enabled}
+	_, err := meter.Int64ObservableGauge("shipping.chaos.leak.retained",
+		metric.WithDescription("Memory retained by the simulated leak."),
+		metric.WithUnit("By"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(l.size())
+			return nil
+		}),
+	)
+	if err != nil {
+		log.WithError(err).Warn("failed to create memory leak metric")
+	}
+	return l
+}
+
+// memoryLeakFromEnv returns the leak configured by CHAOS_LEAK_RATE_KB and
+// CHAOS_LEAK_LIMIT_MB, or nil if the rate is 0.
+func memoryLeakFromEnv(faults *faultInjector) *memoryLeak {
+	rate := int64(envInt("CHAOS_LEAK_RATE_KB", 0)) << 10
+	if rate <= 0 {
+		return nil
+	}
+	limit := int64(envInt("CHAOS_LEAK_LIMIT_MB", defaultLeakLimitMB)) << 20
+	log.Warnf("memory leak simulation is on: %d KiB/s up to %d MiB in chaos mode", rate>>10, limit>>20)
+	return newMemoryLeak(rate, limit, faults.enabled.Load)
+}
+
+// run grows the leak every second until ctx is done.
+func (l *memoryLeak) run(ctx context.Context) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if l.enabled() {
+				l.grow(l.rate)
+			}
+		}
+	}
+}
+
+// grow retains n more bytes, or as many as the limit allows. Every page is
+// written, so that the memory is resident and not just reserved.
+func (l *memoryLeak) grow(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.retained+n > l.limit {
+		n = l.limit - l.retained
+	}
+	if n <= 0 {
+		return
+	}
+	b := make([]byte, n)
+	for i := 0; i < len(b); i += leakPageSize {
+		b[i] = 1
+	}
+	l.buffers = append(l.buffers, b)
+	l.retained += n
+}
+
+func (l *memoryLeak) size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.retained
+}
+
+// reset releases the retained buffers and returns the memory to the
+// operating system, so that the drop shows at once.
+func (l *memoryLeak) reset() {
+	l.mu.Lock()
+	freed := l.retained
+	l.buffers, l.retained = nil, 0
+	l.mu.Unlock()
+	debug.FreeOSMemory()
+	log.Infof("memory leak reset: released %d MiB", freed>>20)
+}
+
+// ServeHTTP reports the leak, and resets it on POST.
+func (l *memoryLeak) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		l.reset()
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Retained int64 `json:"retained_bytes"`
+		Rate     int64 `json:"rate_bytes_per_second"`
+		Limit    int64 `json:"limit_bytes"`
+		Growing  bool  `json:"growing"`
+	}{l.size(), l.rate, l.limit, l.enabled() && l.size() < l.limit})
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestMemoryLeak checks that the leak grows up to its limit and is released
+// by a POST to the admin endpoint.
+func TestMemoryLeak(t *testing.T) {
+	l := newMemoryLeak(1<<20, 3<<20, func() bool { return true })
+	l.grow(l.rate)
+	l.grow(l.rate)
+	l.grow(l.rate)
+	l.grow(l.rate)
+	if got := l.size(); got != 3<<20 {
+		t.Errorf("TestMemoryLeak: retained %d bytes, want the limit of %d", got, 3<<20)
+	}
+
+	var status struct {
+		Retained int64 `json:"retained_bytes"`
+		Growing  bool  `json:"growing"`
+	}
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chaos/leak", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || status.Retained != 3<<20 || status.Growing {
+		t.Errorf("TestMemoryLeak: GET returned %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chaos/leak", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || status.Retained != 0 || !status.Growing {
+		t.Errorf("TestMemoryLeak: POST returned %s", rec.Body)
+	}
+	if l.size() != 0 || l.buffers != nil {
+		t.Errorf("TestMemoryLeak: %d bytes still retained after reset", l.size())
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultShutdownTimeout = 20 * time.Second
+	defaultShutdownDelay   = 5 * time.Second
+
+	// telemetryFlushTimeout bounds the export of the last telemetry, which
+	// happens after the shutdown timeout.
+	telemetryFlushTimeout = 5 * time.Second
+)
+
+// lifecycle runs the background workers and orders the shutdown of the
+// service, so that a rolling update loses neither requests nor telemetry:
+//
+//  1. health checks report NOT_SERVING, and the service keeps serving for
+//     the delay while load balancers and kubelet take notice;
+//  2. the servers stop accepting calls and finish the ones in flight;
+//  3. the background workers are stopped, the queues are worked off, and
+//     both are waited for;
+//  4. the telemetry still buffered is exported.
+//
+// Steps 1 to 3 share the timeout; calls, workers or queued work still
+// running once it has passed are abandoned. The shutdown is traced as a
+// service.shutdown span with a child per step.
+type lifecycle struct {
+	timeout, delay time.Duration
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	http    []*http.Server
+
+	// stop is closed when the workers are stopped, and drainCtx is
+	// cancelled once queued work is abandoned.
+	stop        chan struct{}
+	drainCtx    context.Context
+	cancelDrain context.CancelFunc
+}
+
+func newLifecycle(timeout, delay time.Duration) *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	drainCtx, cancelDrain := context.WithCancel(context.Background())
+	return &lifecycle{timeout: timeout, delay: delay, ctx: ctx, cancel: cancel,
+		stop: make(chan struct{}), drainCtx: drainCtx, cancelDrain: cancelDrain}
+}
+
+// lifecycleFromEnv reads SHUTDOWN_TIMEOUT and SHUTDOWN_DELAY.
+func lifecycleFromEnv() *lifecycle {
+	return newLifecycle(envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout), envDuration("SHUTDOWN_DELAY", defaultShutdownDelay))
+}
+
+// goWorker runs a background worker until the service shuts down. The
+// worker must return once its context is done.
+func (l *lifecycle) goWorker(run func(context.Context)) {
+	l.workers.Add(1)
+	go func() {
+		defer l.workers.Done()
+		run(l.ctx)
+	}()
+}
+
+// goDrainer runs a worker that works off a queue. When the service shuts
+// down, stop is closed, and the worker must work off what is still queued
+// and return. Its ctx is only cancelled if the shutdown timeout passes first.
+func (l *lifecycle) goDrainer(run func(ctx context.Context, stop <-chan struct{})) {
+	l.workers.Add(1)
+	go func() {
+		defer l.workers.Done()
+		run(l.drainCtx, l.stop)
+	}()
+}
+
+// serveHTTP runs an additional server, which is drained along with the gRPC
+// server.
+func (l *lifecycle) serveHTTP(name string, s *http.Server) {
+	l.http = append(l.http, s)
+	go func() {
+		log.Infof("%s listening on %s", name, s.Addr)
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Errorf("%s stopped", name)
+		}
+	}()
+}
+
+// shutdown drains the service. It returns once the telemetry is flushed.
+func (l *lifecycle) shutdown(srv *grpc.Server, health *healthRegistry, inflight *inflightRegistry) {
+	start := time.Now()
+	deadline := start.Add(l.timeout)
+	ctx, span := tracer.Start(context.Background(), "service.shutdown",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("shutdown.timeout", l.timeout.String()),
+			attribute.String("shutdown.delay", l.delay.String()),
+		))
+
+	_, phase := tracer.Start(ctx, "health.drain")
+	health.drain()
+	log.Infof("shutdown: reporting NOT_SERVING, draining for %v", l.delay)
+	sleepContext(context.Background(), minDuration(l.delay, time.Until(deadline)))
+	phase.End()
+
+	_, phase = tracer.Start(ctx, "rpc.drain")
+	calls := len(inflight.list())
+	phase.SetAttributes(attribute.Int("rpc.inflight", calls))
+	log.Infof("shutdown: no longer accepting calls, waiting for %d in flight", calls)
+	drained := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, s := range l.http {
+			wg.Add(1)
+			go func(s *http.Server) {
+				defer wg.Done()
+				httpCtx, cancel := context.WithDeadline(context.Background(), deadline)
+				defer cancel()
+				if err := s.Shutdown(httpCtx); err != nil {
+					s.Close()
+				}
+			}(s)
+		}
+		srv.GracefulStop()
+		wg.Wait()
+		close(drained)
+	}()
+	forced := false
+	select {
+	case <-drained:
+	case <-time.After(time.Until(deadline)):
+		forced = true
+		for _, c := range inflight.list() {
+			log.Warnf("shutdown: abandoning %s from %s after %s (trace %s)", c.Method, c.Peer, c.Elapsed, c.TraceID)
+		}
+		// Stop closes the connections, but may wait for handlers that
+		// ignore their cancelled context.
+		go srv.Stop()
+	}
+	phase.SetAttributes(attribute.Bool("shutdown.forced", forced))
+	phase.End()
+
+	_, phase = tracer.Start(ctx, "workers.stop")
+	close(l.stop)
+	l.cancel()
+	defer l.cancelDrain()
+	stopped := make(chan struct{})
+	go func() {
+		l.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Until(deadline)):
+		forced = true
+		l.cancelDrain()
+		phase.SetAttributes(attribute.Bool("shutdown.forced", true))
+		log.Warn("shutdown: background workers did not stop in time")
+	}
+	phase.End()
+
+	span.SetAttributes(attribute.Bool("shutdown.forced", forced))
+	span.End()
+	log.Infof("service stopped in %v", time.Since(start).Round(time.Millisecond))
+	flushTelemetry()
+}
+
+// flushTelemetry exports the buffered spans, metrics and logs, and shuts the
+// providers down.
+func flushTelemetry() {
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryFlushTimeout)
+	defer cancel()
+	if shutdownTelemetry != nil {
+		if err := shutdownTelemetry(ctx); err != nil {
+			log.WithError(err).Warn("failed to flush telemetry")
+		}
+	}
+	if logProvider != nil {
+		logProvider.Shutdown(ctx)
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
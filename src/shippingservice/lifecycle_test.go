@@ -0,0 +1,169 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// drainTestServer serves health checks, delaying every Check by delay.
+func drainTestServer(t *testing.T, delay time.Duration) (*grpc.Server, *server, *inflightRegistry, healthpb.HealthClient) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inflight := newInflightRegistry()
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(inflight.unary(),
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			time.Sleep(delay)
+			return handler(ctx, req)
+		}))
+	svc := newServer()
+	healthpb.RegisterHealthServer(srv, svc)
+	go srv.Serve(lis)
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return srv, svc, inflight, healthpb.NewHealthClient(cc)
+}
+
+// TestShutdown checks the drain sequence: NOT_SERVING during the delay,
+// calls in flight completing, workers stopped, queues worked off before
+// their context is cancelled, and the trace of it all.
+func TestShutdown(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	srv, svc, inflight, client := drainTestServer(t, 400*time.Millisecond)
+	lc := newLifecycle(5*time.Second, 100*time.Millisecond)
+	workerStopped := make(chan struct{})
+	lc.goWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+	drainErr := make(chan error, 1)
+	lc.goDrainer(func(ctx context.Context, stop <-chan struct{}) {
+		<-stop
+		time.Sleep(50 * time.Millisecond) // working off the queue
+		drainErr <- ctx.Err()
+	})
+
+	// A call in flight when the shutdown starts is served.
+	inFlight := make(chan error, 1)
+	go func() {
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		inFlight <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		lc.shutdown(srv, svc.health, inflight)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if st, _ := svc.health.servingStatus(""); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("TestShutdown: service is %v during the delay, want NOT_SERVING", st)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("TestShutdown: shutdown did not return")
+	}
+	if err := <-inFlight; err != nil {
+		t.Errorf("TestShutdown: call in flight failed: %v", err)
+	}
+	select {
+	case <-workerStopped:
+	default:
+		t.Error("TestShutdown: the worker was not stopped")
+	}
+	select {
+	case err := <-drainErr:
+		if err != nil {
+			t.Errorf("TestShutdown: queue was cancelled while it was worked off: %v", err)
+		}
+	default:
+		t.Error("TestShutdown: shutdown did not wait for the queue")
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("TestShutdown: got %d spans, want 4", len(spans))
+	}
+	root := spans[3]
+	if root.Name() != "service.shutdown" || root.Parent().IsValid() {
+		t.Errorf("TestShutdown: last span is %q with parent %v, want a root service.shutdown", root.Name(), root.Parent())
+	}
+	for i, want := range []string{"health.drain", "rpc.drain", "workers.stop"} {
+		if spans[i].Name() != want || spans[i].Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("TestShutdown: span %d is %q, want %q as a child of service.shutdown", i, spans[i].Name(), want)
+		}
+	}
+	drain, shutdown := attribute.NewSet(spans[1].Attributes()...), attribute.NewSet(root.Attributes()...)
+	if v, _ := drain.Value("rpc.inflight"); v.AsInt64() != 1 {
+		t.Errorf("TestShutdown: rpc.inflight is %d, want 1", v.AsInt64())
+	}
+	if v, _ := shutdown.Value("shutdown.forced"); v.AsBool() {
+		t.Error("TestShutdown: shutdown was forced")
+	}
+}
+
+// TestShutdownTimeout checks that calls and queued work still running at
+// the timeout are abandoned.
+func TestShutdownTimeout(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	srv, svc, inflight, client := drainTestServer(t, 2*time.Second)
+	go client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	lc := newLifecycle(200*time.Millisecond, 0)
+	abandoned := make(chan struct{})
+	lc.goDrainer(func(ctx context.Context, stop <-chan struct{}) {
+		<-ctx.Done()
+		close(abandoned)
+	})
+	lc.shutdown(srv, svc.health, inflight)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("TestShutdownTimeout: shutdown took %v with a 200ms timeout", d)
+	}
+	select {
+	case <-abandoned:
+	case <-time.After(time.Second):
+		t.Error("TestShutdownTimeout: queue was not cancelled at the timeout")
+	}
+	spans := rec.Ended()
+	attrs := attribute.NewSet(spans[len(spans)-1].Attributes()...)
+	if v, _ := attrs.Value("shutdown.forced"); !v.AsBool() {
+		t.Error("TestShutdownTimeout: shutdown.forced is not set")
+	}
+}
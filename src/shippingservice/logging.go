@@ -0,0 +1,329 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	levelTrace = slog.LevelDebug - 4
+	levelFatal = slog.LevelError + 4
+)
+
+// logProvider is set by initLogs when logs are exported over OTLP, so that
+// fatal errors can be flushed before the process exits.
+var logProvider *sdklog.LoggerProvider
+
+// logger is the logging interface used throughout the service: a thin wrapper
+// around a *slog.Logger that keeps printf-style helpers and remembers a
+// context. Lines logged through log.Ctx(ctx) carry the trace and span IDs of
+// ctx, and are attached to the span when exported through the OTel bridge.
+type logger struct {
+	sl    *slog.Logger
+	level *slog.LevelVar
+	ctx   context.Context
+}
+
+// newLogger returns a logger that writes to w in the given LOG_FORMAT at the
+// given LOG_LEVEL, or debug when it is empty. Every record is also handed to
+// the OpenTelemetry log bridge, which drops it until initLogs installs a
+// logger provider.
+func newLogger(w io.Writer, level, format string) (*logger, error) {
+	lvl := new(slog.LevelVar)
+	lvl.Set(slog.LevelDebug)
+	if level != "" {
+		l, err := parseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		lvl.Set(l)
+	}
+	h, err := logHandler(w, format, lvl)
+	if err != nil {
+		return nil, err
+	}
+	bridge := leveledHandler{Handler: otelslog.NewHandler(serviceName), level: lvl}
+	return &logger{
+		sl:    slog.New(fanoutHandler{traceHandler{h}, bridge}),
+		level: lvl,
+		ctx:   context.Background(),
+	}, nil
+}
+
+// logHandler returns the handler for LOG_FORMAT: "json" (the default), "text"
+// for humans, or "otel", JSON keyed like the OpenTelemetry log data model.
+func logHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	switch strings.ToLower(format) {
+	case "", "json":
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: renameKeys("timestamp", "severity", "message"),
+		}), nil
+	case "text":
+		return slog.NewTextHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: renameKeys(slog.TimeKey, slog.LevelKey, slog.MessageKey),
+		}), nil
+	case "otel":
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: renameKeys("timestamp", "severity_text", "body"),
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// renameKeys returns a ReplaceAttr function that gives the built-in time,
+// level and message attributes the given names and spells out the trace and
+// fatal levels, which slog only knows as offsets.
+func renameKeys(timeKey, levelKey, msgKey string) func([]string, slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) > 0 {
+			return a
+		}
+		switch a.Key {
+		case slog.TimeKey:
+			a.Key = timeKey
+			a.Value = slog.StringValue(a.Value.Time().Format(time.RFC3339Nano))
+		case slog.LevelKey:
+			a.Key = levelKey
+			a.Value = slog.StringValue(levelName(a.Value.Any().(slog.Level)))
+		case slog.MessageKey:
+			a.Key = msgKey
+		}
+		return a
+	}
+}
+
+// parseLevel accepts the slog level names, case-insensitively, as well as the
+// "trace", "warning" and "fatal" names LOG_LEVEL took before.
+func parseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "trace":
+		return levelTrace, nil
+	case "warning":
+		return slog.LevelWarn, nil
+	case "fatal":
+		return levelFatal, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return l, nil
+}
+
+func levelName(l slog.Level) string {
+	switch l {
+	case levelTrace:
+		return "TRACE"
+	case levelFatal:
+		return "FATAL"
+	}
+	return l.String()
+}
+
+// Ctx returns a logger whose lines belong to ctx.
+func (l *logger) Ctx(ctx context.Context) *logger {
+	c := *l
+	c.ctx = ctx
+	return &c
+}
+
+// With returns a logger that adds the given key-value pairs to every line.
+func (l *logger) With(args ...any) *logger {
+	c := *l
+	c.sl = l.sl.With(args...)
+	return &c
+}
+
+// WithError returns a logger that adds err to every line.
+func (l *logger) WithError(err error) *logger {
+	return l.With("error", err)
+}
+
+// Level returns the current minimum level.
+func (l *logger) Level() slog.Level {
+	return l.level.Level()
+}
+
+// SetLevel changes the minimum level of this logger and every logger derived
+// from the same newLogger call.
+func (l *logger) SetLevel(level slog.Level) {
+	l.level.Set(level)
+}
+
+func (l *logger) print(level slog.Level, args ...any) {
+	if l.sl.Enabled(l.ctx, level) {
+		l.sl.Log(l.ctx, level, fmt.Sprint(args...))
+	}
+}
+
+func (l *logger) printf(level slog.Level, format string, args ...any) {
+	if l.sl.Enabled(l.ctx, level) {
+		l.sl.Log(l.ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *logger) Debug(args ...any)                 { l.print(slog.LevelDebug, args...) }
+func (l *logger) Debugf(format string, args ...any) { l.printf(slog.LevelDebug, format, args...) }
+func (l *logger) Info(args ...any)                  { l.print(slog.LevelInfo, args...) }
+func (l *logger) Infof(format string, args ...any)  { l.printf(slog.LevelInfo, format, args...) }
+func (l *logger) Warn(args ...any)                  { l.print(slog.LevelWarn, args...) }
+func (l *logger) Warnf(format string, args ...any)  { l.printf(slog.LevelWarn, format, args...) }
+func (l *logger) Error(args ...any)                 { l.print(slog.LevelError, args...) }
+func (l *logger) Errorf(format string, args ...any) { l.printf(slog.LevelError, format, args...) }
+
+// Fatal logs at the fatal level, flushes exported logs and exits.
+func (l *logger) Fatal(args ...any) {
+	l.print(levelFatal, args...)
+	exitAfterFatal()
+}
+
+// Fatalf logs at the fatal level, flushes exported logs and exits.
+func (l *logger) Fatalf(format string, args ...any) {
+	l.printf(levelFatal, format, args...)
+	exitAfterFatal()
+}
+
+func exitAfterFatal() {
+	if logProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		logProvider.Shutdown(ctx)
+		cancel()
+	}
+	os.Exit(1)
+}
+
+// traceHandler adds the trace and span IDs of the record's context, so that
+// lines written to stdout can be joined with the trace they belong to.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	if t, ok := ctx.Value(tenantKey{}).(tenant); ok {
+		r.AddAttrs(slog.String("tenant.id", t.ID))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
+
+// leveledHandler applies a minimum level to a handler that has none of its own.
+type leveledHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h leveledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return leveledHandler{h.Handler.WithAttrs(attrs), h.level}
+}
+
+func (h leveledHandler) WithGroup(name string) slog.Handler {
+	return leveledHandler{h.Handler.WithGroup(name), h.level}
+}
+
+// fanoutHandler passes every record to each of its handlers that accepts it.
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// logLevelHandler reports the log level on GET and changes it on PUT or POST
+// with a level parameter, e.g. "curl -X PUT localhost:8081/loglevel?level=info".
+func logLevelHandler(l *logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			lvl, err := parseLevel(r.FormValue("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if old := l.Level(); old != lvl {
+				l.SetLevel(lvl)
+				l.Ctx(r.Context()).Warnf("log level changed from %s to %s", levelName(old), levelName(lvl))
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprintln(w, strings.ToLower(levelName(l.Level())))
+	}
+}
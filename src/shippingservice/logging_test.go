@@ -0,0 +1,132 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestNewLogger checks that valid settings apply and invalid ones are refused.
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(&buf, "warn", "text")
+	if err != nil {
+		t.Fatalf("TestNewLogger: %v", err)
+	}
+	if l.Level() != slog.LevelWarn {
+		t.Errorf("TestNewLogger: level is %s, expected warn", l.Level())
+	}
+	l.Info("dropped")
+	l.Warn("kept")
+	if got := buf.String(); strings.Contains(got, "dropped") || !strings.Contains(got, "level=WARN msg=kept") {
+		t.Errorf("TestNewLogger: text output was %q", got)
+	}
+	if l, err := newLogger(io.Discard, "", ""); err != nil || l.Level() != slog.LevelDebug {
+		t.Errorf("TestNewLogger: defaults gave %v, %v", l, err)
+	}
+	for _, bad := range [][2]string{{"loud", "json"}, {"info", "xml"}} {
+		if _, err := newLogger(io.Discard, bad[0], bad[1]); err == nil {
+			t.Errorf("TestNewLogger: %v was accepted", bad)
+		}
+	}
+}
+
+// TestLoggerTraceCorrelation checks that lines logged with a span's context carry its IDs.
+func TestLoggerTraceCorrelation(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(&buf, "", "otel")
+	if err != nil {
+		t.Fatalf("TestLoggerTraceCorrelation: %v", err)
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1, 2, 3},
+		SpanID:  trace.SpanID{4, 5, 6},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	l.Ctx(ctx).WithError(errors.New("boom")).Errorf("failed %d times", 3)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("TestLoggerTraceCorrelation: %v", err)
+	}
+	for k, want := range map[string]interface{}{
+		"body":          "failed 3 times",
+		"severity_text": "ERROR",
+		"error":         "boom",
+		"trace_id":      sc.TraceID().String(),
+		"span_id":       sc.SpanID().String(),
+	} {
+		if entry[k] != want {
+			t.Errorf("TestLoggerTraceCorrelation: %s = %v, expected %v", k, entry[k], want)
+		}
+	}
+	if _, ok := entry["timestamp"]; !ok {
+		t.Errorf("TestLoggerTraceCorrelation: no timestamp in %v", entry)
+	}
+}
+
+// TestParseLevel checks that the level names LOG_LEVEL accepted under logrus still work.
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{
+		"trace":   levelTrace,
+		"DEBUG":   slog.LevelDebug,
+		"info":    slog.LevelInfo,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"fatal":   levelFatal,
+	} {
+		if got, err := parseLevel(in); err != nil || got != want {
+			t.Errorf("TestParseLevel: %q gave %s, %v, expected %s", in, got, err, want)
+		}
+	}
+}
+
+// TestLogLevelHandler checks that the level can be read and changed over HTTP.
+func TestLogLevelHandler(t *testing.T) {
+	l, err := newLogger(io.Discard, "", "")
+	if err != nil {
+		t.Fatalf("TestLogLevelHandler: %v", err)
+	}
+	h := logLevelHandler(l)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, "/loglevel?level=error", nil))
+	if rec.Code != http.StatusOK || l.Level() != slog.LevelError {
+		t.Errorf("TestLogLevelHandler: PUT returned %d and level %s", rec.Code, l.Level())
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/loglevel", nil))
+	if got := strings.TrimSpace(rec.Body.String()); got != "error" {
+		t.Errorf("TestLogLevelHandler: GET returned %q, expected error", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, "/loglevel?level=loud", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("TestLogLevelHandler: invalid level returned %d, expected 400", rec.Code)
+	}
+}
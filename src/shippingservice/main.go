@@ -17,33 +17,36 @@ package main
 import (
 	"errors"
 	"fmt"
-	"math"
-	"math/rand"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
 
 	// FOK Workshop - Span Attributes
 
 
 	"golang.org/x/net/context"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/GoogleCloudPlatform/microservices-demo/src/internal/telemetry"
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
@@ -58,25 +61,61 @@ type Quote struct {
 	Cents   uint32
 }
 
-var log *logrus.Logger
-var tracer trace.Tracer
+var log *logger
+var tracer trace.Tracer = otel.Tracer("ExampleService")
+var meter metric.Meter = otel.Meter(serviceName)
+
+// shutdownTelemetry is set by initTelemetry, to flush the spans and metrics
+// as the service exits.
+var shutdownTelemetry func(context.Context) error
 
 func init() {
-	log = logrus.New()
-	log.Level = logrus.DebugLevel
-	log.Formatter = &logrus.JSONFormatter{
-		FieldMap: logrus.FieldMap{
-			logrus.FieldKeyTime:  "timestamp",
-			logrus.FieldKeyLevel: "severity",
-			logrus.FieldKeyMsg:   "message",
-		},
-		TimestampFormat: time.RFC3339Nano,
+	var err error
+	log, err = newLogger(os.Stdout, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid logging configuration: %v\n", err)
+		os.Exit(1)
 	}
-	log.Out = os.Stdout
+	slog.SetDefault(log.sl)
 }
 
 func main() {
-	initTracing()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "record":
+			os.Exit(recordCommand(os.Args[2:]))
+		case "replay":
+			os.Exit(replayCommand(os.Args[2:]))
+		case "client":
+			os.Exit(clientCommand(os.Args[2:], os.Stdout))
+		case "probe":
+			os.Exit(probeCommand(os.Args[2:], os.Stdout))
+		case "migrate":
+			os.Exit(migrateCommand(os.Args[2:], os.Stdout))
+		case "frontend":
+			os.Exit(frontendCommand(os.Args[2:], os.Stdout))
+		}
+	}
+	serve(nil)
+}
+
+// serve runs the service until it fails, recording its RPCs to traffic if it
+// is not nil.
+func serve(traffic *trafficRecorder) {
+	started := time.Now()
+	otel.SetErrorHandler(newSDKErrorHandler(log))
+	deterministicFromEnv()
+	sampler := ratioSamplerFromEnv()
+	debug := debugSurfaceFromEnv()
+	var zp *zpages
+	if debug.zpages {
+		zp = newZPages()
+	}
+	sdk := initTelemetry(newDebugSampler(healthCheckSamplerFromEnv(baggageSamplerFromEnv(sampler))), zp)
+	initLogs()
+	st := beginStartup(started)
+
+	_, bind := st.phase("listener.bind")
 	port := defaultPort
 	if value, ok := os.LookupEnv("PORT"); ok {
 		port = value
@@ -87,97 +126,365 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-
+	bind.SetAttributes(attribute.String("server.address", lis.Addr().String()))
+	bind.End()
+
+	_, load := st.phase("config.load")
+	lc := lifecycleFromEnv()
+	red := newREDMetrics()
+	faults := faultInjectorFromEnv()
+	tenants := tenancyFromEnv()
+	inflight := newInflightRegistry()
+	shedder := loadShedderFromEnv()
+	timeouts := rpcTimeoutsFromEnv()
 	var srv = grpc.NewServer(
-		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
-		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			traceIDInterceptor(),
+			tracestateInterceptor(),
+			traffic.unary(),
+			tenants.unary(),
+			inflight.unary(),
+			red.unary(),
+			accessLoggerFromEnv().unary(),
+			shedder.unary(),
+			tenants.limit(),
+			timeoutInterceptor(timeouts),
+			faults.unary(),
+		),
+		grpc.ChainStreamInterceptor(
+			traceIDStreamInterceptor(),
+			tenants.stream(),
+			inflight.stream(),
+			red.stream(),
+			shedder.stream(),
+			tenants.limitStream(),
+			timeoutStreamInterceptor(timeouts),
+			faults.stream(),
+		),
 	)
 
-	svc := &server{}
+	ids = newIDGenerator(nodeIDFromEnv())
+	svc := newServer()
+	svc.calendar = calendarFromEnv()
+	svc.rates = rateSourceFromEnv()
+	go svc.rates.watch(envDuration("RATES_RELOAD_INTERVAL", defaultRatesReloadInterval))
+	svc.batchWorkers = envInt("BATCH_WORKERS", defaultBatchWorkers)
+	rdb := redisClientFromEnv()
+	db := storageFromEnv()
+	svc.quotes = quoteCacheFromEnv(rdb)
+	svc.idempotency = idempotencyStoreFromEnv(rdb)
+	svc.issued = quoteRepositoryFromEnv(rdb, db)
+	if db != nil {
+		svc.shipments = newShipmentStore(newSQLShipmentRepository(db))
+		svc.health.register("database", true, db.PingContext)
+	}
+	svc.audit = auditLogFromEnv()
+	svc.validity = envDuration("QUOTE_VALIDITY", defaultQuoteValidity)
+	svc.tenants = tenants
+	svc.burn = cpuBurnFromEnv(faults)
+	svc.warehouse = warehouseFromEnv()
+	svc.taxes = taxCalculatorFromEnv()
+	svc.geocoder = geocoderFromEnv()
+	if svc.jobs = jobQueueFromEnv(); svc.jobs != nil {
+		lc.goDrainer(svc.jobs.run)
+	}
+	templates := templateSourceFromEnv()
+	go templates.watch(envDuration("NOTIFY_TEMPLATES_RELOAD_INTERVAL", defaultTemplatesReloadInterval))
+	if svc.notify = notificationPipelineFromEnv(templates); svc.notify != nil {
+		lc.goDrainer(svc.notify.run)
+	}
+	if rdb != nil {
+		svc.health.register("redis", true, func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+	}
+	svc.health.register("otlp", false, sdk.exportHealth)
+	load.End()
+
+	if db != nil {
+		migrateCtx, migrate := st.phase("database.migrate")
+		migrateOnStart(migrateCtx, db)
+		migrate.End()
+	}
+
+	warmCtx, warmup := st.phase("dependencies.warmup")
+	svc.health.run(warmCtx)
+	warmup.SetAttributes(attribute.String("health.status", string(svc.health.report().Status)))
+	warmup.End()
+	healthInterval := envDuration("HEALTH_CHECK_INTERVAL", defaultHealthInterval)
+	lc.goWorker(func(ctx context.Context) { svc.health.watch(ctx, healthInterval) })
+	lc.goWorker(maintenanceScheduler(svc).run)
+	if agent := opampAgentFromEnv(sampler, faults, svc.health); agent != nil {
+		lc.goWorker(agent.run)
+	}
+
+	var publishers multiPublisher
+	if w := webhookNotifierFromEnv(templates); w != nil {
+		w.start()
+		publishers = append(publishers, w)
+	}
+	if bus := eventBusFromEnv(); bus != nil {
+		publishers = append(publishers, bus)
+	}
+	// The outbox relay runs on every replica, which may keep its own outbox
+	// in memory. Background jobs run on one replica at a time when leader
+	// election is on.
+	elector := leaderElectorFromEnv()
+	relay, progression := newOutboxRelay(svc.shipments, publishers), statusProgressionFromEnv(svc.shipments)
+	lc.goDrainer(relay.run)
+	lc.goWorker(func(ctx context.Context) { elector.lead(ctx, progression.run) })
+
+	if gql := graphqlServerFromEnv(svc); gql != nil {
+		lc.serveHTTP("GraphQL API", gql)
+	}
+	leak := memoryLeakFromEnv(faults)
+	if leak != nil {
+		lc.goWorker(leak.run)
+	}
+	if admin := adminServerFromEnv(); admin != nil {
+		admin.handle("/loglevel", debug.writable(logLevelHandler(log)))
+		admin.handle("/healthz", svc.health)
+		if debug.inflight {
+			admin.handle("/inflight", inflight)
+		}
+		debug.registerAdmin(admin, zp)
+		admin.handle("/rates", debug.writable(svc.rates))
+		if debug.chaos {
+			admin.handle("/chaos/cpuburn", svc.burn)
+			if leak != nil {
+				admin.handle("/chaos/leak", leak)
+			}
+		}
+		go admin.serve()
+	}
 	pb.RegisterShippingServiceServer(srv, svc)
 	healthpb.RegisterHealthServer(srv, svc)
 	log.Infof("Shipping Service listening on port %s", port)
 
 	// Register reflection service on gRPC server.
-	reflection.Register(srv)
-	if err := srv.Serve(lis); err != nil {
+	debug.registerGRPC(srv)
+	st.done()
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(lis) }()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-served:
 		log.Fatalf("failed to serve: %v", err)
+	case sig := <-signals:
+		log.Infof("received %v, shutting down", sig)
+	}
+	go func() {
+		<-signals
+		log.Warn("received a second signal, exiting at once")
+		os.Exit(1)
+	}()
+	lc.shutdown(srv, svc.health, inflight)
+}
+
+// initTelemetry installs the tracer and meter providers, with spans also kept
+// by zp for the zPages unless it is nil, and returns the telemetry of the span
+// export pipeline.
+func initTelemetry(sampler sdktrace.Sampler, zp *zpages) *sdkTelemetry {
+	sdk := newSDKTelemetry(envInt("OTEL_BSP_MAX_QUEUE_SIZE", sdktrace.DefaultMaxQueueSize))
+	otel.SetLogger(sdk.logger())
+
+	policy := attributePolicyFromEnv()
+	views := metricViewsFromEnv()
+	opts := []telemetry.Option{
+		telemetry.WithSampler(sampler),
+		telemetry.WithExportProcessor(func(exp sdktrace.SpanExporter) sdktrace.SpanProcessor {
+			return newAttributeFilter(sdk.processor(sdktrace.NewBatchSpanProcessor(sdk.exporter(exp))), policy)
+		}),
+		telemetry.WithPropagator(newPropagator()),
+		telemetry.WithMetricViews(views.views...),
+		telemetry.WithTemporality(views.temporality),
+		telemetry.WithDialOptions(exporterDialOptions),
+	}
+	if zp != nil {
+		opts = append(opts, telemetry.WithSpanProcessors(newAttributeFilter(zp, policy)))
+	}
+	if deterministic {
+		opts = append(opts, telemetry.WithIDGenerator(seededIDGenerator{}))
+	}
+	if sm := spanMetricsFromEnv(); sm != nil {
+		opts = append(opts, telemetry.WithSpanProcessors(newAttributeFilter(sm, policy)))
+	}
+	shutdown, err := telemetry.Setup(context.Background(), serviceName, opts...)
+	if err != nil {
+		log.WithError(err).Fatal("failed to set up telemetry")
 	}
+	shutdownTelemetry = shutdown
+	tracer = otel.Tracer("ExampleService")
+	meter = otel.Meter(serviceName)
+	return sdk
 }
 
-func initTracing() {
-	res, err := detectResource()
+// initLogs exports log records over OTLP/HTTP when
+// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT is set, e.g. to
+// "http://otelcol:4318/v1/logs". Lines are written to stdout either way.
+func initLogs() {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	if endpoint == "" {
+		return
+	}
+	res, err := telemetry.Resource(context.Background(), serviceName)
 	if err != nil {
 		log.WithError(err).Fatal("failed to detect environment resource")
 	}
 
-	exp, err := spanExporter()
+	exp, err := otlploghttp.New(context.Background())
 	if err != nil {
-		log.WithError(err).Fatal("failed to initialize Span exporter")
-		return
+		log.WithError(err).Fatal("failed to initialize log exporter")
 	}
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(exp)),
+	logProvider = sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
 	)
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-	tracer = tp.Tracer("ExampleService")
+	global.SetLoggerProvider(logProvider)
+	log.Infof("exporting logs to OTLP collector at %s", endpoint)
 }
 
-func detectResource() (*resource.Resource, error) {
-	appResource, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
-		resource.WithFromEnv(),
-	)
-	if err != nil {
-		return nil, err
-	}
-	return resource.Merge(resource.Default(), appResource)
+// server controls RPC service responses.
+type server struct {
+	shipments    *shipmentStore
+	quotes       quoteCacher
+	idempotency  idempotencyStore
+	calendar     *businessCalendar
+	rates        *rateSource
+	issued       QuoteRepository
+	validity     time.Duration
+	audit        *auditLog
+	kpis         *businessMetrics
+	health       *healthRegistry
+	tenants      *tenancy
+	batchWorkers int
+	burn         *cpuBurn
+	flights      singleflight.Group
+	warehouse    *warehouse
+	jobs         *jobQueue
+	notify       *notificationPipeline
+	taxes        taxCalculator
+	geocoder     geocoder
 }
 
-func spanExporter() (*otlptrace.Exporter, error) {
-	var otlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otlpEndpoint != "" {
-		log.Infof("exporting to OTLP collector at %s", otlpEndpoint)
-		traceClient := otlptracegrpc.NewClient(
-			otlptracegrpc.WithInsecure(),
-			otlptracegrpc.WithEndpoint(otlpEndpoint),
-		)
-		return otlptrace.New(context.Background(), traceClient)
+func newServer() *server {
+	calendar, _ := newBusinessCalendar(defaultWeekend, "")
+	return &server{
+		shipments:    newShipmentStore(newMemoryShipmentRepository()),
+		quotes:       newQuoteCache(defaultQuoteCacheSize, defaultQuoteCacheTTL),
+		idempotency:  newMemoryIdempotencyStore(defaultIdempotencyTTL),
+		calendar:     calendar,
+		rates:        newDefaultRateSource(),
+		issued:       newMemoryQuoteStore(),
+		validity:     defaultQuoteValidity,
+		kpis:         newBusinessMetrics(),
+		health:       newHealthRegistry(),
+		tenants:      newTenancy(0, 0, 0, defaultTenantMetricLimit),
+		batchWorkers: defaultBatchWorkers,
 	}
-	return nil, errors.New("OTEL_EXPORTER_OTLP_ENDPOINT must not be empty")
 }
 
-// server controls RPC service responses.
-type server struct{}
-
-// Check is for health checking.
+// Check is for health checking. The empty service name reports the service
+// as a whole; "shippingservice.<dependency>" reports one dependency.
 func (s *server) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
-	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+	st, ok := s.health.servingStatus(req.GetService())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
 }
 
+// Watch streams the serving status of a service whenever it changes.
 func (s *server) Watch(req *healthpb.HealthCheckRequest, ws healthpb.Health_WatchServer) error {
-	return status.Errorf(codes.Unimplemented, "health check via Watch not implemented")
+	var last healthpb.HealthCheckResponse_ServingStatus = -1
+	for {
+		changed := s.health.changes()
+		if st, _ := s.health.servingStatus(req.GetService()); st != last {
+			if err := ws.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+		select {
+		case <-ws.Context().Done():
+			return status.FromContextError(ws.Context().Err()).Err()
+		case <-changed:
+		}
+	}
 }
 
 // GetQuote produces a shipping quote (cost) in USD.
 func (s *server) GetQuote(ctx context.Context, in *pb.GetQuoteRequest) (*pb.GetQuoteResponse, error) {
 	
-	log.Info("[GetQuote] received request")
-	defer log.Info("[GetQuote] completed request")
+	log.Ctx(ctx).Info("[GetQuote] received request")
+	defer log.Ctx(ctx).Info("[GetQuote] completed request")
 
 	// FOK Workshop - Building Spans
-	quote := CreateQuoteFromCount(0)
+	rates := s.rates.table()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("rates.version", rates.version), attribute.Bool("rates.precomputed", rates.matrix != nil))
+	opts, violations := rates.shippingOptions(in.Options, "options")
+	if len(violations) > 0 {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid shipping options", badRequest(violations...))
+	}
+	value, violations := orderValue(in.OrderValue, "order_value")
+	if len(violations) > 0 {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid order value", badRequest(violations...))
+	}
+	if violations := validateDimensions(in.Dimensions, "dimensions"); len(violations) > 0 {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid item dimensions", badRequest(violations...))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(opts.attributes()...)
+	// Parcels are priced by the larger of their actual and dimensional
+	// weight, once the items are packed.
+	var packaging *pb.Packaging
+	grams := weightGrams(in.Items)
+	if len(in.Dimensions) > 0 {
+		p := tracedPackOrder(ctx, in.Items, in.Dimensions)
+		packaging = p.toProto()
+		grams = p.billableGrams()
+	}
+	key := newQuoteCacheKeyForWeight(in, grams, rates.version)
+	// Options, surcharges, promotions and taxes are priced on top of the cached
+	// quote, which only depends on the parcel.
+	lines := rates.breakdown(ctx, s.computeQuote(ctx, key, itemCount(in.Items), rates), key, opts, time.Now())
+	if km, ok := s.distance(ctx, in.Address); ok {
+		lines = rates.applyDistance(lines, km)
+	}
+	lines, promotionID := rates.applyPromotion(ctx, lines, key, value)
+	lines, err := s.applyTaxes(ctx, rates, lines, key, in.Address, opts, value)
+	if err != nil {
+		return nil, backendUnavailable(ctx, "calculate taxes", err)
+	}
+	quote := lines.total()
+
+	if err := abandoned(ctx); err != nil {
+		return nil, err
+	}
+
+	issued := issuedQuote{
+		ID:           newID(newQuoteCacheKeyForWeight(in, grams, "").String()),
+		Price:        quote,
+		Zone:         key.zone,
+		WeightBucket: key.weightBucket,
+		Method:       key.method,
+		Options:      opts,
+		Pricing:      pricingDigest(key, in.Address),
+		Expires:      time.Now().Add(s.validity),
+	}
+	if err := s.issued.issue(ctx, issued); err != nil {
+		return nil, backendUnavailable(ctx, "store quote", err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("quote.id", issued.ID))
+	s.kpis.quoted(ctx, key, quote)
 
 	// Generate a response.
 	return &pb.GetQuoteResponse{
-		CostUsd: &pb.Money{
-			CurrencyCode: "USD",
-			Units:        int64(quote.Dollars),
-			Nanos:        int32(quote.Cents * 10000000)},
+		CostUsd:     quote.toMoney(),
+		QuoteId:     issued.ID,
+		ExpiresAt:   timestamppb.New(issued.Expires),
+		LineItems:   lines.lineItems(),
+		PromotionId: promotionID,
+		Packaging:   packaging,
 	}, nil
 
 }
@@ -189,11 +496,23 @@ func (s *server) ShipOrder(ctx context.Context, in *pb.ShipOrderRequest) (*pb.Sh
 	// FOK Workshop - Span Attributes
 
 
-	log.Info("[ShipOrder] received request")
-	defer log.Info("[ShipOrder] completed request")
+	log.Ctx(ctx).Info("[ShipOrder] received request")
+	defer log.Ctx(ctx).Info("[ShipOrder] completed request")
+
+	if violations := validateAddress(in.Address); len(violations) > 0 {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonInvalidAddress, nil, "invalid shipping address", badRequest(violations...))
+	}
+	opts, violations := s.rates.table().shippingOptions(in.Options, "options")
+	if len(violations) > 0 {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid shipping options", badRequest(violations...))
+	}
+	if violations := validateDimensions(in.Dimensions, "dimensions"); len(violations) > 0 {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, "invalid item dimensions", badRequest(violations...))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(opts.attributes()...)
 	
 	// 1. Create a Tracking ID
-	baseAddress := fmt.Sprintf("%s, %s, %s, %d", in.Address.StreetAddress, in.Address.City, in.Address.State, in.Address.ZipCode)
+	baseAddress := formatAddress(in.Address)
 	
 	// FOK Workshop - Span Attributes
 
@@ -203,20 +522,161 @@ func (s *server) ShipOrder(ctx context.Context, in *pb.ShipOrderRequest) (*pb.Sh
 
 	id := CreateTrackingId(baseAddress)
 
+	// A retried request with the same idempotency key gets the original
+	// tracking ID back instead of creating a second shipment, before anything
+	// that may have changed since the first request, such as its quote having
+	// expired or the tenant having reached its quota, is checked. The key is
+	// released if the shipment is not created, so that the retry can be.
+	key := idempotencyKey(ctx)
+	created := false
+	if key != "" {
+		existing, claimed, err := s.idempotency.claim(ctx, key, id)
+		if err != nil {
+			return nil, backendUnavailable(ctx, "check idempotency key", err)
+		}
+		if !claimed {
+			return &pb.ShipOrderResponse{TrackingId: existing, CostUsd: s.replayedCost(ctx, in.QuoteId)}, nil
+		}
+		defer func() {
+			if created {
+				if err := s.idempotency.complete(ctx, key, id); err != nil {
+					log.Ctx(ctx).WithError(err).Warn("failed to complete idempotency key")
+				}
+			} else if err := s.idempotency.release(ctx, key, id); err != nil {
+				log.Ctx(ctx).WithError(err).Warn("failed to release idempotency key")
+			}
+		}()
+	}
+
+	// An order placed against a quote is charged the quoted price, provided
+	// the quote is still valid for this address and weight.
+	var cost *pb.Money
+	method := pb.ShippingMethod_SHIPPING_METHOD_STANDARD
+	if in.QuoteId != "" {
+		q, ok, err := s.lookupQuote(ctx, in.QuoteId)
+		if err != nil {
+			return nil, backendUnavailable(ctx, "look up quote", err)
+		}
+		if !ok {
+			return nil, rpcError(ctx, codes.FailedPrecondition, reasonQuoteExpired, map[string]string{"quote_id": in.QuoteId},
+				fmt.Sprintf("quote %q has expired or does not exist", in.QuoteId))
+		}
+		if !q.matches(newQuoteCacheKey(&pb.GetQuoteRequest{Address: in.Address, Items: in.Items, Dimensions: in.Dimensions}, ""), in.Address) || q.Options != opts {
+			return nil, rpcError(ctx, codes.FailedPrecondition, reasonQuoteMismatch, map[string]string{"quote_id": in.QuoteId},
+				fmt.Sprintf("quote %q does not match the order's destination, weight or options", in.QuoteId))
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("quote.id", q.ID))
+		cost = q.Price.toMoney()
+		method = q.Method
+	}
+
+	if err := abandoned(ctx); err != nil {
+		return nil, err
+	}
+	tn := tenantFromContext(ctx).ID
+	// A tenant already at its quota is turned away before any stock is
+	// reserved. The quota is only enforced when the shipment is saved.
+	if quota := s.tenants.quota; quota > 0 {
+		live, err := s.shipments.live(ctx, tn)
+		if err != nil {
+			return nil, backendUnavailable(ctx, "count shipments", err)
+		}
+		if live >= quota {
+			return nil, s.tenants.quotaExceeded(ctx)
+		}
+	}
+	// Stock is reserved only once the key is claimed, so that a retry of a
+	// shipped order does not reserve it again.
+	if err := s.warehouse.reserve(ctx, in.Items); err != nil {
+		return nil, backendUnavailable(ctx, "reserve stock", err)
+	}
+	if err := s.audit.record(ctx, newShipOrderAudit(id, in)); err != nil {
+		return nil, backendUnavailable(ctx, "write audit log", err)
+	}
+	// The tenant's quota is checked in the same step as the shipment is
+	// saved, so that concurrent orders cannot all get in under it.
+	_, err := s.shipments.create(ctx, tn, id, in.Address, in.Items, s.tenants.quota)
+	if errors.Is(err, errQuotaExceeded) {
+		return nil, s.tenants.quotaExceeded(ctx)
+	}
+	if err != nil {
+		return nil, backendUnavailable(ctx, "save shipment", err)
+	}
+	created = true
+	s.kpis.shipped(ctx, method, in.Address)
+	s.processOrder(ctx, tn, id)
+	s.notifyShipped(ctx, tn, id)
+
 	// 2. Generate a response.
 	return &pb.ShipOrderResponse{
 		TrackingId: id,
+		CostUsd:    cost,
 	}, nil
 }
 
+// replayedCost returns the price of the quote a replayed order was placed
+// against, if the quote can still be found. A replay is not failed for a
+// quote that has expired since the order was shipped.
+func (s *server) replayedCost(ctx context.Context, quoteID string) *pb.Money {
+	if quoteID == "" {
+		return nil
+	}
+	q, ok, err := s.lookupQuote(ctx, quoteID)
+	if err != nil || !ok {
+		return nil
+	}
+	return q.Price.toMoney()
+}
+
+// CancelShipment cancels a shipment that has not yet left the warehouse.
+// Shipments that are already in transit or delivered cannot be cancelled.
+func (s *server) CancelShipment(ctx context.Context, in *pb.CancelShipmentRequest) (*pb.CancelShipmentResponse, error) {
+	log.Ctx(ctx).Info("[CancelShipment] received request")
+	defer log.Ctx(ctx).Info("[CancelShipment] completed request")
+
+	sh, err := s.shipments.transition(ctx, tenantFromContext(ctx).ID, in.TrackingId, pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED)
+	if errors.Is(err, errShipmentNotFound) {
+		return nil, shipmentNotFound(ctx, in.TrackingId)
+	}
+	if errors.Is(err, errInvalidTransition) {
+		return nil, rpcError(ctx, codes.FailedPrecondition, reasonInvalidTransition,
+			map[string]string{"tracking_id": in.TrackingId, "status": sh.Status.String()},
+			fmt.Sprintf("shipment %q cannot be cancelled in state %s", in.TrackingId, sh.Status))
+	}
+	if err != nil {
+		return nil, rpcError(ctx, codes.Internal, reasonInternal, nil, fmt.Sprintf("failed to cancel shipment: %v", err))
+	}
+
+	return &pb.CancelShipmentResponse{
+		TrackingId: sh.TrackingID,
+		Status:     sh.Status,
+	}, nil
+}
+
+// itemCount returns the total quantity of the items.
+func itemCount(items []*pb.CartItem) int {
+	n := 0
+	for _, it := range items {
+		n += int(it.GetQuantity())
+	}
+	return n
+}
+
 // String representation of the Quote.
 func (q Quote) String() string {
-	return fmt.Sprintf("$%d.%d", q.Dollars, q.Cents)
+	return money.Format(*q.toMoney())
+}
+
+// toMoney converts the quote to a pb.Money in USD.
+func (q Quote) toMoney() *pb.Money {
+	m := money.FromCents("USD", int64(q.Dollars)*100+int64(q.Cents))
+	return &m
 }
 
-// CreateQuoteFromCount takes a number of items and returns a Price struct.
+// CreateQuoteFromCount takes a number of items and returns a Price struct,
+// priced from the rate table. An empty cart costs nothing to ship.
 // FOK Workshop - Building spans
-func CreateQuoteFromCount(count int) Quote {
+func CreateQuoteFromCount(count int, rates *rateTable, key quoteCacheKey) Quote {
 
 	// FOK Workshop - Building Spans
 
@@ -224,7 +684,10 @@ func CreateQuoteFromCount(count int) Quote {
 	// FOK Workshop - Adding a Delay
 
 	// FOK Workshop - Building Spans
-	return CreateQuoteFromFloat(float64(rand.Intn(100)))
+	if count == 0 {
+		return Quote{}
+	}
+	return rates.quote(key)
 }
 
 // CreateQuoteFromFloat takes a price represented as a float and creates a Price struct.
@@ -237,9 +700,14 @@ func CreateQuoteFromFloat(value float64) Quote {
 	// FOK Workshop - Adding a Delay
 
 
-	units, fraction := math.Modf(value)
+	m, err := money.FromFloat("USD", value)
+	if err != nil || money.IsNegative(m) {
+		log.Errorf("cannot quote a price of %v", value)
+		return Quote{}
+	}
+	cents := money.Cents(m)
 	return Quote{
-		uint32(units),
-		uint32(math.Trunc(fraction * 100)),
+		uint32(cents / 100),
+		uint32(cents % 100),
 	}
 }
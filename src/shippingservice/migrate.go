@@ -0,0 +1,357 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// migrationFiles holds the schema of each dialect as numbered migrations,
+// migrations/<dialect>/NNNN_name.up.sql and the .down.sql that reverts it, in
+// the layout of golang-migrate.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock taken while migrating, so that
+// replicas migrating on start do not race each other.
+const migrationLockID = 0x5348495050494e47 // "SHIPPING"
+
+type migration struct {
+	version  int
+	name     string
+	up, down string
+}
+
+// migrator applies the bundled migrations to a database, recording the ones
+// applied in the schema_migrations table.
+type migrator struct {
+	db         *database
+	migrations []migration
+}
+
+func newMigrator(db *database) (*migrator, error) {
+	ms, err := loadMigrations(migrationFiles, path.Join("migrations", db.dialect))
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, migrations: ms}, nil
+}
+
+// loadMigrations reads the migrations in dir, ordered by version.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		num, name, ok2 := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || !ok2 || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("malformed migration file name %q", e.Name())
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(b)
+		} else {
+			m.down = string(b)
+		}
+	}
+	var ms []migration
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing its up or down file", m.version, m.name)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].version < ms[j].version })
+	return ms, nil
+}
+
+// latest returns the version of the newest bundled migration.
+func (m *migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// up applies the migrations that have not been yet, and returns the versions
+// the schema went from and to.
+func (m *migrator) up(ctx context.Context) (from, to int, err error) {
+	return m.migrate(ctx, "up", func(current int) []migration {
+		var pending []migration
+		for _, mg := range m.migrations {
+			if mg.version > current {
+				pending = append(pending, mg)
+			}
+		}
+		return pending
+	})
+}
+
+// down reverts the newest steps applied migrations.
+func (m *migrator) down(ctx context.Context, steps int) (from, to int, err error) {
+	return m.migrate(ctx, "down", func(current int) []migration {
+		var applied []migration
+		for i := len(m.migrations) - 1; i >= 0 && len(applied) < steps; i-- {
+			if m.migrations[i].version <= current {
+				applied = append(applied, m.migrations[i])
+			}
+		}
+		return applied
+	})
+}
+
+// version returns the version of the schema, 0 for an empty database.
+func (m *migrator) version(ctx context.Context) (int, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := m.createVersionTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	return m.currentVersion(ctx, conn)
+}
+
+// migrate runs the migrations that plan selects from the current version, each
+// in a transaction of its own, in a db.migrate span with a child span per
+// migration.
+func (m *migrator) migrate(ctx context.Context, direction string, plan func(current int) []migration) (from, to int, err error) {
+	ctx, span := tracer.Start(ctx, "db.migrate", trace.WithAttributes(
+		attribute.String("db.system", m.db.dialect),
+		attribute.String("db.migration.direction", direction),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("db.migration.from_version", from), attribute.Int("db.migration.to_version", to))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// One connection throughout, as the Postgres lock belongs to it.
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	if m.db.dialect == dialectPostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return 0, 0, fmt.Errorf("failed to lock the database: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}
+	if err := m.createVersionTable(ctx, conn); err != nil {
+		return 0, 0, err
+	}
+	if from, err = m.currentVersion(ctx, conn); err != nil {
+		return 0, 0, err
+	}
+	to = from
+	for _, mg := range plan(from) {
+		if err := m.apply(ctx, conn, mg, direction); err != nil {
+			return from, to, err
+		}
+		if to = mg.version; direction == "down" {
+			to = m.previous(mg.version)
+		}
+	}
+	return from, to, nil
+}
+
+func (m *migrator) apply(ctx context.Context, conn *sql.Conn, mg migration, direction string) (err error) {
+	ctx, span := tracer.Start(ctx, fmt.Sprintf("db.migration %04d_%s", mg.version, mg.name), trace.WithAttributes(
+		attribute.Int("db.migration.version", mg.version),
+		attribute.String("db.migration.name", mg.name),
+		attribute.String("db.migration.direction", direction),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, record := mg.up, m.db.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)")
+	args := []any{mg.version, mg.name, time.Now().UTC()}
+	if direction == "down" {
+		stmt, record = mg.down, m.db.rebind("DELETE FROM schema_migrations WHERE version = ?")
+		args = args[:1]
+	}
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("migration %04d_%s %s: %w", mg.version, mg.name, direction, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Ctx(ctx).Infof("applied migration %04d_%s (%s)", mg.version, mg.name, direction)
+	return nil
+}
+
+// previous returns the version of the migration before the given one.
+func (m *migrator) previous(version int) int {
+	prev := 0
+	for _, mg := range m.migrations {
+		if mg.version < version {
+			prev = mg.version
+		}
+	}
+	return prev
+}
+
+func (m *migrator) createVersionTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    BIGINT    PRIMARY KEY,
+    name       TEXT      NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+func (m *migrator) currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// migrateOnStart brings the schema up to date when DATABASE_MIGRATE is set,
+// and otherwise only warns if it is behind.
+func migrateOnStart(ctx context.Context, db *database) {
+	m, err := newMigrator(db)
+	if err != nil {
+		log.WithError(err).Fatal("failed to load migrations")
+	}
+	if !envBool("DATABASE_MIGRATE", false) {
+		if v, err := m.version(ctx); err != nil {
+			log.Ctx(ctx).WithError(err).Warn("failed to read the schema version")
+		} else if v < m.latest() {
+			log.Ctx(ctx).Warnf("database schema is at version %d, %d is available: run `shippingservice migrate` or set DATABASE_MIGRATE=true", v, m.latest())
+		}
+		return
+	}
+	from, to, err := m.up(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("failed to migrate the database")
+	}
+	log.Ctx(ctx).Infof("database schema migrated from version %d to %d", from, to)
+}
+
+// migrateCommand manages the schema of the database at DATABASE_URL:
+//
+//	shippingservice migrate [-database url] [up | down [steps] | version]
+func migrateCommand(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	url := flags.String("database", os.Getenv("DATABASE_URL"), "URL of the database, postgres://… or sqlite://…")
+	timeout := flags.Duration("timeout", 5*time.Minute, "timeout of the migration")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *url == "" {
+		fmt.Fprintln(out, "no database: set DATABASE_URL or -database")
+		return 2
+	}
+	command, rest := "up", []string(nil)
+	if flags.NArg() > 0 {
+		command, rest = flags.Arg(0), flags.Args()[1:]
+	}
+	steps := 1
+	if command == "down" && len(rest) > 0 {
+		n, err := strconv.Atoi(rest[0])
+		if err != nil || n < 1 {
+			fmt.Fprintf(out, "invalid number of steps %q\n", rest[0])
+			return 2
+		}
+		steps = n
+	}
+
+	db, err := openDatabase(*url)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer db.Close()
+	m, err := newMigrator(db)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var from, to int
+	switch command {
+	case "up":
+		from, to, err = m.up(ctx)
+	case "down":
+		from, to, err = m.down(ctx, steps)
+	case "version":
+		var v int
+		if v, err = m.version(ctx); err == nil {
+			fmt.Fprintf(out, "version %d (latest %d)\n", v, m.latest())
+			return 0
+		}
+	default:
+		fmt.Fprintf(out, "unknown migrate command %q: want up, down or version\n", command)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprintf(out, "migrated from version %d to %d\n", from, to)
+	return 0
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestMigrate checks that migrations are applied in order and only once, in
+// traced transactions, and that they can be reverted.
+func TestMigrate(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	db, err := openDatabase("sqlite://" + filepath.Join(t.TempDir(), "shipping.db"))
+	if err != nil {
+		t.Fatalf("TestMigrate: %v", err)
+	}
+	defer db.Close()
+	m, err := newMigrator(db)
+	if err != nil {
+		t.Fatalf("TestMigrate: %v", err)
+	}
+	ctx := context.Background()
+	if from, to, err := m.up(ctx); err != nil || from != 0 || to != m.latest() {
+		t.Fatalf("TestMigrate: up went from %d to %d (%v), want 0 to %d", from, to, err, m.latest())
+	}
+	if _, err := db.Exec("INSERT INTO quotes (id, dollars, cents, zone, weight_bucket, expires_at) VALUES ('q1', 8, 99, 1, 0, CURRENT_TIMESTAMP)"); err != nil {
+		t.Errorf("TestMigrate: quotes table not usable: %v", err)
+	}
+	if from, to, err := m.up(ctx); err != nil || from != to {
+		t.Errorf("TestMigrate: second up went from %d to %d (%v), want no change", from, to, err)
+	}
+
+	if _, to, err := m.down(ctx, 1); err != nil || to != m.previous(m.latest()) {
+		t.Fatalf("TestMigrate: down went to %d (%v), want %d", to, err, m.previous(m.latest()))
+	}
+	if _, to, err := m.down(ctx, len(m.migrations)); err != nil || to != 0 {
+		t.Fatalf("TestMigrate: down went to %d (%v), want 0", to, err)
+	}
+	if _, err := db.Exec("SELECT 1 FROM quotes"); err == nil {
+		t.Error("TestMigrate: quotes table still exists after down")
+	}
+	if v, err := m.version(ctx); err != nil || v != 0 {
+		t.Errorf("TestMigrate: version %d (%v) after down, want 0", v, err)
+	}
+
+	applied := 0
+	for _, sp := range rec.Ended() {
+		if strings.HasPrefix(sp.Name(), "db.migration ") {
+			applied++
+		}
+	}
+	if want := 2 * len(m.migrations); applied != want {
+		t.Errorf("TestMigrate: %d db.migration spans, want %d", applied, want)
+	}
+}
+
+func TestDatabaseURL(t *testing.T) {
+	db := &database{dialect: dialectPostgres}
+	if got := db.rebind("SELECT * FROM quotes WHERE id = ? AND zone = ?"); got != "SELECT * FROM quotes WHERE id = $1 AND zone = $2" {
+		t.Errorf("TestDatabaseURL: rebind gave %q", got)
+	}
+	if got := redactURL("postgres://shipping:secret@db:5432/shipping"); got != "postgres://shipping@db:5432/shipping" {
+		t.Errorf("TestDatabaseURL: redactURL gave %q", got)
+	}
+	if _, err := openDatabase("mysql://db/shipping"); err == nil {
+		t.Error("TestDatabaseURL: unsupported URL accepted")
+	}
+}
@@ -0,0 +1,27 @@
+CREATE TABLE shipments (
+    tenant          TEXT        NOT NULL,
+    tracking_id     TEXT        NOT NULL,
+    status          INTEGER     NOT NULL,
+    address         JSONB       NOT NULL,
+    items           JSONB       NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    origin_trace_id TEXT        NOT NULL DEFAULT '',
+    origin_span_id  TEXT        NOT NULL DEFAULT '',
+    PRIMARY KEY (tenant, tracking_id)
+);
+
+CREATE INDEX shipments_status_updated_at ON shipments (status, updated_at);
+
+CREATE TABLE shipment_events (
+    tenant          TEXT        NOT NULL,
+    tracking_id     TEXT        NOT NULL,
+    seq             BIGINT      NOT NULL,
+    event_id        TEXT        NOT NULL UNIQUE,
+    previous_status INTEGER     NOT NULL,
+    status          INTEGER     NOT NULL,
+    time            TIMESTAMPTZ NOT NULL,
+    trace_id        TEXT        NOT NULL DEFAULT '',
+    PRIMARY KEY (tenant, tracking_id, seq),
+    FOREIGN KEY (tenant, tracking_id) REFERENCES shipments (tenant, tracking_id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+CREATE TABLE quotes (
+    id            TEXT        PRIMARY KEY,
+    dollars       BIGINT      NOT NULL,
+    cents         BIGINT      NOT NULL,
+    zone          INTEGER     NOT NULL,
+    weight_bucket INTEGER     NOT NULL,
+    method        INTEGER     NOT NULL DEFAULT 0,
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX quotes_expires_at ON quotes (expires_at);
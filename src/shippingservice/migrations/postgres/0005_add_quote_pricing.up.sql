@@ -0,0 +1 @@
+ALTER TABLE quotes ADD COLUMN pricing TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+CREATE TABLE outbox (
+    seq        BIGSERIAL   PRIMARY KEY,
+    event      JSONB       NOT NULL,
+    carrier    JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
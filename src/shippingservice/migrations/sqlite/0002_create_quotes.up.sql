@@ -0,0 +1,11 @@
+CREATE TABLE quotes (
+    id            TEXT      PRIMARY KEY,
+    dollars       INTEGER   NOT NULL,
+    cents         INTEGER   NOT NULL,
+    zone          INTEGER   NOT NULL,
+    weight_bucket INTEGER   NOT NULL,
+    method        INTEGER   NOT NULL DEFAULT 0,
+    expires_at    TIMESTAMP NOT NULL
+);
+
+CREATE INDEX quotes_expires_at ON quotes (expires_at);
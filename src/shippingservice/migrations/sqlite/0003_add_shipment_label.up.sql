@@ -0,0 +1 @@
+ALTER TABLE shipments ADD COLUMN label BLOB;
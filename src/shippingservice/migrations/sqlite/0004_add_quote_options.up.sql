@@ -0,0 +1 @@
+ALTER TABLE quotes ADD COLUMN options TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+CREATE TABLE outbox (
+    seq        INTEGER   PRIMARY KEY AUTOINCREMENT,
+    event      TEXT      NOT NULL,
+    carrier    TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,166 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package money implements arithmetic on pb.Money values.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	nanosMin     = -999999999
+	nanosMax     = +999999999
+	nanosMod     = 1000000000
+	nanosPerCent = 10000000
+	centsPerUnit = 100
+
+	// maxFloatUnits is the largest amount FromFloat converts exactly to the
+	// cent.
+	maxFloatUnits = 1 << 53 / centsPerUnit
+)
+
+var (
+	ErrInvalidValue        = errors.New("one of the specified money values is invalid")
+	ErrMismatchingCurrency = errors.New("mismatching currency codes")
+	ErrOverflow            = errors.New("money value out of range")
+)
+
+// New returns a money value, or ErrInvalidValue if units and nanos have
+// different signs or nanos is out of range.
+func New(currency string, units int64, nanos int32) (pb.Money, error) {
+	m := pb.Money{CurrencyCode: currency, Units: units, Nanos: nanos}
+	if !IsValid(m) {
+		return pb.Money{}, ErrInvalidValue
+	}
+	return m, nil
+}
+
+// FromCents returns the value of a whole number of cents.
+func FromCents(currency string, cents int64) pb.Money {
+	return pb.Money{
+		CurrencyCode: currency,
+		Units:        cents / centsPerUnit,
+		Nanos:        int32(cents%centsPerUnit) * nanosPerCent,
+	}
+}
+
+// FromFloat converts an amount to money, rounding to the nearest cent.
+func FromFloat(currency string, v float64) (pb.Money, error) {
+	if math.IsNaN(v) || math.Abs(v) > maxFloatUnits {
+		return pb.Money{}, ErrOverflow
+	}
+	return FromCents(currency, int64(math.Round(v*centsPerUnit))), nil
+}
+
+// Cents returns the value in cents, rounding half away from zero.
+func Cents(m pb.Money) int64 {
+	cents := m.GetUnits() * centsPerUnit
+	nanos := m.GetNanos()
+	if nanos >= 0 {
+		return cents + int64((nanos+nanosPerCent/2)/nanosPerCent)
+	}
+	return cents + int64((nanos-nanosPerCent/2)/nanosPerCent)
+}
+
+// IsValid checks if specified value has a valid units/nanos signs and ranges.
+func IsValid(m pb.Money) bool {
+	return signMatches(m) && validNanos(m.GetNanos())
+}
+
+func signMatches(m pb.Money) bool {
+	return m.GetNanos() == 0 || m.GetUnits() == 0 || (m.GetNanos() < 0) == (m.GetUnits() < 0)
+}
+
+func validNanos(nanos int32) bool { return nanosMin <= nanos && nanos <= nanosMax }
+
+// IsZero returns true if the specified money value is equal to zero.
+func IsZero(m pb.Money) bool { return m.GetUnits() == 0 && m.GetNanos() == 0 }
+
+// IsNegative returns true if the specified money value is negative.
+func IsNegative(m pb.Money) bool {
+	return m.GetUnits() < 0 || (m.GetUnits() == 0 && m.GetNanos() < 0)
+}
+
+// Sum adds two values. Returns an error if one of the values are invalid or
+// currency codes are not matching.
+func Sum(l, r pb.Money) (pb.Money, error) {
+	if !IsValid(l) || !IsValid(r) {
+		return pb.Money{}, ErrInvalidValue
+	} else if l.GetCurrencyCode() != r.GetCurrencyCode() {
+		return pb.Money{}, ErrMismatchingCurrency
+	}
+	units := l.GetUnits() + r.GetUnits()
+	if (l.GetUnits() > 0 && r.GetUnits() > 0 && units < 0) || (l.GetUnits() < 0 && r.GetUnits() < 0 && units >= 0) {
+		return pb.Money{}, ErrOverflow
+	}
+	nanos := l.GetNanos() + r.GetNanos()
+
+	// Carry whole units out of nanos first, then make the signs of units and
+	// nanos agree.
+	carry := int64(nanos / nanosMod)
+	nanos %= nanosMod
+	if (carry > 0 && units == math.MaxInt64) || (carry < 0 && units == math.MinInt64) {
+		return pb.Money{}, ErrOverflow
+	}
+	units += carry
+	if units > 0 && nanos < 0 {
+		units--
+		nanos += nanosMod
+	} else if units < 0 && nanos > 0 {
+		units++
+		nanos -= nanosMod
+	}
+
+	return pb.Money{
+		Units:        units,
+		Nanos:        nanos,
+		CurrencyCode: l.GetCurrencyCode()}, nil
+}
+
+// Multiply returns m multiplied by n.
+func Multiply(m pb.Money, n int64) (pb.Money, error) {
+	if !IsValid(m) {
+		return pb.Money{}, ErrInvalidValue
+	}
+	units := m.GetUnits() * n
+	if n != 0 && units/n != m.GetUnits() {
+		return pb.Money{}, ErrOverflow
+	}
+	nanos := int64(m.GetNanos()) * n
+	return pb.Money{
+		Units:        units + nanos/nanosMod,
+		Nanos:        int32(nanos % nanosMod),
+		CurrencyCode: m.GetCurrencyCode()}, nil
+}
+
+// Format renders the value to the cent, e.g. "$5.05" for USD and "5.05 EUR"
+// for other currencies.
+func Format(m pb.Money) string {
+	cents := Cents(m)
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	amount := fmt.Sprintf("%d.%02d", cents/centsPerUnit, cents%centsPerUnit)
+	if m.GetCurrencyCode() == "USD" {
+		return sign + "$" + amount
+	}
+	return fmt.Sprintf("%s%s %s", sign, amount, m.GetCurrencyCode())
+}
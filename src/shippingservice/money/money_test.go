@@ -0,0 +1,168 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package money
+
+import (
+	"math"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+func mmc(u int64, n int32, c string) pb.Money { return pb.Money{Units: u, Nanos: n, CurrencyCode: c} }
+func mm(u int64, n int32) pb.Money            { return mmc(u, n, "USD") }
+
+func equal(l, r pb.Money) bool {
+	return l.GetCurrencyCode() == r.GetCurrencyCode() && l.GetUnits() == r.GetUnits() && l.GetNanos() == r.GetNanos()
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		units int64
+		nanos int32
+		ok    bool
+	}{
+		{"valid +/+", 5, 50000000, true},
+		{"valid -/-", -5, -50000000, true},
+		{"invalid +/-", 5, -50000000, false},
+		{"invalid nanos overflow", 0, 1000000000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New("USD", tt.units, tt.nanos); (err == nil) != tt.ok {
+				t.Errorf("New(%d, %d) error = %v, want ok=%v", tt.units, tt.nanos, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFromCents(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want pb.Money
+	}{
+		{0, mm(0, 0)},
+		{505, mm(5, 50000000)},
+		{899, mm(8, 990000000)},
+		{-505, mm(-5, -50000000)},
+	}
+	for _, tt := range tests {
+		if got := FromCents("USD", tt.in); !equal(got, tt.want) {
+			t.Errorf("FromCents(%d) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want pb.Money
+	}{
+		{8.99, mm(8, 990000000)},
+		{0.29, mm(0, 290000000)},
+		{0.1 + 0.2, mm(0, 300000000)},
+		{12.499999, mm(12, 500000000)},
+	}
+	for _, tt := range tests {
+		got, err := FromFloat("USD", tt.in)
+		if err != nil || !equal(got, tt.want) {
+			t.Errorf("FromFloat(%v) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []float64{math.NaN(), math.Inf(1), 1e20} {
+		if _, err := FromFloat("USD", in); err != ErrOverflow {
+			t.Errorf("FromFloat(%v) error = %v, want %v", in, err, ErrOverflow)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	tests := []struct {
+		name string
+		l, r pb.Money
+		want pb.Money
+		err  error
+	}{
+		{"carry", mm(1, 600000000), mm(2, 500000000), mm(4, 100000000), nil},
+		{"different signs", mm(5, 0), mm(-2, -10000000), mm(2, 990000000), nil},
+		{"sub-unit", mm(0, 500000000), mm(0, 200000000), mm(0, 700000000), nil},
+		{"sub-unit carry", mm(0, 500000000), mm(0, 600000000), mm(1, 100000000), nil},
+		{"negative sub-unit carry", mm(0, -500000000), mm(0, -600000000), mm(-1, -100000000), nil},
+		{"sub-unit to zero", mm(0, 500000000), mm(0, -500000000), mm(0, 0), nil},
+		{"crosses to negative", mm(0, 500000000), mm(-1, 0), mm(0, -500000000), nil},
+		{"crosses to positive", mm(-1, -500000000), mm(2, 0), mm(0, 500000000), nil},
+		{"unit less nanos", mm(1, 0), mm(0, -300000000), mm(0, 700000000), nil},
+		{"boundary", mm(0, 999999999), mm(0, 1), mm(1, 0), nil},
+		{"negative boundary", mm(0, -999999999), mm(0, -1), mm(-1, 0), nil},
+		{"largest nanos", mm(0, 999999999), mm(0, 999999999), mm(1, 999999998), nil},
+		{"carry overflow", mm(math.MaxInt64, 500000000), mm(0, 500000000), pb.Money{}, ErrOverflow},
+		{"mismatching currency", mm(1, 0), mmc(1, 0, "EUR"), pb.Money{}, ErrMismatchingCurrency},
+		{"invalid", mm(1, -1), mm(1, 0), pb.Money{}, ErrInvalidValue},
+		{"overflow", mm(math.MaxInt64, 0), mm(1, 0), pb.Money{}, ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sum(tt.l, tt.r)
+			if err != tt.err || !equal(got, tt.want) {
+				t.Errorf("Sum(%v, %v) = %v, %v, want %v, %v", tt.l, tt.r, got, err, tt.want, tt.err)
+			}
+			if err == nil && !IsValid(got) {
+				t.Errorf("Sum(%v, %v) = %v, which is not valid", tt.l, tt.r, got)
+			}
+		})
+	}
+}
+
+func TestMultiply(t *testing.T) {
+	tests := []struct {
+		name string
+		in   pb.Money
+		n    int64
+		want pb.Money
+		err  error
+	}{
+		{"zero", mm(8, 990000000), 0, mm(0, 0), nil},
+		{"carry", mm(8, 990000000), 3, mm(26, 970000000), nil},
+		{"negative", mm(1, 500000000), -2, mm(-3, 0), nil},
+		{"overflow", mm(math.MaxInt64/2, 0), 3, pb.Money{}, ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Multiply(tt.in, tt.n)
+			if err != tt.err || !equal(got, tt.want) {
+				t.Errorf("Multiply(%v, %d) = %v, %v, want %v, %v", tt.in, tt.n, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		in   pb.Money
+		want string
+	}{
+		{mm(5, 50000000), "$5.05"},
+		{mm(8, 990000000), "$8.99"},
+		{mm(0, 0), "$0.00"},
+		{mm(-1, -50000000), "-$1.05"},
+		{mmc(12, 500000000, "EUR"), "12.50 EUR"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.in); got != tt.want {
+			t.Errorf("Format(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultNATSSubject = "shipments"
+
+// natsPublisher publishes shipment events to NATS subjects of the form
+// <subject>.<event type>, optionally through JetStream for persistence. The
+// payload and trace context headers are the same as for Kafka.
+type natsPublisher struct {
+	subject string
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	encoder eventEncoder
+}
+
+// natsPublisherFromEnv connects to NATS_URL. Publishing goes through
+// JetStream when NATS_JETSTREAM is true.
+func natsPublisherFromEnv() *natsPublisher {
+	url := os.Getenv("NATS_URL")
+	if url == "" {
+		url = nats.DefaultURL
+	}
+	subject := defaultNATSSubject
+	if v := os.Getenv("NATS_SUBJECT"); v != "" {
+		subject = v
+	}
+
+	conn, err := nats.Connect(url,
+		nats.Name(serviceName),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		log.Fatalf("failed to connect to NATS at %s: %v", url, err)
+	}
+	p := &natsPublisher{subject: subject, conn: conn, encoder: eventEncoderFromEnv()}
+
+	if os.Getenv("NATS_JETSTREAM") == "true" {
+		p.js, err = conn.JetStream(nats.PublishAsyncErrHandler(func(_ nats.JetStream, m *nats.Msg, err error) {
+			log.WithError(err).Errorf("failed to publish event to JetStream subject %s", m.Subject)
+		}))
+		if err != nil {
+			log.Fatalf("failed to initialize JetStream: %v", err)
+		}
+	}
+	log.Infof("publishing shipment events to NATS subject %q at %s (jetstream=%t)", subject, url, p.js != nil)
+	return p
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, ev shipmentEvent) error {
+	subject := p.subject + "." + ev.Type
+	system := "nats"
+	if p.js != nil {
+		system = "nats-jetstream"
+	}
+	ctx, span := tracer.Start(ctx, subject+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String(system),
+			semconv.MessagingDestinationKey.String(subject),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingMessageIDKey.String(ev.ID),
+		),
+	)
+	defer span.End()
+
+	data, err := p.encoder.encode(ctx, ev)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set("event_type", ev.Type)
+	msg.Header.Set("Content-Type", p.encoder.contentType())
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(http.Header(msg.Header)))
+
+	if p.js != nil {
+		_, err = p.js.PublishMsgAsync(msg, nats.MsgId(ev.ID))
+	} else {
+		err = p.conn.PublishMsg(msg)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
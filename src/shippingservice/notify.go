@@ -0,0 +1,278 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultNotifyQueueSize   = 256
+	defaultNotifyWorkers     = 2
+	defaultNotifyMaxAttempts = 4
+)
+
+var errNotifyQueueFull = errors.New("notification queue is full")
+
+// notification is one message waiting to be sent over one channel.
+type notification struct {
+	ctx        context.Context
+	sender     notificationSender
+	tenant     string
+	trackingID string
+	data       messageData
+	queued     time.Time
+	// subject and body are rendered from the channel's templates when the
+	// message is sent.
+	subject string
+	body    string
+}
+
+// notificationSender sends messages over one channel, such as email or SMS.
+// send is called once per attempt, in a span of its own. The content comes
+// from the <channel>.subject and <channel>.body templates.
+type notificationSender interface {
+	channel() string
+	send(ctx context.Context, n notification) error
+}
+
+// notificationPipeline sends a message over every configured channel when a
+// shipment is created. Messages are queued and sent by a fixed number of
+// workers, after the request has returned, and retried with exponential
+// backoff. Their spans are children of the request span, so the trace of a
+// ShipOrder call shows every message it caused.
+type notificationPipeline struct {
+	senders   []notificationSender
+	templates *templateSource
+	queue     chan notification
+	workers   int
+	retry     retryPolicy
+	failures  metric.Int64Counter
+}
+
+func newNotificationPipeline(senders []notificationSender, size, workers int) *notificationPipeline {
+	p := &notificationPipeline{
+		senders:   senders,
+		templates: newTemplateSource(defaultTemplates),
+		queue:     make(chan notification, size),
+		workers:   workers,
+		retry:     retryPolicy{maxAttempts: defaultNotifyMaxAttempts, baseBackoff: 500 * time.Millisecond, maxBackoff: 30 * time.Second},
+	}
+	_, err := meter.Int64ObservableGauge("shipping.notifications.queue.depth",
+		metric.WithDescription("Notifications waiting to be sent."),
+		metric.WithUnit("{notification}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(len(p.queue)), metric.WithAttributes(attribute.Int("notifications.queue.capacity", cap(p.queue))))
+			return nil
+		}),
+	)
+	if err != nil {
+		log.WithError(err).Warn("failed to create notification queue metric")
+	}
+	if p.failures, err = meter.Int64Counter("shipping.notifications.failures",
+		metric.WithDescription("Notifications given up on, by channel and error type."),
+		metric.WithUnit("{notification}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create notification failures metric")
+	}
+	return p
+}
+
+// notificationPipelineFromEnv returns a pipeline sending over the channels
+// configured in the environment, with content from templates, or nil if
+// there are none.
+func notificationPipelineFromEnv(templates *templateSource) *notificationPipeline {
+	var senders []notificationSender
+	if e := emailSenderFromEnv(); e != nil {
+		senders = append(senders, e)
+	}
+	if sms := smsSenderFromEnv(); sms != nil {
+		senders = append(senders, sms)
+	}
+	if len(senders) == 0 {
+		return nil
+	}
+	p := newNotificationPipeline(senders,
+		envInt("NOTIFY_QUEUE_SIZE", defaultNotifyQueueSize),
+		envInt("NOTIFY_WORKERS", defaultNotifyWorkers))
+	p.retry.maxAttempts = envInt("NOTIFY_MAX_ATTEMPTS", defaultNotifyMaxAttempts)
+	p.templates = templates
+	return p
+}
+
+// shipmentCreated queues the messages announcing a new shipment.
+func (p *notificationPipeline) shipmentCreated(ctx context.Context, sh shipment) {
+	data := shipmentMessageData(sh)
+	for _, s := range p.senders {
+		p.enqueue(ctx, notification{
+			ctx:        detachedContext(ctx),
+			sender:     s,
+			tenant:     sh.Tenant,
+			trackingID: sh.TrackingID,
+			data:       data,
+			queued:     time.Now(),
+		})
+	}
+}
+
+// enqueue queues a message, recording it on the request span. A message that
+// does not fit is dropped and counted as failed.
+func (p *notificationPipeline) enqueue(ctx context.Context, n notification) {
+	span := trace.SpanFromContext(ctx)
+	attrs := trace.WithAttributes(attribute.String("notification.channel", n.sender.channel()))
+	select {
+	case p.queue <- n:
+		span.AddEvent("notification.queued", attrs)
+	default:
+		span.AddEvent("notification.dropped", attrs)
+		log.Ctx(ctx).WithError(errNotifyQueueFull).Warnf("dropping %s notification for %s", n.sender.channel(), n.trackingID)
+		p.failed(ctx, n, "queue_full")
+	}
+}
+
+// run sends messages until stop is closed, and then sends the messages
+// still queued. Messages still queued when ctx is done are dropped.
+func (p *notificationPipeline) run(ctx context.Context, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-p.queue:
+					p.deliver(ctx, n)
+				case <-stop:
+					for ctx.Err() == nil {
+						select {
+						case n := <-p.queue:
+							p.deliver(ctx, n)
+						default:
+							return
+						}
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(p.queue); n > 0 {
+		log.Warnf("dropping %d queued notifications", n)
+	}
+}
+
+// deliver sends a message, with the cancellation of ctx and the trace context
+// and baggage of the request that queued it, retrying until it succeeds or
+// runs out of attempts.
+func (p *notificationPipeline) deliver(ctx context.Context, n notification) {
+	ctx, span := tracer.Start(carryContext(ctx, n.ctx), "notification.deliver", trace.WithAttributes(
+		attribute.String("notification.channel", n.sender.channel()),
+		attribute.Int64("notification.queue.wait_ms", time.Since(n.queued).Milliseconds()),
+		attribute.String("tenant.id", n.tenant),
+		attribute.String("shipment.tracking_id", n.trackingID),
+	))
+	defer span.End()
+
+	if err := p.render(ctx, &n); err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		log.Ctx(ctx).WithError(err).Errorf("failed to render %s notification for %s", n.sender.channel(), n.trackingID)
+		p.failed(ctx, n, "render_failed")
+		return
+	}
+	var err error
+	attempt := 1
+	for ; attempt <= p.retry.maxAttempts; attempt++ {
+		if err = p.attempt(ctx, n, attempt); err == nil || attempt == p.retry.maxAttempts {
+			break
+		}
+		if sleepContext(ctx, p.retry.backoff(attempt)) != nil {
+			break
+		}
+	}
+	span.SetAttributes(attribute.Int("notification.attempts", attempt))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		log.Ctx(ctx).WithError(err).Errorf("giving up on %s notification for %s after %d attempt(s)", n.sender.channel(), n.trackingID, attempt)
+		p.failed(ctx, n, "send_failed")
+	}
+}
+
+// render fills in the subject, for channels that have one, and the body of a
+// message from the channel's templates.
+func (p *notificationPipeline) render(ctx context.Context, n *notification) error {
+	ch := n.sender.channel()
+	if p.templates.defined(ctx, ch+".subject") {
+		subject, err := p.templates.render(ctx, ch+".subject", n.data)
+		if err != nil {
+			return err
+		}
+		n.subject = subject
+	}
+	body, err := p.templates.render(ctx, ch+".body", n.data)
+	if err != nil {
+		return err
+	}
+	n.body = body
+	return nil
+}
+
+// attempt makes a single attempt at sending a message, in a span of its own.
+func (p *notificationPipeline) attempt(ctx context.Context, n notification, attempt int) error {
+	ctx, span := tracer.Start(ctx, n.sender.channel()+".send", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("notification.attempt", attempt)))
+	defer span.End()
+	err := n.sender.send(ctx, n)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	return err
+}
+
+func (p *notificationPipeline) failed(ctx context.Context, n notification, errorType string) {
+	if p.failures == nil {
+		return
+	}
+	p.failures.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("notification.channel", n.sender.channel()),
+		attribute.String("error.type", errorType),
+	))
+}
+
+// notifyShipped announces a new shipment of tenant over the notification
+// channels, if there are any.
+func (s *server) notifyShipped(ctx context.Context, tenant, trackingID string) {
+	if s.notify == nil {
+		return
+	}
+	sh, err := s.shipments.get(ctx, tenant, trackingID)
+	if err != nil {
+		return
+	}
+	s.notify.shipmentCreated(ctx, sh)
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// fakeSender fails the first failures sends and records the rest.
+type fakeSender struct {
+	name     string
+	failures int
+
+	mu   sync.Mutex
+	sent []notification
+	done chan struct{}
+}
+
+func (f *fakeSender) channel() string { return f.name }
+
+func (f *fakeSender) send(_ context.Context, n notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("relay unavailable")
+	}
+	f.sent = append(f.sent, n)
+	close(f.done)
+	return nil
+}
+
+// TestNotificationRetries checks that ShipOrder queues a message that is
+// retried until it is sent, in spans that are part of the request's trace.
+func TestNotificationRetries(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	sender := &fakeSender{name: "email", failures: 1, done: make(chan struct{})}
+	s := newServer()
+	s.notify = newNotificationPipeline([]notificationSender{sender}, 1, 1)
+	s.notify.retry.baseBackoff = time.Millisecond
+
+	ctx, span := tracer.Start(context.Background(), "ShipOrder")
+	res, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}})
+	span.End()
+	if err != nil {
+		t.Fatalf("TestNotificationRetries: ShipOrder failed: %v", err)
+	}
+	if n := countEvents(span.(sdktrace.ReadOnlySpan), "notification.queued"); n != 1 {
+		t.Errorf("TestNotificationRetries: %d notification.queued events, want 1", n)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.notify.run(runCtx, nil)
+		close(stopped)
+	}()
+	select {
+	case <-sender.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("TestNotificationRetries: notification was not sent")
+	}
+	cancel()
+	<-stopped
+
+	if got := sender.sent[0].trackingID; got != res.TrackingId {
+		t.Errorf("TestNotificationRetries: notification for %q, want %q", got, res.TrackingId)
+	}
+	var deliver sdktrace.ReadOnlySpan
+	attempts := 0
+	for _, sp := range rec.Ended() {
+		switch sp.Name() {
+		case "notification.deliver":
+			deliver = sp
+		case "email.send":
+			attempts++
+		}
+	}
+	if deliver == nil {
+		t.Fatal("TestNotificationRetries: no notification.deliver span")
+	}
+	if deliver.Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("TestNotificationRetries: notification.deliver has parent %v, want the ShipOrder span", deliver.Parent())
+	}
+	if attempts != 2 {
+		t.Errorf("TestNotificationRetries: %d email.send spans, want 2", attempts)
+	}
+}
+
+// TestNotificationFailures checks that messages given up on, or dropped for
+// want of room in the queue, are counted as failures.
+func TestNotificationFailures(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	saved := meter
+	meter = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(serviceName)
+	defer func() { meter = saved }()
+
+	sender := &fakeSender{name: "email", failures: 10, done: make(chan struct{})}
+	p := newNotificationPipeline([]notificationSender{sender}, 1, 1)
+	p.retry.maxAttempts = 2
+	p.retry.baseBackoff = time.Millisecond
+	ctx := context.Background()
+	p.shipmentCreated(ctx, shipment{TrackingID: "AB-123"})
+	p.shipmentCreated(ctx, shipment{TrackingID: "AB-456"})
+	p.deliver(ctx, <-p.queue)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("TestNotificationFailures: %v", err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					v, _ := dp.Attributes.Value("error.type")
+					got[m.Name+"/"+v.AsString()] += dp.Value
+				}
+			}
+		}
+	}
+	for _, key := range []string{"shipping.notifications.failures/queue_full", "shipping.notifications.failures/send_failed"} {
+		if got[key] != 1 {
+			t.Errorf("TestNotificationFailures: %s = %d, want 1", key, got[key])
+		}
+	}
+	if sender.failures != 8 {
+		t.Errorf("TestNotificationFailures: %d attempts made, want 2", 10-sender.failures)
+	}
+}
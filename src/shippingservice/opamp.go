@@ -0,0 +1,257 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-telemetry/opamp-go/client"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultOpAMPPollInterval = 30 * time.Second
+
+	// opampConfigName is the key of this service's file in the agent config
+	// map that the OpAMP server offers.
+	opampConfigName = serviceName
+
+	opampCapabilities = protobufs.AgentCapabilities_AgentCapabilities_ReportsStatus |
+		protobufs.AgentCapabilities_AgentCapabilities_AcceptsRemoteConfig |
+		protobufs.AgentCapabilities_AgentCapabilities_ReportsEffectiveConfig |
+		protobufs.AgentCapabilities_AgentCapabilities_ReportsHealth |
+		protobufs.AgentCapabilities_AgentCapabilities_ReportsRemoteConfig
+)
+
+// remoteSettings are the settings an OpAMP server can change, sent as the
+// YAML body of the "shippingservice" config file. Settings that are left out
+// return to the values the service was started with.
+type remoteSettings struct {
+	SamplingRatio *float64 `yaml:"sampling_ratio,omitempty"`
+	LogLevel      string   `yaml:"log_level,omitempty"`
+	ChaosMode     *bool    `yaml:"chaos_mode,omitempty"`
+}
+
+// opampAgent reports the service to an OpAMP server with the opamp-go
+// client, over the plain HTTP transport. It applies the remote configuration
+// the server offers and reports the effective configuration and health back,
+// so a fleet of instances can be tuned from one place while the workshop
+// runs.
+type opampAgent struct {
+	endpoint string
+	interval time.Duration
+	start    time.Time
+	uid      types.InstanceUid
+
+	sampler  *ratioSampler
+	faults   *faultInjector
+	log      *logger
+	health   *healthRegistry
+	defaults remoteSettings
+
+	mu       sync.Mutex
+	lastHash []byte
+}
+
+func newOpAMPAgent(endpoint string, sampler *ratioSampler, faults *faultInjector, l *logger, health *healthRegistry) *opampAgent {
+	ratio, chaos := sampler.ratio(), faults.enabled.Load()
+	return &opampAgent{
+		endpoint: endpoint,
+		interval: defaultOpAMPPollInterval,
+		start:    time.Now(),
+		uid:      types.InstanceUid(uuid.New()),
+		sampler:  sampler,
+		faults:   faults,
+		log:      l,
+		health:   health,
+		defaults: remoteSettings{SamplingRatio: &ratio, LogLevel: strings.ToLower(levelName(l.Level())), ChaosMode: &chaos},
+	}
+}
+
+// opampAgentFromEnv connects to OPAMP_ENDPOINT, e.g.
+// "http://opamp-server:4320/v1/opamp", or returns nil if it is not set.
+func opampAgentFromEnv(sampler *ratioSampler, faults *faultInjector, health *healthRegistry) *opampAgent {
+	endpoint := os.Getenv("OPAMP_ENDPOINT")
+	if endpoint == "" {
+		return nil
+	}
+	a := newOpAMPAgent(endpoint, sampler, faults, log, health)
+	a.interval = envDuration("OPAMP_POLL_INTERVAL", defaultOpAMPPollInterval)
+	log.Infof("reporting to OpAMP server at %s", endpoint)
+	return a
+}
+
+// run reports to the server until ctx is done. The client polls the server
+// every interval; a change of health is reported at the next poll.
+func (a *opampAgent) run(ctx context.Context) {
+	c := client.NewHTTP(opampLogger{a.log})
+	c.SetPollingInterval(a.interval)
+	c.SetAgentDescription(a.description())
+	health := a.componentHealth()
+	c.SetHealth(health)
+	err := c.Start(ctx, types.StartSettings{
+		OpAMPServerURL: a.endpoint,
+		InstanceUid:    a.uid,
+		Capabilities:   opampCapabilities,
+		Callbacks: types.CallbacksStruct{
+			OnErrorFunc: func(_ context.Context, err *protobufs.ServerErrorResponse) {
+				a.log.Warnf("OpAMP server error: %s", err.GetErrorMessage())
+			},
+			OnMessageFunc: func(ctx context.Context, msg *types.MessageData) {
+				if status := a.handle(msg.RemoteConfig); status != nil {
+					c.SetRemoteConfigStatus(status)
+					c.UpdateEffectiveConfig(ctx)
+				}
+			},
+			GetEffectiveConfigFunc: func(context.Context) (*protobufs.EffectiveConfig, error) {
+				return a.effectiveConfig(), nil
+			},
+		},
+	})
+	if err != nil {
+		a.log.WithError(err).Warn("failed to start the OpAMP client")
+		return
+	}
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.Stop(stopCtx)
+	}()
+
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if h := a.componentHealth(); h.Healthy != health.Healthy || h.Status != health.Status {
+			health = h
+			c.SetHealth(h)
+		}
+	}
+}
+
+// handle applies a remote config the agent has not seen yet, and returns the
+// status to report for it, or nil if there is nothing new.
+func (a *opampAgent) handle(rc *protobufs.AgentRemoteConfig) *protobufs.RemoteConfigStatus {
+	if rc == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lastHash != nil && string(rc.ConfigHash) == string(a.lastHash) {
+		return nil
+	}
+	a.lastHash = rc.ConfigHash
+	status := &protobufs.RemoteConfigStatus{LastRemoteConfigHash: rc.ConfigHash}
+	var body []byte
+	if f := rc.GetConfig().GetConfigMap()[opampConfigName]; f != nil {
+		body = f.Body
+	}
+	if err := a.apply(body); err != nil {
+		status.Status, status.ErrorMessage = protobufs.RemoteConfigStatuses_RemoteConfigStatuses_FAILED, err.Error()
+		a.log.WithError(err).Warn("rejected OpAMP remote config")
+	} else {
+		status.Status = protobufs.RemoteConfigStatuses_RemoteConfigStatuses_APPLIED
+		a.log.Infof("applied OpAMP remote config %x", rc.ConfigHash)
+	}
+	return status
+}
+
+// apply parses and applies a config file body. Nothing is changed unless
+// every setting is valid.
+func (a *opampAgent) apply(body []byte) error {
+	var s remoteSettings
+	if err := yaml.Unmarshal(body, &s); err != nil {
+		return err
+	}
+	if s.SamplingRatio == nil {
+		s.SamplingRatio = a.defaults.SamplingRatio
+	}
+	if r := *s.SamplingRatio; r < 0 || r > 1 {
+		return fmt.Errorf("sampling_ratio must be between 0 and 1, got %v", r)
+	}
+	if s.LogLevel == "" {
+		s.LogLevel = a.defaults.LogLevel
+	}
+	level, err := parseLevel(s.LogLevel)
+	if err != nil {
+		return err
+	}
+	if s.ChaosMode == nil {
+		s.ChaosMode = a.defaults.ChaosMode
+	}
+	a.sampler.setRatio(*s.SamplingRatio)
+	a.log.SetLevel(level)
+	a.faults.setEnabled(*s.ChaosMode)
+	return nil
+}
+
+// effectiveConfig returns the settings in force, as a YAML config file.
+func (a *opampAgent) effectiveConfig() *protobufs.EffectiveConfig {
+	ratio, chaos := a.sampler.ratio(), a.faults.enabled.Load()
+	b, _ := yaml.Marshal(remoteSettings{SamplingRatio: &ratio, LogLevel: strings.ToLower(levelName(a.log.Level())), ChaosMode: &chaos})
+	return &protobufs.EffectiveConfig{ConfigMap: &protobufs.AgentConfigMap{
+		ConfigMap: map[string]*protobufs.AgentConfigFile{opampConfigName: {Body: b, ContentType: "text/yaml"}},
+	}}
+}
+
+// description identifies the instance to the server.
+func (a *opampAgent) description() *protobufs.AgentDescription {
+	d := &protobufs.AgentDescription{IdentifyingAttributes: []*protobufs.KeyValue{
+		opampString("service.name", serviceName),
+		opampString("service.instance.id", uuid.UUID(a.uid).String()),
+	}}
+	if host, err := os.Hostname(); err == nil {
+		d.NonIdentifyingAttributes = append(d.NonIdentifyingAttributes, opampString("host.name", host))
+	}
+	return d
+}
+
+// componentHealth reports the health registry.
+func (a *opampAgent) componentHealth() *protobufs.ComponentHealth {
+	healthy, state := true, healthOK
+	if a.health != nil {
+		rep := a.health.report()
+		healthy, state = rep.Status != healthDown && rep.Status != healthDraining, rep.Status
+	}
+	return &protobufs.ComponentHealth{Healthy: healthy, StartTimeUnixNano: uint64(a.start.UnixNano()), Status: string(state)}
+}
+
+func opampString(key, value string) *protobufs.KeyValue {
+	return &protobufs.KeyValue{Key: key, Value: &protobufs.AnyValue{Value: &protobufs.AnyValue_StringValue{StringValue: value}}}
+}
+
+// opampLogger writes the logs of the OpAMP client, whose errors are failed
+// polls that the next poll retries, as warnings.
+type opampLogger struct{ l *logger }
+
+func (o opampLogger) Debugf(ctx context.Context, format string, v ...interface{}) {
+	o.l.Ctx(ctx).Debugf("OpAMP: "+format, v...)
+}
+
+func (o opampLogger) Errorf(ctx context.Context, format string, v ...interface{}) {
+	o.l.Ctx(ctx).Warnf("OpAMP: "+format, v...)
+}
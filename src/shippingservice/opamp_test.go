@@ -0,0 +1,151 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeOpAMPServer offers one remote config and records what the agent reports.
+type fakeOpAMPServer struct {
+	mu           sync.Mutex
+	config, hash string
+
+	effective    string
+	configStatus protobufs.RemoteConfigStatuses
+	configError  string
+}
+
+func (f *fakeOpAMPServer) offer(config, hash string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config, f.hash = config, hash
+}
+
+func (f *fakeOpAMPServer) reported() (effective string, status protobufs.RemoteConfigStatuses, errMsg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.effective, f.configStatus, f.configError
+}
+
+func (f *fakeOpAMPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var msg protobufs.AgentToServer
+	if err := proto.Unmarshal(body, &msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if file := msg.GetEffectiveConfig().GetConfigMap().GetConfigMap()[opampConfigName]; file != nil {
+		f.effective = string(file.Body)
+	}
+	if st := msg.GetRemoteConfigStatus(); st != nil {
+		f.configStatus, f.configError = st.Status, st.ErrorMessage
+	}
+
+	resp, _ := proto.Marshal(&protobufs.ServerToAgent{
+		InstanceUid: msg.InstanceUid,
+		RemoteConfig: &protobufs.AgentRemoteConfig{
+			Config: &protobufs.AgentConfigMap{ConfigMap: map[string]*protobufs.AgentConfigFile{
+				opampConfigName: {Body: []byte(f.config)},
+			}},
+			ConfigHash: []byte(f.hash),
+		},
+	})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+// TestOpAMPRemoteConfig checks that a remote config changes the sampling
+// ratio and log level, and that the result is reported back.
+func TestOpAMPRemoteConfig(t *testing.T) {
+	srv := &fakeOpAMPServer{config: "sampling_ratio: 0.25\nlog_level: warn\nchaos_mode: true\n", hash: "v1"}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	l, err := newLogger(io.Discard, "info", "json")
+	if err != nil {
+		t.Fatalf("TestOpAMPRemoteConfig: %v", err)
+	}
+	sampler, faults := newRatioSampler(1), newFaultInjector(false)
+	a := newOpAMPAgent(ts.URL, sampler, faults, l, newHealthRegistry())
+	a.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// eventually waits until cond holds, as the agent applies configs in the
+	// background.
+	eventually := func(cond func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if cond() {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !eventually(func() bool {
+		effective, status, _ := srv.reported()
+		return status == protobufs.RemoteConfigStatuses_RemoteConfigStatuses_APPLIED && strings.Contains(effective, "sampling_ratio: 0.25")
+	}) {
+		effective, status, _ := srv.reported()
+		t.Fatalf("TestOpAMPRemoteConfig: agent reported status %v and effective config %q", status, effective)
+	}
+	if sampler.ratio() != 0.25 || l.Level() != slog.LevelWarn || !faults.enabled.Load() {
+		t.Errorf("TestOpAMPRemoteConfig: ratio %v, level %v, chaos mode %v after remote config", sampler.ratio(), l.Level(), faults.enabled.Load())
+	}
+	if a.handle(&protobufs.AgentRemoteConfig{ConfigHash: []byte("v1")}) != nil {
+		t.Errorf("TestOpAMPRemoteConfig: the same config was applied twice")
+	}
+
+	srv.offer("sampling_ratio: 2\nlog_level: debug\n", "v2")
+	if !eventually(func() bool {
+		_, status, errMsg := srv.reported()
+		return status == protobufs.RemoteConfigStatuses_RemoteConfigStatuses_FAILED && errMsg != ""
+	}) {
+		_, status, errMsg := srv.reported()
+		t.Errorf("TestOpAMPRemoteConfig: agent reported status %v, error %q for an invalid config", status, errMsg)
+	}
+	if sampler.ratio() != 0.25 || l.Level() != slog.LevelWarn {
+		t.Errorf("TestOpAMPRemoteConfig: an invalid config changed ratio to %v, level to %v", sampler.ratio(), l.Level())
+	}
+
+	srv.offer("", "v3")
+	if !eventually(func() bool {
+		return sampler.ratio() == 1 && l.Level() == slog.LevelInfo && !faults.enabled.Load()
+	}) {
+		t.Errorf("TestOpAMPRemoteConfig: an empty config left ratio %v, level %v, chaos mode %v", sampler.ratio(), l.Level(), faults.enabled.Load())
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// rateOptions are the prices of the options of an order, on top of the
+// price of its parcel.
+type rateOptions struct {
+	// ServiceLevels multiply the price, by level; levels without a
+	// multiplier are charged at 1.0.
+	ServiceLevels map[string]float64 `yaml:"service_levels"`
+	// Signature is added when a signature is required.
+	Signature float64       `yaml:"signature"`
+	Insurance insuranceRate `yaml:"insurance"`
+}
+
+// insuranceRate prices insurance as a share of the declared value, with a
+// minimum, up to a largest insurable value.
+type insuranceRate struct {
+	Rate             float64 `yaml:"rate"`
+	Minimum          float64 `yaml:"minimum"`
+	MaxDeclaredValue float64 `yaml:"max_declared_value"`
+}
+
+// validate checks the option prices of a rate table.
+func (o rateOptions) validate() error {
+	for name, m := range o.ServiceLevels {
+		if _, ok := pb.ServiceLevel_value["SERVICE_LEVEL_"+strings.ToUpper(name)]; !ok {
+			return fmt.Errorf("unknown service level %q", name)
+		}
+		if m <= 0 {
+			return fmt.Errorf("service level %q must have a positive multiplier", name)
+		}
+	}
+	if o.Signature < 0 || o.Insurance.Rate < 0 || o.Insurance.Minimum < 0 || o.Insurance.MaxDeclaredValue < 0 {
+		return fmt.Errorf("negative option price")
+	}
+	return nil
+}
+
+// shippingOptions are the options of an order, as quoted and then shipped.
+// The zero value is a standard order without extras. It is comparable, so
+// that an order can be checked against the options of its quote; Level is
+// left unspecified for the standard level, so that quotes issued before
+// there were options match standard orders.
+type shippingOptions struct {
+	Level         pb.ServiceLevel `json:"level,omitempty"`
+	DeclaredCents int64           `json:"declared_cents,omitempty"`
+	Signature     bool            `json:"signature,omitempty"`
+	Insured       bool            `json:"insured,omitempty"`
+}
+
+// level is the service level of the order.
+func (o shippingOptions) level() pb.ServiceLevel {
+	if o.Level == pb.ServiceLevel_SERVICE_LEVEL_UNSPECIFIED {
+		return pb.ServiceLevel_SERVICE_LEVEL_STANDARD
+	}
+	return o.Level
+}
+
+// serviceLevelName is the rate table's name for a service level, e.g.
+// "premium".
+func serviceLevelName(l pb.ServiceLevel) string {
+	return strings.ToLower(strings.TrimPrefix(l.String(), "SERVICE_LEVEL_"))
+}
+
+// shippingOptions validates the options of an order against the table and
+// returns them, or the fields that are invalid. field is the path of the
+// options in the request, such as "options".
+func (rt *rateTable) shippingOptions(in *pb.ShippingOptions, field string) (shippingOptions, []*errdetails.BadRequest_FieldViolation) {
+	var violations []*errdetails.BadRequest_FieldViolation
+	invalid := func(name, desc string) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: field + "." + name, Description: desc})
+	}
+	opts := shippingOptions{
+		Level:     in.GetServiceLevel(),
+		Signature: in.GetSignatureRequired(),
+		Insured:   in.GetInsured(),
+	}
+	if opts.Level == pb.ServiceLevel_SERVICE_LEVEL_STANDARD {
+		opts.Level = pb.ServiceLevel_SERVICE_LEVEL_UNSPECIFIED
+	}
+	if _, ok := pb.ServiceLevel_name[int32(opts.Level)]; !ok {
+		invalid("service_level", fmt.Sprintf("unknown service level %d", opts.Level))
+	}
+	if v := in.GetDeclaredValue(); v != nil {
+		switch {
+		case v.GetCurrencyCode() != "USD":
+			invalid("declared_value", "declared value must be in USD")
+		case !money.IsValid(*v) || money.IsNegative(*v):
+			invalid("declared_value", "declared value must be a valid, positive amount")
+		default:
+			opts.DeclaredCents = money.Cents(*v)
+		}
+	}
+	if opts.Insured {
+		max := rt.Options.Insurance.MaxDeclaredValue
+		switch {
+		case opts.DeclaredCents == 0:
+			invalid("declared_value", "declared value is required for insurance")
+		case max > 0 && float64(opts.DeclaredCents) > max*100:
+			invalid("declared_value", fmt.Sprintf("declared value can be insured up to $%.2f", max))
+		}
+	}
+	return opts, violations
+}
+
+// attributes describe the options on the span of the request.
+func (o shippingOptions) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("shipping.service_level", serviceLevelName(o.level())),
+		attribute.Bool("shipping.signature_required", o.Signature),
+		attribute.Bool("shipping.insured", o.Insured),
+		attribute.Float64("shipping.declared_value_usd", float64(o.DeclaredCents)/100),
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// TestShippingOptions checks that the options of an order are priced on top
+// of its parcel, and that an order must keep the options it was quoted for.
+func TestShippingOptions(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}}
+	base, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items})
+	if err != nil {
+		t.Fatalf("TestShippingOptions: %v", err)
+	}
+	declared := money.FromCents("USD", 30000)
+	opts := &pb.ShippingOptions{
+		ServiceLevel:      pb.ServiceLevel_SERVICE_LEVEL_PREMIUM,
+		DeclaredValue:     &declared,
+		SignatureRequired: true,
+		Insured:           true,
+	}
+	quote, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, Options: opts})
+	if err != nil {
+		t.Fatalf("TestShippingOptions: %v", err)
+	}
+	// Premium is 1.25 times the parcel, plus $2.50 for the signature and 1%
+	// of $300 for insurance.
+	want := (money.Cents(*base.CostUsd)*125+50)/100 + 250 + 300
+	if got := money.Cents(*quote.CostUsd); got != want {
+		t.Errorf("TestShippingOptions: quote with options is %d cents, want %d", got, want)
+	}
+
+	_, err = s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, Options: &pb.ShippingOptions{Insured: true}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TestShippingOptions: insurance without a declared value returned %v", err)
+	}
+	tooMuch := money.FromCents("USD", 600000)
+	_, err = s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, Options: &pb.ShippingOptions{Insured: true, DeclaredValue: &tooMuch}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TestShippingOptions: insurance over the maximum returned %v", err)
+	}
+
+	_, err = s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: benchmarkAddress, Items: items, QuoteId: quote.QuoteId})
+	if info, _ := errorDetails(err); info == nil || info.Reason != reasonQuoteMismatch {
+		t.Errorf("TestShippingOptions: order without the quoted options returned %v", err)
+	}
+	shipped, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: benchmarkAddress, Items: items, QuoteId: quote.QuoteId, Options: opts})
+	if err != nil || money.Cents(*shipped.CostUsd) != want {
+		t.Errorf("TestShippingOptions: order with the quoted options returned %v (%v)", shipped, err)
+	}
+	standard := &pb.ShippingOptions{ServiceLevel: pb.ServiceLevel_SERVICE_LEVEL_STANDARD}
+	if _, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: benchmarkAddress, Items: items, QuoteId: base.QuoteId, Options: standard}); err != nil {
+		t.Errorf("TestShippingOptions: explicitly standard order returned %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// StreamOrders takes orders for as long as the client keeps the stream open.
+// Each order is acknowledged as soon as it is received and shipped by a pool
+// of workers, which send its result when done. A stream can outlive any
+// sensible trace, so, as in ShipOrders, every order gets its own trace linked
+// to the stream span instead of growing the stream's trace without bound.
+func (s *server) StreamOrders(stream pb.ShippingService_StreamOrdersServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	log.Ctx(ctx).Info("[StreamOrders] stream opened")
+
+	streamSpan := trace.SpanFromContext(ctx)
+
+	// A stream must not be sent to concurrently, so acknowledgements and
+	// results all go through one sender. Once sending fails, the rest
+	// is discarded so that workers never block.
+	out := make(chan *pb.StreamOrdersResponse)
+	sent := make(chan error, 1)
+	go func() {
+		var err error
+		for res := range out {
+			if err == nil {
+				if err = stream.Send(res); err != nil {
+					cancel()
+				}
+			}
+		}
+		sent <- err
+	}()
+
+	workers := s.batchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	pool := newWorkerPool(workers, linkedSpans)
+	var mu sync.Mutex
+	failed := 0
+
+	received := 0
+	var recvErr error
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				recvErr = err
+			}
+			break
+		}
+		out <- &pb.StreamOrdersResponse{Index: int32(received), Ref: req.Ref}
+		index := received
+		// An order is known by its ref, if it has one, so that a client
+		// resending some of its orders on a new stream is not shipped
+		// them twice.
+		item := strconv.Itoa(index)
+		if req.Ref != "" {
+			item = "ref:" + req.Ref
+		}
+		ship := func(ctx context.Context) error {
+			res, err := s.shipBatchItem(withIdempotencyItem(ctx, item), req.GetOrder())
+			if err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+			out <- &pb.StreamOrdersResponse{Index: int32(index), Ref: req.Ref, Result: res}
+			return err
+		}
+		pool.submit(ctx, "StreamOrders/order", ship, trace.WithAttributes(attribute.Int("stream.index", index)))
+		received++
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	pool.wait()
+	close(out)
+	sendErr := <-sent
+
+	streamSpan.SetAttributes(attribute.Int("stream.orders", received), attribute.Int("stream.failed", failed))
+	log.Ctx(ctx).Infof("[StreamOrders] stream closed after %d orders", received)
+	if recvErr != nil {
+		return recvErr
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	return abandoned(stream.Context())
+}
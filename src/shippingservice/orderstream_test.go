@@ -0,0 +1,180 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestStreamOrders checks that every order is acknowledged before its result
+// is sent, that a request without an order fails on its own, and that each
+// order is traced on its own, linked to the stream.
+func TestStreamOrders(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	client, stop := goldenClient(t, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	valid := &pb.ShipOrderRequest{
+		Address: &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043},
+		Items:   []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}},
+	}
+	orders := []*pb.ShipOrderRequest{valid, {Address: &pb.Address{Country: "USA"}, Items: valid.Items}, valid, nil}
+
+	stream, err := client.StreamOrders(context.Background())
+	if err != nil {
+		t.Fatalf("TestStreamOrders: %v", err)
+	}
+	for i, o := range orders {
+		if err := stream.Send(&pb.StreamOrdersRequest{Order: o, Ref: fmt.Sprintf("order-%d", i)}); err != nil {
+			t.Fatalf("TestStreamOrders: %v", err)
+		}
+	}
+	stream.CloseSend()
+
+	acked := make(map[int32]bool)
+	results := make(map[int32]*pb.ShipOrderResult)
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("TestStreamOrders: %v", err)
+		}
+		if want := fmt.Sprintf("order-%d", res.Index); res.Ref != want {
+			t.Errorf("TestStreamOrders: response for order %d has ref %q, expected %q", res.Index, res.Ref, want)
+		}
+		if res.Result == nil {
+			acked[res.Index] = true
+			continue
+		}
+		if !acked[res.Index] {
+			t.Errorf("TestStreamOrders: result for order %d arrived before its acknowledgement", res.Index)
+		}
+		results[res.Index] = res.Result
+	}
+	stop()
+
+	if len(results) != len(orders) {
+		t.Fatalf("TestStreamOrders: got %d results, expected %d", len(results), len(orders))
+	}
+	for i, r := range results {
+		if failed := r.Code != int32(codes.OK); failed != (i == 1 || i == 3) {
+			t.Errorf("TestStreamOrders: order %d got code %d (%s)", i, r.Code, r.Error)
+		}
+		if i == 3 && r.Code != int32(codes.InvalidArgument) {
+			t.Errorf("TestStreamOrders: request without an order got code %d (%s), expected InvalidArgument", r.Code, r.Error)
+		}
+		if r.Code == int32(codes.OK) && r.TrackingId == "" {
+			t.Errorf("TestStreamOrders: order %d has no tracking ID", i)
+		}
+	}
+
+	var streamSpan trace.SpanContext
+	var orderSpans []sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		switch {
+		case s.Name() == "hipstershop.ShippingService/StreamOrders" && s.SpanKind() == trace.SpanKindServer:
+			streamSpan = s.SpanContext()
+		case s.Name() == "StreamOrders/order":
+			orderSpans = append(orderSpans, s)
+		}
+	}
+	if len(orderSpans) != len(orders) {
+		t.Fatalf("TestStreamOrders: got %d order spans, expected %d", len(orderSpans), len(orders))
+	}
+	for _, s := range orderSpans {
+		if s.SpanContext().TraceID() == streamSpan.TraceID() {
+			t.Errorf("TestStreamOrders: order span is in the stream's trace")
+		}
+		if links := s.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != streamSpan.SpanID() {
+			t.Errorf("TestStreamOrders: order span links are %v, expected the stream span", links)
+		}
+	}
+}
+
+// TestStreamOrdersTenant checks that the orders of a stream opened by a tenant
+// other than the default one are shipped for that tenant.
+func TestStreamOrdersTenant(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := newServer()
+	tenants := newTenancy(0, 0, 0, defaultTenantMetricLimit)
+	srv := grpc.NewServer(grpc.ChainStreamInterceptor(
+		tenants.stream(),
+		newLoadShedder(10, nil, defaultShedRetryAfter).stream(),
+		tenants.limitStream(),
+		timeoutStreamInterceptor(defaultRPCTimeouts),
+	))
+	pb.RegisterShippingServiceServer(srv, svc)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), tenantHeader, "team-a")
+	stream, err := pb.NewShippingServiceClient(cc).StreamOrders(ctx)
+	if err != nil {
+		t.Fatalf("TestStreamOrdersTenant: %v", err)
+	}
+	order := &pb.ShipOrderRequest{
+		Address: &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043},
+		Items:   []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}},
+	}
+	if err := stream.Send(&pb.StreamOrdersRequest{Order: order}); err != nil {
+		t.Fatalf("TestStreamOrdersTenant: %v", err)
+	}
+	stream.CloseSend()
+	var trackingID string
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("TestStreamOrdersTenant: %v", err)
+		}
+		if res.Result != nil {
+			trackingID = res.Result.TrackingId
+		}
+	}
+	if trackingID == "" {
+		t.Fatal("TestStreamOrdersTenant: the order was not shipped")
+	}
+	if _, err := svc.shipments.get(context.Background(), "team-a", trackingID); err != nil {
+		t.Errorf("TestStreamOrdersTenant: shipment %s is not team-a's: %v", trackingID, err)
+	}
+	if _, err := svc.shipments.get(context.Background(), defaultTenant, trackingID); !errors.Is(err, errShipmentNotFound) {
+		t.Errorf("TestStreamOrdersTenant: shipment %s is the default tenant's (%v)", trackingID, err)
+	}
+}
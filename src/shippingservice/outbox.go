@@ -0,0 +1,162 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	outboxBatchSize    = 100
+	outboxPollInterval = time.Second
+)
+
+// outboxRecord is an event waiting to be published, together with the trace
+// context of the request that produced it.
+type outboxRecord struct {
+	Seq     int64
+	Event   shipmentEvent
+	Carrier propagation.MapCarrier
+	Created time.Time
+}
+
+// newOutboxRecord returns the record of ev, carrying the trace context of
+// ctx. The repository that saves it assigns its sequence number.
+func newOutboxRecord(ctx context.Context, ev shipmentEvent) outboxRecord {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return outboxRecord{Event: ev, Carrier: carrier, Created: time.Now()}
+}
+
+// outbox is an ordered log of unpublished events kept in memory. It is not
+// safe for concurrent use; the memory repository guards it with the same lock
+// as the shipments, which plays the part of the database transaction.
+type outbox struct {
+	records []outboxRecord
+	lastSeq int64
+}
+
+func (o *outbox) append(rec outboxRecord) {
+	o.lastSeq++
+	rec.Seq = o.lastSeq
+	o.records = append(o.records, rec)
+}
+
+func (o *outbox) pending(limit int) []outboxRecord {
+	if len(o.records) < limit {
+		limit = len(o.records)
+	}
+	out := make([]outboxRecord, limit)
+	copy(out, o.records)
+	return out
+}
+
+func (o *outbox) ack(seq int64) {
+	i := 0
+	for i < len(o.records) && o.records[i].Seq <= seq {
+		i++
+	}
+	o.records = o.records[i:]
+}
+
+// outboxRelay publishes outbox records in order. Delivery is at least once:
+// a record is only removed after it has been handed to the publisher, and
+// consumers can de-duplicate on the event ID.
+type outboxRelay struct {
+	store     *shipmentStore
+	publisher eventPublisher
+	interval  time.Duration
+}
+
+func newOutboxRelay(store *shipmentStore, publisher eventPublisher) *outboxRelay {
+	return &outboxRelay{store: store, publisher: publisher, interval: outboxPollInterval}
+}
+
+// run relays events until stop is closed, waking up whenever the store
+// records a change and at least once per interval to retry failed publishes.
+// It makes one last attempt when stopped, so that events written by the last
+// calls before a shutdown are not lost with the process; that attempt is
+// abandoned when ctx is done, once the shutdown timeout has passed.
+func (r *outboxRelay) run(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.flush(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			r.flush(ctx)
+			return
+		case <-r.store.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// flush publishes everything currently in the outbox. It stops at the first
+// failure so that events for a shipment are never published out of order.
+func (r *outboxRelay) flush(ctx context.Context) {
+	for {
+		records, err := r.store.pendingEvents(ctx, outboxBatchSize)
+		if err != nil {
+			log.Ctx(ctx).WithError(err).Warn("outbox: failed to read pending events, will retry")
+			return
+		}
+		if len(records) == 0 {
+			return
+		}
+		for _, rec := range records {
+			if err := r.publish(ctx, rec); err != nil {
+				log.Ctx(ctx).WithError(err).Warnf("outbox: failed to publish event %s, will retry", rec.Event.ID)
+				return
+			}
+			if err := r.store.markPublished(ctx, rec.Seq); err != nil {
+				log.Ctx(ctx).WithError(err).Warnf("outbox: failed to mark event %s published, will retry", rec.Event.ID)
+				return
+			}
+		}
+	}
+}
+
+// publish sends one record in a new trace linked to the request that wrote it.
+func (r *outboxRelay) publish(ctx context.Context, rec outboxRecord) error {
+	origin := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), rec.Carrier))
+	ctx, span := tracer.Start(ctx, "outbox.relay",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: origin}),
+		trace.WithAttributes(
+			attribute.Int64("outbox.seq", rec.Seq),
+			attribute.String("event.id", rec.Event.ID),
+			attribute.String("event.type", rec.Event.Type),
+			attribute.Int64("outbox.lag_ms", time.Since(rec.Created).Milliseconds()),
+		),
+	)
+	defer span.End()
+
+	if err := r.publisher.Publish(ctx, rec.Event); err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// recordingPublisher remembers published events and can be told to fail.
+type recordingPublisher struct {
+	events []shipmentEvent
+	err    error
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, ev shipmentEvent) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, ev)
+	return nil
+}
+
+// TestOutboxRelay checks that events are relayed in order and only removed once published.
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+	st := newShipmentStore(newMemoryShipmentRepository())
+	st.create(ctx, defaultTenant, "AB-1", &pb.Address{}, nil, 0)
+	if _, err := st.transition(ctx, defaultTenant, "AB-1", pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := &recordingPublisher{err: errors.New("broker down")}
+	relay := newOutboxRelay(st, pub)
+	relay.flush(ctx)
+	if events, _ := st.pendingEvents(ctx, outboxBatchSize); len(events) != 2 {
+		t.Fatalf("TestOutboxRelay: %d pending events after a failed publish, expected 2", len(events))
+	}
+
+	pub.err = nil
+	relay.flush(ctx)
+	if events, _ := st.pendingEvents(ctx, outboxBatchSize); len(events) != 0 {
+		t.Errorf("TestOutboxRelay: %d pending events after relaying, expected 0", len(events))
+	}
+	if len(pub.events) != 2 || pub.events[0].Type != eventShipmentCreated || pub.events[1].Type != eventShipmentStatusChanged {
+		t.Errorf("TestOutboxRelay: unexpected events %+v", pub.events)
+	}
+}
+
+// blockingPublisher hangs until its context is done, like a broker that
+// stopped answering.
+type blockingPublisher struct{}
+
+func (blockingPublisher) Publish(ctx context.Context, _ shipmentEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestOutboxRelayShutdown checks that the last flush on shutdown is abandoned
+// once the shutdown timeout cancels the context.
+func TestOutboxRelayShutdown(t *testing.T) {
+	st := newShipmentStore(newMemoryShipmentRepository())
+	st.create(context.Background(), defaultTenant, "AB-1", &pb.Address{}, nil, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		newOutboxRelay(st, blockingPublisher{}).run(ctx, stop)
+		close(done)
+	}()
+	close(stop)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("TestOutboxRelayShutdown: the relay kept flushing after its context was cancelled")
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	// dimensionalDivisor converts a volume in cm³ to a dimensional weight in
+	// kg, as carriers do.
+	dimensionalDivisor = 5000
+	// boxFillRatio is how much of a box can be filled, leaving room for
+	// padding and for items that do not stack perfectly.
+	boxFillRatio = 0.8
+	// maxPackedUnits bounds the work of packing one order. Larger orders are
+	// packed by volume alone.
+	maxPackedUnits = 2000
+	// maxDimensionCm is the largest side of an item that is accepted.
+	maxDimensionCm = 500
+)
+
+// nominalItemCm is the assumed size of a product without dimensions.
+var nominalItemCm = [3]float64{20, 15, 10}
+
+// box is a kind of packaging, with its inner size in cm, sides in
+// decreasing order, and the most it can carry.
+type box struct {
+	name     string
+	cm       [3]float64
+	maxGrams int
+}
+
+func (b box) volume() float64 { return b.cm[0] * b.cm[1] * b.cm[2] }
+
+// boxes are the packaging of the warehouse, smallest first.
+var boxes = []box{
+	{name: "small", cm: [3]float64{25, 20, 10}, maxGrams: 2000},
+	{name: "medium", cm: [3]float64{40, 30, 20}, maxGrams: 10000},
+	{name: "large", cm: [3]float64{60, 40, 40}, maxGrams: 20000},
+	{name: "extra-large", cm: [3]float64{100, 60, 60}, maxGrams: 30000},
+}
+
+// packUnit is one unit of a product, sides in decreasing order.
+type packUnit struct {
+	cm    [3]float64
+	grams int
+}
+
+func (u packUnit) volume() float64 { return u.cm[0] * u.cm[1] * u.cm[2] }
+
+// fitsIn reports whether the unit fits in the box in some orientation.
+func (u packUnit) fitsIn(b box) bool {
+	return u.cm[0] <= b.cm[0] && u.cm[1] <= b.cm[1] && u.cm[2] <= b.cm[2]
+}
+
+// bin is a box being filled.
+type bin struct {
+	box    box
+	units  []packUnit
+	volume float64
+	grams  int
+}
+
+// accepts reports whether u can be added to the bin without going over its
+// fill ratio or weight.
+func (b *bin) accepts(u packUnit) bool {
+	return u.fitsIn(b.box) && b.volume+u.volume() <= b.box.volume()*boxFillRatio && b.grams+u.grams <= b.box.maxGrams
+}
+
+// packing is how an order was packed and what it weighs.
+type packing struct {
+	boxes             []string
+	units             int
+	actualGrams       int
+	dimensionalGrams  int
+	fillRatio         float64
+	estimatedByVolume bool
+}
+
+// billableGrams is the weight the order is charged for: its actual weight
+// or, if larger, the dimensional weight of its boxes.
+func (p packing) billableGrams() int {
+	if p.dimensionalGrams > p.actualGrams {
+		return p.dimensionalGrams
+	}
+	return p.actualGrams
+}
+
+func (p packing) toProto() *pb.Packaging {
+	return &pb.Packaging{
+		Boxes:                  p.boxes,
+		ActualWeightGrams:      int32(p.actualGrams),
+		DimensionalWeightGrams: int32(p.dimensionalGrams),
+		BillableWeightGrams:    int32(p.billableGrams()),
+	}
+}
+
+func (p packing) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("packing.units", p.units),
+		attribute.Int("packing.boxes", len(p.boxes)),
+		attribute.Float64("packing.fill_ratio", p.fillRatio),
+		attribute.Bool("packing.estimated", p.estimatedByVolume),
+		attribute.Int("parcel.weight.actual_grams", p.actualGrams),
+		attribute.Int("parcel.weight.dimensional_grams", p.dimensionalGrams),
+		attribute.Int("parcel.weight.billable_grams", p.billableGrams()),
+	}
+}
+
+// validateDimensions lists the dimensions of a request that are invalid.
+// field is their path in the request, such as "dimensions".
+func validateDimensions(dims []*pb.ItemDimensions, field string) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	for i, d := range dims {
+		for _, side := range []float64{d.GetLengthCm(), d.GetWidthCm(), d.GetHeightCm()} {
+			if !(side > 0 && side <= maxDimensionCm) {
+				violations = append(violations, &errdetails.BadRequest_FieldViolation{
+					Field:       fmt.Sprintf("%s[%d]", field, i),
+					Description: fmt.Sprintf("sides must be between 0 and %d cm", maxDimensionCm),
+				})
+				break
+			}
+		}
+		if d.GetWeightGrams() < 0 {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("%s[%d].weight_grams", field, i),
+				Description: "weight must not be negative",
+			})
+		}
+	}
+	return violations
+}
+
+// packOrder packs the items of an order into boxes, given the dimensions of
+// its products. Products without dimensions are taken to be of a nominal
+// size and weight. Units are packed largest first, each into the first box
+// it fits in or else a new one of the smallest kind that holds it, and each
+// box is then swapped for the smallest kind its contents fit in. A unit too
+// big for any box ships on its own. Without dimensions nothing is packed and
+// the order weighs the nominal weight of its items, as before dimensions
+// were accepted.
+func packOrder(items []*pb.CartItem, dims []*pb.ItemDimensions) packing {
+	if len(dims) == 0 {
+		return packing{units: itemCount(items), actualGrams: weightGrams(items)}
+	}
+	sizes := make(map[string]*pb.ItemDimensions, len(dims))
+	for _, d := range dims {
+		sizes[d.GetProductId()] = d
+	}
+	var units []packUnit
+	p := packing{}
+	for _, it := range items {
+		u := packUnit{cm: nominalItemCm, grams: nominalItemWeightGrams}
+		if d, ok := sizes[it.GetProductId()]; ok {
+			u.cm = [3]float64{d.GetLengthCm(), d.GetWidthCm(), d.GetHeightCm()}
+			sort.Sort(sort.Reverse(sort.Float64Slice(u.cm[:])))
+			if d.GetWeightGrams() > 0 {
+				u.grams = int(d.GetWeightGrams())
+			}
+		}
+		n := int(it.GetQuantity())
+		p.units += n
+		p.actualGrams += n * u.grams
+		for i := 0; i < n && len(units) < maxPackedUnits; i++ {
+			units = append(units, u)
+		}
+	}
+	if p.units > maxPackedUnits {
+		return p.estimateByVolume(items, sizes)
+	}
+	sort.SliceStable(units, func(i, j int) bool { return units[i].volume() > units[j].volume() })
+
+	var bins []*bin
+	var volume, capacity float64
+	for _, u := range units {
+		var into *bin
+		for _, b := range bins {
+			if b.accepts(u) {
+				into = b
+				break
+			}
+		}
+		if into == nil {
+			into = &bin{box: oversize(u)}
+			for _, kind := range boxes {
+				if (&bin{box: kind}).accepts(u) {
+					into.box = kind
+					break
+				}
+			}
+			bins = append(bins, into)
+		}
+		into.units = append(into.units, u)
+		into.volume += u.volume()
+		into.grams += u.grams
+	}
+	for _, b := range bins {
+		b.box = smallestBoxFor(b)
+		p.boxes = append(p.boxes, b.box.name)
+		volume += b.volume
+		capacity += b.box.volume()
+	}
+	p.dimensionalGrams = int(math.Ceil(capacity / dimensionalDivisor * 1000))
+	if capacity > 0 {
+		p.fillRatio = volume / capacity
+	}
+	return p
+}
+
+// oversize is a box the size of a unit that fits in none of the boxes, or
+// is too heavy for them, so that it ships as it is.
+func oversize(u packUnit) box {
+	return box{name: "oversize", cm: u.cm, maxGrams: u.grams}
+}
+
+// smallestBoxFor returns the smallest kind of box that holds the contents
+// of b, or its own box if none is smaller.
+func smallestBoxFor(b *bin) box {
+	for _, kind := range boxes {
+		if kind.volume() >= b.box.volume() {
+			break
+		}
+		candidate := &bin{box: kind}
+		fits := true
+		for _, u := range b.units {
+			if !candidate.accepts(u) {
+				fits = false
+				break
+			}
+			candidate.volume += u.volume()
+			candidate.grams += u.grams
+		}
+		if fits {
+			return kind
+		}
+	}
+	return b.box
+}
+
+// estimateByVolume prices an order too large to pack unit by unit as if its
+// volume filled the largest boxes.
+func (p packing) estimateByVolume(items []*pb.CartItem, sizes map[string]*pb.ItemDimensions) packing {
+	var volume float64
+	for _, it := range items {
+		v := nominalItemCm[0] * nominalItemCm[1] * nominalItemCm[2]
+		if d, ok := sizes[it.GetProductId()]; ok {
+			v = d.GetLengthCm() * d.GetWidthCm() * d.GetHeightCm()
+		}
+		volume += float64(it.GetQuantity()) * v
+	}
+	largest := boxes[len(boxes)-1]
+	n := int(math.Ceil(volume / (largest.volume() * boxFillRatio)))
+	for i := 0; i < n; i++ {
+		p.boxes = append(p.boxes, largest.name)
+	}
+	capacity := float64(n) * largest.volume()
+	p.dimensionalGrams = int(math.Ceil(capacity / dimensionalDivisor * 1000))
+	if capacity > 0 {
+		p.fillRatio = volume / capacity
+	}
+	p.estimatedByVolume = true
+	return p
+}
+
+// tracedPackOrder packs an order in a span of its own, since packing is the
+// costliest step of a quote with many items.
+func tracedPackOrder(ctx context.Context, items []*pb.CartItem, dims []*pb.ItemDimensions) packing {
+	_, span := tracer.Start(ctx, "packOrder")
+	defer span.End()
+	p := packOrder(items, dims)
+	span.SetAttributes(p.attributes()...)
+	return p
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// TestPackOrder checks the boxes chosen for orders and that they are
+// charged for the larger of their actual and dimensional weight.
+func TestPackOrder(t *testing.T) {
+	dims := []*pb.ItemDimensions{
+		{ProductId: "mug", LengthCm: 10, WidthCm: 10, HeightCm: 5, WeightGrams: 200},
+		{ProductId: "pillow", LengthCm: 30, WidthCm: 50, HeightCm: 40, WeightGrams: 300},
+		{ProductId: "rod", LengthCm: 150, WidthCm: 10, HeightCm: 10, WeightGrams: 1000},
+		{ProductId: "anvil", LengthCm: 30, WidthCm: 30, HeightCm: 30, WeightGrams: 25000},
+	}
+	for _, tc := range []struct {
+		items    []*pb.CartItem
+		boxes    []string
+		billable int
+	}{
+		{[]*pb.CartItem{{ProductId: "mug", Quantity: 4}}, []string{"small"}, 1000},
+		{[]*pb.CartItem{{ProductId: "pillow", Quantity: 1}}, []string{"large"}, 19200},
+		{[]*pb.CartItem{{ProductId: "pillow", Quantity: 1}, {ProductId: "mug", Quantity: 2}}, []string{"large"}, 19200},
+		{[]*pb.CartItem{{ProductId: "rod", Quantity: 1}}, []string{"oversize"}, 3000},
+		{[]*pb.CartItem{{ProductId: "anvil", Quantity: 2}}, []string{"extra-large", "extra-large"}, 144000},
+		{[]*pb.CartItem{{ProductId: "unknown", Quantity: 2}}, []string{"small", "small"}, 2000},
+	} {
+		p := packOrder(tc.items, dims)
+		if !reflect.DeepEqual(p.boxes, tc.boxes) || p.billableGrams() != tc.billable {
+			t.Errorf("TestPackOrder: %v packed in %v for %d g, want %v for %d g", tc.items, p.boxes, p.billableGrams(), tc.boxes, tc.billable)
+		}
+	}
+	if p := packOrder([]*pb.CartItem{{ProductId: "mug", Quantity: 4}}, dims); p.actualGrams != 800 || p.dimensionalGrams != 1000 {
+		t.Errorf("TestPackOrder: mugs weigh %d g actual and %d g dimensional", p.actualGrams, p.dimensionalGrams)
+	}
+	if p := packOrder([]*pb.CartItem{{ProductId: "mug", Quantity: 5000}}, dims); !p.estimatedByVolume || len(p.boxes) == 0 {
+		t.Errorf("TestPackOrder: large order packed as %+v, want an estimate", p)
+	}
+	if p := packOrder([]*pb.CartItem{{ProductId: "mug", Quantity: 3}}, nil); p.boxes != nil || p.billableGrams() != 3*nominalItemWeightGrams {
+		t.Errorf("TestPackOrder: order without dimensions packed as %+v", p)
+	}
+}
+
+// TestQuoteDimensions checks that a bulky but light order is quoted by its
+// dimensional weight, and that its quote only ships with the same sizes.
+// Standard shipping is not priced by weight, so the order goes express.
+func TestQuoteDimensions(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	express := pb.ShippingMethod_SHIPPING_METHOD_EXPRESS
+	items := []*pb.CartItem{{ProductId: "pillow", Quantity: 1}}
+	dims := []*pb.ItemDimensions{{ProductId: "pillow", LengthCm: 50, WidthCm: 40, HeightCm: 30, WeightGrams: 300}}
+
+	light, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, Method: express})
+	if err != nil {
+		t.Fatalf("TestQuoteDimensions: %v", err)
+	}
+	bulky, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, Method: express, Dimensions: dims})
+	if err != nil {
+		t.Fatalf("TestQuoteDimensions: %v", err)
+	}
+	if light.Packaging != nil {
+		t.Errorf("TestQuoteDimensions: packaging %v without dimensions", light.Packaging)
+	}
+	if p := bulky.Packaging; p.GetBillableWeightGrams() != 19200 || p.GetActualWeightGrams() != 300 || len(p.GetBoxes()) != 1 {
+		t.Errorf("TestQuoteDimensions: packaging %v", p)
+	}
+	if money.Cents(*bulky.CostUsd) <= money.Cents(*light.CostUsd) {
+		t.Errorf("TestQuoteDimensions: bulky order quoted %v, no more than %v", bulky.CostUsd, light.CostUsd)
+	}
+
+	if _, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: benchmarkAddress, Items: items, QuoteId: bulky.QuoteId}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("TestQuoteDimensions: order without dimensions returned %v", err)
+	}
+	if _, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: benchmarkAddress, Items: items, QuoteId: bulky.QuoteId, Dimensions: dims}); err != nil {
+		t.Errorf("TestQuoteDimensions: order with dimensions returned %v", err)
+	}
+
+	bad := []*pb.ItemDimensions{{ProductId: "pillow", LengthCm: 50, WidthCm: 0, HeightCm: 30}}
+	if _, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, Dimensions: bad}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TestQuoteDimensions: zero width returned %v", err)
+	}
+}
+
+func BenchmarkPackOrder(b *testing.B) {
+	dims := []*pb.ItemDimensions{
+		{ProductId: "mug", LengthCm: 10, WidthCm: 10, HeightCm: 5, WeightGrams: 200},
+		{ProductId: "pillow", LengthCm: 50, WidthCm: 40, HeightCm: 30, WeightGrams: 300},
+		{ProductId: "book", LengthCm: 24, WidthCm: 16, HeightCm: 4, WeightGrams: 600},
+	}
+	items := []*pb.CartItem{{ProductId: "mug", Quantity: 40}, {ProductId: "pillow", Quantity: 5}, {ProductId: "book", Quantity: 60}}
+	for i := 0; i < b.N; i++ {
+		packOrder(items, dims)
+	}
+}
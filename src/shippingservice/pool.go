@@ -0,0 +1,121 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/baggage"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FOK Workshop - Worker pools
+//
+// The trace context and baggage of a request live in its context.Context,
+// and a goroutine only has the context it is given. A worker started ahead
+// of time has its own, so work handed to it must carry the context of
+// whoever submitted it, and the worker must start the work's span from
+// that, or the span becomes the root of a trace of its own that nothing
+// points to.
+//
+// taskSpans says how the span of such work relates to the submitter's.
+type taskSpans int
+
+const (
+	// childSpans makes the task's span a child of the submitter's span, for
+	// work the submitter waits for.
+	childSpans taskSpans = iota
+	// linkedSpans starts the task's span in a new trace linked to the
+	// submitter's span, for work that outlives the submitter or comes in
+	// such numbers that it would swamp the submitter's trace.
+	linkedSpans
+)
+
+// workerPool runs tasks on a fixed number of goroutines. Each task runs with
+// the trace context, baggage and cancellation of the context it was
+// submitted with, in a span started as the pool's spans say.
+type workerPool struct {
+	spans taskSpans
+	tasks chan poolTask
+	wg    sync.WaitGroup
+}
+
+type poolTask struct {
+	ctx  context.Context
+	name string
+	run  func(context.Context) error
+	opts []trace.SpanStartOption
+}
+
+// newWorkerPool starts a pool of workers. It must be stopped with wait.
+func newWorkerPool(workers int, spans taskSpans) *workerPool {
+	p := &workerPool{spans: spans, tasks: make(chan poolTask)}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for t := range p.tasks {
+				runTask(t.ctx, p.spans, t.name, t.run, t.opts...)
+			}
+		}()
+	}
+	return p
+}
+
+// submit hands a task to the next free worker. It returns false, and the task
+// is not run, if ctx is done first.
+func (p *workerPool) submit(ctx context.Context, name string, run func(context.Context) error, opts ...trace.SpanStartOption) bool {
+	select {
+	case p.tasks <- poolTask{ctx: ctx, name: name, run: run, opts: opts}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// wait stops the pool taking tasks and waits for the submitted ones to
+// finish.
+func (p *workerPool) wait() {
+	close(p.tasks)
+	p.wg.Wait()
+}
+
+// runTask runs a task in a span named name, started from ctx as spans says,
+// and records the error it returns on the span.
+func runTask(ctx context.Context, spans taskSpans, name string, run func(context.Context) error, opts ...trace.SpanStartOption) error {
+	if spans == linkedSpans {
+		opts = append(opts, trace.WithNewRoot())
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+		}
+	}
+	ctx, span := tracer.Start(ctx, name, opts...)
+	defer span.End()
+	err := run(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	return err
+}
+
+// carryContext returns ctx with the span context and baggage of from, for
+// work submitted from one context and run in another.
+func carryContext(ctx, from context.Context) context.Context {
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(from))
+	return baggage.ContextWithBaggage(ctx, baggage.FromContext(from))
+}
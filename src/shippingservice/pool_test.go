@@ -0,0 +1,93 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestWorkerPool checks that pooled tasks run with the submitter's baggage,
+// in spans that are children of, or linked to, the submitter's span, and that
+// a task failing sets its span's status.
+func TestWorkerPool(t *testing.T) {
+	saved := tracer
+	defer func() { tracer = saved }()
+
+	member, _ := baggage.NewMember("customer.tier", "gold")
+	bag, _ := baggage.New(member)
+	for _, spans := range []taskSpans{childSpans, linkedSpans} {
+		rec := tracetest.NewSpanRecorder()
+		tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+		ctx, parent := tracer.Start(baggage.ContextWithBaggage(context.Background(), bag), "submitter")
+		var tiers atomic.Int32
+		pool := newWorkerPool(2, spans)
+		for i := 0; i < 4; i++ {
+			i := i
+			pool.submit(ctx, "task", func(ctx context.Context) error {
+				if baggage.FromContext(ctx).Member("customer.tier").Value() == "gold" {
+					tiers.Add(1)
+				}
+				if i == 0 {
+					return errors.New("boom")
+				}
+				return nil
+			})
+		}
+		pool.wait()
+		parent.End()
+
+		if n := tiers.Load(); n != 4 {
+			t.Errorf("TestWorkerPool: %d of 4 tasks had the submitter's baggage", n)
+		}
+		failed := 0
+		for _, s := range rec.Ended() {
+			if s.Name() != "task" {
+				continue
+			}
+			if s.Status().Code == otelcodes.Error {
+				failed++
+			}
+			switch spans {
+			case childSpans:
+				if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+					t.Errorf("TestWorkerPool: child task has parent %v, want the submitter", s.Parent())
+				}
+			case linkedSpans:
+				if s.Parent().IsValid() || len(s.Links()) != 1 || s.Links()[0].SpanContext.SpanID() != parent.SpanContext().SpanID() {
+					t.Errorf("TestWorkerPool: linked task has parent %v and links %v, want a root linked to the submitter", s.Parent(), s.Links())
+				}
+			}
+		}
+		if failed != 1 {
+			t.Errorf("TestWorkerPool: %d task spans failed, want 1", failed)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool := newWorkerPool(0, childSpans)
+	if pool.submit(ctx, "task", func(context.Context) error { return nil }) {
+		t.Error("TestWorkerPool: a task was taken after the submitter's context was done")
+	}
+	pool.wait()
+}
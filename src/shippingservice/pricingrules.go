@@ -0,0 +1,168 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// ruleKinds are the kinds of pricing rule, by the line of the quote they are
+// shown as.
+var ruleKinds = map[string]pb.QuoteLineItemType{
+	"fuel":        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_FUEL_SURCHARGE,
+	"peak":        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_PEAK_SURCHARGE,
+	"remote_area": pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_REMOTE_AREA,
+}
+
+// pricingRule is a surcharge of the rate table. The rules a quote matches
+// are applied after its options, in the order of the table, and each adds a
+// percentage of the quote so far plus a flat amount. A rule without
+// conditions matches every quote.
+type pricingRule struct {
+	Name    string  `yaml:"name"`
+	Kind    string  `yaml:"kind"`
+	Percent float64 `yaml:"percent"`
+	Amount  float64 `yaml:"amount"`
+	// From and To, as MM-DD, limit the rule to part of the year, in UTC. A
+	// range such as 12-15 to 01-05 wraps around the new year.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Zones and Methods limit the rule to parcels to those zones or
+	// shipped by those methods.
+	Zones   []string `yaml:"zones"`
+	Methods []string `yaml:"methods"`
+
+	kind     pb.QuoteLineItemType
+	from, to int // month*100 + day
+	zones    map[zone]bool
+	methods  map[pb.ShippingMethod]bool
+}
+
+// parseMonthDay parses an MM-DD date as month*100 + day.
+func parseMonthDay(s string) (int, error) {
+	t, err := time.Parse("01-02", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q, want MM-DD", s)
+	}
+	return int(t.Month())*100 + t.Day(), nil
+}
+
+// compile validates the rule and prepares it for matching.
+func (r *pricingRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("pricing rule without a name")
+	}
+	kind, ok := ruleKinds[r.Kind]
+	if !ok {
+		return fmt.Errorf("pricing rule %q has unknown kind %q", r.Name, r.Kind)
+	}
+	r.kind = kind
+	if r.Percent < 0 || r.Amount < 0 || r.Percent == 0 && r.Amount == 0 {
+		return fmt.Errorf("pricing rule %q must have a positive percent or amount", r.Name)
+	}
+	if (r.From == "") != (r.To == "") {
+		return fmt.Errorf("pricing rule %q needs both from and to", r.Name)
+	}
+	if r.From != "" {
+		var err error
+		if r.from, err = parseMonthDay(r.From); err != nil {
+			return fmt.Errorf("pricing rule %q: %v", r.Name, err)
+		}
+		if r.to, err = parseMonthDay(r.To); err != nil {
+			return fmt.Errorf("pricing rule %q: %v", r.Name, err)
+		}
+	}
+	if len(r.Zones) > 0 {
+		r.zones = make(map[zone]bool, len(r.Zones))
+		for _, name := range r.Zones {
+			z, ok := zonesByName[name]
+			if !ok {
+				return fmt.Errorf("pricing rule %q has unknown zone %q", r.Name, name)
+			}
+			r.zones[z] = true
+		}
+	}
+	if len(r.Methods) > 0 {
+		r.methods = make(map[pb.ShippingMethod]bool, len(r.Methods))
+		for _, name := range r.Methods {
+			m, ok := pb.ShippingMethod_value["SHIPPING_METHOD_"+strings.ToUpper(name)]
+			if !ok || m == int32(pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED) {
+				return fmt.Errorf("pricing rule %q has unknown shipping method %q", r.Name, name)
+			}
+			r.methods[pb.ShippingMethod(m)] = true
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a parcel matching key that is
+// quoted at now.
+func (r *pricingRule) matches(key quoteCacheKey, now time.Time) bool {
+	if r.zones != nil && !r.zones[key.zone] {
+		return false
+	}
+	if r.methods != nil && !r.methods[key.method] {
+		return false
+	}
+	if r.from != 0 {
+		now = now.UTC()
+		day := int(now.Month())*100 + now.Day()
+		if r.from <= r.to {
+			return r.from <= day && day <= r.to
+		}
+		return day >= r.from || day <= r.to
+	}
+	return true
+}
+
+// description is the text of the rule's line on a quote.
+func (r *pricingRule) description() string {
+	if r.Percent > 0 {
+		return fmt.Sprintf("%s (%g%%)", r.Name, r.Percent)
+	}
+	return r.Name
+}
+
+// applyRules adds a line for each rule that matches the parcel, in order,
+// and records each one applied as a pricing.rule event on the current span,
+// so that the trace explains the price.
+func (rt *rateTable) applyRules(ctx context.Context, lines quoteBreakdown, key quoteCacheKey, now time.Time) quoteBreakdown {
+	span := trace.SpanFromContext(ctx)
+	for i := range rt.Rules {
+		r := &rt.Rules[i]
+		if !r.matches(key, now) {
+			continue
+		}
+		subtotal := lines.cents()
+		cents := roundCents(float64(subtotal)*r.Percent/100 + r.Amount*100)
+		lines = append(lines, quoteLine{kind: r.kind, description: r.description(), cents: cents})
+		span.AddEvent("pricing.rule", trace.WithAttributes(
+			attribute.String("pricing.rule.name", r.Name),
+			attribute.String("pricing.rule.kind", r.Kind),
+			attribute.Int("pricing.rule.index", i),
+			attribute.Float64("pricing.subtotal_usd", float64(subtotal)/100),
+			attribute.Float64("pricing.amount_usd", float64(cents)/100),
+		))
+	}
+	return lines
+}
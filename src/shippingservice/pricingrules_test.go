@@ -0,0 +1,98 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestPricingRules checks that the rules a parcel matches are applied in
+// order, each on the quote so far, and recorded as span events.
+func TestPricingRules(t *testing.T) {
+	rt, err := parseRateTable([]byte(`
+currency: USD
+methods:
+  standard: {base: 10}
+rules:
+  - {name: Fuel, kind: fuel, percent: 10}
+  - {name: Holidays, kind: peak, amount: 1, from: "12-15", to: "01-05"}
+  - {name: Remote, kind: remote_area, percent: 50, zones: [zone-8], methods: [standard]}
+`))
+	if err != nil {
+		t.Fatalf("TestPricingRules: %v", err)
+	}
+	rec := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("test").Start(context.Background(), "GetQuote")
+	remote := quoteCacheKey{zone: zoneFarthest, method: pb.ShippingMethod_SHIPPING_METHOD_STANDARD}
+	newYear := time.Date(2026, time.January, 2, 12, 0, 0, 0, time.UTC)
+	lines := rt.breakdown(ctx, Quote{Dollars: 10}, remote, shippingOptions{}, newYear)
+	span.End()
+
+	want := []struct {
+		kind  pb.QuoteLineItemType
+		cents int64
+	}{
+		{pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_BASE_RATE, 1000},
+		{pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_FUEL_SURCHARGE, 100},
+		{pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_PEAK_SURCHARGE, 100},
+		{pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_REMOTE_AREA, 600},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("TestPricingRules: got lines %+v", lines)
+	}
+	for i, w := range want {
+		if lines[i].kind != w.kind || lines[i].cents != w.cents {
+			t.Errorf("TestPricingRules: line %d is %v of %d cents, want %v of %d", i, lines[i].kind, lines[i].cents, w.kind, w.cents)
+		}
+	}
+	if got := lines.total(); got != (Quote{Dollars: 18}) {
+		t.Errorf("TestPricingRules: total is %v, want $18.00", got)
+	}
+	events := rec.Ended()[0].Events()
+	if len(events) != 3 {
+		t.Fatalf("TestPricingRules: %d events, want one for each of the 3 rules", len(events))
+	}
+	attrs := attribute.NewSet(events[2].Attributes...)
+	if v, _ := attrs.Value("pricing.rule.name"); events[2].Name != "pricing.rule" || v.AsString() != "Remote" {
+		t.Errorf("TestPricingRules: last event is %s %v", events[2].Name, events[2].Attributes)
+	}
+
+	summer := time.Date(2026, time.July, 1, 12, 0, 0, 0, time.UTC)
+	express := quoteCacheKey{zone: zoneFarthest, method: pb.ShippingMethod_SHIPPING_METHOD_EXPRESS}
+	if lines := rt.breakdown(context.Background(), Quote{Dollars: 10}, express, shippingOptions{}, summer); len(lines) != 2 {
+		t.Errorf("TestPricingRules: express parcel in summer has lines %+v, want the base rate and fuel", lines)
+	}
+
+	for _, rule := range []string{
+		"{name: A, kind: tip, amount: 1}",
+		"{kind: fuel, amount: 1}",
+		"{name: A, kind: fuel}",
+		"{name: A, kind: peak, amount: 1, from: 12-01}",
+		"{name: A, kind: peak, amount: 1, from: 12-01, to: 13-01}",
+		"{name: A, kind: remote_area, amount: 1, zones: [moon]}",
+	} {
+		if _, err := parseRateTable([]byte("currency: USD\nmethods: {standard: {base: 1}}\nrules: [" + rule + "]")); err == nil {
+			t.Errorf("TestPricingRules: rule %s was accepted", rule)
+		}
+	}
+}
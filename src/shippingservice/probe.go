@@ -0,0 +1,70 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// probeCommand checks the health of a running server and exits 0 if it is
+// SERVING and 1 otherwise, for container health checks and Kubernetes exec
+// probes without grpc_health_probe:
+//
+//	shippingservice probe [-addr localhost:50051] [-service ""] [-timeout 1s]
+func probeCommand(args []string, out io.Writer) int {
+	port := defaultPort
+	if v := os.Getenv("PORT"); v != "" {
+		port = v
+	}
+	fs := flag.NewFlagSet("probe", flag.ContinueOnError)
+	fs.SetOutput(out)
+	addr := fs.String("addr", "localhost:"+port, "address of the server")
+	service := fs.String("service", "", `service to check: "" for the whole service, or "shippingservice.<dependency>"`)
+	timeout := fs.Duration("timeout", time.Second, "timeout of the check")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(*addr) > 0 && (*addr)[0] == ':' {
+		*addr = "localhost" + *addr // the grpc_health_probe form, "-addr=:50051"
+	}
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Fprintf(out, "failed to create client: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: *service}, grpc.WaitForReady(true))
+	if err != nil {
+		fmt.Fprintf(out, "health check failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "status: %s\n", res.GetStatus())
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return 1
+	}
+	return 0
+}
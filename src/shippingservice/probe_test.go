@@ -0,0 +1,60 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestProbeCommand checks the exit codes of the probe for a serving server,
+// a failing critical dependency and no server.
+func TestProbeCommand(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer()
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, s)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+
+	var out bytes.Buffer
+	if code := probeCommand([]string{"-addr=:" + port}, &out); code != 0 {
+		t.Errorf("TestProbeCommand: serving server exited with %d: %s", code, &out)
+	}
+
+	s.health.register("redis", true, func(context.Context) error { return errors.New("connection refused") })
+	s.health.run(context.Background())
+	out.Reset()
+	if code := probeCommand([]string{"-addr=:" + port}, &out); code != 1 || !bytes.Contains(out.Bytes(), []byte("NOT_SERVING")) {
+		t.Errorf("TestProbeCommand: failing server exited with %d: %s", code, &out)
+	}
+
+	srv.Stop()
+	start := time.Now()
+	if code := probeCommand([]string{"-addr=:" + port, "-timeout=100ms"}, &out); code != 1 || time.Since(start) > time.Second {
+		t.Errorf("TestProbeCommand: stopped server exited with %d after %s", code, time.Since(start))
+	}
+}
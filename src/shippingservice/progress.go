@@ -0,0 +1,150 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	defaultInTransitAfter = time.Minute
+	defaultDeliveredAfter = 5 * time.Minute
+)
+
+// nextStatus is the state the progression worker moves a shipment to from
+// each state.
+var nextStatus = map[pb.ShipmentStatus]pb.ShipmentStatus{
+	pb.ShipmentStatus_SHIPMENT_STATUS_CREATED:    pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT,
+	pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT: pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED,
+}
+
+// statusProgression plays the carrier: it moves shipments from CREATED to
+// IN_TRANSIT and on to DELIVERED once they have been in a state long
+// enough. Each move is a trace of its own, linked to the ShipOrder call that
+// created the shipment, and its event goes out through the outbox like any
+// other.
+type statusProgression struct {
+	store    *shipmentStore
+	interval time.Duration
+	after    map[pb.ShipmentStatus]time.Duration
+	now      func() time.Time
+}
+
+func newStatusProgression(store *shipmentStore, interval, inTransitAfter, deliveredAfter time.Duration) *statusProgression {
+	return &statusProgression{
+		store:    store,
+		interval: interval,
+		after: map[pb.ShipmentStatus]time.Duration{
+			pb.ShipmentStatus_SHIPMENT_STATUS_CREATED:    inTransitAfter,
+			pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT: deliveredAfter,
+		},
+		now: time.Now,
+	}
+}
+
+// statusProgressionFromEnv returns the worker if SHIPMENT_PROGRESS_INTERVAL
+// is set, moving shipments on after SHIPMENT_IN_TRANSIT_AFTER and
+// SHIPMENT_DELIVERED_AFTER, or nil.
+func statusProgressionFromEnv(store *shipmentStore) *statusProgression {
+	interval := envDuration("SHIPMENT_PROGRESS_INTERVAL", 0)
+	if interval <= 0 {
+		return nil
+	}
+	p := newStatusProgression(store, interval,
+		envDuration("SHIPMENT_IN_TRANSIT_AFTER", defaultInTransitAfter),
+		envDuration("SHIPMENT_DELIVERED_AFTER", defaultDeliveredAfter))
+	log.Infof("advancing shipments every %v: in transit after %v, delivered after %v", interval,
+		p.after[pb.ShipmentStatus_SHIPMENT_STATUS_CREATED], p.after[pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT])
+	return p
+}
+
+// run advances shipments every interval until ctx is done. A nil worker
+// returns at once.
+func (p *statusProgression) run(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.advanceDue(ctx)
+		}
+	}
+}
+
+// advanceDue moves on every shipment that is due, and returns how many moved.
+func (p *statusProgression) advanceDue(ctx context.Context) int {
+	due, err := p.store.due(ctx, p.now(), p.after)
+	if err != nil {
+		log.Ctx(ctx).WithError(err).Warn("failed to find shipments due to move on")
+		return 0
+	}
+	n := 0
+	for _, sh := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		if p.advance(ctx, sh) {
+			n++
+		}
+	}
+	return n
+}
+
+// advance moves one shipment to its next state in a new trace linked to its
+// ShipOrder call. The shipment may have been cancelled since it was found
+// due, which is not an error.
+func (p *statusProgression) advance(ctx context.Context, sh shipment) bool {
+	to := nextStatus[sh.Status]
+	var opts []trace.SpanStartOption
+	if sh.Origin.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sh.Origin}))
+	}
+	opts = append(opts, trace.WithNewRoot(), trace.WithAttributes(
+		attribute.String("tenant.id", sh.Tenant),
+		attribute.String("shipment.tracking_id", sh.TrackingID),
+		attribute.String("shipment.status.from", sh.Status.String()),
+		attribute.String("shipment.status.to", to.String()),
+		attribute.Int64("shipment.status.age_ms", p.now().Sub(sh.UpdatedAt).Milliseconds()),
+	))
+	ctx, span := tracer.Start(ctx, "shipment.advance", opts...)
+	defer span.End()
+
+	_, err := p.store.transition(ctx, sh.Tenant, sh.TrackingID, to)
+	switch {
+	case errors.Is(err, errInvalidTransition), errors.Is(err, errShipmentNotFound):
+		span.AddEvent("shipment.skipped", trace.WithAttributes(attribute.String("reason", err.Error())))
+		return false
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		log.Ctx(ctx).WithError(err).Warnf("failed to advance shipment %s", sh.TrackingID)
+		return false
+	}
+	log.Ctx(ctx).Debugf("shipment %s is now %s", sh.TrackingID, to)
+	return true
+}
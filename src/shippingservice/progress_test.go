@@ -0,0 +1,108 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestStatusProgression checks that shipments move through their lifecycle
+// once due, in traces linked to ShipOrder whose events go to the outbox.
+func TestStatusProgression(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+	savedProp := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(savedProp)
+
+	st := newShipmentStore(newMemoryShipmentRepository())
+	ctx, shipOrder := tracer.Start(context.Background(), "ShipOrder")
+	st.create(ctx, defaultTenant, "AB-1", &pb.Address{}, nil, 0)
+	st.create(ctx, defaultTenant, "AB-2", &pb.Address{}, nil, 0)
+	shipOrder.End()
+	if _, err := st.transition(context.Background(), defaultTenant, "AB-2", pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED); err != nil {
+		t.Fatal(err)
+	}
+	st.markPublished(ctx, 3)
+
+	p := newStatusProgression(st, time.Second, time.Minute, 5*time.Minute)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	bg := context.Background()
+	if n := p.advanceDue(bg); n != 0 {
+		t.Errorf("TestStatusProgression: advanced %d shipments before they were due, want 0", n)
+	}
+	now = now.Add(time.Minute)
+	if n := p.advanceDue(bg); n != 1 {
+		t.Errorf("TestStatusProgression: advanced %d shipments after a minute, want 1", n)
+	}
+	if sh, _ := st.get(ctx, defaultTenant, "AB-1"); sh.Status != pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT {
+		t.Errorf("TestStatusProgression: shipment is %s after a minute, want IN_TRANSIT", sh.Status)
+	}
+	now = now.Add(5 * time.Minute)
+	p.advanceDue(bg)
+	if sh, _ := st.get(ctx, defaultTenant, "AB-1"); sh.Status != pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED {
+		t.Errorf("TestStatusProgression: shipment is %s after six minutes, want DELIVERED", sh.Status)
+	}
+	if sh, _ := st.get(ctx, defaultTenant, "AB-2"); sh.Status != pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED {
+		t.Errorf("TestStatusProgression: cancelled shipment is %s, want CANCELLED", sh.Status)
+	}
+
+	var advances []sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.Name() == "shipment.advance" {
+			advances = append(advances, s)
+		}
+	}
+	if len(advances) != 2 {
+		t.Fatalf("TestStatusProgression: got %d shipment.advance spans, want 2", len(advances))
+	}
+	events, _ := st.pendingEvents(bg, outboxBatchSize)
+	if len(events) != 2 {
+		t.Fatalf("TestStatusProgression: got %d outbox events, want 2", len(events))
+	}
+	for i, s := range advances {
+		if s.Parent().IsValid() {
+			t.Errorf("TestStatusProgression: shipment.advance %d has a parent, want a root span", i)
+		}
+		if len(s.Links()) != 1 || s.Links()[0].SpanContext.SpanID() != shipOrder.SpanContext().SpanID() {
+			t.Errorf("TestStatusProgression: shipment.advance %d links %v, want the ShipOrder span", i, s.Links())
+		}
+		carried := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(bg, events[i].Carrier))
+		if events[i].Event.Type != eventShipmentStatusChanged || carried.SpanID() != s.SpanContext().SpanID() {
+			t.Errorf("TestStatusProgression: outbox event %d is %s from span %s, want %s from shipment.advance", i, events[i].Event.Type, carried.SpanID(), eventShipmentStatusChanged)
+		}
+	}
+
+	// A shipment cancelled after it was found due is skipped.
+	st.create(bg, defaultTenant, "AB-3", &pb.Address{}, nil, 0)
+	stale, _ := st.get(ctx, defaultTenant, "AB-3")
+	st.transition(bg, defaultTenant, "AB-3", pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED)
+	if p.advance(bg, stale) {
+		t.Error("TestStatusProgression: advanced a cancelled shipment")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// promotion is a discount of the rate table. The first promotion in the
+// table that a quote qualifies for is applied, after the pricing rules, as
+// a negative line of the quote.
+type promotion struct {
+	ID string `yaml:"id"`
+	// FreeShippingOver makes the quote free for orders worth at least that
+	// much, in USD.
+	FreeShippingOver float64 `yaml:"free_shipping_over"`
+	// PercentOff takes a percentage off the quote.
+	PercentOff float64 `yaml:"percent_off"`
+	// Tier limits the promotion to customers of that tier, as sent in the
+	// customer.tier baggage member.
+	Tier string `yaml:"tier"`
+	// Methods limits the promotion to parcels shipped by those methods.
+	Methods []string `yaml:"methods"`
+
+	methods map[pb.ShippingMethod]bool
+}
+
+// compile validates the promotion and prepares it for matching.
+func (p *promotion) compile() error {
+	if p.ID == "" {
+		return fmt.Errorf("promotion without an id")
+	}
+	if (p.FreeShippingOver > 0) == (p.PercentOff > 0) || p.FreeShippingOver < 0 || p.PercentOff < 0 {
+		return fmt.Errorf("promotion %q must have either free_shipping_over or percent_off", p.ID)
+	}
+	if p.PercentOff > 100 {
+		return fmt.Errorf("promotion %q takes more than 100%% off", p.ID)
+	}
+	if len(p.Methods) > 0 {
+		p.methods = make(map[pb.ShippingMethod]bool, len(p.Methods))
+		for _, name := range p.Methods {
+			m, ok := pb.ShippingMethod_value["SHIPPING_METHOD_"+strings.ToUpper(name)]
+			if !ok || m == int32(pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED) {
+				return fmt.Errorf("promotion %q has unknown shipping method %q", p.ID, name)
+			}
+			p.methods[pb.ShippingMethod(m)] = true
+		}
+	}
+	return nil
+}
+
+// qualifies reports whether an order of a parcel matching key, worth
+// valueCents, from a customer of tier, gets the promotion.
+func (p *promotion) qualifies(key quoteCacheKey, valueCents int64, tier string) bool {
+	if p.methods != nil && !p.methods[key.method] {
+		return false
+	}
+	if p.Tier != "" && p.Tier != tier {
+		return false
+	}
+	return p.FreeShippingOver == 0 || float64(valueCents) >= p.FreeShippingOver*100
+}
+
+// description is the text of the promotion's line on a quote.
+func (p *promotion) description() string {
+	if p.FreeShippingOver > 0 {
+		return fmt.Sprintf("Free shipping over $%.2f (%s)", p.FreeShippingOver, p.ID)
+	}
+	return fmt.Sprintf("%g%% off (%s)", p.PercentOff, p.ID)
+}
+
+// applyPromotion applies the first promotion an order worth valueCents
+// qualifies for, taking the customer tier from the baggage of ctx. It
+// returns the lines with the discount and the ID of the promotion, which is
+// also set on the current span as promotion.id.
+func (rt *rateTable) applyPromotion(ctx context.Context, lines quoteBreakdown, key quoteCacheKey, valueCents int64) (quoteBreakdown, string) {
+	subtotal := lines.cents()
+	if subtotal <= 0 {
+		return lines, ""
+	}
+	tier := baggage.FromContext(ctx).Member(customerTierBaggageKey).Value()
+	for i := range rt.Promotions {
+		p := &rt.Promotions[i]
+		if !p.qualifies(key, valueCents, tier) {
+			continue
+		}
+		off := subtotal
+		if p.PercentOff > 0 {
+			off = int64(math.Round(float64(subtotal) * p.PercentOff / 100))
+		}
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("promotion.id", p.ID),
+			attribute.Float64("promotion.discount_usd", float64(off)/100),
+		)
+		return append(lines, quoteLine{kind: pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_DISCOUNT, description: p.description(), cents: -off}), p.ID
+	}
+	return lines, ""
+}
+
+// orderValue validates the value of an order and returns it in cents; an
+// order without one is worth 0. field is the path of the value in the
+// request.
+func orderValue(v *pb.Money, field string) (int64, []*errdetails.BadRequest_FieldViolation) {
+	if v == nil {
+		return 0, nil
+	}
+	if v.GetCurrencyCode() != "USD" || !money.IsValid(*v) || money.IsNegative(*v) {
+		return 0, []*errdetails.BadRequest_FieldViolation{{Field: field, Description: "order value must be a valid, positive amount in USD"}}
+	}
+	return money.Cents(*v), nil
+}
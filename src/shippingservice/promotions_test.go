@@ -0,0 +1,83 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// TestPromotions checks that the first promotion an order qualifies for is
+// applied and named in the response, with the built-in promotions.
+func TestPromotions(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}
+	express := pb.ShippingMethod_SHIPPING_METHOD_EXPRESS
+	quote := func(ctx context.Context, method pb.ShippingMethod, cents int64) (*pb.GetQuoteResponse, error) {
+		value := money.FromCents("USD", cents)
+		return s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, Method: method, OrderValue: &value})
+	}
+
+	free, err := quote(ctx, pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED, 5000)
+	if err != nil {
+		t.Fatalf("TestPromotions: %v", err)
+	}
+	last := free.LineItems[len(free.LineItems)-1]
+	if free.PromotionId != "FREESHIP50" || !money.IsZero(*free.CostUsd) || last.Type != pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_DISCOUNT {
+		t.Errorf("TestPromotions: $50 order got %s for %v, last line %v", free.PromotionId, free.CostUsd, last)
+	}
+	if q, _ := quote(ctx, pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED, 4999); q.PromotionId != "" || money.IsZero(*q.CostUsd) {
+		t.Errorf("TestPromotions: $49.99 order got %q for %v", q.PromotionId, q.CostUsd)
+	}
+
+	full, _ := quote(ctx, express, 5000)
+	if full.PromotionId != "" {
+		t.Errorf("TestPromotions: express order got %q, want no promotion", full.PromotionId)
+	}
+	member, _ := baggage.NewMember(customerTierBaggageKey, "gold")
+	bag, _ := baggage.New(member)
+	gold, err := quote(baggage.ContextWithBaggage(ctx, bag), express, 5000)
+	if err != nil {
+		t.Fatalf("TestPromotions: %v", err)
+	}
+	want := money.Cents(*full.CostUsd) - (money.Cents(*full.CostUsd)+5)/10
+	if gold.PromotionId != "GOLD10" || money.Cents(*gold.CostUsd) != want {
+		t.Errorf("TestPromotions: gold customer got %q for %v, want GOLD10 for %d cents", gold.PromotionId, gold.CostUsd, want)
+	}
+
+	euros := money.FromCents("EUR", 5000)
+	if _, err := s.GetQuote(ctx, &pb.GetQuoteRequest{Address: benchmarkAddress, Items: items, OrderValue: &euros}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TestPromotions: order value in EUR returned %v", err)
+	}
+	for _, promotions := range []string{
+		"[{id: A}]",
+		"[{id: A, free_shipping_over: 10, percent_off: 5}]",
+		"[{id: A, percent_off: 150}]",
+		"[{percent_off: 5}]",
+		"[{id: A, percent_off: 5}, {id: A, percent_off: 10}]",
+	} {
+		if _, err := parseRateTable([]byte("currency: USD\nmethods: {standard: {base: 1}}\npromotions: " + promotions)); err == nil {
+			t.Errorf("TestPromotions: promotions %s were accepted", promotions)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// workshopTraceHeader carries the trace context in workshopPropagator's
+// format.
+const workshopTraceHeader = "x-workshop-trace"
+
+// FOK Workshop - Propagation
+//
+// workshopPropagator is a deliberately simple TextMapPropagator, to show
+// what the W3C TraceContext propagator does under the hood. It writes the
+// current span context as one header,
+//
+//	x-workshop-trace: 4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1
+//
+// holding the trace ID, the ID of the span making the call, which becomes
+// the parent of the callee's span, and whether the trace is sampled.
+//
+// A propagator only moves span contexts in and out of carriers: gRPC
+// metadata, HTTP headers or message headers. The instrumentation calls
+// Inject with the context of its client span before sending, and Extract on
+// the receiving side before starting its server span, whose parent is then
+// the remote span context found in the carrier.
+type workshopPropagator struct{}
+
+var _ propagation.TextMapPropagator = workshopPropagator{}
+
+// Inject writes the span context of ctx, if it has one, to the carrier.
+func (workshopPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	carrier.Set(workshopTraceHeader, sc.TraceID().String()+"-"+sc.SpanID().String()+"-"+sampled)
+}
+
+// Extract returns ctx with the remote span context read from the carrier. A
+// missing or malformed header leaves ctx as it is: a bad header must never
+// fail the call it came with.
+func (workshopPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	parts := strings.Split(carrier.Get(workshopTraceHeader), "-")
+	if len(parts) != 3 {
+		return ctx
+	}
+	traceID, err := trace.TraceIDFromHex(parts[0])
+	if err != nil {
+		return ctx
+	}
+	spanID, err := trace.SpanIDFromHex(parts[1])
+	if err != nil {
+		return ctx
+	}
+	var flags trace.TraceFlags
+	switch parts[2] {
+	case "1":
+		flags = trace.FlagsSampled
+	case "0":
+	default:
+		return ctx
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: flags, Remote: true})
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields returns the header the propagator uses, so that carriers which need
+// to know them in advance, such as some message brokers, can copy it.
+func (workshopPropagator) Fields() []string {
+	return []string{workshopTraceHeader}
+}
+
+// newPropagator returns the propagator of the service: W3C trace context
+// with its tracestate entry, W3C baggage and, if WORKSHOP_PROPAGATOR is
+// true, the workshop header. The workshop propagator comes first, so that
+// when a caller sends both formats Extract keeps the W3C trace context.
+func newPropagator() propagation.TextMapPropagator {
+	var ps []propagation.TextMapPropagator
+	if envBool("WORKSHOP_PROPAGATOR", true) {
+		ps = append(ps, workshopPropagator{})
+	}
+	ps = append(ps, tracestatePropagatorFromEnv(propagation.TraceContext{}), propagation.Baggage{})
+	return propagation.NewCompositeTextMapPropagator(ps...)
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestWorkshopPropagator checks that a span context survives a round trip
+// through the x-workshop-trace header, and that bad headers are ignored.
+func TestWorkshopPropagator(t *testing.T) {
+	p := workshopPropagator{}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa},
+		TraceFlags: trace.FlagsSampled,
+	})
+	carrier := propagation.MapCarrier{}
+	p.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	want := "4bf92f35000000000000000000000000-00f067aa00000000-1"
+	if got := carrier.Get(workshopTraceHeader); got != want {
+		t.Errorf("TestWorkshopPropagator: injected %q, want %q", got, want)
+	}
+	got := trace.SpanContextFromContext(p.Extract(context.Background(), carrier))
+	if !got.Equal(sc.WithRemote(true)) {
+		t.Errorf("TestWorkshopPropagator: extracted %+v, want %+v", got, sc)
+	}
+
+	for _, bad := range []string{
+		"",
+		"4bf92f35000000000000000000000000-00f067aa00000000",
+		"4bf92f35000000000000000000000000-00f067aa00000000-yes",
+		"00000000000000000000000000000000-00f067aa00000000-1",
+		"4bf92f35-00f067aa00000000-1",
+	} {
+		ctx := p.Extract(context.Background(), propagation.MapCarrier{workshopTraceHeader: bad})
+		if trace.SpanContextFromContext(ctx).IsValid() {
+			t.Errorf("TestWorkshopPropagator: %q was extracted", bad)
+		}
+	}
+}
+
+// TestWorkshopPropagatorAlongsideW3C checks that a server which only reads the
+// workshop header joins the caller's trace, that W3C wins when the two
+// formats disagree, and that WORKSHOP_PROPAGATOR=false drops the header.
+func TestWorkshopPropagatorAlongsideW3C(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server only understands the workshop header.
+	srv := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler(
+		otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(workshopPropagator{}))))
+	healthpb.RegisterHealthServer(srv, newServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithTracerProvider(tp), otelgrpc.WithPropagators(newPropagator()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "caller")
+	if _, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+	srv.GracefulStop()
+
+	var server sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.SpanKind() == trace.SpanKindServer {
+			server = s
+		}
+	}
+	if server == nil || server.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("TestWorkshopPropagatorAlongsideW3C: the server did not join the caller's trace")
+	}
+
+	w3c := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled})
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), w3c), carrier)
+	carrier.Set(workshopTraceHeader, "22222222222222222222222222222222-2222222222222222-1")
+	if got := trace.SpanContextFromContext(newPropagator().Extract(context.Background(), carrier)); got.TraceID() != w3c.TraceID() {
+		t.Errorf("TestWorkshopPropagatorAlongsideW3C: extracted trace %s, want the W3C one", got.TraceID())
+	}
+
+	t.Setenv("WORKSHOP_PROPAGATOR", "false")
+	carrier = propagation.MapCarrier{}
+	newPropagator().Inject(trace.ContextWithSpanContext(context.Background(), w3c), carrier)
+	if carrier.Get(workshopTraceHeader) != "" || carrier.Get("traceparent") == "" {
+		t.Errorf("TestWorkshopPropagatorAlongsideW3C: injected %v with WORKSHOP_PROPAGATOR=false", carrier)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	pubsubQueueSize = 256
+	pubsubTimeout   = 10 * time.Second
+)
+
+// pubsubPublisher publishes shipment events to a Google Cloud Pub/Sub topic
+// with the Pub/Sub client library, which finds Application Default
+// Credentials and batches the messages. Attributes play the part of message
+// headers, so the trace context goes there. As with Kafka, Publish does not
+// wait for the message to be sent, and failures are logged.
+type pubsubPublisher struct {
+	topic   *pubsub.Topic
+	encoder eventEncoder
+}
+
+// pubsubPublisherFromEnv publishes to PUBSUB_TOPIC, either a full
+// projects/<project>/topics/<topic> name or a topic of GOOGLE_CLOUD_PROJECT
+// or of the project of the credentials. With PUBSUB_EMULATOR_HOST set the
+// client library talks to the emulator without credentials.
+func pubsubPublisherFromEnv() *pubsubPublisher {
+	name := os.Getenv("PUBSUB_TOPIC")
+	if name == "" {
+		log.Fatal("EVENT_BUS=pubsub requires PUBSUB_TOPIC to be set")
+	}
+	project, id := os.Getenv("GOOGLE_CLOUD_PROJECT"), name
+	if rest, ok := strings.CutPrefix(name, "projects/"); ok {
+		if project, id, ok = strings.Cut(rest, "/topics/"); !ok {
+			log.Fatalf("PUBSUB_TOPIC %q is not a projects/<project>/topics/<topic> name", name)
+		}
+	}
+	if project == "" {
+		project = pubsub.DetectProjectID
+	}
+	client, err := pubsub.NewClient(context.Background(), project)
+	if err != nil {
+		log.Fatalf("failed to create a Pub/Sub client for PUBSUB_TOPIC %q: %v", name, err)
+	}
+	topic := client.Topic(id)
+	topic.PublishSettings.Timeout = pubsubTimeout
+	topic.PublishSettings.FlowControlSettings = pubsub.FlowControlSettings{
+		MaxOutstandingMessages: pubsubQueueSize,
+		LimitExceededBehavior:  pubsub.FlowControlSignalError,
+	}
+	log.Infof("publishing shipment events to Pub/Sub topic %s", topic)
+	return &pubsubPublisher{topic: topic, encoder: eventEncoderFromEnv()}
+}
+
+func (p *pubsubPublisher) Publish(ctx context.Context, ev shipmentEvent) error {
+	ctx, span := tracer.Start(ctx, p.topic.String()+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("gcp_pubsub"),
+			semconv.MessagingDestinationKey.String(p.topic.String()),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingMessageIDKey.String(ev.ID),
+		),
+	)
+	defer span.End()
+
+	data, err := p.encoder.encode(ctx, ev)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	attrs := map[string]string{
+		"event_type":   ev.Type,
+		"content-type": p.encoder.contentType(),
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(attrs))
+
+	res := p.topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attrs})
+	select {
+	case <-res.Ready():
+		// The message was refused at once, e.g. because too many are
+		// waiting to be sent.
+		if _, err := res.Get(ctx); err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+			return err
+		}
+	default:
+		pctx := detachedContext(ctx)
+		go func() {
+			if _, err := res.Get(pctx); err != nil {
+				log.Ctx(pctx).WithError(err).Errorf("failed to publish event %s to Pub/Sub topic %s", ev.ID, p.topic)
+			}
+		}()
+	}
+	return nil
+}
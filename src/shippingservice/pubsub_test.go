@@ -0,0 +1,69 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/pstest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestPubSubPublisher checks that events reach the topic with the trace
+// context of the producer span in the message attributes.
+func TestPubSubPublisher(t *testing.T) {
+	saved := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(saved)
+
+	srv := pstest.NewServer()
+	defer srv.Close()
+	if _, err := srv.GServer.CreateTopic(context.Background(), &pubsubpb.Topic{Name: "projects/workshop/topics/shipments"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PUBSUB_EMULATOR_HOST", srv.Addr)
+	t.Setenv("PUBSUB_TOPIC", "shipments")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "workshop")
+	p := pubsubPublisherFromEnv()
+	defer p.topic.Stop()
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{0x01}, SpanID: trace.SpanID{0x02}, TraceFlags: trace.FlagsSampled})
+	if err := p.Publish(trace.ContextWithSpanContext(context.Background(), sc), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.Messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("TestPubSubPublisher: event was not published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	msg := srv.Messages()[0]
+	var ev shipmentEvent
+	if err := json.Unmarshal(msg.Data, &ev); err != nil || ev.TrackingID != "AB-123" {
+		t.Errorf("TestPubSubPublisher: data %s is not the event (%v)", msg.Data, err)
+	}
+	got := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier(msg.Attributes)))
+	if got.TraceID() != sc.TraceID() || msg.Attributes["event_type"] != eventShipmentStatusChanged {
+		t.Errorf("TestPubSubPublisher: attributes %v do not carry the trace and event type", msg.Attributes)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const defaultQuoteValidity = 15 * time.Minute
+
+// issuedQuote is a price handed out by GetQuote that ShipOrder will honour
+// until it expires, as long as the order is priced from the same inputs and
+// has the same options. Method is the method it was quoted for, which the
+// order is then shipped by.
+type issuedQuote struct {
+	ID           string            `json:"id"`
+	Price        Quote             `json:"price"`
+	Zone         zone              `json:"zone"`
+	WeightBucket int               `json:"weight_bucket"`
+	Method       pb.ShippingMethod `json:"method,omitempty"`
+	Options      shippingOptions   `json:"options"`
+	// Pricing is the pricingDigest of the quote.
+	Pricing string    `json:"pricing,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// pricingDigest identifies what a quote was priced from, apart from its
+// options: the zone and weight of the parcel, whether the cart is empty, and
+// the country, zip code and city of the address, which distance and taxes
+// depend on. It is a hash, so that addresses are not kept with quotes.
+func pricingDigest(key quoteCacheKey, a *pb.Address) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%d:%t:%s", key.zone, key.weightBucket, key.empty, geocodeKey(a))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// matches reports whether an order to address with the given key may use
+// the quote. Quotes issued before the digest was kept are matched on zone
+// and weight alone.
+func (q issuedQuote) matches(key quoteCacheKey, address *pb.Address) bool {
+	if q.Pricing == "" {
+		return q.Zone == key.zone && q.WeightBucket == key.weightBucket
+	}
+	return q.Pricing == pricingDigest(key, address)
+}
+
+// quoteRepositoryFromEnv keeps issued quotes in the database if there is
+// one, in Redis if it is the cache backend, and in memory otherwise.
+func quoteRepositoryFromEnv(rdb redis.UniversalClient, db *database) QuoteRepository {
+	switch {
+	case db != nil:
+		return &sqlQuoteRepository{db: db}
+	case rdb != nil:
+		return &redisQuoteStore{rdb: rdb}
+	}
+	return newMemoryQuoteStore()
+}
+
+// memoryQuoteStore keeps issued quotes in process memory. Expired quotes are
+// swept at most once a minute, when a new quote is issued.
+type memoryQuoteStore struct {
+	mu        sync.Mutex
+	quotes    map[string]issuedQuote
+	lastSweep time.Time
+}
+
+func newMemoryQuoteStore() *memoryQuoteStore {
+	return &memoryQuoteStore{quotes: make(map[string]issuedQuote)}
+}
+
+func (s *memoryQuoteStore) issue(_ context.Context, q issuedQuote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+	}
+	s.quotes[q.ID] = q
+	return nil
+}
+
+func (s *memoryQuoteStore) deleteExpired(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sweep(now), nil
+}
+
+func (s *memoryQuoteStore) sweep(now time.Time) int {
+	n := 0
+	for id, old := range s.quotes {
+		if !now.Before(old.Expires) {
+			delete(s.quotes, id)
+			n++
+		}
+	}
+	s.lastSweep = now
+	return n
+}
+
+func (s *memoryQuoteStore) lookup(_ context.Context, id string) (issuedQuote, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.quotes[id]
+	if !ok || !time.Now().Before(q.Expires) {
+		return issuedQuote{}, false, nil
+	}
+	return q, true, nil
+}
+
+// quoteBatchLookup is implemented by quote repositories that can look up many
+// quote IDs in one round trip, which ShipOrders uses to fetch the quotes of a
+// whole batch up front.
+type quoteBatchLookup interface {
+	lookupMany(ctx context.Context, ids []string) (map[string]issuedQuote, error)
+}
+
+// redisQuoteStore keeps issued quotes in Redis, expiring them with the key
+// TTL, so an order can be placed on a different replica than the quote.
+type redisQuoteStore struct {
+	rdb redis.UniversalClient
+}
+
+func (s *redisQuoteStore) issue(ctx context.Context, q issuedQuote) error {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, "quote-id:"+q.ID, b, time.Until(q.Expires)).Err()
+}
+
+func (s *redisQuoteStore) lookup(ctx context.Context, id string) (issuedQuote, bool, error) {
+	b, err := s.rdb.Get(ctx, "quote-id:"+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return issuedQuote{}, false, nil
+	}
+	if err != nil {
+		return issuedQuote{}, false, err
+	}
+	var q issuedQuote
+	if err := json.Unmarshal(b, &q); err != nil {
+		return issuedQuote{}, false, err
+	}
+	return q, time.Now().Before(q.Expires), nil
+}
+
+// lookupMany looks up many quote IDs in a single pipeline and returns the
+// quotes that exist and have not expired.
+func (s *redisQuoteStore) lookupMany(ctx context.Context, ids []string) (map[string]issuedQuote, error) {
+	cmds := make([]*redis.StringCmd, len(ids))
+	_, err := s.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = p.Get(ctx, "quote-id:"+id)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	quotes := make(map[string]issuedQuote, len(ids))
+	for _, cmd := range cmds {
+		b, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+		var q issuedQuote
+		if err := json.Unmarshal(b, &q); err == nil && time.Now().Before(q.Expires) {
+			quotes[q.ID] = q
+		}
+	}
+	return quotes, nil
+}
+
+// deleteExpired has nothing to do: Redis expires the keys by itself.
+func (s *redisQuoteStore) deleteExpired(context.Context, time.Time) (int, error) {
+	return 0, nil
+}
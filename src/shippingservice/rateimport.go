@@ -0,0 +1,337 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+const maxRateImportBytes = 64 << 20
+
+var (
+	// rateImportProgressRows is how often an import reports its progress.
+	rateImportProgressRows = 1000
+	rateImportHeader       = []string{"zone", "weight_bucket", "method", "price"}
+
+	errRatesChanged = errors.New("the rate table was reloaded during the import; retry it")
+)
+
+// rateImportResult is the outcome of an import, and the last line of its
+// response.
+type rateImportResult struct {
+	Rows            int    `json:"rows"`
+	Prices          int    `json:"prices,omitempty"`
+	Version         string `json:"version,omitempty"`
+	PreviousVersion string `json:"previous_version"`
+	// Persisted reports whether the prices were written to RATES_FILE.
+	// Imports into the built-in rates only last until the process exits.
+	Persisted bool   `json:"persisted"`
+	Error     string `json:"error,omitempty"`
+}
+
+// importPrices reads prices as CSV rows of zone, weight bucket, method and
+// price, after a header naming those columns, and applies them to the current
+// rate table at once: either every row is valid and the resulting table
+// replaces the current one, or nothing changes. Imported prices are added to
+// those of the table, replacing any for the same parcels, or with replace,
+// take the place of all of them. The prices of the new table are written to
+// the rate file, if there is one, before it replaces the current one, so
+// that reloads and restarts keep them. progress is called every
+// rateImportProgressRows rows.
+func (s *rateSource) importPrices(ctx context.Context, r io.Reader, replace bool, progress func(rows int)) (rateImportResult, error) {
+	ctx, span := tracer.Start(ctx, "rates.import", trace.WithAttributes(attribute.Bool("rates.import.replace", replace)))
+	defer span.End()
+	base := s.table()
+	res := rateImportResult{PreviousVersion: base.version}
+	span.SetAttributes(attribute.String("rates.previous_version", base.version))
+	fail := func(err error) (rateImportResult, error) {
+		span.SetAttributes(attribute.Int("rates.import.rows", res.Rows))
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		log.Ctx(ctx).WithError(err).Warnf("rate import failed after %d rows", res.Rows)
+		res.Error = err.Error()
+		return res, err
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(rateImportHeader)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return fail(fmt.Errorf("read header: %w", err))
+	}
+	for i, name := range rateImportHeader {
+		if !strings.EqualFold(strings.TrimSpace(header[i]), name) {
+			return fail(fmt.Errorf("header must be %s", strings.Join(rateImportHeader, ",")))
+		}
+	}
+	imported := make(map[priceKey]ratePrice)
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+		line, _ := cr.FieldPos(0)
+		p, key, err := parseRatePrice(rec)
+		if err != nil {
+			return fail(fmt.Errorf("line %d: %w", line, err))
+		}
+		if _, dup := imported[key]; dup {
+			return fail(fmt.Errorf("line %d: %s was already priced", line, p))
+		}
+		imported[key] = p
+		res.Rows++
+		if res.Rows%rateImportProgressRows == 0 {
+			span.AddEvent("rates.import.progress", trace.WithAttributes(attribute.Int("rates.import.rows", res.Rows)))
+			if progress != nil {
+				progress(res.Rows)
+			}
+		}
+	}
+
+	next := base.withPrices(imported, replace, !s.onRequest)
+	persisted, err := s.commit(base, next)
+	if err != nil {
+		return fail(err)
+	}
+	res.Prices, res.Version, res.Persisted = len(next.Prices), next.version, persisted
+	span.SetAttributes(
+		attribute.Int("rates.import.rows", res.Rows),
+		attribute.String("rates.version", next.version),
+		attribute.Bool("rates.import.persisted", persisted),
+	)
+	log.Ctx(ctx).Infof("imported %d prices into rate table %s, which is now %s", res.Rows, base.version, next.version)
+	if !persisted {
+		log.Ctx(ctx).Warn("imported prices are only kept in memory and are lost on restart: set RATES_FILE to keep them")
+	}
+	return res, nil
+}
+
+// commit makes next the current table if base still is. With a rate file,
+// the prices of next are written to it first, and commit reports that they
+// were.
+func (s *rateSource) commit(base, next *rateTable) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.table() != base {
+		return false, errRatesChanged
+	}
+	if s.path == "" {
+		s.current.Store(next)
+		return false, nil
+	}
+	if err := s.writePrices(next.Prices); err != nil {
+		return false, fmt.Errorf("write %s: %w", s.path, err)
+	}
+	s.current.Store(next)
+	return true, nil
+}
+
+// writePrices replaces the prices listed in the rate file, keeping the rest
+// of the file, comments included. The file is replaced in one rename, so a
+// reload never reads it half written, and its new modification time is
+// recorded so that the watch does not reload it. The caller must hold s.mu.
+func (s *rateSource) writePrices(prices []ratePrice) error {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return errors.New("the rate file is not a YAML mapping")
+	}
+	var value yaml.Node
+	if err := value.Encode(prices); err != nil {
+		return err
+	}
+	root := doc.Content[0]
+	found := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "prices" {
+			root.Content[i+1], found = &value, true
+		}
+	}
+	if !found {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "prices"}, &value)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".rates-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := yaml.NewEncoder(tmp)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(s.path); err == nil {
+		s.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+// parseRatePrice parses and validates one imported row.
+func parseRatePrice(rec []string) (ratePrice, priceKey, error) {
+	bucket, err := strconv.Atoi(strings.TrimSpace(rec[1]))
+	if err != nil {
+		return ratePrice{}, priceKey{}, fmt.Errorf("weight bucket %q is not a number", rec[1])
+	}
+	price, err := strconv.ParseFloat(strings.TrimSpace(rec[3]), 64)
+	if err != nil {
+		return ratePrice{}, priceKey{}, fmt.Errorf("price %q is not a number", rec[3])
+	}
+	p := ratePrice{
+		Zone:         strings.ToLower(strings.TrimSpace(rec[0])),
+		WeightBucket: bucket,
+		Method:       strings.ToLower(strings.TrimSpace(rec[2])),
+		Price:        price,
+	}
+	key, err := p.key()
+	return p, key, err
+}
+
+// withPrices returns a copy of the table with the imported prices added or,
+// with replace, in place of its own. Its version is derived from the table's
+// and the prices, and its matrix is precomputed if precompute is set.
+func (rt *rateTable) withPrices(imported map[priceKey]ratePrice, replace, precompute bool) *rateTable {
+	next := *rt
+	next.Prices = nil
+	next.prices = make(map[priceKey]float64)
+	if !replace {
+		for _, p := range rt.Prices {
+			key, _ := p.key()
+			if _, ok := imported[key]; !ok {
+				next.prices[key] = p.Price
+				next.Prices = append(next.Prices, p)
+			}
+		}
+	}
+	for key, p := range imported {
+		next.prices[key] = p.Price
+		next.Prices = append(next.Prices, p)
+	}
+	sort.Slice(next.Prices, func(i, j int) bool {
+		a, b := next.Prices[i], next.Prices[j]
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		if a.WeightBucket != b.WeightBucket {
+			return a.WeightBucket < b.WeightBucket
+		}
+		return a.Method < b.Method
+	})
+
+	h := sha256.New()
+	fmt.Fprintln(h, rt.version)
+	for _, p := range next.Prices {
+		fmt.Fprintf(h, "%s,%d,%s,%v\n", p.Zone, p.WeightBucket, p.Method, p.Price)
+	}
+	next.version = hex.EncodeToString(h.Sum(nil)[:4])
+	next.matrix = nil
+	if precompute {
+		next.precompute()
+	}
+	return &next
+}
+
+// ServeHTTP reports the current rate table. POST imports prices into it, as
+// CSV with the header zone,weight_bucket,method,price; ?replace=true drops the
+// table's own prices first. The response is a JSON line every
+// rateImportProgressRows rows, then one with the result. A row that is not
+// valid fails the whole import, with 400 if no progress was reported yet.
+func (s *rateSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rt := s.table()
+		source := s.path
+		if source == "" {
+			source = "built-in"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Version     string `json:"version"`
+			Source      string `json:"source"`
+			Prices      int    `json:"prices"`
+			Precomputed bool   `json:"precomputed"`
+		}{rt.version, source, len(rt.Prices), rt.matrix != nil})
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		reported := false
+		progress := func(rows int) {
+			reported = true
+			enc.Encode(struct {
+				Rows int `json:"rows"`
+			}{rows})
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		body := http.MaxBytesReader(w, r.Body, maxRateImportBytes)
+		res, err := s.importPrices(r.Context(), body, r.URL.Query().Get("replace") == "true", progress)
+		if err != nil && !reported {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		enc.Encode(res)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestRateImport checks that imported prices are applied all at once, with
+// progress along the way, and that a bad row leaves the table as it was.
+func TestRateImport(t *testing.T) {
+	saved := rateImportProgressRows
+	rateImportProgressRows = 50
+	defer func() { rateImportProgressRows = saved }()
+	s := newDefaultRateSource()
+	before := s.table()
+	post := func(query, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rates"+query, strings.NewReader(body)))
+		return rec
+	}
+
+	var csv strings.Builder
+	csv.WriteString("zone,weight_bucket,method,price\n")
+	rows := 0
+	for z := zoneLocal; z <= zoneInternational; z++ {
+		for b := 0; b <= len(weightBucketsGrams); b++ {
+			for _, m := range []string{"standard", "express", "overnight"} {
+				fmt.Fprintf(&csv, "%s,%d,%s,%d.25\n", z, b, m, rows)
+				rows++
+			}
+		}
+	}
+	rec := post("", csv.String())
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != rows/rateImportProgressRows+1 {
+		t.Fatalf("TestRateImport: import returned %d %s", rec.Code, rec.Body)
+	}
+	after := s.table()
+	if after.version == before.version || len(after.Prices) != rows || after.matrix == nil {
+		t.Errorf("TestRateImport: table has version %s and %d prices, want a new version and %d", after.version, len(after.Prices), rows)
+	}
+	key := quoteCacheKey{zone: zoneLocal, weightBucket: 0, method: pb.ShippingMethod_SHIPPING_METHOD_EXPRESS}
+	if got := after.quote(key); got != (Quote{Dollars: 1, Cents: 25}) {
+		t.Errorf("TestRateImport: imported quote is %v, want $1.25", got)
+	}
+
+	rec = post("", "zone,weight_bucket,method,price\nzone-1,0,express,9\nzone-1,1,teleport,9\n")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "line 3") {
+		t.Errorf("TestRateImport: invalid row returned %d %s", rec.Code, rec.Body)
+	}
+	if s.table() != after {
+		t.Error("TestRateImport: failed import changed the table")
+	}
+
+	rec = post("?replace=true", "zone,weight_bucket,method,price\nzone-1,0,express,9\n")
+	if rec.Code != http.StatusOK || len(s.table().Prices) != 1 || s.table().quote(key) != (Quote{Dollars: 9}) {
+		t.Errorf("TestRateImport: replacing import returned %d %s", rec.Code, rec.Body)
+	}
+}
+
+// TestRateImportReload checks that imported prices are written to the rate
+// file, so that they survive a reload, and that imports into the built-in
+// rates say they are not kept.
+func TestRateImportReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.yaml")
+	if err := os.WriteFile(path, defaultRates, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &rateSource{path: path}
+	if err := s.reload(); err != nil {
+		t.Fatalf("TestRateImportReload: %v", err)
+	}
+	ctx := context.Background()
+	res, err := s.importPrices(ctx, strings.NewReader("zone,weight_bucket,method,price\nzone-1,0,express,9\n"), false, nil)
+	if err != nil || !res.Persisted {
+		t.Fatalf("TestRateImportReload: import returned %+v (%v)", res, err)
+	}
+	if s.changed(mustModTime(t, path)) {
+		t.Error("TestRateImportReload: the watch would reload the file the import wrote")
+	}
+	if err := s.reload(); err != nil {
+		t.Fatalf("TestRateImportReload: reload after the import: %v", err)
+	}
+	key := quoteCacheKey{zone: zoneLocal, weightBucket: 0, method: pb.ShippingMethod_SHIPPING_METHOD_EXPRESS}
+	if got := s.table().quote(key); got != (Quote{Dollars: 9}) {
+		t.Errorf("TestRateImportReload: quote after a reload is %v, want the imported $9", got)
+	}
+	b, _ := os.ReadFile(path)
+	if !strings.Contains(string(b), "# This file is reloaded while the service is running") {
+		t.Error("TestRateImportReload: the import dropped the comments of the rate file")
+	}
+
+	res, err = newDefaultRateSource().importPrices(ctx, strings.NewReader("zone,weight_bucket,method,price\nzone-1,0,express,9\n"), false, nil)
+	if err != nil || res.Persisted {
+		t.Errorf("TestRateImportReload: import into the built-in rates returned %+v (%v), want it not persisted", res, err)
+	}
+}
+
+func mustModTime(t *testing.T, path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.ModTime()
+}
@@ -0,0 +1,356 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const defaultRatesReloadInterval = 10 * time.Second
+
+// defaultRates is used when RATES_FILE is not set.
+//
+//go:embed rates.yaml
+var defaultRates []byte
+
+// methodRate is the price of one shipping method.
+type methodRate struct {
+	Base  float64 `yaml:"base"`
+	PerKg float64 `yaml:"per_kg"`
+}
+
+// ratePrice sets the price of one zone, weight bucket and method outright,
+// instead of working it out from the method rate and the zone multiplier.
+type ratePrice struct {
+	Zone         string  `yaml:"zone" json:"zone"`
+	WeightBucket int     `yaml:"weight_bucket" json:"weight_bucket"`
+	Method       string  `yaml:"method" json:"method"`
+	Price        float64 `yaml:"price" json:"price"`
+}
+
+// priceKey identifies the parcels a ratePrice applies to.
+type priceKey struct {
+	zone         zone
+	weightBucket int
+	method       pb.ShippingMethod
+}
+
+// rateTable holds the prices used to compute quotes.
+type rateTable struct {
+	Currency   string                `yaml:"currency"`
+	Methods    map[string]methodRate `yaml:"methods"`
+	Zones      map[string]float64    `yaml:"zones"`
+	Prices     []ratePrice           `yaml:"prices"`
+	Options    rateOptions           `yaml:"options"`
+	Rules      []pricingRule         `yaml:"rules"`
+	Promotions []promotion           `yaml:"promotions"`
+	Customs    customsRates          `yaml:"customs"`
+	Distance   distanceRate          `yaml:"distance"`
+
+	// prices indexes Prices.
+	prices map[priceKey]float64
+
+	// version identifies the contents the table was parsed from.
+	version string
+	// matrix holds the quote of every zone, weight bucket and method, as
+	// indexed by matrixIndex, or is nil if quotes are computed on request.
+	matrix []Quote
+}
+
+// parseRateTable parses and validates a YAML rate table.
+func parseRateTable(b []byte) (*rateTable, error) {
+	var rt rateTable
+	if err := yaml.Unmarshal(b, &rt); err != nil {
+		return nil, err
+	}
+	if rt.Currency != "USD" {
+		return nil, fmt.Errorf("unsupported currency %q: quotes are in USD", rt.Currency)
+	}
+	if _, ok := rt.Methods["standard"]; !ok {
+		return nil, fmt.Errorf("no rate for the standard method")
+	}
+	for name, r := range rt.Methods {
+		if _, ok := pb.ShippingMethod_value["SHIPPING_METHOD_"+strings.ToUpper(name)]; !ok {
+			return nil, fmt.Errorf("unknown shipping method %q", name)
+		}
+		if r.Base < 0 || r.PerKg < 0 {
+			return nil, fmt.Errorf("negative rate for %q", name)
+		}
+	}
+	for name, m := range rt.Zones {
+		if m <= 0 {
+			return nil, fmt.Errorf("zone %q must have a positive multiplier", name)
+		}
+	}
+	if err := rt.Options.validate(); err != nil {
+		return nil, err
+	}
+	if err := rt.Customs.validate(); err != nil {
+		return nil, err
+	}
+	if err := rt.Distance.validate(); err != nil {
+		return nil, err
+	}
+	for i := range rt.Rules {
+		if err := rt.Rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	promotions := make(map[string]bool, len(rt.Promotions))
+	for i := range rt.Promotions {
+		if err := rt.Promotions[i].compile(); err != nil {
+			return nil, err
+		}
+		if promotions[rt.Promotions[i].ID] {
+			return nil, fmt.Errorf("more than one promotion %q", rt.Promotions[i].ID)
+		}
+		promotions[rt.Promotions[i].ID] = true
+	}
+	rt.prices = make(map[priceKey]float64, len(rt.Prices))
+	for _, p := range rt.Prices {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := rt.prices[key]; dup {
+			return nil, fmt.Errorf("more than one price for %s", p)
+		}
+		rt.prices[key] = p.Price
+	}
+	sum := sha256.Sum256(b)
+	rt.version = hex.EncodeToString(sum[:4])
+	rt.precompute()
+	return &rt, nil
+}
+
+// zonesByName maps the names of the zones back to them.
+var zonesByName = func() map[string]zone {
+	m := make(map[string]zone)
+	for z := zoneLocal; z <= zoneInternational; z++ {
+		m[z.String()] = z
+	}
+	return m
+}()
+
+// key validates the price and returns the parcels it applies to.
+func (p ratePrice) key() (priceKey, error) {
+	z, ok := zonesByName[p.Zone]
+	if !ok {
+		return priceKey{}, fmt.Errorf("unknown zone %q", p.Zone)
+	}
+	if p.WeightBucket < 0 || p.WeightBucket > len(weightBucketsGrams) {
+		return priceKey{}, fmt.Errorf("weight bucket %d is not between 0 and %d", p.WeightBucket, len(weightBucketsGrams))
+	}
+	m, ok := pb.ShippingMethod_value["SHIPPING_METHOD_"+strings.ToUpper(p.Method)]
+	if !ok || m == int32(pb.ShippingMethod_SHIPPING_METHOD_UNSPECIFIED) {
+		return priceKey{}, fmt.Errorf("unknown shipping method %q", p.Method)
+	}
+	if p.Price < 0 {
+		return priceKey{}, fmt.Errorf("negative price for %s", p)
+	}
+	return priceKey{zone: z, weightBucket: p.WeightBucket, method: pb.ShippingMethod(m)}, nil
+}
+
+func (p ratePrice) String() string {
+	return fmt.Sprintf("%s, weight bucket %d, %s", p.Zone, p.WeightBucket, p.Method)
+}
+
+// precompute fills the matrix with the quote of every combination of zone,
+// weight bucket and method, so that pricing a request is a lookup.
+func (rt *rateTable) precompute() {
+	buckets, methods := len(weightBucketsGrams)+1, len(pb.ShippingMethod_name)
+	rt.matrix = make([]Quote, int(zoneInternational)*buckets*methods)
+	for z := zoneLocal; z <= zoneInternational; z++ {
+		for b := 0; b < buckets; b++ {
+			for m := 0; m < methods; m++ {
+				key := quoteCacheKey{zone: z, weightBucket: b, method: pb.ShippingMethod(m)}
+				i, _ := matrixIndex(key)
+				rt.matrix[i] = CreateQuoteFromFloat(rt.price(key))
+			}
+		}
+	}
+}
+
+// matrixIndex returns the position of the quote for key in a rate matrix.
+func matrixIndex(key quoteCacheKey) (int, bool) {
+	buckets, methods := len(weightBucketsGrams)+1, len(pb.ShippingMethod_name)
+	if key.zone < zoneLocal || key.zone > zoneInternational ||
+		key.weightBucket < 0 || key.weightBucket >= buckets ||
+		key.method < 0 || int(key.method) >= methods {
+		return 0, false
+	}
+	return ((int(key.zone)-1)*buckets+key.weightBucket)*methods + int(key.method), true
+}
+
+// quote returns the quote for a parcel matching key, from the matrix unless
+// it was dropped.
+func (rt *rateTable) quote(key quoteCacheKey) Quote {
+	if i, ok := matrixIndex(key); ok && rt.matrix != nil {
+		return rt.matrix[i]
+	}
+	return CreateQuoteFromFloat(rt.price(key))
+}
+
+// billableKg is the weight charged for parcels in the given weight bucket.
+func billableKg(bucket int) float64 {
+	if bucket < len(weightBucketsGrams) {
+		return float64(weightBucketsGrams[bucket]) / 1000
+	}
+	return 2 * float64(weightBucketsGrams[len(weightBucketsGrams)-1]) / 1000
+}
+
+// methodName is the rate table's name for a shipping method, e.g. "express".
+func methodName(m pb.ShippingMethod) string {
+	return strings.ToLower(strings.TrimPrefix(m.String(), "SHIPPING_METHOD_"))
+}
+
+// price returns the cost in USD of shipping a parcel matching key: its own
+// price if the table sets one, and otherwise the method rate times the zone
+// multiplier. Methods without their own rate are charged at the standard
+// rate.
+func (rt *rateTable) price(key quoteCacheKey) float64 {
+	if p, ok := rt.prices[priceKey{zone: key.zone, weightBucket: key.weightBucket, method: key.method}]; ok {
+		return p
+	}
+	r, ok := rt.Methods[methodName(key.method)]
+	if !ok {
+		r = rt.Methods["standard"]
+	}
+	multiplier, ok := rt.Zones[key.zone.String()]
+	if !ok {
+		multiplier = 1
+	}
+	return (r.Base + r.PerKg*billableKg(key.weightBucket)) * multiplier
+}
+
+// rateSource holds the current rate table and reloads it from disk when the
+// file changes or the process receives SIGHUP. With onRequest set, the rate
+// matrix of every table is dropped and quotes are computed on each request,
+// to compare against.
+type rateSource struct {
+	path      string
+	onRequest bool
+	current   atomic.Value // *rateTable
+
+	mu      sync.Mutex // serializes reloads and imports
+	modTime time.Time
+}
+
+// newDefaultRateSource returns a rate source serving the built-in rates.
+func newDefaultRateSource() *rateSource {
+	rt, err := parseRateTable(defaultRates)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in rate table: %v", err))
+	}
+	s := &rateSource{}
+	s.current.Store(rt)
+	return s
+}
+
+// rateSourceFromEnv loads the rates from RATES_FILE, or the built-in rates if
+// it is not set. RATE_MATRIX=false computes quotes on request.
+func rateSourceFromEnv() *rateSource {
+	path := os.Getenv("RATES_FILE")
+	onRequest := !envBool("RATE_MATRIX", true)
+	if path == "" {
+		s := newDefaultRateSource()
+		if onRequest {
+			s.onRequest = true
+			s.table().matrix = nil
+		}
+		return s
+	}
+	s := &rateSource{path: path, onRequest: onRequest}
+	if err := s.reload(); err != nil {
+		log.Fatalf("failed to load rates from %s: %v", path, err)
+	}
+	return s
+}
+
+func (s *rateSource) table() *rateTable {
+	return s.current.Load().(*rateTable)
+}
+
+// reload re-reads the rate file. The current table is kept if the new one is
+// invalid.
+func (s *rateSource) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	rt, err := parseRateTable(b)
+	if err != nil {
+		return err
+	}
+	if s.onRequest {
+		rt.matrix = nil
+	}
+	s.modTime = fi.ModTime()
+	s.current.Store(rt)
+	log.Infof("loaded rate table %s from %s", rt.version, s.path)
+	return nil
+}
+
+// watch reloads the rate file whenever its modification time changes or the
+// process receives SIGHUP. It does nothing for the built-in rates.
+func (s *rateSource) watch(interval time.Duration) {
+	if s.path == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			if fi, err := os.Stat(s.path); err != nil || !s.changed(fi.ModTime()) {
+				continue
+			}
+		}
+		if err := s.reload(); err != nil {
+			log.WithError(err).Errorf("failed to reload rates from %s, keeping rate table %s", s.path, s.table().version)
+		}
+	}
+}
+
+// changed reports whether modTime differs from that of the rate file when it
+// was last read or written.
+func (s *rateSource) changed(modTime time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !modTime.Equal(s.modTime)
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestRateTablePrice checks that quotes follow the weight and zone rules.
+func TestRateTablePrice(t *testing.T) {
+	rt, err := parseRateTable([]byte(`
+currency: USD
+methods:
+  standard: {base: 5, per_kg: 1}
+zones:
+  international: 2
+`))
+	if err != nil {
+		t.Fatalf("TestRateTablePrice: %v", err)
+	}
+	tests := []struct {
+		key  quoteCacheKey
+		want float64
+	}{
+		{quoteCacheKey{zone: 1, weightBucket: 0}, 6},
+		{quoteCacheKey{zone: 1, weightBucket: 2}, 10},
+		{quoteCacheKey{zone: zoneInternational, weightBucket: 0}, 12},
+		{quoteCacheKey{zone: 1, weightBucket: len(weightBucketsGrams)}, 45},
+		// Methods without a rate fall back to standard.
+		{quoteCacheKey{zone: 1, method: pb.ShippingMethod_SHIPPING_METHOD_OVERNIGHT}, 6},
+	}
+	for _, tt := range tests {
+		if got := rt.price(tt.key); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("TestRateTablePrice: price(%v) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+// TestParseRateTableRejectsInvalid checks that bad rate files are refused.
+func TestParseRateTableRejectsInvalid(t *testing.T) {
+	for _, in := range []string{
+		"currency: EUR\nmethods: {standard: {base: 1}}",
+		"currency: USD\nmethods: {express: {base: 1}}",
+		"currency: USD\nmethods: {standard: {base: 1}, teleport: {base: 1}}",
+		"currency: USD\nmethods: {standard: {base: -1}}",
+		"currency: USD\nmethods: {standard: {base: 1}}\nzones: {zone-1: 0}",
+	} {
+		if _, err := parseRateTable([]byte(in)); err == nil {
+			t.Errorf("TestParseRateTableRejectsInvalid: %q was accepted", in)
+		}
+	}
+}
+
+// TestRateSourceReload checks that a reload picks up new prices and keeps the
+// old table when the file becomes invalid.
+func TestRateSourceReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.yaml")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("currency: USD\nmethods: {standard: {base: 5}}")
+	s := &rateSource{path: path}
+	if err := s.reload(); err != nil {
+		t.Fatalf("TestRateSourceReload: %v", err)
+	}
+	first := s.table().version
+
+	write("currency: USD\nmethods: {standard: {base: 7}}")
+	if err := s.reload(); err != nil {
+		t.Fatalf("TestRateSourceReload: %v", err)
+	}
+	if s.table().version == first || s.table().price(quoteCacheKey{}) != 7 {
+		t.Errorf("TestRateSourceReload: new rates were not loaded")
+	}
+
+	write("not: [valid")
+	if err := s.reload(); err == nil {
+		t.Errorf("TestRateSourceReload: invalid file was accepted")
+	}
+	if s.table().price(quoteCacheKey{}) != 7 {
+		t.Errorf("TestRateSourceReload: invalid file replaced the current rates")
+	}
+}
+
+// TestRateMatrix checks that the precomputed quotes are the ones computed on
+// request, and that RATE_MATRIX=false drops them.
+func TestRateMatrix(t *testing.T) {
+	rt := newDefaultRateSource().table()
+	for z := zoneLocal; z <= zoneInternational; z++ {
+		for b := 0; b <= len(weightBucketsGrams); b++ {
+			for m := range pb.ShippingMethod_name {
+				key := quoteCacheKey{zone: z, weightBucket: b, method: pb.ShippingMethod(m)}
+				if got, want := rt.quote(key), CreateQuoteFromFloat(rt.price(key)); got != want {
+					t.Errorf("TestRateMatrix: quote(%v) = %v, want %v", key, got, want)
+				}
+			}
+		}
+	}
+
+	t.Setenv("RATE_MATRIX", "false")
+	s := rateSourceFromEnv()
+	if s.table().matrix != nil {
+		t.Error("TestRateMatrix: RATE_MATRIX=false kept the matrix")
+	}
+	key := quoteCacheKey{zone: zoneInternational, weightBucket: 2, method: pb.ShippingMethod_SHIPPING_METHOD_EXPRESS}
+	if got, want := s.table().quote(key), rt.quote(key); got != want {
+		t.Errorf("TestRateMatrix: quote on request is %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// redBuckets are the duration histogram bucket boundaries, in seconds.
+var redBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// redMetrics records the Rate, Errors and Duration of every RPC. Measurements
+// are made with the request context, so the SDK attaches the trace ID of
+// sampled requests to histogram buckets as exemplars, and dashboards can jump
+// from a latency spike to a trace that caused it.
+type redMetrics struct {
+	requests metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+func newREDMetrics() *redMetrics {
+	m := &redMetrics{}
+	var err error
+	if m.requests, err = meter.Int64Counter("shipping.rpc.requests",
+		metric.WithDescription("RPCs handled, by method and status code."),
+	); err != nil {
+		log.WithError(err).Warn("failed to create RPC request metric")
+	}
+	if m.errors, err = meter.Int64Counter("shipping.rpc.errors",
+		metric.WithDescription("RPCs that failed, by method and status code."),
+	); err != nil {
+		log.WithError(err).Warn("failed to create RPC error metric")
+	}
+	if m.duration, err = meter.Float64Histogram("shipping.rpc.duration",
+		metric.WithDescription("Time taken to handle RPCs, by method and status code."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(redBuckets...),
+	); err != nil {
+		log.WithError(err).Warn("failed to create RPC duration metric")
+	}
+	return m
+}
+
+func (m *redMetrics) record(ctx context.Context, fullMethod string, start time.Time, err error) {
+	service, method := splitMethodName(fullMethod)
+	code := status.Code(err)
+	attrs := metric.WithAttributes(
+		semconv.RPCServiceKey.String(service),
+		semconv.RPCMethodKey.String(method),
+		semconv.RPCGRPCStatusCodeKey.Int(int(code)),
+		attribute.String("rpc.grpc.status", code.String()),
+		attribute.String("tenant.id", tenantFromContext(ctx).label),
+	)
+	if m.requests != nil {
+		m.requests.Add(ctx, 1, attrs)
+	}
+	if m.errors != nil && code != codes.OK {
+		m.errors.Add(ctx, 1, attrs)
+	}
+	if m.duration != nil {
+		m.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	}
+}
+
+// unary returns an interceptor recording RED metrics for unary RPCs.
+func (m *redMetrics) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.record(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// stream returns an interceptor recording RED metrics for streaming RPCs.
+// The duration covers the whole stream.
+func (m *redMetrics) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.record(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// splitMethodName splits "/package.Service/Method" into its service and
+// method names.
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestREDMetrics checks that requests, errors and durations are recorded per method and code.
+func TestREDMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	saved := meter
+	meter = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(serviceName)
+	defer func() { meter = saved }()
+
+	intercept := newREDMetrics().unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/ShipOrder"}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	fail := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.InvalidArgument, "bad")
+	}
+	intercept(context.Background(), nil, info, ok)
+	intercept(context.Background(), nil, info, ok)
+	intercept(context.Background(), nil, info, fail)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("TestREDMetrics: %v", err)
+	}
+	sums := map[string]int64{}
+	var observations uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					method, _ := dp.Attributes.Value("rpc.method")
+					code, _ := dp.Attributes.Value("rpc.grpc.status")
+					if method.AsString() != "ShipOrder" {
+						t.Errorf("TestREDMetrics: %s has rpc.method %q", m.Name, method.AsString())
+					}
+					sums[m.Name+"/"+code.AsString()] += dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					observations += dp.Count
+				}
+			}
+		}
+	}
+	want := map[string]int64{
+		"shipping.rpc.requests/OK":              2,
+		"shipping.rpc.requests/InvalidArgument": 1,
+		"shipping.rpc.errors/InvalidArgument":   1,
+	}
+	for k, v := range want {
+		if sums[k] != v {
+			t.Errorf("TestREDMetrics: %s = %d, expected %d", k, sums[k], v)
+		}
+	}
+	if len(sums) != len(want) {
+		t.Errorf("TestREDMetrics: got counters %v, expected %v", sums, want)
+	}
+	if observations != 3 {
+		t.Errorf("TestREDMetrics: duration histogram has %d observations, expected 3", observations)
+	}
+}
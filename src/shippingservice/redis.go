@@ -0,0 +1,274 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redisClientFromEnv connects to REDIS_ADDR when CACHE_BACKEND is "redis" and
+// returns nil otherwise. Commands are traced, guarded by a circuit breaker,
+// and the connection pool is reported as metrics. Spans carry the pattern of
+// the keys a command touches rather than the command itself, whose keys and
+// values hold quote IDs and idempotency keys.
+func redisClientFromEnv() redis.UniversalClient {
+	switch backend := os.Getenv("CACHE_BACKEND"); backend {
+	case "", "memory":
+		return nil
+	case "redis":
+	default:
+		log.Fatalf("unknown CACHE_BACKEND %q", backend)
+	}
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+	rdb.AddHook(breakerHook{breakerFromEnv("redis")})
+	if err := redisotel.InstrumentTracing(rdb, redisotel.WithDBStatement(false)); err != nil {
+		log.WithError(err).Fatal("failed to instrument Redis tracing")
+	}
+	// Added after the tracing hook, so that it runs within the command span.
+	rdb.AddHook(keyPatternHook{})
+	if err := redisotel.InstrumentMetrics(rdb); err != nil {
+		log.WithError(err).Fatal("failed to instrument Redis metrics")
+	}
+	log.Infof("using Redis at %s for caching", addr)
+	return rdb
+}
+
+// redisQuoteCache stores quotes in Redis, so that replicas share a cache and
+// the cache hop shows up in traces. Redis errors are treated as misses.
+type redisQuoteCache struct {
+	rdb     redis.UniversalClient
+	ttl     time.Duration
+	lookups metric.Int64Counter
+}
+
+func newRedisQuoteCache(rdb redis.UniversalClient, ttl time.Duration) *redisQuoteCache {
+	return &redisQuoteCache{rdb: rdb, ttl: ttl, lookups: newCacheLookupCounter()}
+}
+
+func (c *redisQuoteCache) get(ctx context.Context, key quoteCacheKey) (Quote, bool) {
+	var q Quote
+	b, err := c.rdb.Get(ctx, "quote:"+key.String()).Bytes()
+	if err == nil {
+		err = json.Unmarshal(b, &q)
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		recordRedisError(ctx, err)
+	}
+	hit := err == nil
+	recordCacheLookup(ctx, c.lookups, "redis", hit)
+	return q, hit
+}
+
+func (c *redisQuoteCache) put(ctx context.Context, key quoteCacheKey, q Quote) {
+	b, err := json.Marshal(q)
+	if err == nil {
+		err = c.rdb.Set(ctx, "quote:"+key.String(), b, c.ttl).Err()
+	}
+	if err != nil {
+		recordRedisError(ctx, err)
+	}
+}
+
+// getMany looks up all the keys in a single pipeline.
+func (c *redisQuoteCache) getMany(ctx context.Context, keys []quoteCacheKey) ([]Quote, []bool) {
+	quotes, hits := make([]Quote, len(keys)), make([]bool, len(keys))
+	if len(keys) == 0 {
+		return quotes, hits
+	}
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := c.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = p.Get(ctx, "quote:"+key.String())
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		recordRedisError(ctx, err)
+	}
+	for i, cmd := range cmds {
+		b, err := cmd.Bytes()
+		if err == nil {
+			err = json.Unmarshal(b, &quotes[i])
+		}
+		hits[i] = err == nil
+		recordCacheLookup(ctx, c.lookups, "redis", hits[i])
+	}
+	return quotes, hits
+}
+
+// putMany stores all the quotes in a single pipeline.
+func (c *redisQuoteCache) putMany(ctx context.Context, keys []quoteCacheKey, quotes []Quote) {
+	if len(keys) == 0 {
+		return
+	}
+	_, err := c.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, key := range keys {
+			b, err := json.Marshal(quotes[i])
+			if err != nil {
+				return err
+			}
+			p.Set(ctx, "quote:"+key.String(), b, c.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		recordRedisError(ctx, err)
+	}
+}
+
+// redisIdempotencyStore remembers idempotency keys in Redis with SET NX, so a
+// retried ShipOrder returns the original tracking ID on any replica. Pending
+// claims hold the tracking ID prefixed with "pending:".
+type redisIdempotencyStore struct {
+	rdb redis.UniversalClient
+	ttl time.Duration
+}
+
+const redisPendingPrefix = "pending:"
+
+func (s *redisIdempotencyStore) claim(ctx context.Context, key, trackingID string) (string, bool, error) {
+	k := "idempotency:" + key
+	ok, err := s.rdb.SetNX(ctx, k, redisPendingPrefix+trackingID, idempotencyPendingTTL).Result()
+	if err != nil {
+		return "", false, err
+	}
+	if ok {
+		return trackingID, true, nil
+	}
+	existing, err := s.rdb.Get(ctx, k).Result()
+	if err != nil {
+		return "", false, err
+	}
+	if strings.HasPrefix(existing, redisPendingPrefix) {
+		return "", false, errIdempotencyPending
+	}
+	return existing, false, nil
+}
+
+func (s *redisIdempotencyStore) complete(ctx context.Context, key, trackingID string) error {
+	return s.rdb.Set(ctx, "idempotency:"+key, trackingID, s.ttl).Err()
+}
+
+// release deletes the key in a transaction that fails if it changed since it
+// was read, so that a claim made after the pending one expired is kept.
+func (s *redisIdempotencyStore) release(ctx context.Context, key, trackingID string) error {
+	k := "idempotency:" + key
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, k).Result()
+		if err != nil || v != redisPendingPrefix+trackingID {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Del(ctx, k)
+			return nil
+		})
+		return err
+	}, k)
+	if errors.Is(err, redis.Nil) || errors.Is(err, redis.TxFailedErr) {
+		return nil
+	}
+	return err
+}
+
+func recordRedisError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(otelcodes.Error, err.Error())
+	log.Ctx(ctx).WithError(err).Warn("redis request failed")
+}
+
+// keyPatternHook records the pattern of the keys a command touches, such as
+// quote:*, as db.redis.key_pattern on its span, and the patterns of a
+// pipeline as db.redis.key_patterns. Full keys contain quote IDs and
+// idempotency keys, which are both personal data and unbounded in number.
+type keyPatternHook struct{}
+
+func (keyPatternHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (keyPatternHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if pattern := redisKeyPattern(cmd); pattern != "" {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("db.redis.key_pattern", pattern))
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (keyPatternHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		seen := map[string]bool{}
+		var patterns []string
+		for _, cmd := range cmds {
+			if pattern := redisKeyPattern(cmd); pattern != "" && !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+		if len(patterns) > 0 {
+			sort.Strings(patterns)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.StringSlice("db.redis.key_patterns", patterns))
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// redisKeyPattern returns the prefix of the first key of a command followed
+// by *, or "" for commands without a key. The service's keys are all of the
+// form prefix:id.
+func redisKeyPattern(cmd redis.Cmder) string {
+	switch cmd.Name() {
+	case "get", "set", "setnx", "mget", "del", "exists", "expire", "ttl":
+	default:
+		return ""
+	}
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	key, ok := args[1].(string)
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i+1] + "*"
+	}
+	return "*"
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestKeyPatternHook checks that Redis spans get the pattern of the keys a
+// command or pipeline touches, and never the keys themselves.
+func TestKeyPatternHook(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	ctx := context.Background()
+	next := func(context.Context, redis.Cmder) error { return nil }
+	nextPipeline := func(context.Context, []redis.Cmder) error { return nil }
+	hook := keyPatternHook{}
+
+	spanCtx, span := tp.Tracer("test").Start(ctx, "get")
+	hook.ProcessHook(next)(spanCtx, redis.NewStringCmd(ctx, "get", "quote-id:q-8f3a"))
+	span.End()
+
+	spanCtx, span = tp.Tracer("test").Start(ctx, "redis.pipeline")
+	hook.ProcessPipelineHook(nextPipeline)(spanCtx, []redis.Cmder{
+		redis.NewStatusCmd(ctx, "set", "quote:v1:zone-1:0:STANDARD", "{}", "ex", int64(time.Minute/time.Second)),
+		redis.NewBoolCmd(ctx, "setnx", "idempotency:default:order-1", "AB-1"),
+		redis.NewStringCmd(ctx, "get", "quote:v1:zone-2:1:EXPRESS"),
+		redis.NewStatusCmd(ctx, "ping"),
+	})
+	span.End()
+
+	spans := rec.Ended()
+	command, pipeline := attribute.NewSet(spans[0].Attributes()...), attribute.NewSet(spans[1].Attributes()...)
+	if v, _ := command.Value("db.redis.key_pattern"); v.AsString() != "quote-id:*" {
+		t.Errorf("TestKeyPatternHook: command key pattern is %q, want quote-id:*", v.AsString())
+	}
+	v, _ := pipeline.Value("db.redis.key_patterns")
+	if got := v.AsStringSlice(); len(got) != 2 || got[0] != "idempotency:*" || got[1] != "quote:*" {
+		t.Errorf("TestKeyPatternHook: pipeline key patterns are %v, want [idempotency:* quote:*]", got)
+	}
+	if p := redisKeyPattern(redis.NewStatusCmd(ctx, "auth", "user:secret")); p != "" {
+		t.Errorf("TestKeyPatternHook: AUTH has key pattern %q", p)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// ShipmentRepository persists shipments, their history and the outbox of
+// their events. It does not enforce the state machine, which is the job of
+// the shipmentStore in front of it, but it writes a change, its history entry
+// and its outbox record together or not at all.
+type ShipmentRepository interface {
+	// insert adds a new shipment with the first entry of its history and
+	// the outbox record of its creation. If quota is positive, it fails with
+	// errQuotaExceeded instead if the tenant already has that many live
+	// shipments, counted in the same step as the insert.
+	insert(ctx context.Context, sh shipment, e historyEntry, rec outboxRecord, quota int) error
+	// get returns the tenant's shipment, or errShipmentNotFound.
+	get(ctx context.Context, tenant, id string) (shipment, error)
+	// update saves the new status of a shipment that was in status from,
+	// with the history entry and outbox record of the change. It fails with
+	// errInvalidTransition if the shipment has changed since.
+	update(ctx context.Context, sh shipment, from pb.ShipmentStatus, e historyEntry, rec outboxRecord) error
+	// setLabel keeps the rendered label of the tenant's shipment.
+	setLabel(ctx context.Context, tenant, id string, label []byte) error
+	// live returns the number of shipments of tenant not yet finished.
+	live(ctx context.Context, tenant string) (int, error)
+	// due returns the shipments that have been in their status for at least
+	// the time given for it in after, oldest first.
+	due(ctx context.Context, now time.Time, after map[pb.ShipmentStatus]time.Duration) ([]shipment, error)
+	// history returns the history of the tenant's shipment, oldest first,
+	// or errShipmentNotFound.
+	history(ctx context.Context, tenant, id string) ([]historyEntry, error)
+	// purge removes the finished shipments that the policy no longer keeps,
+	// along with their history.
+	purge(ctx context.Context, now time.Time, policy retentionPolicy) (purgeResult, error)
+	// pendingEvents returns up to limit unpublished outbox records, oldest
+	// first.
+	pendingEvents(ctx context.Context, limit int) ([]outboxRecord, error)
+	// markPublished removes the outbox record seq once the relay has
+	// published it.
+	markPublished(ctx context.Context, seq int64) error
+}
+
+// QuoteRepository keeps issued quotes until they expire.
+type QuoteRepository interface {
+	issue(ctx context.Context, q issuedQuote) error
+	// lookup returns the quote with the given ID, or false if it does not
+	// exist or has expired.
+	lookup(ctx context.Context, id string) (issuedQuote, bool, error)
+	// deleteExpired removes the quotes that expired by now and returns how
+	// many there were.
+	deleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// storageFromEnv opens the database that STORAGE_BACKEND selects: none for
+// memory, or the one at DATABASE_URL for sqlite and postgres. Without
+// STORAGE_BACKEND, the backend is the dialect of DATABASE_URL if it is set.
+func storageFromEnv() *database {
+	url := os.Getenv("DATABASE_URL")
+	backend := os.Getenv("STORAGE_BACKEND")
+	switch backend {
+	case "":
+		if url == "" {
+			return nil
+		}
+	case "memory":
+		return nil
+	case dialectSQLite:
+		if url == "" {
+			url = defaultSQLiteURL
+		}
+	case dialectPostgres:
+		if url == "" {
+			log.Fatal("STORAGE_BACKEND=postgres needs DATABASE_URL")
+		}
+	default:
+		log.Fatalf("unknown STORAGE_BACKEND %q", backend)
+	}
+	db, err := openDatabase(url)
+	if err != nil {
+		log.WithError(err).Fatal("failed to open database")
+	}
+	if backend != "" && backend != db.dialect {
+		log.Fatalf("STORAGE_BACKEND is %s but DATABASE_URL is a %s database", backend, db.dialect)
+	}
+	log.Infof("keeping shipments and quotes in the %s database at %s", db.dialect, db.target)
+	return db
+}
+
+// memoryShipmentRepository keeps shipments in process memory, so they are
+// lost on restart and not shared between replicas.
+type memoryShipmentRepository struct {
+	mu        sync.Mutex
+	shipments map[string]map[string]*shipment // by tenant, then tracking ID
+	events    shipmentHistory
+	outbox    outbox
+	// liveCount counts the live shipments of each tenant, which ShipOrder checks
+	// on every call.
+	liveCount map[string]int
+}
+
+func newMemoryShipmentRepository() *memoryShipmentRepository {
+	return &memoryShipmentRepository{shipments: make(map[string]map[string]*shipment), liveCount: make(map[string]int)}
+}
+
+func (r *memoryShipmentRepository) insert(_ context.Context, sh shipment, e historyEntry, rec outboxRecord, quota int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if quota > 0 && r.liveCount[sh.Tenant] >= quota {
+		return errQuotaExceeded
+	}
+	if r.shipments[sh.Tenant] == nil {
+		r.shipments[sh.Tenant] = make(map[string]*shipment)
+	}
+	r.shipments[sh.Tenant][sh.TrackingID] = &sh
+	if len(transitions[sh.Status]) > 0 {
+		r.liveCount[sh.Tenant]++
+	}
+	r.events.append(sh.Tenant, sh.TrackingID, e)
+	r.outbox.append(rec)
+	return nil
+}
+
+func (r *memoryShipmentRepository) get(_ context.Context, tenant, id string) (shipment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sh, ok := r.shipments[tenant][id]
+	if !ok {
+		return shipment{}, errShipmentNotFound
+	}
+	return *sh, nil
+}
+
+func (r *memoryShipmentRepository) update(_ context.Context, sh shipment, from pb.ShipmentStatus, e historyEntry, rec outboxRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur, ok := r.shipments[sh.Tenant][sh.TrackingID]
+	if !ok {
+		return errShipmentNotFound
+	}
+	if cur.Status != from {
+		return fmt.Errorf("%w: %s changed to %s", errInvalidTransition, sh.TrackingID, cur.Status)
+	}
+	if len(transitions[from]) > 0 && len(transitions[sh.Status]) == 0 {
+		r.liveCount[sh.Tenant]--
+	}
+	cur.Status, cur.UpdatedAt = sh.Status, sh.UpdatedAt
+	r.events.append(sh.Tenant, sh.TrackingID, e)
+	r.outbox.append(rec)
+	return nil
+}
+
+func (r *memoryShipmentRepository) setLabel(_ context.Context, tenant, id string, label []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sh, ok := r.shipments[tenant][id]
+	if !ok {
+		return errShipmentNotFound
+	}
+	sh.Label = label
+	return nil
+}
+
+func (r *memoryShipmentRepository) live(_ context.Context, tenant string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.liveCount[tenant], nil
+}
+
+func (r *memoryShipmentRepository) due(_ context.Context, now time.Time, after map[pb.ShipmentStatus]time.Duration) ([]shipment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []shipment
+	for _, byID := range r.shipments {
+		for _, sh := range byID {
+			if d, ok := after[sh.Status]; ok && !now.Before(sh.UpdatedAt.Add(d)) {
+				out = append(out, *sh)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.Before(out[j].UpdatedAt) })
+	return out, nil
+}
+
+func (r *memoryShipmentRepository) history(_ context.Context, tenant, id string) ([]historyEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.events.get(tenant, id)
+	if entries == nil {
+		return nil, errShipmentNotFound
+	}
+	return entries, nil
+}
+
+func (r *memoryShipmentRepository) purge(_ context.Context, now time.Time, policy retentionPolicy) (purgeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res purgeResult
+	for tenant, byID := range r.shipments {
+		for id, sh := range byID {
+			cutoff, ok := policy.cutoff(sh.Status, now)
+			if !ok || len(transitions[sh.Status]) > 0 || !sh.UpdatedAt.Before(cutoff) {
+				continue
+			}
+			delete(byID, id)
+			res.events += r.events.remove(tenant, id)
+			if sh.Status == pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED {
+				res.delivered++
+			} else {
+				res.cancelled++
+			}
+		}
+		if len(byID) == 0 {
+			delete(r.shipments, tenant)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryShipmentRepository) pendingEvents(_ context.Context, limit int) ([]outboxRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.outbox.pending(limit), nil
+}
+
+func (r *memoryShipmentRepository) markPublished(_ context.Context, seq int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outbox.ack(seq)
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// migratedSQLite returns a new SQLite database with the latest schema.
+func migratedSQLite(t *testing.T) *database {
+	db, err := openDatabase("sqlite://" + filepath.Join(t.TempDir(), "shipping.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := newMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestShipmentRepositories checks that the in-memory and SQL repositories
+// behave the same behind a shipment store.
+func TestShipmentRepositories(t *testing.T) {
+	for name, repo := range map[string]func(t *testing.T) ShipmentRepository{
+		"memory": func(*testing.T) ShipmentRepository { return newMemoryShipmentRepository() },
+		"sqlite": func(t *testing.T) ShipmentRepository { return newSQLShipmentRepository(migratedSQLite(t)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			st := newShipmentStore(repo(t))
+			origin := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}, TraceFlags: trace.FlagsSampled})
+			ctx := trace.ContextWithSpanContext(context.Background(), origin)
+			address := &pb.Address{City: "Mountain View", ZipCode: 94043}
+			items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}}
+			if _, err := st.create(ctx, defaultTenant, "AB-1", address, items, 0); err != nil {
+				t.Fatalf("TestShipmentRepositories: %v", err)
+			}
+			st.create(ctx, defaultTenant, "AB-2", address, nil, 0)
+			st.create(ctx, "team-a", "AB-3", address, nil, 0)
+
+			sh, err := st.get(ctx, defaultTenant, "AB-1")
+			if err != nil || sh.Address.City != "Mountain View" || len(sh.Items) != 1 || sh.Items[0].Quantity != 2 ||
+				sh.Origin.TraceID() != origin.TraceID() || sh.Origin.SpanID() != origin.SpanID() {
+				t.Errorf("TestShipmentRepositories: got %+v (%v)", sh, err)
+			}
+			if _, err := st.get(ctx, "team-a", "AB-1"); !errors.Is(err, errShipmentNotFound) {
+				t.Errorf("TestShipmentRepositories: another tenant's shipment returned %v", err)
+			}
+			if err := st.attachLabel(ctx, defaultTenant, "AB-1", []byte("label")); err != nil {
+				t.Errorf("TestShipmentRepositories: attachLabel: %v", err)
+			}
+			if sh, _ := st.get(ctx, defaultTenant, "AB-1"); string(sh.Label) != "label" {
+				t.Errorf("TestShipmentRepositories: label is %q", sh.Label)
+			}
+
+			if _, err := st.transition(ctx, defaultTenant, "AB-1", pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT); err != nil {
+				t.Fatalf("TestShipmentRepositories: %v", err)
+			}
+			if _, err := st.transition(ctx, defaultTenant, "AB-2", pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED); err != nil {
+				t.Fatalf("TestShipmentRepositories: %v", err)
+			}
+			if _, err := st.transition(ctx, defaultTenant, "AB-2", pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT); !errors.Is(err, errInvalidTransition) {
+				t.Errorf("TestShipmentRepositories: invalid transition returned %v", err)
+			}
+			if n, err := st.live(ctx, defaultTenant); err != nil || n != 1 {
+				t.Errorf("TestShipmentRepositories: %d live shipments (%v), want 1", n, err)
+			}
+			entries, err := st.history(ctx, defaultTenant, "AB-1")
+			if err != nil || len(entries) != 2 || entries[1].Seq != 2 || entries[1].To != pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT ||
+				entries[0].TraceID != origin.TraceID() {
+				t.Errorf("TestShipmentRepositories: history %+v (%v)", entries, err)
+			}
+
+			due, err := st.due(ctx, time.Now().Add(time.Minute), map[pb.ShipmentStatus]time.Duration{
+				pb.ShipmentStatus_SHIPMENT_STATUS_CREATED:    0,
+				pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT: time.Hour,
+			})
+			if err != nil || len(due) != 1 || due[0].TrackingID != "AB-3" {
+				t.Errorf("TestShipmentRepositories: due %+v (%v), want AB-3", due, err)
+			}
+
+			res, err := st.purgeFinished(ctx, time.Now().Add(time.Minute), retentionPolicy{})
+			if err != nil || res.cancelled != 1 || res.delivered != 0 || res.events != 2 {
+				t.Errorf("TestShipmentRepositories: purged %+v (%v), want AB-2 and its 2 events", res, err)
+			}
+			if _, err := st.history(ctx, defaultTenant, "AB-2"); !errors.Is(err, errShipmentNotFound) {
+				t.Errorf("TestShipmentRepositories: purged history returned %v", err)
+			}
+			events, err := st.pendingEvents(ctx, 10)
+			if err != nil || len(events) != 5 {
+				t.Fatalf("TestShipmentRepositories: %d outbox events (%v), want 5", len(events), err)
+			}
+			if ev := events[0].Event; ev.Type != eventShipmentCreated || ev.TrackingID != "AB-1" || events[2].Event.Tenant != "team-a" ||
+				events[4].Event.Status != pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED.String() {
+				t.Errorf("TestShipmentRepositories: outbox events %+v", events)
+			}
+			if err := st.markPublished(ctx, events[0].Seq); err != nil {
+				t.Errorf("TestShipmentRepositories: markPublished: %v", err)
+			}
+			if events, _ := st.pendingEvents(ctx, 10); len(events) != 4 || events[0].Event.TrackingID != "AB-2" {
+				t.Errorf("TestShipmentRepositories: outbox events %+v after publishing the first, want the other 4", events)
+			}
+
+			// Concurrent orders of a tenant cannot get in under its quota
+			// together.
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			created, exceeded := 0, 0
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, err := st.create(ctx, "team-b", fmt.Sprintf("AB-Q%d", i), address, nil, 3)
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == nil:
+						created++
+					case errors.Is(err, errQuotaExceeded):
+						exceeded++
+					default:
+						t.Errorf("TestShipmentRepositories: create under quota: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			if created != 3 || exceeded != 5 {
+				t.Errorf("TestShipmentRepositories: %d created and %d over quota, want 3 and 5", created, exceeded)
+			}
+			if n, err := st.live(ctx, "team-b"); err != nil || n != 3 {
+				t.Errorf("TestShipmentRepositories: %d live shipments of team-b (%v), want 3", n, err)
+			}
+		})
+	}
+}
+
+// TestSQLQuoteRepository checks that quotes are found until they expire and
+// then deleted.
+func TestSQLQuoteRepository(t *testing.T) {
+	r := quoteRepositoryFromEnv(nil, migratedSQLite(t))
+	ctx := context.Background()
+	q := issuedQuote{ID: "q-1", Price: Quote{Dollars: 8, Cents: 99}, Zone: 2, WeightBucket: 3,
+		Method: pb.ShippingMethod_SHIPPING_METHOD_EXPRESS, Options: shippingOptions{DeclaredCents: 12000, Insured: true},
+		Pricing: "digest", Expires: time.Now().Add(time.Minute)}
+	if err := r.issue(ctx, q); err != nil {
+		t.Fatalf("TestSQLQuoteRepository: %v", err)
+	}
+	r.issue(ctx, issuedQuote{ID: "q-2", Expires: time.Now().Add(-time.Minute)})
+
+	got, ok, err := r.lookup(ctx, "q-1")
+	if err != nil || !ok || got.Price != q.Price || got.Zone != q.Zone || got.WeightBucket != 3 || got.Method != q.Method || got.Options != q.Options || got.Pricing != q.Pricing {
+		t.Errorf("TestSQLQuoteRepository: lookup returned %+v, %v (%v)", got, ok, err)
+	}
+	if _, ok, _ := r.lookup(ctx, "q-2"); ok {
+		t.Error("TestSQLQuoteRepository: expired quote found")
+	}
+	if n, err := r.deleteExpired(ctx, time.Now()); err != nil || n != 1 {
+		t.Errorf("TestSQLQuoteRepository: deleted %d quotes (%v), want 1", n, err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// retentionPolicy is how long finished shipments are kept, by the status they
+// finished in. Their history goes with them.
+type retentionPolicy struct {
+	delivered time.Duration
+	cancelled time.Duration
+}
+
+// retentionPolicyFromEnv reads SHIPMENT_RETENTION_DELIVERED and
+// SHIPMENT_RETENTION_CANCELLED, both defaulting to SHIPMENT_RETENTION.
+func retentionPolicyFromEnv() retentionPolicy {
+	def := envDuration("SHIPMENT_RETENTION", defaultShipmentRetention)
+	return retentionPolicy{
+		delivered: envDuration("SHIPMENT_RETENTION_DELIVERED", def),
+		cancelled: envDuration("SHIPMENT_RETENTION_CANCELLED", def),
+	}
+}
+
+// cutoff returns the time before which a shipment finished in the given
+// status is removed, or false if shipments in that status are kept.
+func (p retentionPolicy) cutoff(status pb.ShipmentStatus, now time.Time) (time.Time, bool) {
+	switch status {
+	case pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED:
+		return now.Add(-p.delivered), true
+	case pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED:
+		return now.Add(-p.cancelled), true
+	}
+	return time.Time{}, false
+}
+
+// purgeResult counts what a retention run removed.
+type purgeResult struct {
+	delivered, cancelled int
+	events               int
+}
+
+func (r purgeResult) shipments() int { return r.delivered + r.cancelled }
+
+// retentionMetrics counts the records removed by maintenance jobs, by job and
+// kind of record.
+type retentionMetrics struct {
+	deleted metric.Int64Counter
+}
+
+func newRetentionMetrics() *retentionMetrics {
+	m := &retentionMetrics{}
+	var err error
+	if m.deleted, err = meter.Int64Counter("shipping.retention.deleted",
+		metric.WithDescription("Records removed by maintenance jobs, by job and kind of record."),
+		metric.WithUnit("{record}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create retention metric")
+	}
+	return m
+}
+
+// record counts n records of a kind removed by a job, and returns the span
+// attribute reporting them.
+func (m *retentionMetrics) record(ctx context.Context, job, kind string, n int, attrs ...attribute.KeyValue) attribute.KeyValue {
+	if m.deleted != nil && n > 0 {
+		attrs = append(attrs, attribute.String("cron.job", job), attribute.String("retention.kind", kind))
+		m.deleted.Add(ctx, int64(n), metric.WithAttributes(attrs...))
+	}
+	return attribute.Int(kind+".purged", n)
+}
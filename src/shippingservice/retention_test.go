@@ -0,0 +1,87 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestShipmentRetention checks that delivered and cancelled shipments are
+// kept for their own retention periods, and that what is removed is counted.
+func TestShipmentRetention(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	saved := meter
+	meter = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(serviceName)
+	defer func() { meter = saved }()
+
+	ctx := context.Background()
+	svc := newServer()
+	for _, id := range []string{"AB-1", "AB-2", "AB-3"} {
+		svc.shipments.create(ctx, defaultTenant, id, &pb.Address{}, nil, 0)
+	}
+	svc.shipments.transition(ctx, defaultTenant, "AB-1", pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT)
+	svc.shipments.transition(ctx, defaultTenant, "AB-1", pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED)
+	svc.shipments.transition(ctx, defaultTenant, "AB-2", pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED)
+
+	t.Setenv("SHIPMENT_RETENTION_DELIVERED", "1h")
+	t.Setenv("SHIPMENT_RETENTION_CANCELLED", "0s")
+	var retention cronJob
+	for _, j := range maintenanceScheduler(svc).jobs {
+		if j.name == "shipments.retention" {
+			retention = j
+		}
+	}
+	if _, err := retention.run(ctx); err != nil {
+		t.Fatalf("TestShipmentRetention: %v", err)
+	}
+	if _, err := svc.shipments.get(ctx, defaultTenant, "AB-2"); err == nil {
+		t.Error("TestShipmentRetention: cancelled shipment was kept")
+	}
+	for _, id := range []string{"AB-1", "AB-3"} {
+		if _, err := svc.shipments.get(ctx, defaultTenant, id); err != nil {
+			t.Errorf("TestShipmentRetention: shipment %s was removed", id)
+		}
+	}
+	res, _ := svc.shipments.purgeFinished(ctx, time.Now().Add(2*time.Hour), retentionPolicyFromEnv())
+	if res.delivered != 1 || res.cancelled != 0 || res.events != 3 {
+		t.Errorf("TestShipmentRetention: later run removed %+v, want the delivered shipment and its 3 events", res)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("TestShipmentRetention: %v", err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if data, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == "shipping.retention.deleted" {
+				for _, dp := range data.DataPoints {
+					kind, _ := dp.Attributes.Value("retention.kind")
+					got[kind.AsString()] += dp.Value
+				}
+			}
+		}
+	}
+	if got["shipments"] != 1 || got["shipment_events"] != 2 {
+		t.Errorf("TestShipmentRetention: counted %v, want 1 shipment and 2 events", got)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errRetryableStatus = errors.New("retryable HTTP status")
+
+// retryPolicy controls how failed downstream calls are retried. The
+// notification and webhook workers use its attempts and backoff for their
+// own retry loops, without a budget.
+type retryPolicy struct {
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	budget      *retryBudget
+}
+
+func retryPolicyFromEnv() retryPolicy {
+	return retryPolicy{
+		maxAttempts: envInt("DOWNSTREAM_MAX_ATTEMPTS", 3),
+		baseBackoff: 50 * time.Millisecond,
+		maxBackoff:  time.Second,
+		budget:      newRetryBudget(envFloat("DOWNSTREAM_RETRY_RATIO", 0.1), 10),
+	}
+}
+
+// backoff returns the full-jitter delay before the given retry (1-based).
+func (p retryPolicy) backoff(retry int) time.Duration {
+	d := p.baseBackoff << uint(retry-1)
+	if d <= 0 || d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	return jitter(d)
+}
+
+// retryBudget caps retries at a fraction of recent requests, so that when a
+// dependency is struggling retries cannot multiply its load. Each request
+// earns ratio tokens and each retry spends one; minPerSecond tokens are added
+// every second so that a quiet client can still retry.
+type retryBudget struct {
+	ratio        float64
+	minPerSecond float64
+	maxTokens    float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRetryBudget(ratio, minPerSecond float64) *retryBudget {
+	return &retryBudget{ratio: ratio, minPerSecond: minPerSecond, maxTokens: 10 * minPerSecond, tokens: minPerSecond, last: time.Now()}
+}
+
+func (b *retryBudget) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.minPerSecond
+	b.last = now
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// request records a first attempt.
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// withdraw reports whether a retry fits in the budget, spending a token if so.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retry runs call up to maxAttempts times while retryable reports that its
+// error is worth retrying and the budget allows. Each retry is recorded as a
+// span event with the attempt number and the delay before it.
+func (p retryPolicy) retry(ctx context.Context, call func(attempt int) error, retryable func(error) bool) error {
+	span := trace.SpanFromContext(ctx)
+	p.budget.request()
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = call(attempt); err == nil || !retryable(err) || attempt >= p.maxAttempts {
+			break
+		}
+		if !p.budget.withdraw() {
+			span.AddEvent("retry.budget_exhausted", trace.WithAttributes(attribute.Int("retry.attempt", attempt)))
+			break
+		}
+		delay := p.backoff(attempt)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("retry.attempt", attempt+1),
+			attribute.String("retry.delay", delay.String()),
+			attribute.String("error", err.Error()),
+		))
+		if sleepContext(ctx, delay) != nil {
+			break
+		}
+	}
+	return err
+}
+
+// retryTransport retries idempotent HTTP requests (GET, HEAD, OPTIONS, PUT
+// and DELETE, or any request with an Idempotency-Key header) that fail with a
+// transport error or a 502, 503 or 504.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy retryPolicy
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req) || (req.Body != nil && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+	var resp *http.Response
+	err := t.policy.retry(req.Context(), func(attempt int) error {
+		r := req
+		if attempt > 1 {
+			if resp != nil {
+				// The previous response is being discarded for a retry.
+				resp.Body.Close()
+			}
+			r = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return err
+				}
+				r.Body = body
+			}
+			r.Header.Set("Retry-Attempt", strconv.Itoa(attempt))
+		}
+		var err error
+		resp, err = t.next.RoundTrip(r)
+		if err == nil && retryableStatus(resp.StatusCode) {
+			return errRetryableStatus
+		}
+		return err
+	}, func(err error) bool { return true })
+	if err == errRetryableStatus {
+		err = nil
+	}
+	return resp, err
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// newDownstreamHTTPClient returns an HTTP client for calls to other services.
+// Each attempt is traced, requests to a failing host are cut off by a circuit
+// breaker, and idempotent requests are retried within the retry budget.
+func newDownstreamHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: retryTransport{
+			next:   otelhttp.NewTransport(newBreakerTransport(http.DefaultTransport)),
+			policy: retryPolicyFromEnv(),
+		},
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testRetryPolicy(tokens float64) retryPolicy {
+	b := newRetryBudget(0, 0)
+	b.maxTokens, b.tokens = tokens, tokens
+	return retryPolicy{maxAttempts: 3, baseBackoff: time.Millisecond, maxBackoff: time.Millisecond, budget: b}
+}
+
+// TestRetryBudget checks that retries stop once the budget is spent.
+func TestRetryBudget(t *testing.T) {
+	p := testRetryPolicy(1)
+	calls := 0
+	p.retry(context.Background(), func(int) error {
+		calls++
+		return status.Error(codes.Unavailable, "down")
+	}, func(error) bool { return true })
+	if calls != 2 {
+		t.Errorf("TestRetryBudget: made %d attempts with one retry token, expected 2", calls)
+	}
+}
+
+// TestRetryTransport checks that idempotent HTTP requests are retried on 503 and POSTs are not.
+func TestRetryTransport(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: retryTransport{next: http.DefaultTransport, policy: testRetryPolicy(10)}}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("TestRetryTransport: got %v, %v, expected 200 after a retry", resp, err)
+	}
+	resp.Body.Close()
+
+	atomic.StoreInt32(&hits, 0)
+	resp, err = client.Post(srv.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("TestRetryTransport: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("TestRetryTransport: POST was retried")
+	}
+}
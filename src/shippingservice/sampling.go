@@ -0,0 +1,255 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// debugTraceHeader is the request metadata key that forces a trace to be
+// sampled, e.g. "x-debug-trace: true".
+const debugTraceHeader = "x-debug-trace"
+
+// ratioSampler samples a fraction of new traces and follows the caller's
+// decision for the rest, like the SDK's parentbased_traceidratio sampler, but
+// its ratio can be changed while the service runs.
+type ratioSampler struct {
+	current atomic.Pointer[sdktrace.Sampler]
+	value   atomic.Uint64 // the ratio, as float64 bits
+}
+
+func newRatioSampler(ratio float64) *ratioSampler {
+	s := &ratioSampler{}
+	s.setRatio(ratio)
+	return s
+}
+
+// ratioSamplerFromEnv starts at OTEL_TRACES_SAMPLER_ARG, which defaults to
+// sampling every trace.
+func ratioSamplerFromEnv() *ratioSampler {
+	ratio := envFloat("OTEL_TRACES_SAMPLER_ARG", 1)
+	if ratio < 0 || ratio > 1 {
+		log.Fatalf("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1, got %v", ratio)
+	}
+	return newRatioSampler(ratio)
+}
+
+func (s *ratioSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return (*s.current.Load()).ShouldSample(p)
+}
+
+func (s *ratioSampler) Description() string {
+	return fmt.Sprintf("ParentBased{root:TraceIDRatioBased{%g}}", s.ratio())
+}
+
+func (s *ratioSampler) ratio() float64 {
+	return math.Float64frombits(s.value.Load())
+}
+
+func (s *ratioSampler) setRatio(ratio float64) {
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	s.current.Store(&sampler)
+	s.value.Store(math.Float64bits(ratio))
+}
+
+// debugSampler samples every request that carries debugTraceHeader, whatever
+// next and the caller decided, and marks its span with debug=true. This lets
+// attendees capture their own requests even when the sampling ratio is low.
+type debugSampler struct {
+	next sdktrace.Sampler
+}
+
+func newDebugSampler(next sdktrace.Sampler) sdktrace.Sampler {
+	return debugSampler{next: next}
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if !debugRequested(p) {
+		return s.next.ShouldSample(p)
+	}
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Attributes: []attribute.KeyValue{attribute.Bool("debug", true)},
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s debugSampler) Description() string {
+	return fmt.Sprintf("Debug{%s}", s.next.Description())
+}
+
+// debugRequested reports whether p is for the server span of a request with
+// a true debugTraceHeader. The gRPC server adds the request metadata to the
+// context before its span is started.
+func debugRequested(p sdktrace.SamplingParameters) bool {
+	if p.Kind != trace.SpanKindServer {
+		return false
+	}
+	md, _ := metadata.FromIncomingContext(p.ParentContext)
+	for _, v := range md.Get(debugTraceHeader) {
+		// Any value turns debugging on, except an explicit false.
+		if on, err := strconv.ParseBool(v); v != "" && (on || err != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// healthCheckTelemetry reports whether HEALTH_CHECK_TELEMETRY asks for health
+// checks to be traced and access logged. They are not by default: kubelet
+// probes every few seconds, and its calls drown out the interesting ones.
+func healthCheckTelemetry() bool {
+	return envBool("HEALTH_CHECK_TELEMETRY", false)
+}
+
+// isHealthCheck reports whether a full method or span name is a call of the
+// gRPC health service.
+func isHealthCheck(name string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(name, "/"), "grpc.health.v1.Health/")
+}
+
+// healthCheckSampler drops the spans of health checks, made by kubelet or
+// by the client-side health checking of the services calling this one, and
+// leaves every other decision to next. Work done on behalf of a health check, such
+// as the probes of dependencies it triggers, is dropped along with it.
+type healthCheckSampler struct {
+	next sdktrace.Sampler
+}
+
+// healthCheckSamplerFromEnv wraps next in a healthCheckSampler, unless
+// HEALTH_CHECK_TELEMETRY is true.
+func healthCheckSamplerFromEnv(next sdktrace.Sampler) sdktrace.Sampler {
+	if healthCheckTelemetry() {
+		return next
+	}
+	return healthCheckSampler{next: next}
+}
+
+func (s healthCheckSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if isHealthCheck(p.Name) {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.Drop,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s healthCheckSampler) Description() string {
+	return fmt.Sprintf("DropHealthChecks{%s}", s.next.Description())
+}
+
+// Baggage members that steer sampling, set by a caller such as the load
+// generator for its synthetic users.
+const (
+	samplingPriorityBaggageKey = "sampling.priority"
+	customerTierBaggageKey     = "customer.tier"
+)
+
+// baggageSampler lets the baggage of a request decide whether its trace is
+// sampled where it enters the service, so that a load generator can have
+// the traces of chosen users kept or dropped:
+//
+//   - sampling.priority=0 drops the trace, and any higher priority keeps it;
+//   - otherwise a customer.tier with a ratio in tiers samples that fraction
+//     of the tier's traces.
+//
+// Tier decisions are taken from the trace ID, like the SDK's ratio sampler,
+// so every service with the same ratios agrees on them, and the trace stays
+// whole whichever service is its head. Spans with a local parent, and
+// requests without either member, are left to next.
+type baggageSampler struct {
+	next  sdktrace.Sampler
+	tiers map[string]sdktrace.Sampler
+}
+
+// parseTierRatios parses a comma-separated list of tier=ratio pairs, e.g.
+// "gold=1,free=0.01".
+func parseTierRatios(s string) (map[string]float64, error) {
+	ratios := make(map[string]float64)
+	for _, kv := range splitList(s) {
+		tier, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not of the form tier=ratio", kv)
+		}
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("ratio of tier %q must be between 0 and 1, got %q", tier, v)
+		}
+		ratios[strings.TrimSpace(tier)] = ratio
+	}
+	return ratios, nil
+}
+
+func newBaggageSampler(next sdktrace.Sampler, ratios map[string]float64) sdktrace.Sampler {
+	s := baggageSampler{next: next, tiers: make(map[string]sdktrace.Sampler, len(ratios))}
+	for tier, ratio := range ratios {
+		s.tiers[tier] = sdktrace.TraceIDRatioBased(ratio)
+	}
+	return s
+}
+
+// baggageSamplerFromEnv wraps next in a baggageSampler with the
+// SAMPLING_TIER_RATIOS.
+func baggageSamplerFromEnv(next sdktrace.Sampler) sdktrace.Sampler {
+	ratios, err := parseTierRatios(os.Getenv("SAMPLING_TIER_RATIOS"))
+	if err != nil {
+		log.Fatalf("invalid SAMPLING_TIER_RATIOS: %v", err)
+	}
+	return newBaggageSampler(next, ratios)
+}
+
+func (s baggageSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if parent.IsValid() && !parent.IsRemote() {
+		return s.next.ShouldSample(p)
+	}
+	bag := baggage.FromContext(p.ParentContext)
+	if v := bag.Member(samplingPriorityBaggageKey).Value(); v != "" {
+		if priority, err := strconv.Atoi(v); err == nil {
+			decision := sdktrace.RecordAndSample
+			if priority <= 0 {
+				decision = sdktrace.Drop
+			}
+			return sdktrace.SamplingResult{
+				Decision:   decision,
+				Attributes: []attribute.KeyValue{attribute.Int(samplingPriorityBaggageKey, priority)},
+				Tracestate: parent.TraceState(),
+			}
+		}
+	}
+	tier := bag.Member(customerTierBaggageKey).Value()
+	if sampler, ok := s.tiers[tier]; ok {
+		res := sampler.ShouldSample(p)
+		res.Attributes = append(res.Attributes, attribute.String(customerTierBaggageKey, tier))
+		return res
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s baggageSampler) Description() string {
+	return fmt.Sprintf("Baggage{%s}", s.next.Description())
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestRatioSampler checks that the ratio applies to new traces only and can be changed.
+func TestRatioSampler(t *testing.T) {
+	s := newRatioSampler(0)
+	root := sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: trace.TraceID{0xff}}
+	if d := s.ShouldSample(root).Decision; d != sdktrace.Drop {
+		t.Errorf("TestRatioSampler: ratio 0 returned %v for a new trace", d)
+	}
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0xff},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	child := root
+	child.ParentContext = trace.ContextWithRemoteSpanContext(context.Background(), parent)
+	if d := s.ShouldSample(child).Decision; d != sdktrace.RecordAndSample {
+		t.Errorf("TestRatioSampler: returned %v for a sampled parent", d)
+	}
+
+	s.setRatio(1)
+	if d := s.ShouldSample(root).Decision; d != sdktrace.RecordAndSample || s.ratio() != 1 {
+		t.Errorf("TestRatioSampler: ratio 1 returned %v for a new trace", d)
+	}
+}
+
+// TestDebugTraceHeader checks that x-debug-trace forces a request's trace to be sampled.
+func TestDebugTraceHeader(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(newDebugSampler(newRatioSampler(0))), sdktrace.WithSpanProcessor(rec))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tp))))
+	pb.RegisterShippingServiceServer(srv, newServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := pb.NewShippingServiceClient(cc)
+
+	req := &pb.GetQuoteRequest{Address: &pb.Address{State: "CA", Country: "USA", ZipCode: 94043}}
+	for _, v := range []string{"", "false", "true", "1"} {
+		ctx := context.Background()
+		if v != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, debugTraceHeader, v)
+		}
+		if _, err := client.GetQuote(ctx, req); err != nil {
+			t.Fatalf("TestDebugTraceHeader: %v", err)
+		}
+	}
+	srv.GracefulStop()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("TestDebugTraceHeader: got %d sampled spans, expected 2 for true and 1", len(spans))
+	}
+	for _, s := range spans {
+		debug := false
+		for _, kv := range s.Attributes() {
+			debug = debug || kv == attribute.Bool("debug", true)
+		}
+		if !debug {
+			t.Errorf("TestDebugTraceHeader: span %s has no debug=true attribute", s.Name())
+		}
+	}
+}
+
+// TestHealthCheckSampler checks that health checks are not traced unless
+// HEALTH_CHECK_TELEMETRY is set, while other calls are.
+func TestHealthCheckSampler(t *testing.T) {
+	for _, tc := range []struct {
+		env  string
+		name string
+		want sdktrace.SamplingDecision
+	}{
+		{"", "grpc.health.v1.Health/Check", sdktrace.Drop},
+		{"", "grpc.health.v1.Health/Watch", sdktrace.Drop},
+		{"", "hipstershop.ShippingService/GetQuote", sdktrace.RecordAndSample},
+		{"true", "grpc.health.v1.Health/Check", sdktrace.RecordAndSample},
+	} {
+		t.Setenv("HEALTH_CHECK_TELEMETRY", tc.env)
+		s := healthCheckSamplerFromEnv(newRatioSampler(1))
+		p := sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: trace.TraceID{1}, Name: tc.name, Kind: trace.SpanKindServer}
+		if d := s.ShouldSample(p).Decision; d != tc.want {
+			t.Errorf("TestHealthCheckSampler: HEALTH_CHECK_TELEMETRY=%q: %s was %v, want %v", tc.env, tc.name, d, tc.want)
+		}
+	}
+
+	// A health check asking for a debug trace gets it.
+	t.Setenv("HEALTH_CHECK_TELEMETRY", "")
+	s := newDebugSampler(healthCheckSamplerFromEnv(newRatioSampler(1)))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(debugTraceHeader, "true"))
+	p := sdktrace.SamplingParameters{ParentContext: ctx, TraceID: trace.TraceID{1}, Name: "grpc.health.v1.Health/Check", Kind: trace.SpanKindServer}
+	if d := s.ShouldSample(p).Decision; d != sdktrace.RecordAndSample {
+		t.Errorf("TestHealthCheckSampler: debug health check was %v", d)
+	}
+}
+
+// TestBaggageSampler checks that sampling.priority and customer.tier baggage
+// decide where a trace enters the service, and only there.
+func TestBaggageSampler(t *testing.T) {
+	ratios, err := parseTierRatios("gold=1, free=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newBaggageSampler(newRatioSampler(0), ratios)
+	sampledParent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0xff}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled, Remote: true,
+	})
+	for _, tc := range []struct {
+		baggage string
+		parent  trace.SpanContext
+		want    sdktrace.SamplingDecision
+	}{
+		{"", trace.SpanContext{}, sdktrace.Drop},
+		{"sampling.priority=1", trace.SpanContext{}, sdktrace.RecordAndSample},
+		{"sampling.priority=0", sampledParent, sdktrace.Drop},
+		{"sampling.priority=0,customer.tier=gold", trace.SpanContext{}, sdktrace.Drop},
+		{"customer.tier=gold", trace.SpanContext{}, sdktrace.RecordAndSample},
+		{"customer.tier=free", sampledParent, sdktrace.Drop},
+		{"customer.tier=silver", sampledParent, sdktrace.RecordAndSample},
+		// A local parent has already decided.
+		{"sampling.priority=1", sampledParent.WithRemote(false).WithTraceFlags(0), sdktrace.Drop},
+	} {
+		b, err := baggage.Parse(tc.baggage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := baggage.ContextWithBaggage(trace.ContextWithSpanContext(context.Background(), tc.parent), b)
+		res := s.ShouldSample(sdktrace.SamplingParameters{ParentContext: ctx, TraceID: trace.TraceID{0xff}, Kind: trace.SpanKindServer})
+		if res.Decision != tc.want {
+			t.Errorf("TestBaggageSampler: %q with parent %v: got %v, want %v", tc.baggage, tc.parent.IsSampled(), res.Decision, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"gold", "gold=2", "free=none"} {
+		if _, err := parseTierRatios(bad); err == nil {
+			t.Errorf("TestBaggageSampler: %q was accepted", bad)
+		}
+	}
+}
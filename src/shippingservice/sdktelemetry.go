@@ -0,0 +1,306 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/internal/telemetry"
+)
+
+const (
+	sdkErrorBurst    = 10
+	sdkErrorInterval = time.Minute
+)
+
+// sdkErrorHandler logs the errors the OpenTelemetry SDK reports, such as
+// failed exports. A collector that is down fails every batch, so at most
+// burst errors are logged per interval and the rest are counted and reported
+// with the next line that gets through.
+type sdkErrorHandler struct {
+	log      *logger
+	burst    int
+	interval time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	logged      int
+	suppressed  int
+}
+
+func newSDKErrorHandler(l *logger) *sdkErrorHandler {
+	return &sdkErrorHandler{log: l, burst: sdkErrorBurst, interval: sdkErrorInterval, now: time.Now}
+}
+
+func (h *sdkErrorHandler) Handle(err error) {
+	h.mu.Lock()
+	now := h.now()
+	if now.Sub(h.windowStart) >= h.interval {
+		h.windowStart, h.logged = now, 0
+	}
+	if h.logged >= h.burst {
+		h.suppressed++
+		h.mu.Unlock()
+		return
+	}
+	h.logged++
+	suppressed := h.suppressed
+	h.suppressed = 0
+	h.mu.Unlock()
+
+	l := h.log.WithError(err)
+	if suppressed > 0 {
+		l = l.With("suppressed", suppressed)
+	}
+	l.Warn("OpenTelemetry SDK error")
+}
+
+// sdkTelemetry makes the trace pipeline observable: how many spans it
+// exported, failed to export or dropped because the batch queue was full,
+// and how full that queue is.
+type sdkTelemetry struct {
+	queueCapacity int64
+
+	enqueued atomic.Int64
+	exported atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+
+	// lastErr is the error of the latest export, or nil if it succeeded.
+	lastErr atomic.Pointer[error]
+
+	processed metric.Int64Counter
+	exports   metric.Int64Counter
+}
+
+// newSDKTelemetry creates the metrics for a batch span processor whose queue
+// holds queueCapacity spans.
+func newSDKTelemetry(queueCapacity int) *sdkTelemetry {
+	t := &sdkTelemetry{queueCapacity: int64(queueCapacity)}
+	var err error
+	if t.processed, err = meter.Int64Counter("otel.sdk.processor.span.processed",
+		metric.WithDescription("Spans handled by the batch processor; error.type is set for spans it dropped."),
+		metric.WithUnit("{span}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create processed spans metric")
+	}
+	if t.exports, err = meter.Int64Counter("otel.sdk.exporter.span.exported",
+		metric.WithDescription("Spans passed to the exporter; error.type is set for spans whose export failed."),
+		metric.WithUnit("{span}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create exported spans metric")
+	}
+	if _, err = meter.Int64ObservableGauge("otel.sdk.processor.span.queue.size",
+		metric.WithDescription("Spans waiting in the batch processor to be exported."),
+		metric.WithUnit("{span}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(t.queueSize())
+			return nil
+		}),
+	); err != nil {
+		log.WithError(err).Warn("failed to create span queue size metric")
+	}
+	if _, err = meter.Int64ObservableGauge("otel.sdk.processor.span.queue.capacity",
+		metric.WithDescription("Spans the batch processor can hold before it drops new ones."),
+		metric.WithUnit("{span}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(t.queueCapacity)
+			return nil
+		}),
+	); err != nil {
+		log.WithError(err).Warn("failed to create span queue capacity metric")
+	}
+	return t
+}
+
+// queueSize estimates the spans accepted by the processor but not yet
+// exported, including the batch being exported.
+func (t *sdkTelemetry) queueSize() int64 {
+	n := t.enqueued.Load() - t.exported.Load() - t.failed.Load() - t.dropped.Load()
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// processor counts the spans handed to next, which must be the batch
+// processor.
+func (t *sdkTelemetry) processor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return countingProcessor{SpanProcessor: next, t: t}
+}
+
+// exporter counts the spans next exports and fails to export.
+func (t *sdkTelemetry) exporter(next sdktrace.SpanExporter) sdktrace.SpanExporter {
+	return countingExporter{SpanExporter: next, t: t}
+}
+
+// logger returns a logr.Logger for otel.SetLogger. The batch processor only
+// reports the spans it dropped in its debug log, so that is where they are
+// counted; warnings and errors go to the service log.
+func (t *sdkTelemetry) logger() logr.Logger {
+	return logr.New(&sdkLogSink{t: t})
+}
+
+// exportHealth is a health probe that fails while the latest export failed,
+// i.e. while the collector is unreachable or rejecting spans.
+func (t *sdkTelemetry) exportHealth(context.Context) error {
+	if err := t.lastErr.Load(); err != nil && *err != nil {
+		return fmt.Errorf("span export failing: %w", *err)
+	}
+	return nil
+}
+
+// setDropped records the processor's running total of dropped spans.
+func (t *sdkTelemetry) setDropped(total int64) {
+	if delta := total - t.dropped.Swap(total); delta > 0 && t.processed != nil {
+		t.processed.Add(context.Background(), delta, metric.WithAttributes(attribute.String("error.type", "queue_full")))
+	}
+}
+
+type countingProcessor struct {
+	sdktrace.SpanProcessor
+	t *sdkTelemetry
+}
+
+func (p countingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// The batch processor ignores unsampled spans.
+	if s.SpanContext().IsSampled() {
+		p.t.enqueued.Add(1)
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+type countingExporter struct {
+	sdktrace.SpanExporter
+	t *sdkTelemetry
+}
+
+func (e countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.t.lastErr.Store(&err)
+	n := int64(len(spans))
+	var opts []metric.AddOption
+	if err != nil {
+		e.t.failed.Add(n)
+		opts = append(opts, metric.WithAttributes(attribute.String("error.type", status.Code(err).String())))
+	} else {
+		e.t.exported.Add(n)
+		if e.t.processed != nil {
+			e.t.processed.Add(ctx, n)
+		}
+	}
+	if e.t.exports != nil {
+		e.t.exports.Add(ctx, n, opts...)
+	}
+	return err
+}
+
+// payloadStats is a gRPC stats handler for an OTLP exporter's connection,
+// counting the bytes of the export requests before and after compression,
+// so the bandwidth that OTEL_EXPORTER_OTLP_COMPRESSION saves can be seen.
+type payloadStats struct {
+	uncompressed metric.Int64Counter
+	sent         metric.Int64Counter
+	attrs        metric.AddOption
+}
+
+// exporterDialOptions measures the payloads of the OTLP exporter of a signal.
+func exporterDialOptions(signal string, cfg telemetry.OTLPConfig) []grpc.DialOption {
+	return []grpc.DialOption{grpc.WithStatsHandler(newPayloadStats(signal, cfg.Compression))}
+}
+
+// newPayloadStats returns the stats handler for the exporter of a signal,
+// e.g. "traces", using the given compression.
+func newPayloadStats(signal, compression string) *payloadStats {
+	p := &payloadStats{attrs: metric.WithAttributes(
+		attribute.String("otel.signal", signal),
+		attribute.String("compression", compression),
+	)}
+	var err error
+	if p.uncompressed, err = meter.Int64Counter("otel.sdk.exporter.payload.uncompressed",
+		metric.WithDescription("Bytes of OTLP export requests before compression."),
+		metric.WithUnit("By"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create uncompressed payload metric")
+	}
+	if p.sent, err = meter.Int64Counter("otel.sdk.exporter.payload.sent",
+		metric.WithDescription("Bytes of OTLP export requests sent, after compression."),
+		metric.WithUnit("By"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create sent payload metric")
+	}
+	return p
+}
+
+func (p *payloadStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	out, ok := s.(*stats.OutPayload)
+	if !ok || p.uncompressed == nil || p.sent == nil {
+		return
+	}
+	p.uncompressed.Add(ctx, int64(out.Length), p.attrs)
+	p.sent.Add(ctx, int64(out.CompressedLength), p.attrs)
+}
+
+func (p *payloadStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (p *payloadStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (p *payloadStats) HandleConn(context.Context, stats.ConnStats)                       {}
+
+// sdkLogSink receives the OpenTelemetry SDK's internal log.
+type sdkLogSink struct {
+	t *sdkTelemetry
+}
+
+func (s *sdkLogSink) Init(logr.RuntimeInfo) {}
+
+// Enabled accepts every level, as the dropped span count is logged at debug
+// verbosity.
+func (s *sdkLogSink) Enabled(int) bool { return true }
+
+func (s *sdkLogSink) Info(level int, msg string, keysAndValues ...any) {
+	if msg == "exporting spans" {
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			if keysAndValues[i] == "total_dropped" {
+				if n, ok := keysAndValues[i+1].(uint32); ok {
+					s.t.setDropped(int64(n))
+				}
+			}
+		}
+		return
+	}
+	// Levels above 1 are the SDK's info and debug messages.
+	if level <= 1 {
+		log.With(keysAndValues...).Warn(msg)
+	}
+}
+
+func (s *sdkLogSink) Error(err error, msg string, keysAndValues ...any) {
+	log.WithError(err).With(keysAndValues...).Error(msg)
+}
+
+func (s *sdkLogSink) WithValues(...any) logr.LogSink { return s }
+func (s *sdkLogSink) WithName(string) logr.LogSink   { return s }
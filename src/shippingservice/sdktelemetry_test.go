@@ -0,0 +1,201 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/microservices-demo/src/internal/telemetry"
+)
+
+// TestSDKErrorHandler checks that SDK errors are rate limited and the suppressed ones reported.
+func TestSDKErrorHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(&buf, "", "json")
+	if err != nil {
+		t.Fatalf("TestSDKErrorHandler: %v", err)
+	}
+	now := time.Unix(1000, 0)
+	h := newSDKErrorHandler(l)
+	h.burst, h.now = 2, func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		h.Handle(errors.New("export failed"))
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("TestSDKErrorHandler: %d lines logged, expected 2", n)
+	}
+	now = now.Add(h.interval)
+	h.Handle(errors.New("export failed"))
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); !strings.Contains(lines[len(lines)-1], `"suppressed":3`) {
+		t.Errorf("TestSDKErrorHandler: last line %q does not report 3 suppressed errors", lines[len(lines)-1])
+	}
+}
+
+// flakySpanExporter fails its first export.
+type flakySpanExporter struct {
+	*tracetest.InMemoryExporter
+	calls int
+}
+
+func (e *flakySpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if e.calls++; e.calls == 1 {
+		return status.Error(codes.Unavailable, "collector is down")
+	}
+	return e.InMemoryExporter.ExportSpans(ctx, spans)
+}
+
+// TestSDKTelemetry checks that exported, failed and dropped spans and the queue are measured.
+func TestSDKTelemetry(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	saved := meter
+	meter = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(serviceName)
+	defer func() { meter = saved }()
+
+	ctx := context.Background()
+	tel := newSDKTelemetry(100)
+	exp := tel.exporter(&flakySpanExporter{InMemoryExporter: tracetest.NewInMemoryExporter()})
+	exporting := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tel.processor(sdktrace.NewSimpleSpanProcessor(exp))))
+	for i := 0; i < 3; i++ {
+		_, span := exporting.Tracer("test").Start(ctx, "span")
+		span.End()
+	}
+	// Spans that never reach the exporter are either queued or, as the
+	// batch processor later reports, dropped.
+	stuck := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tel.processor(tracetest.NewSpanRecorder())))
+	for i := 0; i < 5; i++ {
+		_, span := stuck.Tracer("test").Start(ctx, "span")
+		span.End()
+	}
+	tel.logger().V(8).Info("exporting spans", "count", 0, "total_dropped", uint32(4))
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("TestSDKTelemetry: %v", err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					errType, _ := dp.Attributes.Value("error.type")
+					got[m.Name+"/"+errType.AsString()] += dp.Value
+				}
+			case metricdata.Gauge[int64]:
+				got[m.Name] = data.DataPoints[0].Value
+			}
+		}
+	}
+	for k, v := range map[string]int64{
+		"otel.sdk.exporter.span.exported/":             2,
+		"otel.sdk.exporter.span.exported/Unavailable":  1,
+		"otel.sdk.processor.span.processed/":           2,
+		"otel.sdk.processor.span.processed/queue_full": 4,
+		"otel.sdk.processor.span.queue.capacity":       100,
+		"otel.sdk.processor.span.queue.size":           1,
+	} {
+		if got[k] != v {
+			t.Errorf("TestSDKTelemetry: %s = %d, expected %d", k, got[k], v)
+		}
+	}
+}
+
+type fakeTraceCollector struct {
+	coltracepb.UnimplementedTraceServiceServer
+}
+
+func (fakeTraceCollector) Export(context.Context, *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// TestExportPayloadSize checks that the size of export requests is measured
+// before and after compression.
+func TestExportPayloadSize(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, fakeTraceCollector{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	for _, compression := range []string{"none", "gzip"} {
+		reader := sdkmetric.NewManualReader()
+		saved := meter
+		meter = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(serviceName)
+
+		ctx := context.Background()
+		cfg := telemetry.OTLPConfig{Endpoint: lis.Addr().String(), Insecure: true, Timeout: 5 * time.Second, Compression: compression}
+		exp, err := telemetry.SpanExporter(ctx, cfg, exporterDialOptions("traces", cfg)...)
+		meter = saved
+		if err != nil {
+			t.Fatalf("TestExportPayloadSize: %v", err)
+		}
+		tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+		// Repetitive spans, like real ones, compress well.
+		for i := 0; i < 50; i++ {
+			_, span := tp.Tracer("test").Start(ctx, "hipstershop.ShippingService/GetQuote",
+				trace.WithAttributes(attribute.String("app.address.country", "USA"), attribute.String("rpc.system", "grpc")))
+			span.End()
+		}
+		tp.Shutdown(ctx)
+
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(ctx, &rm); err != nil {
+			t.Fatalf("TestExportPayloadSize: %v", err)
+		}
+		got := map[string]int64{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if data, ok := m.Data.(metricdata.Sum[int64]); ok {
+					for _, dp := range data.DataPoints {
+						if v, _ := dp.Attributes.Value("compression"); v.AsString() == compression {
+							got[m.Name] += dp.Value
+						}
+					}
+				}
+			}
+		}
+		uncompressed, sent := got["otel.sdk.exporter.payload.uncompressed"], got["otel.sdk.exporter.payload.sent"]
+		if uncompressed == 0 {
+			t.Errorf("TestExportPayloadSize: no payload measured with compression %s", compression)
+		}
+		if compression == "none" && sent != uncompressed {
+			t.Errorf("TestExportPayloadSize: sent %d of %d bytes without compression", sent, uncompressed)
+		}
+		if compression == "gzip" && sent*2 > uncompressed {
+			t.Errorf("TestExportPayloadSize: gzip sent %d of %d bytes", sent, uncompressed)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultShedRetryAfter = time.Second
+
+// loadShedder rejects calls straight away once a ceiling of concurrent calls
+// is reached. Under overload the calls it admits keep their usual latency,
+// while the rest fail fast with a hint of when to retry, rather than every
+// call queueing until it times out. The ceiling is fixed, or adjusted by an
+// adaptiveLimit as the latency of the calls changes.
+type loadShedder struct {
+	limit      atomic.Int64
+	adaptive   *adaptiveLimit
+	retryAfter time.Duration
+	inflight   atomic.Int64
+	shed       metric.Int64Counter
+}
+
+func newLoadShedder(limit int, adaptive *adaptiveLimit, retryAfter time.Duration) *loadShedder {
+	s := &loadShedder{adaptive: adaptive, retryAfter: retryAfter}
+	s.limit.Store(int64(limit))
+	algorithm := "fixed"
+	if adaptive != nil {
+		s.limit.Store(int64(adaptive.limit))
+		algorithm = adaptive.algorithm
+	}
+	var err error
+	if s.shed, err = meter.Int64Counter("shipping.rpc.shed",
+		metric.WithDescription("RPCs rejected because the service was at its concurrency limit, by method."),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create load shedding metric")
+	}
+	if _, err = meter.Int64ObservableGauge("shipping.rpc.concurrency",
+		metric.WithDescription("RPCs being handled."),
+		metric.WithUnit("{request}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(s.inflight.Load())
+			return nil
+		}),
+	); err != nil {
+		log.WithError(err).Warn("failed to create concurrency metric")
+	}
+	if _, err = meter.Int64ObservableGauge("shipping.rpc.concurrency.limit",
+		metric.WithDescription("Concurrent RPCs handled before further ones are shed."),
+		metric.WithUnit("{request}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(s.limit.Load(), metric.WithAttributes(attribute.String("rpc.concurrency.algorithm", algorithm)))
+			return nil
+		}),
+	); err != nil {
+		log.WithError(err).Warn("failed to create concurrency limit metric")
+	}
+	if adaptive == nil {
+		return s
+	}
+	if _, err = meter.Float64ObservableGauge("shipping.rpc.concurrency.latency",
+		metric.WithDescription("Average latency of the admitted RPCs over the short and long-term windows of the adaptive limit."),
+		metric.WithUnit("s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			short, long := adaptive.latencies()
+			o.Observe(short, metric.WithAttributes(attribute.String("latency.window", "short")))
+			o.Observe(long, metric.WithAttributes(attribute.String("latency.window", "long")))
+			return nil
+		}),
+	); err != nil {
+		log.WithError(err).Warn("failed to create concurrency latency metric")
+	}
+	return s
+}
+
+// loadShedderFromEnv returns a shedder with the CONCURRENCY_LIMIT_ALGORITHM
+// limit: fixed at MAX_CONCURRENT_REQUESTS, or starting there and adjusted
+// between CONCURRENCY_LIMIT_MIN and CONCURRENCY_LIMIT_MAX. It returns nil if
+// the limit is fixed and not set.
+func loadShedderFromEnv() *loadShedder {
+	algorithm := os.Getenv("CONCURRENCY_LIMIT_ALGORITHM")
+	limit := envInt("MAX_CONCURRENT_REQUESTS", 0)
+	retry := envDuration("SHED_RETRY_AFTER", defaultShedRetryAfter)
+	if algorithm == "" || algorithm == "fixed" {
+		if limit <= 0 {
+			return nil
+		}
+		log.Infof("shedding load above %d concurrent requests", limit)
+		return newLoadShedder(limit, nil, retry)
+	}
+	if limit <= 0 {
+		limit = defaultInitialConcurrencyLimit
+	}
+	adaptive, err := newAdaptiveLimit(algorithm, limit,
+		envInt("CONCURRENCY_LIMIT_MIN", defaultMinConcurrencyLimit),
+		envInt("CONCURRENCY_LIMIT_MAX", defaultMaxConcurrencyLimit),
+		envDuration("CONCURRENCY_LATENCY_TARGET", defaultConcurrencyLatency))
+	if err != nil {
+		log.Fatalf("invalid concurrency limit: %v", err)
+	}
+	log.Infof("shedding load above an %s concurrency limit starting at %d", algorithm, limit)
+	return newLoadShedder(limit, adaptive, retry)
+}
+
+// acquire admits a call if the limit allows it, returning the calls now in
+// flight. Every admitted call must be followed by a release.
+func (s *loadShedder) acquire() (int64, bool) {
+	n := s.inflight.Add(1)
+	if n > s.limit.Load() {
+		s.inflight.Add(-1)
+		return n - 1, false
+	}
+	return n, true
+}
+
+// release ends a call admitted with inflight calls running, which took rtt.
+// An adaptive limit learns from it.
+func (s *loadShedder) release(inflight int64, rtt time.Duration, err error) {
+	s.inflight.Add(-1)
+	if s.adaptive != nil {
+		s.limit.Store(s.adaptive.update(rtt, inflight, status.Code(err) == codes.DeadlineExceeded))
+	}
+}
+
+// unary returns an interceptor shedding unary calls over the limit with
+// ResourceExhausted and a RetryInfo. Health checks are always admitted. It
+// belongs after the RED metrics and access log, so that shed calls are
+// counted, and before anything costly.
+func (s *loadShedder) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if s == nil || exempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		inflight, ok := s.acquire()
+		if !ok {
+			return nil, s.reject(ctx, info.FullMethod)
+		}
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		s.release(inflight, time.Since(start), err)
+		return resp, err
+	}
+}
+
+// stream is unary for streaming RPCs. A stream holds its slot for as long as
+// it is open, but the adaptive limit does not learn from it: how long a
+// stream stays open says nothing of the latency of the service.
+func (s *loadShedder) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if s == nil || exempt(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		if _, ok := s.acquire(); !ok {
+			return s.reject(ss.Context(), info.FullMethod)
+		}
+		defer s.inflight.Add(-1)
+		return handler(srv, ss)
+	}
+}
+
+// reject counts a shed call of fullMethod and returns its error.
+func (s *loadShedder) reject(ctx context.Context, fullMethod string) error {
+	service, method := splitMethodName(fullMethod)
+	if s.shed != nil {
+		s.shed.Add(ctx, 1, metric.WithAttributes(
+			semconv.RPCServiceKey.String(service),
+			semconv.RPCMethodKey.String(method),
+			attribute.String("tenant.id", tenantFromContext(ctx).label),
+		))
+	}
+	limit := s.limit.Load()
+	return rpcError(ctx, codes.ResourceExhausted, reasonOverloaded,
+		map[string]string{"limit": fmt.Sprint(limit)},
+		fmt.Sprintf("the service is at its limit of %d concurrent requests", limit),
+		retryAfter(s.retryAfter))
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestLoadShedding checks that calls over the limit fail fast with a retry
+// hint, that health checks are admitted, and that slots are given back.
+func TestLoadShedding(t *testing.T) {
+	s := newLoadShedder(2, nil, 3*time.Second)
+	shed := s.unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocking := func(ctx context.Context, req interface{}) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return "done", nil
+	}
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := shed(context.Background(), nil, info, blocking)
+			done <- err
+		}()
+		<-started
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "done", nil }
+	_, err := shed(context.Background(), nil, info, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("TestLoadShedding: call over the limit returned %v, want ResourceExhausted", err)
+	}
+	errInfo, retry := errorDetails(err)
+	if errInfo == nil || errInfo.Reason != reasonOverloaded {
+		t.Errorf("TestLoadShedding: ErrorInfo is %v, want reason %s", errInfo, reasonOverloaded)
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() != 3*time.Second {
+		t.Errorf("TestLoadShedding: RetryInfo is %v, want 3s", retry)
+	}
+	health := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	if _, err := shed(context.Background(), nil, health, handler); err != nil {
+		t.Errorf("TestLoadShedding: health check was shed: %v", err)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("TestLoadShedding: admitted call failed: %v", err)
+		}
+	}
+	if _, err := shed(context.Background(), nil, info, handler); err != nil {
+		t.Errorf("TestLoadShedding: call after the others finished was shed: %v", err)
+	}
+	if n := s.inflight.Load(); n != 0 {
+		t.Errorf("TestLoadShedding: %d calls in flight after all returned", n)
+	}
+}
+
+// TestAdaptiveLimit checks that the adaptive limits grow while latency holds
+// and shrink as it rises, within their bounds.
+func TestAdaptiveLimit(t *testing.T) {
+	aimd, err := newAdaptiveLimit("aimd", 10, 5, 12, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aimd.update(10*time.Millisecond, 2, false); got != 10 {
+		t.Errorf("TestAdaptiveLimit: aimd limit moved to %d with little in flight", got)
+	}
+	for i := 0; i < 5; i++ {
+		aimd.update(10*time.Millisecond, 8, false)
+	}
+	if got := aimd.update(10*time.Millisecond, 8, false); got != 12 {
+		t.Errorf("TestAdaptiveLimit: aimd limit is %d after fast calls, want the max of 12", got)
+	}
+	if got := aimd.update(200*time.Millisecond, 8, false); got != 10 {
+		t.Errorf("TestAdaptiveLimit: aimd limit is %d after a slow call, want 10", got)
+	}
+	for i := 0; i < 20; i++ {
+		aimd.update(10*time.Millisecond, 8, true)
+	}
+	if got := aimd.update(10*time.Millisecond, 1, true); got != 5 {
+		t.Errorf("TestAdaptiveLimit: aimd limit is %d after timeouts, want the min of 5", got)
+	}
+
+	gradient, err := newAdaptiveLimit("gradient", 16, 1, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limit int64
+	for i := 0; i < 50; i++ {
+		limit = gradient.update(20*time.Millisecond, 16, false)
+	}
+	if limit <= 16 {
+		t.Errorf("TestAdaptiveLimit: gradient limit is %d at a steady latency, want it to grow from 16", limit)
+	}
+	grown := limit
+	for i := 0; i < 20; i++ {
+		limit = gradient.update(200*time.Millisecond, grown, false)
+	}
+	if limit >= grown {
+		t.Errorf("TestAdaptiveLimit: gradient limit is %d after calls slowed down, want below %d", limit, grown)
+	}
+	if short, long := gradient.latencies(); short <= long {
+		t.Errorf("TestAdaptiveLimit: short-term latency %v is not above long-term %v", short, long)
+	}
+
+	instant, _ := newAdaptiveLimit("gradient", 16, 1, 1000, 0)
+	for i := 0; i < 3; i++ {
+		limit = instant.update(0, 16, false)
+	}
+	if limit < 16 || limit > 1000 {
+		t.Errorf("TestAdaptiveLimit: gradient limit is %d after calls that took no measurable time", limit)
+	}
+
+	if _, err := newAdaptiveLimit("vegas", 10, 1, 100, 0); err == nil {
+		t.Error("TestAdaptiveLimit: unknown algorithm was accepted")
+	}
+}
+
+// TestAdaptiveShedding checks that the shedder applies the limit learnt from
+// the calls it admits.
+func TestAdaptiveShedding(t *testing.T) {
+	adaptive, _ := newAdaptiveLimit("aimd", 1, 1, 10, time.Second)
+	s := newLoadShedder(1, adaptive, time.Second)
+	shed := s.unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "done", nil }
+	for i := 0; i < 3; i++ {
+		if _, err := shed(context.Background(), nil, info, handler); err != nil {
+			t.Fatalf("TestAdaptiveShedding: call %d: %v", i, err)
+		}
+	}
+	// One call at a time keeps using half of the limit until it reaches 3.
+	if got := s.limit.Load(); got != 3 {
+		t.Errorf("TestAdaptiveShedding: limit is %d after 3 fast sequential calls, want 3", got)
+	}
+}
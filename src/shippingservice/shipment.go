@@ -0,0 +1,197 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+var (
+	errShipmentNotFound  = errors.New("shipment not found")
+	errInvalidTransition = errors.New("invalid shipment state transition")
+	errQuotaExceeded     = errors.New("shipment quota exceeded")
+)
+
+// transitions lists the states a shipment may move to from each state.
+var transitions = map[pb.ShipmentStatus][]pb.ShipmentStatus{
+	pb.ShipmentStatus_SHIPMENT_STATUS_CREATED: {
+		pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT,
+		pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED,
+	},
+	pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT: {
+		pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED,
+	},
+}
+
+// canTransition reports whether a shipment may move from one state to another.
+func canTransition(from, to pb.ShipmentStatus) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// shipment is a single order handed over for shipping.
+type shipment struct {
+	Tenant     string
+	TrackingID string
+	Address    *pb.Address
+	Items      []*pb.CartItem
+	Status     pb.ShipmentStatus
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// Label is the rendered shipping label, once the label job has run.
+	Label []byte
+	// Origin is the span of the ShipOrder call that created the shipment,
+	// for later work on it to link to.
+	Origin trace.SpanContext
+}
+
+// shipmentStore keeps track of shipments and enforces their state machine.
+// Every change is written to the outbox together with the shipment itself, so
+// an event is published if and only if the change it describes happened.
+// Every change is also appended to the shipment's history. Shipments are
+// partitioned by tenant: a tenant can only see its own. The shipments, their
+// history and the outbox are kept by a ShipmentRepository.
+type shipmentStore struct {
+	mu     sync.Mutex
+	repo   ShipmentRepository
+	notify chan struct{}
+}
+
+func newShipmentStore(repo ShipmentRepository) *shipmentStore {
+	return &shipmentStore{
+		repo:   repo,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// create records a new shipment of tenant in the CREATED state. It fails
+// with errQuotaExceeded if quota is positive and the tenant already has that
+// many shipments in progress.
+func (st *shipmentStore) create(ctx context.Context, tenant, id string, address *pb.Address, items []*pb.CartItem, quota int) (shipment, error) {
+	now := time.Now()
+	sh := shipment{
+		Tenant:     tenant,
+		TrackingID: id,
+		Address:    address,
+		Items:      items,
+		Status:     pb.ShipmentStatus_SHIPMENT_STATUS_CREATED,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Origin:     trace.SpanContextFromContext(ctx),
+	}
+	from := pb.ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
+	ev := newShipmentEvent(eventShipmentCreated, tenant, id, from, sh.Status)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.repo.insert(ctx, sh, newHistoryEntry(ctx, ev, from, sh.Status), newOutboxRecord(ctx, ev), quota); err != nil {
+		return shipment{}, err
+	}
+	st.wake()
+
+	trace.SpanFromContext(ctx).AddEvent("shipment.created", trace.WithAttributes(
+		attribute.String("shipment.tracking_id", id),
+		attribute.String("shipment.status", sh.Status.String()),
+	))
+	return sh, nil
+}
+
+// get returns the tenant's shipment with the given tracking ID.
+func (st *shipmentStore) get(ctx context.Context, tenant, id string) (shipment, error) {
+	return st.repo.get(ctx, tenant, id)
+}
+
+// transition moves a tenant's shipment to the given state if the state
+// machine allows it, recording the change as a span event.
+func (st *shipmentStore) transition(ctx context.Context, tenant, id string, to pb.ShipmentStatus) (shipment, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sh, err := st.repo.get(ctx, tenant, id)
+	if err != nil {
+		return shipment{}, err
+	}
+	from := sh.Status
+	if !canTransition(from, to) {
+		return sh, fmt.Errorf("%w: %s -> %s", errInvalidTransition, from, to)
+	}
+	sh.Status = to
+	sh.UpdatedAt = time.Now()
+	ev := newShipmentEvent(eventShipmentStatusChanged, tenant, id, from, to)
+	if err := st.repo.update(ctx, sh, from, newHistoryEntry(ctx, ev, from, to), newOutboxRecord(ctx, ev)); err != nil {
+		return sh, err
+	}
+	st.wake()
+
+	trace.SpanFromContext(ctx).AddEvent("shipment.transition", trace.WithAttributes(
+		attribute.String("shipment.tracking_id", id),
+		attribute.String("shipment.status.from", from.String()),
+		attribute.String("shipment.status.to", to.String()),
+	))
+	return sh, nil
+}
+
+// live returns the number of shipments of tenant that are not yet delivered
+// or cancelled.
+func (st *shipmentStore) live(ctx context.Context, tenant string) (int, error) {
+	return st.repo.live(ctx, tenant)
+}
+
+// attachLabel keeps the rendered label of a tenant's shipment.
+func (st *shipmentStore) attachLabel(ctx context.Context, tenant, id string, label []byte) error {
+	return st.repo.setLabel(ctx, tenant, id, label)
+}
+
+// due returns the shipments that have been in their state for at least the
+// time given for it in after, oldest first.
+func (st *shipmentStore) due(ctx context.Context, now time.Time, after map[pb.ShipmentStatus]time.Duration) ([]shipment, error) {
+	return st.repo.due(ctx, now, after)
+}
+
+// purgeFinished removes the delivered and cancelled shipments last updated
+// longer ago than the policy keeps them, along with their history.
+func (st *shipmentStore) purgeFinished(ctx context.Context, now time.Time, policy retentionPolicy) (purgeResult, error) {
+	return st.repo.purge(ctx, now, policy)
+}
+
+// wake tells the outbox relay that new events are waiting.
+func (st *shipmentStore) wake() {
+	select {
+	case st.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pendingEvents returns up to limit unpublished outbox records, oldest first.
+func (st *shipmentStore) pendingEvents(ctx context.Context, limit int) ([]outboxRecord, error) {
+	return st.repo.pendingEvents(ctx, limit)
+}
+
+// markPublished removes records up to and including seq from the outbox.
+func (st *shipmentStore) markPublished(ctx context.Context, seq int64) error {
+	return st.repo.markPublished(ctx, seq)
+}
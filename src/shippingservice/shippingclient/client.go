@@ -0,0 +1,191 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shippingclient calls the shipping service. NewClient dials it with
+// the otelgrpc instrumentation, so that calls are traced and carry the trace
+// context, retries the calls that are safe to retry, and turns the errors
+// the service returns into *Error values that can be matched with errors.Is:
+//
+//	c, err := shippingclient.NewClient("shippingservice:50051")
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	resp, err := c.GetQuote(ctx, &pb.GetQuoteRequest{Address: addr, Items: items})
+//	if errors.Is(err, shippingclient.ErrInvalidAddress) {
+//		...
+//	}
+package shippingclient
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	defaultMaxAttempts = 3
+	baseBackoff        = 50 * time.Millisecond
+	maxBackoff         = time.Second
+
+	idempotencyKeyHeader = "idempotency-key"
+)
+
+// Client is a connection to the shipping service. Its methods are those of
+// the ShippingService RPCs.
+type Client struct {
+	pb.ShippingServiceClient
+	conn *grpc.ClientConn
+}
+
+type config struct {
+	maxAttempts int
+	otel        []otelgrpc.Option
+	dial        []grpc.DialOption
+}
+
+// Option changes how NewClient connects.
+type Option func(*config)
+
+// WithMaxAttempts makes at most n attempts of each call that can be retried;
+// 1 turns retries off. The default is 3.
+func WithMaxAttempts(n int) Option {
+	return func(c *config) { c.maxAttempts = n }
+}
+
+// WithInstrumentation passes options, such as the tracer provider, to the
+// otelgrpc instrumentation, which uses the global providers by default.
+func WithInstrumentation(opts ...otelgrpc.Option) Option {
+	return func(c *config) { c.otel = append(c.otel, opts...) }
+}
+
+// WithDialOptions adds options to the connection. The connection is
+// plaintext, as it is inside the cluster, unless they give transport
+// credentials.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *config) { c.dial = append(c.dial, opts...) }
+}
+
+// NewClient returns a client of the shipping service at target, for
+// instance "shippingservice:50051". Like grpc.NewClient, it does not
+// connect until the first call.
+func NewClient(target string, opts ...Option) (*Client, error) {
+	c := config{maxAttempts: defaultMaxAttempts}
+	for _, o := range opts {
+		o(&c)
+	}
+	dial := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(c.otel...)),
+		grpc.WithChainUnaryInterceptor(retryInterceptor(c.maxAttempts), errorInterceptor),
+		grpc.WithChainStreamInterceptor(streamErrorInterceptor),
+	}, c.dial...)
+	conn, err := grpc.NewClient(target, dial...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{ShippingServiceClient: pb.NewShippingServiceClient(conn), conn: conn}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// readOnly are the methods that change nothing, and can always be retried.
+var readOnly = map[string]bool{
+	"/hipstershop.ShippingService/GetQuote":            true,
+	"/hipstershop.ShippingService/GetDeliveryEstimate": true,
+	"/hipstershop.ShippingService/GetTrackingStatus":   true,
+	"/hipstershop.ShippingService/GetShipmentHistory":  true,
+}
+
+const shipOrderMethod = "/hipstershop.ShippingService/ShipOrder"
+
+// retryInterceptor retries calls that failed with a transient error, up to
+// maxAttempts attempts, after a jittered exponential backoff or the delay
+// the service asked for, whichever is longer. ShipOrder is retried too: it
+// is given an idempotency key unless the caller set one, so that a retry
+// returns the shipment of the first attempt instead of creating another.
+// Every retry is recorded as an event of the caller's span.
+func retryInterceptor(maxAttempts int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if method == shipOrderMethod {
+			if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(idempotencyKeyHeader)) == 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, idempotencyKeyHeader, uuid.NewString())
+			}
+		} else if !readOnly[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		span := trace.SpanFromContext(ctx)
+		for attempt := 1; ; attempt++ {
+			actx := ctx
+			if attempt > 1 {
+				actx = metadata.AppendToOutgoingContext(ctx, "grpc-previous-rpc-attempts", strconv.Itoa(attempt-1))
+			}
+			err := invoker(actx, method, req, reply, cc, opts...)
+			e, ok := err.(*Error)
+			if err == nil || !ok || !e.Temporary() || attempt >= maxAttempts {
+				return err
+			}
+			delay := backoff(attempt)
+			if e.RetryDelay > delay {
+				delay = e.RetryDelay
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				return err
+			}
+			span.AddEvent("shippingclient.retry", trace.WithAttributes(
+				attribute.String("rpc.method", method),
+				attribute.Int("retry.attempt", attempt+1),
+				attribute.String("retry.delay", delay.String()),
+				attribute.String("error", err.Error()),
+			))
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+		}
+	}
+}
+
+// backoff returns the full-jitter delay before the given retry (1-based).
+func backoff(retry int) time.Duration {
+	d := baseBackoff << uint(retry-1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// temporaryCodes are the codes of errors that may not happen again.
+var temporaryCodes = map[codes.Code]bool{
+	codes.Unavailable: true,
+	codes.Aborted:     true,
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shippingclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// fakeService answers the calls of the test as the shipping service would.
+// The methods it does not implement panic.
+type fakeService struct {
+	pb.ShippingServiceServer
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *fakeService) GetQuote(ctx context.Context, req *pb.GetQuoteRequest) (*pb.GetQuoteResponse, error) {
+	return &pb.GetQuoteResponse{CostUsd: &pb.Money{CurrencyCode: "USD", Units: 8, Nanos: 990000000}}, nil
+}
+
+func (s *fakeService) ShipOrder(ctx context.Context, req *pb.ShipOrderRequest) (*pb.ShipOrderResponse, error) {
+	return &pb.ShipOrderResponse{TrackingId: "AB-1234-56789012"}, nil
+}
+
+func (s *fakeService) GetTrackingStatus(ctx context.Context, req *pb.GetTrackingStatusRequest) (*pb.GetTrackingStatusResponse, error) {
+	st, _ := status.New(codes.InvalidArgument, "malformed tracking ID").WithDetails(
+		&errdetails.ErrorInfo{Reason: ErrMalformedTrackingID.Reason, Domain: "shippingservice.hipstershop"},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "tracking_id", Description: "must look like AB-1234-56789012"},
+		}},
+	)
+	return nil, st.Err()
+}
+
+// failFirst fails the first call of every method with Unavailable, and
+// records the idempotency keys of the ShipOrder calls.
+func (s *fakeService) failFirst() grpc.UnaryServerInterceptor {
+	failed := map[string]bool{}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		s.mu.Lock()
+		first := !failed[info.FullMethod]
+		failed[info.FullMethod] = true
+		if info.FullMethod == shipOrderMethod {
+			md, _ := metadata.FromIncomingContext(ctx)
+			s.keys = append(s.keys, md.Get(idempotencyKeyHeader)...)
+		}
+		s.mu.Unlock()
+		if first {
+			st, _ := status.New(codes.Unavailable, "first call fails").WithDetails(
+				&errdetails.ErrorInfo{Reason: ErrBackendUnavailable.Reason, Domain: "shippingservice.hipstershop"})
+			return nil, st.Err()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TestClient checks that the client retries transient failures, with the
+// same idempotency key for ShipOrder, and returns typed errors.
+func TestClient(t *testing.T) {
+	fake := &fakeService{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(fake.failFirst()))
+	pb.RegisterShippingServiceServer(srv, fake)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	c, err := NewClient(lis.Addr().String(), WithInstrumentation(otelgrpc.WithTracerProvider(tp)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, caller := tp.Tracer("test").Start(context.Background(), "caller")
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}
+	if _, err := c.GetQuote(ctx, &pb.GetQuoteRequest{Items: items}); err != nil {
+		t.Errorf("TestClient: GetQuote was not retried: %v", err)
+	}
+	if _, err := c.ShipOrder(ctx, &pb.ShipOrderRequest{Items: items}); err != nil {
+		t.Errorf("TestClient: ShipOrder was not retried: %v", err)
+	}
+	if len(fake.keys) != 2 || fake.keys[0] == "" || fake.keys[0] != fake.keys[1] {
+		t.Errorf("TestClient: ShipOrder attempts had idempotency keys %q, want the same one twice", fake.keys)
+	}
+	caller.End()
+	retries := 0
+	for _, ev := range rec.Ended()[len(rec.Ended())-1].Events() {
+		if ev.Name == "shippingclient.retry" {
+			retries++
+		}
+	}
+	if retries != 2 {
+		t.Errorf("TestClient: %d retry events on the caller span, want 2", retries)
+	}
+
+	_, err = c.GetTrackingStatus(ctx, &pb.GetTrackingStatusRequest{TrackingId: "nope"})
+	var e *Error
+	if !errors.Is(err, ErrMalformedTrackingID) || !errors.As(err, &e) || e.Violations["tracking_id"] == "" ||
+		status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TestClient: malformed tracking ID returned %#v", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shippingclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is an error returned by the shipping service. The service says why
+// a call failed in an ErrorInfo, whose reason is stable where messages are
+// not: compare errors with the Err values below using errors.Is.
+type Error struct {
+	Code codes.Code
+	// Reason is the ErrorInfo reason, such as "QUOTE_EXPIRED", or empty if
+	// the error did not come from the service itself.
+	Reason   string
+	Metadata map[string]string
+	Message  string
+	// RetryDelay is how long the service asked to wait before a retry, or 0.
+	RetryDelay time.Duration
+	// Violations maps the invalid fields of a request to what is wrong with
+	// them.
+	Violations map[string]string
+
+	status *status.Status
+}
+
+// The errors of the shipping service, by reason.
+var (
+	ErrInvalidAddress      = &Error{Reason: "INVALID_ADDRESS"}
+	ErrInvalidArgument     = &Error{Reason: "INVALID_ARGUMENT"}
+	ErrBatchTooLarge       = &Error{Reason: "BATCH_TOO_LARGE"}
+	ErrMalformedTrackingID = &Error{Reason: "MALFORMED_TRACKING_ID"}
+	ErrShipmentNotFound    = &Error{Reason: "SHIPMENT_NOT_FOUND"}
+	ErrInvalidTransition   = &Error{Reason: "INVALID_SHIPMENT_TRANSITION"}
+	ErrQuoteExpired        = &Error{Reason: "QUOTE_EXPIRED"}
+	ErrQuoteMismatch       = &Error{Reason: "QUOTE_MISMATCH"}
+	ErrBackendUnavailable  = &Error{Reason: "BACKEND_UNAVAILABLE"}
+	ErrServerTimeout       = &Error{Reason: "SERVER_TIMEOUT"}
+	ErrInjectedFault       = &Error{Reason: "INJECTED_FAULT"}
+	ErrRateLimited         = &Error{Reason: "RATE_LIMITED"}
+	ErrQuotaExceeded       = &Error{Reason: "QUOTA_EXCEEDED"}
+	ErrOverloaded          = &Error{Reason: "OVERLOADED"}
+	ErrInternal            = &Error{Reason: "INTERNAL"}
+)
+
+func (e *Error) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("shipping: %s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("shipping: %s (%s): %s", e.Code, e.Reason, e.Message)
+}
+
+// Is reports whether target is an Error with the same reason.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Reason != "" && t.Reason == e.Reason
+}
+
+// GRPCStatus returns the status the error was made from, so that
+// status.Code and status.FromError keep working.
+func (e *Error) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// Temporary reports whether the call may succeed if it is made again: the
+// service is unavailable, or it asked for a retry after a delay.
+func (e *Error) Temporary() bool {
+	return temporaryCodes[e.Code] || e.RetryDelay > 0
+}
+
+// fromStatus turns the error of a call into an *Error, if it has a status.
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	e := &Error{Code: st.Code(), Message: st.Message(), status: st}
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			e.Reason, e.Metadata = d.GetReason(), d.GetMetadata()
+		case *errdetails.RetryInfo:
+			e.RetryDelay = d.GetRetryDelay().AsDuration()
+		case *errdetails.BadRequest:
+			e.Violations = make(map[string]string)
+			for _, v := range d.GetFieldViolations() {
+				e.Violations[v.GetField()] = v.GetDescription()
+			}
+		}
+	}
+	return e
+}
+
+// errorInterceptor returns the errors of unary calls as *Error.
+func errorInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return fromStatus(invoker(ctx, method, req, reply, cc, opts...))
+}
+
+// streamErrorInterceptor returns the errors of streaming calls as *Error.
+func streamErrorInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return errorStream{s}, nil
+}
+
+type errorStream struct {
+	grpc.ClientStream
+}
+
+func (s errorStream) SendMsg(m any) error {
+	return fromStatus(s.ClientStream.SendMsg(m))
+}
+
+func (s errorStream) RecvMsg(m any) error {
+	return fromStatus(s.ClientStream.RecvMsg(m))
+}
@@ -15,16 +15,23 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
 )
 
 // TestGetQuote is a basic check on the GetQuote RPC service.
 func TestGetQuote(t *testing.T) {
-	s := server{}
+	s := newServer()
 
 	// A basic test case to test logic and protobuf interactions.
 	req := &pb.GetQuoteRequest{
@@ -57,7 +64,7 @@ func TestGetQuote(t *testing.T) {
 
 // TestShipOrder is a basic check on the ShipOrder RPC service.
 func TestShipOrder(t *testing.T) {
-	s := server{}
+	s := newServer()
 
 	// A basic test case to test logic and protobuf interactions.
 	req := &pb.ShipOrderRequest{
@@ -83,8 +90,347 @@ func TestShipOrder(t *testing.T) {
 	if err != nil {
 		t.Errorf("TestShipOrder (%v) failed", err)
 	}
-	// @todo improve quality of this test to check for a pattern such as '[A-Z]{2}-\d+-\d+'.
 	if len(res.TrackingId) != 18 {
 		t.Errorf("TestShipOrder: Tracking ID is malformed - has %d characters, %d expected", len(res.TrackingId), 18)
 	}
+	if err := ValidateTrackingId(res.TrackingId); err != nil {
+		t.Errorf("TestShipOrder: %v", err)
+	}
+}
+
+// TestCancelShipment checks that only shipments which are not yet in transit can be cancelled.
+func TestCancelShipment(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+
+	res, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{
+		Address: &pb.Address{
+			StreetAddress: "Muffin Man",
+			City:          "London",
+			Country:       "England",
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestCancelShipment: ShipOrder (%v) failed", err)
+	}
+
+	cancelled, err := s.CancelShipment(ctx, &pb.CancelShipmentRequest{TrackingId: res.TrackingId})
+	if err != nil {
+		t.Fatalf("TestCancelShipment: CancelShipment (%v) failed", err)
+	}
+	if cancelled.Status != pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED {
+		t.Errorf("TestCancelShipment: status is %s, expected %s", cancelled.Status, pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED)
+	}
+
+	// A cancelled shipment cannot be cancelled again.
+	_, err = s.CancelShipment(ctx, &pb.CancelShipmentRequest{TrackingId: res.TrackingId})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("TestCancelShipment: second cancel returned %v, expected %s", err, codes.FailedPrecondition)
+	}
+
+	// Nor can a shipment that is already in transit.
+	res, _ = s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: &pb.Address{ZipCode: 94043}})
+	if _, err := s.shipments.transition(ctx, defaultTenant, res.TrackingId, pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT); err != nil {
+		t.Fatalf("TestCancelShipment: transition (%v) failed", err)
+	}
+	_, err = s.CancelShipment(ctx, &pb.CancelShipmentRequest{TrackingId: res.TrackingId})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("TestCancelShipment: cancel in transit returned %v, expected %s", err, codes.FailedPrecondition)
+	}
+
+	_, err = s.CancelShipment(ctx, &pb.CancelShipmentRequest{TrackingId: "does-not-exist"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("TestCancelShipment: cancel of unknown shipment returned %v, expected %s", err, codes.NotFound)
+	}
+}
+
+// TestShipOrders checks that every order in a batch gets its own result.
+func TestShipOrders(t *testing.T) {
+	s := newServer()
+
+	req := &pb.ShipOrdersRequest{}
+	for i := 0; i < 10; i++ {
+		req.Orders = append(req.Orders, &pb.ShipOrderRequest{
+			Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"},
+		})
+	}
+
+	res, err := s.ShipOrders(context.Background(), req)
+	if err != nil {
+		t.Fatalf("TestShipOrders (%v) failed", err)
+	}
+	if len(res.Results) != len(req.Orders) {
+		t.Fatalf("TestShipOrders: got %d results, expected %d", len(res.Results), len(req.Orders))
+	}
+	for i, r := range res.Results {
+		if r.Code != int32(codes.OK) || r.TrackingId == "" {
+			t.Errorf("TestShipOrders: order %d failed with code %d: %s", i, r.Code, r.Error)
+		}
+	}
+}
+
+// TestShipOrderIdempotency checks that retries with the same idempotency key return the original tracking ID.
+func TestShipOrderIdempotency(t *testing.T) {
+	s := newServer()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotencyKeyHeader, "order-42"))
+	req := &pb.ShipOrderRequest{Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}}
+
+	first, err := s.ShipOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("TestShipOrderIdempotency (%v) failed", err)
+	}
+	second, err := s.ShipOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("TestShipOrderIdempotency (%v) failed", err)
+	}
+	if first.TrackingId != second.TrackingId {
+		t.Errorf("TestShipOrderIdempotency: got tracking IDs %q and %q, expected them to match", first.TrackingId, second.TrackingId)
+	}
+}
+
+// TestShipOrdersIdempotency checks that the orders of a batch sent with an
+// idempotency key are each shipped, and that a retry of the batch returns
+// their original tracking IDs.
+func TestShipOrdersIdempotency(t *testing.T) {
+	s := newServer()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotencyKeyHeader, "batch-1"))
+	req := &pb.ShipOrdersRequest{Orders: []*pb.ShipOrderRequest{
+		{Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}},
+		{Address: &pb.Address{StreetAddress: "221B Baker Street", City: "London", Country: "England"}},
+	}}
+
+	first, err := s.ShipOrders(ctx, req)
+	if err != nil {
+		t.Fatalf("TestShipOrdersIdempotency (%v) failed", err)
+	}
+	a, b := first.Results[0].TrackingId, first.Results[1].TrackingId
+	if a == "" || b == "" || a == b {
+		t.Fatalf("TestShipOrdersIdempotency: got tracking IDs %q and %q, expected two shipments", a, b)
+	}
+	for _, id := range []string{a, b} {
+		if _, err := s.shipments.get(context.Background(), defaultTenant, id); err != nil {
+			t.Errorf("TestShipOrdersIdempotency: shipment %s was not saved: %v", id, err)
+		}
+	}
+	retry, err := s.ShipOrders(ctx, req)
+	if err != nil {
+		t.Fatalf("TestShipOrdersIdempotency (%v) failed", err)
+	}
+	if retry.Results[0].TrackingId != a || retry.Results[1].TrackingId != b {
+		t.Errorf("TestShipOrdersIdempotency: retry got tracking IDs %q and %q, expected %q and %q",
+			retry.Results[0].TrackingId, retry.Results[1].TrackingId, a, b)
+	}
+}
+
+// flakyShipmentRepository fails the next insert when fail is set.
+type flakyShipmentRepository struct {
+	ShipmentRepository
+	fail bool
+}
+
+func (r *flakyShipmentRepository) insert(ctx context.Context, sh shipment, e historyEntry, rec outboxRecord, quota int) error {
+	if r.fail {
+		r.fail = false
+		return errors.New("connection refused")
+	}
+	return r.ShipmentRepository.insert(ctx, sh, e, rec, quota)
+}
+
+// TestShipOrderIdempotencyRetry checks that a request whose shipment could not be saved does not keep its
+// idempotency key, so that its retry creates the shipment.
+func TestShipOrderIdempotencyRetry(t *testing.T) {
+	s := newServer()
+	repo := &flakyShipmentRepository{ShipmentRepository: newMemoryShipmentRepository(), fail: true}
+	s.shipments = newShipmentStore(repo)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotencyKeyHeader, "order-43"))
+	req := &pb.ShipOrderRequest{Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}}
+
+	if _, err := s.ShipOrder(ctx, req); status.Code(err) != codes.Unavailable {
+		t.Fatalf("TestShipOrderIdempotencyRetry: got %v for a failed save, expected %s", err, codes.Unavailable)
+	}
+	retry, err := s.ShipOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("TestShipOrderIdempotencyRetry (%v) failed", err)
+	}
+	if _, err := s.shipments.get(ctx, defaultTenant, retry.TrackingId); err != nil {
+		t.Errorf("TestShipOrderIdempotencyRetry: retry returned tracking ID %q, which was not saved: %v", retry.TrackingId, err)
+	}
+	again, err := s.ShipOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("TestShipOrderIdempotencyRetry (%v) failed", err)
+	}
+	if again.TrackingId != retry.TrackingId {
+		t.Errorf("TestShipOrderIdempotencyRetry: got tracking IDs %q and %q, expected them to match", retry.TrackingId, again.TrackingId)
+	}
+}
+
+// TestIdempotencyPending checks that a key held by a request in progress is neither handed out nor claimed again.
+func TestIdempotencyPending(t *testing.T) {
+	ctx := context.Background()
+	st := newMemoryIdempotencyStore(defaultIdempotencyTTL)
+	if _, claimed, err := st.claim(ctx, "k", "AB-1"); !claimed || err != nil {
+		t.Fatalf("TestIdempotencyPending: first claim returned %v, %v", claimed, err)
+	}
+	if _, _, err := st.claim(ctx, "k", "AB-2"); !errors.Is(err, errIdempotencyPending) {
+		t.Errorf("TestIdempotencyPending: claim of a pending key returned %v, expected %v", err, errIdempotencyPending)
+	}
+	st.release(ctx, "k", "AB-2")
+	if _, _, err := st.claim(ctx, "k", "AB-2"); !errors.Is(err, errIdempotencyPending) {
+		t.Errorf("TestIdempotencyPending: release by another request dropped the claim")
+	}
+	st.complete(ctx, "k", "AB-1")
+	if id, claimed, err := st.claim(ctx, "k", "AB-3"); id != "AB-1" || claimed || err != nil {
+		t.Errorf("TestIdempotencyPending: claim of a completed key returned %q, %v, %v", id, claimed, err)
+	}
+}
+
+// TestShipOrderWithQuote checks that an order placed against a quote is charged the quoted price.
+func TestShipOrderWithQuote(t *testing.T) {
+	s := newServer()
+	addr := &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}
+	items := []*pb.CartItem{{ProductId: "23", Quantity: 2}}
+
+	quote, err := s.GetQuote(context.Background(), &pb.GetQuoteRequest{Address: addr, Items: items})
+	if err != nil {
+		t.Fatalf("TestShipOrderWithQuote (%v) failed", err)
+	}
+	if quote.QuoteId == "" || quote.ExpiresAt == nil {
+		t.Fatalf("TestShipOrderWithQuote: quote has no ID or expiry")
+	}
+	res, err := s.ShipOrder(context.Background(), &pb.ShipOrderRequest{Address: addr, Items: items, QuoteId: quote.QuoteId})
+	if err != nil {
+		t.Fatalf("TestShipOrderWithQuote (%v) failed", err)
+	}
+	if res.CostUsd.GetUnits() != quote.CostUsd.GetUnits() || res.CostUsd.GetNanos() != quote.CostUsd.GetNanos() {
+		t.Errorf("TestShipOrderWithQuote: charged %v, expected the quoted %v", res.CostUsd, quote.CostUsd)
+	}
+
+	heavier := []*pb.CartItem{{ProductId: "23", Quantity: 20}}
+	_, err = s.ShipOrder(context.Background(), &pb.ShipOrderRequest{Address: addr, Items: heavier, QuoteId: quote.QuoteId})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("TestShipOrderWithQuote: got %v for a mismatched order, expected FailedPrecondition", err)
+	}
+	// Paris is in the same zone as London, but duties, taxes and distance
+	// depend on the country and city.
+	paris := &pb.Address{StreetAddress: "1 Rue de Rivoli", City: "Paris", Country: "France"}
+	_, err = s.ShipOrder(context.Background(), &pb.ShipOrderRequest{Address: paris, Items: items, QuoteId: quote.QuoteId})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("TestShipOrderWithQuote: got %v for another address in the zone, expected FailedPrecondition", err)
+	}
+	empty, err := s.GetQuote(context.Background(), &pb.GetQuoteRequest{Address: addr})
+	if err != nil {
+		t.Fatalf("TestShipOrderWithQuote (%v) failed", err)
+	}
+	_, err = s.ShipOrder(context.Background(), &pb.ShipOrderRequest{Address: addr, Items: []*pb.CartItem{{ProductId: "23", Quantity: 1}}, QuoteId: empty.QuoteId})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("TestShipOrderWithQuote: got %v for an order at an empty cart's quote, expected FailedPrecondition", err)
+	}
+}
+
+// TestShipOrderWithExpiredQuote checks that stale and unknown quotes are refused.
+func TestShipOrderWithExpiredQuote(t *testing.T) {
+	s := newServer()
+	s.validity = -time.Second
+	addr := &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}
+
+	quote, err := s.GetQuote(context.Background(), &pb.GetQuoteRequest{Address: addr})
+	if err != nil {
+		t.Fatalf("TestShipOrderWithExpiredQuote (%v) failed", err)
+	}
+	for _, id := range []string{quote.QuoteId, "no-such-quote"} {
+		_, err = s.ShipOrder(context.Background(), &pb.ShipOrderRequest{Address: addr, QuoteId: id})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("TestShipOrderWithExpiredQuote: got %v for quote %q, expected FailedPrecondition", err, id)
+		}
+	}
+}
+
+// TestShipOrderInvalidZip checks that bad zip codes are rejected with field violations.
+func TestShipOrderInvalidZip(t *testing.T) {
+	s := newServer()
+	for _, addr := range []*pb.Address{
+		{StreetAddress: "1600 Amphitheatre Pkwy", City: "Mountain View", Country: "USA"},
+		{StreetAddress: "1600 Amphitheatre Pkwy", City: "Mountain View", ZipCode: 940430},
+		{StreetAddress: "Muffin Man", City: "London", Country: "England", ZipCode: -1},
+	} {
+		_, err := s.ShipOrder(context.Background(), &pb.ShipOrderRequest{Address: addr})
+		st := status.Convert(err)
+		if st.Code() != codes.InvalidArgument {
+			t.Errorf("TestShipOrderInvalidZip: zip %d returned %v, expected %s", addr.ZipCode, err, codes.InvalidArgument)
+			continue
+		}
+		var br *errdetails.BadRequest
+		for _, d := range st.Details() {
+			if v, ok := d.(*errdetails.BadRequest); ok {
+				br = v
+			}
+		}
+		if br == nil || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != "address.zip_code" {
+			t.Errorf("TestShipOrderInvalidZip: zip %d returned details %v, expected a zip_code violation", addr.ZipCode, st.Details())
+		}
+	}
+}
+
+// TestCreateQuoteFromFloat checks that prices are rounded to the cent and formatted with two decimals.
+func TestCreateQuoteFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{5.05, "$5.05"},
+		{0.29, "$0.29"},
+		{8.99, "$8.99"},
+		{12.5, "$12.50"},
+	}
+	for _, tt := range tests {
+		if got := CreateQuoteFromFloat(tt.in).String(); got != tt.want {
+			t.Errorf("TestCreateQuoteFromFloat: quote for %v is %q, expected %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// quietLogs sends the logs of a benchmark nowhere, at the info level the
+// service logs at by default, so that formatting them is still measured.
+func quietLogs(b *testing.B) {
+	saved := log
+	l, err := newLogger(io.Discard, "info", "json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	log = l
+	b.Cleanup(func() { log = saved })
+}
+
+var benchmarkAddress = &pb.Address{
+	StreetAddress: "1600 Amphitheatre Parkway",
+	City:          "Mountain View",
+	State:         "CA",
+	Country:       "USA",
+	ZipCode:       94043,
+}
+
+func BenchmarkGetQuote(b *testing.B) {
+	quietLogs(b)
+	s := newServer()
+	ctx := context.Background()
+	req := &pb.GetQuoteRequest{Address: benchmarkAddress, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 3}}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetQuote(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkShipOrder(b *testing.B) {
+	quietLogs(b)
+	s := newServer()
+	ctx := context.Background()
+	req := &pb.ShipOrderRequest{Address: benchmarkAddress, Items: []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 3}}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.ShipOrder(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,95 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultSMSFrom    = "+15550100"
+	defaultSMSLatency = "40ms/150ms/600ms"
+	smsAccountSID     = "AC0000000000000000000000000000ws"
+	smsSegmentLength  = 160
+)
+
+// smsSender sends notifications as text messages through a fake, in-process
+// SMS API shaped like Twilio's. Each send is traced as the HTTP call it
+// stands for and fails as often as the availability dictates, so that
+// retries can be seen in the traces.
+type smsSender struct {
+	to           string
+	from         string
+	availability float64
+	latency      latencyShape
+}
+
+// smsSenderFromEnv returns a sender texting NOTIFY_SMS_TO, or nil if it is not
+// set, with the availability and latency of SMS_AVAILABILITY and SMS_LATENCY.
+func smsSenderFromEnv() *smsSender {
+	to := os.Getenv("NOTIFY_SMS_TO")
+	if to == "" {
+		return nil
+	}
+	spec := os.Getenv("SMS_LATENCY")
+	if spec == "" {
+		spec = defaultSMSLatency
+	}
+	shapes, err := parseLatencyShapes("Send=" + spec)
+	if err != nil {
+		log.Fatalf("invalid SMS_LATENCY: %v", err)
+	}
+	s := &smsSender{to: to, from: os.Getenv("NOTIFY_SMS_FROM"), availability: envFloat("SMS_AVAILABILITY", 1), latency: shapes["Send"]}
+	if s.from == "" {
+		s.from = defaultSMSFrom
+	}
+	log.Infof("texting notifications to %s through the fake SMS API: availability %v, latency p50/p95/p99 %s", to, s.availability, spec)
+	return s
+}
+
+func (s *smsSender) channel() string { return "sms" }
+
+func (s *smsSender) send(ctx context.Context, n notification) error {
+	text := strings.TrimSpace(n.body)
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("server.address", "api.sms.example"),
+		attribute.String("http.request.method", http.MethodPost),
+		attribute.String("url.path", "/2010-04-01/Accounts/"+smsAccountSID+"/Messages.json"),
+		attribute.String("sms.to", s.to),
+		attribute.Int("sms.segments", (len(text)+smsSegmentLength-1)/smsSegmentLength),
+	)
+
+	if err := sleepContext(ctx, s.latency.sample()); err != nil {
+		return err
+	}
+	if random.Float64() >= s.availability {
+		span.SetAttributes(attribute.Int("http.response.status_code", http.StatusServiceUnavailable))
+		return fmt.Errorf("SMS API returned %d %s", http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+	}
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", http.StatusCreated),
+		attribute.String("sms.message_sid", "SM"+strings.ReplaceAll(newID("sms:"+n.trackingID), "-", "")),
+	)
+	log.Ctx(ctx).Infof("text to %s: %s", s.to, text)
+	return nil
+}
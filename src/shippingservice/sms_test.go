@@ -0,0 +1,87 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestSMSSender checks that the fake SMS API fails as often as its
+// availability says.
+func TestSMSSender(t *testing.T) {
+	n := notification{trackingID: "AB-123", body: "Your order is on its way.\n"}
+	up := &smsSender{to: "+15550199", availability: 1}
+	if err := up.send(context.Background(), n); err != nil {
+		t.Errorf("TestSMSSender: send with availability 1 failed: %v", err)
+	}
+	down := &smsSender{to: "+15550199", availability: 0}
+	if err := down.send(context.Background(), n); err == nil {
+		t.Error("TestSMSSender: send with availability 0 succeeded")
+	}
+}
+
+// TestNotificationFanOut checks that a shipment sends a message over every
+// channel, each in a branch of the ShipOrder trace.
+func TestNotificationFanOut(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	s := newServer()
+	s.notify = newNotificationPipeline([]notificationSender{
+		&emailSender{from: defaultEmailFrom, to: "ops@example.com"},
+		&smsSender{to: "+15550199", availability: 1},
+	}, 2, 1)
+
+	ctx, span := tracer.Start(context.Background(), "ShipOrder")
+	_, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: &pb.Address{StreetAddress: "Muffin Man", City: "London", Country: "England"}})
+	span.End()
+	if err != nil {
+		t.Fatalf("TestNotificationFanOut: ShipOrder failed: %v", err)
+	}
+	if n := len(s.notify.queue); n != 2 {
+		t.Fatalf("TestNotificationFanOut: %d notifications queued, want 2", n)
+	}
+	runCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.notify.deliver(runCtx, <-s.notify.queue)
+	s.notify.deliver(runCtx, <-s.notify.queue)
+
+	sends := map[string]bool{}
+	for _, sp := range rec.Ended() {
+		switch sp.Name() {
+		case "notification.deliver":
+			if sp.Parent().SpanID() != span.SpanContext().SpanID() {
+				t.Errorf("TestNotificationFanOut: notification.deliver has parent %v, want the ShipOrder span", sp.Parent())
+			}
+		case "email.send", "sms.send":
+			sends[sp.Name()] = true
+			if sp.SpanContext().TraceID() != span.SpanContext().TraceID() {
+				t.Errorf("TestNotificationFanOut: %s is not in the ShipOrder trace", sp.Name())
+			}
+		}
+	}
+	if !sends["email.send"] || !sends["sms.send"] {
+		t.Errorf("TestNotificationFanOut: sent over %v, want email and sms", sends)
+	}
+}
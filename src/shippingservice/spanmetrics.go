@@ -0,0 +1,99 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanMetrics is a span processor that derives call counts and latency
+// histograms from finished spans, named and labelled like the collector's
+// spanmetrics connector, so the dashboards built on it work when the service
+// runs without a collector.
+type spanMetrics struct {
+	calls    metric.Int64Counter
+	duration metric.Float64Histogram
+	// dimensions are span attributes copied onto the metrics, if present.
+	dimensions []attribute.Key
+}
+
+func newSpanMetrics(dimensions []string) *spanMetrics {
+	m := &spanMetrics{dimensions: attributeKeys(dimensions)}
+	var err error
+	if m.calls, err = meter.Int64Counter("traces.span.metrics.calls",
+		metric.WithDescription("Spans finished, by name, kind and status."),
+		metric.WithUnit("{call}"),
+	); err != nil {
+		log.WithError(err).Warn("failed to create span calls metric")
+	}
+	if m.duration, err = meter.Float64Histogram("traces.span.metrics.duration",
+		metric.WithDescription("Duration of finished spans, by name, kind and status."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(redBuckets...),
+	); err != nil {
+		log.WithError(err).Warn("failed to create span duration metric")
+	}
+	return m
+}
+
+// spanMetricsFromEnv returns the processor if SPAN_METRICS is true, with the
+// extra dimensions listed in SPAN_METRICS_DIMENSIONS, or nil.
+func spanMetricsFromEnv() *spanMetrics {
+	if !envBool("SPAN_METRICS", false) {
+		return nil
+	}
+	dims := splitList(os.Getenv("SPAN_METRICS_DIMENSIONS"))
+	log.Infof("deriving metrics from spans with dimensions %v", dims)
+	return newSpanMetrics(dims)
+}
+
+func (m *spanMetrics) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (m *spanMetrics) OnEnd(s sdktrace.ReadOnlySpan) {
+	attrs := []attribute.KeyValue{
+		attribute.String("span.name", s.Name()),
+		attribute.String("span.kind", "SPAN_KIND_"+strings.ToUpper(s.SpanKind().String())),
+		attribute.String("status.code", "STATUS_CODE_"+strings.ToUpper(s.Status().Code.String())),
+	}
+	if len(m.dimensions) > 0 {
+		for _, kv := range s.Attributes() {
+			for _, k := range m.dimensions {
+				if kv.Key == k {
+					attrs = append(attrs, kv)
+				}
+			}
+		}
+	}
+	// Recording under the span's context lets the SDK attach it as an
+	// exemplar when the span was sampled.
+	ctx := trace.ContextWithSpanContext(context.Background(), s.SpanContext())
+	opt := metric.WithAttributes(attrs...)
+	if m.calls != nil {
+		m.calls.Add(ctx, 1, opt)
+	}
+	if m.duration != nil {
+		m.duration.Record(ctx, s.EndTime().Sub(s.StartTime()).Seconds(), opt)
+	}
+}
+
+func (m *spanMetrics) Shutdown(context.Context) error   { return nil }
+func (m *spanMetrics) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,86 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestSpanMetrics checks that finished spans are counted and timed by name, kind, status and dimension.
+func TestSpanMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	saved := meter
+	meter = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(serviceName)
+	defer func() { meter = saved }()
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newSpanMetrics([]string{"rpc.method"})))
+	tr := tp.Tracer("test")
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, span := tr.Start(ctx, "hipstershop.ShippingService/GetQuote", trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("rpc.method", "GetQuote"), attribute.String("city", "London")))
+		span.End()
+	}
+	_, span := tr.Start(ctx, "renderLabel")
+	span.SetStatus(otelcodes.Error, "boom")
+	span.End()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("TestSpanMetrics: %v", err)
+	}
+	calls := map[string]int64{}
+	var observations uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					if dp.Attributes.HasValue("city") {
+						t.Errorf("TestSpanMetrics: %v has an attribute that is not a dimension", dp.Attributes.ToSlice())
+					}
+					name, _ := dp.Attributes.Value("span.name")
+					kind, _ := dp.Attributes.Value("span.kind")
+					code, _ := dp.Attributes.Value("status.code")
+					method, _ := dp.Attributes.Value("rpc.method")
+					calls[name.AsString()+"/"+kind.AsString()+"/"+code.AsString()+"/"+method.AsString()] += dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					observations += dp.Count
+				}
+			}
+		}
+	}
+	for k, v := range map[string]int64{
+		"hipstershop.ShippingService/GetQuote/SPAN_KIND_SERVER/STATUS_CODE_UNSET/GetQuote": 2,
+		"renderLabel/SPAN_KIND_INTERNAL/STATUS_CODE_ERROR/":                                1,
+	} {
+		if calls[k] != v {
+			t.Errorf("TestSpanMetrics: %s = %d, expected %d (got %v)", k, calls[k], v, calls)
+		}
+	}
+	if observations != 3 {
+		t.Errorf("TestSpanMetrics: %d durations recorded, expected 3", observations)
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const shipmentColumns = "tenant, tracking_id, status, address, items, created_at, updated_at, origin_trace_id, origin_span_id, label"
+
+// sqlShipmentRepository keeps shipments in the shipments table and their
+// history in shipment_events, of SQLite or Postgres. Times are stored in UTC.
+// The outbox is the outbox table, written in the transaction of the change an
+// event describes.
+type sqlShipmentRepository struct {
+	db *database
+}
+
+func newSQLShipmentRepository(db *database) *sqlShipmentRepository {
+	return &sqlShipmentRepository{db: db}
+}
+
+func (r *sqlShipmentRepository) insert(ctx context.Context, sh shipment, e historyEntry, rec outboxRecord, quota int) error {
+	address, err := json.Marshal(sh.Address)
+	if err != nil {
+		return err
+	}
+	items, err := json.Marshal(sh.Items)
+	if err != nil {
+		return err
+	}
+	var traceID, spanID string
+	if sh.Origin.IsValid() {
+		traceID, spanID = sh.Origin.TraceID().String(), sh.Origin.SpanID().String()
+	}
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if quota > 0 {
+			// Concurrent inserts of a tenant are serialised, so that they
+			// cannot all count fewer live shipments than the quota. SQLite
+			// has a single connection, and so a single transaction at a time.
+			if r.db.dialect == dialectPostgres {
+				if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "shipments:"+sh.Tenant); err != nil {
+					return err
+				}
+			}
+			n, err := r.countLive(ctx, tx, sh.Tenant)
+			if err != nil {
+				return err
+			}
+			if n >= quota {
+				return errQuotaExceeded
+			}
+		}
+		if _, err := tx.ExecContext(ctx, r.db.rebind("INSERT INTO shipments ("+shipmentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+			sh.Tenant, sh.TrackingID, int32(sh.Status), string(address), string(items),
+			sh.CreatedAt.UTC(), sh.UpdatedAt.UTC(), traceID, spanID, sh.Label); err != nil {
+			return err
+		}
+		if err := r.appendEvent(ctx, tx, sh.Tenant, sh.TrackingID, e); err != nil {
+			return err
+		}
+		return r.appendOutbox(ctx, tx, rec)
+	})
+}
+
+func (r *sqlShipmentRepository) get(ctx context.Context, tenant, id string) (shipment, error) {
+	row := r.db.QueryRowContext(ctx, r.db.rebind("SELECT "+shipmentColumns+" FROM shipments WHERE tenant = ? AND tracking_id = ?"), tenant, id)
+	sh, err := scanShipment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return shipment{}, errShipmentNotFound
+	}
+	return sh, err
+}
+
+func (r *sqlShipmentRepository) update(ctx context.Context, sh shipment, from pb.ShipmentStatus, e historyEntry, rec outboxRecord) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		// The status is only changed from the one the state machine was
+		// checked against, whatever another replica did in the meantime.
+		res, err := tx.ExecContext(ctx, r.db.rebind("UPDATE shipments SET status = ?, updated_at = ? WHERE tenant = ? AND tracking_id = ? AND status = ?"),
+			int32(sh.Status), sh.UpdatedAt.UTC(), sh.Tenant, sh.TrackingID, int32(from))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("%w: %s is no longer %s", errInvalidTransition, sh.TrackingID, from)
+		}
+		if err := r.appendEvent(ctx, tx, sh.Tenant, sh.TrackingID, e); err != nil {
+			return err
+		}
+		return r.appendOutbox(ctx, tx, rec)
+	})
+}
+
+func (r *sqlShipmentRepository) setLabel(ctx context.Context, tenant, id string, label []byte) error {
+	res, err := r.db.ExecContext(ctx, r.db.rebind("UPDATE shipments SET label = ? WHERE tenant = ? AND tracking_id = ?"), label, tenant, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errShipmentNotFound
+	}
+	return nil
+}
+
+func (r *sqlShipmentRepository) live(ctx context.Context, tenant string) (int, error) {
+	return r.countLive(ctx, r.db, tenant)
+}
+
+// countLive counts the live shipments of tenant, in the database or in a
+// transaction.
+func (r *sqlShipmentRepository) countLive(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, tenant string) (int, error) {
+	args := []any{tenant}
+	for status := range transitions {
+		args = append(args, int32(status))
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)-1), ", ")
+	var n int
+	err := q.QueryRowContext(ctx, r.db.rebind("SELECT COUNT(*) FROM shipments WHERE tenant = ? AND status IN ("+placeholders+")"), args...).Scan(&n)
+	return n, err
+}
+
+func (r *sqlShipmentRepository) due(ctx context.Context, now time.Time, after map[pb.ShipmentStatus]time.Duration) ([]shipment, error) {
+	var out []shipment
+	for status, d := range after {
+		rows, err := r.db.QueryContext(ctx, r.db.rebind("SELECT "+shipmentColumns+" FROM shipments WHERE status = ? AND updated_at <= ?"),
+			int32(status), now.Add(-d).UTC())
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			sh, err := scanShipment(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			out = append(out, sh)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.Before(out[j].UpdatedAt) })
+	return out, nil
+}
+
+func (r *sqlShipmentRepository) history(ctx context.Context, tenant, id string) ([]historyEntry, error) {
+	rows, err := r.db.QueryContext(ctx, r.db.rebind(
+		"SELECT seq, event_id, previous_status, status, time, trace_id FROM shipment_events WHERE tenant = ? AND tracking_id = ? ORDER BY seq"),
+		tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []historyEntry
+	for rows.Next() {
+		var e historyEntry
+		var from, to int32
+		var traceID string
+		if err := rows.Scan(&e.Seq, &e.EventID, &from, &to, &e.Time, &traceID); err != nil {
+			return nil, err
+		}
+		e.From, e.To = pb.ShipmentStatus(from), pb.ShipmentStatus(to)
+		e.TraceID, _ = trace.TraceIDFromHex(traceID)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		return nil, errShipmentNotFound
+	}
+	return entries, nil
+}
+
+func (r *sqlShipmentRepository) purge(ctx context.Context, now time.Time, policy retentionPolicy) (purgeResult, error) {
+	var res purgeResult
+	for _, status := range []pb.ShipmentStatus{pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED, pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED} {
+		cutoff, _ := policy.cutoff(status, now)
+		var shipments int64
+		err := r.inTx(ctx, func(tx *sql.Tx) error {
+			events, err := tx.ExecContext(ctx, r.db.rebind(`DELETE FROM shipment_events WHERE EXISTS (
+    SELECT 1 FROM shipments s
+    WHERE s.tenant = shipment_events.tenant AND s.tracking_id = shipment_events.tracking_id
+    AND s.status = ? AND s.updated_at < ?)`), int32(status), cutoff.UTC())
+			if err != nil {
+				return err
+			}
+			n, err := events.RowsAffected()
+			if err != nil {
+				return err
+			}
+			res.events += int(n)
+			deleted, err := tx.ExecContext(ctx, r.db.rebind("DELETE FROM shipments WHERE status = ? AND updated_at < ?"), int32(status), cutoff.UTC())
+			if err != nil {
+				return err
+			}
+			shipments, err = deleted.RowsAffected()
+			return err
+		})
+		if err != nil {
+			return res, err
+		}
+		if status == pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED {
+			res.delivered = int(shipments)
+		} else {
+			res.cancelled = int(shipments)
+		}
+	}
+	return res, nil
+}
+
+func (r *sqlShipmentRepository) pendingEvents(ctx context.Context, limit int) ([]outboxRecord, error) {
+	rows, err := r.db.QueryContext(ctx, r.db.rebind("SELECT seq, event, carrier, created_at FROM outbox ORDER BY seq LIMIT ?"), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []outboxRecord
+	for rows.Next() {
+		var rec outboxRecord
+		var event, carrier []byte
+		if err := rows.Scan(&rec.Seq, &event, &carrier, &rec.Created); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(event, &rec.Event); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(carrier, &rec.Carrier); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// markPublished deletes the record seq alone: with concurrent transactions,
+// a record with a lower sequence number can commit after seq was read.
+func (r *sqlShipmentRepository) markPublished(ctx context.Context, seq int64) error {
+	_, err := r.db.ExecContext(ctx, r.db.rebind("DELETE FROM outbox WHERE seq = ?"), seq)
+	return err
+}
+
+// appendOutbox adds a record to the outbox, which numbers it.
+func (r *sqlShipmentRepository) appendOutbox(ctx context.Context, tx *sql.Tx, rec outboxRecord) error {
+	event, err := json.Marshal(rec.Event)
+	if err != nil {
+		return err
+	}
+	carrier, err := json.Marshal(rec.Carrier)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, r.db.rebind("INSERT INTO outbox (event, carrier, created_at) VALUES (?, ?, ?)"),
+		string(event), string(carrier), rec.Created.UTC())
+	return err
+}
+
+// appendEvent adds an entry to the end of a shipment's history.
+func (r *sqlShipmentRepository) appendEvent(ctx context.Context, tx *sql.Tx, tenant, id string, e historyEntry) error {
+	var last int64
+	if err := tx.QueryRowContext(ctx, r.db.rebind("SELECT COALESCE(MAX(seq), 0) FROM shipment_events WHERE tenant = ? AND tracking_id = ?"),
+		tenant, id).Scan(&last); err != nil {
+		return err
+	}
+	var traceID string
+	if e.TraceID.IsValid() {
+		traceID = e.TraceID.String()
+	}
+	_, err := tx.ExecContext(ctx, r.db.rebind(
+		"INSERT INTO shipment_events (tenant, tracking_id, seq, event_id, previous_status, status, time, trace_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"),
+		tenant, id, last+1, e.EventID, int32(e.From), int32(e.To), e.Time.UTC(), traceID)
+	return err
+}
+
+// inTx runs fn in a transaction, committed if fn succeeds.
+func (r *sqlShipmentRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanShipment reads a row of shipmentColumns.
+func scanShipment(row interface{ Scan(...any) error }) (shipment, error) {
+	var sh shipment
+	var status int32
+	var address, items []byte
+	var traceID, spanID string
+	if err := row.Scan(&sh.Tenant, &sh.TrackingID, &status, &address, &items,
+		&sh.CreatedAt, &sh.UpdatedAt, &traceID, &spanID, &sh.Label); err != nil {
+		return shipment{}, err
+	}
+	sh.Status = pb.ShipmentStatus(status)
+	if err := json.Unmarshal(address, &sh.Address); err != nil {
+		return shipment{}, err
+	}
+	if err := json.Unmarshal(items, &sh.Items); err != nil {
+		return shipment{}, err
+	}
+	tid, _ := trace.TraceIDFromHex(traceID)
+	sid, _ := trace.SpanIDFromHex(spanID)
+	sh.Origin = trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, Remote: true})
+	return sh, nil
+}
+
+// sqlQuoteRepository keeps issued quotes in the quotes table, so that an
+// order can be placed on a different replica than the quote.
+type sqlQuoteRepository struct {
+	db *database
+}
+
+func (r *sqlQuoteRepository) issue(ctx context.Context, q issuedQuote) error {
+	options, err := json.Marshal(q.Options)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, r.db.rebind(
+		"INSERT INTO quotes (id, dollars, cents, zone, weight_bucket, method, options, pricing, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		q.ID, int64(q.Price.Dollars), int64(q.Price.Cents), int(q.Zone), q.WeightBucket, int32(q.Method), string(options), q.Pricing, q.Expires.UTC())
+	return err
+}
+
+func (r *sqlQuoteRepository) lookup(ctx context.Context, id string) (issuedQuote, bool, error) {
+	q := issuedQuote{ID: id}
+	var dollars, cents int64
+	var z int
+	var method int32
+	var options string
+	err := r.db.QueryRowContext(ctx, r.db.rebind("SELECT dollars, cents, zone, weight_bucket, method, options, pricing, expires_at FROM quotes WHERE id = ?"), id).
+		Scan(&dollars, &cents, &z, &q.WeightBucket, &method, &options, &q.Pricing, &q.Expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return issuedQuote{}, false, nil
+	}
+	if err != nil {
+		return issuedQuote{}, false, err
+	}
+	q.Price = Quote{Dollars: uint32(dollars), Cents: uint32(cents)}
+	q.Zone, q.Method = zone(z), pb.ShippingMethod(method)
+	// Quotes issued before options were stored have none.
+	if options != "" {
+		if err := json.Unmarshal([]byte(options), &q.Options); err != nil {
+			return issuedQuote{}, false, err
+		}
+	}
+	return q, time.Now().Before(q.Expires), nil
+}
+
+func (r *sqlQuoteRepository) deleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := r.db.ExecContext(ctx, r.db.rebind("DELETE FROM quotes WHERE expires_at <= ?"), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	awsQueueSize = 256
+	awsTimeout   = 10 * time.Second
+
+	// awsMaxMessageAttributes is the most message attributes SQS and SNS
+	// accept.
+	awsMaxMessageAttributes = 10
+)
+
+// awsPublish is a message waiting to be sent, with the context of its
+// producer span.
+type awsPublish struct {
+	ctx   context.Context
+	ev    shipmentEvent
+	body  []byte
+	attrs map[string]string
+}
+
+// awsPublisher publishes shipment events to an SQS queue or an SNS topic
+// with the AWS SDK, which finds the credentials and signs the calls; otelaws
+// traces each call. The trace context goes in message attributes, which SNS
+// passes on to the queues and endpoints subscribed to the topic. As with
+// Kafka, Publish only queues the message: a worker sends it, and failures
+// are logged.
+type awsPublisher struct {
+	service string // sqs or sns
+	dest    string // queue URL or topic ARN
+	fifo    bool
+	sqs     *sqs.Client
+	sns     *sns.Client
+	encoder eventEncoder
+	queue   chan awsPublish
+}
+
+func newAWSPublisher(service, dest string, cfg aws.Config) *awsPublisher {
+	p := &awsPublisher{
+		service: service,
+		dest:    dest,
+		fifo:    strings.HasSuffix(dest, ".fifo"),
+		queue:   make(chan awsPublish, awsQueueSize),
+	}
+	if service == "sqs" {
+		p.sqs = sqs.NewFromConfig(cfg)
+	} else {
+		p.sns = sns.NewFromConfig(cfg)
+	}
+	go func() {
+		for pub := range p.queue {
+			if err := p.send(pub); err != nil {
+				log.Ctx(pub.ctx).WithError(err).Errorf("failed to publish event %s to %s", pub.ev.ID, p.dest)
+			}
+		}
+	}()
+	return p
+}
+
+// sqsPublisherFromEnv publishes to the queue at SQS_QUEUE_URL.
+func sqsPublisherFromEnv() *awsPublisher {
+	queueURL := os.Getenv("SQS_QUEUE_URL")
+	if queueURL == "" {
+		log.Fatal("EVENT_BUS=sqs requires SQS_QUEUE_URL to be set")
+	}
+	// https://sqs.<region>.amazonaws.com/<account>/<queue>
+	var region string
+	if u, err := url.Parse(queueURL); err == nil {
+		if parts := strings.Split(u.Host, "."); len(parts) == 4 && parts[0] == "sqs" {
+			region = parts[1]
+		}
+	}
+	return awsPublisherFromEnv("sqs", queueURL, region)
+}
+
+// snsPublisherFromEnv publishes to the topic SNS_TOPIC_ARN.
+func snsPublisherFromEnv() *awsPublisher {
+	arn := os.Getenv("SNS_TOPIC_ARN")
+	if arn == "" {
+		log.Fatal("EVENT_BUS=sns requires SNS_TOPIC_ARN to be set")
+	}
+	// arn:aws:sns:<region>:<account>:<topic>
+	var region string
+	if parts := strings.Split(arn, ":"); len(parts) == 6 {
+		region = parts[3]
+	}
+	return awsPublisherFromEnv("sns", arn, region)
+}
+
+// awsPublisherFromEnv loads the configuration of the AWS SDK: the region
+// comes from AWS_REGION or AWS_DEFAULT_REGION, or else from the destination,
+// and the credentials from the default chain.
+func awsPublisherFromEnv(service, dest, region string) *awsPublisher {
+	if v := os.Getenv("AWS_DEFAULT_REGION"); v != "" && os.Getenv("AWS_REGION") == "" {
+		region = v
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithDefaultRegion(region),
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(awsTimeout)))
+	if err != nil {
+		log.Fatalf("failed to load the AWS configuration: %v", err)
+	}
+	if cfg.Region == "" {
+		log.Fatalf("no AWS region for %s: set AWS_REGION", dest)
+	}
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+	p := newAWSPublisher(service, dest, cfg)
+	p.encoder = eventEncoderFromEnv()
+	log.Infof("publishing shipment events to %s %s in %s", strings.ToUpper(service), dest, cfg.Region)
+	return p
+}
+
+func (p *awsPublisher) Publish(ctx context.Context, ev shipmentEvent) error {
+	ctx, span := tracer.Start(ctx, p.dest+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("aws_"+p.service),
+			semconv.MessagingDestinationKey.String(p.dest),
+			awsDestinationKind(p.service),
+			semconv.MessagingMessageIDKey.String(ev.ID),
+		),
+	)
+	defer span.End()
+
+	body, err := p.encoder.encode(ctx, ev)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	attrs := map[string]string{
+		"event_type":   ev.Type,
+		"content-type": p.encoder.contentType(),
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(attrs))
+
+	select {
+	case p.queue <- awsPublish{ctx: detachedContext(ctx), ev: ev, body: body, attrs: attrs}:
+		return nil
+	default:
+		err := fmt.Errorf("%s queue is full", p.service)
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+}
+
+func awsDestinationKind(service string) attribute.KeyValue {
+	if service == "sqs" {
+		return semconv.MessagingDestinationKindQueue
+	}
+	return semconv.MessagingDestinationKindTopic
+}
+
+// send calls SQS SendMessage or SNS Publish with one message.
+func (p *awsPublisher) send(pub awsPublish) error {
+	names := awsAttributeNames(pub.attrs)
+	if p.service == "sqs" {
+		in := &sqs.SendMessageInput{
+			QueueUrl:          aws.String(p.dest),
+			MessageBody:       aws.String(string(pub.body)),
+			MessageAttributes: make(map[string]sqstypes.MessageAttributeValue, len(names)),
+		}
+		for _, k := range names {
+			in.MessageAttributes[k] = sqstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(pub.attrs[k])}
+		}
+		// Next to the W3C message attributes the trace goes in
+		// AWSTraceHeader, the system attribute that Lambda and X-Ray read.
+		if h := xrayTraceHeader(trace.SpanContextFromContext(pub.ctx)); h != "" {
+			in.MessageSystemAttributes = map[string]sqstypes.MessageSystemAttributeValue{
+				string(sqstypes.MessageSystemAttributeNameForSendsAWSTraceHeader): {DataType: aws.String("String"), StringValue: aws.String(h)},
+			}
+		}
+		if p.fifo {
+			in.MessageGroupId, in.MessageDeduplicationId = aws.String(pub.ev.TrackingID), aws.String(pub.ev.ID)
+		}
+		_, err := p.sqs.SendMessage(pub.ctx, in)
+		return err
+	}
+	in := &sns.PublishInput{
+		TopicArn:          aws.String(p.dest),
+		Message:           aws.String(string(pub.body)),
+		MessageAttributes: make(map[string]snstypes.MessageAttributeValue, len(names)),
+	}
+	for _, k := range names {
+		in.MessageAttributes[k] = snstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(pub.attrs[k])}
+	}
+	if p.fifo {
+		in.MessageGroupId, in.MessageDeduplicationId = aws.String(pub.ev.TrackingID), aws.String(pub.ev.ID)
+	}
+	_, err := p.sns.Publish(pub.ctx, in)
+	return err
+}
+
+// awsAttributeNames returns the attributes to send, in order, leaving out
+// empty ones, which SQS and SNS reject, and any beyond the limit.
+func awsAttributeNames(attrs map[string]string) []string {
+	var names []string
+	for k, v := range attrs {
+		if v != "" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > awsMaxMessageAttributes {
+		names = names[:awsMaxMessageAttributes]
+	}
+	return names
+}
+
+// xrayTraceHeader returns a span context in the X-Ray format, e.g.
+// Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1.
+// W3C and X-Ray trace IDs are both 128 bits, so the same trace shows up in
+// either.
+func xrayTraceHeader(sc trace.SpanContext) string {
+	if !sc.IsValid() {
+		return ""
+	}
+	id := sc.TraceID().String()
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	return "Root=1-" + id[:8] + "-" + id[8:] + ";Parent=" + sc.SpanID().String() + ";Sampled=" + sampled
+}
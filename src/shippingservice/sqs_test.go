@@ -0,0 +1,167 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// awsRequest is a call received by a fake AWS endpoint.
+type awsRequest struct {
+	header http.Header
+	body   string
+}
+
+func fakeAWS(t *testing.T, handle func(w http.ResponseWriter, r awsRequest)) chan awsRequest {
+	received := make(chan awsRequest, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := awsRequest{r.Header, string(body)}
+		if handle != nil {
+			handle(w, req)
+		}
+		received <- req
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("AWS_ENDPOINT_URL_STS", srv.URL)
+	return received
+}
+
+func publishTestEvent(t *testing.T, p *awsPublisher) trace.SpanContext {
+	saved := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(saved) })
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x5f, 0x59},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	if err := p.Publish(trace.ContextWithSpanContext(context.Background(), sc), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+func receiveAWS(t *testing.T, received chan awsRequest) awsRequest {
+	select {
+	case r := <-received:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not published")
+		return awsRequest{}
+	}
+}
+
+// TestSQSPublisher checks that events are sent to FIFO queues in order of
+// shipment, signed, and with the trace context in the message attributes.
+func TestSQSPublisher(t *testing.T) {
+	received := fakeAWS(t, func(w http.ResponseWriter, r awsRequest) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte(`{"MessageId":"1"}`))
+	})
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("SQS_QUEUE_URL", "https://sqs.eu-west-1.amazonaws.com/123456789012/shipments.fifo")
+	p := sqsPublisherFromEnv()
+	sc := publishTestEvent(t, p)
+
+	r := receiveAWS(t, received)
+	if r.header.Get("X-Amz-Target") != "AmazonSQS.SendMessage" ||
+		!strings.HasPrefix(r.header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+		!strings.Contains(r.header.Get("Authorization"), "/eu-west-1/sqs/aws4_request") {
+		t.Errorf("TestSQSPublisher: unexpected headers %v", r.header)
+	}
+	type sqsAttribute struct{ StringValue string }
+	var msg struct {
+		MessageBody             string
+		MessageGroupId          string
+		MessageAttributes       map[string]sqsAttribute
+		MessageSystemAttributes map[string]sqsAttribute
+	}
+	if err := json.Unmarshal([]byte(r.body), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg.MessageBody, `"tracking_id":"AB-123"`) || msg.MessageGroupId != "AB-123" {
+		t.Errorf("TestSQSPublisher: unexpected message %s", r.body)
+	}
+	carrier := propagation.MapCarrier{"traceparent": msg.MessageAttributes["traceparent"].StringValue}
+	if got := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier)); got.TraceID() != sc.TraceID() {
+		t.Errorf("TestSQSPublisher: attributes %v do not carry the trace", msg.MessageAttributes)
+	}
+	if h := msg.MessageSystemAttributes["AWSTraceHeader"].StringValue; !strings.HasPrefix(h, "Root=1-5f590000-000000000000000000000000;Parent=") {
+		t.Errorf("TestSQSPublisher: AWSTraceHeader is %q", h)
+	}
+}
+
+// TestSNSPublisher checks that events are published to topics with the
+// trace context in the message attributes, and that credentials come from
+// the web identity token when there are no keys.
+func TestSNSPublisher(t *testing.T) {
+	received := fakeAWS(t, func(w http.ResponseWriter, r awsRequest) {
+		if q, _ := url.ParseQuery(r.body); q.Get("Action") == "AssumeRoleWithWebIdentity" {
+			w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIAWEBIDENTITY</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+			return
+		}
+		w.Write([]byte(`<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`))
+	})
+	token := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(token, []byte("eyJhbGciOi..."), 0o600)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", token)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/shipping")
+	t.Setenv("SNS_TOPIC_ARN", "arn:aws:sns:us-west-2:123456789012:shipments")
+	p := snsPublisherFromEnv()
+	sc := publishTestEvent(t, p)
+
+	if q, _ := url.ParseQuery(receiveAWS(t, received).body); q.Get("RoleArn") != "arn:aws:iam::123456789012:role/shipping" || q.Get("WebIdentityToken") != "eyJhbGciOi..." {
+		t.Errorf("TestSNSPublisher: unexpected AssumeRoleWithWebIdentity call %v", q)
+	}
+	r := receiveAWS(t, received)
+	if !strings.HasPrefix(r.header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIAWEBIDENTITY/") || r.header.Get("X-Amz-Security-Token") != "session" {
+		t.Errorf("TestSNSPublisher: not signed with the assumed role: %v", r.header)
+	}
+	form, _ := url.ParseQuery(r.body)
+	if form.Get("Action") != "Publish" || form.Get("TopicArn") != "arn:aws:sns:us-west-2:123456789012:shipments" {
+		t.Errorf("TestSNSPublisher: unexpected call %v", form)
+	}
+	attrs := map[string]string{}
+	for i := 1; form.Get("MessageAttributes.entry."+strconv.Itoa(i)+".Name") != ""; i++ {
+		prefix := "MessageAttributes.entry." + strconv.Itoa(i) + "."
+		attrs[form.Get(prefix+"Name")] = form.Get(prefix + "Value.StringValue")
+	}
+	got := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier(attrs)))
+	if got.TraceID() != sc.TraceID() || attrs["event_type"] != eventShipmentStatusChanged {
+		t.Errorf("TestSNSPublisher: attributes %v do not carry the trace and event type", attrs)
+	}
+}
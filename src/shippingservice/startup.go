@@ -0,0 +1,53 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startup traces the start of the service as a "service.start" span with a
+// child span per phase, so that slow cold starts show up in the trace
+// backend.
+type startup struct {
+	started time.Time
+	ctx     context.Context
+	span    trace.Span
+}
+
+// beginStartup starts the startup span at started, the time the process
+// began. Telemetry is set up before there is a tracer to record it, so its
+// phase, "telemetry.init", is recorded afterwards from started until now.
+func beginStartup(started time.Time) *startup {
+	ctx, span := tracer.Start(context.Background(), "service.start",
+		trace.WithNewRoot(), trace.WithTimestamp(started))
+	_, telemetry := tracer.Start(ctx, "telemetry.init", trace.WithTimestamp(started))
+	telemetry.End()
+	return &startup{started: started, ctx: ctx, span: span}
+}
+
+// phase starts the span of a startup phase, to be ended by the caller.
+func (s *startup) phase(name string) (context.Context, trace.Span) {
+	return tracer.Start(s.ctx, name)
+}
+
+// done ends the startup span, once the service is about to serve.
+func (s *startup) done() {
+	s.span.End()
+	log.Infof("service started in %s", time.Since(s.started).Round(time.Millisecond))
+}
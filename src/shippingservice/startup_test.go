@@ -0,0 +1,59 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestStartupSpans checks that the startup phases are children of the
+// service.start span, which begins when the process started.
+func TestStartupSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	started := time.Now().Add(-time.Second)
+	st := beginStartup(started)
+	_, load := st.phase("config.load")
+	load.End()
+	st.done()
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("TestStartupSpans: got %d spans, want 3", len(spans))
+	}
+	root := spans[2]
+	if root.Name() != "service.start" || root.Parent().IsValid() {
+		t.Errorf("TestStartupSpans: last span is %q with parent %v, want a root service.start", root.Name(), root.Parent())
+	}
+	if !root.StartTime().Equal(started) {
+		t.Errorf("TestStartupSpans: service.start began at %v, want %v", root.StartTime(), started)
+	}
+	for i, want := range []string{"telemetry.init", "config.load"} {
+		s := spans[i]
+		if s.Name() != want || s.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("TestStartupSpans: span %d is %q, want %q as a child of service.start", i, s.Name(), want)
+		}
+	}
+	if !spans[0].StartTime().Equal(started) {
+		t.Errorf("TestStartupSpans: telemetry.init began at %v, want %v", spans[0].StartTime(), started)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const defaultTaxServiceTimeout = 2 * time.Second
+
+// taxCalculator works out the duties and taxes owed on an international
+// order, as TAX lines of its quote.
+type taxCalculator interface {
+	name() string
+	calculate(ctx context.Context, q taxQuery) (quoteBreakdown, error)
+}
+
+// taxQuery is what duties and taxes are worked out from.
+type taxQuery struct {
+	country string
+	method  pb.ShippingMethod
+	// shippingCents is the price of shipping, after promotions.
+	shippingCents int64
+	// customsCents is the value of the goods: their declared value, or else
+	// the value of the order.
+	customsCents int64
+}
+
+// customsRates are the flat rates of the rate table, the built-in tax
+// calculator. Goods worth less than DeMinimis, in USD, are let in free;
+// above it they pay DutyRate of their value in duties, and TaxRate of their
+// value, shipping and duties included, in import taxes.
+type customsRates struct {
+	DutyRate  float64 `yaml:"duty_rate"`
+	TaxRate   float64 `yaml:"tax_rate"`
+	DeMinimis float64 `yaml:"de_minimis"`
+}
+
+func (c customsRates) validate() error {
+	if c.DutyRate < 0 || c.DutyRate > 1 || c.TaxRate < 0 || c.TaxRate > 1 {
+		return fmt.Errorf("customs rates must be between 0 and 1")
+	}
+	if c.DeMinimis < 0 {
+		return fmt.Errorf("customs de_minimis must not be negative")
+	}
+	return nil
+}
+
+func (c customsRates) name() string { return "flat" }
+
+func (c customsRates) calculate(_ context.Context, q taxQuery) (quoteBreakdown, error) {
+	if q.customsCents == 0 || float64(q.customsCents) < c.DeMinimis*100 {
+		return nil, nil
+	}
+	var lines quoteBreakdown
+	duty := roundCents(float64(q.customsCents) * c.DutyRate)
+	if duty > 0 {
+		lines = append(lines, quoteLine{
+			kind:        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_TAX,
+			description: fmt.Sprintf("Import duty (%g%%)", c.DutyRate*100),
+			cents:       duty,
+		})
+	}
+	if tax := roundCents(float64(q.customsCents+q.shippingCents+duty) * c.TaxRate); tax > 0 {
+		lines = append(lines, quoteLine{
+			kind:        pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_TAX,
+			description: fmt.Sprintf("Import tax (%g%%)", c.TaxRate*100),
+			cents:       tax,
+		})
+	}
+	return lines, nil
+}
+
+// httpTaxCalculator asks an external tax service for the duties and taxes
+// of an order, by posting the query as JSON to its URL. The service answers
+// with the lines to add:
+//
+//	{"lines": [{"description": "VAT (20%)", "amount_usd": 12.34}]}
+//
+// Calls are traced like those to any other downstream service.
+type httpTaxCalculator struct {
+	url    string
+	client *http.Client
+}
+
+// taxCalculatorFromEnv returns a calculator calling the tax service at
+// TAX_SERVICE_URL, or nil to use the flat rates of the rate table.
+func taxCalculatorFromEnv() taxCalculator {
+	url := os.Getenv("TAX_SERVICE_URL")
+	if url == "" {
+		return nil
+	}
+	log.Infof("calculating duties and taxes with the tax service at %s", url)
+	return &httpTaxCalculator{url: url, client: newDownstreamHTTPClient(envDuration("TAX_SERVICE_TIMEOUT", defaultTaxServiceTimeout))}
+}
+
+func (c *httpTaxCalculator) name() string { return "http" }
+
+type taxServiceRequest struct {
+	Country         string  `json:"country"`
+	Method          string  `json:"method"`
+	ShippingUSD     float64 `json:"shipping_usd"`
+	CustomsValueUSD float64 `json:"customs_value_usd"`
+}
+
+type taxServiceResponse struct {
+	Lines []struct {
+		Description string  `json:"description"`
+		AmountUSD   float64 `json:"amount_usd"`
+	} `json:"lines"`
+}
+
+func (c *httpTaxCalculator) calculate(ctx context.Context, q taxQuery) (quoteBreakdown, error) {
+	body, err := json.Marshal(taxServiceRequest{
+		Country:         q.country,
+		Method:          strings.ToLower(strings.TrimPrefix(q.method.String(), "SHIPPING_METHOD_")),
+		ShippingUSD:     float64(q.shippingCents) / 100,
+		CustomsValueUSD: float64(q.customsCents) / 100,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("tax service returned %s", resp.Status)
+	}
+	var out taxServiceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode tax service response: %w", err)
+	}
+	var lines quoteBreakdown
+	for _, l := range out.Lines {
+		if l.AmountUSD < 0 || l.Description == "" {
+			return nil, fmt.Errorf("tax service returned an invalid line %+v", l)
+		}
+		lines = append(lines, quoteLine{kind: pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_TAX, description: l.Description, cents: roundCents(l.AmountUSD * 100)})
+	}
+	return lines, nil
+}
+
+// applyTaxes adds the duties and taxes of an order to its lines, which are
+// final but for them, if it goes abroad. They are worked out by the tax
+// service if there is one, or else from the flat rates of the rate table,
+// in a span of their own.
+func (s *server) applyTaxes(ctx context.Context, rates *rateTable, lines quoteBreakdown, key quoteCacheKey, address *pb.Address, opts shippingOptions, valueCents int64) (quoteBreakdown, error) {
+	if key.zone != zoneInternational || len(lines) == 0 {
+		return lines, nil
+	}
+	var calc taxCalculator = rates.Customs
+	if s.taxes != nil {
+		calc = s.taxes
+	}
+	q := taxQuery{country: address.GetCountry(), method: key.method, shippingCents: lines.cents(), customsCents: opts.DeclaredCents}
+	if q.customsCents == 0 {
+		q.customsCents = valueCents
+	}
+	ctx, span := tracer.Start(ctx, "calculateTaxes")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("tax.calculator", calc.name()),
+		attribute.String("tax.country", q.country),
+		attribute.Float64("tax.customs_value_usd", float64(q.customsCents)/100),
+	)
+	taxes, err := calc.calculate(ctx, q)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Float64("tax.amount_usd", float64(taxes.cents())/100))
+	return append(lines, taxes...), nil
+}
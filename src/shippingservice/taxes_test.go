@@ -0,0 +1,92 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+	"github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/money"
+)
+
+// TestTaxes checks that international orders pay the duties and taxes of
+// the flat rates, or of a tax service when there is one, and that domestic
+// and low-value orders pay none.
+func TestTaxes(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	items := []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}}
+	france := &pb.Address{StreetAddress: "1 Rue de Rivoli", City: "Paris", Country: "France"}
+	quote := func(address *pb.Address, declaredCents int64) (*pb.GetQuoteResponse, error) {
+		declared := money.FromCents("USD", declaredCents)
+		return s.GetQuote(ctx, &pb.GetQuoteRequest{Address: address, Items: items, Options: &pb.ShippingOptions{DeclaredValue: &declared}})
+	}
+
+	res, err := quote(france, 20000)
+	if err != nil {
+		t.Fatalf("TestTaxes: %v", err)
+	}
+	var taxes []int64
+	for _, l := range res.LineItems {
+		if l.Type == pb.QuoteLineItemType_QUOTE_LINE_ITEM_TYPE_TAX {
+			taxes = append(taxes, money.Cents(*l.AmountUsd))
+		}
+	}
+	// 5% of $200 in duties, then 20% of $200 + $8.99 + $10.
+	if len(taxes) != 2 || taxes[0] != 1000 || taxes[1] != 4380 || money.Cents(*res.CostUsd) != 899+1000+4380 {
+		t.Errorf("TestTaxes: $200 order to France got taxes %v for %v", taxes, res.CostUsd)
+	}
+	for _, tc := range []struct {
+		address  *pb.Address
+		declared int64
+	}{{benchmarkAddress, 20000}, {france, 10000}} {
+		if res, err := quote(tc.address, tc.declared); err != nil || len(res.LineItems) != 1 {
+			t.Errorf("TestTaxes: %d cent order to %s got %v (%v), want no taxes", tc.declared, tc.address.Country, res.GetLineItems(), err)
+		}
+	}
+
+	var got taxServiceRequest
+	tax := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Country == "Nowhere" {
+			http.Error(w, "unknown country", http.StatusUnprocessableEntity)
+			return
+		}
+		w.Write([]byte(`{"lines": [{"description": "VAT (20%)", "amount_usd": 1.80}]}`))
+	}))
+	defer tax.Close()
+	s.taxes = &httpTaxCalculator{url: tax.URL, client: tax.Client()}
+	res, err = quote(france, 5000)
+	if err != nil {
+		t.Fatalf("TestTaxes: %v", err)
+	}
+	last := res.LineItems[len(res.LineItems)-1]
+	if last.Description != "VAT (20%)" || money.Cents(*res.CostUsd) != 899+180 {
+		t.Errorf("TestTaxes: tax service gave %v for %v", last, res.CostUsd)
+	}
+	if got.Country != "France" || got.Method != "standard" || got.ShippingUSD != 8.99 || got.CustomsValueUSD != 50 {
+		t.Errorf("TestTaxes: tax service was asked %+v", got)
+	}
+	if _, err := quote(&pb.Address{Country: "Nowhere"}, 5000); status.Code(err) != codes.Unavailable {
+		t.Errorf("TestTaxes: failed tax service returned %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const (
+	defaultTemplatesReloadInterval = 10 * time.Second
+	defaultTrackingURL             = "http://localhost/track/"
+)
+
+// defaultTemplates is used when NOTIFY_TEMPLATES_FILE is not set.
+//
+//go:embed messages.tmpl
+var defaultTemplates []byte
+
+var templateFuncs = template.FuncMap{
+	// json quotes a value as JSON, for templates that produce JSON.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// messageData is what message templates are executed with.
+type messageData struct {
+	TrackingID  string
+	TrackingURL string
+	Tenant      string
+	// Status is the shipment's status in words, e.g. "in transit".
+	Status    string
+	Items     []*pb.CartItem
+	ItemCount int
+	Address   *pb.Address
+}
+
+// trackingURL is the address at which customers can follow a shipment.
+var trackingURL = defaultTrackingURL
+
+func newMessageData(tenant, trackingID string, status pb.ShipmentStatus) messageData {
+	return messageData{
+		TrackingID:  trackingID,
+		TrackingURL: trackingURL + url.PathEscape(trackingID),
+		Tenant:      tenant,
+		Status:      strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(status.String(), "SHIPMENT_STATUS_")), "_", " "),
+	}
+}
+
+// shipmentMessageData describes a shipment to the message templates.
+func shipmentMessageData(sh shipment) messageData {
+	d := newMessageData(sh.Tenant, sh.TrackingID, sh.Status)
+	d.Items = sh.Items
+	d.ItemCount = itemCount(sh.Items)
+	d.Address = sh.Address
+	return d
+}
+
+// eventMessageData describes the shipment of an event to the message
+// templates. Events do not carry the items or the address.
+func eventMessageData(ev shipmentEvent) messageData {
+	return newMessageData(ev.Tenant, ev.TrackingID, pb.ShipmentStatus(pb.ShipmentStatus_value[ev.Status]))
+}
+
+// templateSource holds the message templates and reloads them from disk when
+// the file changes or the process receives SIGHUP. A new version is parsed
+// when it is first used, so the parse shows up in the trace of the message
+// that needed it; a version that fails to parse is reported and the last
+// good one is used instead.
+type templateSource struct {
+	path    string
+	modTime time.Time
+
+	mu            sync.Mutex
+	text          []byte
+	version       string
+	parsed        *template.Template
+	parsedVersion string
+	failedVersion string
+}
+
+// newTemplateSource returns a source serving the given templates.
+func newTemplateSource(text []byte) *templateSource {
+	s := &templateSource{}
+	s.set(text)
+	return s
+}
+
+// templateSourceFromEnv loads the templates from NOTIFY_TEMPLATES_FILE, or
+// the built-in templates if it is not set, and takes the tracking link from
+// TRACKING_URL.
+func templateSourceFromEnv() *templateSource {
+	if u := os.Getenv("TRACKING_URL"); u != "" {
+		trackingURL = u
+	}
+	path := os.Getenv("NOTIFY_TEMPLATES_FILE")
+	if path == "" {
+		return newTemplateSource(defaultTemplates)
+	}
+	s := &templateSource{path: path}
+	if err := s.reload(); err != nil {
+		log.Fatalf("failed to load message templates from %s: %v", path, err)
+	}
+	// Refuse to start with templates that would fail every message.
+	if _, err := parseTemplates(s.text); err != nil {
+		log.Fatalf("invalid message templates in %s: %v", path, err)
+	}
+	return s
+}
+
+func parseTemplates(text []byte) (*template.Template, error) {
+	return template.New("messages").Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+}
+
+func (s *templateSource) set(text []byte) {
+	sum := sha256.Sum256(text)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text = text
+	s.version = hex.EncodeToString(sum[:4])
+}
+
+// reload re-reads the template file.
+func (s *templateSource) reload() error {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime = fi.ModTime()
+	s.set(b)
+	log.Infof("loaded message templates from %s", s.path)
+	return nil
+}
+
+// watch reloads the template file whenever its modification time changes or
+// the process receives SIGHUP. It does nothing for the built-in templates.
+func (s *templateSource) watch(interval time.Duration) {
+	if s.path == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			if fi, err := os.Stat(s.path); err != nil || fi.ModTime().Equal(s.modTime) {
+				continue
+			}
+		}
+		if err := s.reload(); err != nil {
+			log.WithError(err).Errorf("failed to reload message templates from %s", s.path)
+		}
+	}
+}
+
+// templates returns the current templates, parsing them in a template.parse
+// span if they have changed since they were last parsed.
+func (s *templateSource) templates(ctx context.Context) (*template.Template, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.parsedVersion == s.version || s.failedVersion == s.version {
+		return s.current()
+	}
+
+	_, span := tracer.Start(ctx, "template.parse", trace.WithAttributes(
+		attribute.String("template.version", s.version),
+		attribute.Int("template.bytes", len(s.text)),
+	))
+	defer span.End()
+	t, err := parseTemplates(s.text)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		log.Ctx(ctx).WithError(err).Errorf("failed to parse message templates %s, keeping %s", s.version, s.parsedVersion)
+		s.failedVersion = s.version
+		return s.current()
+	}
+	s.parsed, s.parsedVersion = t, s.version
+	return s.current()
+}
+
+func (s *templateSource) current() (*template.Template, string, error) {
+	if s.parsed == nil {
+		return nil, "", fmt.Errorf("message templates %s do not parse", s.failedVersion)
+	}
+	return s.parsed, s.parsedVersion, nil
+}
+
+// defined reports whether the current templates define name.
+func (s *templateSource) defined(ctx context.Context, name string) bool {
+	t, _, err := s.templates(ctx)
+	return err == nil && t.Lookup(name) != nil
+}
+
+// render executes the named template with data, in a template.render span
+// whose children are the parse, if one is needed, and the execution.
+func (s *templateSource) render(ctx context.Context, name string, data messageData) (string, error) {
+	ctx, span := tracer.Start(ctx, "template.render", trace.WithAttributes(attribute.String("template.name", name)))
+	defer span.End()
+	fail := func(err error) (string, error) {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return "", err
+	}
+
+	t, version, err := s.templates(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	span.SetAttributes(attribute.String("template.version", version))
+
+	_, exec := tracer.Start(ctx, "template.execute")
+	var b strings.Builder
+	err = t.ExecuteTemplate(&b, name, data)
+	if err != nil {
+		exec.RecordError(err)
+		exec.SetStatus(otelcodes.Error, err.Error())
+	}
+	exec.SetAttributes(attribute.Int("template.output.bytes", b.Len()))
+	exec.End()
+	if err != nil {
+		return fail(err)
+	}
+	return b.String(), nil
+}
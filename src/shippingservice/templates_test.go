@@ -0,0 +1,120 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestBuiltInTemplates checks that the built-in templates summarize the
+// order, link to the tracking page and, for webhooks, produce JSON.
+func TestBuiltInTemplates(t *testing.T) {
+	s := newTemplateSource(defaultTemplates)
+	ctx := context.Background()
+	sh := shipment{
+		TrackingID: "AB-123",
+		Status:     pb.ShipmentStatus_SHIPMENT_STATUS_CREATED,
+		Items:      []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}, {ProductId: "66VCHSJNUP", Quantity: 1}},
+		Address:    &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043},
+	}
+	body, err := s.render(ctx, "email.body", shipmentMessageData(sh))
+	if err != nil {
+		t.Fatalf("TestBuiltInTemplates: %v", err)
+	}
+	for _, want := range []string{"3 items", "2 x OLJCESPC7Z", defaultTrackingURL + "AB-123", "Mountain View, CA 94043"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("TestBuiltInTemplates: email body does not contain %q:\n%s", want, body)
+		}
+	}
+
+	ev := newShipmentEvent(eventShipmentStatusChanged, defaultTenant, "AB-123", pb.ShipmentStatus_SHIPMENT_STATUS_CREATED, pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT)
+	hook, err := s.render(ctx, "webhook", eventMessageData(ev))
+	if err != nil {
+		t.Fatalf("TestBuiltInTemplates: %v", err)
+	}
+	var msg struct{ Text string }
+	if err := json.Unmarshal([]byte(hook), &msg); err != nil || !strings.Contains(msg.Text, "is now in transit") {
+		t.Errorf("TestBuiltInTemplates: webhook body %q is not the expected JSON (%v)", hook, err)
+	}
+}
+
+// TestTemplateReload checks that changed templates are parsed once, in a
+// child span of the render that needed them, and that templates that fail to
+// parse leave the last good ones in use.
+func TestTemplateReload(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	path := filepath.Join(t.TempDir(), "messages.tmpl")
+	write := func(text string) {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{{define "sms.body"}}v1 {{.TrackingID}}{{end}}`)
+	s := &templateSource{path: path}
+	render := func() string {
+		if err := s.reload(); err != nil {
+			t.Fatal(err)
+		}
+		out, err := s.render(context.Background(), "sms.body", messageData{TrackingID: "AB-123"})
+		if err != nil {
+			t.Fatalf("TestTemplateReload: %v", err)
+		}
+		return out
+	}
+
+	if got := render(); got != "v1 AB-123" {
+		t.Errorf("TestTemplateReload: got %q, want v1", got)
+	}
+	render()
+	write(`{{define "sms.body"}}v2 {{.TrackingID}}{{end}}`)
+	if got := render(); got != "v2 AB-123" {
+		t.Errorf("TestTemplateReload: got %q after reload, want v2", got)
+	}
+	write(`{{define "sms.body"}}{{.TrackingID}{{end}}`)
+	if got := render(); got != "v2 AB-123" {
+		t.Errorf("TestTemplateReload: got %q after a bad reload, want v2", got)
+	}
+
+	counts := map[string]int{}
+	parents := map[string]bool{}
+	for _, sp := range rec.Ended() {
+		counts[sp.Name()]++
+		if sp.Name() == "template.render" {
+			parents[sp.SpanContext().SpanID().String()] = true
+		}
+	}
+	for _, sp := range rec.Ended() {
+		if (sp.Name() == "template.parse" || sp.Name() == "template.execute") && !parents[sp.Parent().SpanID().String()] {
+			t.Errorf("TestTemplateReload: %s is not a child of template.render", sp.Name())
+		}
+	}
+	if counts["template.render"] != 4 || counts["template.execute"] != 4 || counts["template.parse"] != 3 {
+		t.Errorf("TestTemplateReload: got spans %v, want 4 renders and executions and 3 parses", counts)
+	}
+}
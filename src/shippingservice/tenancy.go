@@ -0,0 +1,294 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// tenantHeader is the request metadata key naming the caller's tenant.
+	// The tenant can also be sent as the tenantBaggageKey baggage member,
+	// which survives hops through other services.
+	tenantHeader     = "x-tenant-id"
+	tenantBaggageKey = "tenant.id"
+
+	// defaultTenant owns requests that name no tenant.
+	defaultTenant = "default"
+
+	// otherTenant is the metric label of tenants past the label limit.
+	otherTenant = "other"
+
+	defaultTenantMetricLimit = 20
+
+	// maxTenantBuckets bounds the rate limiter state kept for distinct
+	// tenant IDs, which clients choose.
+	maxTenantBuckets = 10000
+)
+
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// tenant is the tenant a request is served for.
+type tenant struct {
+	ID string
+	// label is the value recorded in metrics: ID, or otherTenant once the
+	// number of distinct labels has reached the limit.
+	label string
+	// err is set if the request named an invalid tenant.
+	err error
+}
+
+type tenantKey struct{}
+
+// tenantFromContext returns the tenant of the request, or the default
+// tenant outside of requests.
+func tenantFromContext(ctx context.Context) tenant {
+	if t, ok := ctx.Value(tenantKey{}).(tenant); ok {
+		return t
+	}
+	return tenant{ID: defaultTenant, label: defaultTenant}
+}
+
+// tenancy identifies the tenant of each request and enforces its limits. A
+// workshop can hand each team its own tenant ID, and the teams then neither
+// see each other's shipments nor starve each other of capacity.
+type tenancy struct {
+	rate        float64 // requests per second per tenant; 0 disables the limit
+	burst       float64
+	quota       int // live shipments per tenant; 0 disables the quota
+	metricLimit int
+
+	mu      sync.Mutex
+	labels  map[string]bool
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func newTenancy(rate float64, burst, quota, metricLimit int) *tenancy {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tenancy{
+		rate:        rate,
+		burst:       float64(burst),
+		quota:       quota,
+		metricLimit: metricLimit,
+		labels:      make(map[string]bool),
+		buckets:     make(map[string]*tokenBucket),
+		now:         time.Now,
+	}
+}
+
+func tenancyFromEnv() *tenancy {
+	return newTenancy(
+		envFloat("TENANT_RATE_LIMIT", 0),
+		envInt("TENANT_RATE_BURST", 10),
+		envInt("TENANT_SHIPMENT_QUOTA", 0),
+		envInt("TENANT_METRIC_LIMIT", defaultTenantMetricLimit),
+	)
+}
+
+// resolve returns the tenant named by the request's metadata or baggage.
+func (t *tenancy) resolve(ctx context.Context) tenant {
+	id := defaultTenant
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := lastValue(md, tenantHeader); v != "" {
+		id = v
+	} else if v := baggage.FromContext(ctx).Member(tenantBaggageKey).Value(); v != "" {
+		id = v
+	}
+	if !tenantIDPattern.MatchString(id) {
+		return tenant{ID: defaultTenant, label: defaultTenant,
+			err: fmt.Errorf("tenant ID %q must be 1-64 letters, digits, '.', '_' or '-'", id)}
+	}
+	return tenant{ID: id, label: t.label(id)}
+}
+
+// label returns the metric label for a tenant. Only the first metricLimit
+// tenants seen get their own label, so a client making up tenant IDs cannot
+// create unbounded time series.
+func (t *tenancy) label(id string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.labels[id] || id == defaultTenant {
+		return id
+	}
+	if len(t.labels) >= t.metricLimit {
+		return otherTenant
+	}
+	t.labels[id] = true
+	return id
+}
+
+// allow reports whether the tenant may make another request now.
+func (t *tenancy) allow(id string) bool {
+	if t.rate <= 0 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.buckets[id]
+	if !ok {
+		if len(t.buckets) >= maxTenantBuckets {
+			t.buckets = make(map[string]*tokenBucket)
+		}
+		b = &tokenBucket{tokens: t.burst, last: t.now()}
+		t.buckets[id] = b
+	}
+	return b.take(t.now(), t.rate, t.burst)
+}
+
+// quotaExceeded returns the error of an order of the request's tenant that
+// has reached its quota of shipments in progress.
+func (t *tenancy) quotaExceeded(ctx context.Context) error {
+	id := tenantFromContext(ctx).ID
+	return rpcError(ctx, codes.ResourceExhausted, reasonQuotaExceeded,
+		map[string]string{"tenant_id": id, "quota": fmt.Sprint(t.quota)},
+		fmt.Sprintf("tenant %q has reached its quota of %d shipments", id, t.quota),
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{
+			{Subject: "tenant:" + id, Description: "live shipments"},
+		}})
+}
+
+// exempt reports whether a method is served without tenancy, so that health
+// checks and reflection keep working for every caller.
+func exempt(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.")
+}
+
+// unary returns an interceptor that adds the request's tenant to its context,
+// span, baggage and log lines. It belongs before the RED metrics, which are
+// labelled by tenant.
+func (t *tenancy) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if exempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return handler(t.withTenant(ctx), req)
+	}
+}
+
+// stream is unary for streaming RPCs.
+func (t *tenancy) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if exempt(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: t.withTenant(ss.Context())})
+	}
+}
+
+// withTenant resolves the tenant of the request of ctx and adds it to ctx,
+// its span and its baggage.
+func (t *tenancy) withTenant(ctx context.Context) context.Context {
+	tn := t.resolve(ctx)
+	ctx = context.WithValue(ctx, tenantKey{}, tn)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", tn.ID))
+	if m, err := baggage.NewMember(tenantBaggageKey, tn.ID); err == nil {
+		if b, err := baggage.FromContext(ctx).SetMember(m); err == nil {
+			ctx = baggage.ContextWithBaggage(ctx, b)
+		}
+	}
+	return ctx
+}
+
+// limit returns an interceptor that rejects requests for an invalid tenant
+// or over their tenant's rate limit. It belongs after the RED metrics and
+// access log, so that rejected calls are counted.
+func (t *tenancy) limit() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if exempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if err := t.admit(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// limitStream is limit for streaming RPCs. Opening a stream takes one token
+// from the tenant's bucket, however many messages it then carries.
+func (t *tenancy) limitStream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if exempt(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		if err := t.admit(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// admit fails if the tenant of ctx is invalid or over its rate limit.
+func (t *tenancy) admit(ctx context.Context) error {
+	tn := tenantFromContext(ctx)
+	if tn.err != nil {
+		return rpcError(ctx, codes.InvalidArgument, reasonInvalidArgument, nil, tn.err.Error(),
+			badRequest(&errdetails.BadRequest_FieldViolation{Field: tenantHeader, Description: tn.err.Error()}))
+	}
+	if !t.allow(tn.ID) {
+		return rpcError(ctx, codes.ResourceExhausted, reasonRateLimited,
+			map[string]string{"tenant_id": tn.ID},
+			fmt.Sprintf("tenant %q is over its rate limit of %g requests per second", tn.ID, t.rate),
+			retryAfter(time.Duration(float64(time.Second)/t.rate)))
+	}
+	return nil
+}
+
+// contextStream is a server stream with a context of its own, for stream
+// interceptors that add to the context of the stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// tokenBucket is a rate limiter holding up to burst tokens, refilled at rate
+// tokens per second.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, rate, burst float64) bool {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
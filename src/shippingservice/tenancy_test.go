@@ -0,0 +1,172 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// asTenant returns ctx as resolved by the tenancy interceptor for id.
+func asTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant{ID: id, label: id})
+}
+
+// TestTenantResolution checks where the tenant is read from and that metric labels are bounded.
+func TestTenantResolution(t *testing.T) {
+	tn := newTenancy(0, 0, 0, 2)
+	ctx := context.Background()
+
+	if got := tn.resolve(ctx); got.ID != defaultTenant || got.err != nil {
+		t.Errorf("TestTenantResolution: no tenant resolved to %+v", got)
+	}
+	m, _ := baggage.NewMember(tenantBaggageKey, "team-b")
+	b, _ := baggage.New(m)
+	bctx := baggage.ContextWithBaggage(ctx, b)
+	if got := tn.resolve(bctx); got.ID != "team-b" {
+		t.Errorf("TestTenantResolution: baggage resolved to %+v", got)
+	}
+	hctx := metadata.NewIncomingContext(bctx, metadata.Pairs(tenantHeader, "team-a"))
+	if got := tn.resolve(hctx); got.ID != "team-a" {
+		t.Errorf("TestTenantResolution: metadata did not win over baggage: %+v", got)
+	}
+	if got := tn.resolve(metadata.NewIncomingContext(ctx, metadata.Pairs(tenantHeader, "../etc"))); got.err == nil {
+		t.Errorf("TestTenantResolution: invalid tenant ID was accepted")
+	}
+	if got := tn.resolve(metadata.NewIncomingContext(ctx, metadata.Pairs(tenantHeader, "team-c"))); got.ID != "team-c" || got.label != otherTenant {
+		t.Errorf("TestTenantResolution: third tenant got label %q, expected %q", got.label, otherTenant)
+	}
+}
+
+// TestTenantRateLimit checks that each tenant has its own token bucket.
+func TestTenantRateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	tn := newTenancy(1, 2, 0, defaultTenantMetricLimit)
+	tn.now = func() time.Time { return now }
+	limit := tn.limit()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "done", nil }
+	call := func(id string) error {
+		_, err := limit(asTenant(context.Background(), id), nil, info, handler)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call("team-a"); err != nil {
+			t.Fatalf("TestTenantRateLimit: request %d within burst: %v", i, err)
+		}
+	}
+	err := call("team-a")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("TestTenantRateLimit: got %v, expected %s", err, codes.ResourceExhausted)
+	}
+	if info, retry := errorDetails(err); info == nil || info.Reason != reasonRateLimited || retry == nil {
+		t.Errorf("TestTenantRateLimit: details are %v, %v", info, retry)
+	}
+	if err := call("team-b"); err != nil {
+		t.Errorf("TestTenantRateLimit: another tenant was limited: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := call("team-a"); err != nil {
+		t.Errorf("TestTenantRateLimit: bucket did not refill: %v", err)
+	}
+}
+
+// TestTenantStream checks that streams get their tenant and are held to its rate limit.
+func TestTenantStream(t *testing.T) {
+	tn := newTenancy(1, 1, 0, defaultTenantMetricLimit)
+	resolve, limit := tn.stream(), tn.limitStream()
+	info := &grpc.StreamServerInfo{FullMethod: "/hipstershop.ShippingService/StreamOrders", IsClientStream: true, IsServerStream: true}
+	var got string
+	handler := func(_ interface{}, ss grpc.ServerStream) error {
+		got = tenantFromContext(ss.Context()).ID
+		return nil
+	}
+	open := func(id string) error {
+		ss := &contextStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantHeader, id))}
+		return resolve(nil, ss, info, func(srv interface{}, ss grpc.ServerStream) error {
+			return limit(srv, ss, info, handler)
+		})
+	}
+
+	if err := open("team-a"); err != nil || got != "team-a" {
+		t.Errorf("TestTenantStream: stream ran as %q (%v), expected team-a", got, err)
+	}
+	if err := open("team-a"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("TestTenantStream: stream over the rate limit got %v, expected %s", err, codes.ResourceExhausted)
+	}
+	if err := open("../etc"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TestTenantStream: stream for an invalid tenant got %v, expected %s", err, codes.InvalidArgument)
+	}
+}
+
+// TestTenantPartitioning checks that tenants only see their own shipments and are held to their quota.
+func TestTenantPartitioning(t *testing.T) {
+	s := newServer()
+	s.tenants = newTenancy(0, 0, 1, defaultTenantMetricLimit)
+	a, b := asTenant(context.Background(), "team-a"), asTenant(context.Background(), "team-b")
+	order := &pb.ShipOrderRequest{
+		Address: &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043},
+		Items:   []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 1}},
+	}
+
+	res, err := s.ShipOrder(a, order)
+	if err != nil {
+		t.Fatalf("TestTenantPartitioning: %v", err)
+	}
+	if _, err := s.GetTrackingStatus(a, &pb.GetTrackingStatusRequest{TrackingId: res.TrackingId}); err != nil {
+		t.Errorf("TestTenantPartitioning: owner could not track its shipment: %v", err)
+	}
+	if _, err := s.GetTrackingStatus(b, &pb.GetTrackingStatusRequest{TrackingId: res.TrackingId}); status.Code(err) != codes.NotFound {
+		t.Errorf("TestTenantPartitioning: another tenant got %v, expected %s", err, codes.NotFound)
+	}
+	if _, err := s.CancelShipment(b, &pb.CancelShipmentRequest{TrackingId: res.TrackingId}); status.Code(err) != codes.NotFound {
+		t.Errorf("TestTenantPartitioning: another tenant cancelled the shipment: %v", err)
+	}
+
+	_, err = s.ShipOrder(a, order)
+	if info, _ := errorDetails(err); status.Code(err) != codes.ResourceExhausted || info == nil || info.Reason != reasonQuotaExceeded {
+		t.Errorf("TestTenantPartitioning: order over quota returned %v", err)
+	}
+	if _, err := s.ShipOrder(b, order); err != nil {
+		t.Errorf("TestTenantPartitioning: another tenant hit the first one's quota: %v", err)
+	}
+	if _, err := s.CancelShipment(a, &pb.CancelShipmentRequest{TrackingId: res.TrackingId}); err != nil {
+		t.Fatalf("TestTenantPartitioning: %v", err)
+	}
+	if _, err := s.ShipOrder(a, order); err != nil {
+		t.Errorf("TestTenantPartitioning: a cancelled shipment still counts against the quota: %v", err)
+	}
+
+	// A retry of a shipped order gets its tracking ID back, although the
+	// order brought the tenant to its quota.
+	keyed := metadata.NewIncomingContext(asTenant(context.Background(), "team-c"), metadata.Pairs(idempotencyKeyHeader, "order-1"))
+	first, err := s.ShipOrder(keyed, order)
+	if err != nil {
+		t.Fatalf("TestTenantPartitioning: %v", err)
+	}
+	if retry, err := s.ShipOrder(keyed, order); err != nil || retry.TrackingId != first.TrackingId {
+		t.Errorf("TestTenantPartitioning: retry at quota returned %v (%v), want tracking ID %s", retry, err, first.TrackingId)
+	}
+}
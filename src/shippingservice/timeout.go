@@ -0,0 +1,129 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// defaultRPCTimeouts bounds how long each method may run on the server,
+// independently of the deadline the client sent.
+var defaultRPCTimeouts = map[string]time.Duration{
+	"GetQuote":            2 * time.Second,
+	"GetDeliveryEstimate": 2 * time.Second,
+	"GetTrackingStatus":   2 * time.Second,
+	"GetShipmentHistory":  2 * time.Second,
+	"ShipOrder":           5 * time.Second,
+	"CancelShipment":      5 * time.Second,
+	"GenerateLabel":       5 * time.Second,
+	"ShipOrders":          30 * time.Second,
+}
+
+// parseRPCTimeouts parses a comma-separated list of Method=duration pairs,
+// e.g. "GetQuote=1s,ShipOrder=10s", on top of the defaults. A duration of
+// 0 removes the limit for that method.
+func parseRPCTimeouts(s string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration, len(defaultRPCTimeouts))
+	for m, d := range defaultRPCTimeouts {
+		out[m] = d
+	}
+	for _, kv := range splitList(s) {
+		method, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not of the form Method=duration", kv)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for %s: %w", method, err)
+		}
+		out[strings.TrimSpace(method)] = d
+	}
+	return out, nil
+}
+
+func rpcTimeoutsFromEnv() map[string]time.Duration {
+	timeouts, err := parseRPCTimeouts(os.Getenv("RPC_TIMEOUTS"))
+	if err != nil {
+		log.Fatalf("invalid RPC_TIMEOUTS: %v", err)
+	}
+	return timeouts
+}
+
+// timeoutInterceptor gives each call the server-side deadline configured for
+// its method. The deadline is only ever shortened, never extended past the
+// client's. If the handler fails after the server-side deadline expired, the
+// call fails with DeadlineExceeded and a span event marks the overrun. A
+// handler that succeeded anyway keeps its result: a ShipOrder that committed
+// a shipment must not be reported as failed, or the client would retry it.
+func timeoutInterceptor(timeouts map[string]time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		d := timeouts[path.Base(info.FullMethod)]
+		if d <= 0 {
+			return handler(ctx, req)
+		}
+		tctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		resp, err := handler(tctx, req)
+		if err != nil && errors.Is(tctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, serverTimeout(ctx, info.FullMethod, d)
+		}
+		return resp, err
+	}
+}
+
+// timeoutStreamInterceptor is timeoutInterceptor for streaming RPCs. The
+// timeout bounds the whole stream, so streams meant to stay open have none
+// by default.
+func timeoutStreamInterceptor(timeouts map[string]time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		d := timeouts[path.Base(info.FullMethod)]
+		if d <= 0 {
+			return handler(srv, ss)
+		}
+		ctx := ss.Context()
+		tctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: tctx})
+		if err != nil && errors.Is(tctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return serverTimeout(ctx, info.FullMethod, d)
+		}
+		return err
+	}
+}
+
+// serverTimeout marks the overrun of the server timeout d by a call of
+// fullMethod on its span and returns its error.
+func serverTimeout(ctx context.Context, fullMethod string, d time.Duration) error {
+	trace.SpanFromContext(ctx).AddEvent("rpc.server_timeout", trace.WithAttributes(
+		attribute.String("rpc.method", fullMethod),
+		attribute.String("rpc.timeout", d.String()),
+	))
+	return rpcError(ctx, codes.DeadlineExceeded, reasonServerTimeout,
+		map[string]string{"method": path.Base(fullMethod), "timeout": d.String()},
+		fmt.Sprintf("%s did not complete within the server timeout of %s", path.Base(fullMethod), d))
+}
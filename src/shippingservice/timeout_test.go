@@ -0,0 +1,76 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestParseRPCTimeouts checks that overrides are applied on top of the defaults.
+func TestParseRPCTimeouts(t *testing.T) {
+	got, err := parseRPCTimeouts("GetQuote=1s, ShipOrders=0")
+	if err != nil {
+		t.Fatalf("TestParseRPCTimeouts: %v", err)
+	}
+	if got["GetQuote"] != time.Second || got["ShipOrders"] != 0 || got["ShipOrder"] != defaultRPCTimeouts["ShipOrder"] {
+		t.Errorf("TestParseRPCTimeouts: got %v", got)
+	}
+	for _, bad := range []string{"GetQuote", "GetQuote=soon"} {
+		if _, err := parseRPCTimeouts(bad); err == nil {
+			t.Errorf("TestParseRPCTimeouts: %q was accepted", bad)
+		}
+	}
+}
+
+// TestTimeoutInterceptor checks that a handler overrunning its server timeout fails with DeadlineExceeded.
+func TestTimeoutInterceptor(t *testing.T) {
+	intercept := timeoutInterceptor(map[string]time.Duration{"GetQuote": 10 * time.Millisecond})
+	slow := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return nil, err
+		}
+		return "done", nil
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/GetQuote"}
+	if _, err := intercept(context.Background(), nil, info, slow); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("TestTimeoutInterceptor: got %v, expected %s", err, codes.DeadlineExceeded)
+	}
+
+	// A handler that finished its work past the deadline keeps its result.
+	late := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return "done", nil
+	}
+	if resp, err := intercept(context.Background(), nil, info, late); err != nil || resp != "done" {
+		t.Errorf("TestTimeoutInterceptor: got %v, %v for a handler that succeeded late", resp, err)
+	}
+
+	fast := func(ctx context.Context, req interface{}) (interface{}, error) { return "done", nil }
+	if resp, err := intercept(context.Background(), nil, info, fast); err != nil || resp != "done" {
+		t.Errorf("TestTimeoutInterceptor: got %v, %v for a fast handler", resp, err)
+	}
+
+	info = &grpc.UnaryServerInfo{FullMethod: "/hipstershop.ShippingService/ShipOrder"}
+	if _, err := intercept(context.Background(), nil, info, fast); err != nil {
+		t.Errorf("TestTimeoutInterceptor: got %v for a method without a timeout", err)
+	}
+}
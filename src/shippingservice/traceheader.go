@@ -0,0 +1,63 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Response header keys carrying the trace of the call, so that a user can
+// paste the ID straight into the trace backend. An unsampled trace was not
+// exported and will not be found there.
+const (
+	traceIDHeader      = "x-trace-id"
+	traceSampledHeader = "x-trace-sampled"
+)
+
+// traceHeaders returns the response headers for the span in ctx, or nil if
+// there is none.
+func traceHeaders(ctx context.Context) metadata.MD {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.TraceID().IsValid() {
+		return nil
+	}
+	return metadata.Pairs(traceIDHeader, sc.TraceID().String(), traceSampledHeader, strconv.FormatBool(sc.IsSampled()))
+}
+
+// traceIDInterceptor sends traceHeaders before the handler runs, so they
+// reach the client with failed calls too.
+func traceIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md := traceHeaders(ctx); md != nil {
+			grpc.SetHeader(ctx, md)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// traceIDStreamInterceptor is traceIDInterceptor for streaming RPCs.
+func traceIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if md := traceHeaders(ss.Context()); md != nil {
+			ss.SetHeader(md)
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestTraceIDHeader checks that the server's trace ID is returned with successful and failed calls.
+func TestTraceIDHeader(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tp))),
+		grpc.ChainUnaryInterceptor(traceIDInterceptor()),
+	)
+	pb.RegisterShippingServiceServer(srv, newServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := pb.NewShippingServiceClient(cc)
+
+	var headers []metadata.MD
+	for _, addr := range []*pb.Address{{State: "CA", Country: "USA", ZipCode: 94043}, {Country: "USA"}} {
+		var header metadata.MD
+		client.ShipOrder(context.Background(), &pb.ShipOrderRequest{Address: addr}, grpc.Header(&header))
+		headers = append(headers, header)
+	}
+	srv.GracefulStop()
+
+	traces := make(map[string]bool)
+	for _, s := range rec.Ended() {
+		traces[s.SpanContext().TraceID().String()] = true
+	}
+	seen := make(map[string]bool)
+	for i, h := range headers {
+		id := h.Get(traceIDHeader)
+		if len(id) != 1 || !traces[id[0]] || seen[id[0]] {
+			t.Errorf("TestTraceIDHeader: call %d returned %s %v, expected one of the server's trace IDs", i, traceIDHeader, id)
+			continue
+		}
+		seen[id[0]] = true
+		if got := h.Get(traceSampledHeader); len(got) != 1 || got[0] != "true" {
+			t.Errorf("TestTraceIDHeader: call %d returned %s %v", i, traceSampledHeader, got)
+		}
+	}
+}
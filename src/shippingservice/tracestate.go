@@ -0,0 +1,128 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// defaultTracestateEntry is the vendor entry the service adds to the W3C
+// tracestate of its outgoing calls.
+const defaultTracestateEntry = "fok=shipv2"
+
+// FOK Workshop - Tracestate
+//
+// tracestatePropagator is a TraceContext propagator that adds a vendor entry
+// to the tracestate of every call it injects into.
+//
+// The W3C traceparent header says which trace and span a call belongs to.
+// Its companion, tracestate, is a list of up to 32 vendor key=value entries,
+// e.g. "fok=shipv2,congo=t61rcWkgMzE", that every service passes on
+// unchanged, except for its own entry, which it may update and must then
+// move to the front. Vendors use it for sampling hints and routing data that
+// must follow the trace across services whatever their instrumentation.
+//
+// In OpenTelemetry the tracestate is part of the span context: a child span
+// inherits its parent's, and the TraceContext propagator writes the current
+// span's tracestate, so changing what goes out means changing the span
+// context at injection time.
+type tracestatePropagator struct {
+	propagation.TextMapPropagator
+	key, value string
+}
+
+func newTracestatePropagator(next propagation.TextMapPropagator, key, value string) propagation.TextMapPropagator {
+	return tracestatePropagator{TextMapPropagator: next, key: key, value: value}
+}
+
+// tracestateEntryFromEnv returns the key and value of TRACESTATE_ENTRY, or
+// empty strings if it is "off".
+func tracestateEntryFromEnv() (string, string) {
+	entry := os.Getenv("TRACESTATE_ENTRY")
+	switch entry {
+	case "off":
+		return "", ""
+	case "":
+		entry = defaultTracestateEntry
+	}
+	// ParseTraceState checks the key and value against the W3C grammar.
+	if _, err := trace.ParseTraceState(entry); err != nil || strings.Contains(entry, ",") {
+		log.Fatalf("invalid TRACESTATE_ENTRY %q: want a single key=value tracestate entry", entry)
+	}
+	key, value, _ := strings.Cut(entry, "=")
+	return key, value
+}
+
+// tracestatePropagatorFromEnv wraps next to add TRACESTATE_ENTRY, unless it
+// is off.
+func tracestatePropagatorFromEnv(next propagation.TextMapPropagator) propagation.TextMapPropagator {
+	key, value := tracestateEntryFromEnv()
+	if key == "" {
+		return next
+	}
+	return newTracestatePropagator(next, key, value)
+}
+
+// Inject writes the trace context of ctx with the vendor entry in front of
+// the tracestate. The spans of ctx are not changed.
+func (p tracestatePropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	ctx = withTracestateEntry(ctx, p.key, p.value)
+	p.TextMapPropagator.Inject(ctx, carrier)
+}
+
+// withTracestateEntry returns ctx with a span context whose tracestate has
+// key=value as its first entry. It returns ctx unchanged if there is no span
+// context, or if the tracestate is already full.
+func withTracestateEntry(ctx context.Context, key, value string) context.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx
+	}
+	ts, err := sc.TraceState().Insert(key, value)
+	if err != nil {
+		return ctx
+	}
+	return trace.ContextWithSpanContext(ctx, sc.WithTraceState(ts))
+}
+
+// tracestateValue returns the value of a vendor entry in the tracestate of
+// the span in ctx, which for a server span is the one the caller sent.
+func tracestateValue(ctx context.Context, key string) string {
+	return trace.SpanContextFromContext(ctx).TraceState().Get(key)
+}
+
+// tracestateInterceptor records the caller's value of the TRACESTATE_ENTRY
+// key on the server span, as a tracestate.<key> attribute, so that what
+// upstream services wrote can be seen in the trace.
+func tracestateInterceptor() grpc.UnaryServerInterceptor {
+	key, _ := tracestateEntryFromEnv()
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if key == "" {
+			return handler(ctx, req)
+		}
+		if v := tracestateValue(ctx, key); v != "" {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String(fmt.Sprintf("tracestate.%s", key), v))
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestTracestatePropagator checks that the vendor entry goes in front of the
+// tracestate of outgoing calls, replacing an older value, and can be read on
+// the receiving side.
+func TestTracestatePropagator(t *testing.T) {
+	p := newTracestatePropagator(propagation.TraceContext{}, "fok", "shipv2")
+	for _, tc := range []struct{ in, want string }{
+		{"", "fok=shipv2"},
+		{"congo=t61rcWkgMzE", "fok=shipv2,congo=t61rcWkgMzE"},
+		{"congo=t61rcWkgMzE,fok=shipv1", "fok=shipv2,congo=t61rcWkgMzE"},
+	} {
+		ts, err := trace.ParseTraceState(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}, TraceFlags: trace.FlagsSampled, TraceState: ts,
+		})
+		ctx := trace.ContextWithSpanContext(context.Background(), sc)
+		carrier := propagation.MapCarrier{}
+		p.Inject(ctx, carrier)
+		if got := carrier.Get("tracestate"); got != tc.want {
+			t.Errorf("TestTracestatePropagator: tracestate %q went out as %q, want %q", tc.in, got, tc.want)
+		}
+		if got := tracestateValue(ctx, "fok"); got == "shipv2" {
+			t.Errorf("TestTracestatePropagator: injecting changed the span context of the caller")
+		}
+
+		received := p.Extract(context.Background(), carrier)
+		if got := tracestateValue(received, "fok"); got != "shipv2" {
+			t.Errorf("TestTracestatePropagator: received fok=%q, want shipv2", got)
+		}
+	}
+
+	carrier := propagation.MapCarrier{}
+	p.Inject(context.Background(), carrier)
+	if len(carrier) != 0 {
+		t.Errorf("TestTracestatePropagator: injected %v without a span", carrier)
+	}
+}
+
+// TestTracestateEntryFromEnv checks the parsing of TRACESTATE_ENTRY.
+func TestTracestateEntryFromEnv(t *testing.T) {
+	for env, want := range map[string]string{"": "fok=shipv2", "off": "=", "acme@fok=v3": "acme@fok=v3"} {
+		t.Setenv("TRACESTATE_ENTRY", env)
+		if k, v := tracestateEntryFromEnv(); k+"="+v != want {
+			t.Errorf("TestTracestateEntryFromEnv: %q gave %s=%s, want %s", env, k, v, want)
+		}
+	}
+}
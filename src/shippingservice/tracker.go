@@ -15,42 +15,151 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
-	"time"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
 )
 
-// seeded determines if the random number generator is ready.
-var seeded bool = false
+// Tracking IDs look like "OB-8Z3K0M4QW7TRS2X":
+//
+//   - the carrier prefix "OB" and a hyphen,
+//   - a 14 character payload in Crockford base32 (70 bits, see idgen.go),
+//   - one base32 check character, computed with the Luhn mod N algorithm
+//     over the payload.
+//
+// The check character catches every single character typo and most
+// transpositions, so malformed IDs are rejected without a lookup.
+const (
+	trackingCarrier    = "OB"
+	trackingPayloadLen = 14
+	trackingIDLen      = len(trackingCarrier) + 1 + trackingPayloadLen + 1
+	crockfordAlphabet  = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var errMalformedTrackingID = errors.New("malformed tracking ID")
 
-// CreateTrackingId generates a tracking ID.
+// trackingID is a parsed tracking ID.
+type trackingID struct {
+	Carrier string
+	Payload string
+}
+
+func (id trackingID) String() string {
+	b := getBuilder()
+	defer b.release()
+	b.WriteString(id.Carrier)
+	b.WriteByte('-')
+	b.WriteString(id.Payload)
+	b.WriteByte(luhnCheckChar(id.Payload))
+	return b.String()
+}
+
+// CreateTrackingId generates a tracking ID. IDs are unique by construction,
+// so the salt is only used in deterministic mode, where the ID is derived
+// from it instead.
 func CreateTrackingId(salt string) string {
-	if !seeded {
-		rand.Seed(time.Now().UnixNano())
-		seeded = true
+	next := ids.next()
+	payload := next[:]
+	if deterministic {
+		sum := derived.sum(salt)
+		payload = sum[:]
+	}
+	// The ID has a fixed length, so it is built on the stack rather than in
+	// a pooled builder, and the returned string is the only allocation.
+	var buf [trackingIDLen]byte
+	id := append(buf[:0], trackingCarrier...)
+	id = append(id, '-')
+	id = appendBase32(id, payload, trackingPayloadLen)
+	id = append(id, luhnCheckChar(string(id[len(trackingCarrier)+1:])))
+	return string(id)
+}
+
+// ParseTrackingId parses and validates a tracking ID.
+func ParseTrackingId(s string) (trackingID, error) {
+	if len(s) != trackingIDLen {
+		return trackingID{}, fmt.Errorf("%w: %q has %d characters, expected %d", errMalformedTrackingID, s, len(s), trackingIDLen)
 	}
+	s = strings.ToUpper(s)
+	if !strings.HasPrefix(s, trackingCarrier+"-") {
+		return trackingID{}, fmt.Errorf("%w: %q does not start with %s-", errMalformedTrackingID, s, trackingCarrier)
+	}
+	body := s[len(trackingCarrier)+1:]
+	for _, r := range body {
+		if !strings.ContainsRune(crockfordAlphabet, r) {
+			return trackingID{}, fmt.Errorf("%w: %q contains %q", errMalformedTrackingID, s, r)
+		}
+	}
+	payload, check := body[:trackingPayloadLen], body[trackingPayloadLen]
+	if luhnCheckChar(payload) != check {
+		return trackingID{}, fmt.Errorf("%w: %q has the wrong check character", errMalformedTrackingID, s)
+	}
+	return trackingID{Carrier: trackingCarrier, Payload: payload}, nil
+}
 
-	return fmt.Sprintf("%c%c-%d%s-%d%s",
-		getRandomLetterCode(),
-		getRandomLetterCode(),
-		len(salt),
-		getRandomNumber(3),
-		len(salt)/2,
-		getRandomNumber(7),
-	)
+// ValidateTrackingId reports whether s is a well-formed tracking ID.
+func ValidateTrackingId(s string) error {
+	_, err := ParseTrackingId(s)
+	return err
 }
 
-// getRandomLetterCode generates a code point value for a capital letter.
-func getRandomLetterCode() uint32 {
-	return 65 + uint32(rand.Intn(25))
+// encodeBase32 encodes the leading bits of b as n Crockford base32 characters.
+func encodeBase32(b []byte, n int) string {
+	return string(appendBase32(make([]byte, 0, n), b, n))
+}
+
+// appendBase32 appends the encoding of the leading bits of b as n Crockford
+// base32 characters to dst.
+func appendBase32(dst, b []byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		var v byte
+		for bit := i * 5; bit < i*5+5; bit++ {
+			v = v<<1 | (b[bit/8]>>(7-bit%8))&1
+		}
+		dst = append(dst, crockfordAlphabet[v])
+	}
+	return dst
 }
 
-// getRandomNumber generates a string representation of a number with the requested number of digits.
-func getRandomNumber(digits int) string {
-	str := ""
-	for i := 0; i < digits; i++ {
-		str = fmt.Sprintf("%s%d", str, rand.Intn(10))
+// luhnCheckChar computes the Luhn mod 32 check character of a base32 string.
+func luhnCheckChar(payload string) byte {
+	const base = len(crockfordAlphabet)
+	factor, sum := 2, 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(crockfordAlphabet, payload[i])
+		sum += addend/base + addend%base
+		factor = 3 - factor
+	}
+	return crockfordAlphabet[(base-sum%base)%base]
+}
+
+// GetTrackingStatus returns the current state of a shipment.
+func (s *server) GetTrackingStatus(ctx context.Context, in *pb.GetTrackingStatusRequest) (*pb.GetTrackingStatusResponse, error) {
+	log.Ctx(ctx).Info("[GetTrackingStatus] received request")
+	defer log.Ctx(ctx).Info("[GetTrackingStatus] completed request")
+
+	id, err := ParseTrackingId(in.TrackingId)
+	if err != nil {
+		return nil, rpcError(ctx, codes.InvalidArgument, reasonMalformedTrackingID, nil, err.Error(),
+			badRequest(&errdetails.BadRequest_FieldViolation{Field: "tracking_id", Description: err.Error()}))
+	}
+	sh, err := s.shipments.get(ctx, tenantFromContext(ctx).ID, id.String())
+	if errors.Is(err, errShipmentNotFound) {
+		return nil, shipmentNotFound(ctx, in.TrackingId)
+	}
+	if err != nil {
+		return nil, backendUnavailable(ctx, "read shipment", err)
 	}
 
-	return str
+	return &pb.GetTrackingStatusResponse{
+		TrackingId: sh.TrackingID,
+		Status:     sh.Status,
+		UpdatedAt:  timestamppb.New(sh.UpdatedAt),
+	}, nil
 }
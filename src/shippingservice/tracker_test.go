@@ -0,0 +1,95 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestParseTrackingId checks that generated IDs parse and that typos are caught.
+func TestParseTrackingId(t *testing.T) {
+	id := CreateTrackingId("1600 Amphitheatre Parkway")
+	parsed, err := ParseTrackingId(id)
+	if err != nil {
+		t.Fatalf("TestParseTrackingId: %v", err)
+	}
+	if parsed.String() != id {
+		t.Errorf("TestParseTrackingId: %q round-tripped to %q", id, parsed.String())
+	}
+	if _, err := ParseTrackingId(strings.ToLower(id)); err != nil {
+		t.Errorf("TestParseTrackingId: lower case ID was rejected: %v", err)
+	}
+
+	// Every single character substitution in the payload or check character
+	// must be detected.
+	for i := len(trackingCarrier) + 1; i < len(id); i++ {
+		for _, r := range crockfordAlphabet {
+			if byte(r) == id[i] {
+				continue
+			}
+			typo := id[:i] + string(r) + id[i+1:]
+			if ValidateTrackingId(typo) == nil {
+				t.Errorf("TestParseTrackingId: typo %q of %q was accepted", typo, id)
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "OB-", "XX" + id[2:], id + "0", strings.Replace(id, "-", "_", 1), id[:5] + "U" + id[6:]} {
+		if ValidateTrackingId(bad) == nil {
+			t.Errorf("TestParseTrackingId: %q was accepted", bad)
+		}
+	}
+}
+
+// TestGetTrackingStatus checks lookups of valid, unknown and malformed IDs.
+func TestGetTrackingStatus(t *testing.T) {
+	s := newServer()
+	ctx := context.Background()
+	res, err := s.ShipOrder(ctx, &pb.ShipOrderRequest{Address: &pb.Address{ZipCode: 94043}})
+	if err != nil {
+		t.Fatalf("TestGetTrackingStatus (%v) failed", err)
+	}
+
+	st, err := s.GetTrackingStatus(ctx, &pb.GetTrackingStatusRequest{TrackingId: res.TrackingId})
+	if err != nil {
+		t.Fatalf("TestGetTrackingStatus (%v) failed", err)
+	}
+	if st.Status != pb.ShipmentStatus_SHIPMENT_STATUS_CREATED {
+		t.Errorf("TestGetTrackingStatus: status is %s, expected %s", st.Status, pb.ShipmentStatus_SHIPMENT_STATUS_CREATED)
+	}
+
+	_, err = s.GetTrackingStatus(ctx, &pb.GetTrackingStatusRequest{TrackingId: CreateTrackingId("")})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("TestGetTrackingStatus: unknown ID returned %v, expected %s", err, codes.NotFound)
+	}
+	_, err = s.GetTrackingStatus(ctx, &pb.GetTrackingStatusRequest{TrackingId: "does-not-exist"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TestGetTrackingStatus: malformed ID returned %v, expected %s", err, codes.InvalidArgument)
+	}
+}
+
+func BenchmarkCreateTrackingId(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CreateTrackingId("1600 Amphitheatre Parkway, Mountain View, CA, 94043")
+	}
+}
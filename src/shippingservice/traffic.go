@@ -0,0 +1,230 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/protoadapt"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// trafficEntry is an RPC captured by the record command, one JSON object per
+// line of the traffic file.
+type trafficEntry struct {
+	Time    time.Time       `json:"time"`
+	Method  string          `json:"method"`
+	Request json.RawMessage `json:"request"`
+}
+
+// replayMethods are the methods that can be recorded and replayed, with
+// new request and response messages for each. Streaming methods and health
+// checks are not recorded.
+var replayMethods = map[string]func() (req, resp protoadapt.MessageV1){
+	"/hipstershop.ShippingService/GetQuote": func() (protoadapt.MessageV1, protoadapt.MessageV1) {
+		return &pb.GetQuoteRequest{}, &pb.GetQuoteResponse{}
+	},
+	"/hipstershop.ShippingService/ShipOrder": func() (protoadapt.MessageV1, protoadapt.MessageV1) {
+		return &pb.ShipOrderRequest{}, &pb.ShipOrderResponse{}
+	},
+	"/hipstershop.ShippingService/CancelShipment": func() (protoadapt.MessageV1, protoadapt.MessageV1) {
+		return &pb.CancelShipmentRequest{}, &pb.CancelShipmentResponse{}
+	},
+	"/hipstershop.ShippingService/ShipOrders": func() (protoadapt.MessageV1, protoadapt.MessageV1) {
+		return &pb.ShipOrdersRequest{}, &pb.ShipOrdersResponse{}
+	},
+	"/hipstershop.ShippingService/GenerateLabel": func() (protoadapt.MessageV1, protoadapt.MessageV1) {
+		return &pb.GenerateLabelRequest{}, &pb.GenerateLabelResponse{}
+	},
+	"/hipstershop.ShippingService/GetDeliveryEstimate": func() (protoadapt.MessageV1, protoadapt.MessageV1) {
+		return &pb.GetDeliveryEstimateRequest{}, &pb.GetDeliveryEstimateResponse{}
+	},
+	"/hipstershop.ShippingService/GetTrackingStatus": func() (protoadapt.MessageV1, protoadapt.MessageV1) {
+		return &pb.GetTrackingStatusRequest{}, &pb.GetTrackingStatusResponse{}
+	},
+}
+
+// trafficRecorder writes the requests of incoming RPCs to a traffic file.
+type trafficRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+func newTrafficRecorder(w io.Writer) *trafficRecorder {
+	return &trafficRecorder{enc: json.NewEncoder(w), now: time.Now}
+}
+
+// unary returns an interceptor recording every call of replayMethods as it
+// arrives, whatever its outcome. A nil recorder records nothing.
+func (r *trafficRecorder) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if r == nil {
+			return handler(ctx, req)
+		}
+		if m, ok := req.(protoadapt.MessageV1); ok && replayMethods[info.FullMethod] != nil {
+			r.record(info.FullMethod, m)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (r *trafficRecorder) record(method string, req protoadapt.MessageV1) {
+	b, err := protojson.Marshal(protoadapt.MessageV2Of(req))
+	if err != nil {
+		log.WithError(err).Warnf("failed to record %s", method)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(trafficEntry{Time: r.now().UTC(), Method: method, Request: b}); err != nil {
+		log.WithError(err).Warnf("failed to record %s", method)
+	}
+}
+
+// recordCommand runs the service, recording its traffic:
+//
+//	shippingservice record [-o traffic.jsonl]
+func recordCommand(args []string) int {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	out := fs.String("o", "traffic.jsonl", "file to append the recorded RPCs to")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.WithError(err).Error("failed to open traffic file")
+		return 1
+	}
+	defer f.Close()
+	log.Infof("recording traffic to %s", *out)
+	serve(newTrafficRecorder(f))
+	return 0
+}
+
+// replayCommand sends recorded traffic to a server, keeping the original
+// spacing of the calls divided by the speed, or as fast as possible at
+// speed 0:
+//
+//	shippingservice replay [-i traffic.jsonl] [-addr localhost:50051] [-speed 1]
+func replayCommand(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	in := fs.String("i", "traffic.jsonl", "traffic file to replay")
+	addr := fs.String("addr", "localhost:"+defaultPort, "address of the server")
+	speed := fs.Float64("speed", 1, "speed-up of the replay; 0 sends the calls back to back")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of each call")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *speed < 0 {
+		fmt.Fprintln(fs.Output(), "-speed must not be negative")
+		return 2
+	}
+	entries, err := readTraffic(*in)
+	if err != nil {
+		log.WithError(err).Error("failed to read traffic file")
+		return 1
+	}
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.WithError(err).Error("failed to create client")
+		return 1
+	}
+	defer conn.Close()
+
+	log.Infof("replaying %d calls from %s to %s at %vx", len(entries), *in, *addr, *speed)
+	results := replay(context.Background(), conn, entries, *speed, *timeout)
+	var summary []string
+	for code, n := range results {
+		summary = append(summary, fmt.Sprintf("%s=%d", code, n))
+	}
+	sort.Strings(summary)
+	log.Infof("replay done: %v", summary)
+	return 0
+}
+
+func readTraffic(path string) ([]trafficEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []trafficEntry
+	dec := json.NewDecoder(f)
+	for {
+		var e trafficEntry
+		if err := dec.Decode(&e); errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries)+1, err)
+		}
+		if replayMethods[e.Method] == nil {
+			return nil, fmt.Errorf("entry %d: cannot replay %s", len(entries)+1, e.Method)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// replay sends the entries, each at its offset from the first divided by
+// speed, and returns the number of calls by resulting code. Calls run
+// concurrently, so a slow call does not delay the next ones.
+func replay(ctx context.Context, conn grpc.ClientConnInterface, entries []trafficEntry, speed float64, timeout time.Duration) map[codes.Code]int {
+	var (
+		mu      sync.Mutex
+		results = make(map[codes.Code]int)
+		wg      sync.WaitGroup
+	)
+	start := time.Now()
+	for _, e := range entries {
+		if speed > 0 {
+			at := time.Duration(float64(e.Time.Sub(entries[0].Time)) / speed)
+			if err := sleepContext(ctx, at-time.Since(start)); err != nil {
+				break
+			}
+		}
+		req, resp := replayMethods[e.Method]()
+		if err := protojson.Unmarshal(e.Request, protoadapt.MessageV2Of(req)); err != nil {
+			log.WithError(err).Warnf("skipping invalid %s request", e.Method)
+			continue
+		}
+		wg.Add(1)
+		go func(method string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			code := status.Code(conn.Invoke(ctx, method, req, resp))
+			mu.Lock()
+			results[code]++
+			mu.Unlock()
+		}(e.Method)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestRecordReplay checks that recorded calls are replayed with the same
+// requests, keeping their spacing at the given speed.
+func TestRecordReplay(t *testing.T) {
+	var buf bytes.Buffer
+	rec := newTrafficRecorder(&buf)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(rec.unary()))
+	pb.RegisterShippingServiceServer(srv, newServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	client := pb.NewShippingServiceClient(conn)
+	address := &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043}
+	client.GetQuote(ctx, &pb.GetQuoteRequest{Address: address})
+	client.ShipOrder(ctx, &pb.ShipOrderRequest{Address: address})
+
+	entries := decodeTraffic(t, buf.Bytes())
+	if len(entries) != 2 || entries[0].Method != "/hipstershop.ShippingService/GetQuote" || entries[1].Method != "/hipstershop.ShippingService/ShipOrder" {
+		t.Fatalf("TestRecordReplay: recorded %+v", entries)
+	}
+	entries[1].Time = entries[0].Time.Add(100 * time.Millisecond)
+
+	buf.Reset()
+	start := time.Now()
+	results := replay(ctx, conn, entries, 5, time.Second)
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("TestRecordReplay: replay at 5x took %s, want at least 20ms", d)
+	}
+	if results[codes.OK] != 2 {
+		t.Errorf("TestRecordReplay: results %v", results)
+	}
+	replayed := decodeTraffic(t, buf.Bytes())
+	if len(replayed) != 2 || !bytes.Equal(replayed[1].Request, entries[1].Request) {
+		t.Errorf("TestRecordReplay: replayed %+v, want %+v", replayed, entries)
+	}
+
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	os.WriteFile(path, []byte(`{"method":"/grpc.health.v1.Health/Check","request":{}}`+"\n"), 0o644)
+	if _, err := readTraffic(path); err == nil || !strings.Contains(err.Error(), "cannot replay") {
+		t.Errorf("TestRecordReplay: reading a health check returned %v", err)
+	}
+}
+
+func decodeTraffic(t *testing.T, b []byte) []trafficEntry {
+	var entries []trafficEntry
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var e trafficEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("decodeTraffic: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
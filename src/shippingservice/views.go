@@ -0,0 +1,179 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"gopkg.in/yaml.v3"
+)
+
+// viewSpec describes one SDK metric view: the instruments it applies to and
+// how their output is reshaped.
+type viewSpec struct {
+	// Instrument is the instrument name, which may contain * and ?
+	// wildcards unless Rename is set.
+	Instrument     string    `yaml:"instrument"`
+	Rename         string    `yaml:"rename"`
+	Description    string    `yaml:"description"`
+	KeepAttributes []string  `yaml:"keep_attributes"`
+	DropAttributes []string  `yaml:"drop_attributes"`
+	Aggregation    string    `yaml:"aggregation"`
+	Buckets        []float64 `yaml:"buckets"`
+}
+
+// metricViews is the contents of METRIC_VIEWS_FILE.
+type metricViews struct {
+	// Temporality is "cumulative", "delta" or "lowmemory". When empty, the
+	// exporter follows OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE.
+	Temporality string     `yaml:"temporality"`
+	Views       []viewSpec `yaml:"views"`
+
+	views       []sdkmetric.View
+	temporality sdkmetric.TemporalitySelector
+}
+
+// parseMetricViews parses and validates a YAML view configuration. Errors
+// are reported here, because the SDK silently drops invalid views.
+func parseMetricViews(b []byte) (*metricViews, error) {
+	var mv metricViews
+	if err := yaml.Unmarshal(b, &mv); err != nil {
+		return nil, err
+	}
+	if mv.Temporality != "" {
+		var err error
+		if mv.temporality, err = temporalitySelector(mv.Temporality); err != nil {
+			return nil, err
+		}
+	}
+	for i, spec := range mv.Views {
+		v, err := spec.view()
+		if err != nil {
+			return nil, fmt.Errorf("view %d (%s): %w", i, spec.Instrument, err)
+		}
+		mv.views = append(mv.views, v)
+	}
+	return &mv, nil
+}
+
+// metricViewsFromEnv loads METRIC_VIEWS_FILE, or returns an empty
+// configuration if it is not set.
+func metricViewsFromEnv() *metricViews {
+	path := os.Getenv("METRIC_VIEWS_FILE")
+	if path == "" {
+		return &metricViews{}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("failed to read metric views: %v", err)
+	}
+	mv, err := parseMetricViews(b)
+	if err != nil {
+		log.Fatalf("invalid metric views in %s: %v", path, err)
+	}
+	log.Infof("loaded %d metric view(s) from %s", len(mv.views), path)
+	return mv
+}
+
+func (s viewSpec) view() (sdkmetric.View, error) {
+	if s.Instrument == "" {
+		return nil, fmt.Errorf("no instrument name")
+	}
+	if s.Rename != "" && strings.ContainsAny(s.Instrument, "*?") {
+		return nil, fmt.Errorf("a wildcard view cannot rename instruments")
+	}
+	if len(s.KeepAttributes) > 0 && len(s.DropAttributes) > 0 {
+		return nil, fmt.Errorf("keep_attributes and drop_attributes are mutually exclusive")
+	}
+	stream := sdkmetric.Stream{Name: s.Rename, Description: s.Description}
+	switch {
+	case len(s.KeepAttributes) > 0:
+		stream.AttributeFilter = attribute.NewAllowKeysFilter(attributeKeys(s.KeepAttributes)...)
+	case len(s.DropAttributes) > 0:
+		stream.AttributeFilter = attribute.NewDenyKeysFilter(attributeKeys(s.DropAttributes)...)
+	}
+
+	agg := strings.ToLower(s.Aggregation)
+	if len(s.Buckets) > 0 && agg != "" && agg != "explicit" {
+		return nil, fmt.Errorf("buckets only apply to the explicit aggregation")
+	}
+	switch agg {
+	case "":
+		if len(s.Buckets) > 0 {
+			stream.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: s.Buckets}
+		}
+	case "default":
+		stream.Aggregation = sdkmetric.AggregationDefault{}
+	case "drop":
+		stream.Aggregation = sdkmetric.AggregationDrop{}
+	case "sum":
+		stream.Aggregation = sdkmetric.AggregationSum{}
+	case "last_value":
+		stream.Aggregation = sdkmetric.AggregationLastValue{}
+	case "explicit":
+		if len(s.Buckets) == 0 {
+			return nil, fmt.Errorf("the explicit aggregation needs buckets")
+		}
+		stream.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: s.Buckets}
+	case "exponential":
+		stream.Aggregation = sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}
+	default:
+		return nil, fmt.Errorf("unknown aggregation %q", s.Aggregation)
+	}
+	if !sort.Float64sAreSorted(s.Buckets) {
+		return nil, fmt.Errorf("buckets must be in increasing order")
+	}
+	return sdkmetric.NewView(sdkmetric.Instrument{Name: s.Instrument}, stream), nil
+}
+
+func attributeKeys(names []string) []attribute.Key {
+	keys := make([]attribute.Key, len(names))
+	for i, n := range names {
+		keys[i] = attribute.Key(n)
+	}
+	return keys
+}
+
+// temporalitySelector returns the selector for a temporality preference, as
+// defined for OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE.
+func temporalitySelector(pref string) (sdkmetric.TemporalitySelector, error) {
+	switch strings.ToLower(pref) {
+	case "cumulative":
+		return sdkmetric.DefaultTemporalitySelector, nil
+	case "delta":
+		return func(k sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch k {
+			case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+				return metricdata.CumulativeTemporality
+			}
+			return metricdata.DeltaTemporality
+		}, nil
+	case "lowmemory":
+		return func(k sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch k {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown temporality %q", pref)
+}
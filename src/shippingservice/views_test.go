@@ -0,0 +1,97 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// TestMetricViews checks that the example views rename, filter, rebucket and drop instruments.
+func TestMetricViews(t *testing.T) {
+	b, err := os.ReadFile("views.example.yaml")
+	if err != nil {
+		t.Fatalf("TestMetricViews: %v", err)
+	}
+	mv, err := parseMetricViews(b)
+	if err != nil {
+		t.Fatalf("TestMetricViews: %v", err)
+	}
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(mv.temporality))
+	m := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(mv.views...)).Meter(serviceName)
+
+	ctx := context.Background()
+	duration, _ := m.Float64Histogram("shipping.rpc.duration")
+	duration.Record(ctx, 0.01, metric.WithAttributes(
+		attribute.String("rpc.method", "GetQuote"),
+		attribute.String("rpc.grpc.status", "OK"),
+	))
+	lookups, _ := m.Int64Counter("shipping.quote.cache.lookups")
+	lookups.Add(ctx, 1)
+	requests, _ := m.Int64Counter("shipping.rpc.requests")
+	requests.Add(ctx, 1)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("TestMetricViews: %v", err)
+	}
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, md := range sm.Metrics {
+			got[md.Name] = md.Data
+		}
+	}
+	if _, ok := got["shipping.quote.cache.lookups"]; ok {
+		t.Errorf("TestMetricViews: dropped instrument was exported")
+	}
+	h, ok := got["rpc.server.duration"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("TestMetricViews: renamed histogram missing from %v", got)
+	}
+	dp := h.DataPoints[0]
+	if len(dp.Bounds) != 5 || dp.Attributes.HasValue("rpc.grpc.status") || !dp.Attributes.HasValue("rpc.method") {
+		t.Errorf("TestMetricViews: histogram has bounds %v and attributes %v", dp.Bounds, dp.Attributes.ToSlice())
+	}
+	if h.Temporality != metricdata.DeltaTemporality {
+		t.Errorf("TestMetricViews: temporality is %s, expected delta", h.Temporality)
+	}
+	if s, ok := got["shipping.rpc.requests"].(metricdata.Sum[int64]); !ok || s.Temporality != metricdata.DeltaTemporality {
+		t.Errorf("TestMetricViews: unmatched counter was %v", got["shipping.rpc.requests"])
+	}
+}
+
+// TestMetricViewsInvalid checks that views the SDK would silently ignore are refused.
+func TestMetricViewsInvalid(t *testing.T) {
+	for _, conf := range []string{
+		"temporality: sideways",
+		"views: [{rename: x}]",
+		"views: [{instrument: 'shipping.*', rename: x}]",
+		"views: [{instrument: a, keep_attributes: [x], drop_attributes: [y]}]",
+		"views: [{instrument: a, aggregation: sum, buckets: [1]}]",
+		"views: [{instrument: a, aggregation: explicit}]",
+		"views: [{instrument: a, buckets: [2, 1]}]",
+		"views: [{instrument: a, aggregation: median}]",
+	} {
+		if _, err := parseMetricViews([]byte(conf)); err == nil {
+			t.Errorf("TestMetricViewsInvalid: %q was accepted", conf)
+		}
+	}
+}
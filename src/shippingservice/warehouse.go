@@ -0,0 +1,93 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+const defaultWarehouseLatency = "5ms/20ms/80ms"
+
+// warehouse is a fake inventory service that ShipOrder calls to reserve
+// stock. It runs in process, but is traced like a gRPC dependency, with a
+// client span per call, so that dependency failures and slowness can be
+// followed through traces even when the service is deployed on its own.
+type warehouse struct {
+	availability float64
+	latency      latencyShape
+}
+
+// warehouseFromEnv returns the fake warehouse if WAREHOUSE_FAKE is set, with
+// the availability and latency of WAREHOUSE_AVAILABILITY and
+// WAREHOUSE_LATENCY, or nil.
+func warehouseFromEnv() *warehouse {
+	if !envBool("WAREHOUSE_FAKE", false) {
+		return nil
+	}
+	spec := os.Getenv("WAREHOUSE_LATENCY")
+	if spec == "" {
+		spec = defaultWarehouseLatency
+	}
+	shapes, err := parseLatencyShapes("ReserveStock=" + spec)
+	if err != nil {
+		log.Fatalf("invalid WAREHOUSE_LATENCY: %v", err)
+	}
+	w := &warehouse{availability: envFloat("WAREHOUSE_AVAILABILITY", 1), latency: shapes["ReserveStock"]}
+	log.Infof("using the fake warehouse service: availability %v, latency p50/p95/p99 %s", w.availability, spec)
+	return w
+}
+
+// reserve reserves the items of an order. It fails with Unavailable as
+// often as the availability dictates, after the simulated latency. A nil
+// warehouse always succeeds at once.
+func (w *warehouse) reserve(ctx context.Context, items []*pb.CartItem) error {
+	if w == nil {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "hipstershop.WarehouseService/ReserveStock",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", "hipstershop.WarehouseService"),
+			attribute.String("rpc.method", "ReserveStock"),
+			attribute.String("server.address", "warehouseservice"),
+			attribute.Int("warehouse.items", itemCount(items)),
+		))
+	defer span.End()
+
+	code, msg := codes.OK, ""
+	if err := sleepContext(ctx, w.latency.sample()); err != nil {
+		code, msg = status.FromContextError(err).Code(), err.Error()
+	} else if random.Float64() >= w.availability {
+		code, msg = codes.Unavailable, "warehouse service unavailable"
+	}
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if code == codes.OK {
+		return nil
+	}
+	err := status.Error(code, msg)
+	span.RecordError(err)
+	span.SetStatus(otelcodes.Error, msg)
+	return err
+}
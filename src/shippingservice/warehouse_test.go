@@ -0,0 +1,103 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestWarehouse checks that a failing fake warehouse fails ShipOrder with a
+// retryable error, traced as a failed client call.
+func TestWarehouse(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	s := newServer()
+	s.warehouse = &warehouse{availability: 0}
+	req := &pb.ShipOrderRequest{
+		Address: &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043},
+		Items:   []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}},
+	}
+	_, err := s.ShipOrder(context.Background(), req)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("TestWarehouse: got %v, want %s", err, codes.Unavailable)
+	}
+	if info, retry := errorDetails(err); info == nil || info.Reason != reasonBackendUnavailable || retry == nil {
+		t.Errorf("TestWarehouse: ErrorInfo %v, RetryInfo %v", info, retry)
+	}
+	if n, _ := s.shipments.live(context.Background(), defaultTenant); n != 0 {
+		t.Errorf("TestWarehouse: %d shipments created", n)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("TestWarehouse: got %d spans, want 1", len(spans))
+	}
+	if sp := spans[0]; sp.Name() != "hipstershop.WarehouseService/ReserveStock" || sp.SpanKind() != trace.SpanKindClient || sp.Status().Code != otelcodes.Error {
+		t.Errorf("TestWarehouse: span %q, kind %s, status %v", sp.Name(), sp.SpanKind(), sp.Status())
+	}
+
+	s.warehouse.availability = 1
+	if _, err := s.ShipOrder(context.Background(), req); err != nil {
+		t.Errorf("TestWarehouse: available warehouse returned %v", err)
+	}
+}
+
+// TestWarehouseIdempotency checks that stock is reserved once per idempotency
+// key: a retry of a shipped order returns its tracking ID without calling
+// the warehouse, and a retry of an order the warehouse failed reserves again.
+func TestWarehouseIdempotency(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	saved := tracer
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("ExampleService")
+	defer func() { tracer = saved }()
+
+	s := newServer()
+	s.warehouse = &warehouse{availability: 0}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotencyKeyHeader, "order-44"))
+	req := &pb.ShipOrderRequest{
+		Address: &pb.Address{StreetAddress: "1600 Amphitheatre Parkway", City: "Mountain View", State: "CA", Country: "USA", ZipCode: 94043},
+		Items:   []*pb.CartItem{{ProductId: "OLJCESPC7Z", Quantity: 2}},
+	}
+	if _, err := s.ShipOrder(ctx, req); status.Code(err) != codes.Unavailable {
+		t.Fatalf("TestWarehouseIdempotency: got %v, want %s", err, codes.Unavailable)
+	}
+	s.warehouse.availability = 1
+	first, err := s.ShipOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("TestWarehouseIdempotency: retry returned %v", err)
+	}
+	s.warehouse.availability = 0
+	second, err := s.ShipOrder(ctx, req)
+	if err != nil || second.TrackingId != first.TrackingId {
+		t.Errorf("TestWarehouseIdempotency: second retry returned %v, %v, want tracking ID %q", second, err, first.TrackingId)
+	}
+	if n := len(rec.Ended()); n != 2 {
+		t.Errorf("TestWarehouseIdempotency: warehouse called %d times, want 2", n)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultWebhookAttempts = 5
+	webhookQueueSize       = 256
+	webhookWorkers         = 2
+	webhookTimeout         = 5 * time.Second
+)
+
+var errQueueFull = errors.New("webhook queue is full")
+
+// webhookDelivery is one event waiting to be POSTed to one callback URL.
+type webhookDelivery struct {
+	ctx   context.Context
+	url   string
+	event shipmentEvent
+	body  []byte
+}
+
+// webhookNotifier POSTs shipment events to registered callback URLs. Requests
+// carry W3C trace context headers, so receivers can continue the trace.
+// Deliveries are retried with exponential backoff; those that still fail are
+// written to the dead-letter log. With templates the body is rendered from
+// the webhook template, e.g. for a chat webhook, instead of being the event.
+type webhookNotifier struct {
+	urls      []string
+	client    *http.Client
+	queue     chan webhookDelivery
+	retry     retryPolicy
+	encoder   eventEncoder
+	templates *templateSource
+
+	mu         sync.Mutex
+	deadLetter io.Writer
+}
+
+func newWebhookNotifier(urls []string, deadLetter io.Writer) *webhookNotifier {
+	return &webhookNotifier{
+		urls: urls,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: otelhttp.NewTransport(newBreakerTransport(http.DefaultTransport)),
+		},
+		queue:      make(chan webhookDelivery, webhookQueueSize),
+		retry:      retryPolicy{maxAttempts: defaultWebhookAttempts, baseBackoff: 500 * time.Millisecond, maxBackoff: 30 * time.Second},
+		deadLetter: deadLetter,
+	}
+}
+
+// webhookNotifierFromEnv builds a notifier from WEBHOOK_URLS, or returns nil
+// if no URLs are configured. Bodies are rendered from templates if
+// WEBHOOK_TEMPLATE is set.
+func webhookNotifierFromEnv(templates *templateSource) *webhookNotifier {
+	urls := splitList(os.Getenv("WEBHOOK_URLS"))
+	if len(urls) == 0 {
+		return nil
+	}
+	var deadLetter io.Writer = os.Stderr
+	if path := os.Getenv("WEBHOOK_DEAD_LETTER_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("failed to open webhook dead-letter file: %v", err)
+		}
+		deadLetter = f
+	}
+	w := newWebhookNotifier(urls, deadLetter)
+	w.retry.maxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookAttempts)
+	w.encoder = eventEncoderFromEnv()
+	if envBool("WEBHOOK_TEMPLATE", false) {
+		w.templates = templates
+	}
+	log.Infof("notifying %d webhook(s) of shipment events", len(urls))
+	return w
+}
+
+// start launches the delivery workers.
+func (w *webhookNotifier) start() {
+	for i := 0; i < webhookWorkers; i++ {
+		go func() {
+			for d := range w.queue {
+				w.deliver(d)
+			}
+		}()
+	}
+}
+
+// Publish queues the event for delivery to every registered URL.
+func (w *webhookNotifier) Publish(ctx context.Context, ev shipmentEvent) error {
+	body, err := w.body(ctx, ev)
+	if err != nil {
+		return err
+	}
+	for _, url := range w.urls {
+		d := webhookDelivery{ctx: detachedContext(ctx), url: url, event: ev, body: body}
+		select {
+		case w.queue <- d:
+		default:
+			w.deadLetterDelivery(d, 0, errQueueFull)
+		}
+	}
+	return nil
+}
+
+// body returns the request body for ev.
+func (w *webhookNotifier) body(ctx context.Context, ev shipmentEvent) ([]byte, error) {
+	if w.templates == nil {
+		return w.encoder.encode(ctx, ev)
+	}
+	body, err := w.templates.render(ctx, "webhook", eventMessageData(ev))
+	return []byte(body), err
+}
+
+// contentType is the content type of the request bodies. Templates must
+// produce JSON.
+func (w *webhookNotifier) contentType() string {
+	if w.templates == nil {
+		return w.encoder.contentType()
+	}
+	return eventContentType
+}
+
+// deliver POSTs a single delivery, retrying until it succeeds, fails
+// permanently or runs out of attempts.
+func (w *webhookNotifier) deliver(d webhookDelivery) {
+	ctx, span := tracer.Start(d.ctx, "webhook.deliver", trace.WithAttributes(
+		attribute.String("webhook.url", d.url),
+		attribute.String("event.type", d.event.Type),
+		attribute.String("event.id", d.event.ID),
+	))
+	defer span.End()
+
+	var err error
+	attempt := 1
+	for ; attempt <= w.retry.maxAttempts; attempt++ {
+		if err = w.post(ctx, d.url, d.body); err == nil {
+			break
+		}
+		span.AddEvent("webhook.attempt_failed", trace.WithAttributes(
+			attribute.Int("webhook.attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		var perm permanentError
+		if errors.As(err, &perm) || attempt == w.retry.maxAttempts {
+			break
+		}
+		if sleepContext(ctx, w.retry.backoff(attempt)) != nil {
+			break
+		}
+	}
+	span.SetAttributes(attribute.Int("webhook.attempts", attempt))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		w.deadLetterDelivery(d, attempt, err)
+	}
+}
+
+// permanentError marks a failure that retrying will not fix.
+type permanentError struct{ error }
+
+func (w *webhookNotifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", w.contentType())
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return permanentError{fmt.Errorf("webhook returned %s", resp.Status)}
+	}
+}
+
+func (w *webhookNotifier) deadLetterDelivery(d webhookDelivery, attempts int, cause error) {
+	log.WithError(cause).Errorf("giving up on webhook %s for event %s after %d attempt(s)", d.url, d.event.ID, attempts)
+	line, err := json.Marshal(struct {
+		Time     time.Time     `json:"time"`
+		URL      string        `json:"url"`
+		Attempts int           `json:"attempts"`
+		Error    string        `json:"error"`
+		Event    shipmentEvent `json:"event"`
+	}{time.Now().UTC(), d.url, attempts, cause.Error(), d.event})
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadLetter.Write(append(line, '\n'))
+}
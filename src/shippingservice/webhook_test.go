@@ -0,0 +1,99 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+func testEvent() shipmentEvent {
+	return newShipmentEvent(eventShipmentStatusChanged, defaultTenant, "AB-123", pb.ShipmentStatus_SHIPMENT_STATUS_CREATED, pb.ShipmentStatus_SHIPMENT_STATUS_CANCELLED)
+}
+
+// TestWebhookRetries checks that a failed delivery is retried until it succeeds.
+func TestWebhookRetries(t *testing.T) {
+	var calls int32
+	received := make(chan shipmentEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var ev shipmentEvent
+		json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer srv.Close()
+
+	var deadLetter bytes.Buffer
+	w := newWebhookNotifier([]string{srv.URL}, &deadLetter)
+	w.retry.baseBackoff = time.Millisecond
+	w.deliver(webhookDelivery{ctx: context.Background(), url: srv.URL, event: testEvent(), body: mustJSON(t, testEvent())})
+
+	select {
+	case ev := <-received:
+		if ev.TrackingID != "AB-123" || ev.Status != "SHIPMENT_STATUS_CANCELLED" {
+			t.Errorf("TestWebhookRetries: unexpected event %+v", ev)
+		}
+	default:
+		t.Fatal("TestWebhookRetries: event was not delivered")
+	}
+	if calls != 2 {
+		t.Errorf("TestWebhookRetries: %d calls, expected 2", calls)
+	}
+	if deadLetter.Len() != 0 {
+		t.Errorf("TestWebhookRetries: unexpected dead letter %q", deadLetter.String())
+	}
+}
+
+// TestWebhookDeadLetter checks that permanently failing deliveries end up in the dead-letter log.
+func TestWebhookDeadLetter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	var deadLetter bytes.Buffer
+	w := newWebhookNotifier([]string{srv.URL}, &deadLetter)
+	w.retry.baseBackoff = time.Millisecond
+	w.deliver(webhookDelivery{ctx: context.Background(), url: srv.URL, event: testEvent(), body: mustJSON(t, testEvent())})
+
+	if calls != 1 {
+		t.Errorf("TestWebhookDeadLetter: %d calls, expected 1 for a permanent failure", calls)
+	}
+	if !strings.Contains(deadLetter.String(), `"tracking_id":"AB-123"`) {
+		t.Errorf("TestWebhookDeadLetter: dead letter %q does not contain the event", deadLetter.String())
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// originZipPrefix is the first digit of the zip code all orders ship from.
+const originZipPrefix = 9
+
+// zone groups destinations by distance from the warehouse. Domestic zones run
+// from 1 (closest) to 8; everything outside the US is zoneInternational.
+type zone int
+
+const (
+	zoneLocal         zone = 1
+	zoneFarthest      zone = 8
+	zoneInternational zone = 9
+)
+
+// zoneNames are the names of the zones from zoneLocal to zoneInternational,
+// which quotes and their metrics use on every call.
+var zoneNames = []string{"zone-1", "zone-2", "zone-3", "zone-4", "zone-5", "zone-6", "zone-7", "zone-8", "international"}
+
+func (z zone) String() string {
+	if z >= zoneLocal && z <= zoneInternational {
+		return zoneNames[z-zoneLocal]
+	}
+	return "zone-" + strconv.Itoa(int(z))
+}
+
+// isDomestic reports whether the address is in the US. An empty country is
+// treated as domestic, since most demo traffic leaves it blank.
+func isDomestic(a *pb.Address) bool {
+	switch strings.ToUpper(strings.TrimSpace(a.GetCountry())) {
+	case "", "US", "USA", "UNITED STATES", "UNITED STATES OF AMERICA":
+		return true
+	}
+	return false
+}
+
+// destinationZone works out the shipping zone of an address from the distance
+// between its zip code prefix and the warehouse's. Zip codes are numbers, so
+// 02110 is 2110: the prefix is the ten-thousands digit, 0 for New England.
+func destinationZone(a *pb.Address) zone {
+	if !isDomestic(a) {
+		return zoneInternational
+	}
+	zip := a.GetZipCode()
+	if zip <= 0 || zip > 99999 {
+		return zoneFarthest
+	}
+	prefix := int(zip / 10000)
+	d := prefix - originZipPrefix
+	if d < 0 {
+		d = -d
+	}
+	if z := zoneLocal + zone(d); z < zoneFarthest {
+		return z
+	}
+	return zoneFarthest
+}
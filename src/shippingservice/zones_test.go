@@ -0,0 +1,44 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	pb "github.com/GoogleCloudPlatform/microservices-demo/src/shippingservice/genproto"
+)
+
+// TestDestinationZone checks that zones follow the first digit of five-digit
+// zip codes, including those that start with 0.
+func TestDestinationZone(t *testing.T) {
+	for _, tc := range []struct {
+		address *pb.Address
+		want    zone
+	}{
+		{&pb.Address{ZipCode: 94043}, zoneLocal},
+		{&pb.Address{ZipCode: 10001}, zoneFarthest},
+		{&pb.Address{ZipCode: 30301}, 7},
+		{&pb.Address{ZipCode: 2110}, zoneFarthest}, // Boston, 02110
+		{&pb.Address{ZipCode: 7302}, zoneFarthest}, // Jersey City, 07302
+		{&pb.Address{ZipCode: 60601}, 4},
+		{&pb.Address{ZipCode: 0}, zoneFarthest},
+		{&pb.Address{ZipCode: 940431}, zoneFarthest},
+		{&pb.Address{ZipCode: 94043, Country: "Canada"}, zoneInternational},
+	} {
+		if got := destinationZone(tc.address); got != tc.want {
+			t.Errorf("TestDestinationZone: zip %05d in %q is in %s, want %s", tc.address.ZipCode, tc.address.Country, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// zpagesSamples is the number of spans kept per latency bucket, and of
+	// failed spans, for each span name.
+	zpagesSamples = 10
+	// maxZPagesNames bounds the span names tracked, in case a name is
+	// made from request data.
+	maxZPagesNames = 1000
+)
+
+// zpagesBuckets are the upper bounds of the latency buckets of tracez, the
+// same as OpenCensus zPages.
+var zpagesBuckets = []time.Duration{
+	10 * time.Microsecond, 100 * time.Microsecond, time.Millisecond,
+	10 * time.Millisecond, 100 * time.Millisecond, time.Second,
+	10 * time.Second, 100 * time.Second,
+}
+
+// zpages is a span processor keeping running spans and samples of finished
+// ones in memory, served as the tracez and rpcz debug pages. It works
+// without a collector, so telemetry can be inspected even when export fails.
+type zpages struct {
+	mu      sync.Mutex
+	running map[trace.SpanID]sdktrace.ReadOnlySpan
+	names   map[string]*zpagesName
+	rpcs    map[zpagesRPCKey]*zpagesRPC
+}
+
+// zpagesName holds the samples of one span name.
+type zpagesName struct {
+	counts  []int // per latency bucket, and one for errors
+	samples [][]sdktrace.ReadOnlySpan
+}
+
+type zpagesRPCKey struct {
+	Method string
+	Kind   string
+}
+
+// zpagesRPC sums up the calls of one RPC method.
+type zpagesRPC struct {
+	Count, Errors int
+	Total, Max    time.Duration
+}
+
+func newZPages() *zpages {
+	return &zpages{
+		running: make(map[trace.SpanID]sdktrace.ReadOnlySpan),
+		names:   make(map[string]*zpagesName),
+		rpcs:    make(map[zpagesRPCKey]*zpagesRPC),
+	}
+}
+
+func (z *zpages) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.running[s.SpanContext().SpanID()] = s
+}
+
+func (z *zpages) OnEnd(s sdktrace.ReadOnlySpan) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	delete(z.running, s.SpanContext().SpanID())
+
+	n, ok := z.names[s.Name()]
+	if !ok {
+		if len(z.names) >= maxZPagesNames {
+			return
+		}
+		n = &zpagesName{
+			counts:  make([]int, len(zpagesBuckets)+2),
+			samples: make([][]sdktrace.ReadOnlySpan, len(zpagesBuckets)+2),
+		}
+		z.names[s.Name()] = n
+	}
+	d := s.EndTime().Sub(s.StartTime())
+	i := zpagesBucket(d)
+	if s.Status().Code == codes.Error {
+		i = len(zpagesBuckets) + 1
+	}
+	n.counts[i]++
+	n.samples[i] = append(n.samples[i], s)
+	if len(n.samples[i]) > zpagesSamples {
+		n.samples[i] = n.samples[i][1:]
+	}
+
+	if method := rpcMethod(s); method != "" {
+		key := zpagesRPCKey{method, s.SpanKind().String()}
+		r, ok := z.rpcs[key]
+		if !ok {
+			r = &zpagesRPC{}
+			z.rpcs[key] = r
+		}
+		r.Count++
+		if s.Status().Code == codes.Error {
+			r.Errors++
+		}
+		r.Total += d
+		if d > r.Max {
+			r.Max = d
+		}
+	}
+}
+
+func (z *zpages) Shutdown(context.Context) error   { return nil }
+func (z *zpages) ForceFlush(context.Context) error { return nil }
+
+// zpagesBucket returns the latency bucket of a duration.
+func zpagesBucket(d time.Duration) int {
+	return sort.Search(len(zpagesBuckets), func(i int) bool { return d < zpagesBuckets[i] })
+}
+
+// rpcMethod returns "service/method" for RPC spans, or "".
+func rpcMethod(s sdktrace.ReadOnlySpan) string {
+	var service, method string
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case "rpc.service":
+			service = kv.Value.AsString()
+		case "rpc.method":
+			method = kv.Value.AsString()
+		}
+	}
+	if method == "" {
+		return ""
+	}
+	return service + "/" + method
+}
+
+// zpagesSummary is a row of the tracez summary.
+type zpagesSummary struct {
+	Name    string
+	Running int
+	Counts  []int
+}
+
+// zpagesSpan is a span as shown in the tracez details.
+type zpagesSpan struct {
+	TraceID, SpanID string
+	Start           time.Time
+	Elapsed         time.Duration
+	Status          string
+	Attributes      []string
+	Events          []string
+}
+
+func newZPagesSpan(s sdktrace.ReadOnlySpan, now time.Time) zpagesSpan {
+	v := zpagesSpan{
+		TraceID: s.SpanContext().TraceID().String(),
+		SpanID:  s.SpanContext().SpanID().String(),
+		Start:   s.StartTime(),
+		Status:  s.Status().Code.String(),
+	}
+	if d := s.Status().Description; d != "" {
+		v.Status += ": " + d
+	}
+	// Attributes are only filtered by the attribute policy once a span has
+	// ended, so those of running spans are not shown.
+	if s.EndTime().IsZero() {
+		v.Elapsed = now.Sub(s.StartTime())
+		return v
+	}
+	v.Elapsed = s.EndTime().Sub(s.StartTime())
+	for _, kv := range s.Attributes() {
+		v.Attributes = append(v.Attributes, string(kv.Key)+"="+kv.Value.Emit())
+	}
+	for _, e := range s.Events() {
+		v.Events = append(v.Events, e.Time.Sub(s.StartTime()).String()+" "+e.Name)
+	}
+	return v
+}
+
+// tracez serves the span summary, or the spans of a name selected by the
+// name and bucket parameters: a latency bucket index, "running" or
+// "errors".
+func (z *zpages) tracez() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, bucket := r.URL.Query().Get("name"), r.URL.Query().Get("bucket")
+		now := time.Now()
+		data := struct {
+			Buckets []string
+			Summary []zpagesSummary
+			Name    string
+			Bucket  string
+			Spans   []zpagesSpan
+		}{Name: name, Bucket: bucket}
+		for i, b := range zpagesBuckets {
+			if i == 0 {
+				data.Buckets = append(data.Buckets, "<"+b.String())
+			} else {
+				data.Buckets = append(data.Buckets, zpagesBuckets[i-1].String()+"-"+b.String())
+			}
+		}
+		data.Buckets = append(data.Buckets, ">"+zpagesBuckets[len(zpagesBuckets)-1].String())
+
+		z.mu.Lock()
+		running := make(map[string]int)
+		for _, s := range z.running {
+			running[s.Name()]++
+			if name == s.Name() && bucket == "running" {
+				data.Spans = append(data.Spans, newZPagesSpan(s, now))
+			}
+		}
+		for n, st := range z.names {
+			data.Summary = append(data.Summary, zpagesSummary{Name: n, Running: running[n], Counts: append([]int(nil), st.counts...)})
+			delete(running, n)
+			if n != name {
+				continue
+			}
+			i, err := strconv.Atoi(bucket)
+			if bucket == "errors" {
+				i, err = len(zpagesBuckets)+1, nil
+			}
+			if err == nil && i >= 0 && i < len(st.samples) {
+				for _, s := range st.samples[i] {
+					data.Spans = append(data.Spans, newZPagesSpan(s, now))
+				}
+			}
+		}
+		// Names with running spans that have not yet finished once.
+		for n, c := range running {
+			data.Summary = append(data.Summary, zpagesSummary{Name: n, Running: c, Counts: make([]int, len(zpagesBuckets)+2)})
+		}
+		z.mu.Unlock()
+
+		sort.Slice(data.Summary, func(i, j int) bool { return data.Summary[i].Name < data.Summary[j].Name })
+		sort.Slice(data.Spans, func(i, j int) bool { return data.Spans[i].Start.After(data.Spans[j].Start) })
+		renderZPage(w, tracezTemplate, data)
+	})
+}
+
+// zpagesRPCRow is a row of rpcz.
+type zpagesRPCRow struct {
+	zpagesRPCKey
+	zpagesRPC
+	Mean time.Duration
+}
+
+// rpcz serves the call count, error count and latency of every RPC method,
+// as seen by the server and client spans.
+func (z *zpages) rpcz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rows []zpagesRPCRow
+		z.mu.Lock()
+		for k, v := range z.rpcs {
+			rows = append(rows, zpagesRPCRow{zpagesRPCKey: k, zpagesRPC: *v, Mean: v.Total / time.Duration(v.Count)})
+		}
+		z.mu.Unlock()
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].Kind != rows[j].Kind {
+				return rows[i].Kind > rows[j].Kind // server first
+			}
+			return rows[i].Method < rows[j].Method
+		})
+		renderZPage(w, rpczTemplate, rows)
+	})
+}
+
+func renderZPage(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		log.WithError(err).Warn("failed to render zPage")
+	}
+}
+
+var tracezTemplate = template.Must(template.New("tracez").Parse(`<!DOCTYPE html>
+<html><head><title>tracez</title><style>
+body { font-family: sans-serif; } table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: right; } td:first-child { text-align: left; }
+</style></head><body>
+<h1>tracez</h1>
+<table>
+<tr><th>Span name</th><th>Running</th>{{range .Buckets}}<th>{{.}}</th>{{end}}<th>Errors</th></tr>
+{{range $s := .Summary}}<tr><td>{{$s.Name}}</td>
+<td><a href="?name={{$s.Name}}&bucket=running">{{$s.Running}}</a></td>
+{{range $i, $c := $s.Counts}}{{if lt $i (len $.Buckets)}}<td><a href="?name={{$s.Name}}&bucket={{$i}}">{{$c}}</a></td>{{else}}<td><a href="?name={{$s.Name}}&bucket=errors">{{$c}}</a></td>{{end}}{{end}}
+</tr>{{end}}
+</table>
+{{if .Name}}<h2>{{.Name}} ({{.Bucket}})</h2>
+<table>
+<tr><th>Start</th><th>Elapsed</th><th>Trace ID</th><th>Span ID</th><th>Status</th><th>Attributes</th><th>Events</th></tr>
+{{range .Spans}}<tr><td>{{.Start.Format "15:04:05.000000"}}</td><td>{{.Elapsed}}</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td><td>{{.Status}}</td>
+<td>{{range .Attributes}}{{.}}<br>{{end}}</td><td>{{range .Events}}{{.}}<br>{{end}}</td></tr>{{end}}
+</table>{{end}}
+</body></html>
+`))
+
+var rpczTemplate = template.Must(template.New("rpcz").Parse(`<!DOCTYPE html>
+<html><head><title>rpcz</title><style>
+body { font-family: sans-serif; } table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: right; } td:first-child { text-align: left; }
+</style></head><body>
+<h1>rpcz</h1>
+<table>
+<tr><th>Method</th><th>Kind</th><th>Count</th><th>Errors</th><th>Mean latency</th><th>Max latency</th></tr>
+{{range .}}<tr><td>{{.Method}}</td><td>{{.Kind}}</td><td>{{.Count}}</td><td>{{.Errors}}</td><td>{{.Mean}}</td><td>{{.Max}}</td></tr>{{end}}
+</table>
+</body></html>
+`))
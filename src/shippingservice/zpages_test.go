@@ -0,0 +1,88 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func getZPage(h http.Handler, query string) string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/tracez"+query, nil))
+	return rec.Body.String()
+}
+
+// TestZPages checks that running spans, latency samples, errors and RPC
+// statistics are shown.
+func TestZPages(t *testing.T) {
+	zp := newZPages()
+	tr := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(zp)).Tracer("test")
+	ctx := context.Background()
+	start := time.Now()
+	end := func(name string, d time.Duration, opts ...trace.SpanStartOption) trace.Span {
+		_, s := tr.Start(ctx, name, append(opts, trace.WithTimestamp(start))...)
+		s.End(trace.WithTimestamp(start.Add(d)))
+		return s
+	}
+
+	_, running := tr.Start(ctx, "Stuck")
+	defer running.End()
+	for i := 0; i < zpagesSamples+5; i++ {
+		end("Quote", 5*time.Millisecond)
+	}
+	slow := end("Quote", 2*time.Second)
+	_, failed := tr.Start(ctx, "Quote")
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+	end("hipstershop.ShippingService/GetQuote", 3*time.Millisecond,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("rpc.service", "hipstershop.ShippingService"), attribute.String("rpc.method", "GetQuote")))
+
+	tracez := zp.tracez()
+	summary := getZPage(tracez, "")
+	for _, want := range []string{"Stuck", "Quote", "10ms-100ms"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("TestZPages: summary does not contain %q", want)
+		}
+	}
+	if page := getZPage(tracez, "?name=Stuck&bucket=running"); !strings.Contains(page, running.SpanContext().SpanID().String()) {
+		t.Errorf("TestZPages: running span is not listed")
+	}
+	if page := getZPage(tracez, "?name=Quote&bucket=3"); strings.Count(page, "<td>5ms</td>") != zpagesSamples {
+		t.Errorf("TestZPages: got %d spans in the 1ms-10ms bucket, expected %d samples", strings.Count(page, "<td>5ms</td>"), zpagesSamples)
+	}
+	if page := getZPage(tracez, "?name=Quote&bucket=6"); !strings.Contains(page, slow.SpanContext().SpanID().String()) {
+		t.Errorf("TestZPages: slow span is not in the 1s-10s bucket")
+	}
+	if page := getZPage(tracez, "?name=Quote&bucket=errors"); !strings.Contains(page, failed.SpanContext().SpanID().String()) || !strings.Contains(page, "boom") {
+		t.Errorf("TestZPages: failed span is not listed with its status")
+	}
+
+	rec := httptest.NewRecorder()
+	zp.rpcz().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/rpcz", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "hipstershop.ShippingService/GetQuote") || !strings.Contains(body, "3ms") {
+		t.Errorf("TestZPages: rpcz does not show GetQuote: %s", body)
+	}
+}